@@ -0,0 +1,223 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	defaultAdaptiveInitialLimit = 20
+	defaultAdaptiveMinLimit     = 1
+	defaultAdaptiveMaxLimit     = 1000
+	defaultAdaptiveTolerance    = 1.5
+	defaultAdaptiveSmoothing    = 0.2
+
+	// The long-term latency average adapts over roughly this many calls, and
+	// the short-term average over far fewer.
+	adaptiveLongWindow  = 600
+	adaptiveShortWindow = 10
+)
+
+// AdaptiveConcurrency configures the limiter installed by
+// [WithAdaptiveConcurrency]. Zero fields use the defaults noted below.
+type AdaptiveConcurrency struct {
+	// InitialLimit is the concurrency limit before any latencies have been
+	// observed. It defaults to 20.
+	InitialLimit int
+	// MinLimit and MaxLimit bound the limit. They default to 1 and 1000.
+	MinLimit int
+	MaxLimit int
+	// Tolerance is how much recent latency may exceed the long-term baseline
+	// before the limit shrinks: 1.5 tolerates a 50% increase. It defaults to
+	// 1.5 and must be at least 1.
+	Tolerance float64
+	// Smoothing is the weight given to each new limit estimate, from 0 to 1.
+	// Smaller values make the limit change more slowly. It defaults to 0.2.
+	Smoothing float64
+	// Procedures replaces the configuration for individual procedures, keyed
+	// by procedure name (for example, "/acme.foo.v1.FooService/Bar"). Zero
+	// fields of the replacements use the defaults, and their Procedures are
+	// ignored.
+	Procedures map[string]AdaptiveConcurrency
+}
+
+// WithAdaptiveConcurrency sheds load before latency collapses. Each procedure
+// gets its own concurrency limit, which tracks a gradient of short-term
+// latency against a long-term baseline, in the style of Netflix's
+// concurrency-limits library: while latency stays near the baseline, the limit
+// grows; when latency rises, the limit shrinks. Calls that arrive while the
+// procedure is at its limit fail immediately with [CodeResourceExhausted], so
+// clients can back off or try another server.
+//
+// Streaming calls count towards the limit while they run, but only unary calls
+// contribute latency measurements. The limiter is implemented as an
+// interceptor, so its position relative to other interceptors follows the
+// order of options.
+func WithAdaptiveConcurrency(config AdaptiveConcurrency) HandlerOption {
+	return WithInterceptors(&adaptiveConcurrencyInterceptor{
+		config:   config,
+		limiters: make(map[string]*gradientLimiter),
+	})
+}
+
+type adaptiveConcurrencyInterceptor struct {
+	config AdaptiveConcurrency
+
+	mu       sync.Mutex
+	limiters map[string]*gradientLimiter
+}
+
+func (i *adaptiveConcurrencyInterceptor) WrapUnary(next UnaryFunc) UnaryFunc {
+	return func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
+		if request.Spec().IsClient {
+			return next(ctx, request)
+		}
+		limiter := i.limiter(request.Spec().Procedure)
+		if err := limiter.acquire(); err != nil {
+			return nil, err
+		}
+		start := time.Now()
+		response, err := next(ctx, request)
+		if ctx.Err() != nil {
+			// The client gave up or the call timed out, so the latency isn't
+			// meaningful.
+			limiter.release(0)
+		} else {
+			limiter.release(time.Since(start))
+		}
+		return response, err
+	}
+}
+
+func (i *adaptiveConcurrencyInterceptor) WrapStreamingClient(next StreamingClientFunc) StreamingClientFunc {
+	return next
+}
+
+func (i *adaptiveConcurrencyInterceptor) WrapStreamingHandler(next StreamingHandlerFunc) StreamingHandlerFunc {
+	return func(ctx context.Context, conn StreamingHandlerConn) error {
+		limiter := i.limiter(conn.Spec().Procedure)
+		if err := limiter.acquire(); err != nil {
+			return err
+		}
+		defer limiter.release(0)
+		return next(ctx, conn)
+	}
+}
+
+func (i *adaptiveConcurrencyInterceptor) limiter(procedure string) *gradientLimiter {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	limiter, ok := i.limiters[procedure]
+	if !ok {
+		config := i.config
+		if override, ok := i.config.Procedures[procedure]; ok {
+			config = override
+		}
+		limiter = newGradientLimiter(config)
+		i.limiters[procedure] = limiter
+	}
+	return limiter
+}
+
+// gradientLimiter adjusts a concurrency limit using the ratio of long-term to
+// short-term latency.
+type gradientLimiter struct {
+	minLimit  float64
+	maxLimit  float64
+	tolerance float64
+	smoothing float64
+
+	mu       sync.Mutex
+	limit    float64
+	inflight int
+	longRTT  float64 // nanoseconds
+	shortRTT float64 // nanoseconds
+}
+
+func newGradientLimiter(config AdaptiveConcurrency) *gradientLimiter {
+	limiter := &gradientLimiter{
+		limit:     float64(defaultAdaptiveInitialLimit),
+		minLimit:  float64(defaultAdaptiveMinLimit),
+		maxLimit:  float64(defaultAdaptiveMaxLimit),
+		tolerance: defaultAdaptiveTolerance,
+		smoothing: defaultAdaptiveSmoothing,
+	}
+	if config.InitialLimit > 0 {
+		limiter.limit = float64(config.InitialLimit)
+	}
+	if config.MinLimit > 0 {
+		limiter.minLimit = float64(config.MinLimit)
+	}
+	if config.MaxLimit > 0 {
+		limiter.maxLimit = float64(config.MaxLimit)
+	}
+	if config.Tolerance >= 1 {
+		limiter.tolerance = config.Tolerance
+	}
+	if config.Smoothing > 0 && config.Smoothing <= 1 {
+		limiter.smoothing = config.Smoothing
+	}
+	limiter.limit = math.Max(limiter.minLimit, math.Min(limiter.maxLimit, limiter.limit))
+	return limiter
+}
+
+func (l *gradientLimiter) acquire() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if float64(l.inflight) >= math.Floor(l.limit) {
+		return errorf(CodeResourceExhausted, "server overloaded: concurrency limit of %d reached", int(l.limit))
+	}
+	l.inflight++
+	return nil
+}
+
+// release frees the call's slot and, if rtt is positive, updates the limit.
+func (l *gradientLimiter) release(rtt time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	inflight := l.inflight
+	l.inflight--
+	if rtt > 0 {
+		l.observe(float64(rtt), inflight)
+	}
+}
+
+// observe updates the limit with a latency sample from a call that ran with
+// the supplied number of calls in flight.
+func (l *gradientLimiter) observe(rtt float64, inflight int) {
+	if l.longRTT == 0 {
+		l.longRTT, l.shortRTT = rtt, rtt
+		return
+	}
+	l.shortRTT += (rtt - l.shortRTT) / adaptiveShortWindow
+	l.longRTT += (rtt - l.longRTT) / adaptiveLongWindow
+	if l.longRTT > 2*l.shortRTT {
+		// Latency has dropped well below the baseline, perhaps after a
+		// sustained spike, so let the baseline catch up quickly.
+		l.longRTT *= 0.95
+	}
+	if float64(inflight) < l.limit/2 {
+		// The limit isn't being tested, so latency says nothing about it.
+		return
+	}
+	gradient := math.Max(0.5, math.Min(1, l.tolerance*l.longRTT/l.shortRTT))
+	estimate := l.limit*gradient + math.Sqrt(l.limit)
+	limit := l.limit*(1-l.smoothing) + estimate*l.smoothing
+	l.limit = math.Max(l.minLimit, math.Min(l.maxLimit, limit))
+}
@@ -0,0 +1,86 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bufbuild/connect-go/internal/assert"
+)
+
+func TestGradientLimiter(t *testing.T) {
+	t.Parallel()
+	// saturate runs calls with the supplied latency, keeping the limiter full.
+	saturate := func(limiter *gradientLimiter, rtt time.Duration, calls int) {
+		for i := 0; i < calls; i++ {
+			limiter.observe(float64(rtt), int(limiter.limit))
+		}
+	}
+	t.Run("grows_while_latency_is_steady", func(t *testing.T) {
+		t.Parallel()
+		limiter := newGradientLimiter(AdaptiveConcurrency{InitialLimit: 10, MaxLimit: 50})
+		saturate(limiter, 10*time.Millisecond, 100)
+		assert.Equal(t, limiter.limit, 50.0)
+	})
+	t.Run("shrinks_when_latency_rises", func(t *testing.T) {
+		t.Parallel()
+		limiter := newGradientLimiter(AdaptiveConcurrency{InitialLimit: 100})
+		saturate(limiter, 10*time.Millisecond, 10)
+		before := limiter.limit
+		saturate(limiter, 50*time.Millisecond, 50)
+		assert.True(t, limiter.limit < before/4, assert.Sprintf("limit %v, was %v", limiter.limit, before))
+		// Under sustained overload, the limit settles where the headroom
+		// for queueing balances the halved estimate.
+		saturate(limiter, time.Second, 200)
+		assert.True(t, limiter.limit < 5, assert.Sprintf("limit %v", limiter.limit))
+	})
+	t.Run("ignores_idle_samples", func(t *testing.T) {
+		t.Parallel()
+		limiter := newGradientLimiter(AdaptiveConcurrency{})
+		saturate(limiter, 10*time.Millisecond, 10)
+		before := limiter.limit
+		for i := 0; i < 100; i++ {
+			limiter.observe(float64(time.Second), 1)
+		}
+		assert.Equal(t, limiter.limit, before)
+	})
+	t.Run("sheds_at_limit", func(t *testing.T) {
+		t.Parallel()
+		limiter := newGradientLimiter(AdaptiveConcurrency{InitialLimit: 2})
+		assert.Nil(t, limiter.acquire())
+		assert.Nil(t, limiter.acquire())
+		err := limiter.acquire()
+		assert.Equal(t, CodeOf(err), CodeResourceExhausted)
+		limiter.release(0)
+		assert.Nil(t, limiter.acquire())
+	})
+	t.Run("per_procedure", func(t *testing.T) {
+		t.Parallel()
+		interceptor := &adaptiveConcurrencyInterceptor{
+			config: AdaptiveConcurrency{
+				InitialLimit: 5,
+				Procedures: map[string]AdaptiveConcurrency{
+					"/foo.v1.FooService/Bar": {InitialLimit: 1},
+				},
+			},
+			limiters: make(map[string]*gradientLimiter),
+		}
+		assert.Equal(t, interceptor.limiter("/foo.v1.FooService/Baz").limit, 5.0)
+		bar := interceptor.limiter("/foo.v1.FooService/Bar")
+		assert.Equal(t, bar.limit, 1.0)
+		assert.True(t, interceptor.limiter("/foo.v1.FooService/Bar") == bar)
+	})
+}
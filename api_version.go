@@ -0,0 +1,149 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+const (
+	// apiVersionsHeader lists the application-level API versions a client
+	// supports, in order of preference.
+	apiVersionsHeader = "Api-Versions"
+	// apiVersionHeader is the API version the handler chose.
+	apiVersionHeader = "Api-Version"
+)
+
+var apiVersionContextValue = NewContextValue[string]("connect API version")
+
+// WithAPIVersions configures application-level API version negotiation, which
+// lets a single procedure evolve its semantics without changing its schema.
+//
+// Clients send the versions they support, in order of preference, with each
+// request. Handlers pick the first of the client's versions that they also
+// support (or their own first version, if the client didn't send any), report
+// it to the client in a response header, and make it available to
+// implementations with [APIVersionFromContext]. Clients can read the
+// negotiated version from the response headers with [NegotiatedAPIVersion].
+// Handlers reject calls from clients that don't support any of the handler's
+// versions with [CodeUnimplemented].
+//
+// Negotiation is implemented as an interceptor, so its position relative to
+// other interceptors follows the order of options.
+func WithAPIVersions(versions ...string) Option {
+	return WithInterceptors(&apiVersionInterceptor{versions: versions})
+}
+
+// APIVersionFromContext returns the API version negotiated for the current
+// call. It reports false if the handler wasn't configured with
+// [WithAPIVersions].
+func APIVersionFromContext(ctx context.Context) (string, bool) {
+	return apiVersionContextValue.From(ctx)
+}
+
+// NegotiatedAPIVersion returns the API version the handler chose, as reported
+// in the response headers. It returns an empty string if the handler didn't
+// negotiate a version.
+func NegotiatedAPIVersion(responseHeader http.Header) string {
+	return responseHeader.Get(apiVersionHeader)
+}
+
+// apiVersionInterceptor sends the supported versions client-side, and
+// negotiates a version handler-side.
+type apiVersionInterceptor struct {
+	versions []string
+}
+
+func (i *apiVersionInterceptor) WrapUnary(next UnaryFunc) UnaryFunc {
+	return func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
+		if request.Spec().IsClient {
+			i.writeVersions(request.Header())
+			return next(ctx, request)
+		}
+		version, err := i.negotiate(request.Header())
+		if err != nil {
+			return nil, err
+		}
+		response, err := next(apiVersionContextValue.With(ctx, version), request)
+		if err != nil {
+			if connectErr, ok := asError(err); ok {
+				connectErr.Meta().Set(apiVersionHeader, version)
+			}
+			return nil, err
+		}
+		response.Header().Set(apiVersionHeader, version)
+		return response, nil
+	}
+}
+
+func (i *apiVersionInterceptor) WrapStreamingClient(next StreamingClientFunc) StreamingClientFunc {
+	return func(ctx context.Context, spec Spec) StreamingClientConn {
+		conn := next(ctx, spec)
+		i.writeVersions(conn.RequestHeader())
+		return conn
+	}
+}
+
+func (i *apiVersionInterceptor) WrapStreamingHandler(next StreamingHandlerFunc) StreamingHandlerFunc {
+	return func(ctx context.Context, conn StreamingHandlerConn) error {
+		version, err := i.negotiate(conn.RequestHeader())
+		if err != nil {
+			return err
+		}
+		conn.ResponseHeader().Set(apiVersionHeader, version)
+		return next(apiVersionContextValue.With(ctx, version), conn)
+	}
+}
+
+func (i *apiVersionInterceptor) writeVersions(header http.Header) {
+	if len(i.versions) > 0 {
+		header.Set(apiVersionsHeader, strings.Join(i.versions, ", "))
+	}
+}
+
+// negotiate picks the first of the client's versions that the handler
+// supports.
+func (i *apiVersionInterceptor) negotiate(header http.Header) (string, error) {
+	offered := header.Values(apiVersionsHeader)
+	if len(offered) == 0 {
+		if len(i.versions) == 0 {
+			return "", nil
+		}
+		return i.versions[0], nil
+	}
+	var clientVersions []string
+	for _, value := range offered {
+		for _, version := range strings.Split(value, ",") {
+			if version = strings.TrimSpace(version); version != "" {
+				clientVersions = append(clientVersions, version)
+			}
+		}
+	}
+	for _, version := range clientVersions {
+		for _, supported := range i.versions {
+			if version == supported {
+				return version, nil
+			}
+		}
+	}
+	return "", errorf(
+		CodeUnimplemented,
+		"unsupported API versions %s: supported versions are %s",
+		strings.Join(clientVersions, ", "),
+		strings.Join(i.versions, ", "),
+	)
+}
@@ -0,0 +1,257 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// An AuditRecord describes one call handled by a server: who made it, which
+// procedure it called, when, and with what outcome. Records are chained
+// together by their hashes, so deleting, reordering, or editing a stored
+// record breaks the chain; [VerifyAuditChain] checks it.
+type AuditRecord struct {
+	// Sequence numbers records from 1, with no gaps.
+	Sequence  uint64
+	Time      time.Time
+	Procedure string
+	Peer      Peer
+	// CallID is the call's ID, if the handler uses [WithCallIDs].
+	CallID string
+	// Code is the call's outcome. It's zero if the call succeeded.
+	Code     Code
+	Duration time.Duration
+	// Fields holds the request fields selected for auditing, formatted as
+	// strings. Fields that aren't set are omitted.
+	Fields map[string]string
+	// PrevHash is the Hash of the previous record, or empty for the first.
+	PrevHash string
+	// Hash is a hex-encoded SHA-256 digest of this record and PrevHash.
+	Hash string
+}
+
+// An AuditSink stores audit records. WriteAudit is called once per call, in
+// sequence order, and calls are serialized, so slow sinks delay handlers:
+// sinks should buffer records rather than write them synchronously to remote
+// storage. Errors are dropped, since the call has already finished.
+type AuditSink interface {
+	WriteAudit(AuditRecord) error
+}
+
+// auditLog assigns sequence numbers and hashes, and writes records to a sink.
+type auditLog struct {
+	sink   AuditSink
+	fields []protoreflect.Name
+
+	mu       sync.Mutex
+	sequence uint64
+	prevHash string
+}
+
+func newAuditLog(sink AuditSink, fields []string) *auditLog {
+	names := make([]protoreflect.Name, len(fields))
+	for i, field := range fields {
+		names[i] = protoreflect.Name(field)
+	}
+	return &auditLog{sink: sink, fields: names}
+}
+
+func (l *auditLog) write(record AuditRecord) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sequence++
+	record.Sequence = l.sequence
+	record.PrevHash = l.prevHash
+	record.Hash = hashAuditRecord(record)
+	l.prevHash = record.Hash
+	_ = l.sink.WriteAudit(record)
+}
+
+// selectFields extracts the audited fields from a Protobuf request message.
+// Other messages don't have any audited fields.
+func (l *auditLog) selectFields(msg any) map[string]string {
+	protoMsg, ok := msg.(proto.Message)
+	if !ok || len(l.fields) == 0 {
+		return nil
+	}
+	reflected := protoMsg.ProtoReflect()
+	descriptors := reflected.Descriptor().Fields()
+	var fields map[string]string
+	for _, name := range l.fields {
+		descriptor := descriptors.ByName(name)
+		if descriptor == nil || !reflected.Has(descriptor) {
+			continue
+		}
+		if fields == nil {
+			fields = make(map[string]string, len(l.fields))
+		}
+		fields[string(name)] = reflected.Get(descriptor).String()
+	}
+	return fields
+}
+
+// VerifyAuditChain checks that records form an unbroken chain: that they're
+// numbered consecutively, that each record's hash matches its contents, and
+// that each record links to its predecessor. The records may start anywhere
+// in the chain.
+func VerifyAuditChain(records []AuditRecord) error {
+	for i, record := range records {
+		if hash := hashAuditRecord(record); hash != record.Hash {
+			return fmt.Errorf("audit record %d: hash mismatch", record.Sequence)
+		}
+		if i == 0 {
+			continue
+		}
+		prev := records[i-1]
+		if record.Sequence != prev.Sequence+1 {
+			return fmt.Errorf("audit record %d: expected sequence %d", record.Sequence, prev.Sequence+1)
+		}
+		if record.PrevHash != prev.Hash {
+			return fmt.Errorf("audit record %d: doesn't link to record %d", record.Sequence, prev.Sequence)
+		}
+	}
+	return nil
+}
+
+// hashAuditRecord digests every field except Hash, separating them with NUL
+// bytes so that different records can't produce the same input.
+func hashAuditRecord(record AuditRecord) string {
+	hash := sha256.New()
+	write := func(value string) {
+		_, _ = hash.Write([]byte(value))
+		_, _ = hash.Write([]byte{0})
+	}
+	write(strconv.FormatUint(record.Sequence, 10 /* base */))
+	write(record.Time.UTC().Format(time.RFC3339Nano))
+	write(record.Procedure)
+	write(record.Peer.Addr)
+	if record.Peer.AuthInfo != nil {
+		write(record.Peer.AuthInfo.AuthType())
+	} else {
+		write("")
+	}
+	write(record.CallID)
+	write(strconv.FormatUint(uint64(record.Code), 10 /* base */))
+	write(strconv.FormatInt(int64(record.Duration), 10 /* base */))
+	keys := make([]string, 0, len(record.Fields))
+	for key := range record.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		write(key)
+		write(record.Fields[key])
+	}
+	write(record.PrevHash)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// auditInterceptor writes an audit record for every call a handler serves.
+type auditInterceptor struct {
+	Interceptor
+
+	log *auditLog
+}
+
+func (i *auditInterceptor) WrapUnary(next UnaryFunc) UnaryFunc {
+	return func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
+		if request.Spec().IsClient {
+			return next(ctx, request)
+		}
+		start := time.Now()
+		response, err := next(ctx, request)
+		i.record(ctx, start, request.Spec(), request.Peer(), request.Any(), err)
+		return response, err
+	}
+}
+
+func (i *auditInterceptor) WrapStreamingHandler(next StreamingHandlerFunc) StreamingHandlerFunc {
+	return func(ctx context.Context, conn StreamingHandlerConn) error {
+		start := time.Now()
+		audited := &auditHandlerConn{StreamingHandlerConn: conn}
+		err := next(ctx, audited)
+		i.record(ctx, start, conn.Spec(), conn.Peer(), audited.first, err)
+		return err
+	}
+}
+
+func (i *auditInterceptor) record(ctx context.Context, start time.Time, spec Spec, peer Peer, msg any, err error) {
+	callID, _ := CallIDFromContext(ctx)
+	var code Code
+	if err != nil {
+		code = CodeOf(wrapIfContextError(err))
+	}
+	i.log.write(AuditRecord{
+		Time:      start,
+		Procedure: spec.Procedure,
+		Peer:      peer,
+		CallID:    callID,
+		Code:      code,
+		Duration:  time.Since(start),
+		Fields:    i.log.selectFields(msg),
+	})
+}
+
+// auditHandlerConn keeps the first message of a stream, which holds the
+// request fields of server streaming calls.
+type auditHandlerConn struct {
+	StreamingHandlerConn
+
+	first any
+}
+
+func (c *auditHandlerConn) Receive(msg any) error {
+	return c.received(msg, c.StreamingHandlerConn.Receive(msg))
+}
+
+func (c *auditHandlerConn) SendWithMetadata(msg any, metadata http.Header) error {
+	return SendWithMetadata(c.StreamingHandlerConn, msg, metadata)
+}
+
+func (c *auditHandlerConn) ReceiveWithMetadata(msg any) (http.Header, error) {
+	metadata, err := ReceiveWithMetadata(c.StreamingHandlerConn, msg)
+	return metadata, c.received(msg, err)
+}
+
+func (c *auditHandlerConn) SendWithEnvelopeFlags(msg any, flags []string) error {
+	return SendWithEnvelopeFlags(c.StreamingHandlerConn, msg, flags...)
+}
+
+func (c *auditHandlerConn) ReceiveWithEnvelopeFlags(msg any) ([]string, error) {
+	flags, err := ReceiveWithEnvelopeFlags(c.StreamingHandlerConn, msg)
+	return flags, c.received(msg, err)
+}
+
+func (c *auditHandlerConn) CloseReceive() error {
+	return closeReceive(c.StreamingHandlerConn)
+}
+
+func (c *auditHandlerConn) received(msg any, err error) error {
+	if err == nil && c.first == nil {
+		c.first = msg
+	}
+	return err
+}
@@ -0,0 +1,93 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	connect "github.com/bufbuild/connect-go"
+	"github.com/bufbuild/connect-go/internal/assert"
+	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
+	"github.com/bufbuild/connect-go/internal/gen/connect/ping/v1/pingv1connect"
+)
+
+func TestAuditLog(t *testing.T) {
+	t.Parallel()
+	sink := &memoryAuditSink{}
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		pingServer{},
+		connect.WithAuditLog(sink, "number", "text"),
+		connect.WithCallIDs(nil),
+	))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+
+	_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 42}))
+	assert.Nil(t, err)
+	_, err = client.Fail(context.Background(), connect.NewRequest(&pingv1.FailRequest{Code: int32(connect.CodePermissionDenied)}))
+	assert.NotNil(t, err)
+	stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 2}))
+	assert.Nil(t, err)
+	for stream.Receive() {
+	}
+	assert.Nil(t, stream.Err())
+	assert.Nil(t, stream.Close())
+
+	records := sink.all()
+	assert.Equal(t, len(records), 3)
+	ping, fail, countUp := records[0], records[1], records[2]
+	assert.Equal(t, ping.Procedure, "/connect.ping.v1.PingService/Ping")
+	assert.Zero(t, ping.Code)
+	assert.NotZero(t, ping.Peer.Addr)
+	assert.NotZero(t, ping.CallID)
+	// Unset fields are omitted.
+	assert.Equal(t, ping.Fields, map[string]string{"number": "42"})
+	assert.Equal(t, fail.Code, connect.CodePermissionDenied)
+	assert.Zero(t, len(fail.Fields))
+	assert.Equal(t, countUp.Procedure, "/connect.ping.v1.PingService/CountUp")
+	assert.Equal(t, countUp.Fields, map[string]string{"number": "2"})
+	assert.Equal(t, ping.Sequence, 1)
+	assert.Zero(t, ping.PrevHash)
+	assert.Nil(t, connect.VerifyAuditChain(records))
+
+	tampered := append([]connect.AuditRecord(nil), records...)
+	tampered[1].Code = 0
+	assert.NotNil(t, connect.VerifyAuditChain(tampered))
+	assert.NotNil(t, connect.VerifyAuditChain([]connect.AuditRecord{records[0], records[2]}))
+}
+
+type memoryAuditSink struct {
+	mu      sync.Mutex
+	records []connect.AuditRecord
+}
+
+func (s *memoryAuditSink) WriteAudit(record connect.AuditRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, record)
+	return nil
+}
+
+func (s *memoryAuditSink) all() []connect.AuditRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]connect.AuditRecord(nil), s.records...)
+}
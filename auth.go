@@ -0,0 +1,93 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+)
+
+// AuthInfo describes the verified identity of a [Peer]. Regardless of how the
+// identity was established (mutual TLS, a custom header scheme, or anything
+// else), interceptors and handlers can find it on [Peer.AuthInfo] and use a
+// type switch to access the mechanism-specific details.
+type AuthInfo interface {
+	// AuthType names the authentication mechanism, for example "tls".
+	AuthType() string
+}
+
+// TLSInfo is the [AuthInfo] for peers authenticated by TLS certificates.
+// Handlers populate it with [VerifyTLS], and clients populate it from the
+// server's certificates whenever the connection uses TLS.
+//
+// The connection state is shared with net/http, so it must not be modified.
+// It's stored as a pointer so that [Peer] values stay safe to compare.
+type TLSInfo struct {
+	State *tls.ConnectionState
+}
+
+// AuthType implements [AuthInfo].
+func (TLSInfo) AuthType() string { return "tls" }
+
+// An AuthVerifier inspects an incoming request's transport credentials and
+// returns the verified identity of the client. Verifiers that don't recognize
+// the request's credentials return a nil AuthInfo and a nil error, so that the
+// next verifier can try. A non-nil error rejects the request; errors that
+// aren't already [*Error]s are sent to the client with CodeUnauthenticated.
+//
+// Configure handlers to use verifiers with [WithAuthVerifiers].
+type AuthVerifier func(*http.Request) (AuthInfo, error)
+
+// VerifyTLS is an [AuthVerifier] for mutual TLS. It returns a [TLSInfo] if the
+// client presented a certificate that was verified during the TLS handshake.
+// To require client certificates, configure the [tls.Config] used by the
+// [http.Server].
+func VerifyTLS(request *http.Request) (AuthInfo, error) {
+	var info AuthInfo
+	if request.TLS != nil && len(request.TLS.VerifiedChains) > 0 {
+		info = TLSInfo{State: request.TLS}
+	}
+	return info, nil
+}
+
+var authInfoContextValue = NewContextValue[AuthInfo]("connect auth info")
+
+// verifyAuth runs the verifiers in order and stores the first identity they
+// return in the context.
+func verifyAuth(ctx context.Context, request *http.Request, verifiers []AuthVerifier) (context.Context, error) {
+	for _, verify := range verifiers {
+		info, err := verify(request)
+		if err != nil {
+			if connectErr, ok := asError(err); ok {
+				return ctx, connectErr
+			}
+			return ctx, NewError(CodeUnauthenticated, err)
+		}
+		if info != nil {
+			return authInfoContextValue.With(ctx, info), nil
+		}
+	}
+	return ctx, nil
+}
+
+// newPeerFromRequest describes the client of a handler.
+func newPeerFromRequest(request *http.Request) Peer {
+	info, _ := authInfoContextValue.From(request.Context())
+	return Peer{
+		Addr:     request.RemoteAddr,
+		AuthInfo: info,
+	}
+}
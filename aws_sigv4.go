@@ -0,0 +1,215 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	awsSigV4Algorithm      = "AWS4-HMAC-SHA256"
+	awsSigV4TimeFormat     = "20060102T150405Z"
+	awsSigV4DateFormat     = "20060102"
+	awsHeaderAuthorization = "Authorization"
+	awsHeaderDate          = "X-Amz-Date"
+	awsHeaderSecurityToken = "X-Amz-Security-Token"
+)
+
+// AWSCredentials are the credentials used to sign requests with AWS
+// Signature Version 4.
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is only set for temporary credentials, for example those
+	// issued by AWS STS.
+	SessionToken string
+}
+
+// AWSCredentialsFunc retrieves the [AWSCredentials] used to sign a request.
+// It's called once per call, with the call's context, so implementations
+// should cache credentials and refresh them before they expire. When using
+// the AWS SDK for Go v2, wrap the Retrieve method of an aws.CredentialsProvider.
+type AWSCredentialsFunc func(context.Context) (AWSCredentials, error)
+
+type awsSigV4Signer struct {
+	credentials AWSCredentialsFunc
+	service     string
+	region      string
+	now         func() time.Time
+}
+
+// bind returns a function that signs the body of a single unary call, or nil
+// if the call doesn't need signing.
+func (s *awsSigV4Signer) bind(ctx context.Context, spec Spec, rawURL string, header http.Header) func([]byte) *Error {
+	if s == nil || spec.StreamType != StreamTypeUnary {
+		return nil
+	}
+	return func(payload []byte) *Error {
+		target, err := url.Parse(rawURL)
+		if err != nil {
+			return errorf(CodeInternal, "sign request: %w", err)
+		}
+		credentials, err := s.credentials(ctx)
+		if err != nil {
+			if connectErr, ok := asError(err); ok {
+				return connectErr
+			}
+			return errorf(CodeUnauthenticated, "retrieve AWS credentials: %w", err)
+		}
+		s.sign(http.MethodPost, target, header, payload, credentials, s.now())
+		return nil
+	}
+}
+
+// sign adds the date, security token, and Authorization headers to header.
+func (s *awsSigV4Signer) sign(
+	method string,
+	target *url.URL,
+	header http.Header,
+	payload []byte,
+	credentials AWSCredentials,
+	now time.Time,
+) {
+	now = now.UTC()
+	timestamp := now.Format(awsSigV4TimeFormat)
+	header.Set(awsHeaderDate, timestamp)
+	if credentials.SessionToken != "" {
+		header.Set(awsHeaderSecurityToken, credentials.SessionToken)
+	} else {
+		header.Del(awsHeaderSecurityToken)
+	}
+
+	signed := map[string]string{
+		"host":                         target.Host,
+		strings.ToLower(awsHeaderDate): timestamp,
+	}
+	if contentType := header.Get(headerContentType); contentType != "" {
+		signed[strings.ToLower(headerContentType)] = contentType
+	}
+	if credentials.SessionToken != "" {
+		signed[strings.ToLower(awsHeaderSecurityToken)] = credentials.SessionToken
+	}
+	names := make([]string, 0, len(signed))
+	for name := range signed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name)
+		canonicalHeaders.WriteByte(':')
+		canonicalHeaders.WriteString(strings.Join(strings.Fields(signed[name]), " "))
+		canonicalHeaders.WriteByte('\n')
+	}
+	signedHeaders := strings.Join(names, ";")
+	payloadHash := sha256.Sum256(payload)
+	canonicalRequest := strings.Join([]string{
+		method,
+		awsCanonicalPath(target),
+		awsCanonicalQuery(target),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := strings.Join([]string{now.Format(awsSigV4DateFormat), s.region, s.service, "aws4_request"}, "/")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		awsSigV4Algorithm,
+		timestamp,
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := awsHMAC([]byte("AWS4"+credentials.SecretAccessKey), now.Format(awsSigV4DateFormat))
+	key = awsHMAC(key, s.region)
+	key = awsHMAC(key, s.service)
+	key = awsHMAC(key, "aws4_request")
+	signature := hex.EncodeToString(awsHMAC(key, stringToSign))
+	header.Set(awsHeaderAuthorization, fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		awsSigV4Algorithm,
+		credentials.AccessKeyID,
+		scope,
+		signedHeaders,
+		signature,
+	))
+}
+
+func awsHMAC(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// awsCanonicalPath escapes each segment of the already-escaped path again,
+// as SigV4 requires for every service other than S3.
+func awsCanonicalPath(target *url.URL) string {
+	path := target.EscapedPath()
+	if path == "" {
+		return "/"
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = awsURIEncode(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func awsCanonicalQuery(target *url.URL) string {
+	query := target.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(query))
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, awsURIEncode(key)+"="+awsURIEncode(value))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// awsURIEncode percent-encodes everything except the unreserved characters
+// from RFC 3986, using upper-case hex digits.
+func awsURIEncode(value string) string {
+	const hexDigits = "0123456789ABCDEF"
+	var encoded strings.Builder
+	for i := 0; i < len(value); i++ {
+		char := value[i]
+		if ('A' <= char && char <= 'Z') || ('a' <= char && char <= 'z') || ('0' <= char && char <= '9') ||
+			char == '-' || char == '_' || char == '.' || char == '~' {
+			encoded.WriteByte(char)
+			continue
+		}
+		encoded.WriteByte('%')
+		encoded.WriteByte(hexDigits[char>>4])
+		encoded.WriteByte(hexDigits[char&0xf])
+	}
+	return encoded.String()
+}
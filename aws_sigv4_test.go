@@ -0,0 +1,86 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bufbuild/connect-go/internal/assert"
+)
+
+func TestAWSSigV4(t *testing.T) {
+	t.Parallel()
+	credentials := AWSCredentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	t.Run("reference", func(t *testing.T) {
+		t.Parallel()
+		// The IAM ListUsers example from the AWS SigV4 documentation.
+		signer := &awsSigV4Signer{service: "iam", region: "us-east-1"}
+		target, err := url.Parse("https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08")
+		assert.Nil(t, err)
+		header := make(http.Header)
+		header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+		signer.sign(http.MethodGet, target, header, nil, credentials, time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+		assert.Equal(t, header.Get("X-Amz-Date"), "20150830T123600Z")
+		assert.Equal(
+			t,
+			header.Get("Authorization"),
+			"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, "+
+				"SignedHeaders=content-type;host;x-amz-date, "+
+				"Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7",
+		)
+	})
+	t.Run("session_token", func(t *testing.T) {
+		t.Parallel()
+		temporary := credentials
+		temporary.SessionToken = "token"
+		signer := &awsSigV4Signer{
+			credentials: func(context.Context) (AWSCredentials, error) { return temporary, nil },
+			service:     "execute-api",
+			region:      "eu-west-1",
+			now:         time.Now,
+		}
+		header := make(http.Header)
+		sign := signer.bind(context.Background(), Spec{StreamType: StreamTypeUnary}, "https://example.com/ping.v1.PingService/Ping", header)
+		assert.Nil(t, sign([]byte("payload")))
+		assert.Equal(t, header.Get("X-Amz-Security-Token"), "token")
+		assert.True(t, strings.Contains(header.Get("Authorization"), "SignedHeaders=host;x-amz-date;x-amz-security-token,"))
+		assert.True(t, strings.Contains(header.Get("Authorization"), "/eu-west-1/execute-api/aws4_request,"))
+	})
+	t.Run("credentials_error", func(t *testing.T) {
+		t.Parallel()
+		signer := &awsSigV4Signer{
+			credentials: func(context.Context) (AWSCredentials, error) { return AWSCredentials{}, errors.New("expired") },
+			now:         time.Now,
+		}
+		sign := signer.bind(context.Background(), Spec{StreamType: StreamTypeUnary}, "https://example.com", make(http.Header))
+		assert.Equal(t, sign(nil).Code(), CodeUnauthenticated)
+		assert.Nil(t, signer.bind(context.Background(), Spec{StreamType: StreamTypeBidi}, "https://example.com", make(http.Header)))
+	})
+	t.Run("canonical_path", func(t *testing.T) {
+		t.Parallel()
+		target, err := url.Parse("https://example.com/a%20b/c")
+		assert.Nil(t, err)
+		assert.Equal(t, awsCanonicalPath(target), "/a%2520b/c")
+	})
+}
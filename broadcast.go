@@ -0,0 +1,259 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+const defaultBroadcastBuffer = 16
+
+// LagPolicy decides what a [StreamBroadcaster] does when a subscriber's
+// buffer is full.
+type LagPolicy uint8
+
+const (
+	// LagBlock waits for the subscriber to catch up, which also delays every
+	// other subscriber. Subscribers must keep receiving or close their
+	// subscription.
+	LagBlock LagPolicy = iota
+	// LagDropOldest discards the oldest buffered message to make room for the
+	// newest one. Subscribers can see how many messages they missed with
+	// [StreamSubscription.Dropped].
+	LagDropOldest
+	// LagDisconnect ends the subscription with [CodeResourceExhausted] after
+	// the subscriber receives the messages already buffered.
+	LagDisconnect
+)
+
+// BroadcastOptions configures a [StreamBroadcaster].
+type BroadcastOptions struct {
+	// Buffer is the number of messages buffered for each subscriber. If it's
+	// less than 1, each subscriber buffers 16 messages.
+	Buffer int
+	// Lag decides what happens when a subscriber's buffer is full.
+	Lag LagPolicy
+}
+
+// StreamBroadcaster fans out a single upstream server stream to many
+// in-process subscribers, so that gateways don't need to open identical
+// upstream streams for each of their own clients. It's constructed with
+// [NewStreamBroadcaster].
+//
+// Subscribers receive the messages sent after they subscribe. Messages are
+// shared between subscribers, so they must not be modified.
+type StreamBroadcaster[Res any] struct {
+	upstream *ServerStreamForClient[Res]
+	options  BroadcastOptions
+
+	mu          sync.Mutex
+	subscribers map[*StreamSubscription[Res]]struct{}
+	done        bool
+	err         error
+}
+
+// NewStreamBroadcaster starts receiving from upstream in a separate goroutine
+// and delivering each message to the current subscribers. The broadcaster
+// owns the upstream stream and closes it when it ends; to stop it early,
+// cancel the context used to open it.
+func NewStreamBroadcaster[Res any](
+	upstream *ServerStreamForClient[Res],
+	options BroadcastOptions,
+) *StreamBroadcaster[Res] {
+	if options.Buffer < 1 {
+		options.Buffer = defaultBroadcastBuffer
+	}
+	broadcaster := &StreamBroadcaster[Res]{
+		upstream:    upstream,
+		options:     options,
+		subscribers: make(map[*StreamSubscription[Res]]struct{}),
+	}
+	go broadcaster.run()
+	return broadcaster
+}
+
+// Subscribe adds a subscriber. If the upstream stream has already ended, the
+// subscription ends immediately with the upstream's error.
+func (b *StreamBroadcaster[Res]) Subscribe() *StreamSubscription[Res] {
+	sub := &StreamSubscription[Res]{
+		broadcaster: b,
+		messages:    make(chan *Res, b.options.Buffer),
+		closed:      make(chan struct{}),
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.done {
+		sub.finish(b.err)
+		return sub
+	}
+	b.subscribers[sub] = struct{}{}
+	return sub
+}
+
+func (b *StreamBroadcaster[Res]) run() {
+	var subscribers []*StreamSubscription[Res]
+	for b.upstream.Receive() {
+		msg := b.upstream.Msg()
+		b.mu.Lock()
+		subscribers = subscribers[:0]
+		for sub := range b.subscribers {
+			subscribers = append(subscribers, sub)
+		}
+		b.mu.Unlock()
+		for _, sub := range subscribers {
+			b.deliver(sub, msg)
+		}
+	}
+	err := b.upstream.Err()
+	if closeErr := b.upstream.Close(); err == nil {
+		err = closeErr
+	}
+	b.mu.Lock()
+	b.done = true
+	b.err = err
+	remaining := b.subscribers
+	b.subscribers = nil
+	b.mu.Unlock()
+	for sub := range remaining {
+		sub.finish(err)
+	}
+}
+
+func (b *StreamBroadcaster[Res]) deliver(sub *StreamSubscription[Res], msg *Res) {
+	if enqueue(sub.messages, sub.closed, msg, b.options.Lag, &sub.dropped) {
+		return
+	}
+	if b.unsubscribe(sub) {
+		sub.finish(errorf(CodeResourceExhausted, "subscriber fell more than %d messages behind", b.options.Buffer))
+	}
+}
+
+// enqueue adds msg to a subscriber's queue, applying the lag policy if the
+// queue is full. It reports false if the subscriber should be disconnected.
+// Sends are abandoned if gone is closed.
+func enqueue[T any](queue chan *T, gone <-chan struct{}, msg *T, lag LagPolicy, dropped *uint64) bool {
+	select {
+	case queue <- msg:
+		return true
+	case <-gone:
+		return true
+	default:
+	}
+	switch lag {
+	case LagDropOldest:
+		for {
+			select {
+			case queue <- msg:
+				return true
+			default:
+			}
+			select {
+			case <-queue:
+				atomic.AddUint64(dropped, 1)
+			default:
+			}
+		}
+	case LagDisconnect:
+		return false
+	default:
+		select {
+		case queue <- msg:
+		case <-gone:
+		}
+		return true
+	}
+}
+
+// unsubscribe reports whether sub was subscribed.
+func (b *StreamBroadcaster[Res]) unsubscribe(sub *StreamSubscription[Res]) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subscribers[sub]; !ok {
+		return false
+	}
+	delete(b.subscribers, sub)
+	return true
+}
+
+// StreamSubscription is a subscriber's view of a [StreamBroadcaster]. Its API
+// mirrors [ServerStreamForClient], and it must be closed when the subscriber
+// is done with it.
+type StreamSubscription[Res any] struct {
+	broadcaster *StreamBroadcaster[Res]
+	messages    chan *Res
+	closed      chan struct{}
+	closeOnce   sync.Once
+	msg         *Res
+	dropped     uint64 // atomic
+
+	mu  sync.Mutex
+	err error
+}
+
+// Receive advances the subscription to the next message, which will then be
+// available through the Msg method. It returns false when the upstream stream
+// ends, when the subscriber is disconnected for falling behind, or after the
+// subscription is closed. After Receive returns false, the Err method will
+// return any error encountered.
+func (s *StreamSubscription[Res]) Receive() bool {
+	select {
+	case msg, ok := <-s.messages:
+		if !ok {
+			return false
+		}
+		s.msg = msg
+		return true
+	case <-s.closed:
+		return false
+	}
+}
+
+// Msg returns the most recent message received by a call to Receive.
+func (s *StreamSubscription[Res]) Msg() *Res {
+	return s.msg
+}
+
+// Err returns the error that ended the subscription, if any.
+func (s *StreamSubscription[Res]) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Dropped returns the number of messages discarded because the subscriber
+// fell behind. It's always zero unless the broadcaster uses [LagDropOldest].
+func (s *StreamSubscription[Res]) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Close unsubscribes. It doesn't affect the upstream stream or other
+// subscribers.
+func (s *StreamSubscription[Res]) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		s.broadcaster.unsubscribe(s)
+	})
+	return nil
+}
+
+// finish ends the subscription after any buffered messages. It's only called
+// once, by the broadcaster.
+func (s *StreamSubscription[Res]) finish(err error) {
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+	close(s.messages)
+}
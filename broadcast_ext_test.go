@@ -0,0 +1,112 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	connect "github.com/bufbuild/connect-go"
+	"github.com/bufbuild/connect-go/internal/assert"
+	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
+	"github.com/bufbuild/connect-go/internal/gen/connect/ping/v1/pingv1connect"
+)
+
+func TestStreamBroadcaster(t *testing.T) {
+	t.Parallel()
+	const (
+		countUpProcedure = "/" + pingv1connect.PingServiceName + "/CountUp"
+		count            = 5
+	)
+	// broadcast starts a broadcaster whose upstream waits for release before
+	// sending any messages, so subscribers don't miss any.
+	broadcast := func(t *testing.T, options connect.BroadcastOptions) (*connect.StreamBroadcaster[pingv1.CountUpResponse], func()) {
+		t.Helper()
+		release := make(chan struct{})
+		mux := http.NewServeMux()
+		mux.Handle(countUpProcedure, connect.NewServerStreamHandler(
+			countUpProcedure,
+			func(ctx context.Context, request *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+				<-release
+				for i := int64(1); i <= request.Msg.Number; i++ {
+					if err := stream.Send(&pingv1.CountUpResponse{Number: i}); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		))
+		server := httptest.NewServer(mux)
+		t.Cleanup(server.Close)
+		client := connect.NewClient[pingv1.CountUpRequest, pingv1.CountUpResponse](server.Client(), server.URL+countUpProcedure)
+		upstream, err := client.CallServerStream(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: count}))
+		assert.Nil(t, err)
+		return connect.NewStreamBroadcaster(upstream, options), func() { close(release) }
+	}
+	receiveAll := func(sub *connect.StreamSubscription[pingv1.CountUpResponse]) []int64 {
+		var got []int64
+		for sub.Receive() {
+			got = append(got, sub.Msg().Number)
+		}
+		return got
+	}
+
+	t.Run("fan_out", func(t *testing.T) {
+		t.Parallel()
+		broadcaster, release := broadcast(t, connect.BroadcastOptions{})
+		subs := []*connect.StreamSubscription[pingv1.CountUpResponse]{
+			broadcaster.Subscribe(),
+			broadcaster.Subscribe(),
+			broadcaster.Subscribe(),
+		}
+		closed := broadcaster.Subscribe()
+		assert.Nil(t, closed.Close())
+		assert.False(t, closed.Receive())
+		release()
+		for _, sub := range subs {
+			assert.Equal(t, receiveAll(sub), []int64{1, 2, 3, 4, 5})
+			assert.Nil(t, sub.Err())
+			assert.Zero(t, sub.Dropped())
+			assert.Nil(t, sub.Close())
+		}
+		// Late subscribers see the end of the stream.
+		late := broadcaster.Subscribe()
+		assert.False(t, late.Receive())
+		assert.Nil(t, late.Err())
+	})
+	t.Run("drop_oldest", func(t *testing.T) {
+		t.Parallel()
+		broadcaster, release := broadcast(t, connect.BroadcastOptions{Buffer: 1, Lag: connect.LagDropOldest})
+		slow := broadcaster.Subscribe()
+		fast := broadcaster.Subscribe()
+		release()
+		receiveAll(fast)
+		assert.Equal(t, receiveAll(slow), []int64{count})
+		assert.Equal(t, slow.Dropped(), count-1)
+		assert.Nil(t, slow.Err())
+	})
+	t.Run("disconnect", func(t *testing.T) {
+		t.Parallel()
+		broadcaster, release := broadcast(t, connect.BroadcastOptions{Buffer: 1, Lag: connect.LagDisconnect})
+		slow := broadcaster.Subscribe()
+		fast := broadcaster.Subscribe()
+		release()
+		receiveAll(fast)
+		assert.Equal(t, receiveAll(slow), []int64{1})
+		assert.Equal(t, connect.CodeOf(slow.Err()), connect.CodeResourceExhausted)
+	})
+}
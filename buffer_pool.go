@@ -17,6 +17,7 @@ package connect
 import (
 	"bytes"
 	"sync"
+	"sync/atomic"
 )
 
 const (
@@ -24,29 +25,72 @@ const (
 	maxRecycleBufferSize = 8 * 1024 * 1024 // if >8MiB, don't hold onto a buffer
 )
 
+// BufferPoolStats counts how well clients and handlers reuse the buffers they
+// use to read and write messages. Configure clients and handlers to record
+// statistics with [WithBufferPoolStats]; one BufferPoolStats may be shared by
+// many clients and handlers. Compare the counts with the message sizes seen
+// in production to tune [WithInitialBufferSize] and
+// [WithMaxRecycleBufferSize].
+//
+// The zero value is ready to use, and all methods are safe to call
+// concurrently.
+type BufferPoolStats struct {
+	hits     uint64
+	misses   uint64
+	discards uint64
+}
+
+// Hits returns the number of times a buffer was reused from the pool.
+func (s *BufferPoolStats) Hits() uint64 {
+	return atomic.LoadUint64(&s.hits)
+}
+
+// Misses returns the number of times the pool was empty, so a new buffer was
+// allocated.
+func (s *BufferPoolStats) Misses() uint64 {
+	return atomic.LoadUint64(&s.misses)
+}
+
+// Discards returns the number of buffers that grew past the maximum recycle
+// size, so they were left for the garbage collector instead of returning to
+// the pool.
+func (s *BufferPoolStats) Discards() uint64 {
+	return atomic.LoadUint64(&s.discards)
+}
+
 type bufferPool struct {
 	sync.Pool
+
+	initialSize    int
+	maxRecycleSize int
+	stats          *BufferPoolStats // may be nil
 }
 
 func newBufferPool() *bufferPool {
 	return &bufferPool{
-		Pool: sync.Pool{
-			New: func() any {
-				return bytes.NewBuffer(make([]byte, 0, initialBufferSize))
-			},
-		},
+		initialSize:    initialBufferSize,
+		maxRecycleSize: maxRecycleBufferSize,
 	}
 }
 
 func (b *bufferPool) Get() *bytes.Buffer {
 	if buf, ok := b.Pool.Get().(*bytes.Buffer); ok {
+		if b.stats != nil {
+			atomic.AddUint64(&b.stats.hits, 1)
+		}
 		return buf
 	}
-	return bytes.NewBuffer(make([]byte, 0, initialBufferSize))
+	if b.stats != nil {
+		atomic.AddUint64(&b.stats.misses, 1)
+	}
+	return bytes.NewBuffer(make([]byte, 0, b.initialSize))
 }
 
 func (b *bufferPool) Put(buffer *bytes.Buffer) {
-	if buffer.Cap() > maxRecycleBufferSize {
+	if buffer.Cap() > b.maxRecycleSize {
+		if b.stats != nil {
+			atomic.AddUint64(&b.stats.discards, 1)
+		}
 		return
 	}
 	buffer.Reset()
@@ -0,0 +1,154 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// BufferedSender queues outgoing messages for a [ServerStream] or
+// [BidiStream] and sends them from a background goroutine, so producers
+// aren't slowed down by the network. It's constructed with
+// [NewBufferedSender], and is safe for concurrent use: unlike the stream
+// itself, several goroutines may call Send at once.
+//
+// The options' Lag policy decides what happens when the queue is full:
+// [LagBlock] waits for room, [LagDropOldest] discards the oldest queued
+// message (which suits telemetry-style streams, where freshness beats
+// completeness), and [LagDisconnect] makes Send return an error with
+// [CodeResourceExhausted] without queueing the message.
+//
+// Handlers must call Close before returning, which sends the remaining queued
+// messages. Handlers must not call the stream's Send method directly while
+// the BufferedSender is open.
+type BufferedSender[Res any] struct {
+	stream  interface{ Send(*Res) error }
+	options BroadcastOptions
+	queue   chan *Res
+	dropped uint64 // atomic
+
+	mu      sync.RWMutex // held exclusively to close
+	closing bool
+	stop    chan struct{} // closed to ask the sending goroutine to finish
+	done    chan struct{} // closed once the sending goroutine exits
+
+	errMu sync.Mutex
+	err   error
+}
+
+// NewBufferedSender starts sending queued messages on the stream. If the
+// options' Buffer is less than 1, the queue holds 16 messages.
+func NewBufferedSender[Res any](stream interface{ Send(*Res) error }, options BroadcastOptions) *BufferedSender[Res] {
+	if options.Buffer < 1 {
+		options.Buffer = defaultBroadcastBuffer
+	}
+	sender := &BufferedSender[Res]{
+		stream:  stream,
+		options: options,
+		queue:   make(chan *Res, options.Buffer),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go sender.run()
+	return sender
+}
+
+// Send queues a message. It returns an error if the sender is closed, if an
+// earlier message couldn't be sent, or if the queue is full and the lag
+// policy is [LagDisconnect].
+func (s *BufferedSender[Res]) Send(msg *Res) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closing {
+		return errorf(CodeInternal, "send on closed BufferedSender")
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+	queued := enqueue(s.queue, s.done, msg, s.options.Lag, &s.dropped)
+	// The sending goroutine may have failed while we were queueing, in which
+	// case the message was abandoned rather than queued.
+	if err := s.Err(); err != nil {
+		return err
+	}
+	if !queued {
+		return errorf(CodeResourceExhausted, "send queue of %d messages is full", s.options.Buffer)
+	}
+	return nil
+}
+
+// Dropped returns the number of messages discarded because the queue was
+// full. It's always zero unless the sender uses [LagDropOldest].
+func (s *BufferedSender[Res]) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Err returns the error that stopped the sender, if any. Once a message
+// can't be sent, the remaining queued messages are discarded.
+func (s *BufferedSender[Res]) Err() error {
+	s.errMu.Lock()
+	defer s.errMu.Unlock()
+	return s.err
+}
+
+// Close stops accepting messages and waits until the queued messages have
+// been sent. It returns the error that stopped the sender, if any. Calling
+// Close more than once is safe.
+func (s *BufferedSender[Res]) Close() error {
+	s.mu.Lock()
+	if !s.closing {
+		s.closing = true
+		close(s.stop)
+	}
+	s.mu.Unlock()
+	<-s.done
+	return s.Err()
+}
+
+func (s *BufferedSender[Res]) run() {
+	defer close(s.done)
+	for {
+		select {
+		case msg := <-s.queue:
+			if !s.send(msg) {
+				return
+			}
+		case <-s.stop:
+			// Send can't queue more messages once stop is closed, so flush
+			// what's left.
+			for {
+				select {
+				case msg := <-s.queue:
+					if !s.send(msg) {
+						return
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (s *BufferedSender[Res]) send(msg *Res) bool {
+	if err := s.stream.Send(msg); err != nil {
+		s.errMu.Lock()
+		s.err = err
+		s.errMu.Unlock()
+		return false
+	}
+	return true
+}
@@ -0,0 +1,127 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/bufbuild/connect-go/internal/assert"
+	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
+)
+
+func TestBufferedSender(t *testing.T) {
+	t.Parallel()
+	// newStream returns a stream whose Send blocks until the test reads the
+	// message from the returned channel.
+	newStream := func() (*bufferedSenderTestStream, <-chan int64) {
+		sent := make(chan int64)
+		return &bufferedSenderTestStream{sent: sent, started: make(chan struct{})}, sent
+	}
+	send := func(t *testing.T, sender *BufferedSender[pingv1.CountUpResponse], numbers ...int64) {
+		t.Helper()
+		for _, number := range numbers {
+			assert.Nil(t, sender.Send(&pingv1.CountUpResponse{Number: number}))
+		}
+	}
+	receive := func(sent <-chan int64, count int) []int64 {
+		numbers := make([]int64, 0, count)
+		for i := 0; i < count; i++ {
+			numbers = append(numbers, <-sent)
+		}
+		return numbers
+	}
+
+	t.Run("block", func(t *testing.T) {
+		t.Parallel()
+		stream, sent := newStream()
+		sender := NewBufferedSender[pingv1.CountUpResponse](stream, BroadcastOptions{Buffer: 2})
+		received := make(chan []int64, 1)
+		go func() { received <- receive(sent, 10) }()
+		send(t, sender, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10)
+		assert.Nil(t, sender.Close())
+		assert.Equal(t, <-received, []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10})
+		assert.Zero(t, sender.Dropped())
+		err := sender.Send(&pingv1.CountUpResponse{})
+		assert.NotNil(t, err)
+		assert.Nil(t, sender.Close())
+	})
+	t.Run("drop_oldest", func(t *testing.T) {
+		t.Parallel()
+		stream, sent := newStream()
+		sender := NewBufferedSender[pingv1.CountUpResponse](stream, BroadcastOptions{Buffer: 2, Lag: LagDropOldest})
+		// The first message is in flight, so the queue keeps the two newest
+		// of the rest.
+		send(t, sender, 1)
+		stream.waitForSend()
+		send(t, sender, 2, 3, 4, 5)
+		assert.Equal(t, sender.Dropped(), uint64(2))
+		closed := make(chan error, 1)
+		go func() { closed <- sender.Close() }()
+		assert.Equal(t, receive(sent, 3), []int64{1, 4, 5})
+		assert.Nil(t, <-closed)
+	})
+	t.Run("disconnect", func(t *testing.T) {
+		t.Parallel()
+		stream, sent := newStream()
+		sender := NewBufferedSender[pingv1.CountUpResponse](stream, BroadcastOptions{Buffer: 1, Lag: LagDisconnect})
+		send(t, sender, 1)
+		stream.waitForSend()
+		send(t, sender, 2)
+		err := sender.Send(&pingv1.CountUpResponse{Number: 3})
+		assert.Equal(t, CodeOf(err), CodeResourceExhausted)
+		closed := make(chan error, 1)
+		go func() { closed <- sender.Close() }()
+		assert.Equal(t, receive(sent, 2), []int64{1, 2})
+		assert.Nil(t, <-closed)
+	})
+	t.Run("error", func(t *testing.T) {
+		t.Parallel()
+		errBroken := errors.New("broken stream")
+		stream := &bufferedSenderTestStream{err: errBroken, started: make(chan struct{})}
+		sender := NewBufferedSender[pingv1.CountUpResponse](stream, BroadcastOptions{})
+		send(t, sender, 1)
+		<-sender.done
+		// Once the sender has failed, Send reports the failure rather than
+		// queueing into the abandoned queue.
+		for i := 0; i < 2*defaultBroadcastBuffer; i++ {
+			assert.ErrorIs(t, sender.Send(&pingv1.CountUpResponse{}), errBroken)
+		}
+		assert.ErrorIs(t, sender.Close(), errBroken)
+		assert.ErrorIs(t, sender.Err(), errBroken)
+	})
+}
+
+type bufferedSenderTestStream struct {
+	sent    chan<- int64
+	err     error
+	started chan struct{}
+	once    sync.Once
+}
+
+func (s *bufferedSenderTestStream) Send(msg *pingv1.CountUpResponse) error {
+	s.once.Do(func() { close(s.started) })
+	if s.err != nil {
+		return s.err
+	}
+	s.sent <- msg.Number
+	return nil
+}
+
+// waitForSend waits until the sender is blocked sending its first message.
+func (s *bufferedSenderTestStream) waitForSend() {
+	<-s.started
+}
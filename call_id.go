@@ -0,0 +1,109 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// maxCallIDLength limits the call IDs handlers accept from clients.
+const maxCallIDLength = 128
+
+var callIDContextValue = NewContextValue[string]("connect call ID")
+
+// CallIDFromContext returns the ID assigned to the current call by
+// [WithCallIDs] or [WithCallIDHeader]. Handler implementations, interceptors,
+// and reporting hooks like the one configured with [WithSlowRequestThreshold] can
+// all use it to correlate their telemetry.
+func CallIDFromContext(ctx context.Context) (string, bool) {
+	return callIDContextValue.From(ctx)
+}
+
+// NewCallID is the default call ID generator. It returns 128 random bits,
+// hex-encoded.
+func NewCallID() string {
+	var id [16]byte
+	_, _ = rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+// callIDPolicy assigns IDs to calls and, optionally, propagates them in a
+// header.
+type callIDPolicy struct {
+	generate func() string
+	header   string
+}
+
+func (p *callIDPolicy) newID() string {
+	if p.generate == nil {
+		return NewCallID()
+	}
+	return p.generate()
+}
+
+// assignClient attaches a new ID to an outbound call. Calls made while
+// handling another call get their own IDs.
+func (p *callIDPolicy) assignClient(ctx context.Context) context.Context {
+	if p == nil {
+		return ctx
+	}
+	return callIDContextValue.With(ctx, p.newID())
+}
+
+// writeClientHeader propagates the outbound call's ID to the handler.
+func (p *callIDPolicy) writeClientHeader(ctx context.Context, header http.Header) {
+	if p == nil || p.header == "" {
+		return
+	}
+	if id, ok := CallIDFromContext(ctx); ok {
+		header.Set(p.header, id)
+	}
+}
+
+// assignHandler attaches an ID to an inbound call, preferring the ID sent by
+// the client so that both sides of the call report the same ID.
+func (p *callIDPolicy) assignHandler(ctx context.Context, request http.Header, response http.Header) context.Context {
+	if p == nil {
+		return ctx
+	}
+	var id string
+	if p.header != "" {
+		id = request.Get(p.header)
+		if !isValidCallID(id) {
+			id = p.newID()
+		}
+		response.Set(p.header, id)
+	} else {
+		id = p.newID()
+	}
+	return callIDContextValue.With(ctx, id)
+}
+
+// isValidCallID reports whether a client-supplied ID is short, printable
+// ASCII, so that it's safe to copy into logs.
+func isValidCallID(id string) bool {
+	if id == "" || len(id) > maxCallIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
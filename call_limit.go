@@ -0,0 +1,149 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// A QueuePolicy controls what clients configured with
+// [WithMaxConcurrentCalls] do with calls over the limit.
+//
+// The zero value rejects calls over the limit immediately.
+type QueuePolicy struct {
+	// MaxQueued limits the number of calls waiting for a slot, in first-in,
+	// first-out order. Calls beyond this limit are rejected immediately. If
+	// zero, calls never wait; if negative, the queue is unbounded.
+	MaxQueued int
+	// Timeout limits how long calls wait for a slot. If zero, calls wait until
+	// their context ends.
+	Timeout time.Duration
+}
+
+// callLimiter caps the number of in-flight calls, queueing the excess.
+type callLimiter struct {
+	maxConcurrent int
+	policy        QueuePolicy
+
+	mu      sync.Mutex
+	active  int
+	waiting []chan struct{}
+}
+
+func newCallLimiter(maxConcurrent int, policy QueuePolicy) *callLimiter {
+	return &callLimiter{maxConcurrent: maxConcurrent, policy: policy}
+}
+
+// acquire waits until the call can proceed, then returns a function that must
+// be called when the call finishes. Calls that are rejected or time out fail
+// with CodeResourceExhausted, and calls whose context ends while waiting fail
+// with CodeCanceled or CodeDeadlineExceeded.
+func (l *callLimiter) acquire(ctx context.Context) (func(), error) {
+	if l == nil || l.maxConcurrent <= 0 {
+		return func() {}, nil
+	}
+	l.mu.Lock()
+	if l.active < l.maxConcurrent && len(l.waiting) == 0 {
+		l.active++
+		l.mu.Unlock()
+		return l.release, nil
+	}
+	if l.policy.MaxQueued >= 0 && len(l.waiting) >= l.policy.MaxQueued {
+		l.mu.Unlock()
+		return nil, errorf(CodeResourceExhausted, "too many concurrent calls: limit is %d", l.maxConcurrent)
+	}
+	ready := make(chan struct{})
+	l.waiting = append(l.waiting, ready)
+	l.mu.Unlock()
+	var timeout <-chan time.Time
+	if l.policy.Timeout > 0 {
+		timer := time.NewTimer(l.policy.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	var err error
+	select {
+	case <-ready:
+		return l.release, nil
+	case <-timeout:
+		err = errorf(CodeResourceExhausted, "timed out after %v waiting for one of %d in-flight calls to finish", l.policy.Timeout, l.maxConcurrent)
+	case <-ctx.Done():
+		err = wrapIfContextDone(ctx, ctx.Err())
+	}
+	l.mu.Lock()
+	removed := l.remove(ready)
+	l.mu.Unlock()
+	if !removed {
+		// We were admitted concurrently, so pass the slot along.
+		l.release()
+	}
+	return nil, err
+}
+
+// release frees a slot, handing it directly to the longest-waiting call.
+func (l *callLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.waiting) > 0 {
+		close(l.waiting[0])
+		l.waiting = l.waiting[1:]
+		return
+	}
+	l.active--
+}
+
+func (l *callLimiter) remove(ready chan struct{}) bool {
+	for i, candidate := range l.waiting {
+		if candidate == ready {
+			l.waiting = append(l.waiting[:i:i], l.waiting[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// limitedClientConn holds a slot from a callLimiter until the receive side of
+// the stream is closed.
+type limitedClientConn struct {
+	StreamingClientConn
+
+	release func()
+	once    sync.Once
+}
+
+func (c *limitedClientConn) SendWithMetadata(msg any, metadata http.Header) error {
+	return SendWithMetadata(c.StreamingClientConn, msg, metadata)
+}
+
+func (c *limitedClientConn) ReceiveWithMetadata(msg any) (http.Header, error) {
+	return ReceiveWithMetadata(c.StreamingClientConn, msg)
+}
+
+func (c *limitedClientConn) SendWithEnvelopeFlags(msg any, flags []string) error {
+	return SendWithEnvelopeFlags(c.StreamingClientConn, msg, flags...)
+}
+
+func (c *limitedClientConn) ReceiveWithEnvelopeFlags(msg any) ([]string, error) {
+	return ReceiveWithEnvelopeFlags(c.StreamingClientConn, msg)
+}
+
+func (c *limitedClientConn) CloseResponse() error {
+	err := c.StreamingClientConn.CloseResponse()
+	c.once.Do(c.release)
+	return err
+}
@@ -0,0 +1,77 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.20
+
+package connect
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bufbuild/connect-go/internal/assert"
+)
+
+func TestWrapIfContextDone(t *testing.T) {
+	t.Parallel()
+	t.Run("not_done", func(t *testing.T) {
+		t.Parallel()
+		err := errors.New("oh no")
+		assert.ErrorIs(t, wrapIfContextDone(context.Background(), err), err)
+		assert.Nil(t, wrapIfContextDone(context.Background(), nil))
+	})
+	t.Run("no_cause", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err := wrapIfContextDone(ctx, ctx.Err())
+		assert.Equal(t, CodeOf(err), CodeCanceled)
+		assert.Equal(t, err.Error(), "canceled: context canceled")
+	})
+	t.Run("cause", func(t *testing.T) {
+		t.Parallel()
+		shutdown := errors.New("server shutting down")
+		ctx, cancel := context.WithCancelCause(context.Background())
+		cancel(shutdown)
+		err := wrapIfContextDone(ctx, ctx.Err())
+		assert.Equal(t, CodeOf(err), CodeCanceled)
+		assert.Equal(t, err.Error(), "canceled: context canceled: server shutting down")
+		assert.ErrorIs(t, err, shutdown)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+	t.Run("coded_cause", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := context.WithCancelCause(context.Background())
+		cancel(NewError(CodeUnavailable, errors.New("draining")))
+		err := wrapIfContextDone(ctx, ctx.Err())
+		assert.Equal(t, CodeOf(err), CodeUnavailable)
+	})
+	t.Run("deadline_cause", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := context.WithCancelCause(context.Background())
+		cancel(context.DeadlineExceeded)
+		err := wrapIfContextDone(ctx, ctx.Err())
+		assert.Equal(t, CodeOf(err), CodeDeadlineExceeded)
+	})
+	t.Run("deadline", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+		defer cancel()
+		<-ctx.Done()
+		err := wrapIfContextDone(ctx, ctx.Err())
+		assert.Equal(t, CodeOf(err), CodeDeadlineExceeded)
+	})
+}
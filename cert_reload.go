@@ -0,0 +1,181 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"crypto/tls"
+	"errors"
+	"sync"
+	"time"
+)
+
+// CertificateReloader serves a TLS certificate that can change while the
+// process is running, so that short-lived mTLS certificates issued by a
+// service mesh or SPIFFE implementation can rotate without a restart. Its
+// [CertificateReloader.GetCertificate] and
+// [CertificateReloader.GetClientCertificate] methods plug into [tls.Config]:
+//
+//	reloader, err := connect.NewFileCertificateReloader("tls.crt", "tls.key", time.Minute)
+//	if err != nil {
+//		return err
+//	}
+//	defer reloader.Close()
+//	server.TLSConfig = &tls.Config{GetCertificate: reloader.GetCertificate}
+//	clientOption := connect.WithTLSConfig(&tls.Config{
+//		GetClientCertificate: reloader.GetClientCertificate,
+//	})
+//
+// TLS only presents certificates during handshakes, so rotation affects new
+// connections. Established connections, and the long-lived streams on them,
+// keep running with the certificate they were opened with.
+//
+// Certificates can be loaded by polling (as [NewFileCertificateReloader]
+// does with PEM files), on demand with [CertificateReloader.Reload] (for
+// example, on SIGHUP), or pushed with [CertificateReloader.Update] by sources
+// that stream updates, like the SPIFFE Workload API. The methods of a
+// CertificateReloader are safe to call concurrently.
+type CertificateReloader struct {
+	load func() (tls.Certificate, error)
+	stop chan struct{}
+	done chan struct{}
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	err       error
+	closeOnce sync.Once
+}
+
+// NewCertificateReloader constructs a CertificateReloader that obtains
+// certificates from load. It loads the initial certificate immediately and
+// returns any error. If interval is positive, the reloader calls load again
+// at that interval until it's closed; failed reloads keep serving the
+// previous certificate, and are reported by [CertificateReloader.Err]. If
+// load is nil, certificates must be supplied with
+// [CertificateReloader.Update].
+func NewCertificateReloader(load func() (tls.Certificate, error), interval time.Duration) (*CertificateReloader, error) {
+	reloader := &CertificateReloader{
+		load: load,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	if load != nil {
+		if err := reloader.Reload(); err != nil {
+			return nil, err
+		}
+	}
+	if load == nil || interval <= 0 {
+		close(reloader.done)
+		return reloader, nil
+	}
+	go reloader.poll(interval)
+	return reloader, nil
+}
+
+// NewFileCertificateReloader constructs a CertificateReloader that reads a
+// PEM-encoded certificate chain and private key from files, as
+// [tls.LoadX509KeyPair] does, rereading them at the given interval. Tools
+// that rotate the files should replace them atomically (for example, by
+// renaming), so that the reloader never reads a certificate and key that
+// don't match; mismatched pairs are rejected and the previous certificate is
+// kept.
+func NewFileCertificateReloader(certFile, keyFile string, interval time.Duration) (*CertificateReloader, error) {
+	return NewCertificateReloader(func() (tls.Certificate, error) {
+		return tls.LoadX509KeyPair(certFile, keyFile)
+	}, interval)
+}
+
+// Certificate returns the current certificate, or nil if there isn't one
+// yet.
+func (r *CertificateReloader) Certificate() *tls.Certificate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert
+}
+
+// GetCertificate returns the current certificate. It has the signature of
+// [tls.Config.GetCertificate], for servers.
+func (r *CertificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.current()
+}
+
+// GetClientCertificate returns the current certificate. It has the signature
+// of [tls.Config.GetClientCertificate], for clients using mutual TLS.
+func (r *CertificateReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.current()
+}
+
+// Reload loads a new certificate immediately. If loading fails, the previous
+// certificate is kept and the error is returned (and reported by Err).
+func (r *CertificateReloader) Reload() error {
+	if r.load == nil {
+		return errors.New("certificate reloader has no load function")
+	}
+	cert, err := r.load()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.err = err
+	if err == nil {
+		r.cert = &cert
+	}
+	return err
+}
+
+// Update replaces the current certificate, for sources that push new
+// certificates rather than being polled.
+func (r *CertificateReloader) Update(cert tls.Certificate) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.err = nil
+}
+
+// Err returns the error from the most recent reload, or nil if it succeeded.
+func (r *CertificateReloader) Err() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.err
+}
+
+// Close stops polling for new certificates. The current certificate is still
+// served.
+func (r *CertificateReloader) Close() {
+	r.closeOnce.Do(func() {
+		close(r.stop)
+	})
+	<-r.done
+}
+
+func (r *CertificateReloader) current() (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.cert == nil {
+		return nil, errors.New("no certificate loaded")
+	}
+	return r.cert, nil
+}
+
+func (r *CertificateReloader) poll(interval time.Duration) {
+	defer close(r.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			_ = r.Reload()
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/bufbuild/connect-go/internal/assert"
+	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
+	"github.com/bufbuild/connect-go/internal/gen/connect/ping/v1/pingv1connect"
+)
+
+func TestCertificateReloader(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	first := writeTestCertificate(t, certFile, keyFile, 1)
+	reloader, err := connect.NewFileCertificateReloader(certFile, keyFile, 5*time.Millisecond)
+	assert.Nil(t, err)
+	t.Cleanup(reloader.Close)
+
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.TLS = &tls.Config{GetCertificate: reloader.GetCertificate, MinVersion: tls.VersionTLS12}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	roots := x509.NewCertPool()
+	roots.AddCert(first)
+	second := newTestCertificate(t, 2)
+	roots.AddCert(second.leaf)
+	// Send SNI, so that the server consults GetCertificate.
+	clientTLS := &tls.Config{RootCAs: roots, ServerName: "example.com", MinVersion: tls.VersionTLS12}
+	servedSerial := func() int64 {
+		conn, err := tls.Dial("tcp", server.Listener.Addr().String(), clientTLS)
+		assert.Nil(t, err)
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+	}
+	assert.Equal(t, servedSerial(), int64(1))
+
+	client := pingv1connect.NewPingServiceClient(&http.Client{}, server.URL, connect.WithTLSConfig(clientTLS))
+	stream := client.CumSum(context.Background())
+	assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: 1}))
+	response, err := stream.Receive()
+	assert.Nil(t, err)
+	assert.Equal(t, response.Sum, int64(1))
+
+	// Rotate, replacing the files atomically.
+	second.write(t, certFile, keyFile)
+	deadline := time.Now().Add(5 * time.Second)
+	loadedSerial := func() int64 {
+		leaf, err := x509.ParseCertificate(reloader.Certificate().Certificate[0])
+		assert.Nil(t, err)
+		return leaf.SerialNumber.Int64()
+	}
+	for loadedSerial() != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("certificate wasn't reloaded")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.Equal(t, servedSerial(), int64(2))
+	// The established stream is unaffected.
+	assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: 2}))
+	response, err = stream.Receive()
+	assert.Nil(t, err)
+	assert.Equal(t, response.Sum, int64(3))
+	assert.Nil(t, stream.CloseRequest())
+	assert.Nil(t, stream.CloseResponse())
+
+	// Invalid files keep the previous certificate.
+	assert.Nil(t, os.WriteFile(certFile, []byte("garbage"), 0o600))
+	assert.NotNil(t, reloader.Reload())
+	assert.NotNil(t, reloader.Err())
+	assert.Equal(t, servedSerial(), int64(2))
+}
+
+func TestCertificateReloaderUpdate(t *testing.T) {
+	t.Parallel()
+	reloader, err := connect.NewCertificateReloader(nil, 0)
+	assert.Nil(t, err)
+	defer reloader.Close()
+	_, err = reloader.GetClientCertificate(&tls.CertificateRequestInfo{})
+	assert.NotNil(t, err)
+	assert.NotNil(t, reloader.Reload())
+	cert := newTestCertificate(t, 3)
+	reloader.Update(cert.pair)
+	got, err := reloader.GetClientCertificate(&tls.CertificateRequestInfo{})
+	assert.Nil(t, err)
+	assert.Equal(t, got.Certificate, cert.pair.Certificate)
+	assert.Nil(t, reloader.Err())
+}
+
+type testCertificate struct {
+	leaf    *x509.Certificate
+	pair    tls.Certificate
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// newTestCertificate creates a self-signed certificate for example.com and
+// 127.0.0.1 with the given serial number.
+func newTestCertificate(t *testing.T, serial int64) *testCertificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: "example.com"},
+		DNSNames:              []string{"example.com"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+	cert := &testCertificate{
+		leaf:    leaf,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+	cert.pair, err = tls.X509KeyPair(cert.certPEM, cert.keyPEM)
+	assert.Nil(t, err)
+	return cert
+}
+
+func writeTestCertificate(t *testing.T, certFile, keyFile string, serial int64) *x509.Certificate {
+	t.Helper()
+	cert := newTestCertificate(t, serial)
+	cert.write(t, certFile, keyFile)
+	return cert.leaf
+}
+
+// write replaces the files by renaming, so readers never see a partial
+// update. The key is written first; a reader that sees the new key with the
+// old certificate fails and retries.
+func (c *testCertificate) write(t *testing.T, certFile, keyFile string) {
+	t.Helper()
+	for _, file := range []struct {
+		path string
+		data []byte
+	}{{keyFile, c.keyPEM}, {certFile, c.certPEM}} {
+		tmp := file.path + ".tmp"
+		assert.Nil(t, os.WriteFile(tmp, file.data, 0o600))
+		assert.Nil(t, os.Rename(tmp, file.path))
+	}
+}
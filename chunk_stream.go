@@ -0,0 +1,308 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// defaultUploadBackoff is the delay before the first retry of an upload.
+// Later retries double it.
+const defaultUploadBackoff = 100 * time.Millisecond
+
+// DefaultChunkSize is the chunk size [NewChunkWriter] uses if none is given.
+// It's large enough to amortize per-message overhead, but small enough to
+// stay well under the default message size limits of most servers and
+// proxies.
+const DefaultChunkSize = 32 * 1024
+
+// ChunkReader exposes a server stream of byte chunks, as used by file
+// download RPCs, as an [io.ReadCloser]. It's constructed with
+// [NewChunkReader].
+//
+// Messages are received as the reader is drained, so HTTP/2 flow control
+// applies backpressure to the server when the caller reads slowly.
+type ChunkReader[Res any] struct {
+	stream  *ServerStreamForClient[Res]
+	chunkOf func(*Res) []byte
+	pending []byte
+	err     error
+}
+
+// NewChunkReader reads the chunks of a server stream, using chunkOf to
+// extract the bytes from each message. For example:
+//
+//	stream, err := client.Download(ctx, connect.NewRequest(&filev1.DownloadRequest{Name: name}))
+//	if err != nil {
+//	  return err
+//	}
+//	reader := connect.NewChunkReader(stream, (*filev1.DownloadResponse).GetChunk)
+//	defer reader.Close()
+//	_, err = io.Copy(file, reader)
+func NewChunkReader[Res any](stream *ServerStreamForClient[Res], chunkOf func(*Res) []byte) *ChunkReader[Res] {
+	return &ChunkReader[Res]{stream: stream, chunkOf: chunkOf}
+}
+
+// Read implements [io.Reader]. It returns [io.EOF] once the server ends the
+// stream successfully, and the stream's error if the call fails.
+func (r *ChunkReader[Res]) Read(data []byte) (int, error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+	for len(r.pending) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if !r.stream.Receive() {
+			r.err = r.stream.Err()
+			if r.err == nil {
+				r.err = io.EOF
+			}
+			continue
+		}
+		r.pending = r.chunkOf(r.stream.Msg())
+	}
+	n := copy(data, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// Close closes the receive side of the stream. Closing the reader before it's
+// drained cancels the rest of the download.
+func (r *ChunkReader[Res]) Close() error {
+	return r.stream.Close()
+}
+
+// ChunkWriter exposes a server stream as an [io.WriteCloser], splitting the
+// written bytes into chunks of a fixed size. It's constructed with
+// [NewChunkWriter].
+//
+// Each chunk is sent as soon as it's full, and sending blocks while the
+// client isn't keeping up, so writers never buffer more than one chunk.
+type ChunkWriter[Res any] struct {
+	stream     *ServerStream[Res]
+	newMessage func(chunk []byte) *Res
+	chunkSize  int
+	pending    []byte
+	err        error
+}
+
+// NewChunkWriter writes chunks of at most chunkSize bytes to a server stream,
+// using newMessage to wrap each chunk in a message. The chunks passed to
+// newMessage aren't reused, so messages may retain them. If chunkSize isn't
+// positive, the writer uses [DefaultChunkSize]. For example:
+//
+//	writer := connect.NewChunkWriter(stream, 0, func(chunk []byte) *filev1.DownloadResponse {
+//	  return &filev1.DownloadResponse{Chunk: chunk}
+//	})
+//	if _, err := io.Copy(writer, file); err != nil {
+//	  return err
+//	}
+//	return writer.Close()
+func NewChunkWriter[Res any](stream *ServerStream[Res], chunkSize int, newMessage func(chunk []byte) *Res) *ChunkWriter[Res] {
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	return &ChunkWriter[Res]{
+		stream:     stream,
+		newMessage: newMessage,
+		chunkSize:  chunkSize,
+	}
+}
+
+// Write implements [io.Writer]. After a chunk fails to send, Write returns
+// the send error without accepting any more data.
+func (w *ChunkWriter[Res]) Write(data []byte) (int, error) {
+	var written int
+	for len(data) > 0 {
+		if w.err != nil {
+			return written, w.err
+		}
+		if w.pending == nil {
+			w.pending = make([]byte, 0, w.chunkSize)
+		}
+		n := copy(w.pending[len(w.pending):w.chunkSize], data)
+		w.pending = w.pending[:len(w.pending)+n]
+		data = data[n:]
+		written += n
+		if len(w.pending) == w.chunkSize {
+			w.send()
+		}
+	}
+	return written, w.err
+}
+
+// Flush sends any buffered bytes as a short chunk.
+func (w *ChunkWriter[Res]) Flush() error {
+	if w.err == nil && len(w.pending) > 0 {
+		w.send()
+	}
+	return w.err
+}
+
+// Close flushes the writer. It doesn't end the stream: that happens when the
+// handler returns.
+func (w *ChunkWriter[Res]) Close() error {
+	return w.Flush()
+}
+
+func (w *ChunkWriter[Res]) send() {
+	chunk := w.pending
+	w.pending = nil
+	w.err = w.stream.Send(w.newMessage(chunk))
+}
+
+// UploadOptions configure [Upload]. The zero value sends chunks of
+// [DefaultChunkSize] and makes a single attempt.
+type UploadOptions struct {
+	// ChunkSize is the maximum size of each chunk. If it isn't positive,
+	// uploads use DefaultChunkSize.
+	ChunkSize int
+	// MaxAttempts limits the number of times an upload is attempted. Once
+	// chunks have been sent, a client stream can't pick up where a failed
+	// stream left off, so retries start over on a new stream: uploads are
+	// only retried if the reader is an [io.Seeker], and only after errors
+	// with [CodeUnavailable], which indicate that the server didn't process
+	// the call. Servers must tolerate receiving the same upload more than
+	// once.
+	MaxAttempts int
+	// Backoff returns the delay before the supplied retry, starting from 1.
+	// If nil, the delay starts at 100ms and doubles with each retry.
+	Backoff func(retry int) time.Duration
+	// Progress, if non-nil, is called after each chunk is sent with the total
+	// number of bytes sent by the current attempt.
+	Progress func(sent int64)
+}
+
+// Upload sends everything read from reader on a client stream of byte chunks,
+// as used by file upload RPCs, and returns the server's response. It's the
+// client-side counterpart of [ChunkWriter] and [ChunkReader]: newStream opens
+// the stream (usually a method of a generated client), and newMessage wraps
+// each chunk in a message. The chunks passed to newMessage aren't reused, so
+// messages may retain them. For example:
+//
+//	response, err := connect.Upload(
+//	  ctx,
+//	  client.Upload,
+//	  file,
+//	  func(chunk []byte) *filev1.UploadRequest {
+//	    return &filev1.UploadRequest{Chunk: chunk}
+//	  },
+//	  connect.UploadOptions{MaxAttempts: 3},
+//	)
+//
+// Each chunk is sent before the next is read, so HTTP/2 flow control keeps a
+// slow server from being flooded.
+func Upload[Req, Res any](
+	ctx context.Context,
+	newStream func(context.Context) *ClientStreamForClient[Req, Res],
+	reader io.Reader,
+	newMessage func(chunk []byte) *Req,
+	options UploadOptions,
+) (*Response[Res], error) {
+	seeker, canRetry := reader.(io.Seeker)
+	var start int64
+	if canRetry && options.MaxAttempts > 1 {
+		var err error
+		if start, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+			canRetry = false
+		}
+	}
+	for attempt := 1; ; attempt++ {
+		response, err := upload(ctx, newStream, reader, newMessage, options)
+		if err == nil || !canRetry || attempt >= options.MaxAttempts || CodeOf(err) != CodeUnavailable {
+			return response, err
+		}
+		if err := sleepBeforeRetry(ctx, attempt, options.Backoff); err != nil {
+			return nil, err
+		}
+		if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+			return nil, errorf(CodeInternal, "rewind upload: %w", err)
+		}
+	}
+}
+
+// upload makes a single attempt to send the reader's contents.
+func upload[Req, Res any](
+	ctx context.Context,
+	newStream func(context.Context) *ClientStreamForClient[Req, Res],
+	reader io.Reader,
+	newMessage func(chunk []byte) *Req,
+	options UploadOptions,
+) (*Response[Res], error) {
+	// If the upload fails on our side, we cancel the call rather than closing
+	// the stream cleanly, so the server doesn't mistake a partial upload for
+	// a complete one.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream := newStream(ctx)
+	chunkSize := options.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	var sent int64
+	for {
+		chunk := make([]byte, chunkSize)
+		n, readErr := io.ReadFull(reader, chunk)
+		if n > 0 {
+			if err := stream.Send(newMessage(chunk[:n])); err != nil {
+				// If the server has already responded, CloseAndReceive
+				// returns its error.
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				cancel()
+				_, _ = stream.CloseAndReceive()
+				return nil, err
+			}
+			sent += int64(n)
+			if options.Progress != nil {
+				options.Progress(sent)
+			}
+		}
+		if errors.Is(readErr, io.EOF) || errors.Is(readErr, io.ErrUnexpectedEOF) {
+			break
+		}
+		if readErr != nil {
+			cancel()
+			_, _ = stream.CloseAndReceive()
+			return nil, readErr
+		}
+	}
+	return stream.CloseAndReceive()
+}
+
+func sleepBeforeRetry(ctx context.Context, retry int, backoff func(int) time.Duration) error {
+	const maxDoublings = 10
+	doublings := retry - 1
+	if doublings > maxDoublings {
+		doublings = maxDoublings
+	}
+	delay := defaultUploadBackoff << doublings
+	if backoff != nil {
+		delay = backoff(retry)
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return wrapIfContextDone(ctx, ctx.Err())
+	}
+}
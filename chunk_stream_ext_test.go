@@ -0,0 +1,150 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/bufbuild/connect-go/internal/assert"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestChunkStream(t *testing.T) {
+	t.Parallel()
+	const procedure = "/file.v1.FileService/Download"
+	const chunkSize = 7
+	errTruncated := errors.New("file truncated")
+	payload := bytes.Repeat([]byte("0123456789"), 10)
+	var chunks []int
+	mux := http.NewServeMux()
+	mux.Handle(procedure, connect.NewServerStreamHandler(
+		procedure,
+		func(_ context.Context, request *connect.Request[wrapperspb.StringValue], stream *connect.ServerStream[wrapperspb.BytesValue]) error {
+			writer := connect.NewChunkWriter(stream, chunkSize, func(chunk []byte) *wrapperspb.BytesValue {
+				chunks = append(chunks, len(chunk))
+				return wrapperspb.Bytes(chunk)
+			})
+			// Write in pieces that don't line up with the chunks.
+			for _, piece := range [][]byte{payload[:3], payload[3:50], payload[50:]} {
+				if _, err := writer.Write(piece); err != nil {
+					return err
+				}
+			}
+			if request.Msg.Value == "truncated" {
+				return connect.NewError(connect.CodeDataLoss, errTruncated)
+			}
+			return writer.Close()
+		},
+	))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := connect.NewClient[wrapperspb.StringValue, wrapperspb.BytesValue](server.Client(), server.URL+procedure)
+	download := func(t *testing.T, name string) ([]byte, error) {
+		t.Helper()
+		stream, err := client.CallServerStream(context.Background(), connect.NewRequest(wrapperspb.String(name)))
+		assert.Nil(t, err)
+		reader := connect.NewChunkReader(stream, (*wrapperspb.BytesValue).GetValue)
+		defer func() { _ = reader.Close() }()
+		var got bytes.Buffer
+		// A small buffer exercises reads that span chunks.
+		_, err = io.CopyBuffer(&got, reader, make([]byte, 5))
+		return got.Bytes(), err
+	}
+
+	got, err := download(t, "complete")
+	assert.Nil(t, err)
+	assert.Equal(t, got, payload)
+	assert.Equal(t, chunks, []int{7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 2})
+
+	got, err = download(t, "truncated")
+	assert.Equal(t, connect.CodeOf(err), connect.CodeDataLoss)
+	assert.Equal(t, len(got), 98)
+}
+
+func TestUpload(t *testing.T) {
+	t.Parallel()
+	const procedure = "/file.v1.FileService/Upload"
+	payload := bytes.Repeat([]byte("0123456789"), 10)
+	var attempts int64
+	mux := http.NewServeMux()
+	mux.Handle(procedure, connect.NewClientStreamHandler(
+		procedure,
+		func(_ context.Context, stream *connect.ClientStream[wrapperspb.BytesValue]) (*connect.Response[wrapperspb.Int64Value], error) {
+			var received []byte
+			for stream.Receive() {
+				received = append(received, stream.Msg().Value...)
+			}
+			if err := stream.Err(); err != nil {
+				return nil, err
+			}
+			if atomic.AddInt64(&attempts, 1) == 1 {
+				return nil, connect.NewError(connect.CodeUnavailable, errors.New("storage unavailable"))
+			}
+			if !bytes.Equal(received, payload) {
+				return nil, connect.NewError(connect.CodeDataLoss, errors.New("corrupt upload"))
+			}
+			return connect.NewResponse(wrapperspb.Int64(int64(len(received)))), nil
+		},
+	))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := connect.NewClient[wrapperspb.BytesValue, wrapperspb.Int64Value](server.Client(), server.URL+procedure)
+	newMessage := func(chunk []byte) *wrapperspb.BytesValue {
+		return wrapperspb.Bytes(chunk)
+	}
+	var progress []int64
+	options := connect.UploadOptions{
+		ChunkSize:   30,
+		MaxAttempts: 2,
+		Backoff:     func(int) time.Duration { return time.Millisecond },
+		Progress:    func(sent int64) { progress = append(progress, sent) },
+	}
+
+	response, err := connect.Upload(context.Background(), client.CallClientStream, bytes.NewReader(payload), newMessage, options)
+	assert.Nil(t, err)
+	assert.Equal(t, response.Msg.Value, int64(len(payload)))
+	assert.Equal(t, atomic.LoadInt64(&attempts), int64(2))
+	assert.Equal(t, progress, []int64{30, 60, 90, 100, 30, 60, 90, 100})
+
+	// Readers that can't rewind aren't retried.
+	atomic.StoreInt64(&attempts, 0)
+	_, err = connect.Upload(context.Background(), client.CallClientStream, io.MultiReader(bytes.NewReader(payload)), newMessage, options)
+	assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+	assert.Equal(t, atomic.LoadInt64(&attempts), int64(1))
+
+	// Read errors cancel the call, rather than completing a partial upload.
+	atomic.StoreInt64(&attempts, 1)
+	errRead := errors.New("disk error")
+	_, err = connect.Upload(context.Background(), client.CallClientStream, io.MultiReader(bytes.NewReader(payload), &failingReader{err: errRead}), newMessage, options)
+	assert.ErrorIs(t, err, errRead)
+	assert.Equal(t, atomic.LoadInt64(&attempts), int64(1))
+}
+
+type failingReader struct {
+	err error
+}
+
+func (r *failingReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
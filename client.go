@@ -19,6 +19,9 @@ import (
 	"errors"
 	"io"
 	"net/http"
+	"time"
+
+	"google.golang.org/protobuf/proto"
 )
 
 // Client is a reusable, concurrency-safe client for a single procedure.
@@ -44,6 +47,32 @@ func NewClient[Req, Res any](httpClient HTTPClient, url string, options ...Clien
 		return client
 	}
 	client.config = config
+	if config.Dialer != nil {
+		httpClient, err = config.Dialer.wrap(httpClient)
+		if err != nil {
+			client.err = err
+			return client
+		}
+	}
+	if config.TLSConfig != nil {
+		httpClient, err = config.TLSConfig.wrap(httpClient)
+		if err != nil {
+			client.err = err
+			return client
+		}
+	}
+	if config.StrictHeaders {
+		httpClient = &strictHeaderClient{next: httpClient}
+	}
+	if config.LoadBalancer != nil {
+		httpClient = &balancedClient{
+			next:       httpClient,
+			balancer:   config.LoadBalancer,
+			quarantine: config.EndpointQuarantine,
+			procedure:  config.Procedure,
+		}
+	}
+	httpClient = newWaitForReadyClient(httpClient, config.WaitForReady)
 	protocolClient, protocolErr := client.config.Protocol.NewClient(
 		&protocolClientParams{
 			CompressionName: config.RequestCompressionName,
@@ -51,14 +80,33 @@ func NewClient[Req, Res any](httpClient HTTPClient, url string, options ...Clien
 				config.CompressionPools,
 				config.CompressionNames,
 			),
-			Codec:            config.Codec,
-			Protobuf:         config.protobuf(),
-			CompressMinBytes: config.CompressMinBytes,
-			HTTPClient:       httpClient,
-			URL:              url,
-			BufferPool:       config.BufferPool,
-			ReadMaxBytes:     config.ReadMaxBytes,
-			SendMaxBytes:     config.SendMaxBytes,
+			Codec:                      config.Codec,
+			Protobuf:                   config.protobuf(),
+			CompressMinBytes:           config.CompressMinBytes,
+			CodecCompressMinBytes:      config.CodecCompressMinBytes,
+			CompressionPolicy:          config.CompressionPolicy,
+			PayloadSigner:              config.PayloadSigner,
+			AWSSigV4:                   config.AWSSigV4,
+			HTTPClient:                 httpClient,
+			URL:                        url,
+			BufferPool:                 config.BufferPool,
+			ReadMaxBytes:               config.ReadMaxBytes,
+			SendMaxBytes:               config.SendMaxBytes,
+			FirstReadMaxBytes:          config.FirstReadMaxBytes,
+			FirstSendMaxBytes:          config.FirstSendMaxBytes,
+			ReadMaxHeaderBytes:         config.ReadMaxHeaderBytes,
+			CancelGracePeriod:          config.CancelGracePeriod,
+			EnableGet:                  config.EnableGet,
+			GetMaxURLSize:              config.GetMaxURLSize,
+			TimeoutSkew:                config.TimeoutSkew,
+			UnaryResponseLimitBehavior: config.UnaryResponseLimitBehavior,
+			MessageMetadata:            config.MessageMetadata,
+			EnvelopeFlags:              newEnvelopeFlagSet(config.EnvelopeFlags),
+			HTTPStatusCodes:            config.HTTPStatusCodes,
+			Initializer:                config.Initializer,
+			TypeResolver:               config.TypeResolver,
+			Progress:                   config.Progress,
+			SerializationTiming:        config.SerializationTiming,
 		},
 	)
 	if protocolErr != nil {
@@ -70,7 +118,7 @@ func NewClient[Req, Res any](httpClient HTTPClient, url string, options ...Clien
 	// once at client creation.
 	unarySpec := config.newSpec(StreamTypeUnary)
 	unaryFunc := UnaryFunc(func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
-		conn := client.protocolClient.NewConn(ctx, unarySpec, request.Header())
+		conn := followDeadlineExtensions(ctx, client.protocolClient.NewConn(ctx, unarySpec, request.Header()))
 		// Send always returns an io.EOF unless the error is from the client-side.
 		// We want the user to continue to call Receive in those cases to get the
 		// full error from the server-side.
@@ -84,23 +132,53 @@ func NewClient[Req, Res any](httpClient HTTPClient, url string, options ...Clien
 			return nil, err
 		}
 		response, err := receiveUnaryResponse[Res](conn)
+		if typed, ok := request.(*Request[Req]); ok {
+			// Now that we've connected, the peer address is more precise.
+			typed.peer = conn.Peer()
+		}
 		if err != nil {
 			_ = conn.CloseResponse()
 			return nil, err
 		}
 		return response, conn.CloseResponse()
 	})
+	if config.Retrier != nil {
+		unaryFunc = newRetryingUnary[Req](unaryFunc, config.Retrier)
+	}
+	if config.SingleFlight {
+		unaryFunc = newSingleFlightUnary[Res](unaryFunc, config.Codec, singleFlightPerCallHeaders(config.CallIDs))
+	}
 	if interceptor := config.Interceptor; interceptor != nil {
 		unaryFunc = interceptor.WrapUnary(unaryFunc)
 	}
+	if config.CodedErrors {
+		next := unaryFunc
+		unaryFunc = func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
+			response, err := next(ctx, request)
+			return response, toError(err)
+		}
+	}
 	client.callUnary = func(ctx context.Context, request *Request[Req]) (*Response[Res], error) {
 		// To make the specification, peer, and RPC headers visible to the full
 		// interceptor chain (as though they were supplied by the caller), we'll
 		// add them here.
 		request.spec = unarySpec
 		request.peer = client.protocolClient.Peer()
+		ctx, cancel := withDefaultTimeout(ctx, config.DefaultCallTimeout)
+		if cancel != nil {
+			defer cancel()
+		}
 		protocolClient.WriteRequestHeader(StreamTypeUnary, request.Header())
+		ctx = config.CallIDs.assignClient(ctx)
+		config.CallIDs.writeClientHeader(ctx, request.Header())
+		ctx = config.RouteExtractor.assign(ctx, request.Header(), request.Any())
+		config.RouteExtractor.writeClientHeader(ctx, request.Header())
+		release, err := config.CallLimiter.acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
 		response, err := unaryFunc(ctx, request)
+		release()
 		if err != nil {
 			return nil, err
 		}
@@ -126,7 +204,11 @@ func (c *Client[Req, Res]) CallClientStream(ctx context.Context) *ClientStreamFo
 	if c.err != nil {
 		return &ClientStreamForClient[Req, Res]{err: c.err}
 	}
-	return &ClientStreamForClient[Req, Res]{conn: c.newConn(ctx, StreamTypeClient)}
+	conn, err := c.newConn(ctx, StreamTypeClient)
+	if err != nil {
+		return &ClientStreamForClient[Req, Res]{err: err}
+	}
+	return &ClientStreamForClient[Req, Res]{conn: conn}
 }
 
 // CallServerStream calls a server streaming procedure.
@@ -134,8 +216,34 @@ func (c *Client[Req, Res]) CallServerStream(ctx context.Context, request *Reques
 	if c.err != nil {
 		return nil, c.err
 	}
-	conn := c.newConn(ctx, StreamTypeServer)
-	mergeHeaders(conn.RequestHeader(), request.header)
+	conn, err := c.openServerStream(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	stream := &ServerStreamForClient[Res]{conn: conn}
+	if c.config.ReconnectOnDrain > 0 {
+		stream.maxReconnects = c.config.ReconnectOnDrain
+		stream.reconnect = func(delay time.Duration) (StreamingClientConn, error) {
+			timer := time.NewTimer(delay)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				return nil, wrapIfContextDone(ctx, ctx.Err())
+			}
+			return c.openServerStream(ctx, request)
+		}
+	}
+	return stream, nil
+}
+
+// openServerStream starts a server streaming call and sends the request.
+func (c *Client[Req, Res]) openServerStream(ctx context.Context, request *Request[Req]) (StreamingClientConn, error) {
+	conn, err := c.newConn(ctx, StreamTypeServer)
+	if err != nil {
+		return nil, err
+	}
+	mergeHeadersWithPolicy(conn.RequestHeader(), request.header, c.config.HeaderMergePolicy)
 	// Send always returns an io.EOF unless the error is from the client-side.
 	// We want the user to continue to call Receive in those cases to get the
 	// full error from the server-side.
@@ -145,9 +253,10 @@ func (c *Client[Req, Res]) CallServerStream(ctx context.Context, request *Reques
 		return nil, err
 	}
 	if err := conn.CloseRequest(); err != nil {
+		_ = conn.CloseResponse()
 		return nil, err
 	}
-	return &ServerStreamForClient[Res]{conn: conn}, nil
+	return conn, nil
 }
 
 // CallBidiStream calls a bidirectional streaming procedure.
@@ -155,33 +264,94 @@ func (c *Client[Req, Res]) CallBidiStream(ctx context.Context) *BidiStreamForCli
 	if c.err != nil {
 		return &BidiStreamForClient[Req, Res]{err: c.err}
 	}
-	return &BidiStreamForClient[Req, Res]{conn: c.newConn(ctx, StreamTypeBidi)}
+	conn, err := c.newConn(ctx, StreamTypeBidi)
+	if err != nil {
+		return &BidiStreamForClient[Req, Res]{err: err}
+	}
+	return &BidiStreamForClient[Req, Res]{conn: conn}
 }
 
-func (c *Client[Req, Res]) newConn(ctx context.Context, streamType StreamType) StreamingClientConn {
+func (c *Client[Req, Res]) newConn(ctx context.Context, streamType StreamType) (StreamingClientConn, error) {
+	ctx, cancel := withDefaultTimeout(ctx, c.config.DefaultCallTimeout)
+	release, err := c.config.CallLimiter.acquire(ctx)
+	if err != nil {
+		if cancel != nil {
+			cancel()
+		}
+		return nil, err
+	}
 	newConn := func(ctx context.Context, spec Spec) StreamingClientConn {
 		header := make(http.Header, 8) // arbitrary power of two, prevent immediate resizing
 		c.protocolClient.WriteRequestHeader(streamType, header)
-		return c.protocolClient.NewConn(ctx, spec, header)
+		c.config.CallIDs.writeClientHeader(ctx, header)
+		c.config.RouteExtractor.writeClientHeader(ctx, header)
+		return followDeadlineExtensions(ctx, c.protocolClient.NewConn(ctx, spec, header))
 	}
 	if interceptor := c.config.Interceptor; interceptor != nil {
 		newConn = interceptor.WrapStreamingClient(newConn)
 	}
-	return newConn(ctx, c.config.newSpec(streamType))
+	conn := newConn(c.config.CallIDs.assignClient(ctx), c.config.newSpec(streamType))
+	if c.config.CodedErrors {
+		conn = &codedErrorsClientConn{StreamingClientConn: conn}
+	}
+	if c.config.CallLimiter != nil {
+		conn = &limitedClientConn{StreamingClientConn: conn, release: release}
+	}
+	if cancel != nil {
+		conn = &timeoutClientConn{StreamingClientConn: conn, cancel: cancel}
+	}
+	return conn, nil
 }
 
 type clientConfig struct {
-	Protocol               protocol
-	Procedure              string
-	CompressMinBytes       int
-	Interceptor            Interceptor
-	CompressionPools       map[string]*compressionPool
-	CompressionNames       []string
-	Codec                  Codec
-	RequestCompressionName string
-	BufferPool             *bufferPool
-	ReadMaxBytes           int
-	SendMaxBytes           int
+	Protocol                   protocol
+	Procedure                  string
+	IdempotencyLevel           IdempotencyLevel
+	EnableGet                  bool
+	GetMaxURLSize              int
+	CompressMinBytes           int
+	CodecCompressMinBytes      map[string]int
+	CompressionPolicy          CompressionPolicy
+	PayloadSigner              PayloadSigner
+	AWSSigV4                   *awsSigV4Signer
+	Interceptor                Interceptor
+	CompressionPools           map[string]*compressionPool
+	CompressionNames           []string
+	Codec                      Codec
+	RequestCompressionName     string
+	BufferPool                 *bufferPool
+	ReadMaxBytes               int
+	SendMaxBytes               int
+	FirstReadMaxBytes          int
+	FirstSendMaxBytes          int
+	ReadMaxHeaderBytes         int
+	CancelGracePeriod          time.Duration
+	TimeoutSkew                time.Duration
+	DefaultCallTimeout         time.Duration
+	WaitForReady               bool
+	LoadBalancer               *loadBalancer
+	EndpointQuarantine         *EndpointQuarantine
+	UnaryResponseLimitBehavior ResponseLimitBehavior
+	MessageMetadata            bool
+	EnvelopeFlags              []EnvelopeFlag
+	Dialer                     *dialerOption
+	TLSConfig                  *tlsConfigOption
+	Retrier                    *retrier
+	HTTPStatusCodes            func(int) (Code, bool)
+	Initializer                func(Spec, any) error
+	ProtoUnmarshalOptions      *proto.UnmarshalOptions
+	TypeResolver               TypeResolver
+	HeaderMergePolicy          HeaderMergePolicy
+	CodedErrors                bool
+	CallIDs                    *callIDPolicy
+	RouteExtractor             *RouteExtractor
+	StrictHeaders              bool
+	CallLimiter                *callLimiter
+	SingleFlight               bool
+	ReconnectOnDrain           int
+	Progress                   func(Progress)
+	SerializationTiming        func(context.Context, SerializationTiming)
+	InitErr                    *Error // set by options that can't be applied
 }
 
 func newClientConfig(url string, options []ClientOption) (*clientConfig, *Error) {
@@ -191,12 +361,19 @@ func newClientConfig(url string, options []ClientOption) (*clientConfig, *Error)
 		Procedure:        protoPath,
 		CompressionPools: make(map[string]*compressionPool),
 		BufferPool:       newBufferPool(),
+		GetMaxURLSize:    connectUnaryDefaultGetMaxURLSize,
 	}
 	withProtoBinaryCodec().applyToClient(&config)
 	withGzip().applyToClient(&config)
 	for _, opt := range options {
 		opt.applyToClient(&config)
 	}
+	config.Codec = configureProtoCodec(
+		config.Codec,
+		config.ProtoUnmarshalOptions,
+		config.TypeResolver,
+		config.Initializer != nil,
+	)
 	if err := config.validate(); err != nil {
 		return nil, err
 	}
@@ -204,6 +381,18 @@ func newClientConfig(url string, options []ClientOption) (*clientConfig, *Error)
 }
 
 func (c *clientConfig) validate() *Error {
+	if c.InitErr != nil {
+		return c.InitErr
+	}
+	if _, ok := c.Protocol.(*protocolConnect); c.AWSSigV4 != nil && !ok {
+		return errorf(CodeUnknown, "AWS SigV4 signing requires the Connect protocol")
+	}
+	if c.AWSSigV4 != nil && c.LoadBalancer != nil {
+		return errorf(CodeUnknown, "AWS SigV4 signing can't be combined with load balancing")
+	}
+	if c.EndpointQuarantine != nil && c.LoadBalancer == nil {
+		return errorf(CodeUnknown, "endpoint quarantine requires load balancing")
+	}
 	if c.Codec == nil || c.Codec.Name() == "" {
 		return errorf(CodeUnknown, "no codec configured")
 	}
@@ -224,8 +413,59 @@ func (c *clientConfig) protobuf() Codec {
 
 func (c *clientConfig) newSpec(t StreamType) Spec {
 	return Spec{
-		StreamType: t,
-		Procedure:  c.Procedure,
-		IsClient:   true,
+		StreamType:       t,
+		Procedure:        c.Procedure,
+		IsClient:         true,
+		IdempotencyLevel: c.IdempotencyLevel,
+	}
+}
+
+// codedErrorsClientConn wraps every error other than the io.EOF that marks the
+// end of a stream in an *Error, so callers configured with WithCodedErrors
+// never see bare context, network, or interceptor errors.
+type codedErrorsClientConn struct {
+	StreamingClientConn
+}
+
+func (c *codedErrorsClientConn) Send(msg any) error {
+	return wrapIfUncodedStreamError(c.StreamingClientConn.Send(msg))
+}
+
+func (c *codedErrorsClientConn) CloseRequest() error {
+	return wrapIfUncodedStreamError(c.StreamingClientConn.CloseRequest())
+}
+
+func (c *codedErrorsClientConn) Receive(msg any) error {
+	return wrapIfUncodedStreamError(c.StreamingClientConn.Receive(msg))
+}
+
+func (c *codedErrorsClientConn) SendWithMetadata(msg any, metadata http.Header) error {
+	return wrapIfUncodedStreamError(SendWithMetadata(c.StreamingClientConn, msg, metadata))
+}
+
+func (c *codedErrorsClientConn) ReceiveWithMetadata(msg any) (http.Header, error) {
+	metadata, err := ReceiveWithMetadata(c.StreamingClientConn, msg)
+	return metadata, wrapIfUncodedStreamError(err)
+}
+
+func (c *codedErrorsClientConn) SendWithEnvelopeFlags(msg any, flags []string) error {
+	return wrapIfUncodedStreamError(SendWithEnvelopeFlags(c.StreamingClientConn, msg, flags...))
+}
+
+func (c *codedErrorsClientConn) ReceiveWithEnvelopeFlags(msg any) ([]string, error) {
+	flags, err := ReceiveWithEnvelopeFlags(c.StreamingClientConn, msg)
+	return flags, wrapIfUncodedStreamError(err)
+}
+
+func (c *codedErrorsClientConn) CloseResponse() error {
+	return wrapIfUncodedStreamError(c.StreamingClientConn.CloseResponse())
+}
+
+// wrapIfUncodedStreamError is like toError, but it leaves io.EOF unchanged so
+// that callers can still detect the end of the stream.
+func wrapIfUncodedStreamError(err error) error {
+	if errors.Is(err, io.EOF) {
+		return err
 	}
+	return toError(err)
 }
@@ -15,16 +15,27 @@
 package connect_test
 
 import (
+	"compress/gzip"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/bufbuild/connect-go"
 	"github.com/bufbuild/connect-go/internal/assert"
 	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
 	"github.com/bufbuild/connect-go/internal/gen/connect/ping/v1/pingv1connect"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoregistry"
 )
 
 func TestNewClient_InitFailure(t *testing.T) {
@@ -131,6 +142,246 @@ func TestClientPeer(t *testing.T) {
 	})
 }
 
+func TestClientProxyCompressedResponse(t *testing.T) {
+	t.Parallel()
+	// gzipProxy simulates an intermediary that gzips response bodies,
+	// advertising the coding with the supplied Content-Encoding (if any).
+	gzipProxy := func(contentEncoding string) http.Handler {
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Header.Del("Accept-Encoding")
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, r)
+			for k, v := range recorder.Header() {
+				w.Header()[k] = v
+			}
+			w.Header().Del("Content-Length")
+			if contentEncoding != "" {
+				w.Header().Set("Content-Encoding", contentEncoding)
+			}
+			w.WriteHeader(recorder.Code)
+			gzipWriter := gzip.NewWriter(w)
+			_, err := gzipWriter.Write(recorder.Body.Bytes())
+			assert.Nil(t, err)
+			assert.Nil(t, gzipWriter.Close())
+		})
+	}
+	run := func(t *testing.T, contentEncoding string, opts ...connect.ClientOption) {
+		t.Helper()
+		server := httptest.NewServer(gzipProxy(contentEncoding))
+		t.Cleanup(server.Close)
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opts...)
+		request := connect.NewRequest(&pingv1.PingRequest{Number: 42, Text: "hello"})
+		response, err := client.Ping(context.Background(), request)
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.Number, 42)
+		assert.Equal(t, response.Msg.Text, "hello")
+		_, err = client.Fail(context.Background(), connect.NewRequest(&pingv1.FailRequest{Code: int32(connect.CodeResourceExhausted)}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+	}
+	t.Run("x-gzip", func(t *testing.T) {
+		t.Parallel()
+		run(t, "x-gzip")
+	})
+	t.Run("gzip_not_accepted", func(t *testing.T) {
+		t.Parallel()
+		run(t, "gzip", connect.WithAcceptCompression("gzip", nil, nil))
+	})
+	t.Run("missing_content_encoding", func(t *testing.T) {
+		t.Parallel()
+		run(t, "")
+	})
+	t.Run("json", func(t *testing.T) {
+		t.Parallel()
+		run(t, "", connect.WithProtoJSON())
+	})
+}
+
+func TestClientHTTPStatusCodes(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cdn/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cf-Ray", "abc123")
+		w.WriteHeader(520)
+		_, _ = w.Write([]byte("<html>origin error</html>"))
+	})
+	mux.HandleFunc("/moved/", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/elsewhere"+r.URL.Path, http.StatusPermanentRedirect)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	httpClient := server.Client()
+	httpClient.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	mapping := connect.WithHTTPStatusCodes(func(status int) (connect.Code, bool) {
+		switch {
+		case status >= 520 && status <= 527:
+			return connect.CodeUnavailable, true
+		case status >= 300 && status < 400:
+			return connect.CodeFailedPrecondition, true
+		}
+		return 0, false
+	})
+	run := func(t *testing.T, path string, opts ...connect.ClientOption) *connect.Error {
+		t.Helper()
+		client := pingv1connect.NewPingServiceClient(httpClient, server.URL+path, opts...)
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		var connectErr *connect.Error
+		assert.True(t, errors.As(err, &connectErr))
+		return connectErr
+	}
+	for _, protocol := range []struct {
+		name string
+		opt  connect.ClientOption
+	}{
+		{name: "connect", opt: connect.WithConnect()},
+		{name: "grpc", opt: connect.WithGRPC()},
+		{name: "grpcweb", opt: connect.WithGRPCWeb()},
+	} {
+		protocol := protocol
+		t.Run(protocol.name, func(t *testing.T) {
+			t.Parallel()
+			err := run(t, "/cdn", protocol.opt)
+			assert.Equal(t, err.Code(), connect.CodeUnknown)
+			err = run(t, "/cdn", protocol.opt, mapping)
+			assert.Equal(t, err.Code(), connect.CodeUnavailable)
+			assert.Equal(t, err.Meta().Get("Cf-Ray"), "abc123")
+			var statusErr *connect.HTTPStatusError
+			assert.True(t, errors.As(err, &statusErr))
+			assert.Equal(t, statusErr.StatusCode, 520)
+
+			err = run(t, "/moved", protocol.opt, mapping)
+			assert.Equal(t, err.Code(), connect.CodeFailedPrecondition)
+			assert.True(t, strings.HasPrefix(err.Meta().Get("Location"), "/elsewhere/moved/"))
+			assert.True(t, errors.As(err, &statusErr))
+			assert.Equal(t, statusErr.StatusCode, http.StatusPermanentRedirect)
+		})
+	}
+}
+
+func TestClientDialer(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	backend := server.Listener.Addr().String()
+	var dialed int32
+	dialer := connect.WithDialer(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		atomic.AddInt32(&dialed, 1)
+		var netDialer net.Dialer
+		return netDialer.DialContext(ctx, network, backend)
+	})
+
+	t.Run("peer", func(t *testing.T) {
+		t.Parallel()
+		var unaryPeer connect.Peer
+		client := pingv1connect.NewPingServiceClient(
+			&http.Client{},
+			"http://ping.invalid",
+			dialer,
+			connect.WithInterceptors(connect.UnaryInterceptorFunc(func(next connect.UnaryFunc) connect.UnaryFunc {
+				return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+					assert.Equal(t, req.Peer().Addr, "ping.invalid")
+					res, err := next(ctx, req)
+					unaryPeer = req.Peer()
+					return res, err
+				}
+			})),
+		)
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Nil(t, err)
+		assert.Equal(t, unaryPeer.Addr, backend)
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 1}))
+		assert.Nil(t, err)
+		assert.True(t, stream.Receive())
+		assert.Nil(t, stream.Close())
+		assert.True(t, atomic.LoadInt32(&dialed) > 0)
+	})
+	t.Run("unsupported_client", func(t *testing.T) {
+		t.Parallel()
+		client := pingv1connect.NewPingServiceClient(
+			httpClientFunc(http.DefaultClient.Do),
+			"http://ping.invalid",
+			dialer,
+		)
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnknown)
+	})
+}
+
+type httpClientFunc func(*http.Request) (*http.Response, error)
+
+func (f httpClientFunc) Do(request *http.Request) (*http.Response, error) {
+	return f(request)
+}
+
+func TestClientTLSConfig(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	backend := server.Listener.Addr().String()
+	ping := func(client pingv1connect.PingServiceClient) error {
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		return err
+	}
+
+	t.Run("roots", func(t *testing.T) {
+		t.Parallel()
+		client := pingv1connect.NewPingServiceClient(&http.Client{}, server.URL)
+		assert.NotNil(t, ping(client))
+		client = pingv1connect.NewPingServiceClient(
+			&http.Client{},
+			server.URL,
+			connect.WithTLSConfig(&tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}),
+		)
+		assert.Nil(t, ping(client))
+	})
+	t.Run("server_name", func(t *testing.T) {
+		t.Parallel()
+		// The test certificate is valid for example.com, but not ping.invalid.
+		dialer := connect.WithDialer(func(ctx context.Context, network, addr string) (net.Conn, error) {
+			var netDialer net.Dialer
+			return netDialer.DialContext(ctx, network, backend)
+		})
+		client := pingv1connect.NewPingServiceClient(
+			&http.Client{},
+			"https://ping.invalid",
+			dialer,
+			connect.WithTLSConfig(&tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}),
+		)
+		assert.NotNil(t, ping(client))
+		client = pingv1connect.NewPingServiceClient(
+			&http.Client{},
+			"https://ping.invalid",
+			dialer,
+			connect.WithTLSConfig(&tls.Config{RootCAs: roots, ServerName: "example.com", MinVersion: tls.VersionTLS12}),
+		)
+		assert.Nil(t, ping(client))
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 1}))
+		assert.Nil(t, err)
+		assert.True(t, stream.Receive())
+		assert.Nil(t, stream.Close())
+	})
+	t.Run("unsupported_client", func(t *testing.T) {
+		t.Parallel()
+		client := pingv1connect.NewPingServiceClient(
+			httpClientFunc(http.DefaultClient.Do),
+			server.URL,
+			connect.WithTLSConfig(&tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}),
+		)
+		assert.Equal(t, connect.CodeOf(ping(client)), connect.CodeUnknown)
+	})
+}
+
 type assertPeerInterceptor struct {
 	tb testing.TB
 }
@@ -156,3 +407,780 @@ func (a *assertPeerInterceptor) WrapStreamingHandler(next connect.StreamingHandl
 		return next(ctx, conn)
 	}
 }
+
+func TestInitializer(t *testing.T) {
+	t.Parallel()
+	var handlerCalls, clientCalls int32
+	errUninitialized := errors.New("uninitialized")
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		pingServer{},
+		connect.WithInitializer(func(spec connect.Spec, message any) error {
+			assert.Equal(t, spec.IsClient, false)
+			if _, ok := message.(*pingv1.PingRequest); !ok {
+				return errUninitialized
+			}
+			atomic.AddInt32(&handlerCalls, 1)
+			return nil
+		}),
+	))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := pingv1connect.NewPingServiceClient(
+		server.Client(),
+		server.URL,
+		connect.WithInitializer(func(spec connect.Spec, message any) error {
+			assert.Equal(t, spec.IsClient, true)
+			if _, ok := message.(*pingv1.PingResponse); !ok {
+				return errUninitialized
+			}
+			atomic.AddInt32(&clientCalls, 1)
+			return nil
+		}),
+	)
+	response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 42}))
+	assert.Nil(t, err)
+	assert.Equal(t, response.Msg.Number, 42)
+	assert.Equal(t, atomic.LoadInt32(&handlerCalls), 1)
+	// Clients also initialize the message used to check for unexpected extra
+	// responses.
+	assert.True(t, atomic.LoadInt32(&clientCalls) > 0)
+
+	_, err = client.Sum(context.Background()).CloseAndReceive()
+	assert.NotNil(t, err)
+	assert.Equal(t, connect.CodeOf(err), connect.CodeInternal)
+	assert.True(t, strings.Contains(err.Error(), errUninitialized.Error()))
+}
+
+func TestInitializerDefaults(t *testing.T) {
+	t.Parallel()
+	const procedure = "/" + pingv1connect.PingServiceName + "/Ping"
+	mux := http.NewServeMux()
+	mux.Handle(procedure, connect.NewUnaryHandler(
+		procedure,
+		func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			return connect.NewResponse(&pingv1.PingResponse{Number: request.Msg.Number, Text: request.Msg.Text}), nil
+		},
+		connect.WithInitializer(func(_ connect.Spec, message any) error {
+			if request, ok := message.(*pingv1.PingRequest); ok {
+				request.Text = "default"
+			}
+			return nil
+		}),
+	))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	for _, codec := range []string{"proto", "json"} {
+		codec := codec
+		t.Run(codec, func(t *testing.T) {
+			t.Parallel()
+			var options []connect.ClientOption
+			if codec == "json" {
+				options = append(options, connect.WithProtoJSON())
+			}
+			client := connect.NewClient[pingv1.PingRequest, pingv1.PingResponse](
+				server.Client(),
+				server.URL+procedure,
+				options...,
+			)
+			// The initializer's default survives unmarshaling.
+			response, err := client.CallUnary(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 42}))
+			assert.Nil(t, err)
+			assert.Equal(t, response.Msg.Number, 42)
+			assert.Equal(t, response.Msg.Text, "default")
+			// Fields set by the client take precedence.
+			response, err = client.CallUnary(context.Background(), connect.NewRequest(&pingv1.PingRequest{Text: "custom"}))
+			assert.Nil(t, err)
+			assert.Equal(t, response.Msg.Text, "custom")
+		})
+	}
+}
+
+func TestClientTypeResolver(t *testing.T) {
+	t.Parallel()
+	const procedure = "/" + pingv1connect.PingServiceName + "/Fail"
+	mux := http.NewServeMux()
+	mux.Handle(procedure, connect.NewUnaryHandler(
+		procedure,
+		func(context.Context, *connect.Request[pingv1.FailRequest]) (*connect.Response[pingv1.FailResponse], error) {
+			err := connect.NewError(connect.CodeFailedPrecondition, errors.New("oh no"))
+			detail, detailErr := connect.NewErrorDetail(&pingv1.PingRequest{Text: "detail"})
+			if detailErr != nil {
+				return nil, detailErr
+			}
+			err.AddDetail(detail)
+			return nil, err
+		},
+	))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	registry := new(protoregistry.Types)
+	assert.Nil(t, registry.RegisterMessage((&pingv1.PingRequest{}).ProtoReflect().Type()))
+	for _, protocol := range []struct {
+		name string
+		opt  connect.ClientOption
+	}{
+		{name: "connect", opt: connect.WithConnect()},
+		{name: "grpc", opt: connect.WithGRPC()},
+		{name: "grpcweb", opt: connect.WithGRPCWeb()},
+	} {
+		protocol := protocol
+		t.Run(protocol.name, func(t *testing.T) {
+			t.Parallel()
+			detailValue := func(t *testing.T, resolver connect.TypeResolver) (proto.Message, error) {
+				t.Helper()
+				client := pingv1connect.NewPingServiceClient(
+					server.Client(),
+					server.URL,
+					protocol.opt,
+					connect.WithTypeResolver(resolver),
+				)
+				_, err := client.Fail(context.Background(), connect.NewRequest(&pingv1.FailRequest{}))
+				var connectErr *connect.Error
+				assert.True(t, errors.As(err, &connectErr))
+				assert.Equal(t, len(connectErr.Details()), 1)
+				return connectErr.Details()[0].Value()
+			}
+			value, err := detailValue(t, registry)
+			assert.Nil(t, err)
+			pingRequest, ok := value.(*pingv1.PingRequest)
+			assert.True(t, ok)
+			assert.Equal(t, pingRequest.Text, "detail")
+			_, err = detailValue(t, new(protoregistry.Types))
+			assert.ErrorIs(t, err, protoregistry.NotFound)
+		})
+	}
+}
+
+func TestClientLoadReportObserver(t *testing.T) {
+	t.Parallel()
+	const procedure = "/" + pingv1connect.PingServiceName + "/Ping"
+	report := &connect.LoadReport{
+		CPUUtilization: 0.5,
+		RPSFractional:  120,
+		Utilization:    map[string]float64{"queue": 0.25},
+		NamedMetrics:   map[string]float64{"sessions": 12},
+	}
+	mux := http.NewServeMux()
+	mux.Handle(procedure, connect.NewUnaryHandler(
+		procedure,
+		func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			if request.Msg.Number < 0 {
+				err := connect.NewError(connect.CodeUnavailable, errors.New("overloaded"))
+				connect.SetLoadReport(err.Meta(), report)
+				return nil, err
+			}
+			response := connect.NewResponse(&pingv1.PingResponse{Number: request.Msg.Number})
+			connect.SetLoadReport(response.Trailer(), report)
+			return response, nil
+		},
+	))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	for _, protocol := range []struct {
+		name string
+		opt  connect.ClientOption
+	}{
+		{name: "connect", opt: connect.WithConnect()},
+		{name: "grpc", opt: connect.WithGRPC()},
+		{name: "grpcweb", opt: connect.WithGRPCWeb()},
+	} {
+		protocol := protocol
+		t.Run(protocol.name, func(t *testing.T) {
+			t.Parallel()
+			var observed []*connect.LoadReport
+			client := pingv1connect.NewPingServiceClient(
+				server.Client(),
+				server.URL,
+				protocol.opt,
+				connect.WithLoadReportObserver(func(_ context.Context, spec connect.Spec, report *connect.LoadReport) {
+					assert.Equal(t, spec.Procedure, procedure)
+					observed = append(observed, report)
+				}),
+			)
+			_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 1}))
+			assert.Nil(t, err)
+			_, err = client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: -1}))
+			assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+			assert.Equal(t, observed, []*connect.LoadReport{report, report})
+		})
+	}
+}
+
+func TestCancelGracePeriod(t *testing.T) {
+	t.Parallel()
+	const cumSumProcedure = "/" + pingv1connect.PingServiceName + "/CumSum"
+	mux := http.NewServeMux()
+	mux.Handle(cumSumProcedure, connect.NewBidiStreamHandler(
+		cumSumProcedure,
+		func(ctx context.Context, stream *connect.BidiStream[pingv1.CumSumRequest, pingv1.CumSumResponse]) error {
+			var sum int64
+			for {
+				msg, err := stream.Receive()
+				if errors.Is(err, io.EOF) {
+					// The client stopped sending, so flush a final trailer.
+					stream.ResponseTrailer().Set("Drained", "true")
+					return nil
+				} else if err != nil {
+					return err
+				}
+				sum += msg.Number
+				if err := stream.Send(&pingv1.CumSumResponse{Sum: sum}); err != nil {
+					return err
+				}
+			}
+		},
+	))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	run := func(t *testing.T, opts ...connect.ClientOption) (*connect.BidiStreamForClient[pingv1.CumSumRequest, pingv1.CumSumResponse], error) {
+		t.Helper()
+		client := connect.NewClient[pingv1.CumSumRequest, pingv1.CumSumResponse](
+			server.Client(),
+			server.URL+cumSumProcedure,
+			opts...,
+		)
+		ctx, cancel := context.WithCancel(context.Background())
+		stream := client.CallBidiStream(ctx)
+		assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: 1}))
+		msg, err := stream.Receive()
+		assert.Nil(t, err)
+		assert.Equal(t, msg.Sum, 1)
+		cancel()
+		_, err = stream.Receive()
+		return stream, err
+	}
+	for _, testCase := range []struct {
+		name string
+		opt  connect.ClientOption
+	}{
+		{name: "connect", opt: connect.WithConnect()},
+		{name: "grpc", opt: connect.WithGRPC()},
+		{name: "grpcweb", opt: connect.WithGRPCWeb()},
+	} {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			stream, err := run(t, testCase.opt)
+			assert.Equal(t, connect.CodeOf(err), connect.CodeCanceled)
+			_ = stream.CloseResponse()
+
+			stream, err = run(t, testCase.opt, connect.WithCancelGracePeriod(time.Second))
+			assert.ErrorIs(t, err, io.EOF)
+			assert.Equal(t, stream.ResponseTrailer().Get("Drained"), "true")
+			assert.Nil(t, stream.CloseResponse())
+		})
+	}
+}
+
+func TestUnaryResponseLimitBehavior(t *testing.T) {
+	t.Parallel()
+	const readMaxBytes = 16
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	request := &pingv1.PingRequest{Text: strings.Repeat("a", 256)}
+
+	protocols := []struct {
+		name string
+		opt  connect.ClientOption
+	}{
+		{"connect", connect.WithConnect()},
+		{"grpc", connect.WithGRPC()},
+		{"grpcweb", connect.WithGRPCWeb()},
+	}
+	for _, protocol := range protocols {
+		protocol := protocol
+		t.Run(protocol.name, func(t *testing.T) {
+			t.Parallel()
+			call := func(t *testing.T, options ...connect.ClientOption) *connect.MessageTooLargeError {
+				t.Helper()
+				options = append(options, protocol.opt, connect.WithReadMaxBytes(readMaxBytes))
+				client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, options...)
+				_, err := client.Ping(context.Background(), connect.NewRequest(request))
+				assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+				var tooLarge *connect.MessageTooLargeError
+				assert.True(t, errors.As(err, &tooLarge))
+				assert.True(t, tooLarge.Size > readMaxBytes)
+				assert.Equal(t, tooLarge.Max, int64(readMaxBytes))
+				return tooLarge
+			}
+			t.Run("discard", func(t *testing.T) {
+				t.Parallel()
+				tooLarge := call(t)
+				assert.Zero(t, len(tooLarge.Prefix))
+			})
+			t.Run("retain_prefix", func(t *testing.T) {
+				t.Parallel()
+				tooLarge := call(t, connect.WithUnaryResponseLimitBehavior(connect.ResponseLimitRetainPrefix))
+				assert.Equal(t, len(tooLarge.Prefix), readMaxBytes)
+			})
+		})
+	}
+}
+
+func TestClientAWSSigV4(t *testing.T) {
+	t.Parallel()
+	var authorization atomic.Value
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization.Store(r.Header.Get("Authorization"))
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	credentials := func(context.Context) (connect.AWSCredentials, error) {
+		return connect.AWSCredentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}, nil
+	}
+
+	client := pingv1connect.NewPingServiceClient(
+		server.Client(),
+		server.URL,
+		connect.WithAWSSigV4(credentials, "execute-api", "us-east-1"),
+	)
+	_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 1}))
+	assert.Nil(t, err)
+	header, _ := authorization.Load().(string)
+	assert.True(t, strings.HasPrefix(header, "AWS4-HMAC-SHA256 Credential=AKID/"))
+	assert.True(t, strings.Contains(header, "SignedHeaders=content-type;host;x-amz-date,"))
+
+	grpcClient := pingv1connect.NewPingServiceClient(
+		server.Client(),
+		server.URL,
+		connect.WithGRPC(),
+		connect.WithAWSSigV4(credentials, "execute-api", "us-east-1"),
+	)
+	_, err = grpcClient.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+	assert.Equal(t, connect.CodeOf(err), connect.CodeUnknown)
+}
+
+func TestClientCodedErrors(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	errInterceptor := errors.New("interceptor failed")
+	client := pingv1connect.NewPingServiceClient(
+		server.Client(),
+		server.URL,
+		connect.WithCodedErrors(),
+		connect.WithInterceptors(&failingClientInterceptor{err: errInterceptor}),
+	)
+	assertCode := func(t *testing.T, err error, code connect.Code) {
+		t.Helper()
+		connectErr, ok := err.(*connect.Error) //nolint:errorlint
+		assert.True(t, ok, assert.Sprintf("got %T", err))
+		assert.Equal(t, connectErr.Code(), code)
+	}
+	t.Run("unary", func(t *testing.T) {
+		t.Parallel()
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Text: "plain"}))
+		assertCode(t, err, connect.CodeUnknown)
+		assert.True(t, errors.Is(err, errInterceptor))
+		_, err = client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Text: "wrapped"}))
+		assertCode(t, err, connect.CodeAborted)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = client.Ping(ctx, connect.NewRequest(&pingv1.PingRequest{Text: "context"}))
+		assertCode(t, err, connect.CodeCanceled)
+		_, err = client.Fail(context.Background(), connect.NewRequest(&pingv1.FailRequest{Code: int32(connect.CodeNotFound)}))
+		assertCode(t, err, connect.CodeNotFound)
+	})
+	t.Run("bidi", func(t *testing.T) {
+		t.Parallel()
+		stream := client.CumSum(context.Background())
+		assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: 1}))
+		assert.Nil(t, stream.CloseRequest())
+		response, err := stream.Receive()
+		assert.Nil(t, err)
+		assert.Equal(t, response.Sum, int64(1))
+		_, err = stream.Receive()
+		assert.True(t, errors.Is(err, io.EOF))
+		err = stream.CloseResponse()
+		assertCode(t, err, connect.CodeUnknown)
+		assert.True(t, errors.Is(err, errInterceptor))
+	})
+	t.Run("bidi_metadata", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		stream := client.CumSum(ctx)
+		conn, err := stream.Conn()
+		assert.Nil(t, err)
+		err = connect.SendWithMetadata(conn, &pingv1.CumSumRequest{Number: 1}, http.Header{"Foo": []string{"bar"}})
+		assertCode(t, err, connect.CodeCanceled)
+		err = connect.SendWithEnvelopeFlags(conn, &pingv1.CumSumRequest{Number: 1})
+		assertCode(t, err, connect.CodeCanceled)
+		_, err = connect.ReceiveWithMetadata(conn, &pingv1.CumSumResponse{})
+		assertCode(t, err, connect.CodeCanceled)
+		_, err = connect.ReceiveWithEnvelopeFlags(conn, &pingv1.CumSumResponse{})
+		assertCode(t, err, connect.CodeCanceled)
+		_ = stream.CloseResponse()
+	})
+}
+
+// failingClientInterceptor returns errors without codes, which clients
+// configured with WithCodedErrors must wrap.
+type failingClientInterceptor struct {
+	err error
+}
+
+func (f *failingClientInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, request connect.AnyRequest) (connect.AnyResponse, error) {
+		ping, ok := request.Any().(*pingv1.PingRequest)
+		if !ok {
+			return next(ctx, request)
+		}
+		switch ping.Text {
+		case "plain":
+			return nil, f.err
+		case "wrapped":
+			return nil, fmt.Errorf("retry budget: %w", connect.NewError(connect.CodeAborted, f.err))
+		case "context":
+			return nil, ctx.Err()
+		}
+		return next(ctx, request)
+	}
+}
+
+func (f *failingClientInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return func(ctx context.Context, spec connect.Spec) connect.StreamingClientConn {
+		return &failingCloseClientConn{StreamingClientConn: next(ctx, spec), err: f.err}
+	}
+}
+
+func (f *failingClientInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return next
+}
+
+type failingCloseClientConn struct {
+	connect.StreamingClientConn
+
+	err error
+}
+
+func (c *failingCloseClientConn) CloseResponse() error {
+	_ = c.StreamingClientConn.CloseResponse()
+	return c.err
+}
+
+func TestClientMaxConcurrentCalls(t *testing.T) {
+	t.Parallel()
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		pingServer{},
+		connect.WithInterceptors(connect.UnaryInterceptorFunc(func(next connect.UnaryFunc) connect.UnaryFunc {
+			return func(ctx context.Context, request connect.AnyRequest) (connect.AnyResponse, error) {
+				if ping, ok := request.Any().(*pingv1.PingRequest); ok && ping.Text == "block" {
+					started <- struct{}{}
+					<-unblock
+				}
+				return next(ctx, request)
+			}
+		})),
+	))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	ping := func(client pingv1connect.PingServiceClient, text string) error {
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Text: text}))
+		return err
+	}
+	// block starts a call that holds the client's only slot until the
+	// returned function is called.
+	block := func(t *testing.T, client pingv1connect.PingServiceClient) func() {
+		t.Helper()
+		done := make(chan error, 1)
+		go func() { done <- ping(client, "block") }()
+		<-started
+		return func() {
+			unblock <- struct{}{}
+			assert.Nil(t, <-done)
+		}
+	}
+
+	t.Run("reject", func(t *testing.T) {
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithMaxConcurrentCalls(1, connect.QueuePolicy{}))
+		finish := block(t, client)
+		assert.Equal(t, connect.CodeOf(ping(client, "rejected")), connect.CodeResourceExhausted)
+		// The limit spans all of the service's procedures.
+		_, err := client.Sum(context.Background()).CloseAndReceive()
+		assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+		finish()
+		assert.Nil(t, ping(client, "admitted"))
+	})
+	t.Run("queue_timeout", func(t *testing.T) {
+		client := pingv1connect.NewPingServiceClient(
+			server.Client(),
+			server.URL,
+			connect.WithMaxConcurrentCalls(1, connect.QueuePolicy{MaxQueued: -1, Timeout: 10 * time.Millisecond}),
+		)
+		finish := block(t, client)
+		assert.Equal(t, connect.CodeOf(ping(client, "timed out")), connect.CodeResourceExhausted)
+		finish()
+	})
+	t.Run("queue", func(t *testing.T) {
+		client := pingv1connect.NewPingServiceClient(
+			server.Client(),
+			server.URL,
+			connect.WithMaxConcurrentCalls(1, connect.QueuePolicy{MaxQueued: 1}),
+		)
+		finish := block(t, client)
+		queued := make(chan error, 1)
+		go func() { queued <- ping(client, "queued") }()
+		select {
+		case err := <-queued:
+			t.Fatalf("queued call finished early: %v", err)
+		case <-time.After(10 * time.Millisecond):
+		}
+		finish()
+		assert.Nil(t, <-queued)
+	})
+	t.Run("stream", func(t *testing.T) {
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithMaxConcurrentCalls(1, connect.QueuePolicy{}))
+		stream := client.CumSum(context.Background())
+		assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: 1}))
+		assert.Equal(t, connect.CodeOf(ping(client, "rejected")), connect.CodeResourceExhausted)
+		assert.Nil(t, stream.CloseRequest())
+		assert.Nil(t, stream.CloseResponse())
+		assert.Nil(t, ping(client, "admitted"))
+	})
+}
+
+func TestClientSingleFlight(t *testing.T) {
+	t.Parallel()
+	var calls int64
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		pingServer{},
+		connect.WithInterceptors(connect.UnaryInterceptorFunc(func(next connect.UnaryFunc) connect.UnaryFunc {
+			return func(ctx context.Context, request connect.AnyRequest) (connect.AnyResponse, error) {
+				if atomic.AddInt64(&calls, 1) == 1 {
+					close(started)
+					<-unblock
+				}
+				return next(ctx, request)
+			}
+		})),
+	))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	client := pingv1connect.NewPingServiceClient(
+		server.Client(),
+		server.URL,
+		connect.WithSingleFlight(),
+		connect.WithCallIDs(nil),
+		connect.WithCallIDHeader("Call-Id"),
+	)
+	var traces int64
+	ping := func(header string) (*connect.Response[pingv1.PingResponse], error) {
+		request := connect.NewRequest(&pingv1.PingRequest{Number: 42, Text: "stampede"})
+		request.Header().Set("Tenant", header)
+		// Each call has its own call ID and span, which don't prevent
+		// coalescing.
+		trace := connect.TraceContext{TraceID: [16]byte{1}, SpanID: [8]byte{byte(atomic.AddInt64(&traces, 1))}}
+		request.Header().Set("Traceparent", trace.TraceParent())
+		return client.Ping(context.Background(), request)
+	}
+
+	const callers = 5
+	responses := make(chan *connect.Response[pingv1.PingResponse], callers)
+	call := func() {
+		response, err := ping("a")
+		assert.Nil(t, err)
+		responses <- response
+	}
+	go call()
+	<-started
+	for i := 1; i < callers; i++ {
+		go call()
+	}
+	// Calls with different headers aren't coalesced.
+	_, err := ping("b")
+	assert.Nil(t, err)
+	assert.Equal(t, atomic.LoadInt64(&calls), 2)
+	// Give the remaining callers time to join the in-flight call.
+	time.Sleep(50 * time.Millisecond)
+	close(unblock)
+	seen := make(map[*pingv1.PingResponse]struct{})
+	for i := 0; i < callers; i++ {
+		response := <-responses
+		assert.Equal(t, response.Msg.Number, 42)
+		assert.Equal(t, response.Header().Values(handlerHeader), []string{headerValue})
+		seen[response.Msg] = struct{}{}
+	}
+	// Everyone gets their own copy of the response.
+	assert.Equal(t, len(seen), callers)
+	assert.Equal(t, atomic.LoadInt64(&calls), 2)
+}
+
+func TestClientProgress(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	text := strings.Repeat("progress ", 10_000)
+	for _, protocol := range []string{connect.ProtocolConnect, connect.ProtocolGRPC} {
+		protocol := protocol
+		t.Run(protocol, func(t *testing.T) {
+			t.Parallel()
+			var requests, responses []connect.Progress
+			options := []connect.ClientOption{connect.WithProgress(func(progress connect.Progress) {
+				if progress.Response {
+					responses = append(responses, progress)
+				} else {
+					requests = append(requests, progress)
+				}
+			})}
+			if protocol == connect.ProtocolGRPC {
+				options = append(options, connect.WithGRPC())
+			}
+			client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, options...)
+			response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Text: text}))
+			assert.Nil(t, err)
+			assert.Equal(t, response.Msg.Text, text)
+
+			// The request is reported in chunks, ending with the full body.
+			assert.True(t, len(requests) > 1, assert.Sprintf("got %d request reports", len(requests)))
+			last := requests[len(requests)-1]
+			assert.True(t, last.Total > int64(len(text)))
+			assert.Equal(t, last.Bytes, last.Total)
+			assert.Equal(t, last.Spec.Procedure, "/"+pingv1connect.PingServiceName+"/Ping")
+			for i := 1; i < len(requests); i++ {
+				assert.True(t, requests[i].Bytes > requests[i-1].Bytes)
+			}
+
+			assert.True(t, len(responses) > 0)
+			last = responses[len(responses)-1]
+			if protocol == connect.ProtocolConnect {
+				assert.Equal(t, last.Bytes, last.Total)
+			} else {
+				assert.Equal(t, last.Total, int64(-1))
+				assert.True(t, last.Bytes > 0)
+			}
+		})
+	}
+
+	// Streaming calls aren't reported.
+	var reports int
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithProgress(func(connect.Progress) {
+		reports++
+	}))
+	stream := client.CumSum(context.Background())
+	assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: 1}))
+	_, err := stream.Receive()
+	assert.Nil(t, err)
+	assert.Nil(t, stream.CloseRequest())
+	assert.Nil(t, stream.CloseResponse())
+	assert.Zero(t, reports)
+}
+
+func TestClientDefaultCallTimeout(t *testing.T) {
+	t.Parallel()
+	const (
+		pingProcedure   = "/" + pingv1connect.PingServiceName + "/Ping"
+		cumSumProcedure = "/" + pingv1connect.PingServiceName + "/CumSum"
+		defaultTimeout  = time.Minute
+	)
+	mux := http.NewServeMux()
+	mux.Handle(pingProcedure, connect.NewUnaryHandler(
+		pingProcedure,
+		func(ctx context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			response := connect.NewResponse(&pingv1.PingResponse{})
+			if remaining, ok := connect.RemainingBudget(ctx); ok {
+				response.Header().Set("Remaining", remaining.String())
+			}
+			return response, nil
+		},
+	))
+	mux.Handle(cumSumProcedure, connect.NewBidiStreamHandler(
+		cumSumProcedure,
+		func(ctx context.Context, stream *connect.BidiStream[pingv1.CumSumRequest, pingv1.CumSumResponse]) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	remaining := func(t *testing.T, response *connect.Response[pingv1.PingResponse]) time.Duration {
+		t.Helper()
+		value := response.Header().Get("Remaining")
+		assert.NotZero(t, value)
+		remaining, err := time.ParseDuration(value)
+		assert.Nil(t, err)
+		return remaining
+	}
+	client := connect.NewClient[pingv1.PingRequest, pingv1.PingResponse](
+		server.Client(),
+		server.URL+pingProcedure,
+		connect.WithDefaultCallTimeout(defaultTimeout),
+	)
+	t.Run("default", func(t *testing.T) {
+		t.Parallel()
+		response, err := client.CallUnary(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Nil(t, err)
+		got := remaining(t, response)
+		assert.True(t, got > 0 && got <= defaultTimeout, assert.Sprintf("remaining %v", got))
+	})
+	t.Run("caller_deadline", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+		defer cancel()
+		response, err := client.CallUnary(ctx, connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Nil(t, err)
+		got := remaining(t, response)
+		assert.True(t, got > defaultTimeout, assert.Sprintf("remaining %v", got))
+	})
+	t.Run("no_default", func(t *testing.T) {
+		t.Parallel()
+		client := connect.NewClient[pingv1.PingRequest, pingv1.PingResponse](
+			server.Client(),
+			server.URL+pingProcedure,
+		)
+		response, err := client.CallUnary(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Nil(t, err)
+		assert.Zero(t, response.Header().Get("Remaining"))
+	})
+	t.Run("stream", func(t *testing.T) {
+		t.Parallel()
+		client := connect.NewClient[pingv1.CumSumRequest, pingv1.CumSumResponse](
+			server.Client(),
+			server.URL+cumSumProcedure,
+			connect.WithDefaultCallTimeout(100*time.Millisecond),
+		)
+		stream := client.CallBidiStream(context.Background())
+		assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: 1}))
+		_, err := stream.Receive()
+		assert.Equal(t, connect.CodeOf(err), connect.CodeDeadlineExceeded)
+		assert.Nil(t, stream.CloseRequest())
+		assert.Nil(t, stream.CloseResponse())
+	})
+}
@@ -18,6 +18,7 @@ import (
 	"errors"
 	"io"
 	"net/http"
+	"time"
 )
 
 // ClientStreamForClient is the client's view of a client streaming RPC.
@@ -97,6 +98,10 @@ type ServerStreamForClient[Res any] struct {
 	constructErr error
 	// Error from conn.Receive().
 	receiveErr error
+	// If non-nil, reopens the stream after a draining server closes it.
+	reconnect     func(delay time.Duration) (StreamingClientConn, error)
+	maxReconnects int
+	reconnects    int // consecutive reconnects without receiving a message
 }
 
 // Receive advances the stream to the next message, which will then be
@@ -110,6 +115,24 @@ func (s *ServerStreamForClient[Res]) Receive() bool {
 	}
 	s.msg = new(Res)
 	s.receiveErr = s.conn.Receive(s.msg)
+	for s.receiveErr != nil && s.reconnect != nil && s.reconnects < s.maxReconnects {
+		delay, ok := drainReconnectDelay(s.receiveErr)
+		if !ok {
+			break
+		}
+		s.reconnects++
+		_ = s.conn.CloseResponse()
+		conn, err := s.reconnect(delay)
+		if err != nil {
+			s.receiveErr = err
+			return false
+		}
+		s.conn = conn
+		s.receiveErr = s.conn.Receive(s.msg)
+	}
+	if s.receiveErr == nil {
+		s.reconnects = 0
+	}
 	return s.receiveErr == nil
 }
 
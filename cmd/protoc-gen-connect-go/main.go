@@ -51,6 +51,7 @@ import (
 
 	"github.com/bufbuild/connect-go"
 	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/types/descriptorpb"
 	"google.golang.org/protobuf/types/pluginpb"
 )
@@ -138,7 +139,7 @@ func generatePreamble(g *protogen.GeneratedFile, file *protogen.File) {
 		"is not defined, this code was generated with a version of connect newer than the one ",
 		"compiled into your binary. You can fix the problem by either regenerating this code ",
 		"with an older version of connect or updating the connect version compiled into your binary.")
-	g.P("const _ = ", connectPackage.Ident("IsAtLeastVersion0_1_0"))
+	g.P("const _ = ", connectPackage.Ident("IsAtLeastVersion1_2_0"))
 	g.P()
 }
 
@@ -160,6 +161,7 @@ func generateService(g *protogen.GeneratedFile, service *protogen.Service) {
 	generateClientImplementation(g, service, names)
 	generateServerInterface(g, service, names)
 	generateServerConstructor(g, service, names)
+	generateServiceConstructor(g, service, names)
 	generateUnimplementedServerImplementation(g, service, names)
 }
 
@@ -212,7 +214,7 @@ func generateClientImplementation(g *protogen.GeneratedFile, service *protogen.S
 		)
 		g.P("httpClient,")
 		g.P(`baseURL + "`, procedureName(method), `",`)
-		g.P("opts...,")
+		g.P(append(constructorOptions(method, "WithClientOptions"), ",")...)
 		g.P("),")
 	}
 	g.P("}")
@@ -324,21 +326,10 @@ func generateServerConstructor(g *protogen.GeneratedFile, service *protogen.Serv
 		") (string, ", httpPackage.Ident("Handler"), ") {")
 	g.P("mux := ", httpPackage.Ident("NewServeMux"), "()")
 	for _, method := range service.Methods {
-		isStreamingServer := method.Desc.IsStreamingServer()
-		isStreamingClient := method.Desc.IsStreamingClient()
-		switch {
-		case isStreamingClient && !isStreamingServer:
-			g.P(`mux.Handle("`, procedureName(method), `", `, connectPackage.Ident("NewClientStreamHandler"), "(")
-		case !isStreamingClient && isStreamingServer:
-			g.P(`mux.Handle("`, procedureName(method), `", `, connectPackage.Ident("NewServerStreamHandler"), "(")
-		case isStreamingClient && isStreamingServer:
-			g.P(`mux.Handle("`, procedureName(method), `", `, connectPackage.Ident("NewBidiStreamHandler"), "(")
-		default:
-			g.P(`mux.Handle("`, procedureName(method), `", `, connectPackage.Ident("NewUnaryHandler"), "(")
-		}
+		g.P(`mux.Handle("`, procedureName(method), `", `, handlerConstructor(method), "(")
 		g.P(`"`, procedureName(method), `",`)
 		g.P("svc.", method.GoName, ",")
-		g.P("opts...,")
+		g.P(append(constructorOptions(method, "WithHandlerOptions"), ",")...)
 		g.P("))")
 	}
 	g.P(`return "/`, reflectionName(service), `/", mux`)
@@ -346,6 +337,49 @@ func generateServerConstructor(g *protogen.GeneratedFile, service *protogen.Serv
 	g.P()
 }
 
+func generateServiceConstructor(g *protogen.GeneratedFile, service *protogen.Service, names names) {
+	wrapComments(g, names.ServiceConstructor, " describes the ", service.Desc.FullName(),
+		" service and its procedures, for use with connect.Register.")
+	if isDeprecatedService(service) {
+		g.P("//")
+		deprecated(g)
+	}
+	handlerOption := connectPackage.Ident("HandlerOption")
+	g.P("func ", names.ServiceConstructor, "(svc ", names.Server, ") ", connectPackage.Ident("Service"), " {")
+	g.P("return ", connectPackage.Ident("NewService"), "(")
+	g.P(fmt.Sprintf("%sName", service.Desc.Name()), ",")
+	for _, method := range service.Methods {
+		g.P(connectPackage.Ident("ServiceProcedure"), "{")
+		g.P(`Procedure: "`, procedureName(method), `",`)
+		g.P("NewHandler: func(opts ...", handlerOption, ") *", connectPackage.Ident("Handler"), " {")
+		args := []any{"return ", handlerConstructor(method), `("`, procedureName(method), `", svc.`, method.GoName, ", "}
+		args = append(args, constructorOptions(method, "WithHandlerOptions")...)
+		g.P(append(args, ")")...)
+		g.P("},")
+		g.P("},")
+	}
+	g.P(")")
+	g.P("}")
+	g.P()
+}
+
+// handlerConstructor returns the connect function that constructs a Handler
+// for the method.
+func handlerConstructor(method *protogen.Method) protogen.GoIdent {
+	isStreamingServer := method.Desc.IsStreamingServer()
+	isStreamingClient := method.Desc.IsStreamingClient()
+	switch {
+	case isStreamingClient && !isStreamingServer:
+		return connectPackage.Ident("NewClientStreamHandler")
+	case !isStreamingClient && isStreamingServer:
+		return connectPackage.Ident("NewServerStreamHandler")
+	case isStreamingClient && isStreamingServer:
+		return connectPackage.Ident("NewBidiStreamHandler")
+	default:
+		return connectPackage.Ident("NewUnaryHandler")
+	}
+}
+
 func generateUnimplementedServerImplementation(g *protogen.GeneratedFile, service *protogen.Service, names names) {
 	wrapComments(g, names.UnimplementedServer, " returns CodeUnimplemented from all methods.")
 	g.P("type ", names.UnimplementedServer, " struct {}")
@@ -422,6 +456,29 @@ func reflectionName(service *protogen.Service) string {
 	return fmt.Sprintf("%s.%s", service.Desc.ParentFile().Package(), service.Desc.Name())
 }
 
+// constructorOptions returns the options argument for a method's client or
+// handler constructor. If the method declares an idempotency level, it's
+// passed first, followed by opts wrapped with the named connect function.
+func constructorOptions(method *protogen.Method, wrap string) []any {
+	methodOptions, ok := method.Desc.Options().(*descriptorpb.MethodOptions)
+	if !ok {
+		return []any{"opts..."}
+	}
+	var level string
+	switch methodOptions.GetIdempotencyLevel() {
+	case descriptorpb.MethodOptions_NO_SIDE_EFFECTS:
+		level = "IdempotencyNoSideEffects"
+	case descriptorpb.MethodOptions_IDEMPOTENT:
+		level = "IdempotencyIdempotent"
+	default:
+		return []any{"opts..."}
+	}
+	return []any{
+		connectPackage.Ident("WithIdempotency"), "(", connectPackage.Ident(level), "), ",
+		connectPackage.Ident(wrap), "(opts...)",
+	}
+}
+
 func isDeprecatedService(service *protogen.Service) bool {
 	serviceOptions, ok := service.Desc.Options().(*descriptorpb.ServiceOptions)
 	return ok && serviceOptions.GetDeprecated()
@@ -505,9 +562,28 @@ type names struct {
 	ClientExposeMethod  string
 	Server              string
 	ServerConstructor   string
+	ServiceConstructor  string
 	UnimplementedServer string
 }
 
+// serviceConstructorName names the function describing a service for
+// connect.Register. Most service names already end in "Service", which isn't
+// repeated: PingService gets NewPingService, and Health gets
+// NewHealthService. If that would collide with the constructor of another
+// service in the same file, the suffix is kept.
+func serviceConstructorName(service *protogen.Service) string {
+	base := service.GoName
+	trimmed := strings.TrimSuffix(base, "Service")
+	if trimmed == base || trimmed == "" {
+		return fmt.Sprintf("New%sService", base)
+	}
+	services := service.Desc.ParentFile().Services()
+	if services.ByName(protoreflect.Name(trimmed)) != nil {
+		return fmt.Sprintf("New%sService", base)
+	}
+	return fmt.Sprintf("New%sService", trimmed)
+}
+
 func newNames(service *protogen.Service) names {
 	base := service.GoName
 	return names{
@@ -517,6 +593,7 @@ func newNames(service *protogen.Service) names {
 		ClientImpl:          fmt.Sprintf("%sClient", unexport(base)),
 		Server:              fmt.Sprintf("%sHandler", base),
 		ServerConstructor:   fmt.Sprintf("New%sHandler", base),
+		ServiceConstructor:  serviceConstructorName(service),
 		UnimplementedServer: fmt.Sprintf("Unimplemented%sHandler", base),
 	}
 }
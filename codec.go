@@ -15,10 +15,13 @@
 package connect
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoregistry"
 )
 
 const (
@@ -27,6 +30,14 @@ const (
 	codecNameJSONCharsetUTF8 = codecNameJSON + "; charset=utf-8"
 )
 
+// A TypeResolver looks up Protobuf message and extension types, typically by
+// name or by the URLs used in google.protobuf.Any. A [*protoregistry.Types]
+// is a TypeResolver.
+type TypeResolver interface {
+	protoregistry.MessageTypeResolver
+	protoregistry.ExtensionTypeResolver
+}
+
 // Codec marshals structs (typically generated from a schema) to and from bytes.
 type Codec interface {
 	// Name returns the name of the Codec.
@@ -49,9 +60,11 @@ type Codec interface {
 	Unmarshal([]byte, any) error
 }
 
-type protoBinaryCodec struct{}
+type protoBinaryCodec struct {
+	unmarshal proto.UnmarshalOptions
+}
 
-var _ Codec = (*protoBinaryCodec)(nil)
+var _ StableCodec = (*protoBinaryCodec)(nil)
 
 func (c *protoBinaryCodec) Name() string { return codecNameProto }
 
@@ -63,19 +76,30 @@ func (c *protoBinaryCodec) Marshal(message any) ([]byte, error) {
 	return proto.Marshal(protoMessage)
 }
 
+func (c *protoBinaryCodec) MarshalStable(message any) ([]byte, error) {
+	protoMessage, ok := message.(proto.Message)
+	if !ok {
+		return nil, errNotProto(message)
+	}
+	return proto.MarshalOptions{Deterministic: true}.Marshal(protoMessage)
+}
+
 func (c *protoBinaryCodec) Unmarshal(data []byte, message any) error {
 	protoMessage, ok := message.(proto.Message)
 	if !ok {
 		return errNotProto(message)
 	}
-	return proto.Unmarshal(data, protoMessage)
+	return c.unmarshal.Unmarshal(data, protoMessage)
 }
 
 type protoJSONCodec struct {
-	name string
+	name      string
+	marshal   protojson.MarshalOptions
+	unmarshal protojson.UnmarshalOptions
+	merge     bool // merge into the message rather than replacing it
 }
 
-var _ Codec = (*protoJSONCodec)(nil)
+var _ StableCodec = (*protoJSONCodec)(nil)
 
 func (c *protoJSONCodec) Name() string { return c.name }
 
@@ -84,8 +108,21 @@ func (c *protoJSONCodec) Marshal(message any) ([]byte, error) {
 	if !ok {
 		return nil, errNotProto(message)
 	}
-	var options protojson.MarshalOptions
-	return options.Marshal(protoMessage)
+	return c.marshal.Marshal(protoMessage)
+}
+
+func (c *protoJSONCodec) MarshalStable(message any) ([]byte, error) {
+	// protojson orders fields consistently, but deliberately randomizes
+	// whitespace. Compacting the output removes the variation.
+	data, err := c.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, data); err != nil {
+		return nil, err
+	}
+	return compacted.Bytes(), nil
 }
 
 func (c *protoJSONCodec) Unmarshal(binary []byte, message any) error {
@@ -93,8 +130,17 @@ func (c *protoJSONCodec) Unmarshal(binary []byte, message any) error {
 	if !ok {
 		return errNotProto(message)
 	}
-	var options protojson.UnmarshalOptions
-	return options.Unmarshal(binary, protoMessage)
+	if !c.merge {
+		return c.unmarshal.Unmarshal(binary, protoMessage)
+	}
+	// protojson always resets the message, so unmarshal into a fresh one and
+	// merge the result.
+	fresh := protoMessage.ProtoReflect().New().Interface()
+	if err := c.unmarshal.Unmarshal(binary, fresh); err != nil {
+		return err
+	}
+	proto.Merge(protoMessage, fresh)
+	return nil
 }
 
 // readOnlyCodecs is a read-only interface to a map of named codecs.
@@ -142,6 +188,48 @@ func (m *codecMap) Names() []string {
 	return names
 }
 
+// configureProtoCodec returns a copy of the built-in Protobuf codecs
+// configured with the supplied unmarshaling options and type resolver. A
+// Resolver set in the options takes precedence. If merge is true, the codecs
+// merge into messages instead of resetting them, which preserves the fields
+// set by an initializer. Other codecs are returned unchanged.
+func configureProtoCodec(codec Codec, options *proto.UnmarshalOptions, resolver TypeResolver, merge bool) Codec {
+	if options == nil && resolver == nil && !merge {
+		return codec
+	}
+	var unmarshal proto.UnmarshalOptions
+	if options != nil {
+		unmarshal = *options
+	}
+	if unmarshal.Resolver == nil && resolver != nil {
+		unmarshal.Resolver = resolver
+	}
+	if merge {
+		unmarshal.Merge = true
+	}
+	switch typed := codec.(type) {
+	case *protoBinaryCodec:
+		return &protoBinaryCodec{unmarshal: unmarshal}
+	case *protoJSONCodec:
+		configured := &protoJSONCodec{
+			name: typed.name,
+			unmarshal: protojson.UnmarshalOptions{
+				AllowPartial:   unmarshal.AllowPartial,
+				DiscardUnknown: unmarshal.DiscardUnknown,
+			},
+			merge: unmarshal.Merge,
+		}
+		// JSON also needs to resolve the message types packed into Any fields.
+		if jsonResolver, ok := unmarshal.Resolver.(TypeResolver); ok {
+			configured.marshal.Resolver = jsonResolver
+			configured.unmarshal.Resolver = jsonResolver
+		}
+		return configured
+	default:
+		return codec
+	}
+}
+
 func errNotProto(message any) error {
 	return fmt.Errorf("%T doesn't implement proto.Message", message)
 }
@@ -16,6 +16,7 @@ package connect
 
 import (
 	"bytes"
+	"compress/gzip"
 	"errors"
 	"io"
 	"math"
@@ -26,6 +27,8 @@ import (
 const (
 	compressionGzip     = "gzip"
 	compressionIdentity = "identity"
+	// gzipMagic begins every gzip stream, per RFC 1952.
+	gzipMagic = "\x1f\x8b"
 )
 
 // A Decompressor is a reusable wrapper that decompresses an underlying data
@@ -56,6 +59,60 @@ type Compressor interface {
 	Reset(io.Writer)
 }
 
+// httpGzipCompressionPool decompresses responses gzipped at the HTTP layer (for
+// example, by a proxy) when the client hasn't registered gzip itself.
+var httpGzipCompressionPool = newCompressionPool(
+	func() Decompressor { return &gzip.Reader{} },
+	func() Compressor { return gzip.NewWriter(io.Discard) },
+)
+
+// normalizeContentCoding canonicalizes an HTTP Content-Encoding value. Content
+// codings are case-insensitive, and RFC 9110 requires recipients to treat
+// "x-gzip" as equivalent to "gzip".
+// A CompressionPolicy decides whether to compress an outbound message, given
+// the RPC's Spec, the name of the codec that marshaled the message, and the
+// message's marshaled size. It's only consulted when compression has been
+// negotiated for the call. See [WithCompressionPolicy].
+type CompressionPolicy func(spec Spec, codec string, size int) bool
+
+// bind returns a function deciding whether to compress messages for a single
+// call, or nil if the policy is nil.
+func (p CompressionPolicy) bind(spec Spec, codec Codec) func(int) bool {
+	if p == nil {
+		return nil
+	}
+	codecName := codec.Name()
+	return func(size int) bool {
+		return p(spec, codecName, size)
+	}
+}
+
+// codecCompressMinBytes returns the compression threshold for codec: the
+// codec-specific minimum if one was configured, and min otherwise.
+func codecCompressMinBytes(min int, perCodec map[string]int, codec Codec) int {
+	if codecMin, ok := perCodec[codec.Name()]; ok {
+		return codecMin
+	}
+	return min
+}
+
+// shouldCompress reports whether a message of the given size should be
+// compressed. The policy, if any, takes precedence over the size threshold.
+func shouldCompress(size, min int, policy func(int) bool) bool {
+	if policy != nil {
+		return policy(size)
+	}
+	return size >= min
+}
+
+func normalizeContentCoding(coding string) string {
+	coding = strings.ToLower(strings.TrimSpace(coding))
+	if coding == "x-gzip" {
+		return compressionGzip
+	}
+	return coding
+}
+
 type compressionPool struct {
 	decompressors sync.Pool
 	compressors   sync.Pool
@@ -95,7 +152,7 @@ func (c *compressionPool) Decompress(dst *bytes.Buffer, src *bytes.Buffer, readM
 		if err != nil {
 			return errorf(CodeResourceExhausted, "message is larger than configured max %d - unable to determine message size: %w", readMaxBytes, err)
 		}
-		return errorf(CodeResourceExhausted, "message size %d is larger than configured max %d", bytesRead+discardedBytes, readMaxBytes)
+		return newMessageTooLargeError(bytesRead+discardedBytes, readMaxBytes, nil)
 	}
 	if err := c.putDecompressor(decompressor); err != nil {
 		return errorf(CodeUnknown, "recycle decompressor: %w", err)
@@ -0,0 +1,129 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"net/http"
+	"strconv"
+)
+
+const (
+	compressionStatsTrailerAlgorithm    = "Compression-Stats-Algorithm"
+	compressionStatsTrailerUncompressed = "Compression-Stats-Uncompressed-Bytes"
+	compressionStatsTrailerCompressed   = "Compression-Stats-Compressed-Bytes"
+)
+
+// CompressionStats describes the effect of compression on the messages a
+// handler sent in a streaming response. Handlers configured with
+// [WithCompressionStatsTrailers] send them as response trailers, and clients
+// can retrieve them with [CompressionStatsFromTrailer].
+type CompressionStats struct {
+	// Algorithm is the name of the compression algorithm used for the
+	// response, or "identity" if the response wasn't compressed.
+	Algorithm string
+	// UncompressedBytes is the total size of the serialized messages, before
+	// compression.
+	UncompressedBytes int64
+	// CompressedBytes is the total size of the messages as sent on the
+	// network, after compression. It doesn't include the framing around each
+	// message.
+	CompressedBytes int64
+}
+
+// CompressionStatsFromTrailer parses the compression statistics from a
+// response's trailers. It reports false if the trailers don't contain valid
+// statistics, usually because the handler wasn't configured to send them.
+func CompressionStatsFromTrailer(trailer http.Header) (CompressionStats, bool) {
+	algorithm := trailer.Get(compressionStatsTrailerAlgorithm)
+	if algorithm == "" {
+		return CompressionStats{}, false
+	}
+	uncompressed, err := strconv.ParseInt(trailer.Get(compressionStatsTrailerUncompressed), 10 /* base */, 64 /* bitsize */)
+	if err != nil {
+		return CompressionStats{}, false
+	}
+	compressed, err := strconv.ParseInt(trailer.Get(compressionStatsTrailerCompressed), 10 /* base */, 64 /* bitsize */)
+	if err != nil {
+		return CompressionStats{}, false
+	}
+	return CompressionStats{
+		Algorithm:         algorithm,
+		UncompressedBytes: uncompressed,
+		CompressedBytes:   compressed,
+	}, true
+}
+
+func (s CompressionStats) writeTrailer(trailer http.Header) {
+	trailer.Set(compressionStatsTrailerAlgorithm, s.Algorithm)
+	trailer.Set(compressionStatsTrailerUncompressed, strconv.FormatInt(s.UncompressedBytes, 10 /* base */))
+	trailer.Set(compressionStatsTrailerCompressed, strconv.FormatInt(s.CompressedBytes, 10 /* base */))
+}
+
+// compressionStatser is implemented by handler conns that may track the
+// compression of the messages they send.
+type compressionStatser interface {
+	compressionStats() (CompressionStats, bool)
+}
+
+func compressionStatsOf(conn StreamingHandlerConn) (CompressionStats, bool) {
+	if statser, ok := conn.(compressionStatser); ok {
+		return statser.compressionStats()
+	}
+	return CompressionStats{}, false
+}
+
+// writeCompressionStats adds the conn's compression statistics (if any) to
+// its response trailers. Call it after the last message has been sent.
+func writeCompressionStats(conn StreamingHandlerConn) {
+	if stats, ok := compressionStatsOf(conn); ok {
+		stats.writeTrailer(conn.ResponseTrailer())
+	}
+}
+
+func (w *envelopeWriter) compressionStats() CompressionStats {
+	stats := CompressionStats{
+		Algorithm:         w.compressionName,
+		UncompressedBytes: w.uncompressedBytes,
+		CompressedBytes:   w.compressedBytes,
+	}
+	if w.compressionPool == nil || stats.Algorithm == "" {
+		stats.Algorithm = compressionIdentity
+	}
+	return stats
+}
+
+func (hc *connectStreamingHandlerConn) compressionStats() (CompressionStats, bool) {
+	return hc.marshaler.compressionStats(), true
+}
+
+func (hc *grpcHandlerConn) compressionStats() (CompressionStats, bool) {
+	return hc.marshaler.compressionStats(), true
+}
+
+func (hc *errorTranslatingHandlerConnCloser) compressionStats() (CompressionStats, bool) {
+	return compressionStatsOf(hc.handlerConnCloser)
+}
+
+func (hc *slowRequestConn) compressionStats() (CompressionStats, bool) {
+	return compressionStatsOf(hc.handlerConnCloser)
+}
+
+func (hc *debugUnaryConn) compressionStats() (CompressionStats, bool) {
+	return compressionStatsOf(hc.handlerConnCloser)
+}
+
+func (hc *deadlineReportConn) compressionStats() (CompressionStats, bool) {
+	return compressionStatsOf(hc.handlerConnCloser)
+}
@@ -15,6 +15,7 @@
 package connect
 
 import (
+	"bytes"
 	"context"
 	"net/http"
 	"net/http/httptest"
@@ -54,3 +55,28 @@ func TestAcceptEncodingOrdering(t *testing.T) {
 	_, _ = client.CallUnary(context.Background(), NewRequest(&emptypb.Empty{}))
 	assert.True(t, called)
 }
+
+func TestZstdCompressionPool(t *testing.T) {
+	t.Parallel()
+	option, ok := WithZstd().(*compressionOption)
+	assert.True(t, ok)
+	pool := option.CompressionPool
+	message := bytes.Repeat([]byte("connect "), 1024)
+	// Run twice to exercise pooled compressors and decompressors.
+	for i := 0; i < 2; i++ {
+		compressed := &bytes.Buffer{}
+		assert.Nil(t, pool.Compress(compressed, bytes.NewBuffer(message)))
+		assert.True(t, compressed.Len() < len(message))
+		decompressed := &bytes.Buffer{}
+		assert.Nil(t, pool.Decompress(decompressed, compressed, 0 /* readMaxBytes */))
+		assert.Equal(t, decompressed.Bytes(), message)
+	}
+	compressed := &bytes.Buffer{}
+	assert.Nil(t, pool.Compress(compressed, bytes.NewBuffer(message)))
+	err := pool.Decompress(&bytes.Buffer{}, compressed, 64)
+	assert.NotNil(t, err)
+	assert.Equal(t, err.Code(), CodeResourceExhausted)
+	err = pool.Decompress(&bytes.Buffer{}, bytes.NewBufferString("not zstd"), 0 /* readMaxBytes */)
+	assert.NotNil(t, err)
+	assert.Equal(t, err.Code(), CodeInvalidArgument)
+}
@@ -0,0 +1,82 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+// WithConformanceMode configures a handler exactly as the Connect conformance
+// runner expects, which makes it easy to run the conformance suite against an
+// application's own server wiring. It enables all three protocols, registers
+// the default Protobuf binary and JSON codecs and gzip compression, and undoes
+// options that relax protocol strictness, such as
+// [WithLenientRequestEncoding] and [WithProtoUnmarshalOptions].
+//
+// Options are applied in order, so WithConformanceMode should be the last
+// handler option.
+func WithConformanceMode() HandlerOption {
+	return WithHandlerOptions(
+		WithHandlerProtocols(ProtocolConnect, ProtocolGRPC, ProtocolGRPCWeb),
+		withProtoBinaryCodec(),
+		withProtoJSONCodecs(),
+		withGzip(),
+		&conformanceStrictnessOption{},
+	)
+}
+
+// WithConformanceClient configures a client using the protocol, codec, and
+// compression names from a conformance runner's client configuration:
+// protocol is one of [ProtocolConnect], [ProtocolGRPC], and [ProtocolGRPCWeb],
+// codec is "proto" or "json", and compression is "gzip", "identity", or empty.
+// Unknown names make every call from the client fail with [CodeUnknown].
+//
+// Options are applied in order, so WithConformanceClient should be the last
+// client option.
+func WithConformanceClient(protocol, codec, compression string) ClientOption {
+	options := []ClientOption{withGzip()}
+	switch protocol {
+	case ProtocolConnect:
+		options = append(options, WithConnect())
+	case ProtocolGRPC:
+		options = append(options, WithGRPC())
+	case ProtocolGRPCWeb:
+		options = append(options, WithGRPCWeb())
+	default:
+		return &clientInitErrorOption{Err: errorf(CodeUnknown, "unknown protocol %q", protocol)}
+	}
+	switch codec {
+	case codecNameProto:
+		options = append(options, withProtoBinaryCodec())
+	case codecNameJSON:
+		options = append(options, WithProtoJSON())
+	default:
+		return &clientInitErrorOption{Err: errorf(CodeUnknown, "unknown codec %q", codec)}
+	}
+	switch compression {
+	case "", compressionIdentity:
+		options = append(options, &sendCompressionOption{Name: ""})
+	default:
+		// Validated when the client is constructed.
+		options = append(options, WithSendCompression(compression))
+	}
+	return WithClientOptions(options...)
+}
+
+// conformanceStrictnessOption undoes handler options that relax the
+// protocols' requirements.
+type conformanceStrictnessOption struct{}
+
+func (o *conformanceStrictnessOption) applyToHandler(config *handlerConfig) {
+	config.LenientRequestEncoding = false
+	config.ProtoUnmarshalOptions = nil
+	config.HeaderMergePolicy = HeaderMergeAppend
+}
@@ -39,6 +39,7 @@ const Version = "1.2.0-dev"
 const (
 	IsAtLeastVersion0_0_1 = true
 	IsAtLeastVersion0_1_0 = true
+	IsAtLeastVersion1_2_0 = true
 )
 
 // StreamType describes whether the client, server, neither, or both is
@@ -248,16 +249,25 @@ type HTTPClient interface {
 
 // Spec is a description of a client call or a handler invocation.
 type Spec struct {
-	StreamType StreamType
-	Procedure  string // for example, "/acme.foo.v1.FooService/Bar"
-	IsClient   bool   // otherwise we're in a handler
+	StreamType       StreamType
+	Procedure        string // for example, "/acme.foo.v1.FooService/Bar"
+	IsClient         bool   // otherwise we're in a handler
+	IdempotencyLevel IdempotencyLevel
 }
 
 // Peer describes the other party to an RPC. When accessed client-side, Addr
-// contains the host or host:port from the server's URL. When accessed
-// server-side, Addr contains the client's address in IP:port format.
+// contains the host or host:port from the server's URL until a connection is
+// established, and the remote address of the connection afterwards. (For
+// unary calls, interceptors see the connection's address on the request once
+// the next function in the chain returns.) When accessed server-side, Addr
+// contains the client's address in IP:port format.
+//
+// AuthInfo describes the peer's verified identity, if any. Client-side, it's a
+// [TLSInfo] once a TLS connection is established. Server-side, it's populated
+// by the verifiers configured with [WithAuthVerifiers].
 type Peer struct {
-	Addr string
+	Addr     string
+	AuthInfo AuthInfo
 }
 
 func newPeerFromURL(s string) Peer {
@@ -276,6 +286,22 @@ type handlerConnCloser interface {
 	Close(error) error
 }
 
+// receiveCloser is implemented by StreamingHandlerConns that can stop reading
+// the request stream before the client has finished sending.
+type receiveCloser interface {
+	CloseReceive() error
+}
+
+// closeReceive half-closes the receive side of a StreamingHandlerConn, if the
+// connection supports it.
+func closeReceive(conn StreamingHandlerConn) error {
+	closer, ok := conn.(receiveCloser)
+	if !ok {
+		return errorf(CodeUnimplemented, "%T doesn't support closing the receive side of the stream", conn)
+	}
+	return closer.CloseReceive()
+}
+
 // receiveUnaryResponse unmarshals a message from a StreamingClientConn, then
 // envelopes the message and attaches headers and trailers. It attempts to
 // consume the response stream and isn't appropriate when receiving multiple
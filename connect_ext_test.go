@@ -584,7 +584,6 @@ func TestGRPCMissingTrailersError(t *testing.T) {
 
 	trimTrailers := func(handler http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			r.Header.Del("Te")
 			handler.ServeHTTP(&trimTrailerWriter{w: w}, r)
 		})
 	}
@@ -659,6 +658,63 @@ func TestGRPCMissingTrailersError(t *testing.T) {
 	})
 }
 
+func TestGRPCMissingTE(t *testing.T) {
+	t.Parallel()
+	// stripTE simulates a proxy that doesn't forward the TE header, and
+	// probably doesn't forward trailers either.
+	stripTE := func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Header.Del("Te")
+			handler.ServeHTTP(&trimTrailerWriter{w: w}, r)
+		})
+	}
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	server := httptest.NewUnstartedServer(stripTE(mux))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	assertMissingTE := func(t *testing.T, err error) {
+		t.Helper()
+		assert.Equal(t, connect.CodeOf(err), connect.CodeInternal)
+		assert.True(t, strings.Contains(err.Error(), `must include "TE: trailers"`))
+	}
+	t.Run("grpc", func(t *testing.T) {
+		t.Parallel()
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithGRPC())
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assertMissingTE(t, err)
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 1}))
+		assert.Nil(t, err)
+		assert.False(t, stream.Receive())
+		assertMissingTE(t, stream.Err())
+	})
+	t.Run("grpcweb", func(t *testing.T) {
+		t.Parallel()
+		// gRPC-Web sends trailers in the body, so it doesn't need TE.
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithGRPCWeb())
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Nil(t, err)
+	})
+}
+
+func TestGRPCOverHTTP1(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithGRPC())
+	// net/http sends HTTP/1.1 trailers using chunked transfer encoding.
+	response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 42}))
+	assert.Nil(t, err)
+	assert.Equal(t, response.Msg.Number, 42)
+	assert.Equal(t, response.Trailer().Get("Grpc-Status"), "0")
+	_, err = client.Fail(context.Background(), connect.NewRequest(&pingv1.FailRequest{Code: int32(connect.CodeResourceExhausted)}))
+	assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+}
+
 func TestUnavailableIfHostInvalid(t *testing.T) {
 	t.Parallel()
 	client := pingv1connect.NewPingServiceClient(
@@ -777,6 +833,171 @@ func TestCustomCompression(t *testing.T) {
 	assert.Equal(t, response.Msg, &pingv1.PingResponse{Text: request.Text})
 }
 
+func TestBufferPoolStats(t *testing.T) {
+	t.Parallel()
+	var handlerStats, clientStats connect.BufferPoolStats
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		pingServer{},
+		connect.WithBufferPoolStats(&handlerStats),
+		connect.WithInitialBufferSize(64),
+		connect.WithMaxRecycleBufferSize(1024),
+	))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := pingv1connect.NewPingServiceClient(
+		server.Client(),
+		server.URL,
+		connect.WithBufferPoolStats(&clientStats),
+		connect.WithSendGzip(),
+	)
+	const calls = 10
+	for i := 0; i < calls; i++ {
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Text: "small"}))
+		assert.Nil(t, err)
+	}
+	assert.True(t, handlerStats.Hits()+handlerStats.Misses() > 0)
+	assert.True(t, clientStats.Hits()+clientStats.Misses() > 0)
+	assert.True(t, clientStats.Hits() > 0)
+	assert.Zero(t, handlerStats.Discards())
+
+	large := strings.Repeat("a", 4096)
+	_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Text: large}))
+	assert.Nil(t, err)
+	assert.True(t, handlerStats.Discards() > 0)
+	assert.Zero(t, clientStats.Discards())
+}
+
+func TestZstd(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		pingServer{},
+		connect.WithZstd(),
+		connect.WithCompressMinBytes(1),
+	))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	for _, protocol := range []struct {
+		name   string
+		option connect.ClientOption
+	}{
+		{name: "connect", option: connect.WithClientOptions()},
+		{name: "grpc", option: connect.WithGRPC()},
+		{name: "grpcweb", option: connect.WithGRPCWeb()},
+	} {
+		protocol := protocol
+		t.Run(protocol.name, func(t *testing.T) {
+			t.Parallel()
+			var mu sync.Mutex
+			var encodings []string
+			httpClient := httpClientFunc(func(request *http.Request) (*http.Response, error) {
+				response, err := server.Client().Do(request)
+				if err == nil {
+					mu.Lock()
+					for _, key := range []string{"Content-Encoding", "Connect-Content-Encoding", "Grpc-Encoding"} {
+						if value := response.Header.Get(key); value != "" {
+							encodings = append(encodings, value)
+						}
+					}
+					mu.Unlock()
+				}
+				return response, err
+			})
+			client := pingv1connect.NewPingServiceClient(
+				httpClient,
+				server.URL,
+				protocol.option,
+				connect.WithZstd(),
+				connect.WithSendCompression("zstd"),
+				connect.WithCompressMinBytes(1),
+			)
+			text := strings.Repeat("zstd ", 256)
+			response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Text: text}))
+			assert.Nil(t, err)
+			assert.Equal(t, response.Msg.Text, text)
+			stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 3}))
+			assert.Nil(t, err)
+			var count int
+			for stream.Receive() {
+				count++
+			}
+			assert.Nil(t, stream.Err())
+			assert.Nil(t, stream.Close())
+			assert.Equal(t, count, 3)
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Equal(t, encodings, []string{"zstd", "zstd"})
+		})
+	}
+}
+
+func TestSerializationTiming(t *testing.T) {
+	t.Parallel()
+	type ctxKey struct{}
+	type recorder struct {
+		mu     sync.Mutex
+		stages map[connect.SerializationStage]int
+		traced int
+	}
+	newRecorder := func() *recorder {
+		return &recorder{stages: make(map[connect.SerializationStage]int)}
+	}
+	report := func(r *recorder) func(context.Context, connect.SerializationTiming) {
+		return func(ctx context.Context, timing connect.SerializationTiming) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.stages[timing.Stage]++
+			if ctx.Value(ctxKey{}) != nil {
+				r.traced++
+			}
+			assert.Equal(t, timing.Spec.Procedure, "/connect.ping.v1.PingService/Ping")
+			assert.True(t, timing.Bytes > 0)
+			assert.True(t, timing.Duration >= 0)
+		}
+	}
+	allStages := []connect.SerializationStage{
+		connect.SerializationMarshal,
+		connect.SerializationUnmarshal,
+		connect.SerializationCompress,
+		connect.SerializationDecompress,
+	}
+	for _, protocol := range []string{"connect", "grpc"} {
+		protocol := protocol
+		t.Run(protocol, func(t *testing.T) {
+			t.Parallel()
+			handlerTimings, clientTimings := newRecorder(), newRecorder()
+			mux := http.NewServeMux()
+			mux.Handle(pingv1connect.NewPingServiceHandler(
+				pingServer{},
+				connect.WithSerializationTiming(report(handlerTimings)),
+			))
+			server := httptest.NewUnstartedServer(mux)
+			server.EnableHTTP2 = true
+			server.StartTLS()
+			t.Cleanup(server.Close)
+			options := []connect.ClientOption{
+				connect.WithSerializationTiming(report(clientTimings)),
+				connect.WithSendGzip(),
+			}
+			if protocol == "grpc" {
+				options = append(options, connect.WithGRPC())
+			}
+			client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, options...)
+			ctx := context.WithValue(context.Background(), ctxKey{}, true)
+			_, err := client.Ping(ctx, connect.NewRequest(&pingv1.PingRequest{Number: 42, Text: "timed"}))
+			assert.Nil(t, err)
+			for _, stage := range allStages {
+				assert.Equal(t, handlerTimings.stages[stage], 1, assert.Sprintf("handler %v", stage))
+				assert.Equal(t, clientTimings.stages[stage], 1, assert.Sprintf("client %v", stage))
+			}
+			assert.Equal(t, clientTimings.traced, len(allStages))
+		})
+	}
+}
+
 func TestClientWithoutGzipSupport(t *testing.T) {
 	// See https://github.com/bufbuild/connect-go/pull/349 for why we want to
 	// support this. TL;DR is that Microsoft's dapr sidecar can't handle
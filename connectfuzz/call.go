@@ -0,0 +1,189 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connectfuzz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/bufbuild/connect-go"
+	"google.golang.org/protobuf/proto"
+)
+
+// CallUnary makes n unary calls with generated requests, passing each
+// request and its outcome to check. Calls that fail aren't necessarily
+// problems, since handlers may reject some valid requests, so check decides:
+// it returns an error to stop the run. CallUnary returns the first such
+// error, annotated with the call's index.
+//
+// Req must be a generated protobuf message type.
+func CallUnary[Req, Res any](
+	ctx context.Context,
+	client *connect.Client[Req, Res],
+	generator *Generator,
+	n int,
+	check func(request *Req, response *connect.Response[Res], err error) error,
+) error {
+	for i := 0; i < n; i++ {
+		request, err := newMessage[Req](generator)
+		if err != nil {
+			return err
+		}
+		response, err := client.CallUnary(ctx, connect.NewRequest(request))
+		if err := check(request, response, err); err != nil {
+			return fmt.Errorf("call %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// CallClientStream makes n client streaming calls, each sending a random
+// number of generated requests (up to the limit set with
+// [WithMaxStreamLength]). It passes the requests sent and the call's outcome
+// to check, as in [CallUnary].
+func CallClientStream[Req, Res any](
+	ctx context.Context,
+	client *connect.Client[Req, Res],
+	generator *Generator,
+	n int,
+	check func(requests []*Req, response *connect.Response[Res], err error) error,
+) error {
+	for i := 0; i < n; i++ {
+		requests, err := newMessages[Req](generator)
+		if err != nil {
+			return err
+		}
+		stream := client.CallClientStream(ctx)
+		sent := requests[:0:0]
+		for _, request := range requests {
+			// Send returns io.EOF if the server has already responded, and
+			// CloseAndReceive returns the server's error.
+			if err := stream.Send(request); err != nil {
+				break
+			}
+			sent = append(sent, request)
+		}
+		response, err := stream.CloseAndReceive()
+		if err := check(sent, response, err); err != nil {
+			return fmt.Errorf("call %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// CallServerStream makes n server streaming calls with generated requests,
+// passing each request, the responses received, and the stream's error to
+// check, as in [CallUnary].
+func CallServerStream[Req, Res any](
+	ctx context.Context,
+	client *connect.Client[Req, Res],
+	generator *Generator,
+	n int,
+	check func(request *Req, responses []*Res, err error) error,
+) error {
+	for i := 0; i < n; i++ {
+		request, err := newMessage[Req](generator)
+		if err != nil {
+			return err
+		}
+		var responses []*Res
+		stream, err := client.CallServerStream(ctx, connect.NewRequest(request))
+		if err == nil {
+			for stream.Receive() {
+				responses = append(responses, stream.Msg())
+			}
+			err = stream.Err()
+			_ = stream.Close()
+		}
+		if err := check(request, responses, err); err != nil {
+			return fmt.Errorf("call %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// CallBidiStream makes n bidirectional streaming calls. Each sends a random
+// number of generated requests (up to the limit set with
+// [WithMaxStreamLength]), closes the request side, and then receives all the
+// responses. It passes the requests sent, the responses received, and the
+// stream's error to check, as in [CallUnary].
+//
+// Since all requests are sent before any responses are read, handlers that
+// respond to each request before reading the next one may deadlock once
+// their responses fill the transport's buffers. Keep streams short when
+// testing such handlers.
+func CallBidiStream[Req, Res any](
+	ctx context.Context,
+	client *connect.Client[Req, Res],
+	generator *Generator,
+	n int,
+	check func(requests []*Req, responses []*Res, err error) error,
+) error {
+	for i := 0; i < n; i++ {
+		requests, err := newMessages[Req](generator)
+		if err != nil {
+			return err
+		}
+		stream := client.CallBidiStream(ctx)
+		sent := requests[:0:0]
+		for _, request := range requests {
+			if err := stream.Send(request); err != nil {
+				break
+			}
+			sent = append(sent, request)
+		}
+		_ = stream.CloseRequest()
+		var responses []*Res
+		for {
+			response, receiveErr := stream.Receive()
+			if receiveErr != nil {
+				if !errors.Is(receiveErr, io.EOF) {
+					err = receiveErr
+				}
+				break
+			}
+			responses = append(responses, response)
+		}
+		_ = stream.CloseResponse()
+		if err := check(sent, responses, err); err != nil {
+			return fmt.Errorf("call %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func newMessage[T any](generator *Generator) (*T, error) {
+	message := new(T)
+	protoMessage, ok := any(message).(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("connectfuzz: %T isn't a protobuf message", message)
+	}
+	generator.Fill(protoMessage)
+	return message, nil
+}
+
+func newMessages[T any](generator *Generator) ([]*T, error) {
+	messages := make([]*T, generator.count(nil, nil, generator.maxStreamLength))
+	for i := range messages {
+		message, err := newMessage[T](generator)
+		if err != nil {
+			return nil, err
+		}
+		messages[i] = message
+	}
+	return messages, nil
+}
@@ -0,0 +1,157 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connectfuzz_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/bufbuild/connect-go/connectfuzz"
+	"github.com/bufbuild/connect-go/internal/assert"
+	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestCall(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle("/ping", connect.NewUnaryHandler(
+		"/ping",
+		func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			if request.Msg.Number < 0 {
+				return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("negative number"))
+			}
+			return connect.NewResponse(&pingv1.PingResponse{Number: request.Msg.Number, Text: request.Msg.Text}), nil
+		},
+	))
+	mux.Handle("/sum", connect.NewClientStreamHandler(
+		"/sum",
+		func(_ context.Context, stream *connect.ClientStream[pingv1.SumRequest]) (*connect.Response[pingv1.SumResponse], error) {
+			var sum int64
+			for stream.Receive() {
+				sum += stream.Msg().Number
+			}
+			return connect.NewResponse(&pingv1.SumResponse{Sum: sum}), stream.Err()
+		},
+	))
+	mux.Handle("/count", connect.NewServerStreamHandler(
+		"/count",
+		func(_ context.Context, request *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+			for i := int64(1); i <= request.Msg.Number && i <= 10; i++ {
+				if err := stream.Send(&pingv1.CountUpResponse{Number: i}); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	))
+	mux.Handle("/cumsum", connect.NewBidiStreamHandler(
+		"/cumsum",
+		func(_ context.Context, stream *connect.BidiStream[pingv1.CumSumRequest, pingv1.CumSumResponse]) error {
+			var sum int64
+			for {
+				request, err := stream.Receive()
+				if errors.Is(err, io.EOF) {
+					return nil
+				} else if err != nil {
+					return err
+				}
+				sum += request.Number
+				if err := stream.Send(&pingv1.CumSumResponse{Sum: sum}); err != nil {
+					return err
+				}
+			}
+		},
+	))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	ctx := context.Background()
+	generator := connectfuzz.NewGenerator(1)
+
+	ping := connect.NewClient[pingv1.PingRequest, pingv1.PingResponse](server.Client(), server.URL+"/ping")
+	var rejected int
+	err := connectfuzz.CallUnary(ctx, ping, generator, 50, func(request *pingv1.PingRequest, response *connect.Response[pingv1.PingResponse], err error) error {
+		if request.Number < 0 {
+			rejected++
+			if connect.CodeOf(err) != connect.CodeInvalidArgument {
+				return fmt.Errorf("expected CodeInvalidArgument, got %v", err)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !proto.Equal(request, &pingv1.PingRequest{Number: response.Msg.Number, Text: response.Msg.Text}) {
+			return fmt.Errorf("response %v doesn't echo request %v", response.Msg, request)
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.True(t, rejected > 0)
+
+	sum := connect.NewClient[pingv1.SumRequest, pingv1.SumResponse](server.Client(), server.URL+"/sum")
+	err = connectfuzz.CallClientStream(ctx, sum, generator, 20, func(requests []*pingv1.SumRequest, response *connect.Response[pingv1.SumResponse], err error) error {
+		if err != nil {
+			return err
+		}
+		var expect int64
+		for _, request := range requests {
+			expect += request.Number
+		}
+		if response.Msg.Sum != expect {
+			return fmt.Errorf("got sum %d, expected %d", response.Msg.Sum, expect)
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+
+	count := connect.NewClient[pingv1.CountUpRequest, pingv1.CountUpResponse](server.Client(), server.URL+"/count")
+	err = connectfuzz.CallServerStream(ctx, count, generator, 20, func(request *pingv1.CountUpRequest, responses []*pingv1.CountUpResponse, err error) error {
+		if err != nil {
+			return err
+		}
+		if request.Number > 0 && len(responses) == 0 {
+			return errors.New("no responses")
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+
+	cumSum := connect.NewClient[pingv1.CumSumRequest, pingv1.CumSumResponse](server.Client(), server.URL+"/cumsum")
+	err = connectfuzz.CallBidiStream(ctx, cumSum, generator, 20, func(requests []*pingv1.CumSumRequest, responses []*pingv1.CumSumResponse, err error) error {
+		if err != nil {
+			return err
+		}
+		if len(responses) != len(requests) {
+			return fmt.Errorf("got %d responses to %d requests", len(responses), len(requests))
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+
+	// Check errors stop the run and identify the call.
+	err = connectfuzz.CallUnary(ctx, ping, generator, 5, func(*pingv1.PingRequest, *connect.Response[pingv1.PingResponse], error) error {
+		return errors.New("oops")
+	})
+	assert.Equal(t, err.Error(), "call 0: oops")
+}
@@ -0,0 +1,397 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connectfuzz
+
+import (
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// validateExtension is the field number of protovalidate's buf.validate.field
+// extension of google.protobuf.FieldOptions.
+const validateExtension = 1159
+
+// fieldRules is the subset of protovalidate's FieldConstraints that the
+// generator understands. Anything else (CEL expressions, patterns, uniqueness)
+// is ignored.
+type fieldRules struct {
+	required bool
+	number   *numberRules
+	str      *stringRules
+	bytes    *bytesRules
+	enum     *enumRules
+	repeated *repeatedRules
+	mapRules *mapRules
+}
+
+type numberValue struct {
+	i int64
+	f float64
+}
+
+type numberRules struct {
+	constant *numberValue
+	lt, lte  *numberValue
+	gt, gte  *numberValue
+	in       []numberValue
+}
+
+type stringRules struct {
+	constant        *string
+	in              []string
+	length          *uint64
+	minLen, maxLen  *uint64
+	maxBytes        *uint64
+	prefix, suffix  string
+	contains        string
+	email, hostname bool
+	uri, uuid       bool
+}
+
+type bytesRules struct {
+	constant       []byte
+	in             [][]byte
+	length         *uint64
+	minLen, maxLen *uint64
+	prefix, suffix []byte
+}
+
+type enumRules struct {
+	constant *int32
+	in       []int32
+	notIn    []int32
+}
+
+type repeatedRules struct {
+	minItems, maxItems *uint64
+	items              *fieldRules
+}
+
+type mapRules struct {
+	minPairs, maxPairs *uint64
+	keys, values       *fieldRules
+}
+
+// rulesFor extracts protovalidate constraints from a field's options. The
+// extension may or may not be registered in this binary, so the options are
+// marshaled and the extension is parsed from the wire format.
+func rulesFor(field protoreflect.FieldDescriptor) *fieldRules {
+	options := field.Options()
+	if options == nil {
+		return &fieldRules{}
+	}
+	raw, err := proto.MarshalOptions{Deterministic: true}.Marshal(options)
+	if err != nil {
+		return &fieldRules{}
+	}
+	rules := &fieldRules{}
+	eachField(raw, func(num protowire.Number, typ protowire.Type, value []byte, _ uint64) {
+		if num == validateExtension && typ == protowire.BytesType {
+			parseFieldRules(rules, value)
+		}
+	})
+	return rules
+}
+
+func parseFieldRules(rules *fieldRules, raw []byte) {
+	eachField(raw, func(num protowire.Number, typ protowire.Type, value []byte, scalar uint64) {
+		switch {
+		case num >= 1 && num <= 12 && typ == protowire.BytesType:
+			rules.number = parseNumberRules(value, num)
+		case num == 14 && typ == protowire.BytesType:
+			rules.str = parseStringRules(value)
+		case num == 15 && typ == protowire.BytesType:
+			rules.bytes = parseBytesRules(value)
+		case num == 16 && typ == protowire.BytesType:
+			rules.enum = parseEnumRules(value)
+		case num == 18 && typ == protowire.BytesType:
+			rules.repeated = parseRepeatedRules(value)
+		case num == 19 && typ == protowire.BytesType:
+			rules.mapRules = parseMapRules(value)
+		case num == 25 && typ == protowire.VarintType:
+			rules.required = scalar != 0
+		}
+	})
+}
+
+// parseNumberRules parses the numeric rules, whose field numbers are shared
+// by every numeric type. The kind is FieldConstraints' field number for the
+// rules, which determines how values are encoded.
+func parseNumberRules(raw []byte, kind protowire.Number) *numberRules {
+	rules := &numberRules{}
+	decode := func(typ protowire.Type, scalar uint64) (numberValue, bool) {
+		var value numberValue
+		switch {
+		case kind == 1 && typ == protowire.Fixed32Type: // float
+			value.f = float64(math.Float32frombits(uint32(scalar)))
+		case kind == 2 && typ == protowire.Fixed64Type: // double
+			value.f = math.Float64frombits(scalar)
+		case (kind == 3 || kind == 4) && typ == protowire.VarintType: // int32, int64
+			value.i = int64(scalar)
+		case (kind == 5 || kind == 6) && typ == protowire.VarintType: // uint32, uint64
+			value.i = clampUint(scalar)
+		case (kind == 7 || kind == 8) && typ == protowire.VarintType: // sint32, sint64
+			value.i = protowire.DecodeZigZag(scalar)
+		case (kind == 9 || kind == 10) && (typ == protowire.Fixed32Type || typ == protowire.Fixed64Type): // fixed32, fixed64
+			value.i = clampUint(scalar)
+		case kind == 11 && typ == protowire.Fixed32Type: // sfixed32
+			value.i = int64(int32(scalar))
+		case kind == 12 && typ == protowire.Fixed64Type: // sfixed64
+			value.i = int64(scalar)
+		default:
+			return value, false
+		}
+		if kind > 2 {
+			value.f = float64(value.i)
+		}
+		return value, true
+	}
+	eachField(raw, func(num protowire.Number, typ protowire.Type, packed []byte, scalar uint64) {
+		if num == 6 && typ == protowire.BytesType {
+			// Packed repeated "in" values.
+			eachPacked(packed, kind, func(typ protowire.Type, scalar uint64) {
+				if value, ok := decode(typ, scalar); ok {
+					rules.in = append(rules.in, value)
+				}
+			})
+			return
+		}
+		value, ok := decode(typ, scalar)
+		if !ok {
+			return
+		}
+		switch num {
+		case 1:
+			rules.constant = &value
+		case 2:
+			rules.lt = &value
+		case 3:
+			rules.lte = &value
+		case 4:
+			rules.gt = &value
+		case 5:
+			rules.gte = &value
+		case 6:
+			rules.in = append(rules.in, value)
+		}
+	})
+	return rules
+}
+
+func parseStringRules(raw []byte) *stringRules {
+	rules := &stringRules{}
+	eachField(raw, func(num protowire.Number, typ protowire.Type, value []byte, scalar uint64) {
+		if typ == protowire.BytesType {
+			switch num {
+			case 1:
+				constant := string(value)
+				rules.constant = &constant
+			case 7:
+				rules.prefix = string(value)
+			case 8:
+				rules.suffix = string(value)
+			case 9:
+				rules.contains = string(value)
+			case 10:
+				rules.in = append(rules.in, string(value))
+			}
+			return
+		}
+		if typ != protowire.VarintType {
+			return
+		}
+		n := scalar
+		switch num {
+		case 2:
+			rules.minLen = &n
+		case 3:
+			rules.maxLen = &n
+		case 5:
+			rules.maxBytes = &n
+		case 19:
+			rules.length = &n
+		case 12:
+			rules.email = scalar != 0
+		case 13:
+			rules.hostname = scalar != 0
+		case 17:
+			rules.uri = scalar != 0
+		case 22:
+			rules.uuid = scalar != 0
+		}
+	})
+	return rules
+}
+
+func parseBytesRules(raw []byte) *bytesRules {
+	rules := &bytesRules{}
+	eachField(raw, func(num protowire.Number, typ protowire.Type, value []byte, scalar uint64) {
+		n := scalar
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			rules.constant = append([]byte{}, value...)
+		case num == 5 && typ == protowire.BytesType:
+			rules.prefix = append([]byte(nil), value...)
+		case num == 6 && typ == protowire.BytesType:
+			rules.suffix = append([]byte(nil), value...)
+		case num == 8 && typ == protowire.BytesType:
+			rules.in = append(rules.in, append([]byte{}, value...))
+		case num == 2 && typ == protowire.VarintType:
+			rules.minLen = &n
+		case num == 3 && typ == protowire.VarintType:
+			rules.maxLen = &n
+		case num == 13 && typ == protowire.VarintType:
+			rules.length = &n
+		}
+	})
+	return rules
+}
+
+func parseEnumRules(raw []byte) *enumRules {
+	rules := &enumRules{}
+	eachField(raw, func(num protowire.Number, typ protowire.Type, value []byte, scalar uint64) {
+		if typ == protowire.BytesType && (num == 3 || num == 4) {
+			eachPacked(value, 3, func(_ protowire.Type, scalar uint64) {
+				if num == 3 {
+					rules.in = append(rules.in, int32(scalar))
+				} else {
+					rules.notIn = append(rules.notIn, int32(scalar))
+				}
+			})
+			return
+		}
+		if typ != protowire.VarintType {
+			return
+		}
+		switch num {
+		case 1:
+			constant := int32(scalar)
+			rules.constant = &constant
+		case 3:
+			rules.in = append(rules.in, int32(scalar))
+		case 4:
+			rules.notIn = append(rules.notIn, int32(scalar))
+		}
+	})
+	return rules
+}
+
+func parseRepeatedRules(raw []byte) *repeatedRules {
+	rules := &repeatedRules{}
+	eachField(raw, func(num protowire.Number, typ protowire.Type, value []byte, scalar uint64) {
+		n := scalar
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			rules.minItems = &n
+		case num == 2 && typ == protowire.VarintType:
+			rules.maxItems = &n
+		case num == 4 && typ == protowire.BytesType:
+			rules.items = &fieldRules{}
+			parseFieldRules(rules.items, value)
+		}
+	})
+	return rules
+}
+
+func parseMapRules(raw []byte) *mapRules {
+	rules := &mapRules{}
+	eachField(raw, func(num protowire.Number, typ protowire.Type, value []byte, scalar uint64) {
+		n := scalar
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			rules.minPairs = &n
+		case num == 2 && typ == protowire.VarintType:
+			rules.maxPairs = &n
+		case num == 4 && typ == protowire.BytesType:
+			rules.keys = &fieldRules{}
+			parseFieldRules(rules.keys, value)
+		case num == 5 && typ == protowire.BytesType:
+			rules.values = &fieldRules{}
+			parseFieldRules(rules.values, value)
+		}
+	})
+	return rules
+}
+
+// eachField calls f for each field in a serialized message. Length-delimited
+// fields pass their contents as value; other fields pass their numeric value
+// as scalar. Malformed input ends the iteration.
+func eachField(raw []byte, f func(num protowire.Number, typ protowire.Type, value []byte, scalar uint64)) {
+	for len(raw) > 0 {
+		num, typ, n := protowire.ConsumeTag(raw)
+		if n < 0 {
+			return
+		}
+		raw = raw[n:]
+		var value []byte
+		var scalar uint64
+		switch typ {
+		case protowire.VarintType:
+			scalar, n = protowire.ConsumeVarint(raw)
+		case protowire.Fixed32Type:
+			var v uint32
+			v, n = protowire.ConsumeFixed32(raw)
+			scalar = uint64(v)
+		case protowire.Fixed64Type:
+			scalar, n = protowire.ConsumeFixed64(raw)
+		case protowire.BytesType:
+			value, n = protowire.ConsumeBytes(raw)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, raw)
+		}
+		if n < 0 {
+			return
+		}
+		raw = raw[n:]
+		f(num, typ, value, scalar)
+	}
+}
+
+// eachPacked iterates over a packed repeated field of the numeric kind used
+// by parseNumberRules.
+func eachPacked(raw []byte, kind protowire.Number, f func(protowire.Type, uint64)) {
+	for len(raw) > 0 {
+		var scalar uint64
+		var n int
+		var typ protowire.Type
+		switch kind {
+		case 1, 9, 11:
+			var v uint32
+			v, n = protowire.ConsumeFixed32(raw)
+			scalar, typ = uint64(v), protowire.Fixed32Type
+		case 2, 10, 12:
+			scalar, n = protowire.ConsumeFixed64(raw)
+			typ = protowire.Fixed64Type
+		default:
+			scalar, n = protowire.ConsumeVarint(raw)
+			typ = protowire.VarintType
+		}
+		if n < 0 {
+			return
+		}
+		raw = raw[n:]
+		f(typ, scalar)
+	}
+}
+
+func clampUint(value uint64) int64 {
+	if value > math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return int64(value)
+}
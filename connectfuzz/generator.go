@@ -0,0 +1,526 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package connectfuzz generates randomized, schema-conforming protobuf
+// messages and uses them to drive calls against handlers, which makes it easy
+// to write property-based tests: for example, that a handler never returns
+// CodeInternal or CodeUnknown, no matter what valid request it receives.
+//
+// Generated messages respect the subset of protovalidate constraints
+// (buf.validate annotations) that describe the shape of individual values:
+// numeric ranges, constants and "in" lists, string and bytes lengths,
+// prefixes, suffixes, and well-known string formats, enum values, the sizes of
+// repeated and map fields, and required fields. Other constraints, like
+// regular expressions and CEL expressions, are ignored, so messages with such
+// constraints may fail validation.
+package connectfuzz
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	defaultMaxDepth        = 4
+	defaultMaxRepeated     = 4
+	defaultMaxLength       = 16
+	defaultMaxStreamLength = 4
+	// Without constraints, integers and floats are drawn from this range
+	// (except for occasional extreme values), since small values are more
+	// likely to exercise interesting code paths.
+	defaultNumberRange = 1000
+)
+
+// An Option configures a [Generator].
+type Option interface {
+	apply(*Generator)
+}
+
+// WithMaxDepth limits the nesting of generated messages. Message fields deeper
+// than the limit are left unset. The default is 4.
+func WithMaxDepth(depth int) Option {
+	return optionFunc(func(g *Generator) { g.maxDepth = depth })
+}
+
+// WithMaxRepeated limits the number of elements in generated repeated and
+// map fields, unless constraints require more. Repeated message fields get
+// half as many elements at each level of nesting. The default is 4.
+func WithMaxRepeated(n int) Option {
+	return optionFunc(func(g *Generator) { g.maxRepeated = n })
+}
+
+// WithMaxLength limits the length of generated strings (in characters) and
+// bytes, unless constraints require more. The default is 16.
+func WithMaxLength(n int) Option {
+	return optionFunc(func(g *Generator) { g.maxLength = n })
+}
+
+// WithMaxStreamLength limits the number of messages sent on each client or
+// bidirectional stream by [CallClientStream] and [CallBidiStream]. The
+// default is 4.
+func WithMaxStreamLength(n int) Option {
+	return optionFunc(func(g *Generator) { g.maxStreamLength = n })
+}
+
+type optionFunc func(*Generator)
+
+func (f optionFunc) apply(g *Generator) { f(g) }
+
+// A Generator produces random messages that conform to their schemas. Its
+// output is determined entirely by its seed, so failures found with a given
+// seed are reproducible.
+//
+// Generators aren't safe for concurrent use.
+type Generator struct {
+	rand            *rand.Rand
+	maxDepth        int
+	maxRepeated     int
+	maxLength       int
+	maxStreamLength int
+	rules           map[protoreflect.FieldDescriptor]*fieldRules
+}
+
+// NewGenerator constructs a Generator.
+func NewGenerator(seed int64, options ...Option) *Generator {
+	generator := &Generator{
+		rand:            rand.New(rand.NewSource(seed)), //nolint:gosec // test data, not secrets
+		maxDepth:        defaultMaxDepth,
+		maxRepeated:     defaultMaxRepeated,
+		maxLength:       defaultMaxLength,
+		maxStreamLength: defaultMaxStreamLength,
+		rules:           make(map[protoreflect.FieldDescriptor]*fieldRules),
+	}
+	for _, option := range options {
+		option.apply(generator)
+	}
+	return generator
+}
+
+// Fill resets the message and populates it with random values.
+func (g *Generator) Fill(message proto.Message) {
+	proto.Reset(message)
+	g.fillMessage(message.ProtoReflect(), 0)
+}
+
+// New returns a random message of the described type. It's useful when
+// generated code for the type isn't available, for example when working with
+// descriptors fetched by reflection.
+func (g *Generator) New(descriptor protoreflect.MessageDescriptor) *dynamicpb.Message {
+	message := dynamicpb.NewMessage(descriptor)
+	g.fillMessage(message, 0)
+	return message
+}
+
+func (g *Generator) fillMessage(message protoreflect.Message, depth int) {
+	descriptor := message.Descriptor()
+	switch descriptor.FullName() {
+	case "google.protobuf.Any":
+		// Random type URLs and values can't be resolved, so leave Any empty.
+		return
+	case "google.protobuf.Timestamp", "google.protobuf.Duration":
+		g.fillTime(message)
+		return
+	case "google.protobuf.FieldMask":
+		g.fillFieldMask(message)
+		return
+	}
+	oneofs := descriptor.Oneofs()
+	for i := 0; i < oneofs.Len(); i++ {
+		oneof := oneofs.Get(i)
+		if oneof.IsSynthetic() {
+			continue
+		}
+		field := oneof.Fields().Get(g.rand.Intn(oneof.Fields().Len()))
+		g.fillField(message, field, depth)
+	}
+	fields := descriptor.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		if oneof := field.ContainingOneof(); oneof != nil && !oneof.IsSynthetic() {
+			continue
+		}
+		if field.HasPresence() && !g.required(field) && g.rand.Intn(4) == 0 {
+			// Leave optional fields unset some of the time.
+			continue
+		}
+		g.fillField(message, field, depth)
+	}
+}
+
+func (g *Generator) fillField(message protoreflect.Message, field protoreflect.FieldDescriptor, depth int) {
+	rules := g.rulesFor(field)
+	isMessage := field.Kind() == protoreflect.MessageKind || field.Kind() == protoreflect.GroupKind
+	// Nested repeated messages get progressively fewer elements, which keeps
+	// the size of messages with many repeated message fields manageable.
+	limit := g.maxRepeated
+	if isMessage || (field.IsMap() && field.MapValue().Kind() == protoreflect.MessageKind) {
+		limit >>= depth
+	}
+	switch {
+	case field.IsMap():
+		var min, max *uint64
+		keyRules, valueRules := &fieldRules{}, &fieldRules{}
+		if rules.mapRules != nil {
+			min, max = rules.mapRules.minPairs, rules.mapRules.maxPairs
+			if rules.mapRules.keys != nil {
+				keyRules = rules.mapRules.keys
+			}
+			if rules.mapRules.values != nil {
+				valueRules = rules.mapRules.values
+			}
+		}
+		valueField := field.MapValue()
+		valueIsMessage := valueField.Kind() == protoreflect.MessageKind
+		if valueIsMessage && depth >= g.maxDepth {
+			return
+		}
+		entries := message.Mutable(field).Map()
+		count := g.count(min, max, limit)
+		// Keys may collide, so give up after a reasonable number of attempts.
+		for attempt := 0; entries.Len() < count && attempt < 4*count; attempt++ {
+			key := g.scalar(field.MapKey(), keyRules).MapKey()
+			value := entries.NewValue()
+			if valueIsMessage {
+				g.fillMessage(value.Message(), depth+1)
+			} else {
+				value = g.scalar(valueField, valueRules)
+			}
+			entries.Set(key, value)
+		}
+	case field.IsList():
+		var min, max *uint64
+		itemRules := &fieldRules{}
+		if rules.repeated != nil {
+			min, max = rules.repeated.minItems, rules.repeated.maxItems
+			if rules.repeated.items != nil {
+				itemRules = rules.repeated.items
+			}
+		}
+		if isMessage && depth >= g.maxDepth {
+			return
+		}
+		list := message.Mutable(field).List()
+		for i, count := 0, g.count(min, max, limit); i < count; i++ {
+			if isMessage {
+				element := list.NewElement()
+				g.fillMessage(element.Message(), depth+1)
+				list.Append(element)
+			} else {
+				list.Append(g.scalar(field, itemRules))
+			}
+		}
+	case isMessage:
+		if depth >= g.maxDepth && !g.required(field) {
+			return
+		}
+		value := message.NewField(field)
+		g.fillMessage(value.Message(), depth+1)
+		message.Set(field, value)
+	default:
+		message.Set(field, g.scalar(field, rules))
+	}
+}
+
+// scalar generates a value for a non-message field.
+func (g *Generator) scalar(field protoreflect.FieldDescriptor, rules *fieldRules) protoreflect.Value {
+	switch field.Kind() {
+	case protoreflect.BoolKind:
+		return protoreflect.ValueOfBool(g.rand.Intn(2) == 0)
+	case protoreflect.EnumKind:
+		return protoreflect.ValueOfEnum(g.enum(field.Enum(), rules.enum))
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return protoreflect.ValueOfInt32(int32(g.integer(rules.number, math.MinInt32, math.MaxInt32)))
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return protoreflect.ValueOfInt64(g.integer(rules.number, math.MinInt64, math.MaxInt64))
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return protoreflect.ValueOfUint32(uint32(g.integer(rules.number, 0, math.MaxUint32)))
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return protoreflect.ValueOfUint64(uint64(g.integer(rules.number, 0, math.MaxInt64)))
+	case protoreflect.FloatKind:
+		return protoreflect.ValueOfFloat32(float32(g.float(rules.number, -math.MaxFloat32, math.MaxFloat32)))
+	case protoreflect.DoubleKind:
+		return protoreflect.ValueOfFloat64(g.float(rules.number, -math.MaxFloat64, math.MaxFloat64))
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(g.string(rules.str))
+	case protoreflect.BytesKind:
+		return protoreflect.ValueOfBytes(g.bytes(rules.bytes))
+	default:
+		// Unreachable, since fillField handles message and group fields.
+		panic(fmt.Sprintf("connectfuzz: unexpected scalar kind %v", field.Kind())) //nolint:forbidigo
+	}
+}
+
+// required reports whether a field must always be set, either because it's a
+// proto2 required field or because of a protovalidate constraint.
+func (g *Generator) required(field protoreflect.FieldDescriptor) bool {
+	return field.Cardinality() == protoreflect.Required || g.rulesFor(field).required
+}
+
+func (g *Generator) rulesFor(field protoreflect.FieldDescriptor) *fieldRules {
+	rules, ok := g.rules[field]
+	if !ok {
+		rules = rulesFor(field)
+		g.rules[field] = rules
+	}
+	return rules
+}
+
+// count picks a number of elements between min and max, defaulting to
+// [0, limit]. Constraints take precedence over the limit.
+func (g *Generator) count(min, max *uint64, limit int) int {
+	low, high := 0, limit
+	if min != nil {
+		low = int(*min)
+		if high < low {
+			high = low
+		}
+	}
+	if max != nil && int(*max) < high {
+		high = int(*max)
+	}
+	if high <= low {
+		return low
+	}
+	return low + g.rand.Intn(high-low+1)
+}
+
+func (g *Generator) integer(rules *numberRules, min, max int64) int64 {
+	low, high := min, max
+	if rules != nil {
+		if rules.constant != nil {
+			return rules.constant.i
+		}
+		if len(rules.in) > 0 {
+			return rules.in[g.rand.Intn(len(rules.in))].i
+		}
+		if rules.gte != nil && rules.gte.i > low {
+			low = rules.gte.i
+		}
+		if rules.gt != nil && rules.gt.i >= low && rules.gt.i < math.MaxInt64 {
+			low = rules.gt.i + 1
+		}
+		if rules.lte != nil && rules.lte.i < high {
+			high = rules.lte.i
+		}
+		if rules.lt != nil && rules.lt.i <= high && rules.lt.i > math.MinInt64 {
+			high = rules.lt.i - 1
+		}
+		if low > high {
+			// An exclusive range, like gt: 10 and lt: 5, allows values outside
+			// [5, 10]. Stick to the upper side.
+			high = max
+		}
+	}
+	switch g.rand.Intn(8) {
+	case 0:
+		return low
+	case 1:
+		return high
+	}
+	// Prefer small values when they're allowed.
+	if low < -defaultNumberRange && high > defaultNumberRange {
+		low, high = -defaultNumberRange, defaultNumberRange
+	} else if low >= 0 && high > low+defaultNumberRange {
+		high = low + defaultNumberRange
+	} else if high <= 0 && low < high-defaultNumberRange {
+		low = high - defaultNumberRange
+	}
+	span := uint64(high - low)
+	if span == math.MaxUint64 {
+		return int64(g.rand.Uint64())
+	}
+	return low + int64(g.rand.Uint64()%(span+1))
+}
+
+func (g *Generator) float(rules *numberRules, min, max float64) float64 {
+	low, high := min, max
+	if rules != nil {
+		if rules.constant != nil {
+			return rules.constant.f
+		}
+		if len(rules.in) > 0 {
+			return rules.in[g.rand.Intn(len(rules.in))].f
+		}
+		if rules.gte != nil && rules.gte.f > low {
+			low = rules.gte.f
+		}
+		if rules.gt != nil && rules.gt.f >= low {
+			low = math.Nextafter(rules.gt.f, math.Inf(1))
+		}
+		if rules.lte != nil && rules.lte.f < high {
+			high = rules.lte.f
+		}
+		if rules.lt != nil && rules.lt.f <= high {
+			high = math.Nextafter(rules.lt.f, math.Inf(-1))
+		}
+		if low > high {
+			high = max
+		}
+	}
+	if low < -defaultNumberRange && high > defaultNumberRange {
+		low, high = -defaultNumberRange, defaultNumberRange
+	} else if low >= 0 && high > low+defaultNumberRange {
+		high = low + defaultNumberRange
+	} else if high <= 0 && low < high-defaultNumberRange {
+		low = high - defaultNumberRange
+	}
+	return low + g.rand.Float64()*(high-low)
+}
+
+func (g *Generator) enum(descriptor protoreflect.EnumDescriptor, rules *enumRules) protoreflect.EnumNumber {
+	if rules != nil && rules.constant != nil {
+		return protoreflect.EnumNumber(*rules.constant)
+	}
+	values := descriptor.Values()
+	candidates := make([]protoreflect.EnumNumber, 0, values.Len())
+	for i := 0; i < values.Len(); i++ {
+		number := values.Get(i).Number()
+		if rules != nil && len(rules.in) > 0 && !containsInt32(rules.in, int32(number)) {
+			continue
+		}
+		if rules != nil && containsInt32(rules.notIn, int32(number)) {
+			continue
+		}
+		candidates = append(candidates, number)
+	}
+	if len(candidates) == 0 {
+		if rules != nil && len(rules.in) > 0 {
+			return protoreflect.EnumNumber(rules.in[g.rand.Intn(len(rules.in))])
+		}
+		return values.Get(0).Number()
+	}
+	return candidates[g.rand.Intn(len(candidates))]
+}
+
+// alphabet mixes ASCII with multi-byte characters, so that generated strings
+// exercise UTF-8 handling.
+var alphabet = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789 _-.éß世界🙂")
+
+const lowercase = "abcdefghijklmnopqrstuvwxyz"
+
+func (g *Generator) string(rules *stringRules) string {
+	if rules == nil {
+		return g.runes(g.count(nil, nil, g.maxLength), alphabet)
+	}
+	switch {
+	case rules.constant != nil:
+		return *rules.constant
+	case len(rules.in) > 0:
+		return rules.in[g.rand.Intn(len(rules.in))]
+	case rules.email:
+		return g.word() + "@example.com"
+	case rules.hostname:
+		return g.word() + ".example.com"
+	case rules.uri:
+		return "https://example.com/" + g.word()
+	case rules.uuid:
+		var uuid [16]byte
+		_, _ = g.rand.Read(uuid[:])
+		return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:16])
+	}
+	min, max := rules.minLen, rules.maxLen
+	if rules.length != nil {
+		min, max = rules.length, rules.length
+	}
+	fixed := utf8.RuneCountInString(rules.prefix) + utf8.RuneCountInString(rules.contains) + utf8.RuneCountInString(rules.suffix)
+	length := g.count(min, max, g.maxLength) - fixed
+	if length < 0 {
+		length = 0
+	}
+	chars := alphabet
+	if rules.maxBytes != nil {
+		// Stick to ASCII so that characters and bytes agree.
+		chars = []rune(lowercase)
+		if budget := int(*rules.maxBytes) - len(rules.prefix) - len(rules.contains) - len(rules.suffix); length > budget {
+			length = budget
+		}
+	}
+	return rules.prefix + rules.contains + g.runes(length, chars) + rules.suffix
+}
+
+func (g *Generator) bytes(rules *bytesRules) []byte {
+	if rules != nil && rules.constant != nil {
+		return rules.constant
+	}
+	if rules != nil && len(rules.in) > 0 {
+		return rules.in[g.rand.Intn(len(rules.in))]
+	}
+	var min, max *uint64
+	var prefix, suffix []byte
+	if rules != nil {
+		min, max = rules.minLen, rules.maxLen
+		if rules.length != nil {
+			min, max = rules.length, rules.length
+		}
+		prefix, suffix = rules.prefix, rules.suffix
+	}
+	length := g.count(min, max, g.maxLength) - len(prefix) - len(suffix)
+	if length < 0 {
+		length = 0
+	}
+	data := make([]byte, 0, len(prefix)+length+len(suffix))
+	data = append(data, prefix...)
+	for i := 0; i < length; i++ {
+		data = append(data, byte(g.rand.Intn(256)))
+	}
+	return append(data, suffix...)
+}
+
+func (g *Generator) runes(n int, chars []rune) string {
+	var builder strings.Builder
+	for i := 0; i < n; i++ {
+		builder.WriteRune(chars[g.rand.Intn(len(chars))])
+	}
+	return builder.String()
+}
+
+func (g *Generator) word() string {
+	return g.runes(1+g.rand.Intn(8), []rune(lowercase))
+}
+
+// fillTime populates Timestamps and Durations with valid values.
+func (g *Generator) fillTime(message protoreflect.Message) {
+	fields := message.Descriptor().Fields()
+	seconds, nanos := g.rand.Int63n(4_000_000_000), int32(g.rand.Intn(1_000_000_000))
+	if message.Descriptor().FullName() == "google.protobuf.Duration" && g.rand.Intn(2) == 0 {
+		seconds, nanos = -seconds, -nanos
+	}
+	message.Set(fields.ByName("seconds"), protoreflect.ValueOfInt64(seconds))
+	message.Set(fields.ByName("nanos"), protoreflect.ValueOfInt32(nanos))
+}
+
+// fillFieldMask populates FieldMasks with paths that can be represented in
+// JSON.
+func (g *Generator) fillFieldMask(message protoreflect.Message) {
+	paths := message.Mutable(message.Descriptor().Fields().ByName("paths")).List()
+	for i, count := 0, g.count(nil, nil, g.maxRepeated); i < count; i++ {
+		paths.Append(protoreflect.ValueOfString(g.word()))
+	}
+}
+
+func containsInt32(values []int32, value int32) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
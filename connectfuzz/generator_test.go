@@ -0,0 +1,173 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connectfuzz
+
+import (
+	"math"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/bufbuild/connect-go/internal/assert"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestGeneratorConstraints(t *testing.T) {
+	t.Parallel()
+	descriptor := constrainedMessage(t)
+	fields := descriptor.Fields()
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+	generator := NewGenerator(42)
+	for i := 0; i < 200; i++ {
+		message := generator.New(descriptor)
+		age := message.Get(fields.ByName("age")).Int()
+		assert.True(t, age >= 18 && age <= 65, assert.Sprintf("age %d", age))
+		name := message.Get(fields.ByName("name")).String()
+		assert.True(t, strings.HasPrefix(name, "n-"), assert.Sprintf("name %q", name))
+		length := utf8.RuneCountInString(name)
+		assert.True(t, length >= 3 && length <= 5, assert.Sprintf("name %q", name))
+		assert.True(t, uuid.MatchString(message.Get(fields.ByName("id")).String()))
+		tags := message.Get(fields.ByName("tags")).List().Len()
+		assert.True(t, tags >= 2 && tags <= 3, assert.Sprintf("%d tags", tags))
+		assert.Equal(t, message.Get(fields.ByName("color")).Enum(), protoreflect.EnumNumber(2))
+		ratio := message.Get(fields.ByName("ratio")).Float()
+		assert.True(t, ratio > 0 && ratio < 1, assert.Sprintf("ratio %v", ratio))
+		assert.True(t, message.Has(fields.ByName("note")))
+	}
+}
+
+func TestGeneratorWellKnownTypes(t *testing.T) {
+	t.Parallel()
+	generator := NewGenerator(7)
+	for i := 0; i < 50; i++ {
+		for _, message := range []proto.Message{&structpb.Struct{}, &timestamppb.Timestamp{}, &descriptorpb.FileDescriptorProto{}} {
+			generator.Fill(message)
+			if timestamp, ok := message.(*timestamppb.Timestamp); ok {
+				assert.Nil(t, timestamp.CheckValid())
+			}
+			_, err := protojson.Marshal(message)
+			assert.Nil(t, err)
+			_, err = proto.Marshal(message)
+			assert.Nil(t, err)
+		}
+	}
+}
+
+func TestGeneratorDeterministic(t *testing.T) {
+	t.Parallel()
+	first, second := NewGenerator(1), NewGenerator(1)
+	for i := 0; i < 10; i++ {
+		a, b := &descriptorpb.FileDescriptorProto{}, &descriptorpb.FileDescriptorProto{}
+		first.Fill(a)
+		second.Fill(b)
+		assert.Equal(t, a, b)
+	}
+}
+
+// constrainedMessage builds a message descriptor with protovalidate
+// annotations. The annotations are encoded by hand, since protovalidate's
+// generated code isn't a dependency.
+func constrainedMessage(t *testing.T) protoreflect.MessageDescriptor {
+	t.Helper()
+	message := func(fields ...[]byte) []byte {
+		var raw []byte
+		for _, field := range fields {
+			raw = append(raw, field...)
+		}
+		return raw
+	}
+	bytesField := func(num protowire.Number, value []byte) []byte {
+		raw := protowire.AppendTag(nil, num, protowire.BytesType)
+		return protowire.AppendBytes(raw, value)
+	}
+	varintField := func(num protowire.Number, value uint64) []byte {
+		raw := protowire.AppendTag(nil, num, protowire.VarintType)
+		return protowire.AppendVarint(raw, value)
+	}
+	doubleField := func(num protowire.Number, value float64) []byte {
+		raw := protowire.AppendTag(nil, num, protowire.Fixed64Type)
+		return protowire.AppendFixed64(raw, math.Float64bits(value))
+	}
+	constraints := func(rules []byte) *descriptorpb.FieldOptions {
+		options := &descriptorpb.FieldOptions{}
+		options.ProtoReflect().SetUnknown(bytesField(validateExtension, rules))
+		return options
+	}
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, options *descriptorpb.FieldOptions) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{
+			Name:    proto.String(name),
+			Number:  proto.Int32(number),
+			Label:   descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:    typ.Enum(),
+			Options: options,
+		}
+	}
+	tags := field("tags", 4, descriptorpb.FieldDescriptorProto_TYPE_STRING, constraints(
+		bytesField(18, message(varintField(1, 2), varintField(2, 3))),
+	))
+	tags.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+	color := field("color", 5, descriptorpb.FieldDescriptorProto_TYPE_ENUM, constraints(
+		bytesField(16, message(varintField(3, 2))),
+	))
+	color.TypeName = proto.String(".test.Color")
+	note := field("note", 7, descriptorpb.FieldDescriptorProto_TYPE_STRING, constraints(varintField(25, 1)))
+	note.Proto3Optional = proto.Bool(true)
+	note.OneofIndex = proto.Int32(0)
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("test.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("Color"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("COLOR_UNSPECIFIED"), Number: proto.Int32(0)},
+				{Name: proto.String("COLOR_RED"), Number: proto.Int32(1)},
+				{Name: proto.String("COLOR_GREEN"), Number: proto.Int32(2)},
+			},
+		}},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Constrained"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("age", 1, descriptorpb.FieldDescriptorProto_TYPE_INT32, constraints(
+					bytesField(3, message(varintField(5, 18), varintField(3, 65))),
+				)),
+				field("name", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, constraints(
+					bytesField(14, message(varintField(2, 3), varintField(3, 5), bytesField(7, []byte("n-")))),
+				)),
+				field("id", 3, descriptorpb.FieldDescriptorProto_TYPE_STRING, constraints(
+					bytesField(14, varintField(22, 1)),
+				)),
+				tags,
+				color,
+				field("ratio", 6, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, constraints(
+					bytesField(2, message(doubleField(4, 0), doubleField(2, 1))),
+				)),
+				note,
+			},
+			OneofDecl: []*descriptorpb.OneofDescriptorProto{{Name: proto.String("_note")}},
+		}},
+	}
+	fd, err := protodesc.NewFile(file, nil)
+	assert.Nil(t, err)
+	return fd.Messages().Get(0)
+}
@@ -0,0 +1,250 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package connecthealth implements the gRPC health checking protocol
+// (grpc.health.v1.Health), so that load balancers and orchestrators like
+// Kubernetes and Envoy can probe Connect servers without depending on
+// grpc-go. The handler supports the Connect, gRPC, and gRPC-Web protocols,
+// including the streaming Watch method.
+//
+// Servers with fixed sets of services can use a [StaticChecker], which
+// reports status changes to watchers immediately:
+//
+//	checker := connecthealth.NewStaticChecker(pingv1connect.PingServiceName)
+//	mux.Handle(connecthealth.NewHandler(checker))
+//	// Later, while shutting down:
+//	checker.SetStatus(pingv1connect.PingServiceName, connecthealth.StatusNotServing)
+//
+// The package registers its own copy of the grpc.health.v1 Protobuf schema,
+// since renaming it would change the service's name on the wire. As a result,
+// programs can't link both this package and grpc-go's
+// google.golang.org/grpc/health/grpc_health_v1: the duplicate names make the
+// Protobuf runtime panic during initialization. Programs that need both must
+// set the GOLANG_PROTOBUF_REGISTRATION_CONFLICT environment variable to
+// "warn", in which case the first copy registered wins.
+package connecthealth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	healthv1 "github.com/bufbuild/connect-go/internal/gen/connectext/grpc/health/v1"
+	"github.com/bufbuild/connect-go/internal/gen/connectext/grpc/health/v1/healthv1connect"
+)
+
+// ServiceName is the fully-qualified name of the health service.
+const ServiceName = healthv1connect.HealthName
+
+// watchPollInterval is how often Watch re-checks the status of services whose
+// checkers don't implement [Notifier].
+const watchPollInterval = 5 * time.Second
+
+// Status is the serving status of a service.
+type Status uint8
+
+const (
+	// StatusUnknown indicates that the service's status isn't known yet.
+	StatusUnknown Status = 0
+	// StatusServing indicates that the service is ready to accept requests.
+	StatusServing Status = 1
+	// StatusNotServing indicates that the service can't accept requests, for
+	// example because it's shutting down or a dependency is unavailable.
+	StatusNotServing Status = 2
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusUnknown:
+		return "unknown"
+	case StatusServing:
+		return "serving"
+	case StatusNotServing:
+		return "not_serving"
+	}
+	return fmt.Sprintf("status_%d", s)
+}
+
+// CheckRequest asks for the status of a service. An empty service name asks
+// about the server as a whole.
+type CheckRequest struct {
+	Service string
+}
+
+// CheckResponse reports the status of a service.
+type CheckResponse struct {
+	Status Status
+}
+
+// Checker reports the health of a server's services. If the service isn't
+// known, Check should return an error with [connect.CodeNotFound]; Watch
+// reports such services as SERVICE_UNKNOWN until they become known.
+//
+// Checkers must be safe to call concurrently.
+type Checker interface {
+	Check(context.Context, *CheckRequest) (*CheckResponse, error)
+}
+
+// Notifier is an optional interface for checkers that can report status
+// changes, so that Watch can send them immediately. Watch polls other
+// checkers every few seconds.
+type Notifier interface {
+	Checker
+
+	// Changed returns a channel that's closed the next time any service's
+	// status may have changed.
+	Changed() <-chan struct{}
+}
+
+// NewHandler builds an HTTP handler for the health service, backed by the
+// supplied checker. Like generated service constructors, it returns the path
+// on which to mount the handler and the handler itself.
+func NewHandler(checker Checker, options ...connect.HandlerOption) (string, http.Handler) {
+	return healthv1connect.NewHealthHandler(&healthServer{checker: checker}, options...)
+}
+
+type healthServer struct {
+	healthv1connect.UnimplementedHealthHandler
+
+	checker Checker
+}
+
+func (s *healthServer) Check(
+	ctx context.Context,
+	request *connect.Request[healthv1.HealthCheckRequest],
+) (*connect.Response[healthv1.HealthCheckResponse], error) {
+	response, err := s.checker.Check(ctx, &CheckRequest{Service: request.Msg.Service})
+	if err != nil {
+		return nil, err
+	}
+	return connect.NewResponse(&healthv1.HealthCheckResponse{
+		Status: healthv1.HealthCheckResponse_ServingStatus(response.Status),
+	}), nil
+}
+
+func (s *healthServer) Watch(
+	ctx context.Context,
+	request *connect.Request[healthv1.HealthCheckRequest],
+	stream *connect.ServerStream[healthv1.HealthCheckResponse],
+) error {
+	notifier, _ := s.checker.(Notifier)
+	var ticker *time.Ticker
+	if notifier == nil {
+		ticker = time.NewTicker(watchPollInterval)
+		defer ticker.Stop()
+	}
+	var (
+		last    healthv1.HealthCheckResponse_ServingStatus
+		started bool
+	)
+	for {
+		var changed <-chan struct{}
+		if notifier != nil {
+			// Subscribe before checking, so changes made during the check
+			// aren't missed.
+			changed = notifier.Changed()
+		}
+		status, err := s.watchStatus(ctx, request.Msg.Service)
+		if err != nil {
+			return err
+		}
+		if !started || status != last {
+			if err := stream.Send(&healthv1.HealthCheckResponse{Status: status}); err != nil {
+				return err
+			}
+			started = true
+			last = status
+		}
+		var tick <-chan time.Time
+		if ticker != nil {
+			tick = ticker.C
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		case <-tick:
+		}
+	}
+}
+
+// watchStatus checks a service's status, reporting unknown services as
+// SERVICE_UNKNOWN rather than failing.
+func (s *healthServer) watchStatus(ctx context.Context, service string) (healthv1.HealthCheckResponse_ServingStatus, error) {
+	response, err := s.checker.Check(ctx, &CheckRequest{Service: service})
+	if connect.CodeOf(err) == connect.CodeNotFound {
+		return healthv1.HealthCheckResponse_SERVICE_UNKNOWN, nil
+	} else if err != nil {
+		return healthv1.HealthCheckResponse_UNKNOWN, err
+	}
+	return healthv1.HealthCheckResponse_ServingStatus(response.Status), nil
+}
+
+// StaticChecker is a [Checker] for a fixed set of services, whose statuses
+// are set explicitly. It's constructed with [NewStaticChecker], and it
+// implements [Notifier].
+type StaticChecker struct {
+	mu       sync.Mutex
+	statuses map[string]Status
+	changed  chan struct{}
+}
+
+// NewStaticChecker constructs a checker for the supplied fully-qualified
+// service names. The services and the server as a whole (the empty service
+// name) start out serving.
+func NewStaticChecker(services ...string) *StaticChecker {
+	statuses := make(map[string]Status, len(services)+1)
+	statuses[""] = StatusServing
+	for _, service := range services {
+		statuses[service] = StatusServing
+	}
+	return &StaticChecker{
+		statuses: statuses,
+		changed:  make(chan struct{}),
+	}
+}
+
+// SetStatus sets the status of a service, adding it if it's not already
+// known, and notifies any watchers.
+func (c *StaticChecker) SetStatus(service string, status Status) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if current, ok := c.statuses[service]; ok && current == status {
+		return
+	}
+	c.statuses[service] = status
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// Check implements [Checker].
+func (c *StaticChecker) Check(_ context.Context, request *CheckRequest) (*CheckResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status, ok := c.statuses[request.Service]
+	if !ok {
+		return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("unknown service %q", request.Service))
+	}
+	return &CheckResponse{Status: status}, nil
+}
+
+// Changed implements [Notifier].
+func (c *StaticChecker) Changed() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.changed
+}
@@ -0,0 +1,95 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connecthealth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/bufbuild/connect-go/connecthealth"
+	"github.com/bufbuild/connect-go/internal/assert"
+	healthv1 "github.com/bufbuild/connect-go/internal/gen/connectext/grpc/health/v1"
+	"github.com/bufbuild/connect-go/internal/gen/connectext/grpc/health/v1/healthv1connect"
+)
+
+func TestHandler(t *testing.T) {
+	t.Parallel()
+	const (
+		serviceName = "connect.ping.v1.PingService"
+		lateName    = "connect.ping.v1.LateService"
+	)
+	checker := connecthealth.NewStaticChecker(serviceName)
+	mux := http.NewServeMux()
+	mux.Handle(connecthealth.NewHandler(checker))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	for _, options := range [][]connect.ClientOption{nil, {connect.WithGRPC()}} {
+		client := healthv1connect.NewHealthClient(server.Client(), server.URL, options...)
+		check := func(service string) (healthv1.HealthCheckResponse_ServingStatus, error) {
+			t.Helper()
+			response, err := client.Check(context.Background(), connect.NewRequest(&healthv1.HealthCheckRequest{Service: service}))
+			if err != nil {
+				return 0, err
+			}
+			return response.Msg.Status, nil
+		}
+		status, err := check("")
+		assert.Nil(t, err)
+		assert.Equal(t, status, healthv1.HealthCheckResponse_SERVING)
+		status, err = check(serviceName)
+		assert.Nil(t, err)
+		assert.Equal(t, status, healthv1.HealthCheckResponse_SERVING)
+		_, err = check("connect.ping.v1.NoSuchService")
+		assert.Equal(t, connect.CodeOf(err), connect.CodeNotFound)
+	}
+
+	t.Run("watch", func(t *testing.T) {
+		client := healthv1connect.NewHealthClient(server.Client(), server.URL, connect.WithGRPC())
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		stream, err := client.Watch(ctx, connect.NewRequest(&healthv1.HealthCheckRequest{Service: serviceName}))
+		assert.Nil(t, err)
+		late, err := client.Watch(ctx, connect.NewRequest(&healthv1.HealthCheckRequest{Service: lateName}))
+		assert.Nil(t, err)
+		receive := func(stream *connect.ServerStreamForClient[healthv1.HealthCheckResponse]) healthv1.HealthCheckResponse_ServingStatus {
+			t.Helper()
+			assert.True(t, stream.Receive(), assert.Sprintf("receive: %v", stream.Err()))
+			return stream.Msg().Status
+		}
+		// Watchers get the current status immediately, and unknown services
+		// don't end the stream.
+		assert.Equal(t, receive(stream), healthv1.HealthCheckResponse_SERVING)
+		assert.Equal(t, receive(late), healthv1.HealthCheckResponse_SERVICE_UNKNOWN)
+
+		checker.SetStatus(serviceName, connecthealth.StatusNotServing)
+		assert.Equal(t, receive(stream), healthv1.HealthCheckResponse_NOT_SERVING)
+		checker.SetStatus(lateName, connecthealth.StatusServing)
+		assert.Equal(t, receive(late), healthv1.HealthCheckResponse_SERVING)
+		checker.SetStatus(serviceName, connecthealth.StatusServing)
+		assert.Equal(t, receive(stream), healthv1.HealthCheckResponse_SERVING)
+
+		cancel()
+		assert.False(t, stream.Receive())
+		assert.Equal(t, connect.CodeOf(stream.Err()), connect.CodeCanceled)
+		_ = stream.Close()
+		_ = late.Close()
+	})
+}
@@ -0,0 +1,403 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connectinterop
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	testpb "github.com/bufbuild/connect-go/internal/gen/connectext/grpc/testing"
+	"github.com/bufbuild/connect-go/internal/gen/connectext/grpc/testing/testingconnect"
+)
+
+// Sizes used by the standard test cases.
+const (
+	largeRequestSize  = 271828
+	largeResponseSize = 314159
+)
+
+var (
+	streamingRequestSizes  = []int32{27182, 8, 1828, 45904}
+	streamingResponseSizes = []int32{31415, 9, 2653, 58979}
+)
+
+// testCases are the test cases the client implements, in the order of the
+// interop test descriptions.
+var testCases = []struct {
+	name string
+	run  func(*Client, context.Context) error
+}{
+	{"empty_unary", (*Client).emptyUnary},
+	{"large_unary", (*Client).largeUnary},
+	{"client_streaming", (*Client).clientStreaming},
+	{"server_streaming", (*Client).serverStreaming},
+	{"ping_pong", (*Client).pingPong},
+	{"empty_stream", (*Client).emptyStream},
+	{"timeout_on_sleeping_server", (*Client).timeoutOnSleepingServer},
+	{"cancel_after_begin", (*Client).cancelAfterBegin},
+	{"cancel_after_first_response", (*Client).cancelAfterFirstResponse},
+	{"custom_metadata", (*Client).customMetadata},
+	{"status_code_and_message", (*Client).statusCodeAndMessage},
+	{"special_status_message", (*Client).specialStatusMessage},
+	{"unimplemented_method", (*Client).unimplementedMethod},
+	{"unimplemented_service", (*Client).unimplementedService},
+}
+
+// Client runs the interop test cases against a server that implements
+// grpc.testing.TestService.
+//
+// Clients are safe for concurrent use.
+type Client struct {
+	test          testingconnect.TestServiceClient
+	unimplemented testingconnect.UnimplementedServiceClient
+}
+
+// NewClient constructs an interop client for the server at baseURL.
+func NewClient(httpClient connect.HTTPClient, baseURL string, options ...connect.ClientOption) *Client {
+	return &Client{
+		test:          testingconnect.NewTestServiceClient(httpClient, baseURL, options...),
+		unimplemented: testingconnect.NewUnimplementedServiceClient(httpClient, baseURL, options...),
+	}
+}
+
+// TestCases returns the names of the test cases the client implements, using
+// the names from the interop test descriptions.
+func TestCases() []string {
+	names := make([]string, len(testCases))
+	for i, testCase := range testCases {
+		names[i] = testCase.name
+	}
+	return names
+}
+
+// Run runs the named test case. It returns an error describing the first
+// failed check, or an error with [connect.CodeNotFound] if the client doesn't
+// implement the test case.
+func (c *Client) Run(ctx context.Context, testCase string) error {
+	for _, candidate := range testCases {
+		if candidate.name != testCase {
+			continue
+		}
+		if err := candidate.run(c, ctx); err != nil {
+			return fmt.Errorf("%s: %w", testCase, err)
+		}
+		return nil
+	}
+	return connect.NewError(connect.CodeNotFound, fmt.Errorf("unknown interop test case %q", testCase))
+}
+
+// RunAll runs every test case in the order returned by [TestCases], stopping
+// at the first failure.
+func (c *Client) RunAll(ctx context.Context) error {
+	for _, testCase := range testCases {
+		if err := c.Run(ctx, testCase.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) emptyUnary(ctx context.Context) error {
+	_, err := c.test.EmptyCall(ctx, connect.NewRequest(&testpb.Empty{}))
+	return err
+}
+
+func (c *Client) largeUnary(ctx context.Context) error {
+	response, err := c.test.UnaryCall(ctx, connect.NewRequest(&testpb.SimpleRequest{
+		ResponseSize: largeResponseSize,
+		Payload:      newPayload(largeRequestSize),
+	}))
+	if err != nil {
+		return err
+	}
+	return checkPayload(response.Msg.Payload, largeResponseSize)
+}
+
+func (c *Client) clientStreaming(ctx context.Context) error {
+	stream := c.test.StreamingInputCall(ctx)
+	var total int32
+	for _, size := range streamingRequestSizes {
+		if err := stream.Send(&testpb.StreamingInputCallRequest{Payload: newPayload(size)}); err != nil {
+			return err
+		}
+		total += size
+	}
+	response, err := stream.CloseAndReceive()
+	if err != nil {
+		return err
+	}
+	if got := response.Msg.AggregatedPayloadSize; got != total {
+		return fmt.Errorf("got aggregated payload size %d, expected %d", got, total)
+	}
+	return nil
+}
+
+func (c *Client) serverStreaming(ctx context.Context) error {
+	request := &testpb.StreamingOutputCallRequest{}
+	for _, size := range streamingResponseSizes {
+		request.ResponseParameters = append(request.ResponseParameters, &testpb.ResponseParameters{Size: size})
+	}
+	stream, err := c.test.StreamingOutputCall(ctx, connect.NewRequest(request))
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	var received int
+	for ; stream.Receive(); received++ {
+		if received >= len(streamingResponseSizes) {
+			return fmt.Errorf("got more than %d responses", len(streamingResponseSizes))
+		}
+		if err := checkPayload(stream.Msg().Payload, streamingResponseSizes[received]); err != nil {
+			return err
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return err
+	}
+	if received != len(streamingResponseSizes) {
+		return fmt.Errorf("got %d responses, expected %d", received, len(streamingResponseSizes))
+	}
+	return nil
+}
+
+func (c *Client) pingPong(ctx context.Context) error {
+	stream := c.test.FullDuplexCall(ctx)
+	for i, size := range streamingRequestSizes {
+		if err := stream.Send(&testpb.StreamingOutputCallRequest{
+			ResponseParameters: []*testpb.ResponseParameters{{Size: streamingResponseSizes[i]}},
+			Payload:            newPayload(size),
+		}); err != nil {
+			return err
+		}
+		response, err := stream.Receive()
+		if err != nil {
+			return err
+		}
+		if err := checkPayload(response.Payload, streamingResponseSizes[i]); err != nil {
+			return err
+		}
+	}
+	if err := stream.CloseRequest(); err != nil {
+		return err
+	}
+	if err := expectEOF(stream); err != nil {
+		return err
+	}
+	return stream.CloseResponse()
+}
+
+func (c *Client) emptyStream(ctx context.Context) error {
+	stream := c.test.FullDuplexCall(ctx)
+	if err := stream.CloseRequest(); err != nil {
+		return err
+	}
+	if err := expectEOF(stream); err != nil {
+		return err
+	}
+	return stream.CloseResponse()
+}
+
+func (c *Client) timeoutOnSleepingServer(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+	stream := c.test.FullDuplexCall(ctx)
+	defer stream.CloseResponse()
+	// The server waits longer than the deadline before responding.
+	err := stream.Send(&testpb.StreamingOutputCallRequest{
+		ResponseParameters: []*testpb.ResponseParameters{{Size: 1, IntervalUs: int32(time.Second / time.Microsecond)}},
+		Payload:            newPayload(streamingRequestSizes[0]),
+	})
+	if err == nil || errors.Is(err, io.EOF) {
+		_, err = stream.Receive()
+	}
+	return expectCode(err, connect.CodeDeadlineExceeded)
+}
+
+func (c *Client) cancelAfterBegin(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	stream := c.test.StreamingInputCall(ctx)
+	cancel()
+	_, err := stream.CloseAndReceive()
+	return expectCode(err, connect.CodeCanceled)
+}
+
+func (c *Client) cancelAfterFirstResponse(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream := c.test.FullDuplexCall(ctx)
+	defer stream.CloseResponse()
+	if err := stream.Send(&testpb.StreamingOutputCallRequest{
+		ResponseParameters: []*testpb.ResponseParameters{{Size: streamingResponseSizes[0]}},
+		Payload:            newPayload(streamingRequestSizes[0]),
+	}); err != nil {
+		return err
+	}
+	if _, err := stream.Receive(); err != nil {
+		return err
+	}
+	cancel()
+	_, err := stream.Receive()
+	return expectCode(err, connect.CodeCanceled)
+}
+
+func (c *Client) customMetadata(ctx context.Context) error {
+	const initialValue = "test_initial_metadata_value"
+	trailingValue := connect.EncodeBinaryHeader([]byte{0xab, 0xab, 0xab})
+	check := func(header, trailer http.Header) error {
+		if got := header.Get(echoInitialHeader); got != initialValue {
+			return fmt.Errorf("got %s header %q, expected %q", echoInitialHeader, got, initialValue)
+		}
+		got, err := connect.DecodeBinaryHeader(trailer.Get(echoTrailingHeader))
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(got, []byte{0xab, 0xab, 0xab}) {
+			return fmt.Errorf("got %s trailer %x, expected ababab", echoTrailingHeader, got)
+		}
+		return nil
+	}
+
+	request := connect.NewRequest(&testpb.SimpleRequest{
+		ResponseSize: 1,
+		Payload:      newPayload(1),
+	})
+	request.Header().Set(echoInitialHeader, initialValue)
+	request.Header().Set(echoTrailingHeader, trailingValue)
+	response, err := c.test.UnaryCall(ctx, request)
+	if err != nil {
+		return err
+	}
+	if err := check(response.Header(), response.Trailer()); err != nil {
+		return fmt.Errorf("unary: %w", err)
+	}
+
+	stream := c.test.FullDuplexCall(ctx)
+	stream.RequestHeader().Set(echoInitialHeader, initialValue)
+	stream.RequestHeader().Set(echoTrailingHeader, trailingValue)
+	if err := stream.Send(&testpb.StreamingOutputCallRequest{
+		ResponseParameters: []*testpb.ResponseParameters{{Size: 1}},
+		Payload:            newPayload(1),
+	}); err != nil {
+		return err
+	}
+	if err := stream.CloseRequest(); err != nil {
+		return err
+	}
+	if _, err := stream.Receive(); err != nil {
+		return err
+	}
+	if err := expectEOF(stream); err != nil {
+		return err
+	}
+	if err := stream.CloseResponse(); err != nil {
+		return err
+	}
+	if err := check(stream.ResponseHeader(), stream.ResponseTrailer()); err != nil {
+		return fmt.Errorf("full duplex: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) statusCodeAndMessage(ctx context.Context) error {
+	return c.checkStatus(ctx, "test status message")
+}
+
+func (c *Client) specialStatusMessage(ctx context.Context) error {
+	return c.checkStatus(ctx, "\t\ntest with whitespace\r\nand Unicode BMP ☺ and non-BMP \U0001F608\t\n")
+}
+
+// checkStatus asks the server to fail unary and full duplex calls with
+// CodeUnknown and the message, and checks that both arrive intact.
+func (c *Client) checkStatus(ctx context.Context, message string) error {
+	status := &testpb.EchoStatus{Code: int32(connect.CodeUnknown), Message: message}
+	check := func(err error) error {
+		if err := expectCode(err, connect.CodeUnknown); err != nil {
+			return err
+		}
+		var connectErr *connect.Error
+		if !errors.As(err, &connectErr) || connectErr.Message() != message {
+			return fmt.Errorf("got error %q, expected message %q", err, message)
+		}
+		return nil
+	}
+
+	_, err := c.test.UnaryCall(ctx, connect.NewRequest(&testpb.SimpleRequest{ResponseStatus: status}))
+	if err := check(err); err != nil {
+		return fmt.Errorf("unary: %w", err)
+	}
+
+	stream := c.test.FullDuplexCall(ctx)
+	defer stream.CloseResponse()
+	if err := stream.Send(&testpb.StreamingOutputCallRequest{ResponseStatus: status}); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	if err := stream.CloseRequest(); err != nil {
+		return err
+	}
+	_, err = stream.Receive()
+	if err := check(err); err != nil {
+		return fmt.Errorf("full duplex: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) unimplementedMethod(ctx context.Context) error {
+	_, err := c.test.UnimplementedCall(ctx, connect.NewRequest(&testpb.Empty{}))
+	return expectCode(err, connect.CodeUnimplemented)
+}
+
+func (c *Client) unimplementedService(ctx context.Context) error {
+	_, err := c.unimplemented.UnimplementedCall(ctx, connect.NewRequest(&testpb.Empty{}))
+	return expectCode(err, connect.CodeUnimplemented)
+}
+
+func checkPayload(payload *testpb.Payload, size int32) error {
+	if got := len(payload.GetBody()); got != int(size) {
+		return fmt.Errorf("got payload of %d bytes, expected %d", got, size)
+	}
+	return nil
+}
+
+func expectCode(err error, code connect.Code) error {
+	if err == nil {
+		return fmt.Errorf("call succeeded, expected %v", code)
+	}
+	if got := connect.CodeOf(err); got != code {
+		return fmt.Errorf("got error %q with code %v, expected %v", err, got, code)
+	}
+	return nil
+}
+
+type receiver interface {
+	Receive() (*testpb.StreamingOutputCallResponse, error)
+}
+
+// expectEOF checks that the stream has no more responses.
+func expectEOF(stream receiver) error {
+	_, err := stream.Receive()
+	if err == nil {
+		return errors.New("got an unexpected response")
+	}
+	if !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
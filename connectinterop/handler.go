@@ -0,0 +1,240 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package connectinterop implements the gRPC interoperability test suite, so
+// that deployments can be validated against the official interop matrix. The
+// handlers implement grpc.testing.TestService the way the reference servers
+// do, and the client runs the standard test cases against any server that
+// implements it, whether it's built with connect-go, grpc-go, or another gRPC
+// implementation.
+//
+// Both support the Connect, gRPC, and gRPC-Web protocols. The bidirectional
+// streaming test cases require HTTP/2 end to end, so they're a good way to
+// check that proxies and load balancers in front of a server don't downgrade
+// connections.
+//
+// Like the reference implementations, the package registers the grpc.testing
+// Protobuf schemas under their upstream names, which the test service's name
+// on the wire depends on. It therefore can't be linked into the same program
+// as grpc-go's google.golang.org/grpc/interop/grpc_testing: the Protobuf
+// runtime panics during initialization when it sees the duplicate names,
+// unless the GOLANG_PROTOBUF_REGISTRATION_CONFLICT environment variable is set
+// to "warn".
+package connectinterop
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	testpb "github.com/bufbuild/connect-go/internal/gen/connectext/grpc/testing"
+	"github.com/bufbuild/connect-go/internal/gen/connectext/grpc/testing/testingconnect"
+)
+
+const (
+	// TestServiceName is the fully-qualified name of the interop test
+	// service.
+	TestServiceName = testingconnect.TestServiceName
+	// UnimplementedServiceName is the fully-qualified name of the service
+	// that interop servers deliberately don't implement.
+	UnimplementedServiceName = testingconnect.UnimplementedServiceName
+
+	// Requests with these headers ask the server to echo them back, in the
+	// response headers and trailers respectively.
+	echoInitialHeader  = "X-Grpc-Test-Echo-Initial"
+	echoTrailingHeader = "X-Grpc-Test-Echo-Trailing-Bin"
+)
+
+// NewHandler builds an HTTP handler for the interop test service. Like
+// generated service constructors, it returns the path on which to mount the
+// handler and the handler itself. UnimplementedCall fails with
+// [connect.CodeUnimplemented], as the test suite expects.
+func NewHandler(options ...connect.HandlerOption) (string, http.Handler) {
+	return testingconnect.NewTestServiceHandler(&testServer{}, options...)
+}
+
+type testServer struct {
+	testingconnect.UnimplementedTestServiceHandler
+}
+
+func (s *testServer) EmptyCall(
+	ctx context.Context,
+	request *connect.Request[testpb.Empty],
+) (*connect.Response[testpb.Empty], error) {
+	response := connect.NewResponse(&testpb.Empty{})
+	echoMetadata(request.Header(), response.Header(), response.Trailer())
+	return response, nil
+}
+
+func (s *testServer) UnaryCall(
+	ctx context.Context,
+	request *connect.Request[testpb.SimpleRequest],
+) (*connect.Response[testpb.SimpleResponse], error) {
+	if err := statusError(request.Msg.ResponseStatus); err != nil {
+		echoMetadata(request.Header(), err.Meta(), err.Meta())
+		return nil, err
+	}
+	response := connect.NewResponse(&testpb.SimpleResponse{
+		Payload: newPayload(request.Msg.ResponseSize),
+	})
+	echoMetadata(request.Header(), response.Header(), response.Trailer())
+	return response, nil
+}
+
+func (s *testServer) CacheableUnaryCall(
+	ctx context.Context,
+	request *connect.Request[testpb.SimpleRequest],
+) (*connect.Response[testpb.SimpleResponse], error) {
+	response, err := s.UnaryCall(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	response.Header().Set("Cache-Control", "max-age=60")
+	return response, nil
+}
+
+func (s *testServer) StreamingOutputCall(
+	ctx context.Context,
+	request *connect.Request[testpb.StreamingOutputCallRequest],
+	stream *connect.ServerStream[testpb.StreamingOutputCallResponse],
+) error {
+	echoMetadata(request.Header(), stream.ResponseHeader(), stream.ResponseTrailer())
+	if err := sendResponses(ctx, request.Msg, stream.Send); err != nil {
+		return err
+	}
+	if err := statusError(request.Msg.ResponseStatus); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *testServer) StreamingInputCall(
+	ctx context.Context,
+	stream *connect.ClientStream[testpb.StreamingInputCallRequest],
+) (*connect.Response[testpb.StreamingInputCallResponse], error) {
+	var size int
+	for stream.Receive() {
+		size += len(stream.Msg().GetPayload().GetBody())
+	}
+	if err := stream.Err(); err != nil {
+		return nil, err
+	}
+	response := connect.NewResponse(&testpb.StreamingInputCallResponse{
+		AggregatedPayloadSize: int32(size),
+	})
+	echoMetadata(stream.RequestHeader(), response.Header(), response.Trailer())
+	return response, nil
+}
+
+func (s *testServer) FullDuplexCall(
+	ctx context.Context,
+	stream *connect.BidiStream[testpb.StreamingOutputCallRequest, testpb.StreamingOutputCallResponse],
+) error {
+	echoMetadata(stream.RequestHeader(), stream.ResponseHeader(), stream.ResponseTrailer())
+	for {
+		request, err := stream.Receive()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := statusError(request.ResponseStatus); err != nil {
+			return err
+		}
+		if err := sendResponses(ctx, request, stream.Send); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *testServer) HalfDuplexCall(
+	ctx context.Context,
+	stream *connect.BidiStream[testpb.StreamingOutputCallRequest, testpb.StreamingOutputCallResponse],
+) error {
+	echoMetadata(stream.RequestHeader(), stream.ResponseHeader(), stream.ResponseTrailer())
+	var requests []*testpb.StreamingOutputCallRequest
+	for {
+		request, err := stream.Receive()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return err
+		}
+		requests = append(requests, request)
+	}
+	for _, request := range requests {
+		if err := statusError(request.ResponseStatus); err != nil {
+			return err
+		}
+		if err := sendResponses(ctx, request, stream.Send); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendResponses sends the responses described by the request's parameters,
+// waiting the requested interval before each one.
+func sendResponses(
+	ctx context.Context,
+	request *testpb.StreamingOutputCallRequest,
+	send func(*testpb.StreamingOutputCallResponse) error,
+) error {
+	for _, parameters := range request.ResponseParameters {
+		if interval := time.Duration(parameters.IntervalUs) * time.Microsecond; interval > 0 {
+			timer := time.NewTimer(interval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+		if err := send(&testpb.StreamingOutputCallResponse{Payload: newPayload(parameters.Size)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// statusError returns the error requested by the client, if any.
+func statusError(status *testpb.EchoStatus) *connect.Error {
+	if status.GetCode() == 0 {
+		return nil
+	}
+	return connect.NewError(connect.Code(status.Code), errors.New(status.Message))
+}
+
+// echoMetadata copies the echo headers from the request to the response.
+func echoMetadata(request, header, trailer http.Header) {
+	if value := request.Get(echoInitialHeader); value != "" {
+		header.Set(echoInitialHeader, value)
+	}
+	if value := request.Get(echoTrailingHeader); value != "" {
+		trailer.Set(echoTrailingHeader, value)
+	}
+}
+
+func newPayload(size int32) *testpb.Payload {
+	if size < 0 {
+		size = 0
+	}
+	return &testpb.Payload{
+		Type: testpb.PayloadType_COMPRESSABLE,
+		Body: make([]byte, size),
+	}
+}
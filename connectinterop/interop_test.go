@@ -0,0 +1,60 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connectinterop_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/bufbuild/connect-go/connectinterop"
+	"github.com/bufbuild/connect-go/internal/assert"
+)
+
+func TestInterop(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(connectinterop.NewHandler())
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	for _, protocol := range []struct {
+		name    string
+		options []connect.ClientOption
+	}{
+		{name: "connect"},
+		{name: "grpc", options: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpcweb", options: []connect.ClientOption{connect.WithGRPCWeb()}},
+	} {
+		protocol := protocol
+		t.Run(protocol.name, func(t *testing.T) {
+			t.Parallel()
+			client := connectinterop.NewClient(server.Client(), server.URL, protocol.options...)
+			for _, testCase := range connectinterop.TestCases() {
+				testCase := testCase
+				t.Run(testCase, func(t *testing.T) {
+					t.Parallel()
+					assert.Nil(t, client.Run(context.Background(), testCase))
+				})
+			}
+			err := client.Run(context.Background(), "no_such_case")
+			assert.Equal(t, connect.CodeOf(err), connect.CodeNotFound)
+		})
+	}
+}
@@ -0,0 +1,267 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package connectreflect provides a client and handlers for the gRPC server
+// reflection API, which exposes a server's protobuf descriptors at runtime.
+// It's useful for dynamic clients and command-line tools that call services
+// without generated code.
+//
+// The handlers serve descriptors from the global protobuf registries, so
+// tools like grpcurl, buf curl, and Postman can introspect Connect servers.
+// The client works with any server that supports reflection, whether it's
+// built with connect-go, grpc-go, or another gRPC implementation. Since most
+// of those servers only support the gRPC protocol, use [connect.WithGRPC]
+// when constructing the client.
+//
+// The package registers its own copy of the grpc.reflection.v1alpha Protobuf
+// schema, since renaming it would change the service's name on the wire. As a
+// result, programs can't link both this package and grpc-go's
+// google.golang.org/grpc/reflection/grpc_reflection_v1alpha, which
+// google.golang.org/grpc/reflection imports: the duplicate names make the
+// Protobuf runtime panic during initialization. Programs that need both must
+// set the GOLANG_PROTOBUF_REGISTRATION_CONFLICT environment variable to
+// "warn", in which case the first copy registered wins.
+package connectreflect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+
+	"github.com/bufbuild/connect-go"
+	reflectionv1alpha "github.com/bufbuild/connect-go/internal/gen/connectext/grpc/reflection/v1alpha"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+const (
+	// ServiceNameV1 is the name of the current version of the reflection
+	// service.
+	ServiceNameV1 = "grpc.reflection.v1.ServerReflection"
+	// ServiceNameV1Alpha is the name of the original, pre-release version of
+	// the reflection service. Many servers only support this version.
+	ServiceNameV1Alpha = "grpc.reflection.v1alpha.ServerReflection"
+
+	methodName = "/ServerReflectionInfo"
+)
+
+type reflectionClient = connect.Client[reflectionv1alpha.ServerReflectionRequest, reflectionv1alpha.ServerReflectionResponse]
+
+// Client fetches descriptors from a server that supports gRPC server
+// reflection. It uses grpc.reflection.v1 by default, and falls back to
+// grpc.reflection.v1alpha if the server doesn't support the newer version.
+// The two versions are identical on the wire.
+//
+// Clients are safe for concurrent use. Each method opens its own reflection
+// stream.
+type Client struct {
+	v1      *reflectionClient
+	v1alpha *reflectionClient
+	alpha   uint32 // atomic: set once the server is known not to support v1
+}
+
+// NewClient constructs a reflection client for the server at baseURL, which
+// should be the same base URL used for the server's other services.
+func NewClient(httpClient connect.HTTPClient, baseURL string, options ...connect.ClientOption) *Client {
+	baseURL = strings.TrimRight(baseURL, "/")
+	return &Client{
+		v1: connect.NewClient[reflectionv1alpha.ServerReflectionRequest, reflectionv1alpha.ServerReflectionResponse](
+			httpClient,
+			baseURL+"/"+ServiceNameV1+methodName,
+			options...,
+		),
+		v1alpha: connect.NewClient[reflectionv1alpha.ServerReflectionRequest, reflectionv1alpha.ServerReflectionResponse](
+			httpClient,
+			baseURL+"/"+ServiceNameV1Alpha+methodName,
+			options...,
+		),
+	}
+}
+
+// ListServices returns the fully-qualified names of the services exposed by
+// the server.
+func (c *Client) ListServices(ctx context.Context) ([]string, error) {
+	var names []string
+	err := c.call(ctx, func(stream *stream) error {
+		response, err := stream.send(&reflectionv1alpha.ServerReflectionRequest{
+			MessageRequest: &reflectionv1alpha.ServerReflectionRequest_ListServices{},
+		})
+		if err != nil {
+			return err
+		}
+		list := response.GetListServicesResponse()
+		if list == nil {
+			return errUnexpectedResponse(response)
+		}
+		for _, service := range list.Service {
+			names = append(names, service.Name)
+		}
+		return nil
+	})
+	return names, err
+}
+
+// Files fetches the files declaring the supplied fully-qualified symbols
+// (typically service names), along with all their transitive dependencies,
+// and returns them as a registry. If no symbols are supplied, Files fetches
+// the files for every service listed by the server.
+//
+// Dependencies the server doesn't know about are taken from
+// [protoregistry.GlobalFiles] if possible, since some servers omit
+// well-known types.
+func (c *Client) Files(ctx context.Context, symbols ...string) (*protoregistry.Files, error) {
+	if len(symbols) == 0 {
+		services, err := c.ListServices(ctx)
+		if err != nil {
+			return nil, err
+		}
+		symbols = services
+	}
+	files := make(map[string]*descriptorpb.FileDescriptorProto)
+	var order []string
+	add := func(response *reflectionv1alpha.ServerReflectionResponse) error {
+		descriptors := response.GetFileDescriptorResponse()
+		if descriptors == nil {
+			return errUnexpectedResponse(response)
+		}
+		for _, raw := range descriptors.FileDescriptorProto {
+			file := &descriptorpb.FileDescriptorProto{}
+			if err := proto.Unmarshal(raw, file); err != nil {
+				return connect.NewError(connect.CodeInternal, fmt.Errorf("unmarshal file descriptor: %w", err))
+			}
+			if _, ok := files[file.GetName()]; !ok {
+				files[file.GetName()] = file
+				order = append(order, file.GetName())
+			}
+		}
+		return nil
+	}
+	err := c.call(ctx, func(stream *stream) error {
+		for _, symbol := range symbols {
+			response, err := stream.send(&reflectionv1alpha.ServerReflectionRequest{
+				MessageRequest: &reflectionv1alpha.ServerReflectionRequest_FileContainingSymbol{
+					FileContainingSymbol: symbol,
+				},
+			})
+			if err != nil {
+				return err
+			}
+			if err := add(response); err != nil {
+				return err
+			}
+		}
+		// Servers may omit files they've already sent on this stream, or
+		// (incorrectly) omit dependencies altogether, so fetch anything that's
+		// still missing by name.
+		for i := 0; i < len(order); i++ {
+			for _, dependency := range files[order[i]].Dependency {
+				if _, ok := files[dependency]; ok {
+					continue
+				}
+				response, err := stream.send(&reflectionv1alpha.ServerReflectionRequest{
+					MessageRequest: &reflectionv1alpha.ServerReflectionRequest_FileByFilename{
+						FileByFilename: dependency,
+					},
+				})
+				if err != nil {
+					global, globalErr := protoregistry.GlobalFiles.FindFileByPath(dependency)
+					if globalErr != nil || connect.CodeOf(err) != connect.CodeNotFound {
+						return err
+					}
+					files[dependency] = protodesc.ToFileDescriptorProto(global)
+					order = append(order, dependency)
+					continue
+				}
+				if err := add(response); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	set := &descriptorpb.FileDescriptorSet{File: make([]*descriptorpb.FileDescriptorProto, 0, len(order))}
+	for _, name := range order {
+		set.File = append(set.File, files[name])
+	}
+	registry, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("build registry: %w", err))
+	}
+	return registry, nil
+}
+
+// call runs a function with a reflection stream, falling back to v1alpha if
+// the server doesn't support v1.
+func (c *Client) call(ctx context.Context, f func(*stream) error) error {
+	if atomic.LoadUint32(&c.alpha) == 0 {
+		err := c.callWith(ctx, c.v1, f)
+		if connect.CodeOf(err) != connect.CodeUnimplemented {
+			return err
+		}
+		atomic.StoreUint32(&c.alpha, 1)
+	}
+	return c.callWith(ctx, c.v1alpha, f)
+}
+
+func (c *Client) callWith(ctx context.Context, client *reflectionClient, f func(*stream) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	bidi := client.CallBidiStream(ctx)
+	err := f(&stream{bidi: bidi})
+	_ = bidi.CloseRequest()
+	_ = bidi.CloseResponse()
+	return err
+}
+
+type stream struct {
+	bidi *connect.BidiStreamForClient[reflectionv1alpha.ServerReflectionRequest, reflectionv1alpha.ServerReflectionResponse]
+}
+
+// send makes a single reflection request and waits for the response,
+// converting error responses to Go errors.
+func (s *stream) send(request *reflectionv1alpha.ServerReflectionRequest) (*reflectionv1alpha.ServerReflectionResponse, error) {
+	if err := s.bidi.Send(request); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	// If Send returned io.EOF, the server has already closed the stream and
+	// Receive returns the server's error.
+	response, err := s.bidi.Receive()
+	if errors.Is(err, io.EOF) {
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("reflection stream ended: %w", io.ErrUnexpectedEOF))
+	} else if err != nil {
+		return nil, err
+	}
+	if errResponse := response.GetErrorResponse(); errResponse != nil {
+		return nil, connect.NewError(
+			connect.Code(errResponse.ErrorCode),
+			errors.New(errResponse.ErrorMessage),
+		)
+	}
+	return response, nil
+}
+
+func errUnexpectedResponse(response *reflectionv1alpha.ServerReflectionResponse) error {
+	return connect.NewError(
+		connect.CodeInternal,
+		fmt.Errorf("unexpected reflection response type %T", response.MessageResponse),
+	)
+}
@@ -0,0 +1,142 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connectreflect_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/bufbuild/connect-go/connectreflect"
+	"github.com/bufbuild/connect-go/internal/assert"
+	"github.com/bufbuild/connect-go/internal/gen/connect/ping/v1/pingv1connect"
+	reflectionv1alpha "github.com/bufbuild/connect-go/internal/gen/connectext/grpc/reflection/v1alpha"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+func TestClient(t *testing.T) {
+	t.Parallel()
+	newServer := func(t *testing.T, serviceName string) *httptest.Server {
+		t.Helper()
+		procedure := "/" + serviceName + "/ServerReflectionInfo"
+		mux := http.NewServeMux()
+		mux.Handle(procedure, connect.NewBidiStreamHandler(procedure, serveReflection))
+		server := httptest.NewUnstartedServer(mux)
+		server.EnableHTTP2 = true
+		server.StartTLS()
+		t.Cleanup(server.Close)
+		return server
+	}
+	for _, serviceName := range []string{connectreflect.ServiceNameV1, connectreflect.ServiceNameV1Alpha} {
+		serviceName := serviceName
+		t.Run(serviceName, func(t *testing.T) {
+			t.Parallel()
+			server := newServer(t, serviceName)
+			client := connectreflect.NewClient(server.Client(), server.URL, connect.WithGRPC())
+			services, err := client.ListServices(context.Background())
+			assert.Nil(t, err)
+			assert.Equal(t, services, []string{pingv1connect.PingServiceName})
+
+			files, err := client.Files(context.Background())
+			assert.Nil(t, err)
+			descriptor, err := files.FindDescriptorByName("connect.ping.v1.PingService")
+			assert.Nil(t, err)
+			service, ok := descriptor.(protoreflect.ServiceDescriptor)
+			assert.True(t, ok)
+			assert.NotNil(t, service.Methods().ByName("Ping"))
+
+			// The gRPC status file (registered by connect) depends on
+			// google/protobuf/any.proto.
+			files, err = client.Files(context.Background(), "grpc.status.v1.Status")
+			assert.Nil(t, err)
+			_, err = files.FindDescriptorByName("google.protobuf.Any")
+			assert.Nil(t, err)
+
+			_, err = client.Files(context.Background(), "connect.ping.v1.NoSuchService")
+			assert.Equal(t, connect.CodeOf(err), connect.CodeNotFound)
+		})
+	}
+	t.Run("unsupported", func(t *testing.T) {
+		t.Parallel()
+		server := newServer(t, "grpc.reflection.v2.ServerReflection")
+		client := connectreflect.NewClient(server.Client(), server.URL, connect.WithGRPC())
+		_, err := client.ListServices(context.Background())
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnimplemented)
+	})
+}
+
+// serveReflection is a minimal reflection service backed by the global
+// registry, exposing only the ping service.
+func serveReflection(
+	_ context.Context,
+	stream *connect.BidiStream[reflectionv1alpha.ServerReflectionRequest, reflectionv1alpha.ServerReflectionResponse],
+) error {
+	for {
+		request, err := stream.Receive()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		response := &reflectionv1alpha.ServerReflectionResponse{
+			ValidHost:       request.Host,
+			OriginalRequest: request,
+		}
+		var file protoreflect.FileDescriptor
+		switch req := request.MessageRequest.(type) {
+		case *reflectionv1alpha.ServerReflectionRequest_ListServices:
+			response.MessageResponse = &reflectionv1alpha.ServerReflectionResponse_ListServicesResponse{
+				ListServicesResponse: &reflectionv1alpha.ListServiceResponse{
+					Service: []*reflectionv1alpha.ServiceResponse{{Name: pingv1connect.PingServiceName}},
+				},
+			}
+		case *reflectionv1alpha.ServerReflectionRequest_FileContainingSymbol:
+			if descriptor, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(req.FileContainingSymbol)); err == nil {
+				file = descriptor.ParentFile()
+			}
+		case *reflectionv1alpha.ServerReflectionRequest_FileByFilename:
+			file, _ = protoregistry.GlobalFiles.FindFileByPath(req.FileByFilename)
+		}
+		if response.MessageResponse == nil && file != nil {
+			raw, err := proto.Marshal(protodesc.ToFileDescriptorProto(file))
+			if err != nil {
+				return err
+			}
+			// Deliberately omit dependencies, which the client must fetch.
+			response.MessageResponse = &reflectionv1alpha.ServerReflectionResponse_FileDescriptorResponse{
+				FileDescriptorResponse: &reflectionv1alpha.FileDescriptorResponse{
+					FileDescriptorProto: [][]byte{raw},
+				},
+			}
+		} else if response.MessageResponse == nil {
+			response.MessageResponse = &reflectionv1alpha.ServerReflectionResponse_ErrorResponse{
+				ErrorResponse: &reflectionv1alpha.ErrorResponse{
+					ErrorCode:    int32(connect.CodeNotFound),
+					ErrorMessage: "not found",
+				},
+			}
+		}
+		if err := stream.Send(response); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connectreflect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+
+	"github.com/bufbuild/connect-go"
+	reflectionv1alpha "github.com/bufbuild/connect-go/internal/gen/connectext/grpc/reflection/v1alpha"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// NewHandlerV1 builds an HTTP handler for the grpc.reflection.v1 reflection
+// service, which lets tools like grpcurl, buf curl, and Postman introspect
+// the server. Like generated service constructors, it returns the path on
+// which to mount the handler and the handler itself.
+//
+// The handler lists the supplied fully-qualified service names, and serves
+// descriptors from [protoregistry.GlobalFiles] and [protoregistry.GlobalTypes].
+// Generated code registers its files there automatically. Most tools still
+// use the older v1alpha service, so servers usually mount both:
+//
+//	services := []string{pingv1connect.PingServiceName}
+//	mux.Handle(connectreflect.NewHandlerV1(services))
+//	mux.Handle(connectreflect.NewHandlerV1Alpha(services))
+func NewHandlerV1(services []string, options ...connect.HandlerOption) (string, http.Handler) {
+	return newHandler(ServiceNameV1, services, options)
+}
+
+// NewHandlerV1Alpha builds an HTTP handler for the grpc.reflection.v1alpha
+// reflection service. Apart from the service name, it's identical to
+// [NewHandlerV1].
+func NewHandlerV1Alpha(services []string, options ...connect.HandlerOption) (string, http.Handler) {
+	return newHandler(ServiceNameV1Alpha, services, options)
+}
+
+func newHandler(serviceName string, services []string, options []connect.HandlerOption) (string, http.Handler) {
+	names := make([]string, len(services))
+	copy(names, services)
+	sort.Strings(names)
+	reflector := &reflector{
+		services: names,
+		files:    protoregistry.GlobalFiles,
+		types:    protoregistry.GlobalTypes,
+	}
+	procedure := "/" + serviceName + methodName
+	return procedure, connect.NewBidiStreamHandler(procedure, reflector.serve, options...)
+}
+
+// reflector answers reflection requests from a file and type registry.
+type reflector struct {
+	services []string
+	files    *protoregistry.Files
+	types    *protoregistry.Types
+}
+
+func (r *reflector) serve(
+	_ context.Context,
+	stream *connect.BidiStream[reflectionv1alpha.ServerReflectionRequest, reflectionv1alpha.ServerReflectionResponse],
+) error {
+	// Like grpc-go, send each dependency at most once per stream: clients
+	// cache the files they've already received.
+	sent := make(map[string]struct{})
+	for {
+		request, err := stream.Receive()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		response := &reflectionv1alpha.ServerReflectionResponse{
+			ValidHost:       request.Host,
+			OriginalRequest: request,
+		}
+		if err := r.answer(request, response, sent); err != nil {
+			response.MessageResponse = &reflectionv1alpha.ServerReflectionResponse_ErrorResponse{
+				ErrorResponse: &reflectionv1alpha.ErrorResponse{
+					ErrorCode:    int32(connect.CodeOf(err)),
+					ErrorMessage: errorMessage(err),
+				},
+			}
+		}
+		if err := stream.Send(response); err != nil {
+			return err
+		}
+	}
+}
+
+// answer fills in the response to a single reflection request. Errors are
+// reported to the client in the response rather than ending the stream.
+func (r *reflector) answer(
+	request *reflectionv1alpha.ServerReflectionRequest,
+	response *reflectionv1alpha.ServerReflectionResponse,
+	sent map[string]struct{},
+) error {
+	switch req := request.MessageRequest.(type) {
+	case *reflectionv1alpha.ServerReflectionRequest_ListServices:
+		list := &reflectionv1alpha.ListServiceResponse{
+			Service: make([]*reflectionv1alpha.ServiceResponse, 0, len(r.services)),
+		}
+		for _, name := range r.services {
+			list.Service = append(list.Service, &reflectionv1alpha.ServiceResponse{Name: name})
+		}
+		response.MessageResponse = &reflectionv1alpha.ServerReflectionResponse_ListServicesResponse{
+			ListServicesResponse: list,
+		}
+		return nil
+	case *reflectionv1alpha.ServerReflectionRequest_FileByFilename:
+		file, err := r.files.FindFileByPath(req.FileByFilename)
+		if err != nil {
+			return connect.NewError(connect.CodeNotFound, fmt.Errorf("file %q: %w", req.FileByFilename, err))
+		}
+		return fileResponse(response, file, sent)
+	case *reflectionv1alpha.ServerReflectionRequest_FileContainingSymbol:
+		descriptor, err := r.files.FindDescriptorByName(protoreflect.FullName(req.FileContainingSymbol))
+		if err != nil {
+			return connect.NewError(connect.CodeNotFound, fmt.Errorf("symbol %q: %w", req.FileContainingSymbol, err))
+		}
+		return fileResponse(response, descriptor.ParentFile(), sent)
+	case *reflectionv1alpha.ServerReflectionRequest_FileContainingExtension:
+		extension, err := r.types.FindExtensionByNumber(
+			protoreflect.FullName(req.FileContainingExtension.GetContainingType()),
+			protoreflect.FieldNumber(req.FileContainingExtension.GetExtensionNumber()),
+		)
+		if err != nil {
+			return connect.NewError(connect.CodeNotFound, fmt.Errorf(
+				"extension %d of %q: %w",
+				req.FileContainingExtension.GetExtensionNumber(),
+				req.FileContainingExtension.GetContainingType(),
+				err,
+			))
+		}
+		return fileResponse(response, extension.TypeDescriptor().ParentFile(), sent)
+	case *reflectionv1alpha.ServerReflectionRequest_AllExtensionNumbersOfType:
+		name := protoreflect.FullName(req.AllExtensionNumbersOfType)
+		if descriptor, err := r.files.FindDescriptorByName(name); err != nil {
+			return connect.NewError(connect.CodeNotFound, fmt.Errorf("message %q: %w", name, err))
+		} else if _, ok := descriptor.(protoreflect.MessageDescriptor); !ok {
+			return connect.NewError(connect.CodeNotFound, fmt.Errorf("%q is not a message", name))
+		}
+		var numbers []int32
+		r.types.RangeExtensionsByMessage(name, func(extension protoreflect.ExtensionType) bool {
+			numbers = append(numbers, int32(extension.TypeDescriptor().Number()))
+			return true
+		})
+		sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+		response.MessageResponse = &reflectionv1alpha.ServerReflectionResponse_AllExtensionNumbersResponse{
+			AllExtensionNumbersResponse: &reflectionv1alpha.ExtensionNumberResponse{
+				BaseTypeName:    string(name),
+				ExtensionNumber: numbers,
+			},
+		}
+		return nil
+	default:
+		return connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("unsupported reflection request type %T", req))
+	}
+}
+
+// fileResponse answers with the file and any of its transitive dependencies
+// that haven't already been sent on the stream. The requested file is always
+// included.
+func fileResponse(
+	response *reflectionv1alpha.ServerReflectionResponse,
+	file protoreflect.FileDescriptor,
+	sent map[string]struct{},
+) error {
+	var raw [][]byte
+	var add func(protoreflect.FileDescriptor, bool) error
+	add = func(file protoreflect.FileDescriptor, force bool) error {
+		if _, ok := sent[file.Path()]; ok && !force {
+			return nil
+		}
+		sent[file.Path()] = struct{}{}
+		encoded, err := proto.Marshal(protodesc.ToFileDescriptorProto(file))
+		if err != nil {
+			return connect.NewError(connect.CodeInternal, fmt.Errorf("marshal file descriptor %q: %w", file.Path(), err))
+		}
+		raw = append(raw, encoded)
+		imports := file.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			dependency := imports.Get(i).FileDescriptor
+			if dependency.IsPlaceholder() {
+				// The dependency isn't registered, so the client will have to
+				// find it elsewhere.
+				continue
+			}
+			if err := add(dependency, false); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := add(file, true); err != nil {
+		return err
+	}
+	response.MessageResponse = &reflectionv1alpha.ServerReflectionResponse_FileDescriptorResponse{
+		FileDescriptorResponse: &reflectionv1alpha.FileDescriptorResponse{
+			FileDescriptorProto: raw,
+		},
+	}
+	return nil
+}
+
+func errorMessage(err error) string {
+	if connectErr := new(connect.Error); errors.As(err, &connectErr) {
+		return connectErr.Message()
+	}
+	return err.Error()
+}
@@ -0,0 +1,146 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connectreflect_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/bufbuild/connect-go/connectreflect"
+	"github.com/bufbuild/connect-go/internal/assert"
+	"github.com/bufbuild/connect-go/internal/gen/connect/ping/v1/pingv1connect"
+	reflectionv1alpha "github.com/bufbuild/connect-go/internal/gen/connectext/grpc/reflection/v1alpha"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestHandler(t *testing.T) {
+	t.Parallel()
+	services := []string{connectreflect.ServiceNameV1Alpha, pingv1connect.PingServiceName}
+	mux := http.NewServeMux()
+	mux.Handle(connectreflect.NewHandlerV1(services))
+	mux.Handle(connectreflect.NewHandlerV1Alpha(services))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	t.Run("client", func(t *testing.T) {
+		t.Parallel()
+		for _, options := range [][]connect.ClientOption{nil, {connect.WithGRPC()}} {
+			client := connectreflect.NewClient(server.Client(), server.URL, options...)
+			names, err := client.ListServices(context.Background())
+			assert.Nil(t, err)
+			assert.Equal(t, names, []string{pingv1connect.PingServiceName, connectreflect.ServiceNameV1Alpha})
+
+			files, err := client.Files(context.Background(), pingv1connect.PingServiceName)
+			assert.Nil(t, err)
+			descriptor, err := files.FindDescriptorByName("connect.ping.v1.PingService")
+			assert.Nil(t, err)
+			service, ok := descriptor.(protoreflect.ServiceDescriptor)
+			assert.True(t, ok)
+			assert.NotNil(t, service.Methods().ByName("CumSum"))
+
+			_, err = client.Files(context.Background(), "connect.ping.v1.NoSuchService")
+			assert.Equal(t, connect.CodeOf(err), connect.CodeNotFound)
+		}
+	})
+	t.Run("stream", func(t *testing.T) {
+		t.Parallel()
+		for _, serviceName := range []string{connectreflect.ServiceNameV1, connectreflect.ServiceNameV1Alpha} {
+			client := connect.NewClient[reflectionv1alpha.ServerReflectionRequest, reflectionv1alpha.ServerReflectionResponse](
+				server.Client(),
+				server.URL+"/"+serviceName+"/ServerReflectionInfo",
+				connect.WithGRPC(),
+			)
+			stream := client.CallBidiStream(context.Background())
+			send := func(request *reflectionv1alpha.ServerReflectionRequest) *reflectionv1alpha.ServerReflectionResponse {
+				t.Helper()
+				request.Host = "example.com"
+				assert.Nil(t, stream.Send(request))
+				response, err := stream.Receive()
+				assert.Nil(t, err)
+				assert.Equal(t, response.ValidHost, "example.com")
+				assert.True(t, proto.Equal(response.OriginalRequest, request))
+				return response
+			}
+			fileNames := func(response *reflectionv1alpha.ServerReflectionResponse) []string {
+				t.Helper()
+				var names []string
+				for _, raw := range response.GetFileDescriptorResponse().GetFileDescriptorProto() {
+					file := &descriptorpb.FileDescriptorProto{}
+					assert.Nil(t, proto.Unmarshal(raw, file))
+					names = append(names, file.GetName())
+				}
+				return names
+			}
+
+			// The status file depends on any.proto, which is only sent once per
+			// stream.
+			response := send(&reflectionv1alpha.ServerReflectionRequest{
+				MessageRequest: &reflectionv1alpha.ServerReflectionRequest_FileContainingSymbol{
+					FileContainingSymbol: "grpc.status.v1.Status",
+				},
+			})
+			names := fileNames(response)
+			assert.Equal(t, len(names), 2)
+			assert.Equal(t, names[1], "google/protobuf/any.proto")
+			response = send(&reflectionv1alpha.ServerReflectionRequest{
+				MessageRequest: &reflectionv1alpha.ServerReflectionRequest_FileByFilename{
+					FileByFilename: names[0],
+				},
+			})
+			assert.Equal(t, fileNames(response), names[:1])
+
+			response = send(&reflectionv1alpha.ServerReflectionRequest{
+				MessageRequest: &reflectionv1alpha.ServerReflectionRequest_AllExtensionNumbersOfType{
+					AllExtensionNumbersOfType: "connect.ping.v1.PingRequest",
+				},
+			})
+			assert.Equal(t, response.GetAllExtensionNumbersResponse().GetBaseTypeName(), "connect.ping.v1.PingRequest")
+			assert.Zero(t, len(response.GetAllExtensionNumbersResponse().GetExtensionNumber()))
+
+			// Errors are reported in responses, and the stream stays open.
+			response = send(&reflectionv1alpha.ServerReflectionRequest{
+				MessageRequest: &reflectionv1alpha.ServerReflectionRequest_FileContainingExtension{
+					FileContainingExtension: &reflectionv1alpha.ExtensionRequest{
+						ContainingType:  "connect.ping.v1.PingRequest",
+						ExtensionNumber: 100,
+					},
+				},
+			})
+			assert.Equal(t, connect.Code(response.GetErrorResponse().GetErrorCode()), connect.CodeNotFound)
+			response = send(&reflectionv1alpha.ServerReflectionRequest{
+				MessageRequest: &reflectionv1alpha.ServerReflectionRequest_AllExtensionNumbersOfType{
+					AllExtensionNumbersOfType: "connect.ping.v1.PingService",
+				},
+			})
+			assert.Equal(t, connect.Code(response.GetErrorResponse().GetErrorCode()), connect.CodeNotFound)
+			response = send(&reflectionv1alpha.ServerReflectionRequest{})
+			assert.Equal(t, connect.Code(response.GetErrorResponse().GetErrorCode()), connect.CodeInvalidArgument)
+			response = send(&reflectionv1alpha.ServerReflectionRequest{
+				MessageRequest: &reflectionv1alpha.ServerReflectionRequest_ListServices{},
+			})
+			assert.Equal(t, len(response.GetListServicesResponse().GetService()), 2)
+
+			assert.Nil(t, stream.CloseRequest())
+			assert.Nil(t, stream.CloseResponse())
+		}
+	})
+}
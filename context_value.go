@@ -0,0 +1,74 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+)
+
+// A ContextValue is a typed key for passing values through a
+// [context.Context], as interceptors often do. Each key constructed with
+// [NewContextValue] is distinct, even if it shares a name with another key, so
+// values set by different packages never collide. For example:
+//
+//	var tenantID = connect.NewContextValue[string]("tenant ID")
+//
+//	func (i *tenantInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+//	  return func(ctx context.Context, request connect.AnyRequest) (connect.AnyResponse, error) {
+//	    return next(tenantID.With(ctx, request.Header().Get("Tenant-Id")), request)
+//	  }
+//	}
+//
+//	func handle(ctx context.Context) {
+//	  if tenant, ok := tenantID.From(ctx); ok {
+//	    // ...
+//	  }
+//	}
+//
+// The zero value isn't a usable key.
+type ContextValue[T any] struct {
+	key *contextValueKey
+}
+
+// contextValueKey is the key actually stored in contexts: pointers are
+// comparable and unique to each call to NewContextValue.
+type contextValueKey struct {
+	name string
+}
+
+// NewContextValue constructs a new key. The name is only used for debugging.
+func NewContextValue[T any](name string) ContextValue[T] {
+	return ContextValue[T]{key: &contextValueKey{name: name}}
+}
+
+// With returns a copy of the context that carries the value.
+func (v ContextValue[T]) With(ctx context.Context, value T) context.Context {
+	return context.WithValue(ctx, v.key, value)
+}
+
+// From retrieves the value from the context. It reports false if the context
+// doesn't carry a value for the key.
+func (v ContextValue[T]) From(ctx context.Context) (T, bool) {
+	value, ok := ctx.Value(v.key).(T)
+	return value, ok
+}
+
+// String returns the key's name.
+func (v ContextValue[T]) String() string {
+	if v.key == nil {
+		return "<nil>"
+	}
+	return v.key.name
+}
@@ -0,0 +1,159 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"net/http"
+	"strings"
+)
+
+const (
+	corsHeaderOrigin         = "Origin"
+	corsHeaderRequestMethod  = "Access-Control-Request-Method"
+	corsHeaderRequestHeaders = "Access-Control-Request-Headers"
+	corsMaxAge               = "7200" // seconds, Chromium's cap
+)
+
+// corsPolicy answers CORS preflight requests and annotates responses for
+// handlers configured with WithCORS.
+type corsPolicy struct {
+	allowAnyOrigin bool
+	allowGet       bool // for Connect unary procedures without side effects
+	origins        map[string]struct{}
+	allowHeaders   []string
+	exposeHeaders  []string
+}
+
+// newCORSPolicy derives the CORS headers from the protocols the handler
+// supports. It returns nil if CORS isn't enabled. Browsers can't speak
+// gRPC-HTTP2, so only Connect and gRPC-Web contribute headers.
+func newCORSPolicy(config *handlerConfig) *corsPolicy {
+	if len(config.CORSOrigins) == 0 {
+		return nil
+	}
+	policy := &corsPolicy{
+		origins:      make(map[string]struct{}, len(config.CORSOrigins)),
+		allowHeaders: []string{headerContentType},
+	}
+	for _, origin := range config.CORSOrigins {
+		if origin == "*" {
+			policy.allowAnyOrigin = true
+		}
+		policy.origins[origin] = struct{}{}
+	}
+	if config.HandleConnect {
+		policy.allowGet = config.IdempotencyLevel == IdempotencyNoSideEffects
+		policy.allowHeaders = append(
+			policy.allowHeaders,
+			connectUnaryHeaderCompression,
+			connectStreamingHeaderCompression,
+			connectStreamingHeaderAcceptCompression,
+			connectHeaderTimeout,
+		)
+		if config.TimeoutHeader != nil && config.TimeoutHeader.Name != "" {
+			policy.allowHeaders = append(policy.allowHeaders, http.CanonicalHeaderKey(config.TimeoutHeader.Name))
+		}
+		policy.exposeHeaders = append(
+			policy.exposeHeaders,
+			connectUnaryHeaderCompression,
+			connectUnaryHeaderAcceptCompression,
+			connectStreamingHeaderCompression,
+			connectStreamingHeaderAcceptCompression,
+		)
+	}
+	if config.HandleGRPCWeb {
+		policy.allowHeaders = append(
+			policy.allowHeaders,
+			grpcHeaderCompression,
+			grpcHeaderAcceptCompression,
+			grpcHeaderTimeout,
+			"X-Grpc-Web",
+			"X-User-Agent",
+		)
+		policy.exposeHeaders = append(
+			policy.exposeHeaders,
+			grpcHeaderCompression,
+			grpcHeaderAcceptCompression,
+			grpcHeaderStatus,
+			grpcHeaderMessage,
+			grpcHeaderDetails,
+		)
+	}
+	return policy
+}
+
+func (p *corsPolicy) allowOrigin(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	if p.allowAnyOrigin {
+		return true
+	}
+	_, ok := p.origins[origin]
+	return ok
+}
+
+// servePreflight answers CORS preflight requests. It reports whether the
+// request was a preflight request, in which case the response has been
+// written.
+func (p *corsPolicy) servePreflight(responseWriter http.ResponseWriter, request *http.Request) bool {
+	if request.Method != http.MethodOptions || request.Header.Get(corsHeaderRequestMethod) == "" {
+		return false
+	}
+	header := responseWriter.Header()
+	header.Add("Vary", corsHeaderOrigin)
+	header.Add("Vary", corsHeaderRequestMethod)
+	header.Add("Vary", corsHeaderRequestHeaders)
+	origin := request.Header.Get(corsHeaderOrigin)
+	method := request.Header.Get(corsHeaderRequestMethod)
+	if !p.allowOrigin(origin) || (method != http.MethodPost && (!p.allowGet || (method != http.MethodGet && method != http.MethodHead))) {
+		responseWriter.WriteHeader(http.StatusForbidden)
+		return true
+	}
+	allowHeaders := make([]string, len(p.allowHeaders))
+	copy(allowHeaders, p.allowHeaders)
+	// Applications often add their own headers (for example, Authorization),
+	// so allow whatever the browser asks for.
+	for _, requested := range strings.Split(request.Header.Get(corsHeaderRequestHeaders), ",") {
+		if requested = strings.TrimSpace(requested); requested != "" {
+			allowHeaders = append(allowHeaders, requested)
+		}
+	}
+	header.Set("Access-Control-Allow-Origin", origin)
+	allowMethods := http.MethodPost
+	if p.allowGet {
+		allowMethods = http.MethodGet + ", " + http.MethodHead + ", " + http.MethodPost
+	}
+	header.Set("Access-Control-Allow-Methods", allowMethods)
+	header.Set("Access-Control-Allow-Headers", strings.Join(allowHeaders, ", "))
+	header.Set("Access-Control-Max-Age", corsMaxAge)
+	responseWriter.WriteHeader(http.StatusNoContent)
+	return true
+}
+
+// setResponseHeaders lets browsers read the protocols' response headers for
+// cross-origin requests from allowed origins.
+func (p *corsPolicy) setResponseHeaders(responseWriter http.ResponseWriter, request *http.Request) {
+	header := responseWriter.Header()
+	header.Add("Vary", corsHeaderOrigin)
+	origin := request.Header.Get(corsHeaderOrigin)
+	if !p.allowOrigin(origin) {
+		return
+	}
+	header.Set("Access-Control-Allow-Origin", origin)
+	if len(p.exposeHeaders) > 0 {
+		header.Set("Access-Control-Expose-Headers", strings.Join(p.exposeHeaders, ", "))
+	}
+}
@@ -0,0 +1,488 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// deadlineExtendedTrailer reports a handler's extended deadline to the
+	// client. The same key is used in response headers and per-message
+	// metadata.
+	deadlineExtendedTrailer = "Deadline-Extended-To"
+	// deadlineRemainingHeader reports the handler's view of the remaining
+	// timeout, in milliseconds.
+	deadlineRemainingHeader = "Deadline-Remaining-Ms"
+)
+
+// deadlineMarginContextValue carries the margin reserved with
+// WithDeadlineMargin, which outbound calls subtract from their timeouts.
+var deadlineMarginContextValue = NewContextValue[time.Duration]("connect deadline margin")
+
+// RemainingBudget reports how much time remains before the context's
+// deadline. The boolean is false if the context has no deadline. Once the
+// deadline has passed, the remaining budget is zero.
+//
+// In handlers, the context's deadline accounts for the client's timeout, and
+// the remaining budget excludes any margin reserved with [WithDeadlineMargin].
+// Handlers can use the remaining budget to skip expensive work that can't
+// finish in time or to divide the budget between several outbound calls.
+func RemainingBudget(ctx context.Context) (time.Duration, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+	remaining := time.Until(deadline) - deadlineMargin(ctx)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return remaining, true
+}
+
+// ReportedDeadline returns the remaining time before the call's deadline, as
+// seen by the handler when the call arrived. It requires a handler configured
+// with [WithDeadlineReport]; the boolean is false if the response headers
+// don't include a valid report. The difference between the timeout the client
+// sent and the reported value approximates the request's transit time.
+func ReportedDeadline(header http.Header) (time.Duration, bool) {
+	value := header.Get(deadlineRemainingHeader)
+	if value == "" {
+		return 0, false
+	}
+	millis, err := strconv.ParseInt(value, 10 /* base */, 64 /* bitsize */)
+	if err != nil || millis < 0 {
+		return 0, false
+	}
+	return time.Duration(millis) * time.Millisecond, true
+}
+
+// writeDeadlineRemaining reports the remaining time before the context's
+// deadline in the response headers.
+func writeDeadlineRemaining(ctx context.Context, header http.Header) {
+	remaining, ok := RemainingBudget(ctx)
+	if !ok {
+		return
+	}
+	header.Set(deadlineRemainingHeader, strconv.FormatInt(int64(remaining/time.Millisecond), 10 /* base */))
+}
+
+// deadlineMargin returns the margin reserved by the handler whose context ctx
+// derives from, if any.
+func deadlineMargin(ctx context.Context) time.Duration {
+	margin, _ := deadlineMarginContextValue.From(ctx)
+	return margin
+}
+
+// timeoutWithSkew returns the timeout to send for a deadline, shortened by
+// skew. Shortening never turns a live deadline into a missing timeout, so the
+// result is at least a millisecond if any time remains.
+func timeoutWithSkew(deadline time.Time, skew time.Duration) time.Duration {
+	timeout := time.Until(deadline)
+	if skew <= 0 || timeout <= 0 {
+		return timeout
+	}
+	timeout -= skew
+	if timeout < time.Millisecond {
+		return time.Millisecond
+	}
+	return timeout
+}
+
+// clampTimeout enforces the handler's minimum, maximum, and default timeouts.
+// Calls with less than minTimeout remaining are rejected, calls without a
+// deadline get defaultTimeout, and calls with more than maxTimeout remaining
+// (including calls without a deadline) are shortened. Zero values disable the
+// corresponding check.
+func clampTimeout(ctx context.Context, minTimeout, maxTimeout, defaultTimeout time.Duration) (context.Context, context.CancelFunc, error) {
+	remaining, ok := RemainingBudget(ctx)
+	if ok && minTimeout > 0 && remaining < minTimeout {
+		return ctx, nil, errorf(
+			CodeInvalidArgument,
+			"timeout %v is shorter than the minimum %v", remaining.Round(time.Millisecond), minTimeout,
+		)
+	}
+	if !ok && defaultTimeout > 0 && (maxTimeout <= 0 || defaultTimeout < maxTimeout) {
+		ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+		return ctx, cancel, nil
+	}
+	if maxTimeout <= 0 || (ok && remaining <= maxTimeout) {
+		return ctx, nil, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, maxTimeout)
+	return ctx, cancel, nil
+}
+
+// withDefaultTimeout applies a client's default call timeout to contexts
+// without a deadline. The returned cancel function is nil if the context is
+// unchanged.
+func withDefaultTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, nil
+	}
+	if _, ok := ctx.Deadline(); ok {
+		return ctx, nil
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// timeoutClientConn cancels the context created for a client's default call
+// timeout once the receive side of the stream is closed.
+type timeoutClientConn struct {
+	StreamingClientConn
+
+	cancel context.CancelFunc
+}
+
+func (cc *timeoutClientConn) SendWithMetadata(msg any, metadata http.Header) error {
+	return SendWithMetadata(cc.StreamingClientConn, msg, metadata)
+}
+
+func (cc *timeoutClientConn) ReceiveWithMetadata(msg any) (http.Header, error) {
+	return ReceiveWithMetadata(cc.StreamingClientConn, msg)
+}
+
+func (cc *timeoutClientConn) SendWithEnvelopeFlags(msg any, flags []string) error {
+	return SendWithEnvelopeFlags(cc.StreamingClientConn, msg, flags...)
+}
+
+func (cc *timeoutClientConn) ReceiveWithEnvelopeFlags(msg any) ([]string, error) {
+	return ReceiveWithEnvelopeFlags(cc.StreamingClientConn, msg)
+}
+
+func (cc *timeoutClientConn) CloseResponse() error {
+	err := cc.StreamingClientConn.CloseResponse()
+	cc.cancel()
+	return err
+}
+
+// ExtendDeadline pushes back the deadline of a long-running call, for jobs
+// whose duration is only known after reading the request. The handler must be
+// configured with [WithMaxDeadlineExtension], and the total extension can't
+// exceed the configured maximum. ExtendDeadline returns the new deadline and
+// reports it to the client as "Deadline-Extended-To", formatted as RFC 3339:
+// in the response headers if they haven't been sent yet, in the metadata of
+// the next streamed message if per-message metadata was negotiated (see
+// [WithMessageMetadata]), and always in the response trailers. Unary
+// responses send their headers with the response, so unary clients only see
+// the extension once the call finishes.
+//
+// Clients calling with a context from [ContextWithExtendableTimeout] push back
+// their own deadline when they see a report. Other clients must allow for the
+// extension with their own context deadlines.
+//
+// Only the deadline derived from the client's timeout is extended: deadlines
+// imposed by [WithMaxTimeout] or a [CallPolicy] still
+// apply.
+func ExtendDeadline(ctx context.Context, by time.Duration) (time.Time, error) {
+	extendable, ok := ctx.Value(extendableDeadlineKey{}).(*extendableDeadlineContext)
+	if !ok {
+		return time.Time{}, errorf(CodeFailedPrecondition, "deadline extension not enabled for this call")
+	}
+	return extendable.extend(by)
+}
+
+// ContextWithExtendableTimeout returns a context for client calls that times
+// out after timeout, unless a handler extends the call's deadline with
+// [ExtendDeadline]. Clients follow the handler's reports, pushing back the
+// context's deadline by up to maxExtension in total. Any deadline on the parent
+// still applies, as do deadlines added by interceptors.
+//
+// Canceling the context releases its resources, so code should call cancel as
+// soon as the calls using it complete.
+func ContextWithExtendableTimeout(
+	parent context.Context,
+	timeout time.Duration,
+	maxExtension time.Duration,
+) (context.Context, context.CancelFunc) {
+	ctx, cancel := newExtendableDeadlineContext(parent, time.Now().Add(timeout), maxExtension)
+	ctx.client = true
+	return ctx, cancel
+}
+
+type extendableDeadlineKey struct{}
+
+type followedDeadlineKey struct{}
+
+// extendableDeadlineContext is a context with a deadline that can be pushed
+// back, up to a limit. The standard library's contexts have fixed deadlines.
+// Handlers extend their deadline explicitly, and clients follow the
+// extensions that handlers report.
+type extendableDeadlineContext struct {
+	parent context.Context
+	done   chan struct{}
+	limit  time.Time
+	client bool
+
+	mu       sync.Mutex
+	deadline time.Time
+	timer    *time.Timer
+	err      error
+	report   func(time.Time) // set once the stream is established
+}
+
+// newExtendableDeadlineContext returns a context that expires at deadline,
+// which may be extended up to maxExtension beyond its initial value. The
+// parent shouldn't have a deadline of its own.
+func newExtendableDeadlineContext(
+	parent context.Context,
+	deadline time.Time,
+	maxExtension time.Duration,
+) (*extendableDeadlineContext, context.CancelFunc) {
+	ctx := &extendableDeadlineContext{
+		parent:   parent,
+		done:     make(chan struct{}),
+		limit:    deadline.Add(maxExtension),
+		deadline: deadline,
+	}
+	ctx.mu.Lock()
+	ctx.timer = time.AfterFunc(time.Until(deadline), func() {
+		ctx.finish(context.DeadlineExceeded)
+	})
+	ctx.mu.Unlock()
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-parent.Done():
+			ctx.finish(parent.Err())
+		case <-stop:
+		case <-ctx.done:
+		}
+	}()
+	var once sync.Once
+	return ctx, func() {
+		once.Do(func() {
+			close(stop)
+			ctx.finish(context.Canceled)
+		})
+	}
+}
+
+func (c *extendableDeadlineContext) Deadline() (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.deadline, true
+}
+
+func (c *extendableDeadlineContext) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *extendableDeadlineContext) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *extendableDeadlineContext) Value(key any) any {
+	switch key.(type) {
+	case extendableDeadlineKey:
+		if !c.client {
+			return c
+		}
+	case followedDeadlineKey:
+		if c.client {
+			return c
+		}
+	}
+	return c.parent.Value(key)
+}
+
+func (c *extendableDeadlineContext) setReport(report func(time.Time)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.report = report
+}
+
+func (c *extendableDeadlineContext) extend(by time.Duration) (time.Time, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.deadline, c.err
+	}
+	if by <= 0 {
+		return c.deadline, errorf(CodeInvalidArgument, "deadline extension %v must be positive", by)
+	}
+	deadline := c.deadline.Add(by)
+	if deadline.After(c.limit) {
+		return c.deadline, errorf(
+			CodeResourceExhausted,
+			"deadline extension %v exceeds the remaining limit %v", by, c.limit.Sub(c.deadline),
+		)
+	}
+	if !c.timer.Stop() {
+		// The timer already fired, and the context is expiring.
+		return c.deadline, context.DeadlineExceeded
+	}
+	c.deadline = deadline
+	c.timer.Reset(time.Until(deadline))
+	if c.report != nil {
+		c.report(deadline)
+	}
+	return deadline, nil
+}
+
+// follow pushes back a client's deadline to match an extension reported by
+// the handler, without exceeding the limit.
+func (c *extendableDeadlineContext) follow(deadline time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if deadline.After(c.limit) {
+		deadline = c.limit
+	}
+	if c.err != nil || !deadline.After(c.deadline) || !c.timer.Stop() {
+		return
+	}
+	c.deadline = deadline
+	c.timer.Reset(time.Until(deadline))
+}
+
+func (c *extendableDeadlineContext) finish(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	c.timer.Stop()
+	close(c.done)
+}
+
+// deadlineReportConn reports a handler's deadline extensions to the client
+// while the call is running.
+type deadlineReportConn struct {
+	handlerConnCloser
+
+	mu      sync.Mutex
+	sent    bool
+	pending string // extension not yet reported in a message's metadata
+}
+
+func (hc *deadlineReportConn) extended(deadline time.Time) {
+	value := deadline.UTC().Format(time.RFC3339Nano)
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	hc.ResponseTrailer().Set(deadlineExtendedTrailer, value)
+	if !hc.sent {
+		// Headers are sent with the first message.
+		hc.ResponseHeader().Set(deadlineExtendedTrailer, value)
+		return
+	}
+	hc.pending = value
+}
+
+func (hc *deadlineReportConn) Send(msg any) error {
+	return hc.SendWithMetadata(msg, nil)
+}
+
+func (hc *deadlineReportConn) SendWithMetadata(msg any, metadata http.Header) error {
+	hc.mu.Lock()
+	hc.sent = true
+	pending := hc.pending
+	hc.pending = ""
+	hc.mu.Unlock()
+	if pending != "" {
+		metadata = metadata.Clone()
+		if metadata == nil {
+			metadata = make(http.Header, 1)
+		}
+		metadata.Set(deadlineExtendedTrailer, pending)
+	}
+	if metadata == nil {
+		return hc.handlerConnCloser.Send(msg)
+	}
+	return SendWithMetadata(hc.handlerConnCloser, msg, metadata)
+}
+
+func (hc *deadlineReportConn) ReceiveWithMetadata(msg any) (http.Header, error) {
+	return ReceiveWithMetadata(hc.handlerConnCloser, msg)
+}
+
+func (hc *deadlineReportConn) ReceiveWithEnvelopeFlags(msg any) ([]string, error) {
+	return ReceiveWithEnvelopeFlags(hc.handlerConnCloser, msg)
+}
+
+func (hc *deadlineReportConn) SendWithEnvelopeFlags(msg any, flags []string) error {
+	hc.mu.Lock()
+	hc.sent = true
+	hc.mu.Unlock()
+	return SendWithEnvelopeFlags(hc.handlerConnCloser, msg, flags...)
+}
+
+func (hc *deadlineReportConn) CloseReceive() error {
+	return closeReceive(hc.handlerConnCloser)
+}
+
+func (hc *deadlineReportConn) applyPolicy(policy *CallPolicy) {
+	applyPolicy(hc.handlerConnCloser, policy)
+}
+
+// followDeadlineClientConn pushes back the deadline of a context created with
+// ContextWithExtendableTimeout when the handler reports an extension.
+type followDeadlineClientConn struct {
+	StreamingClientConn
+
+	deadline *extendableDeadlineContext
+}
+
+// followDeadlineExtensions wraps conn if the call's context follows the
+// handler's deadline extensions.
+func followDeadlineExtensions(ctx context.Context, conn StreamingClientConn) StreamingClientConn {
+	deadline, ok := ctx.Value(followedDeadlineKey{}).(*extendableDeadlineContext)
+	if !ok {
+		return conn
+	}
+	return &followDeadlineClientConn{StreamingClientConn: conn, deadline: deadline}
+}
+
+func (cc *followDeadlineClientConn) Receive(msg any) error {
+	_, err := cc.ReceiveWithMetadata(msg)
+	return err
+}
+
+func (cc *followDeadlineClientConn) ReceiveWithMetadata(msg any) (http.Header, error) {
+	metadata, err := ReceiveWithMetadata(cc.StreamingClientConn, msg)
+	cc.follow(cc.ResponseHeader())
+	cc.follow(metadata)
+	return metadata, err
+}
+
+func (cc *followDeadlineClientConn) SendWithMetadata(msg any, metadata http.Header) error {
+	return SendWithMetadata(cc.StreamingClientConn, msg, metadata)
+}
+
+func (cc *followDeadlineClientConn) ReceiveWithEnvelopeFlags(msg any) ([]string, error) {
+	flags, err := ReceiveWithEnvelopeFlags(cc.StreamingClientConn, msg)
+	cc.follow(cc.ResponseHeader())
+	return flags, err
+}
+
+func (cc *followDeadlineClientConn) SendWithEnvelopeFlags(msg any, flags []string) error {
+	return SendWithEnvelopeFlags(cc.StreamingClientConn, msg, flags...)
+}
+
+func (cc *followDeadlineClientConn) follow(header http.Header) {
+	value := header.Get(deadlineExtendedTrailer)
+	if value == "" {
+		return
+	}
+	if deadline, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		cc.deadline.follow(deadline)
+	}
+}
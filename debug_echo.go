@@ -0,0 +1,114 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"net/http"
+	"time"
+)
+
+const (
+	// headerDebug asks handlers configured with WithDebugEcho for diagnostic
+	// headers.
+	headerDebug               = "Connect-Debug"
+	headerDebugProtocol       = "Connect-Debug-Protocol"
+	headerDebugCodec          = "Connect-Debug-Codec"
+	headerDebugCompression    = "Connect-Debug-Compression"
+	headerDebugVersion        = "Connect-Debug-Version"
+	headerDebugProcessingTime = "Connect-Debug-Processing-Time"
+)
+
+// DebugEcho configures the diagnostic headers enabled by [WithDebugEcho].
+type DebugEcho struct {
+	// Authorize reports whether the caller may see diagnostic headers. It's
+	// called only for requests with a Connect-Debug header. If it's nil, no
+	// callers are authorized.
+	Authorize func(*http.Request) bool
+	// Version identifies the deployed handler, for example a release tag or
+	// commit hash. If empty, the version header is omitted.
+	Version string
+}
+
+// enabled reports whether the request asked for diagnostic headers and is
+// authorized to see them.
+func (e *DebugEcho) enabled(request *http.Request) bool {
+	if e == nil || e.Authorize == nil || request.Header.Get(headerDebug) == "" {
+		return false
+	}
+	return e.Authorize(request)
+}
+
+// writeHeaders attaches diagnostic headers describing how the handler
+// interpreted the request.
+func (e *DebugEcho) writeHeaders(protocolHandler protocolHandler, request *http.Request, header http.Header) {
+	contentType := request.Header.Get(headerContentType)
+	if request.Method == http.MethodGet || request.Method == http.MethodHead {
+		// Connect GET requests carry their codec in the query string.
+		contentType = connectUnaryContentTypePrefix + request.URL.Query().Get(connectUnaryEncodingQueryParameter)
+	}
+	var protocol, codec, compression string
+	switch handler := protocolHandler.(type) {
+	case *connectHandler:
+		protocol = ProtocolConnect
+		codec = connectCodecFromContentType(handler.Spec.StreamType, contentType)
+		if handler.Spec.StreamType == StreamTypeUnary {
+			compression = request.Header.Get(connectUnaryHeaderCompression)
+		} else {
+			compression = request.Header.Get(connectStreamingHeaderCompression)
+		}
+	case *jsonArrayHandler, *longPollHandler:
+		protocol = ProtocolConnect
+		codec = connectCodecFromContentType(StreamTypeUnary, contentType)
+		compression = request.Header.Get(connectUnaryHeaderCompression)
+	case *grpcHandler:
+		protocol = ProtocolGRPC
+		if handler.web {
+			protocol = ProtocolGRPCWeb
+		}
+		codec = grpcCodecFromContentType(handler.web, contentType)
+		compression = request.Header.Get(grpcHeaderCompression)
+	}
+	if compression == "" {
+		compression = compressionIdentity
+	}
+	header.Set(headerDebugProtocol, protocol)
+	header.Set(headerDebugCodec, codec)
+	header.Set(headerDebugCompression, compression)
+	if e.Version != "" {
+		header.Set(headerDebugVersion, e.Version)
+	}
+}
+
+// debugUnaryConn reports the processing time of unary calls. Connect unary
+// handlers send trailers along with the response headers, so the time is
+// recorded when the response is sent rather than when the conn is closed.
+type debugUnaryConn struct {
+	handlerConnCloser
+
+	start time.Time
+}
+
+func (hc *debugUnaryConn) Send(msg any) error {
+	setDebugProcessingTime(hc.ResponseTrailer(), hc.start)
+	return hc.handlerConnCloser.Send(msg)
+}
+
+func (hc *debugUnaryConn) applyPolicy(policy *CallPolicy) {
+	applyPolicy(hc.handlerConnCloser, policy)
+}
+
+func setDebugProcessingTime(trailer http.Header, start time.Time) {
+	trailer.Set(headerDebugProcessingTime, time.Since(start).String())
+}
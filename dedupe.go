@@ -0,0 +1,116 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+const defaultDedupeWindow = 1024
+
+// MessageDeduper drops duplicate messages on the receive side of a stream,
+// for upstreams with at-least-once delivery: for example, server streams
+// that resume after a [Drainer] closes them may repeat messages. Messages are
+// identified by a caller-supplied key, and the deduper remembers the keys of
+// the most recent messages in a sliding window. It's constructed with
+// [NewMessageDeduper].
+//
+// Like streams, MessageDedupers aren't safe for concurrent use.
+type MessageDeduper[T any, K comparable] struct {
+	keyOf      func(*T) K
+	seen       map[K]struct{}
+	window     []K // ring buffer of the remembered keys, oldest first from next
+	next       int
+	duplicates uint64
+}
+
+// NewMessageDeduper constructs a deduper that remembers the keys of the last
+// window messages. If window is less than 1, it remembers 1024 keys.
+func NewMessageDeduper[T any, K comparable](window int, keyOf func(*T) K) *MessageDeduper[T, K] {
+	if window < 1 {
+		window = defaultDedupeWindow
+	}
+	return &MessageDeduper[T, K]{
+		keyOf:  keyOf,
+		seen:   make(map[K]struct{}, window),
+		window: make([]K, 0, window),
+	}
+}
+
+// Duplicate reports whether the message's key is in the window. If it isn't,
+// the key is added, evicting the oldest key if the window is full.
+func (d *MessageDeduper[T, K]) Duplicate(msg *T) bool {
+	key := d.keyOf(msg)
+	if _, ok := d.seen[key]; ok {
+		d.duplicates++
+		return true
+	}
+	d.seen[key] = struct{}{}
+	if len(d.window) < cap(d.window) {
+		d.window = append(d.window, key)
+		return false
+	}
+	delete(d.seen, d.window[d.next])
+	d.window[d.next] = key
+	d.next = (d.next + 1) % len(d.window)
+	return false
+}
+
+// Duplicates returns the number of duplicate messages seen so far.
+func (d *MessageDeduper[T, K]) Duplicates() uint64 {
+	return d.duplicates
+}
+
+// Next advances a stream with a boolean Receive method, like
+// [ServerStreamForClient] or [ClientStream], to the next message that isn't
+// a duplicate. It returns false when the stream's Receive does, and the
+// message is available from the stream's Msg method. For example:
+//
+//	deduper := connect.NewMessageDeduper(1024, func(event *eventv1.Event) string {
+//		return event.Id
+//	})
+//	for deduper.Next(stream) {
+//		handle(stream.Msg())
+//	}
+//	if err := stream.Err(); err != nil {
+//		return err
+//	}
+func (d *MessageDeduper[T, K]) Next(stream messageReceiver[T]) bool {
+	for stream.Receive() {
+		if !d.Duplicate(stream.Msg()) {
+			return true
+		}
+	}
+	return false
+}
+
+// messageReceiver is implemented by streams with a boolean Receive method.
+type messageReceiver[T any] interface {
+	Receive() bool
+	Msg() *T
+}
+
+// Receive calls a receive function, like the Receive method of
+// [BidiStreamForClient] or [BidiStream], until it returns a message that
+// isn't a duplicate or an error. For example:
+//
+//	msg, err := deduper.Receive(stream.Receive)
+func (d *MessageDeduper[T, K]) Receive(receive func() (*T, error)) (*T, error) {
+	for {
+		msg, err := receive()
+		if err != nil {
+			return nil, err
+		}
+		if !d.Duplicate(msg) {
+			return msg, nil
+		}
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/bufbuild/connect-go/internal/assert"
+	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
+	"github.com/bufbuild/connect-go/internal/gen/connect/ping/v1/pingv1connect"
+)
+
+func TestMessageDeduper(t *testing.T) {
+	t.Parallel()
+	numberOf := func(msg *pingv1.CountUpResponse) int64 { return msg.Number }
+	t.Run("server_stream", func(t *testing.T) {
+		t.Parallel()
+		const procedure = "/" + pingv1connect.PingServiceName + "/CountUp"
+		mux := http.NewServeMux()
+		mux.Handle(procedure, connect.NewServerStreamHandler(
+			procedure,
+			func(ctx context.Context, request *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+				for _, number := range []int64{1, 2, 2, 3, 1, 4} {
+					if err := stream.Send(&pingv1.CountUpResponse{Number: number}); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		))
+		server := httptest.NewServer(mux)
+		t.Cleanup(server.Close)
+		client := connect.NewClient[pingv1.CountUpRequest, pingv1.CountUpResponse](server.Client(), server.URL+procedure)
+		stream, err := client.CallServerStream(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{}))
+		assert.Nil(t, err)
+		// With a window of two keys, 1 has been forgotten by the time it's
+		// repeated.
+		deduper := connect.NewMessageDeduper(2, numberOf)
+		var got []int64
+		for deduper.Next(stream) {
+			got = append(got, stream.Msg().Number)
+		}
+		assert.Nil(t, stream.Err())
+		assert.Nil(t, stream.Close())
+		assert.Equal(t, got, []int64{1, 2, 3, 1, 4})
+		assert.Equal(t, deduper.Duplicates(), uint64(1))
+	})
+	t.Run("receive", func(t *testing.T) {
+		t.Parallel()
+		numbers := []int64{5, 5, 6, 5, 6, 7}
+		receive := func() (*pingv1.CountUpResponse, error) {
+			if len(numbers) == 0 {
+				return nil, io.EOF
+			}
+			msg := &pingv1.CountUpResponse{Number: numbers[0]}
+			numbers = numbers[1:]
+			return msg, nil
+		}
+		deduper := connect.NewMessageDeduper(0, numberOf)
+		var got []int64
+		for {
+			msg, err := deduper.Receive(receive)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			assert.Nil(t, err)
+			got = append(got, msg.Number)
+		}
+		assert.Equal(t, got, []int64{5, 6, 7})
+		assert.Equal(t, deduper.Duplicates(), uint64(3))
+	})
+}
@@ -0,0 +1,82 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"net/http"
+)
+
+// wrap returns a copy of httpClient whose transport dials with o.Dial.
+func (o *dialerOption) wrap(httpClient HTTPClient) (HTTPClient, *Error) {
+	return wrapTransport(httpClient, "WithDialer", o.transport)
+}
+
+func (o *dialerOption) transport(original *http.Transport) *http.Transport {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if cloned, ok := o.transports[original]; ok {
+		return cloned
+	}
+	cloned := original.Clone()
+	cloned.DialContext = o.Dial
+	// DialTLSContext takes precedence over DialContext for HTTPS, so it would
+	// bypass the custom dialer.
+	cloned.DialTLSContext = nil
+	o.transports[original] = cloned
+	return cloned
+}
+
+// wrapTransport returns a copy of httpClient whose transport is replaced by
+// the result of clone, for options that need to customize the transport.
+func wrapTransport(
+	httpClient HTTPClient,
+	optionName string,
+	clone func(*http.Transport) *http.Transport,
+) (HTTPClient, *Error) {
+	client, ok := httpClient.(*http.Client)
+	if !ok {
+		return nil, errorf(CodeUnknown, "%s requires an *http.Client, got %T", optionName, httpClient)
+	}
+	transport := client.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	original, ok := transport.(*http.Transport)
+	if !ok {
+		return nil, errorf(CodeUnknown, "%s requires an *http.Transport, got %T", optionName, transport)
+	}
+	wrapped := *client
+	wrapped.Transport = clone(original)
+	return &wrapped, nil
+}
+
+// wrap returns a copy of httpClient whose transport uses o.Config for TLS.
+func (o *tlsConfigOption) wrap(httpClient HTTPClient) (HTTPClient, *Error) {
+	return wrapTransport(httpClient, "WithTLSConfig", o.transport)
+}
+
+func (o *tlsConfigOption) transport(original *http.Transport) *http.Transport {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if cloned, ok := o.transports[original]; ok {
+		return cloned
+	}
+	cloned := original.Clone()
+	cloned.TLSClientConfig = o.Config.Clone()
+	// DialTLSContext would bypass TLSClientConfig.
+	cloned.DialTLSContext = nil
+	o.transports[original] = cloned
+	return cloned
+}
@@ -0,0 +1,74 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// StableCodec is a [Codec] that can also marshal messages deterministically:
+// equal messages always produce identical bytes, at least within a single
+// version of the program. The default Protobuf binary and JSON codecs are
+// StableCodecs.
+type StableCodec interface {
+	Codec
+
+	// MarshalStable marshals the given message with a deterministic encoding.
+	MarshalStable(any) ([]byte, error)
+}
+
+// RequestDigest is a SHA-256 digest of a procedure and request message,
+// suitable as a key for content-addressable caches.
+type RequestDigest [sha256.Size]byte
+
+// String returns the digest in lowercase hexadecimal.
+func (d RequestDigest) String() string {
+	return hex.EncodeToString(d[:])
+}
+
+// DigestRequest computes the digest of a request message sent to a procedure,
+// using the stable encoding of codec. If codec is nil, the message is encoded
+// as deterministic Protobuf binary. Identical requests to the same procedure
+// always have the same digest; request headers aren't considered.
+//
+// Connect uses DigestRequest to key [WithServerStreamCache], so applications
+// can use it to key their own caches consistently. Digests are only stable
+// within a single version of the program and its schemas, so they shouldn't be
+// persisted across deployments.
+func DigestRequest(procedure string, message any, codec Codec) (RequestDigest, error) {
+	if codec == nil {
+		codec = &protoBinaryCodec{}
+	}
+	stable, ok := codec.(StableCodec)
+	if !ok {
+		return RequestDigest{}, errorf(CodeInternal, "codec %q can't marshal deterministically", codec.Name())
+	}
+	data, err := stable.MarshalStable(message)
+	if err != nil {
+		return RequestDigest{}, errorf(CodeInternal, "marshal request: %w", err)
+	}
+	hash := sha256.New()
+	// Separate the fields with NUL bytes, which can't appear in procedures or
+	// codec names, so that different inputs can't produce the same stream.
+	_, _ = hash.Write([]byte(procedure))
+	_, _ = hash.Write([]byte{0})
+	_, _ = hash.Write([]byte(codec.Name()))
+	_, _ = hash.Write([]byte{0})
+	_, _ = hash.Write(data)
+	var digest RequestDigest
+	hash.Sum(digest[:0])
+	return digest, nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"testing"
+
+	"github.com/bufbuild/connect-go/internal/assert"
+	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
+)
+
+func TestDigestRequest(t *testing.T) {
+	t.Parallel()
+	const procedure = "/connect.ping.v1.PingService/Ping"
+	jsonCodec := &protoJSONCodec{name: codecNameJSON}
+	digest := func(t *testing.T, procedure string, message any, codec Codec) RequestDigest {
+		t.Helper()
+		d, err := DigestRequest(procedure, message, codec)
+		assert.Nil(t, err)
+		return d
+	}
+	first := digest(t, procedure, &pingv1.PingRequest{Number: 42, Text: "foo"}, nil)
+	assert.Equal(t, first, digest(t, procedure, &pingv1.PingRequest{Text: "foo", Number: 42}, nil))
+	assert.Equal(t, first, digest(t, procedure, &pingv1.PingRequest{Number: 42, Text: "foo"}, &protoBinaryCodec{}))
+	assert.Equal(t, len(first.String()), 64)
+	assert.NotEqual(t, first, digest(t, procedure, &pingv1.PingRequest{Number: 43, Text: "foo"}, nil))
+	assert.NotEqual(t, first, digest(t, "/connect.ping.v1.PingService/Sum", &pingv1.PingRequest{Number: 42, Text: "foo"}, nil))
+
+	jsonDigest := digest(t, procedure, &pingv1.PingRequest{Number: 42, Text: "foo"}, jsonCodec)
+	assert.NotEqual(t, first, jsonDigest)
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, jsonDigest, digest(t, procedure, &pingv1.PingRequest{Number: 42, Text: "foo"}, jsonCodec))
+	}
+
+	_, err := DigestRequest(procedure, &pingv1.PingRequest{}, &unstableCodec{Codec: &protoBinaryCodec{}})
+	assert.Equal(t, CodeOf(err), CodeInternal)
+	_, err = DigestRequest(procedure, "not a message", nil)
+	assert.Equal(t, CodeOf(err), CodeInternal)
+}
+
+// unstableCodec hides the MarshalStable method of the wrapped codec.
+type unstableCodec struct {
+	Codec
+}
@@ -0,0 +1,80 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// DisconnectPolicy controls what happens to a running handler when its client
+// disconnects, for example by canceling the call or closing the connection.
+// It's configured with [WithDisconnectPolicy].
+type DisconnectPolicy struct {
+	// GracePeriod is how long the handler's context outlives the client. It
+	// lets handlers finish side effects that are unsafe to abandon halfway,
+	// such as non-idempotent writes. Anything the handler sends during the
+	// grace period is discarded. If it's zero, the context is canceled as soon
+	// as the client disconnects.
+	GracePeriod time.Duration
+	// Notify, if non-nil, is called once when the client disconnects before
+	// the handler returns. It receives the handler's context, which stays live
+	// for the grace period, and the error from the request's context, which
+	// explains why the call ended. Notify runs concurrently with the handler.
+	Notify func(ctx context.Context, spec Spec, peer Peer, reason error)
+}
+
+// watch detaches the request's context from the client's connection, so that
+// disconnects are governed by the policy. The returned function must be
+// called when the handler returns.
+func (p *DisconnectPolicy) watch(request *http.Request, spec Spec) (*http.Request, func()) {
+	clientCtx := request.Context()
+	var ctx context.Context = detachedContext{clientCtx}
+	var cancel context.CancelFunc
+	if deadline, ok := clientCtx.Deadline(); ok {
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+			return
+		case <-clientCtx.Done():
+		}
+		if p.Notify != nil {
+			p.Notify(ctx, spec, newPeerFromRequest(request), clientCtx.Err())
+		}
+		if p.GracePeriod <= 0 {
+			cancel()
+			return
+		}
+		timer := time.NewTimer(p.GracePeriod)
+		defer timer.Stop()
+		select {
+		case <-done:
+		case <-timer.C:
+			cancel()
+		}
+	}()
+	return request.WithContext(ctx), func() {
+		close(done)
+		cancel()
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// reconnectAfterHeader asks clients to reopen a stream after the given number
+// of milliseconds. It's sent as error metadata, so it arrives in the trailers
+// of streams closed by a draining server.
+const reconnectAfterHeader = "Connect-Reconnect-After-Ms"
+
+// Drainer coordinates graceful shutdown of streaming handlers. When a server
+// begins draining, typically after receiving SIGTERM during a rolling
+// restart, calling [Drainer.Drain] cancels the contexts of active streams.
+// Each stream is then closed with [CodeUnavailable] and metadata asking the
+// client to reconnect after a delay, and new streams are rejected the same
+// way. Clients configured with [WithReconnectOnDrain] reopen server streams
+// automatically, so the restart is invisible to their consumers.
+//
+// Unary calls aren't affected: servers should finish them with
+// [net/http.Server.Shutdown] as usual. Drainers are attached to handlers with
+// [WithDrainer], and a single Drainer is usually shared by all of a server's
+// handlers.
+type Drainer struct {
+	mu             sync.Mutex
+	draining       bool
+	reconnectAfter time.Duration
+	streams        map[*drainingStream]struct{}
+}
+
+type drainingStream struct {
+	cancel  context.CancelFunc
+	drained bool // guarded by Drainer.mu
+}
+
+// NewDrainer constructs a Drainer.
+func NewDrainer() *Drainer {
+	return &Drainer{streams: make(map[*drainingStream]struct{})}
+}
+
+// Drain closes active streams, asking clients to reconnect after the supplied
+// delay, and rejects new streams. The delay should be long enough for load
+// balancers to stop routing to this server, so that clients reconnect to a
+// healthy one. Drain doesn't wait for handlers to return.
+func (d *Drainer) Drain(reconnectAfter time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.draining = true
+	if reconnectAfter < 0 {
+		reconnectAfter = 0
+	}
+	d.reconnectAfter = reconnectAfter
+	for stream := range d.streams {
+		stream.drained = true
+		stream.cancel()
+	}
+}
+
+// Draining reports whether Drain has been called.
+func (d *Drainer) Draining() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.draining
+}
+
+// track registers a stream, returning a context that's canceled when the
+// server drains. It returns a nil stream if the server is already draining.
+func (d *Drainer) track(ctx context.Context) (context.Context, *drainingStream) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.draining {
+		return ctx, nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	stream := &drainingStream{cancel: cancel}
+	d.streams[stream] = struct{}{}
+	return ctx, stream
+}
+
+// release unregisters a stream, and reports whether it was drained.
+func (d *Drainer) release(stream *drainingStream) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.streams, stream)
+	stream.cancel()
+	return stream.drained
+}
+
+// drainErr is the error sent to clients when a stream is drained.
+func (d *Drainer) drainErr() *Error {
+	d.mu.Lock()
+	reconnectAfter := d.reconnectAfter
+	d.mu.Unlock()
+	err := NewError(CodeUnavailable, errors.New("server is draining: reconnect to another server"))
+	err.Meta().Set(reconnectAfterHeader, strconv.FormatInt(int64(reconnectAfter/time.Millisecond), 10 /* base */))
+	return err
+}
+
+// drainReconnectDelay returns the delay requested by a draining server, if
+// err closed a drained stream.
+func drainReconnectDelay(err error) (time.Duration, bool) {
+	connectErr, ok := asError(err)
+	if !ok || connectErr.Code() != CodeUnavailable {
+		return 0, false
+	}
+	value := connectErr.Meta().Get(reconnectAfterHeader)
+	if value == "" {
+		return 0, false
+	}
+	millis, parseErr := strconv.ParseInt(value, 10 /* base */, 64 /* bitsize */)
+	if parseErr != nil || millis < 0 {
+		return 0, false
+	}
+	return time.Duration(millis) * time.Millisecond, true
+}
@@ -0,0 +1,114 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	connect "github.com/bufbuild/connect-go"
+	"github.com/bufbuild/connect-go/internal/assert"
+	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
+	"github.com/bufbuild/connect-go/internal/gen/connect/ping/v1/pingv1connect"
+)
+
+func TestDrainer(t *testing.T) {
+	t.Parallel()
+	const countUpProcedure = "/" + pingv1connect.PingServiceName + "/CountUp"
+	// Simulate a rolling restart: the old server sends one message and then
+	// waits to be drained, and the load balancer then routes new streams to
+	// the new server, which finishes the stream.
+	drainer := connect.NewDrainer()
+	oldServer := connect.NewServerStreamHandler(
+		countUpProcedure,
+		func(ctx context.Context, request *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+			if err := stream.Send(&pingv1.CountUpResponse{Number: 1}); err != nil {
+				return err
+			}
+			<-ctx.Done()
+			return ctx.Err()
+		},
+		connect.WithDrainer(drainer),
+	)
+	newServer := connect.NewServerStreamHandler(
+		countUpProcedure,
+		func(ctx context.Context, request *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+			for i := int64(2); i <= request.Msg.Number; i++ {
+				if err := stream.Send(&pingv1.CountUpResponse{Number: i}); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	)
+	var drained int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&drained) == 1 && r.Header.Get("Old-Server") == "" {
+			newServer.ServeHTTP(w, r)
+			return
+		}
+		oldServer.ServeHTTP(w, r)
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	drain := func() {
+		drainer.Drain(10 * time.Millisecond)
+		atomic.StoreInt32(&drained, 1)
+	}
+
+	t.Run("reconnect", func(t *testing.T) {
+		client := connect.NewClient[pingv1.CountUpRequest, pingv1.CountUpResponse](
+			server.Client(),
+			server.URL+countUpProcedure,
+			connect.WithReconnectOnDrain(3),
+		)
+		stream, err := client.CallServerStream(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 3}))
+		assert.Nil(t, err)
+		assert.True(t, stream.Receive())
+		assert.Equal(t, stream.Msg().Number, 1)
+		drain()
+		var got []int64
+		for stream.Receive() {
+			got = append(got, stream.Msg().Number)
+		}
+		assert.Nil(t, stream.Err())
+		assert.Equal(t, got, []int64{2, 3})
+		assert.Nil(t, stream.Close())
+	})
+	t.Run("rejected", func(t *testing.T) {
+		// Without WithReconnectOnDrain, clients see the error. New streams to a
+		// draining server are rejected the same way.
+		client := connect.NewClient[pingv1.CountUpRequest, pingv1.CountUpResponse](
+			server.Client(),
+			server.URL+countUpProcedure,
+		)
+		request := connect.NewRequest(&pingv1.CountUpRequest{Number: 3})
+		request.Header().Set("Old-Server", "1")
+		stream, err := client.CallServerStream(context.Background(), request)
+		assert.Nil(t, err)
+		assert.False(t, stream.Receive())
+		assert.Equal(t, connect.CodeOf(stream.Err()), connect.CodeUnavailable)
+		var connectErr *connect.Error
+		assert.True(t, errors.As(stream.Err(), &connectErr))
+		assert.Equal(t, connectErr.Meta().Get("Connect-Reconnect-After-Ms"), "10")
+		assert.Nil(t, stream.Close())
+	})
+}
@@ -20,7 +20,9 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptrace"
 	"sync"
+	"time"
 )
 
 // duplexHTTPCall is a full-duplex stream between the client and server. The
@@ -33,6 +35,11 @@ type duplexHTTPCall struct {
 	httpClient       HTTPClient
 	streamType       StreamType
 	validateResponse func(*http.Response) *Error
+	// readMaxHeaderBytes limits the size of the response headers, if positive.
+	readMaxHeaderBytes int
+	// progress, if non-nil, reports the transfer of the request and response
+	// bodies.
+	progress *transferProgress
 
 	// We'll use a pipe as the request body. We hand the read side of the pipe to
 	// net/http, and we write to the write side (naturally). The two ends are
@@ -47,6 +54,20 @@ type duplexHTTPCall struct {
 
 	errMu sync.Mutex
 	err   error
+
+	// Until we've connected, peer is derived from the URL. Once net/http has a
+	// connection, it's the connection's remote address.
+	peerMu sync.Mutex
+	peer   Peer
+
+	// If cancelGracePeriod is positive, the HTTP request outlives ctx by up to
+	// that long, so the server can flush its response and trailers. The
+	// request is aborted with cancelRequest, and closeReadOnce closes
+	// readClosed when the caller is done with the response.
+	cancelGracePeriod time.Duration
+	cancelRequest     context.CancelFunc
+	closeReadOnce     sync.Once
+	readClosed        chan struct{}
 }
 
 func newDuplexHTTPCall(
@@ -55,24 +76,33 @@ func newDuplexHTTPCall(
 	url string,
 	spec Spec,
 	header http.Header,
+	cancelGracePeriod time.Duration,
 ) *duplexHTTPCall {
 	pipeReader, pipeWriter := io.Pipe()
-	request, err := http.NewRequestWithContext(
-		ctx,
-		http.MethodPost,
-		url,
-		pipeReader,
-	)
-	request.Header = header
 	client := &duplexHTTPCall{
 		ctx:               ctx,
 		httpClient:        httpClient,
 		streamType:        spec.StreamType,
 		requestBodyReader: pipeReader,
 		requestBodyWriter: pipeWriter,
-		request:           request,
 		responseReady:     make(chan struct{}),
+		peer:              newPeerFromURL(url),
+		cancelGracePeriod: cancelGracePeriod,
+		readClosed:        make(chan struct{}),
+	}
+	requestCtx := ctx
+	if cancelGracePeriod > 0 {
+		requestCtx, client.cancelRequest = context.WithCancel(detachedContext{ctx})
 	}
+	trace := &httptrace.ClientTrace{GotConn: client.gotConn}
+	request, err := http.NewRequestWithContext(
+		httptrace.WithClientTrace(requestCtx, trace),
+		http.MethodPost,
+		url,
+		pipeReader,
+	)
+	request.Header = header
+	client.request = request
 	if err != nil {
 		// We can't construct a request, so we definitely can't send it over the
 		// network. Exhaust the sync.Once immediately and short-circuit Read and
@@ -91,11 +121,11 @@ func (d *duplexHTTPCall) Write(data []byte) (int, error) {
 	// Before we send any data, check if the context has been canceled.
 	if err := d.ctx.Err(); err != nil {
 		d.SetError(err)
-		return 0, wrapIfContextError(err)
+		return 0, wrapIfContextDone(d.ctx, err)
 	}
 	// It's safe to write to this side of the pipe while net/http concurrently
 	// reads from the other side.
-	bytesWritten, err := d.requestBodyWriter.Write(data)
+	bytesWritten, err := d.writeBody(data)
 	if err != nil && errors.Is(err, io.ErrClosedPipe) {
 		// Signal that the stream is closed with the more-typical io.EOF instead of
 		// io.ErrClosedPipe. This makes it easier for protocol-specific wrappers to
@@ -105,6 +135,29 @@ func (d *duplexHTTPCall) Write(data []byte) (int, error) {
 	return bytesWritten, err
 }
 
+func (d *duplexHTTPCall) writeBody(data []byte) (int, error) {
+	if d.progress == nil {
+		return d.requestBodyWriter.Write(data)
+	}
+	var total int
+	for len(data) > 0 {
+		chunk := data
+		if len(chunk) > progressChunkSize {
+			chunk = chunk[:progressChunkSize]
+		}
+		n, err := d.requestBodyWriter.Write(chunk)
+		total += n
+		if n > 0 {
+			d.progress.wrote(n)
+		}
+		if err != nil {
+			return total, err
+		}
+		data = data[n:]
+	}
+	return total, nil
+}
+
 // Close the request body. Callers *must* call CloseWrite before Read when
 // using HTTP/1.x.
 func (d *duplexHTTPCall) CloseWrite() error {
@@ -126,6 +179,26 @@ func (d *duplexHTTPCall) CloseWrite() error {
 	return d.requestBodyWriter.Close()
 }
 
+// convertToGet turns the call into a GET request with the given query string
+// and no body. It must be called before anything is written to the request
+// body.
+func (d *duplexHTTPCall) convertToGet(rawQuery string) {
+	url := *d.request.URL
+	url.RawQuery = rawQuery
+	d.request.URL = &url
+	d.request.Method = http.MethodGet
+	d.request.Body = nil
+	d.request.ContentLength = 0
+}
+
+// urlSizeWithQuery returns the length of the request URL if its query string
+// were replaced with rawQuery.
+func (d *duplexHTTPCall) urlSizeWithQuery(rawQuery string) int {
+	url := *d.request.URL
+	url.RawQuery = rawQuery
+	return len(url.String())
+}
+
 // Header returns the HTTP request headers.
 func (d *duplexHTTPCall) Header() http.Header {
 	return d.request.Header
@@ -145,24 +218,33 @@ func (d *duplexHTTPCall) Read(data []byte) (int, error) {
 		// The stream is already closed or corrupted.
 		return 0, err
 	}
-	// Before we read, check if the context has been canceled.
-	if err := d.ctx.Err(); err != nil {
+	// Before we read, check if the context has been canceled. During the
+	// grace period, we keep reading whatever the server sends.
+	if err := d.ctx.Err(); err != nil && d.cancelGracePeriod <= 0 {
 		d.SetError(err)
-		return 0, wrapIfContextError(err)
+		return 0, wrapIfContextDone(d.ctx, err)
 	}
 	if d.response == nil {
 		return 0, fmt.Errorf("nil response from %v", d.request.URL)
 	}
 	n, err := d.response.Body.Read(data)
+	if n > 0 && d.progress != nil {
+		d.progress.read(d.response, n)
+	}
 	return n, wrapIfRSTError(err)
 }
 
 func (d *duplexHTTPCall) CloseRead() error {
+	defer d.closeReadOnce.Do(func() { close(d.readClosed) })
 	d.BlockUntilResponseReady()
 	if d.response == nil {
 		return nil
 	}
-	if err := discard(d.response.Body); err != nil {
+	// Once the response has ended cleanly, SetError has closed the request
+	// body. If the caller hadn't closed it yet, net/http aborts the request
+	// and reading the rest of the response body fails, but there's nothing
+	// left to discard.
+	if err := discard(d.response.Body); err != nil && !errors.Is(d.getError(), io.EOF) {
 		return wrapIfRSTError(err)
 	}
 	return wrapIfRSTError(d.response.Body.Close())
@@ -202,7 +284,7 @@ func (d *duplexHTTPCall) ResponseTrailer() http.Header {
 func (d *duplexHTTPCall) SetError(err error) {
 	d.errMu.Lock()
 	if d.err == nil {
-		d.err = wrapIfContextError(err)
+		d.err = wrapIfContextDone(d.ctx, err)
 	}
 	// Closing the read side of the request body pipe acquires an internal lock,
 	// so we want to scope errMu's usage narrowly and avoid defer.
@@ -218,6 +300,24 @@ func (d *duplexHTTPCall) SetError(err error) {
 	_ = d.requestBodyReader.Close()
 }
 
+// Peer describes the server. Once the request has been sent, Addr is the
+// remote address of the connection used. It's safe to call concurrently with
+// any other method.
+func (d *duplexHTTPCall) Peer() Peer {
+	d.peerMu.Lock()
+	defer d.peerMu.Unlock()
+	return d.peer
+}
+
+func (d *duplexHTTPCall) gotConn(info httptrace.GotConnInfo) {
+	if info.Conn == nil || info.Conn.RemoteAddr() == nil {
+		return
+	}
+	d.peerMu.Lock()
+	d.peer = Peer{Addr: info.Conn.RemoteAddr().String()}
+	d.peerMu.Unlock()
+}
+
 // SetValidateResponse sets the response validation function. The function runs
 // in a background goroutine.
 func (d *duplexHTTPCall) SetValidateResponse(validate func(*http.Response) *Error) {
@@ -230,10 +330,44 @@ func (d *duplexHTTPCall) BlockUntilResponseReady() {
 
 func (d *duplexHTTPCall) ensureRequestMade() {
 	d.sendRequestOnce.Do(func() {
+		if d.cancelRequest != nil {
+			go d.lingerAfterCancel()
+		}
 		go d.makeRequest()
 	})
 }
 
+// lingerAfterCancel aborts the HTTP request once the call's context is done
+// and the grace period has elapsed. During the grace period, the request body
+// is closed but the response can still be read.
+func (d *duplexHTTPCall) lingerAfterCancel() {
+	defer d.cancelRequest()
+	select {
+	case <-d.readClosed:
+		return
+	case <-d.ctx.Done():
+	}
+	// Let the server see the end of the request stream.
+	_ = d.requestBodyWriter.Close()
+	timer := time.NewTimer(d.cancelGracePeriod)
+	defer timer.Stop()
+	select {
+	case <-d.readClosed:
+	case <-timer.C:
+	}
+}
+
+// detachedContext keeps the values of its parent, but not its deadline or
+// cancellation.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (c detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (c detachedContext) Done() <-chan struct{}       { return nil }
+func (c detachedContext) Err() error                  { return nil }
+func (c detachedContext) Value(key any) any           { return c.parent.Value(key) }
+
 func (d *duplexHTTPCall) makeRequest() {
 	// This runs concurrently with Write and CloseWrite. Read and CloseRead wait
 	// on d.responseReady, so we can't race with them.
@@ -243,7 +377,7 @@ func (d *duplexHTTPCall) makeRequest() {
 	// establish the receive side of the stream.
 	response, err := d.httpClient.Do(d.request) //nolint:bodyclose
 	if err != nil {
-		err = wrapIfContextError(err)
+		err = wrapIfContextDone(d.ctx, err)
 		err = wrapIfLikelyH2CNotConfiguredError(d.request, err)
 		err = wrapIfLikelyWithGRPCNotUsedError(err)
 		err = wrapIfRSTError(err)
@@ -254,6 +388,15 @@ func (d *duplexHTTPCall) makeRequest() {
 		return
 	}
 	d.response = response
+	if response.TLS != nil {
+		d.peerMu.Lock()
+		d.peer.AuthInfo = TLSInfo{State: response.TLS}
+		d.peerMu.Unlock()
+	}
+	if err := checkHeaderSize(response.Header, d.readMaxHeaderBytes); err != nil {
+		d.SetError(err)
+		return
+	}
 	if err := d.validateResponse(response); err != nil {
 		d.SetError(err)
 		return
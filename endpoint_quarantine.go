@@ -0,0 +1,148 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// EndpointQuarantine takes endpoints out of rotation for clients configured
+// with [WithLoadBalancing], based on signals the clients can't see for
+// themselves: external health checks, or an orchestrator that's about to
+// restart a server during a deploy. Clients skip quarantined endpoints
+// entirely, and calls fail with [CodeUnavailable] if every endpoint is
+// quarantined.
+//
+// Quarantined endpoints are re-admitted explicitly with
+// [EndpointQuarantine.Readmit], or automatically once a probe succeeds.
+// Quarantines are attached to clients with [WithEndpointQuarantine], and a
+// single quarantine may be shared by many clients.
+type EndpointQuarantine struct {
+	probe    func(ctx context.Context, url string) error
+	interval time.Duration
+
+	mu        sync.Mutex
+	endpoints map[string]*quarantinedEndpoint
+}
+
+type quarantinedEndpoint struct {
+	stop chan struct{}
+}
+
+// NewEndpointQuarantine constructs an EndpointQuarantine. While an endpoint
+// is quarantined, probe is called with its base URL every interval, with a
+// context that expires after the interval; the endpoint is re-admitted as
+// soon as probe returns nil. If probe is nil or interval isn't positive,
+// endpoints stay quarantined until they're re-admitted explicitly.
+func NewEndpointQuarantine(probe func(ctx context.Context, url string) error, interval time.Duration) *EndpointQuarantine {
+	return &EndpointQuarantine{
+		probe:     probe,
+		interval:  interval,
+		endpoints: make(map[string]*quarantinedEndpoint),
+	}
+}
+
+// WithEndpointQuarantine skips the endpoints quarantined by an
+// [EndpointQuarantine]. It requires [WithLoadBalancing].
+//
+// By default, clients only skip endpoints they've failed to reach.
+func WithEndpointQuarantine(quarantine *EndpointQuarantine) ClientOption {
+	return &endpointQuarantineOption{Quarantine: quarantine}
+}
+
+// Quarantine takes the endpoint with the supplied base URL out of rotation
+// and starts probing it. Calls already in flight aren't affected.
+// Quarantining an endpoint that's already quarantined is a no-op.
+func (q *EndpointQuarantine) Quarantine(url string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.endpoints[url]; ok {
+		return
+	}
+	endpoint := &quarantinedEndpoint{stop: make(chan struct{})}
+	q.endpoints[url] = endpoint
+	if q.probe != nil && q.interval > 0 {
+		go q.probeUntilReadmitted(url, endpoint)
+	}
+}
+
+// Readmit returns the endpoint with the supplied base URL to rotation and
+// stops probing it. Re-admitting an endpoint that isn't quarantined is a
+// no-op.
+func (q *EndpointQuarantine) Readmit(url string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.readmitLocked(url, nil)
+}
+
+// Quarantined reports whether the endpoint with the supplied base URL is
+// quarantined.
+func (q *EndpointQuarantine) Quarantined(url string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	_, ok := q.endpoints[url]
+	return ok
+}
+
+// filter returns the URLs that aren't quarantined.
+func (q *EndpointQuarantine) filter(urls []string) []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.endpoints) == 0 {
+		return urls
+	}
+	admitted := make([]string, 0, len(urls))
+	for _, url := range urls {
+		if _, ok := q.endpoints[url]; !ok {
+			admitted = append(admitted, url)
+		}
+	}
+	return admitted
+}
+
+// readmitLocked re-admits the endpoint. If only is non-nil, the endpoint is
+// only re-admitted if it hasn't been re-admitted and quarantined again since
+// only was created.
+func (q *EndpointQuarantine) readmitLocked(url string, only *quarantinedEndpoint) {
+	endpoint, ok := q.endpoints[url]
+	if !ok || (only != nil && endpoint != only) {
+		return
+	}
+	delete(q.endpoints, url)
+	close(endpoint.stop)
+}
+
+func (q *EndpointQuarantine) probeUntilReadmitted(url string, endpoint *quarantinedEndpoint) {
+	ticker := time.NewTicker(q.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-endpoint.stop:
+			return
+		case <-ticker.C:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), q.interval)
+		err := q.probe(ctx, url)
+		cancel()
+		if err == nil {
+			q.mu.Lock()
+			q.readmitLocked(url, endpoint)
+			q.mu.Unlock()
+			return
+		}
+	}
+}
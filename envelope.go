@@ -15,15 +15,25 @@
 package connect
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/binary"
 	"errors"
 	"io"
+	"net/http"
+	"net/textproto"
 )
 
-// flagEnvelopeCompressed indicates that the data is compressed. It has the
-// same meaning in the gRPC-Web, gRPC-HTTP2, and Connect protocols.
-const flagEnvelopeCompressed = 0b00000001
+const (
+	// flagEnvelopeCompressed indicates that the data is compressed. It has the
+	// same meaning in the gRPC-Web, gRPC-HTTP2, and Connect protocols.
+	flagEnvelopeCompressed = 0b00000001
+	// flagEnvelopeMetadata indicates that the data is a block of per-message
+	// metadata annotating the next message. None of the gRPC-Web, gRPC-HTTP2,
+	// or Connect protocols assign a meaning to this bit, so it's only used
+	// after both parties opt in.
+	flagEnvelopeMetadata = 0b00000100
+)
 
 var errSpecialEnvelope = errorf(
 	CodeUnknown,
@@ -49,25 +59,65 @@ func (e *envelope) IsSet(flag uint8) bool {
 }
 
 type envelopeWriter struct {
-	writer           io.Writer
-	codec            Codec
-	compressMinBytes int
-	compressionPool  *compressionPool
-	bufferPool       *bufferPool
-	sendMaxBytes     int
+	writer            io.Writer
+	codec             Codec
+	compressMinBytes  int
+	compressPolicy    func(size int) bool // overrides compressMinBytes
+	signPayload       func([]byte) *Error
+	compressionPool   *compressionPool
+	compressionName   string
+	bufferPool        *bufferPool
+	sendMaxBytes      int
+	firstSendMaxBytes int // overrides sendMaxBytes for the first message
+	wroteFirst        bool
+	sendMetadata      bool
+	envelopeFlags     *envelopeFlagSet // negotiated experimental flags
+	timer             *serializationTimer
+
+	uncompressedBytes int64
+	compressedBytes   int64
 }
 
 func (w *envelopeWriter) Marshal(message any) *Error {
-	raw, err := w.codec.Marshal(message)
+	return w.MarshalWithFlags(message, 0)
+}
+
+// MarshalWithFlags marshals and writes a message, setting the supplied
+// experimental envelope flags. Flags that weren't negotiated are dropped.
+func (w *envelopeWriter) MarshalWithFlags(message any, flags uint8) *Error {
+	start := w.timer.start()
+	raw, err := marshalMessage(w.codec, message)
 	if err != nil {
 		return errorf(CodeInternal, "marshal message: %w", err)
 	}
+	w.timer.observe(SerializationMarshal, start, len(raw))
 	// We can't avoid allocating the byte slice, so we may as well reuse it once
 	// we're done with it.
 	buffer := bytes.NewBuffer(raw)
 	defer w.bufferPool.Put(buffer)
-	envelope := &envelope{Data: buffer}
-	return w.Write(envelope)
+	envelope := &envelope{Data: buffer, Flags: flags & w.envelopeFlags.mask()}
+	if err := w.Write(envelope); err != nil {
+		return err
+	}
+	w.wroteFirst = true
+	return nil
+}
+
+// WriteMetadata writes a block of metadata annotating the next message. It's a
+// no-op if the other party hasn't opted into per-message metadata.
+func (w *envelopeWriter) WriteMetadata(metadata http.Header) *Error {
+	if !w.sendMetadata || len(metadata) == 0 {
+		return nil
+	}
+	raw := w.bufferPool.Get()
+	defer w.bufferPool.Put(raw)
+	if err := metadata.Write(raw); err != nil {
+		return errorf(CodeInternal, "format message metadata: %w", err)
+	}
+	return w.Write(&envelope{
+		Data:  raw,
+		Flags: flagEnvelopeMetadata,
+	})
 }
 
 // Write writes the enveloped message, compressing as necessary. It doesn't
@@ -75,30 +125,48 @@ func (w *envelopeWriter) Marshal(message any) *Error {
 func (w *envelopeWriter) Write(env *envelope) *Error {
 	if env.IsSet(flagEnvelopeCompressed) ||
 		w.compressionPool == nil ||
-		env.Data.Len() < w.compressMinBytes {
-		if w.sendMaxBytes > 0 && env.Data.Len() > w.sendMaxBytes {
-			return errorf(CodeResourceExhausted, "message size %d exceeds sendMaxBytes %d", env.Data.Len(), w.sendMaxBytes)
+		!shouldCompress(env.Data.Len(), w.compressMinBytes, w.compressPolicy) {
+		if max := w.maxBytes(); max > 0 && env.Data.Len() > max {
+			return errorf(CodeResourceExhausted, "message size %d exceeds sendMaxBytes %d", env.Data.Len(), max)
 		}
+		w.uncompressedBytes += int64(env.Data.Len())
+		w.compressedBytes += int64(env.Data.Len())
 		return w.write(env)
 	}
+	uncompressed := env.Data.Len()
 	data := w.bufferPool.Get()
 	defer w.bufferPool.Put(data)
+	start := w.timer.start()
 	if err := w.compressionPool.Compress(data, env.Data); err != nil {
 		return err
 	}
-	if w.sendMaxBytes > 0 && data.Len() > w.sendMaxBytes {
-		return errorf(CodeResourceExhausted, "compressed message size %d exceeds sendMaxBytes %d", data.Len(), w.sendMaxBytes)
+	w.timer.observe(SerializationCompress, start, uncompressed)
+	if max := w.maxBytes(); max > 0 && data.Len() > max {
+		return errorf(CodeResourceExhausted, "compressed message size %d exceeds sendMaxBytes %d", data.Len(), max)
 	}
+	w.uncompressedBytes += int64(uncompressed)
+	w.compressedBytes += int64(data.Len())
 	return w.write(&envelope{
 		Data:  data,
 		Flags: env.Flags | flagEnvelopeCompressed,
 	})
 }
 
+// maxBytes returns the size limit for the next message.
+func (w *envelopeWriter) maxBytes() int {
+	return firstMessageMaxBytes(w.wroteFirst, w.firstSendMaxBytes, w.sendMaxBytes)
+}
+
 func (w *envelopeWriter) write(env *envelope) *Error {
+	if w.signPayload != nil && env.Flags&flagEnvelopeMetadata == 0 {
+		if err := w.signPayload(env.Data.Bytes()); err != nil {
+			return err
+		}
+	}
 	prefix := [5]byte{}
 	prefix[0] = env.Flags
 	binary.BigEndian.PutUint32(prefix[1:5], uint32(env.Data.Len()))
+	expectRequestBytes(w.writer, len(prefix)+env.Data.Len())
 	if _, err := w.writer.Write(prefix[:]); err != nil {
 		if connectErr, ok := asError(err); ok {
 			return connectErr
@@ -112,26 +180,50 @@ func (w *envelopeWriter) write(env *envelope) *Error {
 }
 
 type envelopeReader struct {
-	reader          io.Reader
-	codec           Codec
-	last            envelope
-	compressionPool *compressionPool
-	bufferPool      *bufferPool
-	readMaxBytes    int
+	reader            io.Reader
+	codec             Codec
+	last              envelope
+	compressionPool   *compressionPool
+	bufferPool        *bufferPool
+	readMaxBytes      int
+	firstReadMaxBytes int // overrides readMaxBytes for the first message
+	readFirst         bool
+	readMetadata      bool
+	metadata          http.Header      // annotates the most recently read message
+	annotated         bool             // currently reading an annotated message
+	envelopeFlags     *envelopeFlagSet // negotiated experimental flags
+	flags             uint8            // experimental flags on the most recently read message
+	retainOverLimit   bool             // keep a prefix of over-limit messages in errors
+	verifyPayload     func([]byte) *Error
+	timer             *serializationTimer
 }
 
 func (r *envelopeReader) Unmarshal(message any) *Error {
 	buffer := r.bufferPool.Get()
 	defer r.bufferPool.Put(buffer)
 
+	r.metadata = nil
+	r.flags = 0
 	env := &envelope{Data: buffer}
 	err := r.Read(env)
+	if err == nil {
+		// Strip negotiated experimental flags before checking for
+		// protocol-defined ones.
+		r.flags = env.Flags & r.envelopeFlags.mask()
+		env.Flags &^= r.flags
+	}
+	if err == nil && r.verifyPayload != nil && env.Flags&^flagEnvelopeCompressed == 0 {
+		if verifyErr := r.verifyPayload(env.Data.Bytes()); verifyErr != nil {
+			return verifyErr
+		}
+	}
 	switch {
 	case err == nil &&
 		(env.Flags == 0 || env.Flags == flagEnvelopeCompressed) &&
 		env.Data.Len() == 0:
 		// This is a standard message (because none of the top 7 bits are set) and
 		// there's no data, so the zero value of the message is correct.
+		r.readFirst = true
 		return nil
 	case err != nil && errors.Is(err, io.EOF):
 		// The stream has ended. Propagate the EOF to the caller.
@@ -151,12 +243,33 @@ func (r *envelopeReader) Unmarshal(message any) *Error {
 		}
 		decompressed := r.bufferPool.Get()
 		defer r.bufferPool.Put(decompressed)
-		if err := r.compressionPool.Decompress(decompressed, data, int64(r.readMaxBytes)); err != nil {
+		start := r.timer.start()
+		if err := r.compressionPool.Decompress(decompressed, data, int64(r.maxBytes())); err != nil {
 			return err
 		}
+		r.timer.observe(SerializationDecompress, start, decompressed.Len())
 		data = decompressed
 	}
 
+	if r.readMetadata && env.Flags&^flagEnvelopeCompressed == flagEnvelopeMetadata {
+		// This envelope annotates the next message, so we need to keep reading.
+		if r.annotated {
+			return errorf(CodeInternal, "protocol error: consecutive message metadata envelopes")
+		}
+		metadata, parseErr := parseHeaderBlock(data)
+		if parseErr != nil {
+			return errorf(CodeInternal, "protocol error: invalid message metadata: %w", parseErr)
+		}
+		r.annotated = true
+		err := r.Unmarshal(message)
+		r.annotated = false
+		if err != nil {
+			return err
+		}
+		r.metadata = metadata
+		return nil
+	}
+
 	if env.Flags != 0 && env.Flags != flagEnvelopeCompressed {
 		// One of the protocol-specific flags are set, so this is the end of the
 		// stream. Save the message for protocol-specific code to process and
@@ -174,12 +287,20 @@ func (r *envelopeReader) Unmarshal(message any) *Error {
 		return errSpecialEnvelope
 	}
 
-	if err := r.codec.Unmarshal(data.Bytes(), message); err != nil {
+	start := r.timer.start()
+	if err := unmarshalMessage(r.codec, data.Bytes(), message); err != nil {
 		return errorf(CodeInvalidArgument, "unmarshal into %T: %w", message, err)
 	}
+	r.timer.observe(SerializationUnmarshal, start, data.Len())
+	r.readFirst = true
 	return nil
 }
 
+// maxBytes returns the size limit for the next message.
+func (r *envelopeReader) maxBytes() int {
+	return firstMessageMaxBytes(r.readFirst, r.firstReadMaxBytes, r.readMaxBytes)
+}
+
 func (r *envelopeReader) Read(env *envelope) *Error {
 	prefixes := [5]byte{}
 	prefixBytesRead, err := r.reader.Read(prefixes[:])
@@ -205,6 +326,10 @@ func (r *envelopeReader) Read(env *envelope) *Error {
 			// We're reading from an http.MaxBytesHandler, and we've exceeded the read limit.
 			return maxBytesErr
 		}
+		if rstErr, ok := asError(wrapIfRSTError(err)); ok {
+			// The peer reset the stream, usually because it was canceled.
+			return rstErr
+		}
 		return errorf(
 			CodeInvalidArgument,
 			"protocol error: incomplete envelope: %w", err,
@@ -214,12 +339,16 @@ func (r *envelopeReader) Read(env *envelope) *Error {
 	if size < 0 {
 		return errorf(CodeInvalidArgument, "message size %d overflowed uint32", size)
 	}
-	if r.readMaxBytes > 0 && size > r.readMaxBytes {
-		_, err := io.CopyN(io.Discard, r.reader, int64(size))
-		if err != nil && !errors.Is(err, io.EOF) {
+	if max := r.maxBytes(); max > 0 && size > max {
+		var retain int
+		if r.retainOverLimit {
+			retain = max
+		}
+		prefix, err := discardMessage(r.reader, int64(size), retain)
+		if err != nil {
 			return errorf(CodeUnknown, "read enveloped message: %w", err)
 		}
-		return errorf(CodeResourceExhausted, "message size %d is larger than configured max %d", size, r.readMaxBytes)
+		return newMessageTooLargeError(int64(size), int64(max), prefix)
 	}
 	if size > 0 {
 		env.Data.Grow(size)
@@ -235,6 +364,9 @@ func (r *envelopeReader) Read(env *envelope) *Error {
 					// We're reading from an http.MaxBytesHandler, and we've exceeded the read limit.
 					return maxBytesErr
 				}
+				if rstErr, ok := asError(wrapIfRSTError(err)); ok {
+					return rstErr
+				}
 				return errorf(CodeUnknown, "read enveloped message: %w", err)
 			}
 			if errors.Is(err, io.EOF) && bytesRead == 0 {
@@ -254,6 +386,21 @@ func (r *envelopeReader) Read(env *envelope) *Error {
 	return nil
 }
 
+// parseHeaderBlock parses an HTTP/1 headers block without the terminating
+// newline.
+func parseHeaderBlock(data *bytes.Buffer) (http.Header, error) {
+	// To make the headers parseable by net/textproto, we need to add the
+	// newline.
+	if err := data.WriteByte('\n'); err != nil {
+		return nil, err
+	}
+	mimeHeader, err := textproto.NewReader(bufio.NewReader(data)).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	return http.Header(mimeHeader), nil
+}
+
 func isSizeZeroPrefix(prefix [5]byte) bool {
 	for i := 1; i < 5; i++ {
 		if prefix[i] != 0 {
@@ -0,0 +1,235 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// headerEnvelopeFlags lists the experimental envelope flags a party
+	// understands, as comma-separated name=bit pairs. Clients set it on
+	// requests when WithEnvelopeFlags is used, and handlers echo back the
+	// subset they've agreed to.
+	headerEnvelopeFlags = "Connect-Envelope-Flags"
+
+	// The gRPC-Web, gRPC-HTTP2, and Connect protocols and per-message metadata
+	// use bits 0, 1, 2, and 7 of the envelope's flags byte. The rest are
+	// available for experimental features.
+	minEnvelopeFlagBit = 3
+	maxEnvelopeFlagBit = 6
+)
+
+// EnvelopeFlag assigns a name to one of the reserved bits in the envelope
+// prefix of streaming messages. Registering flags with [WithEnvelopeFlags]
+// lets experimental features (for example, per-message checksums or
+// priorities) mark individual messages without changing the framing code.
+//
+// Bit is the zero-based index of the flag in the envelope's flags byte. Only
+// bits 3 through 6 are available: the others have protocol-defined meanings.
+// Names must be non-empty and may not contain whitespace, commas, or equals
+// signs.
+type EnvelopeFlag struct {
+	Name string
+	Bit  uint8
+}
+
+func (f EnvelopeFlag) validate() error {
+	if f.Bit < minEnvelopeFlagBit || f.Bit > maxEnvelopeFlagBit {
+		return fmt.Errorf(
+			"envelope flag %q: bit %d is reserved, use bits %d through %d",
+			f.Name, f.Bit, minEnvelopeFlagBit, maxEnvelopeFlagBit,
+		)
+	}
+	if f.Name == "" || strings.ContainsAny(f.Name, " \t,=") {
+		return fmt.Errorf("envelope flag %q: invalid name", f.Name)
+	}
+	return nil
+}
+
+func (f EnvelopeFlag) mask() uint8 {
+	return 1 << f.Bit
+}
+
+// SendWithEnvelopeFlags sends a message on a streaming connection, setting the
+// named envelope flags on it. The connection is usually a StreamingClientConn
+// or StreamingHandlerConn obtained from a stream's Conn method.
+//
+// Flags are only set if both the client and handler have registered them with
+// [WithEnvelopeFlags]. Unknown or unnegotiated flags are silently dropped, as
+// are all flags if interceptors have wrapped the connection.
+func SendWithEnvelopeFlags(conn interface{ Send(any) error }, msg any, flags ...string) error {
+	if conn, ok := conn.(envelopeFlagsConn); ok {
+		return conn.SendWithEnvelopeFlags(msg, flags)
+	}
+	return conn.Send(msg)
+}
+
+// ReceiveWithEnvelopeFlags receives a message from a streaming connection,
+// along with the names of any envelope flags the sender set on it with
+// [SendWithEnvelopeFlags]. If no flags were set or none were negotiated, the
+// returned slice is nil.
+func ReceiveWithEnvelopeFlags(conn interface{ Receive(any) error }, msg any) ([]string, error) {
+	if conn, ok := conn.(envelopeFlagsConn); ok {
+		return conn.ReceiveWithEnvelopeFlags(msg)
+	}
+	return nil, conn.Receive(msg)
+}
+
+// envelopeFlagsConn is implemented by the streaming connections that support
+// experimental envelope flags.
+type envelopeFlagsConn interface {
+	SendWithEnvelopeFlags(any, []string) error
+	ReceiveWithEnvelopeFlags(any) ([]string, error)
+}
+
+// envelopeFlagSet is a validated collection of envelope flags, ordered by
+// bit. A nil set has no flags.
+type envelopeFlagSet struct {
+	flags []EnvelopeFlag
+}
+
+// newEnvelopeFlagSet collects flags into a set, skipping any invalid flags.
+// Later flags replace earlier ones with the same name or bit.
+func newEnvelopeFlagSet(flags []EnvelopeFlag) *envelopeFlagSet {
+	var byBit [maxEnvelopeFlagBit + 1]*EnvelopeFlag
+	for i := range flags {
+		flag := flags[i]
+		if flag.validate() != nil {
+			continue
+		}
+		for bit, existing := range byBit {
+			if existing != nil && existing.Name == flag.Name {
+				byBit[bit] = nil
+			}
+		}
+		byBit[flag.Bit] = &flag
+	}
+	var set *envelopeFlagSet
+	for _, flag := range byBit {
+		if flag == nil {
+			continue
+		}
+		if set == nil {
+			set = &envelopeFlagSet{}
+		}
+		set.flags = append(set.flags, *flag)
+	}
+	return set
+}
+
+// parseEnvelopeFlagSet parses the value of the Connect-Envelope-Flags header,
+// skipping any malformed entries.
+func parseEnvelopeFlagSet(value string) *envelopeFlagSet {
+	var flags []EnvelopeFlag
+	for _, entry := range strings.Split(value, ",") {
+		name, rawBit, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			continue
+		}
+		bit, err := strconv.ParseUint(rawBit, 10 /* base */, 8 /* bitsize */)
+		if err != nil {
+			continue
+		}
+		flags = append(flags, EnvelopeFlag{Name: name, Bit: uint8(bit)})
+	}
+	return newEnvelopeFlagSet(flags)
+}
+
+// mask returns the bits used by the set.
+func (s *envelopeFlagSet) mask() uint8 {
+	if s == nil {
+		return 0
+	}
+	var mask uint8
+	for _, flag := range s.flags {
+		mask |= flag.mask()
+	}
+	return mask
+}
+
+// bits converts flag names to the corresponding bits, ignoring any names that
+// aren't in the set.
+func (s *envelopeFlagSet) bits(names []string) uint8 {
+	if s == nil {
+		return 0
+	}
+	var bits uint8
+	for _, name := range names {
+		for _, flag := range s.flags {
+			if flag.Name == name {
+				bits |= flag.mask()
+			}
+		}
+	}
+	return bits
+}
+
+// names converts bits to the corresponding flag names, ignoring any bits that
+// aren't in the set.
+func (s *envelopeFlagSet) names(bits uint8) []string {
+	if s == nil || bits == 0 {
+		return nil
+	}
+	var names []string
+	for _, flag := range s.flags {
+		if bits&flag.mask() != 0 {
+			names = append(names, flag.Name)
+		}
+	}
+	return names
+}
+
+// String formats the set as a Connect-Envelope-Flags header value.
+func (s *envelopeFlagSet) String() string {
+	if s == nil {
+		return ""
+	}
+	entries := make([]string, len(s.flags))
+	for i, flag := range s.flags {
+		entries[i] = flag.Name + "=" + strconv.Itoa(int(flag.Bit))
+	}
+	return strings.Join(entries, ", ")
+}
+
+// negotiateEnvelopeFlags returns the flags that both the handler and client
+// have registered with the same bit. If there are any, it acknowledges them
+// in the response headers.
+func negotiateEnvelopeFlags(registered *envelopeFlagSet, requestHeader, responseHeader http.Header) *envelopeFlagSet {
+	if registered == nil {
+		return nil
+	}
+	requested := parseEnvelopeFlagSet(requestHeader.Get(headerEnvelopeFlags))
+	if requested == nil {
+		return nil
+	}
+	var agreed []EnvelopeFlag
+	for _, flag := range registered.flags {
+		for _, candidate := range requested.flags {
+			if flag == candidate {
+				agreed = append(agreed, flag)
+			}
+		}
+	}
+	if len(agreed) == 0 {
+		return nil
+	}
+	negotiated := &envelopeFlagSet{flags: agreed}
+	responseHeader[headerEnvelopeFlags] = []string{negotiated.String()}
+	return negotiated
+}
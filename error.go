@@ -18,6 +18,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"strings"
@@ -41,6 +42,7 @@ const (
 // variety of Protobuf messages commonly used as error details.
 type ErrorDetail struct {
 	pb       *anypb.Any
+	resolver TypeResolver
 	wireJSON string // preserve human-readable JSON
 }
 
@@ -75,10 +77,14 @@ func (d *ErrorDetail) Bytes() []byte {
 }
 
 // Value uses the Protobuf runtime's package-global registry to unmarshal the
-// Detail into a strongly-typed message. Typically, clients use Go type
-// assertions to cast from the proto.Message interface to concrete types.
+// Detail into a strongly-typed message, unless the client was configured with
+// [WithTypeResolver]. Typically, clients use Go type assertions to cast from
+// the proto.Message interface to concrete types.
 func (d *ErrorDetail) Value() (proto.Message, error) {
-	return d.pb.UnmarshalNew()
+	if d.resolver == nil {
+		return d.pb.UnmarshalNew()
+	}
+	return anypb.UnmarshalNew(d.pb, proto.UnmarshalOptions{Resolver: d.resolver})
 }
 
 // An Error captures four key pieces of information: a [Code], an underlying Go
@@ -105,6 +111,11 @@ type Error struct {
 	details []*ErrorDetail
 	meta    http.Header
 	wireErr bool
+
+	// Set by NewErrorWithMetadata. Handlers send these as ordinary response
+	// headers and trailers.
+	responseHeader  http.Header
+	responseTrailer http.Header
 }
 
 // NewError annotates any Go error with a status code.
@@ -112,6 +123,25 @@ func NewError(c Code, underlying error) *Error {
 	return &Error{code: c, err: underlying}
 }
 
+// NewErrorWithMetadata is like [NewError], but it also carries response
+// headers and trailers. When a handler or interceptor returns the error, they're
+// sent exactly as if they'd been set on a successful response, regardless of
+// the protocol: for example, rate limiting headers on a [CodeResourceExhausted]
+// error. Headers are dropped if a streaming handler has already sent them.
+// Either header may be nil.
+//
+// Unlike [Error.Meta], whose placement depends on the protocol and stream
+// type, these headers and trailers are kept apart on the wire. Clients see
+// them in the error's metadata.
+func NewErrorWithMetadata(c Code, underlying error, header, trailer http.Header) *Error {
+	return &Error{
+		code:            c,
+		err:             underlying,
+		responseHeader:  header,
+		responseTrailer: trailer,
+	}
+}
+
 // IsWireError checks whether the error was returned by the server, as opposed
 // to being synthesized by the client.
 //
@@ -181,6 +211,14 @@ func (e *Error) Meta() http.Header {
 	return e.meta
 }
 
+// setTypeResolver configures the error's details to unmarshal their values
+// using the supplied resolver.
+func (e *Error) setTypeResolver(resolver TypeResolver) {
+	for _, detail := range e.details {
+		detail.resolver = resolver
+	}
+}
+
 func (e *Error) detailsAsAny() []*anypb.Any {
 	anys := make([]*anypb.Any, 0, len(e.details))
 	for _, detail := range e.details {
@@ -217,6 +255,27 @@ func wrapIfUncoded(err error) error {
 	return NewError(CodeUnknown, maybeCodedErr)
 }
 
+// toError is like wrapIfUncoded, but it guarantees that the returned error is
+// an *Error rather than an error wrapping one. Errors that wrap an *Error keep
+// its code, details, and metadata, and remain the underlying error.
+func toError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if connectErr, ok := err.(*Error); ok { //nolint:errorlint
+		return connectErr
+	}
+	wrapped := wrapIfUncoded(err)
+	connectErr, _ := asError(wrapped)
+	if wrapped != err { //nolint:errorlint,goerr113
+		// wrapIfUncoded allocated a new *Error.
+		return connectErr
+	}
+	coded := *connectErr
+	coded.err = err
+	return &coded
+}
+
 // wrapIfContextError applies CodeCanceled or CodeDeadlineExceeded to Go's
 // context.Canceled and context.DeadlineExceeded errors, but only if they
 // haven't already been wrapped.
@@ -236,6 +295,91 @@ func wrapIfContextError(err error) error {
 	return err
 }
 
+// wrapIfContextDone is like wrapIfContextError, but it also consults the
+// context's cause. If the context was canceled with a more descriptive cause
+// (for example, by context.WithCancelCause), the cause is included in the
+// error message and drives the choice of code: a cause that's an *Error keeps
+// its code, and a cause wrapping context.DeadlineExceeded is reported as
+// CodeDeadlineExceeded even if the context was canceled explicitly.
+func wrapIfContextDone(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	ctxErr := ctx.Err()
+	if ctxErr == nil || !errors.Is(err, ctxErr) {
+		return wrapIfContextError(err)
+	}
+	if _, ok := asError(err); ok {
+		return err
+	}
+	cause := contextCause(ctx)
+	if cause == nil || cause == ctxErr { //nolint:errorlint
+		return wrapIfContextError(err)
+	}
+	if connectErr, ok := asError(cause); ok {
+		return connectErr
+	}
+	return NewError(contextCode(ctxErr, cause), &contextCauseError{err: err, cause: cause})
+}
+
+// wrapIfStreamContextDone codes errors from sending or receiving stream
+// messages after the stream's context is done. Once the context is done, the
+// underlying network errors (for example, a reset HTTP/2 stream) are just a
+// symptom, so we code them as CodeCanceled or CodeDeadlineExceeded and
+// preserve the context's cause. Errors that are already coded and io.EOF
+// pass through unchanged.
+func wrapIfStreamContextDone(ctx context.Context, err error) error {
+	if err == nil || errors.Is(err, io.EOF) {
+		return err
+	}
+	if _, ok := asError(err); ok {
+		return err
+	}
+	ctxErr := ctx.Err()
+	if ctxErr == nil {
+		return err
+	}
+	if errors.Is(err, ctxErr) {
+		return wrapIfContextDone(ctx, err)
+	}
+	cause := contextCause(ctx)
+	if cause == nil {
+		cause = ctxErr
+	}
+	if connectErr, ok := asError(cause); ok {
+		return connectErr
+	}
+	return NewError(contextCode(ctxErr, cause), &contextCauseError{err: err, cause: cause})
+}
+
+// contextCode chooses the code for an error caused by a done context.
+func contextCode(ctxErr, cause error) Code {
+	if errors.Is(ctxErr, context.DeadlineExceeded) || errors.Is(cause, context.DeadlineExceeded) {
+		return CodeDeadlineExceeded
+	}
+	return CodeCanceled
+}
+
+// contextCauseError decorates an error with the cause of the context that
+// triggered it. It unwraps to the cause, but still matches the original error
+// with errors.Is.
+type contextCauseError struct {
+	err   error
+	cause error
+}
+
+func (e *contextCauseError) Error() string {
+	return e.err.Error() + ": " + e.cause.Error()
+}
+
+func (e *contextCauseError) Unwrap() error {
+	return e.cause
+}
+
+func (e *contextCauseError) Is(target error) bool {
+	return errors.Is(e.err, target)
+}
+
 // wrapIfLikelyWithGRPCNotUsedError adds a wrapping error that has a message
 // telling the caller that they likely need to use h2c but are using a raw http.Client{}.
 //
@@ -287,7 +431,7 @@ func wrapIfLikelyWithGRPCNotUsedError(err error) error {
 }
 
 // HTTP/2 has its own set of error codes, which it sends in RST_STREAM frames.
-// When the server sends one of these errors, we should map it back into our
+// When the peer sends one of these errors, we should map it back into our
 // RPC error codes following
 // https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-HTTP2.md#http2-transport-mapping.
 //
@@ -315,9 +459,8 @@ func wrapIfRSTError(err error) error {
 	if !strings.HasPrefix(msg, streamErrPrefix) {
 		return err
 	}
-	if !strings.HasSuffix(msg, fromPeerSuffix) {
-		return err
-	}
+	// Clients see errors received from the server with a suffix, but handlers
+	// reading the request body see the client's errors without it.
 	msg = strings.TrimSuffix(msg, fromPeerSuffix)
 	i := strings.LastIndex(msg, ";")
 	if i < 0 || i >= len(msg)-1 {
@@ -0,0 +1,81 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// ProblemJSONContentType is the media type of RFC 7807 problem details.
+const ProblemJSONContentType = "application/problem+json"
+
+// An ErrorFormatter serializes the error body of a Connect unary response.
+type ErrorFormatter func(*Error) ([]byte, error)
+
+// FormatProblemJSON is an [ErrorFormatter] that produces RFC 7807 problem
+// details. The status is the HTTP status Connect uses for the error's [Code],
+// the title is the standard text for that status, and the detail is the error
+// message. The Connect code is also included as the "code" extension member.
+//
+// Register it with WithErrorFormatter(ProblemJSONContentType, FormatProblemJSON).
+func FormatProblemJSON(err *Error) ([]byte, error) {
+	status := connectCodeToHTTP(err.Code())
+	return json.Marshal(struct {
+		Type   string `json:"type"`
+		Title  string `json:"title"`
+		Status int    `json:"status"`
+		Detail string `json:"detail,omitempty"`
+		Code   Code   `json:"code"`
+	}{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: err.Message(),
+		Code:   err.Code(),
+	})
+}
+
+// baseMediaType strips any parameters from a content type.
+func baseMediaType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentType
+	}
+	return mediaType
+}
+
+// negotiateErrorFormatter returns the first formatter whose content type the
+// client accepts. Wildcards don't select custom formatters, so clients that
+// don't ask for a specific error format get the default Connect JSON.
+func negotiateErrorFormatter(formatters map[string]ErrorFormatter, request *http.Request) (string, ErrorFormatter) {
+	if len(formatters) == 0 {
+		return "", nil
+	}
+	for _, value := range request.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(value, ",") {
+			mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+			if err != nil {
+				continue
+			}
+			if format, ok := formatters[mediaType]; ok {
+				return mediaType, format
+			}
+		}
+	}
+	return "", nil
+}
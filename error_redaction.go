@@ -0,0 +1,79 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import "errors"
+
+// An ErrorRedactionPolicy controls how much of an error handlers send to
+// clients. Redaction applies to errors returned by handler implementations
+// and interceptors: errors generated by connect-go itself, like malformed
+// requests and timeouts, never contain internal details. Redacted errors keep
+// their code, metadata, and any approved details.
+//
+// The zero value redacts the messages of [CodeInternal] and [CodeUnknown]
+// errors, including errors without a code, and drops all of their details.
+type ErrorRedactionPolicy struct {
+	// Codes lists the codes whose errors are redacted. If empty, errors with
+	// CodeInternal and CodeUnknown are redacted.
+	Codes []Code
+	// Message replaces the messages of redacted errors. If empty, clients see
+	// only the code.
+	Message string
+	// AllowDetail reports whether a detail may be sent with a redacted error.
+	// If nil, redacted errors carry no details.
+	AllowDetail func(*ErrorDetail) bool
+}
+
+// redact returns the version of the error sent to clients. Since the handler
+// still returns the original error, logs and metrics keep the full detail.
+func (p *ErrorRedactionPolicy) redact(err error) error {
+	if p == nil || err == nil {
+		return err
+	}
+	connectErr, ok := asError(wrapIfUncoded(err))
+	if !ok || !p.applies(connectErr.Code()) {
+		return err
+	}
+	redacted := &Error{
+		code:            connectErr.code,
+		meta:            connectErr.meta,
+		wireErr:         connectErr.wireErr,
+		responseHeader:  connectErr.responseHeader,
+		responseTrailer: connectErr.responseTrailer,
+	}
+	if p.Message != "" {
+		redacted.err = errors.New(p.Message)
+	}
+	if p.AllowDetail != nil {
+		for _, detail := range connectErr.details {
+			if p.AllowDetail(detail) {
+				redacted.details = append(redacted.details, detail)
+			}
+		}
+	}
+	return redacted
+}
+
+func (p *ErrorRedactionPolicy) applies(code Code) bool {
+	if len(p.Codes) == 0 {
+		return code == CodeInternal || code == CodeUnknown
+	}
+	for _, redacted := range p.Codes {
+		if code == redacted {
+			return true
+		}
+	}
+	return false
+}
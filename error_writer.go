@@ -35,6 +35,7 @@ type ErrorWriter struct {
 	grpcWebContentTypes          map[string]struct{}
 	unaryConnectContentTypes     map[string]struct{}
 	streamingConnectContentTypes map[string]struct{}
+	grpcStatusInErrors           bool
 }
 
 // NewErrorWriter constructs an ErrorWriter. To properly recognize supported
@@ -50,14 +51,17 @@ func NewErrorWriter(opts ...HandlerOption) *ErrorWriter {
 		grpcWebContentTypes:          make(map[string]struct{}),
 		unaryConnectContentTypes:     make(map[string]struct{}),
 		streamingConnectContentTypes: make(map[string]struct{}),
+		grpcStatusInErrors:           config.GRPCStatusInErrors,
 	}
-	for name := range config.Codecs {
-		unary := connectContentTypeFromCodecName(StreamTypeUnary, name)
-		writer.allContentTypes[unary] = struct{}{}
-		writer.unaryConnectContentTypes[unary] = struct{}{}
-		streaming := connectContentTypeFromCodecName(StreamTypeBidi, name)
-		writer.streamingConnectContentTypes[streaming] = struct{}{}
-		writer.allContentTypes[streaming] = struct{}{}
+	if config.HandleConnect {
+		for name := range config.Codecs {
+			unary := connectContentTypeFromCodecName(StreamTypeUnary, name)
+			writer.allContentTypes[unary] = struct{}{}
+			writer.unaryConnectContentTypes[unary] = struct{}{}
+			streaming := connectContentTypeFromCodecName(StreamTypeBidi, name)
+			writer.streamingConnectContentTypes[streaming] = struct{}{}
+			writer.allContentTypes[streaming] = struct{}{}
+		}
 	}
 	if config.HandleGRPC {
 		writer.grpcContentTypes[grpcContentTypeDefault] = struct{}{}
@@ -120,7 +124,13 @@ func (w *ErrorWriter) writeConnectUnary(response http.ResponseWriter, err error)
 		mergeHeaders(response.Header(), connectErr.meta)
 	}
 	response.WriteHeader(connectCodeToHTTP(CodeOf(err)))
-	data, marshalErr := json.Marshal(newConnectWireError(err))
+	wire := newConnectWireError(err)
+	if w.grpcStatusInErrors {
+		if statusErr := wire.attachGRPCStatus(err); statusErr != nil {
+			return fmt.Errorf("marshal status: %w", statusErr)
+		}
+	}
+	data, marshalErr := json.Marshal(wire)
 	if marshalErr != nil {
 		return fmt.Errorf("marshal error: %w", marshalErr)
 	}
@@ -0,0 +1,70 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"net/http"
+)
+
+// headerAccelBuffering asks nginx and compatible reverse proxies not to
+// buffer the response.
+const headerAccelBuffering = "X-Accel-Buffering"
+
+// flushPolicy controls when streaming handlers flush responses.
+type flushPolicy struct {
+	threshold int // zero flushes after every message
+}
+
+// apply disables proxy buffering for the response and, if the policy has a
+// threshold, wraps the writer so that flushes wait for enough data.
+func (p *flushPolicy) apply(responseWriter http.ResponseWriter) http.ResponseWriter {
+	if p == nil {
+		return responseWriter
+	}
+	responseWriter.Header().Set(headerAccelBuffering, "no")
+	if p.threshold <= 0 {
+		return responseWriter
+	}
+	return &thresholdFlushWriter{ResponseWriter: responseWriter, threshold: p.threshold}
+}
+
+// thresholdFlushWriter ignores flushes until at least threshold bytes have
+// been written since the last flush. Whatever remains is flushed by net/http
+// when the handler returns.
+type thresholdFlushWriter struct {
+	http.ResponseWriter
+
+	threshold int
+	pending   int
+}
+
+func (w *thresholdFlushWriter) Write(data []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(data)
+	w.pending += n
+	return n, err
+}
+
+func (w *thresholdFlushWriter) Flush() {
+	if w.pending < w.threshold {
+		return
+	}
+	w.pending = 0
+	flushResponseWriter(w.ResponseWriter)
+}
+
+// Unwrap returns the underlying writer, for use with http.ResponseController.
+func (w *thresholdFlushWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
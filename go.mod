@@ -4,5 +4,6 @@ go 1.18
 
 require (
 	github.com/google/go-cmp v0.5.9
+	github.com/klauspost/compress v1.17.2
 	google.golang.org/protobuf v1.28.1
 )
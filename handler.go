@@ -16,7 +16,13 @@ package connect
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"time"
+
+	"google.golang.org/protobuf/proto"
 )
 
 // A Handler is the server-side implementation of a single RPC defined by a
@@ -26,10 +32,36 @@ import (
 // the binary Protobuf and JSON codecs. They support gzip compression using the
 // standard library's [compress/gzip].
 type Handler struct {
-	spec             Spec
-	implementation   StreamingHandlerFunc
-	protocolHandlers []protocolHandler
-	acceptPost       string // Accept-Post header
+	spec                 Spec
+	implementation       StreamingHandlerFunc
+	protocolHandlers     []protocolHandler
+	acceptPost           string // Accept-Post header
+	getHandler           protocolHandler
+	deadlineMargin       time.Duration
+	reportDeadline       bool
+	minTimeout           time.Duration
+	maxTimeout           time.Duration
+	defaultTimeout       time.Duration
+	policyResolver       func(context.Context, Spec, Peer) CallPolicy
+	slowThreshold        time.Duration
+	slowReport           func(context.Context, Spec, Peer, time.Duration, SlowRequestStage)
+	compressionStats     bool
+	authVerifiers        []AuthVerifier
+	maxDeadlineExtension time.Duration
+	priorityScheduler    *PriorityScheduler
+	readMaxHeaderBytes   int
+	cors                 *corsPolicy
+	errorRedaction       *ErrorRedactionPolicy
+	callIDs              *callIDPolicy
+	routes               *RouteExtractor
+	strictHeaders        bool
+	debugEcho            *DebugEcho
+	flushPolicy          *flushPolicy
+	longPoller           *longPoller
+	disconnect           *DisconnectPolicy
+	drainer              *Drainer
+	peerLimiter          *PeerLimiter
+	initErr              *Error // fails every call
 }
 
 // NewUnaryHandler constructs a [Handler] for a request-response procedure.
@@ -50,36 +82,79 @@ func NewUnaryHandler[Req, Res any](
 		return unary(ctx, typed)
 	})
 	config := newHandlerConfig(procedure, options)
+	if code := config.ClientCancelCode; code != 0 {
+		next := untyped
+		untyped = func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
+			response, err := next(ctx, request)
+			return response, recodeIfClientCanceled(ctx, err, code)
+		}
+	}
 	if interceptor := config.Interceptor; interceptor != nil {
 		untyped = interceptor.WrapUnary(untyped)
 	}
+	pool := newMessagePool[Req](config.RequestMessagePooling)
 	// Given a stream, how should we call the unary function?
 	implementation := func(ctx context.Context, conn StreamingHandlerConn) error {
-		var msg Req
-		if err := conn.Receive(&msg); err != nil {
+		msg := pool.Get()
+		defer pool.Put(msg)
+		if err := conn.Receive(msg); err != nil {
 			return err
 		}
 		request := &Request[Req]{
-			Msg:    &msg,
+			Msg:    msg,
 			spec:   conn.Spec(),
 			peer:   conn.Peer(),
 			header: conn.RequestHeader(),
 		}
+		ctx = config.RouteExtractor.assign(ctx, request.header, msg)
 		response, err := untyped(ctx, request)
 		if err != nil {
 			return err
 		}
-		mergeHeaders(conn.ResponseHeader(), response.Header())
-		mergeHeaders(conn.ResponseTrailer(), response.Trailer())
+		// The response is discarded after it's sent, so its metadata can be moved
+		// rather than copied. Read the fields directly: the Header and Trailer
+		// methods allocate empty maps for responses without metadata.
+		if typed, ok := response.(*Response[Res]); ok {
+			moveHeadersWithPolicy(conn.ResponseHeader(), typed.header, config.HeaderMergePolicy)
+			moveHeadersWithPolicy(conn.ResponseTrailer(), typed.trailer, config.HeaderMergePolicy)
+		} else {
+			mergeHeadersWithPolicy(conn.ResponseHeader(), response.Header(), config.HeaderMergePolicy)
+			mergeHeadersWithPolicy(conn.ResponseTrailer(), response.Trailer(), config.HeaderMergePolicy)
+		}
 		return conn.Send(response.Any())
 	}
 
 	protocolHandlers := config.newProtocolHandlers(StreamTypeUnary)
 	return &Handler{
-		spec:             config.newSpec(StreamTypeUnary),
-		implementation:   implementation,
-		protocolHandlers: protocolHandlers,
-		acceptPost:       sortedAcceptPostValue(protocolHandlers),
+		spec:                 config.newSpec(StreamTypeUnary),
+		implementation:       implementation,
+		protocolHandlers:     protocolHandlers,
+		acceptPost:           sortedAcceptPostValue(protocolHandlers),
+		getHandler:           config.newGetHandler(protocolHandlers),
+		deadlineMargin:       config.DeadlineMargin,
+		reportDeadline:       config.ReportDeadline,
+		minTimeout:           config.MinTimeout,
+		maxTimeout:           config.MaxTimeout,
+		defaultTimeout:       config.DefaultTimeout,
+		policyResolver:       withRuntimeLimits(config.RuntimeLimits, config.PolicyResolver),
+		slowThreshold:        config.SlowRequestThreshold,
+		slowReport:           config.SlowRequestReport,
+		compressionStats:     config.CompressionStatsTrailers,
+		authVerifiers:        config.AuthVerifiers,
+		maxDeadlineExtension: config.MaxDeadlineExtension,
+		priorityScheduler:    config.PriorityScheduler,
+		readMaxHeaderBytes:   config.ReadMaxHeaderBytes,
+		cors:                 newCORSPolicy(config),
+		errorRedaction:       config.ErrorRedaction,
+		flushPolicy:          config.FlushPolicy,
+		callIDs:              config.CallIDs,
+		routes:               config.RouteExtractor,
+		strictHeaders:        config.StrictHeaders,
+		debugEcho:            config.DebugEcho,
+		disconnect:           config.DisconnectPolicy,
+		drainer:              config.Drainer,
+		peerLimiter:          config.PeerLimiter,
+		initErr:              config.InitErr,
 	}
 }
 
@@ -89,8 +164,9 @@ func NewClientStreamHandler[Req, Res any](
 	implementation func(context.Context, *ClientStream[Req]) (*Response[Res], error),
 	options ...HandlerOption,
 ) *Handler {
-	return newStreamHandler(
-		procedure,
+	config := newHandlerConfig(procedure, options)
+	return newStreamHandlerFromConfig(
+		config,
 		StreamTypeClient,
 		func(ctx context.Context, conn StreamingHandlerConn) error {
 			stream := &ClientStream[Req]{conn: conn}
@@ -98,11 +174,10 @@ func NewClientStreamHandler[Req, Res any](
 			if err != nil {
 				return err
 			}
-			mergeHeaders(conn.ResponseHeader(), res.header)
-			mergeHeaders(conn.ResponseTrailer(), res.trailer)
+			mergeHeadersWithPolicy(conn.ResponseHeader(), res.header, config.HeaderMergePolicy)
+			mergeHeadersWithPolicy(conn.ResponseTrailer(), res.trailer, config.HeaderMergePolicy)
 			return conn.Send(res.Msg)
 		},
-		options...,
 	)
 }
 
@@ -112,27 +187,47 @@ func NewServerStreamHandler[Req, Res any](
 	implementation func(context.Context, *Request[Req], *ServerStream[Res]) error,
 	options ...HandlerOption,
 ) *Handler {
-	return newStreamHandler(
-		procedure,
+	config := newHandlerConfig(procedure, options)
+	var cache *serverStreamCache
+	if config.ServerStreamCacheTTL > 0 {
+		cache = newServerStreamCache(config.ServerStreamCacheTTL, config.ServerStreamCacheLimits)
+	}
+	handler := newStreamHandlerFromConfig(
+		config,
 		StreamTypeServer,
 		func(ctx context.Context, conn StreamingHandlerConn) error {
 			var msg Req
 			if err := conn.Receive(&msg); err != nil {
 				return err
 			}
-			return implementation(
-				ctx,
-				&Request[Req]{
-					Msg:    &msg,
-					spec:   conn.Spec(),
-					peer:   conn.Peer(),
-					header: conn.RequestHeader(),
-				},
-				&ServerStream[Res]{conn: conn},
-			)
+			call := func(conn StreamingHandlerConn) error {
+				return implementation(
+					ctx,
+					&Request[Req]{
+						Msg:    &msg,
+						spec:   conn.Spec(),
+						peer:   conn.Peer(),
+						header: conn.RequestHeader(),
+					},
+					&ServerStream[Res]{conn: conn},
+				)
+			}
+			if cache != nil {
+				return cache.Serve(conn, &msg, call)
+			}
+			return call(conn)
 		},
-		options...,
 	)
+	if config.LongPolling != nil && config.HandleConnect {
+		handler.longPoller = newLongPoller(
+			*config.LongPolling,
+			handler.spec,
+			func() any { return new(Req) },
+			func() any { return new(Res) },
+			copyMessage[Req],
+		)
+	}
+	return handler
 }
 
 // NewBidiStreamHandler constructs a [Handler] for a bidirectional streaming procedure.
@@ -156,21 +251,75 @@ func NewBidiStreamHandler[Req, Res any](
 
 // ServeHTTP implements [http.Handler].
 func (h *Handler) ServeHTTP(responseWriter http.ResponseWriter, request *http.Request) {
+	_ = h.ServeConnectHTTP(responseWriter, request)
+}
+
+// ServeConnectHTTP is like ServeHTTP, but it returns the RPC's final error
+// (if any) after the response has been written to the client. It's useful in
+// routers and middleware chains that observe request outcomes, since callers
+// can use [CodeOf] and [errors.As] to inspect the error. Requests that don't
+// conform to any supported protocol are rejected with an error describing the
+// problem.
+//
+// The returned error has already been sent to the client, so callers must not
+// write it to the response again.
+func (h *Handler) ServeConnectHTTP(responseWriter http.ResponseWriter, request *http.Request) error {
 	// We don't need to defer functions  to close the request body or read to
 	// EOF: the stream we construct later on already does that, and we only
 	// return early when dealing with misbehaving clients. In those cases, it's
 	// okay if we can't re-use the connection.
+	if h.strictHeaders {
+		if err := checkStrictHeaders(request); err != nil {
+			return writeProtocolError(responseWriter, http.StatusBadRequest, err.Error())
+		}
+		strictWriter := &strictHeaderWriter{ResponseWriter: responseWriter}
+		defer strictWriter.sanitizeTrailers()
+		responseWriter = strictWriter
+	}
+	if h.cors != nil {
+		if h.cors.servePreflight(responseWriter, request) {
+			return nil
+		}
+		h.cors.setResponseHeaders(responseWriter, request)
+	}
 	isBidi := (h.spec.StreamType & StreamTypeBidi) == StreamTypeBidi
 	if isBidi && request.ProtoMajor < 2 {
-		responseWriter.WriteHeader(http.StatusHTTPVersionNotSupported)
-		return
+		return writeProtocolError(
+			responseWriter,
+			http.StatusHTTPVersionNotSupported,
+			"bidirectional streaming requires HTTP/2",
+		)
 	}
 
-	// The gRPC-HTTP2, gRPC-Web, and Connect protocols are all POST-only.
+	// The gRPC-HTTP2, gRPC-Web, and Connect protocols are all POST-only, except
+	// that the Connect protocol allows GET for unary procedures without side
+	// effects. HEAD runs the same RPC as GET but drops the response body.
+	isGet := request.Method == http.MethodGet || request.Method == http.MethodHead
+	if isGet && h.getHandler != nil {
+		encoding := request.URL.Query().Get(connectUnaryEncodingQueryParameter)
+		if _, ok := h.getHandler.ContentTypes()[connectUnaryContentTypePrefix+encoding]; !ok {
+			return writeProtocolError(
+				responseWriter,
+				http.StatusUnsupportedMediaType,
+				fmt.Sprintf("unsupported message encoding %q", encoding),
+			)
+		}
+		if request.Method == http.MethodHead {
+			responseWriter = &headResponseWriter{ResponseWriter: responseWriter}
+		}
+		return h.serve(responseWriter, request, h.getHandler)
+	}
 	if request.Method != http.MethodPost {
-		responseWriter.Header().Set("Allow", http.MethodPost)
-		responseWriter.WriteHeader(http.StatusMethodNotAllowed)
-		return
+		allow := http.MethodPost
+		if h.getHandler != nil {
+			allow = http.MethodGet + ", " + http.MethodHead + ", " + http.MethodPost
+		}
+		responseWriter.Header().Set("Allow", allow)
+		return writeProtocolError(
+			responseWriter,
+			http.StatusMethodNotAllowed,
+			fmt.Sprintf("HTTP method %s not allowed: RPCs must use %s", request.Method, http.MethodPost),
+		)
 	}
 
 	// Find our implementation of the RPC protocol in use.
@@ -184,12 +333,25 @@ func (h *Handler) ServeHTTP(responseWriter http.ResponseWriter, request *http.Re
 	}
 	if protocolHandler == nil {
 		responseWriter.Header().Set("Accept-Post", h.acceptPost)
-		responseWriter.WriteHeader(http.StatusUnsupportedMediaType)
-		return
+		return writeProtocolError(
+			responseWriter,
+			http.StatusUnsupportedMediaType,
+			fmt.Sprintf("unsupported content type %q: expected one of %s", contentType, h.acceptPost),
+		)
+	}
+	if values := request.Header[headerContentType]; len(values) != 1 || values[0] != contentType {
+		request.Header[headerContentType] = []string{contentType} // prefer canonicalized value
 	}
+	return h.serve(responseWriter, request, protocolHandler)
+}
 
-	// Establish a stream and serve the RPC.
-	request.Header.Set("Content-Type", contentType)                // prefer canonicalized value
+// serve establishes a stream using the chosen protocol and serves the RPC.
+func (h *Handler) serve(responseWriter http.ResponseWriter, request *http.Request, protocolHandler protocolHandler) error {
+	if h.disconnect != nil {
+		var stopWatching func()
+		request, stopWatching = h.disconnect.watch(request, h.spec)
+		defer stopWatching()
+	}
 	ctx, cancel, timeoutErr := protocolHandler.SetTimeout(request) //nolint: contextcheck
 	if timeoutErr != nil {
 		ctx = request.Context()
@@ -197,34 +359,235 @@ func (h *Handler) ServeHTTP(responseWriter http.ResponseWriter, request *http.Re
 	if cancel != nil {
 		defer cancel()
 	}
-	connCloser, ok := protocolHandler.NewConn(
+	var extendable *extendableDeadlineContext
+	if deadline, ok := ctx.Deadline(); ok && timeoutErr == nil && h.maxDeadlineExtension > 0 {
+		// Replace the fixed deadline from the client's timeout.
+		var cancelExtendable context.CancelFunc
+		extendable, cancelExtendable = newExtendableDeadlineContext(request.Context(), deadline, h.maxDeadlineExtension)
+		defer cancelExtendable()
+		ctx = extendable
+	}
+	headerErr := checkHeaderSize(request.Header, h.readMaxHeaderBytes)
+	var authErr error
+	if len(h.authVerifiers) > 0 {
+		ctx, authErr = verifyAuth(ctx, request, h.authVerifiers)
+	}
+	if h.spec.StreamType != StreamTypeUnary {
+		responseWriter = h.flushPolicy.apply(responseWriter)
+	}
+	connCloser, connErr := protocolHandler.NewConn(
 		responseWriter,
 		request.WithContext(ctx),
 	)
-	if !ok {
+	if connErr != nil {
 		// Failed to create stream, usually because client used an unknown
-		// compression algorithm. Nothing further to do.
-		return
+		// compression algorithm. NewConn has already sent the error.
+		return connErr
+	}
+	ctx = h.callIDs.assignHandler(ctx, request.Header, connCloser.ResponseHeader())
+	ctx = h.routes.assign(ctx, request.Header, nil /* msg */)
+	if h.reportDeadline && timeoutErr == nil {
+		writeDeadlineRemaining(ctx, connCloser.ResponseHeader())
+	}
+	var debugStart time.Time
+	if h.debugEcho.enabled(request) {
+		debugStart = time.Now()
+		h.debugEcho.writeHeaders(protocolHandler, request, connCloser.ResponseHeader())
+		if h.spec.StreamType == StreamTypeUnary {
+			connCloser = &debugUnaryConn{handlerConnCloser: connCloser, start: debugStart}
+		}
+	}
+	if h.initErr != nil {
+		_ = connCloser.Close(h.initErr)
+		return h.initErr
 	}
 	if timeoutErr != nil {
 		_ = connCloser.Close(timeoutErr)
-		return
+		return timeoutErr
+	}
+	if headerErr != nil {
+		_ = connCloser.Close(headerErr)
+		return headerErr
+	}
+	if authErr != nil {
+		_ = connCloser.Close(authErr)
+		return authErr
+	}
+	if extendable != nil {
+		reportConn := &deadlineReportConn{handlerConnCloser: connCloser}
+		extendable.setReport(reportConn.extended)
+		connCloser = reportConn
+	}
+	if h.minTimeout > 0 || h.maxTimeout > 0 || h.defaultTimeout > 0 {
+		var cancelClamp context.CancelFunc
+		var clampErr error
+		ctx, cancelClamp, clampErr = clampTimeout(ctx, h.minTimeout, h.maxTimeout, h.defaultTimeout)
+		if clampErr != nil {
+			_ = connCloser.Close(clampErr)
+			return clampErr
+		}
+		if cancelClamp != nil {
+			defer cancelClamp()
+		}
+	}
+	if h.policyResolver != nil {
+		var cancelPolicy context.CancelFunc
+		var policyErr error
+		ctx, cancelPolicy, policyErr = resolvePolicy(ctx, h.policyResolver, connCloser)
+		if policyErr != nil {
+			_ = connCloser.Close(policyErr)
+			return policyErr
+		}
+		if cancelPolicy != nil {
+			defer cancelPolicy()
+		}
+	}
+	if h.slowThreshold > 0 && h.slowReport != nil {
+		// Close stops the timer.
+		connCloser = newSlowRequestConn(ctx, connCloser, h.slowThreshold, h.slowReport)
 	}
-	_ = connCloser.Close(h.implementation(ctx, connCloser))
+	if h.deadlineMargin > 0 {
+		// Reserve some of the budget for the handler itself. The handler keeps
+		// its full deadline, but outbound calls made with this context send
+		// shorter timeouts, so they time out before the handler does.
+		ctx = deadlineMarginContextValue.With(ctx, h.deadlineMargin)
+	}
+	if h.priorityScheduler != nil {
+		release, scheduleErr := h.priorityScheduler.schedule(ctx, connCloser)
+		if scheduleErr != nil {
+			_ = connCloser.Close(scheduleErr)
+			return scheduleErr
+		}
+		defer release()
+	}
+	if h.peerLimiter != nil && h.spec.StreamType != StreamTypeUnary {
+		release, limitErr := h.peerLimiter.acquire(ctx, connCloser.Peer())
+		if limitErr != nil {
+			_ = connCloser.Close(limitErr)
+			return limitErr
+		}
+		defer release()
+	}
+	var drainStream *drainingStream
+	if h.drainer != nil && h.spec.StreamType != StreamTypeUnary {
+		ctx, drainStream = h.drainer.track(ctx)
+		if drainStream == nil {
+			drainErr := h.drainer.drainErr()
+			_ = connCloser.Close(drainErr)
+			return drainErr
+		}
+	}
+	implementation := h.implementation
+	if _, ok := protocolHandler.(*longPollHandler); ok && h.longPoller != nil && isLongPoll(request) {
+		implementation = func(ctx context.Context, conn StreamingHandlerConn) error {
+			return h.longPoller.serve(ctx, conn, h.implementation)
+		}
+	}
+	err := implementation(ctx, connCloser)
+	if drainStream != nil && h.drainer.release(drainStream) && err != nil {
+		// The handler stopped because the server is draining, so ask the
+		// client to reconnect.
+		err = h.drainer.drainErr()
+	}
+	if connectErr, ok := asError(err); ok {
+		mergeHeaders(connCloser.ResponseHeader(), connectErr.responseHeader)
+		mergeHeaders(connCloser.ResponseTrailer(), connectErr.responseTrailer)
+	}
+	if h.compressionStats {
+		writeCompressionStats(connCloser)
+	}
+	if !debugStart.IsZero() {
+		setDebugProcessingTime(connCloser.ResponseTrailer(), debugStart)
+	}
+	closeErr := connCloser.Close(h.errorRedaction.redact(err))
+	if err != nil {
+		return wrapIfContextDone(ctx, err)
+	}
+	return closeErr
+}
+
+// writeProtocolError rejects a request that doesn't conform to any of the
+// supported RPC protocols. The HTTP status code is what all clients rely on,
+// but the Connect-formatted JSON body makes the rejection actionable for
+// browsers and command-line tools. To avoid changing the code that Connect
+// clients infer from the status, the body's code matches the Connect
+// protocol's HTTP-to-code mapping.
+func writeProtocolError(responseWriter http.ResponseWriter, status int, message string) *Error {
+	protocolErr := NewError(connectHTTPToCode(status), errors.New(message))
+	data, err := json.Marshal(newConnectWireError(protocolErr))
+	if err != nil {
+		responseWriter.WriteHeader(status)
+		return protocolErr
+	}
+	responseWriter.Header().Set(headerContentType, connectUnaryContentTypeJSON)
+	responseWriter.WriteHeader(status)
+	_, _ = responseWriter.Write(data)
+	return protocolErr
 }
 
 type handlerConfig struct {
-	CompressionPools map[string]*compressionPool
-	CompressionNames []string
-	Codecs           map[string]Codec
-	CompressMinBytes int
-	Interceptor      Interceptor
-	Procedure        string
-	HandleGRPC       bool
-	HandleGRPCWeb    bool
-	BufferPool       *bufferPool
-	ReadMaxBytes     int
-	SendMaxBytes     int
+	CompressionPools      map[string]*compressionPool
+	CompressionNames      []string
+	Codecs                map[string]Codec
+	CompressMinBytes      int
+	CodecCompressMinBytes map[string]int
+	CompressionPolicy     CompressionPolicy
+	PayloadVerifier       PayloadVerifier
+	Interceptor           Interceptor
+	Procedure             string
+	IdempotencyLevel      IdempotencyLevel
+	HandleConnect         bool
+	HandleGRPC            bool
+	HandleGRPCWeb         bool
+	BufferPool            *bufferPool
+	ReadMaxBytes          int
+	SendMaxBytes          int
+	MessageMetadata       bool
+	EnvelopeFlags         []EnvelopeFlag
+
+	FirstReadMaxBytes  int
+	FirstSendMaxBytes  int
+	ReadMaxHeaderBytes int
+	CORSOrigins        []string
+
+	ServerStreamCacheTTL     time.Duration
+	ServerStreamCacheLimits  ServerStreamCacheLimits
+	DeadlineMargin           time.Duration
+	ReportDeadline           bool
+	MinTimeout               time.Duration
+	MaxTimeout               time.Duration
+	DefaultTimeout           time.Duration
+	PolicyResolver           func(context.Context, Spec, Peer) CallPolicy
+	RuntimeLimits            *RuntimeLimits
+	LenientRequestEncoding   bool
+	Initializer              func(Spec, any) error
+	ProtoUnmarshalOptions    *proto.UnmarshalOptions
+	TypeResolver             TypeResolver
+	HeaderMergePolicy        HeaderMergePolicy
+	CompressionStatsTrailers bool
+	AuthVerifiers            []AuthVerifier
+	ErrorFormatters          map[string]ErrorFormatter
+	GRPCStatusInErrors       bool
+	TimeoutHeader            *TimeoutHeader
+	MaxDeadlineExtension     time.Duration
+	PriorityScheduler        *PriorityScheduler
+	RequestMessagePooling    bool
+	SlowRequestThreshold     time.Duration
+	SlowRequestReport        func(context.Context, Spec, Peer, time.Duration, SlowRequestStage)
+	ClientCancelCode         Code
+	ErrorRedaction           *ErrorRedactionPolicy
+	CallIDs                  *callIDPolicy
+	RouteExtractor           *RouteExtractor
+	StrictHeaders            bool
+	JSONArrayStreaming       bool
+	DebugEcho                *DebugEcho
+	FlushPolicy              *flushPolicy
+	LongPolling              *LongPolling
+	DisconnectPolicy         *DisconnectPolicy
+	Drainer                  *Drainer
+	PeerLimiter              *PeerLimiter
+	SerializationTiming      func(context.Context, SerializationTiming)
+	InitErr                  *Error // set by options that can't be applied
 }
 
 func newHandlerConfig(procedure string, options []HandlerOption) *handlerConfig {
@@ -233,6 +596,7 @@ func newHandlerConfig(procedure string, options []HandlerOption) *handlerConfig
 		Procedure:        protoPath,
 		CompressionPools: make(map[string]*compressionPool),
 		Codecs:           make(map[string]Codec),
+		HandleConnect:    true,
 		HandleGRPC:       true,
 		HandleGRPCWeb:    true,
 		BufferPool:       newBufferPool(),
@@ -243,18 +607,61 @@ func newHandlerConfig(procedure string, options []HandlerOption) *handlerConfig
 	for _, opt := range options {
 		opt.applyToHandler(&config)
 	}
+	for name, codec := range config.Codecs {
+		config.Codecs[name] = configureProtoCodec(
+			codec,
+			config.ProtoUnmarshalOptions,
+			config.TypeResolver,
+			config.Initializer != nil,
+		)
+	}
 	return &config
 }
 
+// recodeIfClientCanceled replaces CodeCanceled with the supplied code, unless
+// the RPC's context timed out. Depending on timing, handlers may see the
+// client's cancellation as a reset stream before the context is canceled.
+func recodeIfClientCanceled(ctx context.Context, err error, code Code) error {
+	if err == nil || errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+	connectErr, ok := asError(wrapIfContextDone(ctx, err))
+	if !ok || connectErr.Code() != CodeCanceled {
+		return err
+	}
+	recoded := *connectErr
+	recoded.code = code
+	return &recoded
+}
+
 func (c *handlerConfig) newSpec(streamType StreamType) Spec {
 	return Spec{
-		Procedure:  c.Procedure,
-		StreamType: streamType,
+		Procedure:        c.Procedure,
+		StreamType:       streamType,
+		IdempotencyLevel: c.IdempotencyLevel,
 	}
 }
 
+// newGetHandler returns the Connect protocol handler if the procedure
+// accepts GET requests, and nil otherwise. Only unary procedures without
+// side effects do.
+func (c *handlerConfig) newGetHandler(handlers []protocolHandler) protocolHandler {
+	if c.IdempotencyLevel != IdempotencyNoSideEffects {
+		return nil
+	}
+	for _, handler := range handlers {
+		if connect, ok := handler.(*connectHandler); ok {
+			return connect
+		}
+	}
+	return nil
+}
+
 func (c *handlerConfig) newProtocolHandlers(streamType StreamType) []protocolHandler {
-	protocols := []protocol{&protocolConnect{}}
+	var protocols []protocol
+	if c.HandleConnect {
+		protocols = append(protocols, &protocolConnect{})
+	}
 	if c.HandleGRPC {
 		protocols = append(protocols, &protocolGRPC{web: false})
 	}
@@ -267,16 +674,45 @@ func (c *handlerConfig) newProtocolHandlers(streamType StreamType) []protocolHan
 		c.CompressionPools,
 		c.CompressionNames,
 	)
+	newParams := func() *protocolHandlerParams {
+		return &protocolHandlerParams{
+			Spec:                  c.newSpec(streamType),
+			Codecs:                codecs,
+			CompressionPools:      compressors,
+			CompressMinBytes:      c.CompressMinBytes,
+			CodecCompressMinBytes: c.CodecCompressMinBytes,
+			CompressionPolicy:     c.CompressionPolicy,
+			PayloadVerifier:       c.PayloadVerifier,
+			BufferPool:            c.BufferPool,
+			ReadMaxBytes:          c.ReadMaxBytes,
+			SendMaxBytes:          c.SendMaxBytes,
+			FirstReadMaxBytes:     c.FirstReadMaxBytes,
+			FirstSendMaxBytes:     c.FirstSendMaxBytes,
+			MessageMetadata:       c.MessageMetadata,
+			EnvelopeFlags:         newEnvelopeFlagSet(c.EnvelopeFlags),
+			LenientEncoding:       c.LenientRequestEncoding,
+			Initializer:           c.Initializer,
+			ErrorFormatters:       c.ErrorFormatters,
+			GRPCStatusInErrors:    c.GRPCStatusInErrors,
+			TimeoutHeader:         c.TimeoutHeader,
+			SerializationTiming:   c.SerializationTiming,
+		}
+	}
 	for _, protocol := range protocols {
-		handlers = append(handlers, protocol.NewHandler(&protocolHandlerParams{
-			Spec:             c.newSpec(streamType),
-			Codecs:           codecs,
-			CompressionPools: compressors,
-			CompressMinBytes: c.CompressMinBytes,
-			BufferPool:       c.BufferPool,
-			ReadMaxBytes:     c.ReadMaxBytes,
-			SendMaxBytes:     c.SendMaxBytes,
-		}))
+		handlers = append(handlers, protocol.NewHandler(newParams()))
+	}
+	var jsonArray protocolHandler
+	if c.JSONArrayStreaming && c.HandleConnect && streamType == StreamTypeServer {
+		jsonArray = newJSONArrayHandler(newParams())
+	}
+	switch {
+	case c.LongPolling != nil && c.HandleConnect && streamType == StreamTypeServer:
+		// Long polls and JSON array requests share content types, so the
+		// long-poll handler passes requests without a cursor to the JSON array
+		// handler.
+		handlers = append(handlers, newLongPollHandler(newParams(), jsonArray))
+	case jsonArray != nil:
+		handlers = append(handlers, jsonArray)
 	}
 	return handlers
 }
@@ -287,15 +723,75 @@ func newStreamHandler(
 	implementation StreamingHandlerFunc,
 	options ...HandlerOption,
 ) *Handler {
-	config := newHandlerConfig(procedure, options)
+	return newStreamHandlerFromConfig(
+		newHandlerConfig(procedure, options),
+		streamType,
+		implementation,
+	)
+}
+
+func newStreamHandlerFromConfig(
+	config *handlerConfig,
+	streamType StreamType,
+	implementation StreamingHandlerFunc,
+) *Handler {
+	if code := config.ClientCancelCode; code != 0 {
+		next := implementation
+		implementation = func(ctx context.Context, conn StreamingHandlerConn) error {
+			return recodeIfClientCanceled(ctx, next(ctx, conn), code)
+		}
+	}
 	if ic := config.Interceptor; ic != nil {
 		implementation = ic.WrapStreamingHandler(implementation)
 	}
 	protocolHandlers := config.newProtocolHandlers(streamType)
 	return &Handler{
-		spec:             config.newSpec(streamType),
-		implementation:   implementation,
-		protocolHandlers: protocolHandlers,
-		acceptPost:       sortedAcceptPostValue(protocolHandlers),
+		spec:                 config.newSpec(streamType),
+		implementation:       implementation,
+		protocolHandlers:     protocolHandlers,
+		acceptPost:           sortedAcceptPostValue(protocolHandlers),
+		deadlineMargin:       config.DeadlineMargin,
+		reportDeadline:       config.ReportDeadline,
+		minTimeout:           config.MinTimeout,
+		maxTimeout:           config.MaxTimeout,
+		defaultTimeout:       config.DefaultTimeout,
+		policyResolver:       withRuntimeLimits(config.RuntimeLimits, config.PolicyResolver),
+		slowThreshold:        config.SlowRequestThreshold,
+		slowReport:           config.SlowRequestReport,
+		compressionStats:     config.CompressionStatsTrailers,
+		authVerifiers:        config.AuthVerifiers,
+		maxDeadlineExtension: config.MaxDeadlineExtension,
+		priorityScheduler:    config.PriorityScheduler,
+		readMaxHeaderBytes:   config.ReadMaxHeaderBytes,
+		cors:                 newCORSPolicy(config),
+		errorRedaction:       config.ErrorRedaction,
+		flushPolicy:          config.FlushPolicy,
+		callIDs:              config.CallIDs,
+		routes:               config.RouteExtractor,
+		strictHeaders:        config.StrictHeaders,
+		debugEcho:            config.DebugEcho,
+		disconnect:           config.DisconnectPolicy,
+		drainer:              config.Drainer,
+		peerLimiter:          config.PeerLimiter,
+		initErr:              config.InitErr,
 	}
 }
+
+// headResponseWriter serves HEAD requests: it sends headers and status codes
+// as usual, but discards the response body.
+type headResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w *headResponseWriter) Write(data []byte) (int, error) {
+	return len(data), nil
+}
+
+func (w *headResponseWriter) Flush() {
+	flushResponseWriter(w.ResponseWriter)
+}
+
+// Unwrap returns the underlying writer, for use with http.ResponseController.
+func (w *headResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -15,17 +15,33 @@
 package connect_test
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/bufbuild/connect-go"
 	"github.com/bufbuild/connect-go/internal/assert"
 	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
 	"github.com/bufbuild/connect-go/internal/gen/connect/ping/v1/pingv1connect"
+	statusv1 "github.com/bufbuild/connect-go/internal/gen/connectext/grpc/status/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
 )
 
 func TestHandler_ServeHTTP(t *testing.T) {
@@ -55,6 +71,13 @@ func TestHandler_ServeHTTP(t *testing.T) {
 		defer resp.Body.Close()
 		assert.Equal(t, resp.StatusCode, http.StatusMethodNotAllowed)
 		assert.Equal(t, resp.Header.Get("Allow"), http.MethodPost)
+		assert.Equal(t, resp.Header.Get("Content-Type"), "application/json")
+		var message struct {
+			Code, Message string
+		}
+		assert.Nil(t, json.NewDecoder(resp.Body).Decode(&message))
+		assert.Equal(t, message.Code, connect.CodeUnknown.String())
+		assert.Equal(t, message.Message, "HTTP method GET not allowed: RPCs must use POST")
 	})
 
 	t.Run("unsupported_content_type", func(t *testing.T) {
@@ -84,6 +107,12 @@ func TestHandler_ServeHTTP(t *testing.T) {
 			"application/json; charset=utf-8",
 			"application/proto",
 		}, ", "))
+		var message struct {
+			Code, Message string
+		}
+		assert.Nil(t, json.NewDecoder(resp.Body).Decode(&message))
+		assert.Equal(t, message.Code, connect.CodeUnknown.String())
+		assert.True(t, strings.HasPrefix(message.Message, `unsupported content type "application/x-custom-json"`))
 	})
 
 	t.Run("charset_in_content_type_header", func(t *testing.T) {
@@ -145,10 +174,2663 @@ func TestHandler_ServeHTTP(t *testing.T) {
 	})
 }
 
-type successPingServer struct {
-	pingv1connect.UnimplementedPingServiceHandler
+func TestHandlerProtocols(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		successPingServer{},
+		connect.WithHandlerProtocols(connect.ProtocolGRPC),
+	))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	ping := func(opts ...connect.ClientOption) error {
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opts...)
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		return err
+	}
+	t.Run("grpc", func(t *testing.T) {
+		t.Parallel()
+		assert.Nil(t, ping(connect.WithGRPC()))
+	})
+	t.Run("grpcweb", func(t *testing.T) {
+		t.Parallel()
+		err := ping(connect.WithGRPCWeb())
+		assert.NotNil(t, err)
+		assert.True(t, strings.Contains(err.Error(), "415"))
+	})
+	t.Run("connect", func(t *testing.T) {
+		t.Parallel()
+		err := ping(connect.WithGRPC(), connect.WithConnect())
+		assert.NotNil(t, err)
+		// Connect clients get a descriptive error from the response body.
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnknown)
+		assert.True(t, strings.Contains(err.Error(), `unsupported content type "application/proto"`))
+	})
+	t.Run("error_writer", func(t *testing.T) {
+		t.Parallel()
+		writer := connect.NewErrorWriter(connect.WithHandlerProtocols(connect.ProtocolGRPC))
+		request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(""))
+		request.Header.Set("Content-Type", "application/proto")
+		assert.False(t, writer.IsSupported(request))
+		request.Header.Set("Content-Type", "application/grpc")
+		assert.True(t, writer.IsSupported(request))
+	})
+	t.Run("unknown", func(t *testing.T) {
+		t.Parallel()
+		supported := func(writer *connect.ErrorWriter, contentType string) bool {
+			request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(""))
+			request.Header.Set("Content-Type", contentType)
+			return writer.IsSupported(request)
+		}
+		// Without any known protocols, the option is ignored.
+		for _, writer := range []*connect.ErrorWriter{
+			connect.NewErrorWriter(connect.WithHandlerProtocols()),
+			connect.NewErrorWriter(connect.WithHandlerProtocols("grpc-websocket")),
+		} {
+			assert.True(t, supported(writer, "application/proto"))
+			assert.True(t, supported(writer, "application/grpc"))
+			assert.True(t, supported(writer, "application/grpc-web"))
+		}
+		writer := connect.NewErrorWriter(connect.WithHandlerProtocols("grpc-websocket", connect.ProtocolGRPC))
+		assert.False(t, supported(writer, "application/proto"))
+		assert.True(t, supported(writer, "application/grpc"))
+	})
 }
 
-func (successPingServer) Ping(context.Context, *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
-	return &connect.Response[pingv1.PingResponse]{}, nil
+func TestServeConnectHTTP(t *testing.T) {
+	t.Parallel()
+	const (
+		pingProcedure = "/" + pingv1connect.PingServiceName + "/Ping"
+		failProcedure = "/" + pingv1connect.PingServiceName + "/Fail"
+	)
+	outcomes := make(chan error, 1)
+	// observe is error-aware middleware, as might be used with a custom router.
+	observe := func(handler *connect.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			outcomes <- handler.ServeConnectHTTP(w, r)
+		})
+	}
+	mux := http.NewServeMux()
+	mux.Handle(pingProcedure, observe(connect.NewUnaryHandler(pingProcedure, pingServer{}.Ping)))
+	mux.Handle(failProcedure, observe(connect.NewUnaryHandler(failProcedure, pingServer{}.Fail)))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+
+	_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+	assert.Nil(t, err)
+	assert.Nil(t, <-outcomes)
+
+	_, err = client.Fail(context.Background(), connect.NewRequest(&pingv1.FailRequest{
+		Code: int32(connect.CodeResourceExhausted),
+	}))
+	assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+	assert.Equal(t, connect.CodeOf(<-outcomes), connect.CodeResourceExhausted)
+
+	request, err := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL+pingProcedure, http.NoBody)
+	assert.Nil(t, err)
+	response, err := server.Client().Do(request)
+	assert.Nil(t, err)
+	assert.Nil(t, response.Body.Close())
+	assert.Equal(t, response.StatusCode, http.StatusMethodNotAllowed)
+	err = <-outcomes
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), "HTTP method GET not allowed"))
+}
+
+func TestHandlerLenientRequestEncoding(t *testing.T) {
+	t.Parallel()
+	// decompressingGateway simulates an API gateway that transparently
+	// decompresses request bodies, but leaves Content-Encoding in place.
+	decompressingGateway := func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Content-Encoding") == "gzip" {
+				gzipReader, err := gzip.NewReader(r.Body)
+				assert.Nil(t, err)
+				r.Body = io.NopCloser(gzipReader)
+			}
+			handler.ServeHTTP(w, r)
+		})
+	}
+	run := func(t *testing.T, opts ...connect.HandlerOption) error {
+		t.Helper()
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}, opts...))
+		server := httptest.NewServer(decompressingGateway(mux))
+		t.Cleanup(server.Close)
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithSendGzip())
+		request := connect.NewRequest(&pingv1.PingRequest{Number: 42, Text: strings.Repeat("hello", 10)})
+		response, err := client.Ping(context.Background(), request)
+		if err != nil {
+			return err
+		}
+		assert.Equal(t, response.Msg.Number, 42)
+		return nil
+	}
+	t.Run("strict", func(t *testing.T) {
+		t.Parallel()
+		err := run(t)
+		assert.Equal(t, connect.CodeOf(err), connect.CodeInvalidArgument)
+	})
+	t.Run("lenient", func(t *testing.T) {
+		t.Parallel()
+		assert.Nil(t, run(t, connect.WithLenientRequestEncoding()))
+	})
+}
+
+func TestHandlerProtoUnmarshalOptions(t *testing.T) {
+	t.Parallel()
+	run := func(t *testing.T, opts ...connect.HandlerOption) *http.Response {
+		t.Helper()
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}, opts...))
+		server := httptest.NewServer(mux)
+		t.Cleanup(server.Close)
+		request, err := http.NewRequestWithContext(
+			context.Background(),
+			http.MethodPost,
+			server.URL+"/"+pingv1connect.PingServiceName+"/Ping",
+			strings.NewReader(`{"number": "42", "addedInV2": true}`),
+		)
+		assert.Nil(t, err)
+		request.Header.Set("Content-Type", "application/json")
+		response, err := server.Client().Do(request)
+		assert.Nil(t, err)
+		t.Cleanup(func() { _ = response.Body.Close() })
+		return response
+	}
+	t.Run("default", func(t *testing.T) {
+		t.Parallel()
+		response := run(t)
+		assert.Equal(t, response.StatusCode, http.StatusBadRequest)
+	})
+	t.Run("discard_unknown", func(t *testing.T) {
+		t.Parallel()
+		response := run(t, connect.WithProtoUnmarshalOptions(proto.UnmarshalOptions{DiscardUnknown: true}))
+		assert.Equal(t, response.StatusCode, http.StatusOK)
+		var pong pingv1.PingResponse
+		body, err := io.ReadAll(response.Body)
+		assert.Nil(t, err)
+		assert.Nil(t, protojson.Unmarshal(body, &pong))
+		assert.Equal(t, pong.Number, 42)
+	})
+}
+
+func TestBidiStreamCloseReceive(t *testing.T) {
+	t.Parallel()
+	const cumSumProcedure = "/" + pingv1connect.PingServiceName + "/CumSum"
+	mux := http.NewServeMux()
+	mux.Handle(cumSumProcedure, connect.NewBidiStreamHandler(
+		cumSumProcedure,
+		func(ctx context.Context, stream *connect.BidiStream[pingv1.CumSumRequest, pingv1.CumSumResponse]) error {
+			msg, err := stream.Receive()
+			if err != nil {
+				return err
+			}
+			if err := stream.CloseReceive(); err != nil {
+				return err
+			}
+			if _, err := stream.Receive(); !errors.Is(err, io.EOF) {
+				return connect.NewError(connect.CodeInternal, fmt.Errorf("expected EOF after CloseReceive, got %v", err))
+			}
+			return stream.Send(&pingv1.CumSumResponse{Sum: msg.Number})
+		},
+	))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	run := func(t *testing.T, opts ...connect.ClientOption) {
+		t.Helper()
+		client := connect.NewClient[pingv1.CumSumRequest, pingv1.CumSumResponse](
+			server.Client(),
+			server.URL+cumSumProcedure,
+			opts...,
+		)
+		stream := client.CallBidiStream(context.Background())
+		assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: 42}))
+		msg, err := stream.Receive()
+		assert.Nil(t, err)
+		assert.Equal(t, msg.Sum, 42)
+		_, err = stream.Receive()
+		assert.ErrorIs(t, err, io.EOF)
+		assert.Nil(t, stream.CloseRequest())
+		assert.Nil(t, stream.CloseResponse())
+	}
+	t.Run("connect", func(t *testing.T) {
+		t.Parallel()
+		run(t)
+	})
+	t.Run("grpc", func(t *testing.T) {
+		t.Parallel()
+		run(t, connect.WithGRPC())
+	})
+	t.Run("grpcweb", func(t *testing.T) {
+		t.Parallel()
+		run(t, connect.WithGRPCWeb())
+	})
+}
+
+func TestBidiStreamMessageMetadata(t *testing.T) {
+	t.Parallel()
+	const (
+		cumSumProcedure = "/" + pingv1connect.PingServiceName + "/CumSum"
+		traceparent     = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	)
+	mux := http.NewServeMux()
+	mux.Handle(cumSumProcedure, connect.NewBidiStreamHandler(
+		cumSumProcedure,
+		func(ctx context.Context, stream *connect.BidiStream[pingv1.CumSumRequest, pingv1.CumSumResponse]) error {
+			var sum int64
+			for {
+				msg := &pingv1.CumSumRequest{}
+				metadata, err := connect.ReceiveWithMetadata(stream.Conn(), msg)
+				if errors.Is(err, io.EOF) {
+					return nil
+				} else if err != nil {
+					return err
+				}
+				sum += msg.Number
+				// Echo the request's metadata, if any.
+				if err := connect.SendWithMetadata(stream.Conn(), &pingv1.CumSumResponse{Sum: sum}, metadata); err != nil {
+					return err
+				}
+			}
+		},
+		connect.WithMessageMetadata(),
+	))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	run := func(t *testing.T, expectMetadata bool, opts ...connect.ClientOption) {
+		t.Helper()
+		client := connect.NewClient[pingv1.CumSumRequest, pingv1.CumSumResponse](
+			server.Client(),
+			server.URL+cumSumProcedure,
+			opts...,
+		)
+		stream := client.CallBidiStream(context.Background())
+		conn, err := stream.Conn()
+		assert.Nil(t, err)
+		metadata := http.Header{"Traceparent": []string{traceparent}}
+		assert.Nil(t, connect.SendWithMetadata(conn, &pingv1.CumSumRequest{Number: 1}, metadata))
+		msg := &pingv1.CumSumResponse{}
+		received, err := connect.ReceiveWithMetadata(conn, msg)
+		assert.Nil(t, err)
+		assert.Equal(t, msg.Sum, 1)
+		if expectMetadata {
+			assert.Equal(t, received.Get("Traceparent"), traceparent)
+		} else {
+			assert.Nil(t, received)
+		}
+		// Unannotated messages don't inherit metadata.
+		assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: 2}))
+		received, err = connect.ReceiveWithMetadata(conn, msg)
+		assert.Nil(t, err)
+		assert.Equal(t, msg.Sum, 3)
+		assert.Nil(t, received)
+		assert.Nil(t, stream.CloseRequest())
+		_, err = stream.Receive()
+		assert.ErrorIs(t, err, io.EOF)
+		assert.Nil(t, stream.CloseResponse())
+	}
+	t.Run("connect", func(t *testing.T) {
+		t.Parallel()
+		run(t, true, connect.WithMessageMetadata())
+	})
+	t.Run("grpc", func(t *testing.T) {
+		t.Parallel()
+		run(t, true, connect.WithGRPC(), connect.WithMessageMetadata())
+	})
+	t.Run("grpcweb", func(t *testing.T) {
+		t.Parallel()
+		run(t, true, connect.WithGRPCWeb(), connect.WithMessageMetadata())
+	})
+	t.Run("default_call_timeout", func(t *testing.T) {
+		t.Parallel()
+		run(t, true, connect.WithMessageMetadata(), connect.WithDefaultCallTimeout(time.Minute))
+	})
+	t.Run("max_concurrent_calls", func(t *testing.T) {
+		t.Parallel()
+		run(t, true, connect.WithMessageMetadata(), connect.WithMaxConcurrentCalls(1, connect.QueuePolicy{}))
+	})
+	t.Run("coded_errors", func(t *testing.T) {
+		t.Parallel()
+		run(t, true, connect.WithMessageMetadata(), connect.WithCodedErrors())
+	})
+	t.Run("not_negotiated", func(t *testing.T) {
+		t.Parallel()
+		run(t, false)
+	})
+}
+
+func TestBidiStreamEnvelopeFlags(t *testing.T) {
+	t.Parallel()
+	const cumSumProcedure = "/" + pingv1connect.PingServiceName + "/CumSum"
+	mux := http.NewServeMux()
+	mux.Handle(cumSumProcedure, connect.NewBidiStreamHandler(
+		cumSumProcedure,
+		func(ctx context.Context, stream *connect.BidiStream[pingv1.CumSumRequest, pingv1.CumSumResponse]) error {
+			var sum int64
+			for {
+				msg := &pingv1.CumSumRequest{}
+				flags, err := connect.ReceiveWithEnvelopeFlags(stream.Conn(), msg)
+				if errors.Is(err, io.EOF) {
+					return nil
+				} else if err != nil {
+					return err
+				}
+				sum += msg.Number
+				// Echo the request's flags, if any.
+				if err := connect.SendWithEnvelopeFlags(stream.Conn(), &pingv1.CumSumResponse{Sum: sum}, flags...); err != nil {
+					return err
+				}
+			}
+		},
+		connect.WithEnvelopeFlags(
+			connect.EnvelopeFlag{Name: "checksum", Bit: 3},
+			connect.EnvelopeFlag{Name: "priority", Bit: 4},
+		),
+	))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	run := func(t *testing.T, opts ...connect.ClientOption) {
+		t.Helper()
+		client := connect.NewClient[pingv1.CumSumRequest, pingv1.CumSumResponse](
+			server.Client(),
+			server.URL+cumSumProcedure,
+			append(opts, connect.WithEnvelopeFlags(
+				connect.EnvelopeFlag{Name: "checksum", Bit: 3},
+				connect.EnvelopeFlag{Name: "priority", Bit: 5}, // disagrees with handler
+			))...,
+		)
+		stream := client.CallBidiStream(context.Background())
+		conn, err := stream.Conn()
+		assert.Nil(t, err)
+		assert.Nil(t, connect.SendWithEnvelopeFlags(conn, &pingv1.CumSumRequest{Number: 1}, "checksum", "unknown"))
+		msg := &pingv1.CumSumResponse{}
+		flags, err := connect.ReceiveWithEnvelopeFlags(conn, msg)
+		assert.Nil(t, err)
+		assert.Equal(t, msg.Sum, 1)
+		assert.Equal(t, flags, []string{"checksum"})
+		assert.Equal(t, stream.ResponseHeader().Get("Connect-Envelope-Flags"), "checksum=3")
+		// Messages without flags are unaffected.
+		assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: 2}))
+		flags, err = connect.ReceiveWithEnvelopeFlags(conn, msg)
+		assert.Nil(t, err)
+		assert.Equal(t, msg.Sum, 3)
+		assert.Nil(t, flags)
+		assert.Nil(t, stream.CloseRequest())
+		_, err = stream.Receive()
+		assert.ErrorIs(t, err, io.EOF)
+		assert.Nil(t, stream.CloseResponse())
+	}
+	t.Run("connect", func(t *testing.T) {
+		t.Parallel()
+		run(t)
+	})
+	t.Run("grpc", func(t *testing.T) {
+		t.Parallel()
+		run(t, connect.WithGRPC())
+	})
+	t.Run("grpcweb", func(t *testing.T) {
+		t.Parallel()
+		run(t, connect.WithGRPCWeb())
+	})
+	t.Run("default_call_timeout", func(t *testing.T) {
+		t.Parallel()
+		run(t, connect.WithDefaultCallTimeout(time.Minute))
+	})
+	t.Run("max_concurrent_calls", func(t *testing.T) {
+		t.Parallel()
+		run(t, connect.WithMaxConcurrentCalls(1, connect.QueuePolicy{}))
+	})
+	t.Run("coded_errors", func(t *testing.T) {
+		t.Parallel()
+		run(t, connect.WithCodedErrors())
+	})
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+		client := connect.NewClient[pingv1.CumSumRequest, pingv1.CumSumResponse](
+			server.Client(),
+			server.URL+cumSumProcedure,
+			connect.WithEnvelopeFlags(connect.EnvelopeFlag{Name: "compressed", Bit: 0}),
+		)
+		stream := client.CallBidiStream(context.Background())
+		_, err := stream.Conn()
+		assert.NotNil(t, err)
+	})
+	t.Run("invalid_handler", func(t *testing.T) {
+		t.Parallel()
+		mux := http.NewServeMux()
+		mux.Handle(cumSumProcedure, connect.NewBidiStreamHandler(
+			cumSumProcedure,
+			func(ctx context.Context, stream *connect.BidiStream[pingv1.CumSumRequest, pingv1.CumSumResponse]) error {
+				return nil
+			},
+			connect.WithEnvelopeFlags(connect.EnvelopeFlag{Name: "compressed", Bit: 7}),
+		))
+		server := httptest.NewUnstartedServer(mux)
+		server.EnableHTTP2 = true
+		server.StartTLS()
+		t.Cleanup(server.Close)
+		client := connect.NewClient[pingv1.CumSumRequest, pingv1.CumSumResponse](
+			server.Client(),
+			server.URL+cumSumProcedure,
+		)
+		stream := client.CallBidiStream(context.Background())
+		assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: 1}))
+		assert.Nil(t, stream.CloseRequest())
+		_, err := stream.Receive()
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnknown)
+		assert.True(t, strings.Contains(err.Error(), "bit 7 is reserved"))
+		assert.Nil(t, stream.CloseResponse())
+	})
+}
+
+func TestHandlerOptionsKeepStreamFeatures(t *testing.T) {
+	t.Parallel()
+	// Options that wrap the handler's conn must keep per-message metadata,
+	// envelope flags, and CloseReceive working.
+	const cumSumProcedure = "/" + pingv1connect.PingServiceName + "/CumSum"
+	flag := connect.EnvelopeFlag{Name: "checksum", Bit: 3}
+	testCases := []struct {
+		name    string
+		options []connect.HandlerOption
+	}{
+		{name: "response_validation", options: []connect.HandlerOption{connect.WithResponseValidation()}},
+		{name: "unknown_fields", options: []connect.HandlerOption{connect.WithUnknownFieldsHeader()}},
+		{name: "audit_log", options: []connect.HandlerOption{connect.WithAuditLog(&memoryAuditSink{})}},
+	}
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			mux := http.NewServeMux()
+			mux.Handle(cumSumProcedure, connect.NewBidiStreamHandler(
+				cumSumProcedure,
+				func(ctx context.Context, stream *connect.BidiStream[pingv1.CumSumRequest, pingv1.CumSumResponse]) error {
+					msg := &pingv1.CumSumRequest{}
+					metadata, err := connect.ReceiveWithMetadata(stream.Conn(), msg)
+					if err != nil {
+						return err
+					}
+					if err := connect.SendWithMetadata(stream.Conn(), &pingv1.CumSumResponse{Sum: msg.Number}, metadata); err != nil {
+						return err
+					}
+					flags, err := connect.ReceiveWithEnvelopeFlags(stream.Conn(), msg)
+					if err != nil {
+						return err
+					}
+					if err := connect.SendWithEnvelopeFlags(stream.Conn(), &pingv1.CumSumResponse{Sum: msg.Number}, flags...); err != nil {
+						return err
+					}
+					if err := stream.CloseReceive(); err != nil {
+						return err
+					}
+					if _, err := stream.Receive(); !errors.Is(err, io.EOF) {
+						return connect.NewError(connect.CodeInternal, fmt.Errorf("receive after CloseReceive: %w", err))
+					}
+					return nil
+				},
+				append(testCase.options, connect.WithMessageMetadata(), connect.WithEnvelopeFlags(flag))...,
+			))
+			server := httptest.NewUnstartedServer(mux)
+			server.EnableHTTP2 = true
+			server.StartTLS()
+			t.Cleanup(server.Close)
+
+			client := connect.NewClient[pingv1.CumSumRequest, pingv1.CumSumResponse](
+				server.Client(),
+				server.URL+cumSumProcedure,
+				connect.WithMessageMetadata(),
+				connect.WithEnvelopeFlags(flag),
+			)
+			stream := client.CallBidiStream(context.Background())
+			t.Cleanup(func() {
+				// Close the stream before the server, even if an assertion
+				// fails.
+				_ = stream.CloseRequest()
+				_ = stream.CloseResponse()
+			})
+			conn, err := stream.Conn()
+			assert.Nil(t, err)
+			assert.Nil(t, connect.SendWithMetadata(conn, &pingv1.CumSumRequest{Number: 1}, http.Header{"Foo": []string{"bar"}}))
+			metadata, err := connect.ReceiveWithMetadata(conn, &pingv1.CumSumResponse{})
+			assert.Nil(t, err)
+			assert.Equal(t, metadata.Get("Foo"), "bar")
+			assert.Nil(t, connect.SendWithEnvelopeFlags(conn, &pingv1.CumSumRequest{Number: 2}, "checksum"))
+			flags, err := connect.ReceiveWithEnvelopeFlags(conn, &pingv1.CumSumResponse{})
+			assert.Nil(t, err)
+			assert.Equal(t, flags, []string{"checksum"})
+			_, err = stream.Receive()
+			assert.ErrorIs(t, err, io.EOF)
+			assert.Nil(t, stream.CloseRequest())
+			assert.Nil(t, stream.CloseResponse())
+		})
+	}
+}
+
+func TestServerStreamCache(t *testing.T) {
+	t.Parallel()
+	const countUpProcedure = "/" + pingv1connect.PingServiceName + "/CountUp"
+	var calls int32
+	mux := http.NewServeMux()
+	mux.Handle(countUpProcedure, connect.NewServerStreamHandler(
+		countUpProcedure,
+		func(ctx context.Context, req *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+			atomic.AddInt32(&calls, 1)
+			if req.Msg.Number <= 0 {
+				return connect.NewError(connect.CodeInvalidArgument, errors.New("number must be positive"))
+			}
+			stream.ResponseHeader().Set("X-Count", fmt.Sprint(req.Msg.Number))
+			stream.ResponseTrailer().Set("X-Done", "true")
+			msg := &pingv1.CountUpResponse{}
+			for i := int64(1); i <= req.Msg.Number; i++ {
+				msg.Number = i // reused, so the cache must copy sent messages
+				if err := stream.Send(msg); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		connect.WithServerStreamCache(time.Hour),
+	))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	countUp := func(t *testing.T, number int64, opts ...connect.ClientOption) error {
+		t.Helper()
+		client := connect.NewClient[pingv1.CountUpRequest, pingv1.CountUpResponse](
+			server.Client(),
+			server.URL+countUpProcedure,
+			opts...,
+		)
+		stream, err := client.CallServerStream(
+			context.Background(),
+			connect.NewRequest(&pingv1.CountUpRequest{Number: number}),
+		)
+		assert.Nil(t, err)
+		var got []int64
+		for stream.Receive() {
+			got = append(got, stream.Msg().Number)
+		}
+		if err := stream.Err(); err != nil {
+			return err
+		}
+		assert.Equal(t, len(got), int(number))
+		for i, n := range got {
+			assert.Equal(t, n, int64(i+1))
+		}
+		assert.Equal(t, stream.ResponseHeader().Get("X-Count"), fmt.Sprint(number))
+		assert.Equal(t, stream.ResponseTrailer().Get("X-Done"), "true")
+		return stream.Close()
+	}
+
+	// Run sequentially, since we're counting calls to the implementation.
+	assert.Nil(t, countUp(t, 3))
+	assert.Equal(t, atomic.LoadInt32(&calls), 1)
+	assert.Nil(t, countUp(t, 3, connect.WithGRPC()))
+	assert.Nil(t, countUp(t, 3, connect.WithGRPCWeb()))
+	assert.Equal(t, atomic.LoadInt32(&calls), 1)
+	assert.Nil(t, countUp(t, 4))
+	assert.Equal(t, atomic.LoadInt32(&calls), 2)
+	// Errors aren't cached.
+	assert.Equal(t, connect.CodeOf(countUp(t, 0)), connect.CodeInvalidArgument)
+	assert.Equal(t, connect.CodeOf(countUp(t, 0)), connect.CodeInvalidArgument)
+	assert.Equal(t, atomic.LoadInt32(&calls), 4)
+}
+
+func TestDeadlineMargin(t *testing.T) {
+	t.Parallel()
+	const (
+		pingProcedure = "/" + pingv1connect.PingServiceName + "/Ping"
+		margin        = 2 * time.Second
+	)
+	var downstream *connect.Client[pingv1.PingRequest, pingv1.PingResponse]
+	mux := http.NewServeMux()
+	mux.Handle(pingProcedure, connect.NewUnaryHandler(
+		pingProcedure,
+		func(ctx context.Context, req *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			if req.Msg.Text == "outbound" {
+				deadline, ok := ctx.Deadline()
+				assert.True(t, ok)
+				assert.True(t, time.Until(deadline) > margin)
+				return downstream.CallUnary(ctx, connect.NewRequest(&pingv1.PingRequest{}))
+			}
+			remaining, ok := connect.RemainingBudget(ctx)
+			if !ok {
+				return connect.NewResponse(&pingv1.PingResponse{Number: -1}), nil
+			}
+			return connect.NewResponse(&pingv1.PingResponse{Number: int64(remaining)}), nil
+		},
+		connect.WithDeadlineMargin(margin),
+	))
+	mux.Handle("/downstream"+pingProcedure, connect.NewUnaryHandler(
+		pingProcedure,
+		func(ctx context.Context, req *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			remaining, _ := connect.RemainingBudget(ctx)
+			return connect.NewResponse(&pingv1.PingResponse{Number: int64(remaining), Text: "downstream"}), nil
+		},
+	))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := connect.NewClient[pingv1.PingRequest, pingv1.PingResponse](
+		server.Client(),
+		server.URL+pingProcedure,
+	)
+	downstream = connect.NewClient[pingv1.PingRequest, pingv1.PingResponse](
+		server.Client(),
+		server.URL+"/downstream"+pingProcedure,
+	)
+
+	t.Run("deadline", func(t *testing.T) {
+		t.Parallel()
+		const timeout = 5 * time.Second
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		response, err := client.CallUnary(ctx, connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Nil(t, err)
+		remaining := time.Duration(response.Msg.Number)
+		assert.True(t, remaining > 0)
+		assert.True(t, remaining <= timeout-margin)
+	})
+	t.Run("no_deadline", func(t *testing.T) {
+		t.Parallel()
+		response, err := client.CallUnary(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.Number, -1)
+	})
+	t.Run("exhausted", func(t *testing.T) {
+		t.Parallel()
+		// The handler's own deadline isn't shortened, but it has no budget left
+		// for outbound calls.
+		ctx, cancel := context.WithTimeout(context.Background(), margin/2)
+		defer cancel()
+		response, err := client.CallUnary(ctx, connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Nil(t, err)
+		assert.Zero(t, response.Msg.Number)
+	})
+	t.Run("outbound", func(t *testing.T) {
+		t.Parallel()
+		const timeout = 5 * time.Second
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		response, err := client.CallUnary(ctx, connect.NewRequest(&pingv1.PingRequest{Text: "outbound"}))
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.Text, "downstream")
+		// The downstream handler received a timeout shortened by the margin,
+		// while this handler kept its full deadline.
+		downstream := time.Duration(response.Msg.Number)
+		assert.True(t, downstream > 0)
+		assert.True(t, downstream <= timeout-margin)
+	})
+}
+
+func TestDeadlineReport(t *testing.T) {
+	t.Parallel()
+	const (
+		pingProcedure = "/" + pingv1connect.PingServiceName + "/Ping"
+		timeout       = 5 * time.Second
+		skew          = 2 * time.Second
+	)
+	mux := http.NewServeMux()
+	mux.Handle(pingProcedure, connect.NewUnaryHandler(
+		pingProcedure,
+		func(ctx context.Context, req *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			return connect.NewResponse(&pingv1.PingResponse{}), nil
+		},
+		connect.WithDeadlineReport(),
+	))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	for _, opts := range []struct {
+		name    string
+		options []connect.ClientOption
+	}{
+		{name: "connect"},
+		{name: "grpc", options: []connect.ClientOption{connect.WithGRPC()}},
+	} {
+		opts := opts
+		t.Run(opts.name, func(t *testing.T) {
+			t.Parallel()
+			call := func(ctx context.Context, options ...connect.ClientOption) (time.Duration, bool) {
+				t.Helper()
+				client := connect.NewClient[pingv1.PingRequest, pingv1.PingResponse](
+					server.Client(),
+					server.URL+pingProcedure,
+					append(options, opts.options...)...,
+				)
+				response, err := client.CallUnary(ctx, connect.NewRequest(&pingv1.PingRequest{}))
+				assert.Nil(t, err)
+				return connect.ReportedDeadline(response.Header())
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			reported, ok := call(ctx)
+			assert.True(t, ok)
+			assert.True(t, reported > timeout-skew)
+			assert.True(t, reported <= timeout)
+
+			reported, ok = call(ctx, connect.WithTimeoutSkew(skew))
+			assert.True(t, ok)
+			assert.True(t, reported > 0)
+			assert.True(t, reported <= timeout-skew)
+
+			_, ok = call(context.Background(), connect.WithTimeoutSkew(skew))
+			assert.False(t, ok)
+		})
+	}
+}
+
+func TestHandlerFlushPolicy(t *testing.T) {
+	t.Parallel()
+	const messages = 10
+	run := func(t *testing.T, options ...connect.HandlerOption) (int64, http.Header) {
+		t.Helper()
+		_, handler := pingv1connect.NewPingServiceHandler(pingServer{}, options...)
+		var flushes int64
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handler.ServeHTTP(&countingFlushWriter{ResponseWriter: w, flushes: &flushes}, r)
+		}))
+		t.Cleanup(server.Close)
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: messages}))
+		assert.Nil(t, err)
+		var received int
+		for stream.Receive() {
+			received++
+		}
+		assert.Nil(t, stream.Err())
+		assert.Nil(t, stream.Close())
+		assert.Equal(t, received, messages)
+		return atomic.LoadInt64(&flushes), stream.ResponseHeader()
+	}
+	t.Run("default", func(t *testing.T) {
+		t.Parallel()
+		flushes, header := run(t)
+		assert.True(t, flushes >= messages)
+		assert.Equal(t, header.Get("X-Accel-Buffering"), "")
+	})
+	t.Run("immediate", func(t *testing.T) {
+		t.Parallel()
+		flushes, header := run(t, connect.WithImmediateFlush())
+		assert.True(t, flushes >= messages)
+		assert.Equal(t, header.Get("X-Accel-Buffering"), "no")
+	})
+	t.Run("threshold", func(t *testing.T) {
+		t.Parallel()
+		flushes, header := run(t, connect.WithFlushThreshold(1<<20))
+		assert.Zero(t, flushes)
+		assert.Equal(t, header.Get("X-Accel-Buffering"), "no")
+	})
+}
+
+func TestTimeoutLimits(t *testing.T) {
+	t.Parallel()
+	const (
+		pingProcedure = "/" + pingv1connect.PingServiceName + "/Ping"
+		minTimeout    = 5 * time.Second
+		maxTimeout    = time.Minute
+	)
+	mux := http.NewServeMux()
+	mux.Handle(pingProcedure, connect.NewUnaryHandler(
+		pingProcedure,
+		func(ctx context.Context, req *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			remaining, ok := connect.RemainingBudget(ctx)
+			assert.True(t, ok)
+			return connect.NewResponse(&pingv1.PingResponse{Number: int64(remaining)}), nil
+		},
+		connect.WithMinTimeout(minTimeout),
+		connect.WithMaxTimeout(maxTimeout),
+	))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	run := func(t *testing.T, timeout time.Duration, opts ...connect.ClientOption) (time.Duration, error) {
+		t.Helper()
+		client := connect.NewClient[pingv1.PingRequest, pingv1.PingResponse](
+			server.Client(),
+			server.URL+pingProcedure,
+			opts...,
+		)
+		ctx := context.Background()
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		response, err := client.CallUnary(ctx, connect.NewRequest(&pingv1.PingRequest{}))
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(response.Msg.Number), nil
+	}
+	for _, protocol := range []struct {
+		name string
+		opts []connect.ClientOption
+	}{
+		{name: "connect"},
+		{name: "grpcweb", opts: []connect.ClientOption{connect.WithGRPCWeb()}},
+	} {
+		protocol := protocol
+		t.Run(protocol.name, func(t *testing.T) {
+			t.Parallel()
+			remaining, err := run(t, 24*time.Hour, protocol.opts...)
+			assert.Nil(t, err)
+			assert.True(t, remaining <= maxTimeout)
+			remaining, err = run(t, 0, protocol.opts...)
+			assert.Nil(t, err)
+			assert.True(t, remaining <= maxTimeout)
+			remaining, err = run(t, 10*time.Second, protocol.opts...)
+			assert.Nil(t, err)
+			assert.True(t, remaining <= 10*time.Second)
+			_, err = run(t, time.Second, protocol.opts...)
+			assert.Equal(t, connect.CodeOf(err), connect.CodeInvalidArgument)
+		})
+	}
+}
+
+func TestDefaultTimeout(t *testing.T) {
+	t.Parallel()
+	const (
+		pingProcedure   = "/" + pingv1connect.PingServiceName + "/Ping"
+		exportProcedure = "/" + pingv1connect.PingServiceName + "/Export"
+	)
+	implementation := func(ctx context.Context, req *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+		remaining, ok := connect.RemainingBudget(ctx)
+		if !ok {
+			remaining = -1
+		}
+		return connect.NewResponse(&pingv1.PingResponse{Number: int64(remaining)}), nil
+	}
+	options := connect.WithHandlerOptions(
+		connect.WithDefaultTimeout(10*time.Second),
+		connect.WithMaxTimeout(time.Minute),
+		connect.WithProcedureOptions(exportProcedure, connect.WithDefaultTimeout(time.Hour)),
+	)
+	mux := http.NewServeMux()
+	mux.Handle(pingProcedure, connect.NewUnaryHandler(pingProcedure, implementation, options))
+	mux.Handle(exportProcedure, connect.NewUnaryHandler(exportProcedure, implementation, options))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	run := func(t *testing.T, procedure string, timeout time.Duration) time.Duration {
+		t.Helper()
+		client := connect.NewClient[pingv1.PingRequest, pingv1.PingResponse](
+			server.Client(),
+			server.URL+procedure,
+		)
+		ctx := context.Background()
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		response, err := client.CallUnary(ctx, connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Nil(t, err)
+		return time.Duration(response.Msg.Number)
+	}
+	remaining := run(t, pingProcedure, 0)
+	assert.True(t, remaining > 9*time.Second && remaining <= 10*time.Second)
+	// Timeouts sent by the client aren't shortened to the default...
+	remaining = run(t, pingProcedure, 30*time.Second)
+	assert.True(t, remaining > 10*time.Second && remaining <= 30*time.Second)
+	// ...but they're still limited by the maximum.
+	remaining = run(t, pingProcedure, time.Hour)
+	assert.True(t, remaining <= time.Minute)
+	// The per-procedure default is longer than the maximum, so the maximum
+	// applies.
+	remaining = run(t, exportProcedure, 0)
+	assert.True(t, remaining > 50*time.Second && remaining <= time.Minute)
+}
+
+func TestPolicyResolver(t *testing.T) {
+	t.Parallel()
+	const pingProcedure = "/" + pingv1connect.PingServiceName + "/Ping"
+	type tenantKey struct{}
+	policies := map[string]connect.CallPolicy{
+		"limited": {Limiter: denyLimiter{}},
+		"small":   {ReadMaxBytes: 8},
+		"slow":    {Timeout: time.Millisecond},
+	}
+	mux := http.NewServeMux()
+	mux.Handle(pingProcedure, connect.NewUnaryHandler(
+		pingProcedure,
+		func(ctx context.Context, req *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			if req.Msg.Text == "wait" {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			return connect.NewResponse(&pingv1.PingResponse{Number: req.Msg.Number}), nil
+		},
+		connect.WithPolicyResolver(func(ctx context.Context, spec connect.Spec, peer connect.Peer) connect.CallPolicy {
+			tenant, _ := ctx.Value(tenantKey{}).(string)
+			return policies[tenant]
+		}),
+	))
+	// Stand-in for authentication middleware.
+	authenticate := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), tenantKey{}, r.Header.Get("Tenant"))
+		mux.ServeHTTP(w, r.WithContext(ctx))
+	})
+	server := httptest.NewServer(authenticate)
+	t.Cleanup(server.Close)
+	client := connect.NewClient[pingv1.PingRequest, pingv1.PingResponse](
+		server.Client(),
+		server.URL+pingProcedure,
+	)
+	call := func(tenant string, msg *pingv1.PingRequest) error {
+		req := connect.NewRequest(msg)
+		req.Header().Set("Tenant", tenant)
+		_, err := client.CallUnary(context.Background(), req)
+		return err
+	}
+	large := &pingv1.PingRequest{Number: 42, Text: strings.Repeat("a", 64)}
+
+	t.Run("default", func(t *testing.T) {
+		t.Parallel()
+		assert.Nil(t, call("", large))
+	})
+	t.Run("limiter", func(t *testing.T) {
+		t.Parallel()
+		err := call("limited", &pingv1.PingRequest{})
+		assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+	})
+	t.Run("read_max_bytes", func(t *testing.T) {
+		t.Parallel()
+		assert.Nil(t, call("small", &pingv1.PingRequest{Number: 42}))
+		err := call("small", large)
+		assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+	})
+	t.Run("timeout", func(t *testing.T) {
+		t.Parallel()
+		err := call("slow", &pingv1.PingRequest{Text: "wait"})
+		assert.Equal(t, connect.CodeOf(err), connect.CodeDeadlineExceeded)
+	})
+}
+
+type denyLimiter struct{}
+
+func (denyLimiter) Allow() bool { return false }
+
+func TestRuntimeLimits(t *testing.T) {
+	t.Parallel()
+	const pingProcedure = "/" + pingv1connect.PingServiceName + "/Ping"
+	limits := connect.NewRuntimeLimits(connect.CallPolicy{})
+	mux := http.NewServeMux()
+	mux.Handle(pingProcedure, connect.NewUnaryHandler(
+		pingProcedure,
+		func(ctx context.Context, req *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			return connect.NewResponse(&pingv1.PingResponse{Number: req.Msg.Number}), nil
+		},
+		connect.WithRuntimeLimits(limits),
+		connect.WithPolicyResolver(func(ctx context.Context, spec connect.Spec, peer connect.Peer) connect.CallPolicy {
+			return connect.CallPolicy{ReadMaxBytes: 32}
+		}),
+	))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := connect.NewClient[pingv1.PingRequest, pingv1.PingResponse](
+		server.Client(),
+		server.URL+pingProcedure,
+	)
+	call := func(msg *pingv1.PingRequest) error {
+		_, err := client.CallUnary(context.Background(), connect.NewRequest(msg))
+		return err
+	}
+	medium := &pingv1.PingRequest{Number: 42, Text: strings.Repeat("a", 16)}
+	large := &pingv1.PingRequest{Number: 42, Text: strings.Repeat("a", 64)}
+
+	assert.Equal(t, limits.Load(), connect.CallPolicy{})
+	assert.Nil(t, call(medium))
+	// The resolver's limit is stricter.
+	err := call(large)
+	assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+
+	limits.Store(connect.CallPolicy{ReadMaxBytes: 8})
+	assert.Equal(t, limits.Load().ReadMaxBytes, 8)
+	assert.Nil(t, call(&pingv1.PingRequest{Number: 42}))
+	err = call(medium)
+	assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+
+	limits.Store(connect.CallPolicy{Limiter: denyLimiter{}})
+	err = call(&pingv1.PingRequest{Number: 42})
+	assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+
+	limits.Store(connect.CallPolicy{})
+	assert.Nil(t, call(medium))
+}
+
+func TestSlowRequestThreshold(t *testing.T) {
+	t.Parallel()
+	const (
+		pingProcedure    = "/" + pingv1connect.PingServiceName + "/Ping"
+		countUpProcedure = "/" + pingv1connect.PingServiceName + "/CountUp"
+		threshold        = 10 * time.Millisecond
+	)
+	type report struct {
+		procedure string
+		elapsed   time.Duration
+		stage     connect.SlowRequestStage
+	}
+	reports := make(chan report, 2)
+	release := make(chan struct{})
+	slowOption := connect.WithSlowRequestThreshold(
+		threshold,
+		func(ctx context.Context, spec connect.Spec, peer connect.Peer, elapsed time.Duration, stage connect.SlowRequestStage) {
+			assert.NotZero(t, peer.Addr)
+			reports <- report{procedure: spec.Procedure, elapsed: elapsed, stage: stage}
+		},
+	)
+	mux := http.NewServeMux()
+	mux.Handle(pingProcedure, connect.NewUnaryHandler(
+		pingProcedure,
+		func(ctx context.Context, req *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			<-release
+			return connect.NewResponse(&pingv1.PingResponse{}), nil
+		},
+		slowOption,
+	))
+	mux.Handle(countUpProcedure, connect.NewServerStreamHandler(
+		countUpProcedure,
+		func(ctx context.Context, req *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+			if err := stream.Send(&pingv1.CountUpResponse{Number: 1}); err != nil {
+				return err
+			}
+			<-release
+			return nil
+		},
+		slowOption,
+	))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+
+	unaryErr := make(chan error, 1)
+	go func() {
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		unaryErr <- err
+	}()
+	got := <-reports
+	assert.Equal(t, got.procedure, pingProcedure)
+	assert.Equal(t, got.stage, connect.SlowRequestStageHeaders)
+	assert.True(t, got.elapsed >= threshold)
+
+	stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{}))
+	assert.Nil(t, err)
+	assert.True(t, stream.Receive())
+	got = <-reports
+	assert.Equal(t, got.procedure, countUpProcedure)
+	assert.Equal(t, got.stage, connect.SlowRequestStageTotal)
+
+	close(release)
+	assert.Nil(t, <-unaryErr)
+	assert.False(t, stream.Receive())
+	assert.Nil(t, stream.Err())
+	assert.Nil(t, stream.Close())
+	assert.Equal(t, len(reports), 0)
+}
+
+func TestStreamContextErrors(t *testing.T) {
+	t.Parallel()
+	const cumSumProcedure = "/" + pingv1connect.PingServiceName + "/CumSum"
+	run := func(t *testing.T, expectHandlerCode connect.Code, opts ...connect.HandlerOption) {
+		t.Helper()
+		receiveErrs := make(chan error, 1)
+		returnedErrs := make(chan error, 1)
+		mux := http.NewServeMux()
+		mux.Handle(cumSumProcedure, connect.NewBidiStreamHandler(
+			cumSumProcedure,
+			func(ctx context.Context, stream *connect.BidiStream[pingv1.CumSumRequest, pingv1.CumSumResponse]) error {
+				for {
+					msg, err := stream.Receive()
+					if err != nil {
+						receiveErrs <- err
+						return err
+					}
+					if err := stream.Send(&pingv1.CumSumResponse{Sum: msg.Number}); err != nil {
+						receiveErrs <- err
+						return err
+					}
+				}
+			},
+			connect.WithHandlerOptions(opts...),
+			connect.WithInterceptors(&recordStreamingHandlerErrInterceptor{errs: returnedErrs}),
+		))
+		server := httptest.NewUnstartedServer(mux)
+		server.EnableHTTP2 = true
+		server.StartTLS()
+		t.Cleanup(server.Close)
+
+		client := connect.NewClient[pingv1.CumSumRequest, pingv1.CumSumResponse](
+			server.Client(),
+			server.URL+cumSumProcedure,
+		)
+		ctx, cancel := context.WithCancel(context.Background())
+		stream := client.CallBidiStream(ctx)
+		assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: 1}))
+		_, err := stream.Receive()
+		assert.Nil(t, err)
+		cancel()
+		_, err = stream.Receive()
+		assert.Equal(t, connect.CodeOf(err), connect.CodeCanceled)
+		assert.ErrorIs(t, err, context.Canceled)
+
+		select {
+		case err := <-receiveErrs:
+			assert.Equal(t, connect.CodeOf(err), connect.CodeCanceled)
+		case <-time.After(5 * time.Second):
+			t.Fatal("handler didn't observe cancellation")
+		}
+		select {
+		case err := <-returnedErrs:
+			assert.Equal(t, connect.CodeOf(err), expectHandlerCode)
+		case <-time.After(5 * time.Second):
+			t.Fatal("handler didn't return")
+		}
+	}
+	t.Run("default", func(t *testing.T) {
+		t.Parallel()
+		run(t, connect.CodeCanceled)
+	})
+	t.Run("client_cancel_code", func(t *testing.T) {
+		t.Parallel()
+		run(t, connect.CodeDeadlineExceeded, connect.WithClientCancelCode(connect.CodeDeadlineExceeded))
+	})
+}
+
+type recordStreamingHandlerErrInterceptor struct {
+	errs chan error
+}
+
+func (i *recordStreamingHandlerErrInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return next
+}
+
+func (i *recordStreamingHandlerErrInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+func (i *recordStreamingHandlerErrInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		err := next(ctx, conn)
+		i.errs <- err
+		return err
+	}
+}
+
+func TestDisconnectPolicy(t *testing.T) {
+	t.Parallel()
+	const pingProcedure = "/" + pingv1connect.PingServiceName + "/Ping"
+	// run cancels a call mid-handler, and reports whether the handler's context
+	// was still live shortly after the disconnect.
+	run := func(t *testing.T, grace time.Duration) bool {
+		t.Helper()
+		started := make(chan struct{})
+		reasons := make(chan error, 1)
+		live := make(chan bool, 1)
+		mux := http.NewServeMux()
+		mux.Handle(pingProcedure, connect.NewUnaryHandler(
+			pingProcedure,
+			func(ctx context.Context, req *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+				close(started)
+				assert.ErrorIs(t, <-reasons, context.Canceled)
+				select {
+				case <-ctx.Done():
+					live <- false
+				case <-time.After(100 * time.Millisecond):
+					live <- true
+				}
+				return connect.NewResponse(&pingv1.PingResponse{}), nil
+			},
+			connect.WithDisconnectPolicy(connect.DisconnectPolicy{
+				GracePeriod: grace,
+				Notify: func(ctx context.Context, spec connect.Spec, peer connect.Peer, reason error) {
+					assert.Nil(t, ctx.Err())
+					assert.Equal(t, spec.Procedure, pingProcedure)
+					assert.NotZero(t, peer.Addr)
+					reasons <- reason
+				},
+			}),
+		))
+		server := httptest.NewUnstartedServer(mux)
+		server.EnableHTTP2 = true
+		server.StartTLS()
+		t.Cleanup(server.Close)
+		client := connect.NewClient[pingv1.PingRequest, pingv1.PingResponse](
+			server.Client(),
+			server.URL+pingProcedure,
+		)
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-started
+			cancel()
+		}()
+		_, err := client.CallUnary(ctx, connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeCanceled)
+		return <-live
+	}
+	t.Run("grace_period", func(t *testing.T) {
+		t.Parallel()
+		assert.True(t, run(t, time.Minute))
+	})
+	t.Run("immediate", func(t *testing.T) {
+		t.Parallel()
+		assert.False(t, run(t, 0))
+	})
+}
+
+func TestUnknownFields(t *testing.T) {
+	t.Parallel()
+	const pingProcedure = "/" + pingv1connect.PingServiceName + "/Ping"
+	var reported int32
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		pingServer{},
+		connect.WithUnknownFieldsReporter(func(_ context.Context, spec connect.Spec, count int) {
+			assert.Equal(t, spec.Procedure, pingProcedure)
+			atomic.AddInt32(&reported, int32(count))
+		}),
+		connect.WithUnknownFieldsHeader(),
+	))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	ping := func(t *testing.T, body []byte) *http.Response {
+		t.Helper()
+		request, err := http.NewRequestWithContext(
+			context.Background(),
+			http.MethodPost,
+			server.URL+pingProcedure,
+			bytes.NewReader(body),
+		)
+		assert.Nil(t, err)
+		request.Header.Set("Content-Type", "application/proto")
+		response, err := server.Client().Do(request)
+		assert.Nil(t, err)
+		t.Cleanup(func() { _ = response.Body.Close() })
+		assert.Equal(t, response.StatusCode, http.StatusOK)
+		return response
+	}
+	known, err := proto.Marshal(&pingv1.PingRequest{Number: 42})
+	assert.Nil(t, err)
+
+	response := ping(t, known)
+	assert.Equal(t, response.Header.Get("Connect-Unknown-Fields"), "")
+	assert.Equal(t, atomic.LoadInt32(&reported), 0)
+
+	// Simulate a client with two fields the handler doesn't know about.
+	withUnknown := protowire.AppendTag(known, 100, protowire.VarintType)
+	withUnknown = protowire.AppendVarint(withUnknown, 1)
+	withUnknown = protowire.AppendTag(withUnknown, 101, protowire.BytesType)
+	withUnknown = protowire.AppendString(withUnknown, "new")
+	response = ping(t, withUnknown)
+	assert.Equal(t, response.Header.Get("Connect-Unknown-Fields"), "2")
+	assert.Equal(t, atomic.LoadInt32(&reported), 2)
+}
+
+type successPingServer struct {
+	pingv1connect.UnimplementedPingServiceHandler
+}
+
+func (successPingServer) Ping(context.Context, *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+	return &connect.Response[pingv1.PingResponse]{}, nil
+}
+
+func TestCompressionStatsTrailers(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		pingServer{},
+		connect.WithCompressionStatsTrailers(),
+	))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	for _, protocol := range []struct {
+		name string
+		opt  connect.ClientOption
+	}{
+		{name: "connect", opt: connect.WithConnect()},
+		{name: "grpc", opt: connect.WithGRPC()},
+		{name: "grpcweb", opt: connect.WithGRPCWeb()},
+	} {
+		protocol := protocol
+		t.Run(protocol.name, func(t *testing.T) {
+			t.Parallel()
+			client := pingv1connect.NewPingServiceClient(
+				server.Client(),
+				server.URL,
+				protocol.opt,
+				connect.WithSendGzip(),
+			)
+			stream, err := client.CountUp(
+				context.Background(),
+				connect.NewRequest(&pingv1.CountUpRequest{Number: 10}),
+			)
+			assert.Nil(t, err)
+			var received int
+			for stream.Receive() {
+				received++
+			}
+			assert.Nil(t, stream.Err())
+			assert.Equal(t, received, 10)
+			assert.Nil(t, stream.Close())
+			stats, ok := connect.CompressionStatsFromTrailer(stream.ResponseTrailer())
+			assert.True(t, ok)
+			assert.Equal(t, stats.Algorithm, "gzip")
+			// Each response is a two-byte message.
+			assert.Equal(t, stats.UncompressedBytes, 20)
+			assert.True(t, stats.CompressedBytes > 0)
+		})
+	}
+	t.Run("connect_unary", func(t *testing.T) {
+		t.Parallel()
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+		response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Nil(t, err)
+		_, ok := connect.CompressionStatsFromTrailer(response.Trailer())
+		assert.False(t, ok)
+	})
+}
+
+type apiKeyAuthInfo struct{}
+
+func (apiKeyAuthInfo) AuthType() string { return "api-key" }
+
+func TestAuthVerifiers(t *testing.T) {
+	t.Parallel()
+	const procedure = "/" + pingv1connect.PingServiceName + "/Ping"
+	verifyAPIKey := func(request *http.Request) (connect.AuthInfo, error) {
+		key := request.Header.Get("Api-Key")
+		if key == "" {
+			return nil, nil //nolint:nilnil // not applicable, try the next verifier
+		}
+		if key != "secret" {
+			return nil, errors.New("invalid API key")
+		}
+		return apiKeyAuthInfo{}, nil
+	}
+	mux := http.NewServeMux()
+	mux.Handle(procedure, connect.NewUnaryHandler(
+		procedure,
+		func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			response := connect.NewResponse(&pingv1.PingResponse{})
+			if info := request.Peer().AuthInfo; info != nil {
+				response.Msg.Text = info.AuthType()
+			}
+			return response, nil
+		},
+		connect.WithAuthVerifiers(connect.VerifyTLS, verifyAPIKey),
+	))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+	ping := func(t *testing.T, key string) (*connect.Request[pingv1.PingRequest], *connect.Response[pingv1.PingResponse], error) {
+		t.Helper()
+		request := connect.NewRequest(&pingv1.PingRequest{})
+		if key != "" {
+			request.Header().Set("Api-Key", key)
+		}
+		response, err := client.Ping(context.Background(), request)
+		return request, response, err
+	}
+	t.Run("anonymous", func(t *testing.T) {
+		t.Parallel()
+		request, response, err := ping(t, "")
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.Text, "")
+		// Clients see the server's TLS identity.
+		tlsInfo, ok := request.Peer().AuthInfo.(connect.TLSInfo)
+		assert.True(t, ok)
+		assert.True(t, len(tlsInfo.State.PeerCertificates) > 0)
+		// Peers with TLS identities are still safe to compare and use as map
+		// keys.
+		peers := map[connect.Peer]struct{}{request.Peer(): {}}
+		_, ok = peers[request.Peer()]
+		assert.True(t, ok)
+	})
+	t.Run("verified", func(t *testing.T) {
+		t.Parallel()
+		_, response, err := ping(t, "secret")
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.Text, "api-key")
+	})
+	t.Run("rejected", func(t *testing.T) {
+		t.Parallel()
+		_, _, err := ping(t, "wrong")
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnauthenticated)
+	})
+}
+
+func TestAPIVersionNegotiation(t *testing.T) {
+	t.Parallel()
+	const procedure = "/" + pingv1connect.PingServiceName + "/Ping"
+	mux := http.NewServeMux()
+	mux.Handle(procedure, connect.NewUnaryHandler(
+		procedure,
+		func(ctx context.Context, _ *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			version, ok := connect.APIVersionFromContext(ctx)
+			assert.True(t, ok)
+			return connect.NewResponse(&pingv1.PingResponse{Text: version}), nil
+		},
+		connect.WithAPIVersions("v2", "v1"),
+	))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	ping := func(t *testing.T, opts ...connect.ClientOption) (*connect.Response[pingv1.PingResponse], error) {
+		t.Helper()
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opts...)
+		return client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+	}
+	t.Run("negotiated", func(t *testing.T) {
+		t.Parallel()
+		response, err := ping(t, connect.WithAPIVersions("v3", "v1"))
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.Text, "v1")
+		assert.Equal(t, connect.NegotiatedAPIVersion(response.Header()), "v1")
+	})
+	t.Run("default", func(t *testing.T) {
+		t.Parallel()
+		response, err := ping(t)
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.Text, "v2")
+		assert.Equal(t, connect.NegotiatedAPIVersion(response.Header()), "v2")
+	})
+	t.Run("unsupported", func(t *testing.T) {
+		t.Parallel()
+		_, err := ping(t, connect.WithAPIVersions("v9"))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnimplemented)
+	})
+}
+
+func TestConformanceMode(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		pingServer{},
+		// Application wiring that the conformance runner can't exercise.
+		connect.WithHandlerProtocols(connect.ProtocolGRPC),
+		connect.WithLenientRequestEncoding(),
+		connect.WithConformanceMode(),
+	))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	for _, protocol := range []string{connect.ProtocolConnect, connect.ProtocolGRPC, connect.ProtocolGRPCWeb} {
+		for _, codec := range []string{"proto", "json"} {
+			for _, compression := range []string{"identity", "gzip"} {
+				client := pingv1connect.NewPingServiceClient(
+					server.Client(),
+					server.URL,
+					connect.WithConformanceClient(protocol, codec, compression),
+				)
+				response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 42}))
+				assert.Nil(t, err, assert.Sprintf("%s/%s/%s", protocol, codec, compression))
+				assert.Equal(t, response.Msg.Number, 42)
+			}
+		}
+	}
+	client := pingv1connect.NewPingServiceClient(
+		server.Client(),
+		server.URL,
+		connect.WithConformanceClient("thrift", "proto", "identity"),
+	)
+	_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+	assert.Equal(t, connect.CodeOf(err), connect.CodeUnknown)
+}
+
+func TestHandlerErrorFormatter(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		pingServer{},
+		connect.WithErrorFormatter(connect.ProblemJSONContentType, connect.FormatProblemJSON),
+	))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	fail := func(t *testing.T, accept string) *http.Response {
+		t.Helper()
+		request, err := http.NewRequestWithContext(
+			context.Background(),
+			http.MethodPost,
+			server.URL+"/"+pingv1connect.PingServiceName+"/Fail",
+			strings.NewReader(`{"code": 5}`),
+		)
+		assert.Nil(t, err)
+		request.Header.Set("Content-Type", "application/json")
+		if accept != "" {
+			request.Header.Set("Accept", accept)
+		}
+		response, err := server.Client().Do(request)
+		assert.Nil(t, err)
+		t.Cleanup(func() { _ = response.Body.Close() })
+		assert.Equal(t, response.StatusCode, http.StatusNotFound)
+		return response
+	}
+	t.Run("problem", func(t *testing.T) {
+		t.Parallel()
+		response := fail(t, "application/problem+json, application/json;q=0.5")
+		assert.Equal(t, response.Header.Get("Content-Type"), connect.ProblemJSONContentType)
+		var problem map[string]any
+		assert.Nil(t, json.NewDecoder(response.Body).Decode(&problem))
+		assert.Equal(t, problem, map[string]any{
+			"type":   "about:blank",
+			"title":  "Not Found",
+			"status": float64(http.StatusNotFound),
+			"detail": errorMessage,
+			"code":   "not_found",
+		})
+	})
+	t.Run("default", func(t *testing.T) {
+		t.Parallel()
+		response := fail(t, "*/*")
+		assert.Equal(t, response.Header.Get("Content-Type"), "application/json")
+		var wire map[string]any
+		assert.Nil(t, json.NewDecoder(response.Body).Decode(&wire))
+		assert.Equal(t, wire["code"], "not_found")
+	})
+}
+
+func TestHandlerGRPCStatusInErrors(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		pingServer{},
+		connect.WithGRPCStatusInErrors(),
+	))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	t.Run("body", func(t *testing.T) {
+		t.Parallel()
+		request, err := http.NewRequestWithContext(
+			context.Background(),
+			http.MethodPost,
+			server.URL+"/"+pingv1connect.PingServiceName+"/Fail",
+			strings.NewReader(`{"code": 5}`),
+		)
+		assert.Nil(t, err)
+		request.Header.Set("Content-Type", "application/json")
+		response, err := server.Client().Do(request)
+		assert.Nil(t, err)
+		defer response.Body.Close()
+		assert.Equal(t, response.StatusCode, http.StatusNotFound)
+		var wire struct {
+			Code       string `json:"code"`
+			Message    string `json:"message"`
+			GRPCStatus string `json:"grpcStatus"`
+		}
+		assert.Nil(t, json.NewDecoder(response.Body).Decode(&wire))
+		assert.Equal(t, wire.Code, "not_found")
+		data, err := base64.RawStdEncoding.DecodeString(wire.GRPCStatus)
+		assert.Nil(t, err)
+		var status statusv1.Status
+		assert.Nil(t, proto.Unmarshal(data, &status))
+		assert.Equal(t, connect.Code(status.Code), connect.CodeNotFound)
+		assert.Equal(t, status.Message, wire.Message)
+	})
+	t.Run("client", func(t *testing.T) {
+		t.Parallel()
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+		_, err := client.Fail(
+			context.Background(),
+			connect.NewRequest(&pingv1.FailRequest{Code: int32(connect.CodeNotFound)}),
+		)
+		assert.Equal(t, connect.CodeOf(err), connect.CodeNotFound)
+	})
+}
+
+func TestHandlerTimeoutHeader(t *testing.T) {
+	t.Parallel()
+	const procedure = "/" + pingv1connect.PingServiceName + "/Ping"
+	newServer := func(t *testing.T, header connect.TimeoutHeader) *httptest.Server {
+		t.Helper()
+		mux := http.NewServeMux()
+		mux.Handle(procedure, connect.NewUnaryHandler(
+			procedure,
+			func(ctx context.Context, _ *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+				response := connect.NewResponse(&pingv1.PingResponse{})
+				if deadline, ok := ctx.Deadline(); ok {
+					// Round to whole seconds to tolerate scheduling delays.
+					remaining := time.Until(deadline).Round(time.Second)
+					response.Header().Set("Remaining", remaining.String())
+				}
+				return response, nil
+			},
+			connect.WithTimeoutHeader(header),
+		))
+		server := httptest.NewServer(mux)
+		t.Cleanup(server.Close)
+		return server
+	}
+	call := func(t *testing.T, server *httptest.Server, header http.Header) *http.Response {
+		t.Helper()
+		request, err := http.NewRequestWithContext(
+			context.Background(),
+			http.MethodPost,
+			server.URL+procedure,
+			strings.NewReader("{}"),
+		)
+		assert.Nil(t, err)
+		request.Header = header
+		request.Header.Set("Content-Type", "application/json")
+		response, err := server.Client().Do(request)
+		assert.Nil(t, err)
+		t.Cleanup(func() { _ = response.Body.Close() })
+		return response
+	}
+	tests := []struct {
+		name       string
+		precedence connect.TimeoutHeaderPrecedence
+		standard   string
+		custom     string
+		remaining  string
+	}{
+		{name: "none", remaining: ""},
+		{name: "custom_only", custom: "20", remaining: "20s"},
+		{name: "fallback", standard: "30000", custom: "20", remaining: "30s"},
+		{name: "override", precedence: connect.TimeoutHeaderOverride, standard: "30000", custom: "40", remaining: "40s"},
+		{name: "shortest", precedence: connect.TimeoutHeaderShortest, standard: "30000", custom: "20", remaining: "20s"},
+		{name: "shortest_standard", precedence: connect.TimeoutHeaderShortest, standard: "10000", custom: "20", remaining: "10s"},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			server := newServer(t, connect.TimeoutHeader{
+				Name:       "X-Timeout-Sec",
+				Unit:       time.Second,
+				Precedence: test.precedence,
+			})
+			header := make(http.Header)
+			if test.standard != "" {
+				header.Set("Connect-Timeout-Ms", test.standard)
+			}
+			if test.custom != "" {
+				header.Set("X-Timeout-Sec", test.custom)
+			}
+			response := call(t, server, header)
+			assert.Equal(t, response.StatusCode, http.StatusOK)
+			assert.Equal(t, response.Header.Get("Remaining"), test.remaining)
+		})
+	}
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+		server := newServer(t, connect.TimeoutHeader{Name: "X-Timeout-Ms"})
+		header := make(http.Header)
+		header.Set("X-Timeout-Ms", "soon")
+		response := call(t, server, header)
+		assert.Equal(t, response.StatusCode, http.StatusBadRequest)
+	})
+}
+
+func TestExtendDeadline(t *testing.T) {
+	t.Parallel()
+	const procedure = "/" + pingv1connect.PingServiceName + "/Ping"
+	mux := http.NewServeMux()
+	mux.Handle(procedure, connect.NewUnaryHandler(
+		procedure,
+		func(ctx context.Context, _ *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			original, ok := ctx.Deadline()
+			assert.True(t, ok)
+			_, err := connect.ExtendDeadline(ctx, time.Hour)
+			assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+			extended, err := connect.ExtendDeadline(ctx, 500*time.Millisecond)
+			if err != nil {
+				return nil, err
+			}
+			deadline, _ := ctx.Deadline()
+			assert.Equal(t, deadline, extended)
+			assert.True(t, extended.Sub(original) == 500*time.Millisecond)
+			// Outlive the client's original timeout.
+			time.Sleep(150 * time.Millisecond)
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			return connect.NewResponse(&pingv1.PingResponse{}), nil
+		},
+		connect.WithMaxDeadlineExtension(time.Second),
+	))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+	request := connect.NewRequest(&pingv1.PingRequest{})
+	// The client's own context must allow for the extension, so set the
+	// protocol timeout directly.
+	request.Header().Set("Connect-Timeout-Ms", "100")
+	response, err := client.Ping(context.Background(), request)
+	assert.Nil(t, err)
+	assert.NotZero(t, response.Trailer().Get("Deadline-Extended-To"))
+}
+
+func TestExtendDeadlineFollowedByClient(t *testing.T) {
+	t.Parallel()
+	const procedure = "/" + pingv1connect.PingServiceName + "/CountUp"
+	mux := http.NewServeMux()
+	mux.Handle(procedure, connect.NewServerStreamHandler(
+		procedure,
+		func(ctx context.Context, _ *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+			for i := int64(1); i <= 3; i++ {
+				if i < 3 {
+					// The first extension is reported in the response headers, and
+					// the second in the next message's metadata.
+					if _, err := connect.ExtendDeadline(ctx, 300*time.Millisecond); err != nil {
+						return err
+					}
+				}
+				if err := stream.Send(&pingv1.CountUpResponse{Number: i}); err != nil {
+					return err
+				}
+				if i < 3 {
+					// Outlive the client's original timeout.
+					time.Sleep(250 * time.Millisecond)
+				}
+			}
+			return nil
+		},
+		connect.WithMaxDeadlineExtension(time.Second),
+		connect.WithMessageMetadata(),
+	))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithMessageMetadata())
+
+	start := time.Now()
+	ctx, cancel := connect.ContextWithExtendableTimeout(context.Background(), 200*time.Millisecond, time.Second)
+	defer cancel()
+	stream, err := client.CountUp(ctx, connect.NewRequest(&pingv1.CountUpRequest{}))
+	assert.Nil(t, err)
+	var got []int64
+	for stream.Receive() {
+		got = append(got, stream.Msg().Number)
+	}
+	assert.Nil(t, stream.Err())
+	assert.Nil(t, stream.Close())
+	assert.Equal(t, got, []int64{1, 2, 3})
+	assert.NotZero(t, stream.ResponseHeader().Get("Deadline-Extended-To"))
+	deadline, ok := ctx.Deadline()
+	assert.True(t, ok)
+	assert.True(t, deadline.Sub(start) >= 700*time.Millisecond)
+}
+
+func TestPriorityScheduler(t *testing.T) {
+	t.Parallel()
+	const procedure = "/" + pingv1connect.PingServiceName + "/Ping"
+	var (
+		mu      sync.Mutex
+		order   []int64
+		started = make(chan struct{})
+		unblock = make(chan struct{})
+	)
+	mux := http.NewServeMux()
+	mux.Handle(procedure, connect.NewUnaryHandler(
+		procedure,
+		func(ctx context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			mu.Lock()
+			order = append(order, request.Msg.Number)
+			mu.Unlock()
+			if request.Msg.Number == 1 {
+				close(started)
+				<-unblock
+			}
+			return connect.NewResponse(&pingv1.PingResponse{}), nil
+		},
+		connect.WithPriorityScheduler(connect.NewPriorityScheduler(1)),
+	))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+	bulkClient := pingv1connect.NewPingServiceClient(
+		server.Client(),
+		server.URL,
+		connect.WithPriority(connect.Priority{Urgency: 6}),
+	)
+	var wg sync.WaitGroup
+	call := func(client pingv1connect.PingServiceClient, number int64, priority *connect.Priority) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			request := connect.NewRequest(&pingv1.PingRequest{Number: number})
+			if priority != nil {
+				connect.SetPriority(request.Header(), *priority)
+			}
+			_, err := client.Ping(context.Background(), request)
+			assert.Nil(t, err)
+		}()
+	}
+	// The first call occupies the only slot, so the next calls queue up.
+	call(client, 1, nil)
+	<-started
+	call(bulkClient, 2, nil)
+	time.Sleep(50 * time.Millisecond)
+	call(bulkClient, 3, &connect.Priority{Urgency: 0})
+	time.Sleep(50 * time.Millisecond)
+	close(unblock)
+	wg.Wait()
+	assert.Equal(t, order, []int64{1, 3, 2})
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+		client := pingv1connect.NewPingServiceClient(
+			server.Client(),
+			server.URL,
+			connect.WithPriority(connect.Priority{Urgency: 8}),
+		)
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnknown)
+	})
+}
+
+func TestPeerLimiter(t *testing.T) {
+	t.Parallel()
+	const procedure = "/" + pingv1connect.PingServiceName + "/CountUp"
+	unblock := make(chan struct{})
+	verifyTenant := func(request *http.Request) (connect.AuthInfo, error) {
+		return tenantAuthInfo{name: request.Header.Get("Tenant")}, nil
+	}
+	// Streams wait briefly for a slot, since slots are released just after
+	// the client sees the end of the stream.
+	policy := connect.QueuePolicy{MaxQueued: -1, Timeout: 100 * time.Millisecond}
+	limiter := connect.NewPeerLimiter(1, policy, func(peer connect.Peer) string {
+		if info, ok := peer.AuthInfo.(tenantAuthInfo); ok {
+			return info.name
+		}
+		return ""
+	})
+	mux := http.NewServeMux()
+	mux.Handle(procedure, connect.NewServerStreamHandler(
+		procedure,
+		func(ctx context.Context, request *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+			if err := stream.Send(&pingv1.CountUpResponse{Number: request.Msg.Number}); err != nil {
+				return err
+			}
+			if request.Msg.Number == 1 {
+				<-unblock
+			}
+			return nil
+		},
+		connect.WithAuthVerifiers(verifyTenant),
+		connect.WithPeerLimiter(limiter),
+	))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	client := connect.NewClient[pingv1.CountUpRequest, pingv1.CountUpResponse](server.Client(), server.URL+procedure)
+	open := func(t *testing.T, tenant string, number int64) *connect.ServerStreamForClient[pingv1.CountUpResponse] {
+		t.Helper()
+		request := connect.NewRequest(&pingv1.CountUpRequest{Number: number})
+		request.Header().Set("Tenant", tenant)
+		stream, err := client.CallServerStream(context.Background(), request)
+		assert.Nil(t, err)
+		return stream
+	}
+	// finish drains a stream, returning its error.
+	finish := func(stream *connect.ServerStreamForClient[pingv1.CountUpResponse]) error {
+		for stream.Receive() {
+		}
+		_ = stream.Close()
+		return stream.Err()
+	}
+
+	// The first stream holds tenant a's only slot.
+	blocked := open(t, "a", 1)
+	assert.True(t, blocked.Receive())
+	assert.Equal(t, connect.CodeOf(finish(open(t, "a", 2))), connect.CodeResourceExhausted)
+	// Other tenants aren't affected.
+	assert.Nil(t, finish(open(t, "b", 2)))
+	close(unblock)
+	assert.Nil(t, finish(blocked))
+	assert.Nil(t, finish(open(t, "a", 2)))
+}
+
+type tenantAuthInfo struct {
+	name string
+}
+
+func (tenantAuthInfo) AuthType() string { return "tenant" }
+
+func TestRequestMessagePooling(t *testing.T) {
+	t.Parallel()
+	const procedure = "/" + pingv1connect.PingServiceName + "/Ping"
+	mux := http.NewServeMux()
+	mux.Handle(procedure, connect.NewUnaryHandler(
+		procedure,
+		func(ctx context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			return connect.NewResponse(&pingv1.PingResponse{
+				Number: request.Msg.Number,
+				Text:   request.Msg.Text,
+			}), nil
+		},
+		connect.WithRequestMessagePooling(),
+	))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+	response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 42, Text: "foo"}))
+	assert.Nil(t, err)
+	assert.Equal(t, response.Msg.Number, 42)
+	assert.Equal(t, response.Msg.Text, "foo")
+	// Recycled messages don't carry over fields from earlier requests.
+	for i := 0; i < 10; i++ {
+		response, err = client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Nil(t, err)
+		assert.Zero(t, response.Msg.Number)
+		assert.Zero(t, response.Msg.Text)
+	}
+}
+
+func TestPerMessageAndProcedureLimits(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		pingServer{},
+		connect.WithReadMaxBytes(2),
+		connect.WithProcedureOptions(
+			"/"+pingv1connect.PingServiceName+"/Sum",
+			connect.WithFirstMessageReadMaxBytes(16),
+		),
+		connect.WithProcedureOptions(
+			"/"+pingv1connect.PingServiceName+"/Ping",
+			connect.WithReadMaxBytes(0),
+			connect.WithReadMaxHeaderBytes(1024),
+		),
+	))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	for _, testCase := range []struct {
+		name string
+		opt  connect.ClientOption
+	}{
+		{name: "connect", opt: connect.WithConnect()},
+		{name: "grpc", opt: connect.WithGRPC()},
+		{name: "grpcweb", opt: connect.WithGRPCWeb()},
+	} {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, testCase.opt)
+			// Only the first message may exceed the stream's limit.
+			stream := client.Sum(context.Background())
+			assert.Nil(t, stream.Send(&pingv1.SumRequest{Number: 1000}))
+			_, err := stream.CloseAndReceive()
+			assert.Nil(t, err)
+			stream = client.Sum(context.Background())
+			assert.Nil(t, stream.Send(&pingv1.SumRequest{Number: 1000}))
+			_ = stream.Send(&pingv1.SumRequest{Number: 1000})
+			_, err = stream.CloseAndReceive()
+			assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+
+			// Ping overrides the service-wide limits.
+			_, err = client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 1000}))
+			assert.Nil(t, err)
+			request := connect.NewRequest(&pingv1.PingRequest{})
+			request.Header().Set("Padding", strings.Repeat("a", 1024))
+			_, err = client.Ping(context.Background(), request)
+			assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+
+			// Clients can limit response headers, too.
+			limited := pingv1connect.NewPingServiceClient(
+				server.Client(),
+				server.URL,
+				testCase.opt,
+				connect.WithReadMaxHeaderBytes(1),
+			)
+			_, err = limited.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+			assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+		})
+	}
+}
+
+func TestErrorWithMetadata(t *testing.T) {
+	t.Parallel()
+	const procedure = "/" + pingv1connect.PingServiceName + "/Ping"
+	mux := http.NewServeMux()
+	mux.Handle(procedure, connect.NewUnaryHandler(
+		procedure,
+		func(ctx context.Context, _ *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			return nil, connect.NewErrorWithMetadata(
+				connect.CodeResourceExhausted,
+				errors.New("slow down"),
+				http.Header{"Retry-After": []string{"3"}},
+				http.Header{"Quota-Remaining": []string{"0"}},
+			)
+		},
+	))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	for _, testCase := range []struct {
+		name string
+		opt  connect.ClientOption
+	}{
+		{name: "connect", opt: connect.WithConnect()},
+		{name: "grpc", opt: connect.WithGRPC()},
+		{name: "grpcweb", opt: connect.WithGRPCWeb()},
+	} {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			client := connect.NewClient[pingv1.PingRequest, pingv1.PingResponse](
+				server.Client(),
+				server.URL+procedure,
+				testCase.opt,
+			)
+			_, err := client.CallUnary(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+			var connectErr *connect.Error
+			assert.True(t, errors.As(err, &connectErr))
+			assert.Equal(t, connectErr.Code(), connect.CodeResourceExhausted)
+			assert.Equal(t, connectErr.Meta().Get("Retry-After"), "3")
+			assert.Equal(t, connectErr.Meta().Get("Quota-Remaining"), "0")
+		})
+	}
+	t.Run("connect_wire", func(t *testing.T) {
+		t.Parallel()
+		request, err := http.NewRequestWithContext(
+			context.Background(),
+			http.MethodPost,
+			server.URL+procedure,
+			strings.NewReader("{}"),
+		)
+		assert.Nil(t, err)
+		request.Header.Set("Content-Type", "application/json")
+		response, err := server.Client().Do(request)
+		assert.Nil(t, err)
+		defer response.Body.Close()
+		assert.Equal(t, response.StatusCode, http.StatusTooManyRequests)
+		assert.Equal(t, response.Header.Get("Retry-After"), "3")
+		assert.Equal(t, response.Header.Get("Trailer-Quota-Remaining"), "0")
+	})
+}
+
+func TestRegister(t *testing.T) {
+	t.Parallel()
+	const dynamicProcedure = "/connect.dynamic.v1.EchoService/Echo"
+	generated := pingv1connect.NewPingService(pingServer{})
+	assert.Equal(t, generated.ServiceName(), pingv1connect.PingServiceName)
+	assert.Equal(t, len(generated.Procedures()), 5)
+	dynamic := connect.NewService(
+		"connect.dynamic.v1.EchoService",
+		connect.ServiceProcedure{
+			Procedure: dynamicProcedure,
+			NewHandler: func(options ...connect.HandlerOption) *connect.Handler {
+				return connect.NewUnaryHandler(
+					dynamicProcedure,
+					func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+						return connect.NewResponse(&pingv1.PingResponse{Text: request.Msg.Text}), nil
+					},
+					options...,
+				)
+			},
+		},
+	)
+	mux := http.NewServeMux()
+	// Shared options apply to every procedure.
+	connect.Register(mux, generated, connect.WithReadMaxBytes(8))
+	connect.Register(mux, dynamic, connect.WithReadMaxBytes(8))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+	response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 42}))
+	assert.Nil(t, err)
+	assert.Equal(t, response.Msg.Number, 42)
+	_, err = client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Text: "too long to read"}))
+	assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+
+	echo := connect.NewClient[pingv1.PingRequest, pingv1.PingResponse](server.Client(), server.URL+dynamicProcedure)
+	echoed, err := echo.CallUnary(context.Background(), connect.NewRequest(&pingv1.PingRequest{Text: "hi"}))
+	assert.Nil(t, err)
+	assert.Equal(t, echoed.Msg.Text, "hi")
+	_, err = echo.CallUnary(context.Background(), connect.NewRequest(&pingv1.PingRequest{Text: "too long to read"}))
+	assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+}
+
+func TestHandlerCORS(t *testing.T) {
+	t.Parallel()
+	const origin = "https://app.example.com"
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}, connect.WithCORS(origin)))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	pingURL := server.URL + "/" + pingv1connect.PingServiceName + "/Ping"
+
+	preflight := func(t *testing.T, origin string) *http.Response {
+		t.Helper()
+		request, err := http.NewRequestWithContext(context.Background(), http.MethodOptions, pingURL, http.NoBody)
+		assert.Nil(t, err)
+		request.Header.Set("Origin", origin)
+		request.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		request.Header.Set("Access-Control-Request-Headers", "authorization, x-grpc-web")
+		response, err := server.Client().Do(request)
+		assert.Nil(t, err)
+		assert.Nil(t, response.Body.Close())
+		return response
+	}
+	t.Run("preflight", func(t *testing.T) {
+		t.Parallel()
+		response := preflight(t, origin)
+		assert.Equal(t, response.StatusCode, http.StatusNoContent)
+		assert.Equal(t, response.Header.Get("Access-Control-Allow-Origin"), origin)
+		assert.Equal(t, response.Header.Get("Access-Control-Allow-Methods"), http.MethodPost)
+		allowed := response.Header.Get("Access-Control-Allow-Headers")
+		assert.True(t, strings.Contains(allowed, "Connect-Timeout-Ms"))
+		assert.True(t, strings.Contains(allowed, "X-Grpc-Web"))
+		assert.True(t, strings.Contains(allowed, "authorization"))
+	})
+	t.Run("preflight_other_origin", func(t *testing.T) {
+		t.Parallel()
+		response := preflight(t, "https://evil.example.com")
+		assert.Equal(t, response.StatusCode, http.StatusForbidden)
+		assert.Zero(t, response.Header.Get("Access-Control-Allow-Origin"))
+	})
+	t.Run("request", func(t *testing.T) {
+		t.Parallel()
+		request, err := http.NewRequestWithContext(context.Background(), http.MethodPost, pingURL, strings.NewReader("{}"))
+		assert.Nil(t, err)
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set("Origin", origin)
+		response, err := server.Client().Do(request)
+		assert.Nil(t, err)
+		assert.Nil(t, response.Body.Close())
+		assert.Equal(t, response.StatusCode, http.StatusOK)
+		assert.Equal(t, response.Header.Get("Access-Control-Allow-Origin"), origin)
+		assert.True(t, strings.Contains(response.Header.Get("Access-Control-Expose-Headers"), "Grpc-Status"))
+	})
+}
+
+func TestHandlerCompressionThresholds(t *testing.T) {
+	t.Parallel()
+	request := &pingv1.PingRequest{Text: strings.Repeat("a", 64)}
+	protoBody, err := proto.Marshal(request)
+	assert.Nil(t, err)
+	jsonBody, err := protojson.Marshal(request)
+	assert.Nil(t, err)
+
+	ping := func(t *testing.T, options []connect.HandlerOption, contentType string, body []byte) string {
+		t.Helper()
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}, options...))
+		server := httptest.NewServer(mux)
+		defer server.Close()
+		req, err := http.NewRequestWithContext(
+			context.Background(),
+			http.MethodPost,
+			server.URL+"/"+pingv1connect.PingServiceName+"/Ping",
+			bytes.NewReader(body),
+		)
+		assert.Nil(t, err)
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Accept-Encoding", "gzip")
+		response, err := server.Client().Do(req)
+		assert.Nil(t, err)
+		assert.Nil(t, response.Body.Close())
+		assert.Equal(t, response.StatusCode, http.StatusOK)
+		return response.Header.Get("Content-Encoding")
+	}
+	t.Run("per_codec", func(t *testing.T) {
+		t.Parallel()
+		options := []connect.HandlerOption{
+			connect.WithCompressMinBytes(1024),
+			connect.WithCodecCompressMinBytes("json", 16),
+		}
+		assert.Zero(t, ping(t, options, "application/proto", protoBody))
+		assert.Equal(t, ping(t, options, "application/json", jsonBody), "gzip")
+	})
+	t.Run("policy", func(t *testing.T) {
+		t.Parallel()
+		var codecs sync.Map
+		options := []connect.HandlerOption{
+			connect.WithCodecCompressMinBytes("json", 16),
+			connect.WithCompressionPolicy(func(spec connect.Spec, codec string, size int) bool {
+				codecs.Store(codec, spec.Procedure)
+				return codec == "proto" && size > 0
+			}),
+		}
+		assert.Equal(t, ping(t, options, "application/proto", protoBody), "gzip")
+		assert.Zero(t, ping(t, options, "application/json", jsonBody))
+		procedure, ok := codecs.Load("json")
+		assert.True(t, ok)
+		assert.Equal(t, procedure, any("/"+pingv1connect.PingServiceName+"/Ping"))
+	})
+}
+
+func TestPayloadSigning(t *testing.T) {
+	t.Parallel()
+	const signatureHeader = "X-Payload-Signature"
+	key := []byte("secret")
+	sign := func(payload []byte) string {
+		mac := hmac.New(sha256.New, key)
+		_, _ = mac.Write(payload)
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		pingServer{},
+		connect.WithPayloadVerifier(func(spec connect.Spec, header http.Header, payload []byte) error {
+			if !hmac.Equal([]byte(header.Get(signatureHeader)), []byte(sign(payload))) {
+				return errors.New("invalid payload signature")
+			}
+			return nil
+		}),
+	))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	protocols := []struct {
+		name string
+		opt  connect.ClientOption
+	}{
+		{"connect", connect.WithConnect()},
+		{"grpc", connect.WithGRPC()},
+		{"grpcweb", connect.WithGRPCWeb()},
+	}
+	for _, protocol := range protocols {
+		protocol := protocol
+		t.Run(protocol.name, func(t *testing.T) {
+			t.Parallel()
+			request := &pingv1.PingRequest{Number: 42, Text: strings.Repeat("a", 128)}
+			t.Run("signed", func(t *testing.T) {
+				t.Parallel()
+				for _, compress := range []bool{false, true} {
+					options := []connect.ClientOption{
+						protocol.opt,
+						connect.WithPayloadSigner(func(spec connect.Spec, header http.Header, payload []byte) error {
+							header.Set(signatureHeader, sign(payload))
+							return nil
+						}),
+					}
+					if compress {
+						options = append(options, connect.WithSendGzip())
+					}
+					client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, options...)
+					response, err := client.Ping(context.Background(), connect.NewRequest(request))
+					assert.Nil(t, err)
+					assert.Equal(t, response.Msg.Number, request.Number)
+				}
+			})
+			t.Run("tampered", func(t *testing.T) {
+				t.Parallel()
+				client := pingv1connect.NewPingServiceClient(
+					server.Client(),
+					server.URL,
+					protocol.opt,
+					connect.WithPayloadSigner(func(spec connect.Spec, header http.Header, payload []byte) error {
+						header.Set(signatureHeader, sign(append(payload, 0)))
+						return nil
+					}),
+				)
+				_, err := client.Ping(context.Background(), connect.NewRequest(request))
+				assert.Equal(t, connect.CodeOf(err), connect.CodeUnauthenticated)
+			})
+			t.Run("signer_error", func(t *testing.T) {
+				t.Parallel()
+				client := pingv1connect.NewPingServiceClient(
+					server.Client(),
+					server.URL,
+					protocol.opt,
+					connect.WithPayloadSigner(func(connect.Spec, http.Header, []byte) error {
+						return connect.NewError(connect.CodeFailedPrecondition, errors.New("no signing key"))
+					}),
+				)
+				_, err := client.Ping(context.Background(), connect.NewRequest(request))
+				assert.Equal(t, connect.CodeOf(err), connect.CodeFailedPrecondition)
+			})
+			t.Run("streaming", func(t *testing.T) {
+				t.Parallel()
+				client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, protocol.opt)
+				stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 2}))
+				assert.Nil(t, err)
+				var count int
+				for stream.Receive() {
+					count++
+				}
+				assert.Nil(t, stream.Err())
+				assert.Equal(t, count, 2)
+			})
+		})
+	}
+}
+
+func TestHandlerErrorRedaction(t *testing.T) {
+	t.Parallel()
+	const procedure = "/" + pingv1connect.PingServiceName + "/Ping"
+	handler := connect.NewUnaryHandler(
+		procedure,
+		func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			if request.Msg.Number == 0 {
+				return nil, connect.NewError(connect.CodeNotFound, errors.New("no such number"))
+			}
+			err := connect.NewError(connect.CodeInternal, errors.New("pq: relation \"pings\" does not exist"))
+			err.Meta().Set("Request-Id", "42")
+			allowed, detailErr := connect.NewErrorDetail(&pingv1.PingResponse{Text: "retry later"})
+			assert.Nil(t, detailErr)
+			err.AddDetail(allowed)
+			internal, detailErr := connect.NewErrorDetail(&pingv1.PingRequest{Text: "stack trace"})
+			assert.Nil(t, detailErr)
+			err.AddDetail(internal)
+			return nil, err
+		},
+		connect.WithErrorRedaction(connect.ErrorRedactionPolicy{
+			Message: "internal error",
+			AllowDetail: func(detail *connect.ErrorDetail) bool {
+				return detail.Type() == string((&pingv1.PingResponse{}).ProtoReflect().Descriptor().FullName())
+			},
+		}),
+	)
+	served := make(chan error, 1)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served <- handler.ServeConnectHTTP(w, r)
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	for _, protocol := range []string{connect.ProtocolConnect, connect.ProtocolGRPC, connect.ProtocolGRPCWeb} {
+		var options []connect.ClientOption
+		switch protocol {
+		case connect.ProtocolGRPC:
+			options = append(options, connect.WithGRPC())
+		case connect.ProtocolGRPCWeb:
+			options = append(options, connect.WithGRPCWeb())
+		}
+		client := connect.NewClient[pingv1.PingRequest, pingv1.PingResponse](
+			server.Client(),
+			server.URL+procedure,
+			options...,
+		)
+		_, err := client.CallUnary(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 1}))
+		var connectErr *connect.Error
+		assert.True(t, errors.As(err, &connectErr), assert.Sprintf("%s: %v", protocol, err))
+		assert.Equal(t, connectErr.Code(), connect.CodeInternal)
+		assert.Equal(t, connectErr.Message(), "internal error")
+		assert.Equal(t, connectErr.Meta().Get("Request-Id"), "42")
+		assert.Equal(t, len(connectErr.Details()), 1)
+		detail, detailErr := connectErr.Details()[0].Value()
+		assert.Nil(t, detailErr)
+		assert.Equal(t, detail.(*pingv1.PingResponse).Text, "retry later") //nolint:forcetypeassert
+		// The handler reports the original error.
+		assert.True(t, strings.Contains((<-served).Error(), "does not exist"))
+
+		_, err = client.CallUnary(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeNotFound)
+		assert.True(t, strings.Contains(err.Error(), "no such number"))
+		<-served
+	}
+}
+
+func TestCallIDs(t *testing.T) {
+	t.Parallel()
+	const header = "Call-Id"
+	var handlerIDs sync.Map
+	recordHandlerID := connect.UnaryInterceptorFunc(func(next connect.UnaryFunc) connect.UnaryFunc {
+		return func(ctx context.Context, request connect.AnyRequest) (connect.AnyResponse, error) {
+			id, ok := connect.CallIDFromContext(ctx)
+			assert.True(t, ok)
+			handlerIDs.Store(request.Any().(*pingv1.PingRequest).Text, id) //nolint:forcetypeassert
+			return next(ctx, request)
+		}
+	})
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		pingServer{},
+		connect.WithCallIDHeader(header),
+		connect.WithInterceptors(recordHandlerID),
+	))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	t.Run("propagated", func(t *testing.T) {
+		t.Parallel()
+		var clientID string
+		var counter int
+		client := pingv1connect.NewPingServiceClient(
+			server.Client(),
+			server.URL,
+			connect.WithCallIDs(func() string {
+				counter++
+				return fmt.Sprintf("call-%d", counter)
+			}),
+			connect.WithCallIDHeader(header),
+			connect.WithInterceptors(connect.UnaryInterceptorFunc(func(next connect.UnaryFunc) connect.UnaryFunc {
+				return func(ctx context.Context, request connect.AnyRequest) (connect.AnyResponse, error) {
+					clientID, _ = connect.CallIDFromContext(ctx)
+					return next(ctx, request)
+				}
+			})),
+		)
+		response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Text: "propagated"}))
+		assert.Nil(t, err)
+		assert.Equal(t, clientID, "call-1")
+		assert.Equal(t, response.Header().Get(header), clientID)
+		handlerID, _ := handlerIDs.Load("propagated")
+		assert.Equal(t, handlerID, any(clientID))
+
+		stream := client.CumSum(context.Background())
+		assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: 1}))
+		_, err = stream.Receive()
+		assert.Nil(t, err)
+		assert.Equal(t, stream.ResponseHeader().Get(header), "call-2")
+		assert.Nil(t, stream.CloseRequest())
+		assert.Nil(t, stream.CloseResponse())
+	})
+	t.Run("generated", func(t *testing.T) {
+		t.Parallel()
+		for _, sent := range []string{"", "bad id"} {
+			text := "generated" + sent
+			request := connect.NewRequest(&pingv1.PingRequest{Text: text})
+			if sent != "" {
+				request.Header().Set(header, sent)
+			}
+			client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+			response, err := client.Ping(context.Background(), request)
+			assert.Nil(t, err)
+			id := response.Header().Get(header)
+			assert.Equal(t, len(id), 32)
+			handlerID, _ := handlerIDs.Load(text)
+			assert.Equal(t, handlerID, any(id))
+		}
+	})
+}
+
+func TestJSONArrayStreaming(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}, connect.WithJSONArrayStreaming()))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	post := func(t *testing.T, procedure, body string) (*http.Response, string) {
+		t.Helper()
+		request, err := http.NewRequestWithContext(
+			context.Background(),
+			http.MethodPost,
+			server.URL+"/"+pingv1connect.PingServiceName+"/"+procedure,
+			strings.NewReader(body),
+		)
+		assert.Nil(t, err)
+		request.Header.Set("Content-Type", "application/json")
+		response, err := server.Client().Do(request)
+		assert.Nil(t, err)
+		data, err := io.ReadAll(response.Body)
+		assert.Nil(t, err)
+		assert.Nil(t, response.Body.Close())
+		return response, string(data)
+	}
+	t.Run("array", func(t *testing.T) {
+		t.Parallel()
+		response, body := post(t, "CountUp", `{"number": 3}`)
+		assert.Equal(t, response.StatusCode, http.StatusOK)
+		assert.Equal(t, response.Header.Get("Content-Type"), "application/json")
+		var numbers []map[string]string
+		assert.Nil(t, json.Unmarshal([]byte(body), &numbers), assert.Sprintf("body %q", body))
+		assert.Equal(t, numbers, []map[string]string{{"number": "1"}, {"number": "2"}, {"number": "3"}})
+		// Trailers set before the first message are sent like Connect unary
+		// trailers.
+		assert.Equal(t, response.Header.Get("Trailer-"+handlerTrailer), trailerValue)
+	})
+	t.Run("error", func(t *testing.T) {
+		t.Parallel()
+		response, body := post(t, "CountUp", `{"number": -1}`)
+		assert.Equal(t, response.StatusCode, http.StatusBadRequest)
+		var wire map[string]any
+		assert.Nil(t, json.Unmarshal([]byte(body), &wire))
+		assert.Equal(t, wire["code"], "invalid_argument")
+	})
+	t.Run("other_stream_types", func(t *testing.T) {
+		t.Parallel()
+		response, _ := post(t, "Sum", `{"number": 1}`)
+		assert.Equal(t, response.StatusCode, http.StatusUnsupportedMediaType)
+	})
+	t.Run("streaming_clients", func(t *testing.T) {
+		t.Parallel()
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithProtoJSON())
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 2}))
+		assert.Nil(t, err)
+		var count int
+		for stream.Receive() {
+			count++
+		}
+		assert.Nil(t, stream.Err())
+		assert.Equal(t, count, 2)
+		assert.Nil(t, stream.Close())
+	})
+}
+
+func TestHandlerDebugEcho(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		pingServer{},
+		connect.WithDebugEcho(connect.DebugEcho{
+			Authorize: func(request *http.Request) bool {
+				return request.Header.Get("Authorization") == "Bearer operator"
+			},
+			Version: "v1.2.3",
+		}),
+		connect.WithIdempotency(connect.IdempotencyNoSideEffects),
+	))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	newRequest := func(authorized bool) *connect.Request[pingv1.PingRequest] {
+		request := connect.NewRequest(&pingv1.PingRequest{Number: 42})
+		request.Header().Set("Connect-Debug", "1")
+		if authorized {
+			request.Header().Set("Authorization", "Bearer operator")
+		}
+		return request
+	}
+	testCases := []struct {
+		protocol string
+		codec    string
+		options  []connect.ClientOption
+	}{
+		{connect.ProtocolConnect, "json", []connect.ClientOption{connect.WithProtoJSON(), connect.WithSendGzip()}},
+		{connect.ProtocolGRPC, "proto", []connect.ClientOption{connect.WithGRPC()}},
+		{connect.ProtocolGRPCWeb, "proto", []connect.ClientOption{connect.WithGRPCWeb()}},
+	}
+	for _, testCase := range testCases {
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, testCase.options...)
+		response, err := client.Ping(context.Background(), newRequest(true))
+		assert.Nil(t, err)
+		assert.Equal(t, response.Header().Get("Connect-Debug-Protocol"), testCase.protocol)
+		assert.Equal(t, response.Header().Get("Connect-Debug-Codec"), testCase.codec)
+		assert.Equal(t, response.Header().Get("Connect-Debug-Version"), "v1.2.3")
+		_, err = time.ParseDuration(response.Trailer().Get("Connect-Debug-Processing-Time"))
+		assert.Nil(t, err, assert.Sprintf("%s processing time", testCase.protocol))
+
+		response, err = client.Ping(context.Background(), newRequest(false))
+		assert.Nil(t, err)
+		assert.Zero(t, response.Header().Get("Connect-Debug-Protocol"))
+		assert.Zero(t, response.Trailer().Get("Connect-Debug-Processing-Time"))
+	}
+
+	// Connect GET requests name their codec in the query string.
+	getClient := connect.NewClient[pingv1.PingRequest, pingv1.PingResponse](
+		server.Client(),
+		server.URL+"/"+pingv1connect.PingServiceName+"/Ping",
+		connect.WithHTTPGet(),
+		connect.WithProtoJSON(),
+		connect.WithIdempotency(connect.IdempotencyNoSideEffects),
+	)
+	response, err := getClient.CallUnary(context.Background(), newRequest(true))
+	assert.Nil(t, err)
+	assert.Equal(t, response.Header().Get("Connect-Debug-Codec"), "json")
+
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+	request := connect.NewRequest(&pingv1.CountUpRequest{Number: 2})
+	request.Header().Set("Connect-Debug", "1")
+	request.Header().Set("Authorization", "Bearer operator")
+	stream, err := client.CountUp(context.Background(), request)
+	assert.Nil(t, err)
+	for stream.Receive() {
+	}
+	assert.Nil(t, stream.Err())
+	assert.Equal(t, stream.ResponseHeader().Get("Connect-Debug-Protocol"), connect.ProtocolConnect)
+	assert.Equal(t, stream.ResponseHeader().Get("Connect-Debug-Compression"), "identity")
+	_, err = time.ParseDuration(stream.ResponseTrailer().Get("Connect-Debug-Processing-Time"))
+	assert.Nil(t, err)
+	assert.Nil(t, stream.Close())
+
+	t.Run("policy", func(t *testing.T) {
+		t.Parallel()
+		// Per-call policies still apply to requests that ask for diagnostic
+		// headers.
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(
+			pingServer{},
+			connect.WithDebugEcho(connect.DebugEcho{
+				Authorize: func(*http.Request) bool { return true },
+			}),
+			connect.WithPolicyResolver(func(context.Context, connect.Spec, connect.Peer) connect.CallPolicy {
+				return connect.CallPolicy{ReadMaxBytes: 1}
+			}),
+		))
+		server := httptest.NewServer(mux)
+		t.Cleanup(server.Close)
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+		_, err := client.Ping(context.Background(), newRequest(true))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+	})
+}
+
+type countingFlushWriter struct {
+	http.ResponseWriter
+
+	flushes *int64
+}
+
+func (w *countingFlushWriter) Flush() {
+	atomic.AddInt64(w.flushes, 1)
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
 }
@@ -75,6 +75,18 @@ func (c *ClientStream[Req]) Err() error {
 	return c.err
 }
 
+// CloseReceive closes the receive side of the stream, signaling that the
+// handler doesn't need any more messages from the client. Subsequent calls to
+// Receive return false, and any messages the client sends afterwards are
+// discarded. CloseReceive may be called from another goroutine to interrupt a
+// pending Receive.
+//
+// If interceptors have wrapped the underlying StreamingHandlerConn,
+// CloseReceive returns an error with [CodeUnimplemented].
+func (c *ClientStream[Req]) CloseReceive() error {
+	return closeReceive(c.conn)
+}
+
 // Conn exposes the underlying StreamingHandlerConn. This may be useful if
 // you'd prefer to wrap the connection in a different high-level API.
 func (c *ClientStream[Req]) Conn() StreamingHandlerConn {
@@ -146,6 +158,19 @@ func (b *BidiStream[Req, Res]) Receive() (*Req, error) {
 	return &req, nil
 }
 
+// CloseReceive closes the receive side of the stream, signaling that the
+// handler doesn't need any more messages from the client. Subsequent calls to
+// Receive return an error wrapping [io.EOF], and any messages the client sends
+// afterwards are discarded. Over HTTP/2, the client's half of the stream is
+// reset once the handler returns. CloseReceive may be called from another
+// goroutine to interrupt a pending Receive.
+//
+// If interceptors have wrapped the underlying StreamingHandlerConn,
+// CloseReceive returns an error with [CodeUnimplemented].
+func (b *BidiStream[Req, Res]) CloseReceive() error {
+	return closeReceive(b.conn)
+}
+
 // ResponseHeader returns the response headers. Headers are sent with the first
 // call to Send.
 func (b *BidiStream[Req, Res]) ResponseHeader() http.Header {
@@ -45,8 +45,58 @@ func DecodeBinaryHeader(data string) ([]byte, error) {
 	return base64.StdEncoding.DecodeString(data)
 }
 
+// A HeaderMergePolicy controls how headers and trailers set on a [Request] or
+// [Response] are merged with those already set on the underlying stream, for
+// example by interceptors or by the protocol implementation.
+type HeaderMergePolicy uint8
+
+const (
+	// HeaderMergeAppend appends the message's values to any existing values
+	// for the same key. This is the default.
+	HeaderMergeAppend HeaderMergePolicy = iota
+	// HeaderMergeOverwrite replaces any existing values with the message's
+	// values for the same key.
+	HeaderMergeOverwrite
+)
+
+// SetHeaderOnce sets the key to value if the header doesn't already contain
+// any values for the key. It reports whether the value was set. Like
+// [http.Header.Set], it canonicalizes the key.
+func SetHeaderOnce(header http.Header, key, value string) bool {
+	key = http.CanonicalHeaderKey(key)
+	if _, ok := header[key]; ok {
+		return false
+	}
+	header[key] = []string{value}
+	return true
+}
+
 func mergeHeaders(into, from http.Header) {
 	for k, vals := range from {
 		into[k] = append(into[k], vals...)
 	}
 }
+
+func mergeHeadersWithPolicy(into, from http.Header, policy HeaderMergePolicy) {
+	if policy != HeaderMergeOverwrite {
+		mergeHeaders(into, from)
+		return
+	}
+	for k, vals := range from {
+		into[k] = append([]string(nil), vals...)
+	}
+}
+
+// moveHeadersWithPolicy is like mergeHeadersWithPolicy, but it may share value
+// slices with from rather than copying them, so it's only safe when nothing
+// uses from afterwards. The shared slices' capacity is capped, so appending
+// to them later always copies.
+func moveHeadersWithPolicy(into, from http.Header, policy HeaderMergePolicy) {
+	for k, vals := range from {
+		if existing, ok := into[k]; ok && policy != HeaderMergeOverwrite {
+			into[k] = append(existing, vals...)
+			continue
+		}
+		into[k] = vals[:len(vals):len(vals)]
+	}
+}
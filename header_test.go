@@ -56,3 +56,63 @@ func TestHeaderMerge(t *testing.T) {
 	}
 	assert.Equal(t, header, expect)
 }
+
+func TestHeaderMergeOverwrite(t *testing.T) {
+	t.Parallel()
+	header := http.Header{
+		"Foo": []string{"one"},
+		"Qux": []string{"one"},
+	}
+	from := http.Header{
+		"Foo": []string{"two"},
+		"Bar": []string{"one"},
+	}
+	mergeHeadersWithPolicy(header, from, HeaderMergeOverwrite)
+	expect := http.Header{
+		"Foo": []string{"two"},
+		"Bar": []string{"one"},
+		"Qux": []string{"one"},
+	}
+	assert.Equal(t, header, expect)
+	// Mutating the merged header shouldn't affect the source.
+	header["Foo"][0] = "three"
+	assert.Equal(t, from.Get("Foo"), "two")
+}
+
+func TestHeaderMove(t *testing.T) {
+	t.Parallel()
+	from := http.Header{
+		"Foo": make([]string, 1, 4),
+		"Bar": []string{"one"},
+	}
+	from["Foo"][0] = "one"
+	header := http.Header{
+		"Bar": []string{"zero"},
+	}
+	moveHeadersWithPolicy(header, from, HeaderMergeAppend)
+	assert.Equal(t, header, http.Header{
+		"Foo": []string{"one"},
+		"Bar": []string{"zero", "one"},
+	})
+	// Appending to a moved slice mustn't write into the source's spare
+	// capacity.
+	header["Foo"] = append(header["Foo"], "two")
+	assert.Equal(t, from["Foo"][:2], []string{"one", ""})
+
+	header = http.Header{
+		"Bar": []string{"zero"},
+	}
+	moveHeadersWithPolicy(header, from, HeaderMergeOverwrite)
+	assert.Equal(t, header, http.Header{
+		"Foo": []string{"one"},
+		"Bar": []string{"one"},
+	})
+}
+
+func TestSetHeaderOnce(t *testing.T) {
+	t.Parallel()
+	header := make(http.Header)
+	assert.True(t, SetHeaderOnce(header, "x-foo", "one"))
+	assert.False(t, SetHeaderOnce(header, "X-Foo", "two"))
+	assert.Equal(t, header.Values("X-Foo"), []string{"one"})
+}
@@ -0,0 +1,205 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/bufbuild/connect-go/internal/assert"
+	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
+	"github.com/bufbuild/connect-go/internal/gen/connect/ping/v1/pingv1connect"
+)
+
+func TestHTTPGet(t *testing.T) {
+	t.Parallel()
+	const procedure = "/" + pingv1connect.PingServiceName + "/Ping"
+	ping := func(ctx context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+		response := connect.NewResponse(&pingv1.PingResponse{Number: request.Msg.Number, Text: request.Msg.Text})
+		response.Header().Set("Cache-Control", "max-age=60")
+		return response, nil
+	}
+	mux := http.NewServeMux()
+	mux.Handle(procedure, connect.NewUnaryHandler(
+		procedure,
+		ping,
+		connect.WithIdempotency(connect.IdempotencyNoSideEffects),
+	))
+	mux.Handle("/post-only"+procedure, connect.NewUnaryHandler(procedure, ping))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	var mu sync.Mutex
+	var sent []*http.Request
+	recordingClient := httpClientFunc(func(request *http.Request) (*http.Response, error) {
+		mu.Lock()
+		sent = append(sent, request)
+		mu.Unlock()
+		return server.Client().Do(request)
+	})
+	lastRequest := func() *http.Request {
+		mu.Lock()
+		defer mu.Unlock()
+		return sent[len(sent)-1]
+	}
+	call := func(t *testing.T, options ...connect.ClientOption) *http.Request {
+		t.Helper()
+		options = append(options, connect.WithIdempotency(connect.IdempotencyNoSideEffects))
+		client := connect.NewClient[pingv1.PingRequest, pingv1.PingResponse](
+			recordingClient,
+			server.URL+procedure,
+			options...,
+		)
+		request := connect.NewRequest(&pingv1.PingRequest{Number: 42, Text: "hello/world?"})
+		response, err := client.CallUnary(context.Background(), request)
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.Number, int64(42))
+		assert.Equal(t, response.Msg.Text, "hello/world?")
+		return lastRequest()
+	}
+
+	t.Run("proto", func(t *testing.T) {
+		t.Parallel()
+		request := call(t, connect.WithHTTPGet())
+		assert.Equal(t, request.Method, http.MethodGet)
+		assert.Equal(t, request.Header.Get("Content-Type"), "")
+		query := request.URL.Query()
+		assert.Equal(t, query.Get("encoding"), "proto")
+		assert.Equal(t, query.Get("base64"), "1")
+		assert.Equal(t, query.Get("connect"), "v1")
+		assert.NotZero(t, query.Get("message"))
+		// Equal requests have equal URLs, so they can be cached.
+		assert.Equal(t, call(t, connect.WithHTTPGet()).URL.String(), request.URL.String())
+	})
+	t.Run("json", func(t *testing.T) {
+		t.Parallel()
+		request := call(t, connect.WithHTTPGet(), connect.WithProtoJSON())
+		assert.Equal(t, request.Method, http.MethodGet)
+		query := request.URL.Query()
+		assert.Equal(t, query.Get("encoding"), "json")
+		assert.Equal(t, query.Get("base64"), "")
+		assert.Equal(t, query.Get("message"), `{"number":"42","text":"hello/world?"}`)
+	})
+	t.Run("compressed", func(t *testing.T) {
+		t.Parallel()
+		request := call(t, connect.WithHTTPGet(), connect.WithProtoJSON(), connect.WithSendGzip())
+		assert.Equal(t, request.Method, http.MethodGet)
+		assert.Equal(t, request.Header.Get("Content-Encoding"), "")
+		query := request.URL.Query()
+		assert.Equal(t, query.Get("compression"), "gzip")
+		assert.Equal(t, query.Get("base64"), "1")
+	})
+	t.Run("long_url_falls_back_to_post", func(t *testing.T) {
+		t.Parallel()
+		callText := func(t *testing.T, text string, options ...connect.ClientOption) string {
+			t.Helper()
+			var method string
+			client := connect.NewClient[pingv1.PingRequest, pingv1.PingResponse](
+				httpClientFunc(func(request *http.Request) (*http.Response, error) {
+					method = request.Method
+					return server.Client().Do(request)
+				}),
+				server.URL+procedure,
+				append(options, connect.WithHTTPGet(), connect.WithIdempotency(connect.IdempotencyNoSideEffects))...,
+			)
+			response, err := client.CallUnary(context.Background(), connect.NewRequest(&pingv1.PingRequest{Text: text}))
+			assert.Nil(t, err)
+			assert.Equal(t, response.Msg.Text, text)
+			return method
+		}
+		// With the default 8 KiB limit, a 10 KB message is too long for a URL.
+		long := strings.Repeat("x", 10_000)
+		assert.Equal(t, callText(t, "short"), http.MethodGet)
+		assert.Equal(t, callText(t, long), http.MethodPost)
+		assert.Equal(t, callText(t, long, connect.WithHTTPGetMaxURLSize(0)), http.MethodGet)
+		assert.Equal(t, callText(t, "short", connect.WithHTTPGetMaxURLSize(len(server.URL+procedure))), http.MethodPost)
+	})
+	t.Run("post_by_default", func(t *testing.T) {
+		t.Parallel()
+		assert.Equal(t, call(t).Method, http.MethodPost)
+	})
+	t.Run("cacheable_response", func(t *testing.T) {
+		t.Parallel()
+		response, err := server.Client().Get(server.URL + procedure + `?encoding=json&message={"text":"cached"}`)
+		assert.Nil(t, err)
+		defer response.Body.Close()
+		assert.Equal(t, response.StatusCode, http.StatusOK)
+		assert.Equal(t, response.Header.Get("Content-Type"), "application/json")
+		assert.Equal(t, response.Header.Get("Cache-Control"), "max-age=60")
+	})
+	t.Run("head", func(t *testing.T) {
+		t.Parallel()
+		response, err := server.Client().Head(server.URL + procedure + `?encoding=json&message={"text":"cached"}`)
+		assert.Nil(t, err)
+		defer response.Body.Close()
+		assert.Equal(t, response.StatusCode, http.StatusOK)
+		assert.Equal(t, response.Header.Get("Content-Type"), "application/json")
+		assert.Equal(t, response.Header.Get("Cache-Control"), "max-age=60")
+		body, err := io.ReadAll(response.Body)
+		assert.Nil(t, err)
+		assert.Zero(t, len(body))
+
+		response, err = server.Client().Head(server.URL + "/post-only" + procedure + "?encoding=json&message={}")
+		assert.Nil(t, err)
+		defer response.Body.Close()
+		assert.Equal(t, response.StatusCode, http.StatusMethodNotAllowed)
+	})
+	t.Run("padded_base64", func(t *testing.T) {
+		t.Parallel()
+		// {"text":"ab"} is 13 bytes, so its base64 encoding is padded.
+		message := "eyJ0ZXh0IjoiYWIifQ=="
+		response, err := server.Client().Get(server.URL + procedure + "?encoding=json&base64=1&message=" + url.QueryEscape(message))
+		assert.Nil(t, err)
+		defer response.Body.Close()
+		assert.Equal(t, response.StatusCode, http.StatusOK)
+	})
+	t.Run("invalid_base64", func(t *testing.T) {
+		t.Parallel()
+		response, err := server.Client().Get(server.URL + procedure + "?encoding=json&base64=1&message=!!!")
+		assert.Nil(t, err)
+		defer response.Body.Close()
+		assert.Equal(t, response.StatusCode, http.StatusBadRequest)
+	})
+	t.Run("unsupported_encoding", func(t *testing.T) {
+		t.Parallel()
+		response, err := server.Client().Get(server.URL + procedure + "?encoding=xml&message=x")
+		assert.Nil(t, err)
+		defer response.Body.Close()
+		assert.Equal(t, response.StatusCode, http.StatusUnsupportedMediaType)
+	})
+	t.Run("method_not_allowed", func(t *testing.T) {
+		t.Parallel()
+		request, err := http.NewRequestWithContext(context.Background(), http.MethodPut, server.URL+procedure, strings.NewReader("{}"))
+		assert.Nil(t, err)
+		response, err := server.Client().Do(request)
+		assert.Nil(t, err)
+		defer response.Body.Close()
+		assert.Equal(t, response.StatusCode, http.StatusMethodNotAllowed)
+		assert.Equal(t, response.Header.Get("Allow"), "GET, HEAD, POST")
+
+		response, err = server.Client().Get(server.URL + "/post-only" + procedure + "?encoding=json&message={}")
+		assert.Nil(t, err)
+		defer response.Body.Close()
+		assert.Equal(t, response.StatusCode, http.StatusMethodNotAllowed)
+		assert.Equal(t, response.Header.Get("Allow"), "POST")
+	})
+}
@@ -0,0 +1,57 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"net/http"
+)
+
+// An HTTPStatusError describes an HTTP response that didn't carry an RPC
+// result, typically because a proxy, load balancer, or CDN responded on the
+// server's behalf. Clients return an [*Error] wrapping an HTTPStatusError, so
+// the original status is available with [errors.As]. The [*Error] metadata
+// contains the response headers (for example, the Location header of a
+// redirect).
+type HTTPStatusError struct {
+	StatusCode int    // for example, 520
+	Status     string // for example, "520 Web Server Returned an Unknown Error"
+}
+
+func (e *HTTPStatusError) Error() string {
+	return "HTTP status " + e.Status
+}
+
+// newHTTPStatusError converts an unexpected HTTP response into an *Error. If
+// the client was configured with WithHTTPStatusCodes and the mapping
+// recognizes the status, the mapped code is used. Otherwise, the code comes
+// from the protocol's own HTTP-to-code mapping.
+func newHTTPStatusError(
+	response *http.Response,
+	protocolCode func(int) Code,
+	mapping func(int) (Code, bool),
+) *Error {
+	code := protocolCode(response.StatusCode)
+	if mapping != nil {
+		if mapped, ok := mapping(response.StatusCode); ok {
+			code = mapped
+		}
+	}
+	err := NewError(code, &HTTPStatusError{
+		StatusCode: response.StatusCode,
+		Status:     response.Status,
+	})
+	err.meta = response.Header.Clone()
+	return err
+}
@@ -0,0 +1,178 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"sync"
+)
+
+// Hub tracks connected server streams and broadcasts messages to all of them,
+// or to a filtered subset, which covers the common case of publish-subscribe
+// over server streaming. Each stream has its own queue, so a slow client
+// doesn't delay the others unless the hub uses [LagBlock]; most hubs should
+// use [LagDisconnect] to evict slow consumers. It's constructed with [NewHub].
+//
+// Server streaming handlers join the hub by calling [Hub.Serve]:
+//
+//	func (s *server) Watch(ctx context.Context, req *connect.Request[WatchRequest], stream *connect.ServerStream[Event]) error {
+//	  return s.hub.Serve(ctx, stream, req.Msg.Topic)
+//	}
+//
+// Messages are shared between streams, so they must not be modified after
+// they're broadcast. Messages broadcast from a single goroutine are delivered
+// to each stream in order.
+type Hub[T any] struct {
+	options BroadcastOptions
+	done    chan struct{}
+
+	mu          sync.Mutex
+	subscribers map[*hubSubscriber[T]]struct{}
+	closed      bool
+}
+
+type hubSubscriber[T any] struct {
+	key       string
+	queue     chan *T
+	gone      chan struct{} // closed when Serve returns
+	evicted   chan struct{}
+	evictOnce sync.Once
+	dropped   uint64 // atomic
+}
+
+// NewHub constructs an empty Hub. Options apply to each stream's queue.
+func NewHub[T any](options BroadcastOptions) *Hub[T] {
+	if options.Buffer < 1 {
+		options.Buffer = defaultBroadcastBuffer
+	}
+	return &Hub[T]{
+		options:     options,
+		done:        make(chan struct{}),
+		subscribers: make(map[*hubSubscriber[T]]struct{}),
+	}
+}
+
+// Serve adds a stream to the hub and sends it broadcast messages until the
+// context is done, sending fails, the stream is evicted for falling behind,
+// or the hub is closed. The key identifies the stream to broadcast filters,
+// and is usually a topic, tenant, or user ID.
+//
+// Serve returns nil when the hub is closed, after sending any queued
+// messages. Evicted streams fail with [CodeResourceExhausted].
+func (h *Hub[T]) Serve(ctx context.Context, stream *ServerStream[T], key string) error {
+	sub := &hubSubscriber[T]{
+		key:     key,
+		queue:   make(chan *T, h.options.Buffer),
+		gone:    make(chan struct{}),
+		evicted: make(chan struct{}),
+	}
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return nil
+	}
+	h.subscribers[sub] = struct{}{}
+	h.mu.Unlock()
+	defer func() {
+		close(sub.gone)
+		h.remove(sub)
+	}()
+	for {
+		select {
+		case msg := <-sub.queue:
+			if err := stream.Send(msg); err != nil {
+				return err
+			}
+		case <-sub.evicted:
+			return errorf(CodeResourceExhausted, "stream fell more than %d messages behind", h.options.Buffer)
+		case <-h.done:
+			return h.drain(stream, sub)
+		case <-ctx.Done():
+			return wrapIfContextDone(ctx, ctx.Err())
+		}
+	}
+}
+
+// Broadcast sends msg to every stream in the hub, and returns the number of
+// streams it was queued for.
+func (h *Hub[T]) Broadcast(msg *T) int {
+	return h.BroadcastFunc(msg, nil)
+}
+
+// BroadcastFunc sends msg to the streams whose keys match the filter, and
+// returns the number of streams it was queued for. A nil filter matches
+// every stream.
+func (h *Hub[T]) BroadcastFunc(msg *T, filter func(key string) bool) int {
+	h.mu.Lock()
+	subscribers := make([]*hubSubscriber[T], 0, len(h.subscribers))
+	for sub := range h.subscribers {
+		if filter == nil || filter(sub.key) {
+			subscribers = append(subscribers, sub)
+		}
+	}
+	h.mu.Unlock()
+	var queued int
+	for _, sub := range subscribers {
+		if enqueue(sub.queue, sub.gone, msg, h.options.Lag, &sub.dropped) {
+			queued++
+			continue
+		}
+		sub.evictOnce.Do(func() { close(sub.evicted) })
+		h.remove(sub)
+	}
+	return queued
+}
+
+// Len returns the number of streams in the hub.
+func (h *Hub[T]) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers)
+}
+
+// Close removes all streams from the hub, and makes future calls to Serve
+// return immediately. Calls to Serve return nil after sending any messages
+// already queued.
+func (h *Hub[T]) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.closed {
+		h.closed = true
+		close(h.done)
+		// Streams still drain their queues, but they no longer receive
+		// broadcasts.
+		h.subscribers = make(map[*hubSubscriber[T]]struct{})
+	}
+	return nil
+}
+
+func (h *Hub[T]) remove(sub *hubSubscriber[T]) {
+	h.mu.Lock()
+	delete(h.subscribers, sub)
+	h.mu.Unlock()
+}
+
+func (h *Hub[T]) drain(stream *ServerStream[T], sub *hubSubscriber[T]) error {
+	for {
+		select {
+		case msg := <-sub.queue:
+			if err := stream.Send(msg); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bufbuild/connect-go/internal/assert"
+	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
+)
+
+func TestHub(t *testing.T) {
+	t.Parallel()
+	// join serves a stream in the background. Sends block until the test
+	// reads them from the returned channel.
+	join := func(t *testing.T, hub *Hub[pingv1.CountUpResponse], key string) (<-chan any, <-chan error) {
+		t.Helper()
+		conn := &hubTestConn{sent: make(chan any)}
+		done := make(chan error, 1)
+		before := hub.Len()
+		go func() {
+			done <- hub.Serve(context.Background(), &ServerStream[pingv1.CountUpResponse]{conn: conn}, key)
+		}()
+		waitForHub(t, func() bool { return hub.Len() == before+1 })
+		return conn.sent, done
+	}
+	receive := func(t *testing.T, sent <-chan any) int64 {
+		t.Helper()
+		msg, ok := (<-sent).(*pingv1.CountUpResponse)
+		assert.True(t, ok)
+		return msg.Number
+	}
+
+	t.Run("broadcast", func(t *testing.T) {
+		t.Parallel()
+		hub := NewHub[pingv1.CountUpResponse](BroadcastOptions{})
+		first, firstDone := join(t, hub, "a")
+		second, secondDone := join(t, hub, "a")
+		third, thirdDone := join(t, hub, "b")
+		assert.Equal(t, hub.Broadcast(&pingv1.CountUpResponse{Number: 1}), 3)
+		assert.Equal(t, hub.BroadcastFunc(
+			&pingv1.CountUpResponse{Number: 2},
+			func(key string) bool { return key == "a" },
+		), 2)
+		assert.Equal(t, receive(t, first), 1)
+		assert.Equal(t, receive(t, first), 2)
+		assert.Equal(t, receive(t, second), 1)
+		assert.Equal(t, receive(t, second), 2)
+		assert.Equal(t, receive(t, third), 1)
+		assert.Nil(t, hub.Close())
+		assert.Zero(t, hub.Len())
+		assert.Nil(t, <-firstDone)
+		assert.Nil(t, <-secondDone)
+		assert.Nil(t, <-thirdDone)
+		assert.Nil(t, hub.Serve(context.Background(), &ServerStream[pingv1.CountUpResponse]{}, "late"))
+		assert.Zero(t, hub.Broadcast(&pingv1.CountUpResponse{Number: 3}))
+	})
+	t.Run("evict", func(t *testing.T) {
+		t.Parallel()
+		hub := NewHub[pingv1.CountUpResponse](BroadcastOptions{Buffer: 1, Lag: LagDisconnect})
+		sent, done := join(t, hub, "slow")
+		assert.Equal(t, hub.Broadcast(&pingv1.CountUpResponse{Number: 1}), 1)
+		// Wait for the first message to be sending, so that the second fills
+		// the queue and the third overflows it.
+		waitForHub(t, func() bool {
+			hub.mu.Lock()
+			defer hub.mu.Unlock()
+			sending := false
+			for sub := range hub.subscribers {
+				sending = len(sub.queue) == 0
+			}
+			return sending
+		})
+		assert.Equal(t, hub.Broadcast(&pingv1.CountUpResponse{Number: 2}), 1)
+		assert.Equal(t, hub.Broadcast(&pingv1.CountUpResponse{Number: 3}), 0)
+		assert.Zero(t, hub.Len())
+		assert.Equal(t, receive(t, sent), 1)
+		go func() {
+			for range sent {
+			}
+		}()
+		assert.Equal(t, CodeOf(<-done), CodeResourceExhausted)
+	})
+	t.Run("context", func(t *testing.T) {
+		t.Parallel()
+		hub := NewHub[pingv1.CountUpResponse](BroadcastOptions{})
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err := hub.Serve(ctx, &ServerStream[pingv1.CountUpResponse]{conn: &hubTestConn{}}, "canceled")
+		assert.Equal(t, CodeOf(err), CodeCanceled)
+		assert.Zero(t, hub.Len())
+	})
+}
+
+type hubTestConn struct {
+	StreamingHandlerConn
+
+	sent chan any
+}
+
+func (c *hubTestConn) Send(msg any) error {
+	c.sent <- msg
+	return nil
+}
+
+func waitForHub(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for hub")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import "fmt"
+
+// An IdempotencyLevel is a procedure's idempotency, as declared with the
+// idempotency_level option in its Protobuf definition. The values match
+// google.protobuf.MethodOptions.IdempotencyLevel.
+type IdempotencyLevel int
+
+const (
+	// IdempotencyUnknown is the default: the procedure may have side effects,
+	// and calling it more than once may not be safe.
+	IdempotencyUnknown IdempotencyLevel = 0
+	// IdempotencyNoSideEffects marks procedures that only read data. Unary
+	// procedures with no side effects can be called with HTTP GET in the
+	// Connect protocol, which makes their responses cacheable.
+	IdempotencyNoSideEffects IdempotencyLevel = 1
+	// IdempotencyIdempotent marks procedures that may have side effects, but
+	// where repeating a call has the same effect as making it once.
+	IdempotencyIdempotent IdempotencyLevel = 2
+)
+
+func (i IdempotencyLevel) String() string {
+	switch i {
+	case IdempotencyUnknown:
+		return "idempotency_unknown"
+	case IdempotencyNoSideEffects:
+		return "no_side_effects"
+	case IdempotencyIdempotent:
+		return "idempotent"
+	}
+	return fmt.Sprintf("idempotency_level_%d", int(i))
+}
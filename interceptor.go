@@ -64,6 +64,67 @@ func (f UnaryInterceptorFunc) WrapStreamingHandler(next StreamingHandlerFunc) St
 	return next
 }
 
+// TypedUnaryFunc is like [UnaryFunc], but for a single procedure with known
+// request and response types.
+type TypedUnaryFunc[Req, Res any] func(context.Context, *Request[Req]) (*Response[Res], error)
+
+// NewTypedUnaryInterceptor builds an interceptor with typed access to the
+// messages of a single unary procedure, which simplifies per-procedure logic
+// like field-level authorization:
+//
+//	connect.NewTypedUnaryInterceptor(
+//		"/acme.user.v1.UserService/GetUser",
+//		func(next connect.TypedUnaryFunc[userv1.GetUserRequest, userv1.GetUserResponse]) connect.TypedUnaryFunc[userv1.GetUserRequest, userv1.GetUserResponse] {
+//			return func(ctx context.Context, req *connect.Request[userv1.GetUserRequest]) (*connect.Response[userv1.GetUserResponse], error) {
+//				if req.Msg.IncludeEmail && !canReadEmail(ctx) {
+//					return nil, connect.NewError(connect.CodePermissionDenied, nil)
+//				}
+//				return next(ctx, req)
+//			}
+//		},
+//	)
+//
+// The wrap function is called once, when the interceptor wraps a client or
+// handler. Calls to other procedures pass through unchanged. Calls to the
+// named procedure with other message types fail with [CodeInternal], since
+// they indicate a misconfigured interceptor.
+//
+// Like [UnaryInterceptorFunc], the interceptor has no effect on streaming
+// RPCs.
+func NewTypedUnaryInterceptor[Req, Res any](
+	procedure string,
+	wrap func(TypedUnaryFunc[Req, Res]) TypedUnaryFunc[Req, Res],
+) UnaryInterceptorFunc {
+	return func(next UnaryFunc) UnaryFunc {
+		typed := wrap(func(ctx context.Context, request *Request[Req]) (*Response[Res], error) {
+			response, err := next(ctx, request)
+			if response == nil {
+				return nil, err
+			}
+			typedResponse, ok := response.(*Response[Res])
+			if !ok {
+				return nil, errorf(CodeInternal, "%s: expected response type %T, got %T", procedure, typedResponse, response)
+			}
+			return typedResponse, err
+		})
+		return func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
+			if request.Spec().Procedure != procedure {
+				return next(ctx, request)
+			}
+			typedRequest, ok := request.(*Request[Req])
+			if !ok {
+				return nil, errorf(CodeInternal, "%s: expected request type %T, got %T", procedure, typedRequest, request)
+			}
+			response, err := typed(ctx, typedRequest)
+			if response == nil {
+				// Avoid returning a typed nil as a non-nil AnyResponse.
+				return nil, err
+			}
+			return response, err
+		}
+	}
+}
+
 // A chain composes multiple interceptors into one.
 type chain struct {
 	interceptors []Interceptor
@@ -16,8 +16,10 @@ package connect_test
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/bufbuild/connect-go"
@@ -241,3 +243,99 @@ func (cc *headerInspectingClientConn) Receive(msg any) error {
 	}
 	return err
 }
+
+func TestContextValue(t *testing.T) {
+	t.Parallel()
+	tenant := connect.NewContextValue[string]("tenant")
+	other := connect.NewContextValue[string]("tenant")
+	assert.Equal(t, tenant.String(), "tenant")
+	ctx := tenant.With(context.Background(), "acme")
+	value, ok := tenant.From(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, value, "acme")
+	// Keys with the same name and type don't collide.
+	_, ok = other.From(ctx)
+	assert.False(t, ok)
+
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		pingServer{},
+		connect.WithInterceptors(
+			connect.UnaryInterceptorFunc(func(next connect.UnaryFunc) connect.UnaryFunc {
+				return func(ctx context.Context, request connect.AnyRequest) (connect.AnyResponse, error) {
+					return next(tenant.With(ctx, request.Header().Get("Tenant")), request)
+				}
+			}),
+			connect.UnaryInterceptorFunc(func(next connect.UnaryFunc) connect.UnaryFunc {
+				return func(ctx context.Context, request connect.AnyRequest) (connect.AnyResponse, error) {
+					value, ok := tenant.From(ctx)
+					if !ok || value == "" {
+						return nil, connect.NewError(connect.CodePermissionDenied, errors.New("no tenant"))
+					}
+					return next(ctx, request)
+				}
+			}),
+		),
+	))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+	request := connect.NewRequest(&pingv1.PingRequest{})
+	request.Header().Set("Tenant", "acme")
+	_, err := client.Ping(context.Background(), request)
+	assert.Nil(t, err)
+	_, err = client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+	assert.Equal(t, connect.CodeOf(err), connect.CodePermissionDenied)
+}
+
+func TestTypedUnaryInterceptor(t *testing.T) {
+	t.Parallel()
+	const pingProcedure = "/" + pingv1connect.PingServiceName + "/Ping"
+	authorize := connect.NewTypedUnaryInterceptor(
+		pingProcedure,
+		func(next connect.TypedUnaryFunc[pingv1.PingRequest, pingv1.PingResponse]) connect.TypedUnaryFunc[pingv1.PingRequest, pingv1.PingResponse] {
+			return func(ctx context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+				if request.Msg.Text == "secret" {
+					return nil, connect.NewError(connect.CodePermissionDenied, errors.New("can't ping secrets"))
+				}
+				return next(ctx, request)
+			}
+		},
+	)
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}, connect.WithInterceptors(authorize)))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	redact := connect.NewTypedUnaryInterceptor(
+		pingProcedure,
+		func(next connect.TypedUnaryFunc[pingv1.PingRequest, pingv1.PingResponse]) connect.TypedUnaryFunc[pingv1.PingRequest, pingv1.PingResponse] {
+			return func(ctx context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+				response, err := next(ctx, request)
+				if err == nil {
+					response.Msg.Text = strings.Repeat("*", len(response.Msg.Text))
+				}
+				return response, err
+			}
+		},
+	)
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithInterceptors(redact))
+
+	response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Text: "hello"}))
+	assert.Nil(t, err)
+	assert.Equal(t, response.Msg.Text, "*****")
+	_, err = client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Text: "secret"}))
+	assert.Equal(t, connect.CodeOf(err), connect.CodePermissionDenied)
+	// Other procedures pass through.
+	_, err = client.Fail(context.Background(), connect.NewRequest(&pingv1.FailRequest{Code: int32(connect.CodeAborted)}))
+	assert.Equal(t, connect.CodeOf(err), connect.CodeAborted)
+
+	mismatched := connect.NewTypedUnaryInterceptor(
+		pingProcedure,
+		func(next connect.TypedUnaryFunc[pingv1.FailRequest, pingv1.FailResponse]) connect.TypedUnaryFunc[pingv1.FailRequest, pingv1.FailResponse] {
+			return next
+		},
+	)
+	client = pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithInterceptors(mismatched))
+	_, err = client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+	assert.Equal(t, connect.CodeOf(err), connect.CodeInternal)
+}
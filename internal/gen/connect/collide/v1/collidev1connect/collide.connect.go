@@ -32,7 +32,7 @@ import (
 // generated with a version of connect newer than the one compiled into your binary. You can fix the
 // problem by either regenerating this code with an older version of connect or updating the connect
 // version compiled into your binary.
-const _ = connect_go.IsAtLeastVersion0_1_0
+const _ = connect_go.IsAtLeastVersion1_2_0
 
 const (
 	// CollideServiceName is the fully-qualified name of the CollideService service.
@@ -92,6 +92,20 @@ func NewCollideServiceHandler(svc CollideServiceHandler, opts ...connect_go.Hand
 	return "/connect.collide.v1.CollideService/", mux
 }
 
+// NewCollideService describes the connect.collide.v1.CollideService service and its procedures, for
+// use with connect.Register.
+func NewCollideService(svc CollideServiceHandler) connect_go.Service {
+	return connect_go.NewService(
+		CollideServiceName,
+		connect_go.ServiceProcedure{
+			Procedure: "/connect.collide.v1.CollideService/Import",
+			NewHandler: func(opts ...connect_go.HandlerOption) *connect_go.Handler {
+				return connect_go.NewUnaryHandler("/connect.collide.v1.CollideService/Import", svc.Import, opts...)
+			},
+		},
+	)
+}
+
 // UnimplementedCollideServiceHandler returns CodeUnimplemented from all methods.
 type UnimplementedCollideServiceHandler struct{}
 
@@ -32,7 +32,7 @@ import (
 // generated with a version of connect newer than the one compiled into your binary. You can fix the
 // problem by either regenerating this code with an older version of connect or updating the connect
 // version compiled into your binary.
-const _ = connect_go.IsAtLeastVersion0_1_0
+const _ = connect_go.IsAtLeastVersion1_2_0
 
 const (
 	// PingServiceName is the fully-qualified name of the PingService service.
@@ -174,6 +174,44 @@ func NewPingServiceHandler(svc PingServiceHandler, opts ...connect_go.HandlerOpt
 	return "/connect.ping.v1.PingService/", mux
 }
 
+// NewPingService describes the connect.ping.v1.PingService service and its procedures, for use with
+// connect.Register.
+func NewPingService(svc PingServiceHandler) connect_go.Service {
+	return connect_go.NewService(
+		PingServiceName,
+		connect_go.ServiceProcedure{
+			Procedure: "/connect.ping.v1.PingService/Ping",
+			NewHandler: func(opts ...connect_go.HandlerOption) *connect_go.Handler {
+				return connect_go.NewUnaryHandler("/connect.ping.v1.PingService/Ping", svc.Ping, opts...)
+			},
+		},
+		connect_go.ServiceProcedure{
+			Procedure: "/connect.ping.v1.PingService/Fail",
+			NewHandler: func(opts ...connect_go.HandlerOption) *connect_go.Handler {
+				return connect_go.NewUnaryHandler("/connect.ping.v1.PingService/Fail", svc.Fail, opts...)
+			},
+		},
+		connect_go.ServiceProcedure{
+			Procedure: "/connect.ping.v1.PingService/Sum",
+			NewHandler: func(opts ...connect_go.HandlerOption) *connect_go.Handler {
+				return connect_go.NewClientStreamHandler("/connect.ping.v1.PingService/Sum", svc.Sum, opts...)
+			},
+		},
+		connect_go.ServiceProcedure{
+			Procedure: "/connect.ping.v1.PingService/CountUp",
+			NewHandler: func(opts ...connect_go.HandlerOption) *connect_go.Handler {
+				return connect_go.NewServerStreamHandler("/connect.ping.v1.PingService/CountUp", svc.CountUp, opts...)
+			},
+		},
+		connect_go.ServiceProcedure{
+			Procedure: "/connect.ping.v1.PingService/CumSum",
+			NewHandler: func(opts ...connect_go.HandlerOption) *connect_go.Handler {
+				return connect_go.NewBidiStreamHandler("/connect.ping.v1.PingService/CumSum", svc.CumSum, opts...)
+			},
+		},
+	)
+}
+
 // UnimplementedPingServiceHandler returns CodeUnimplemented from all methods.
 type UnimplementedPingServiceHandler struct{}
 
@@ -0,0 +1,105 @@
+// Code generated by protoc-gen-connect-go. DO NOT EDIT.
+//
+// Source: connectext/grpc/reflection/v1alpha/reflection.proto
+
+package reflectionv1alphaconnect
+
+import (
+	context "context"
+	errors "errors"
+	connect_go "github.com/bufbuild/connect-go"
+	v1alpha "github.com/bufbuild/connect-go/internal/gen/connectext/grpc/reflection/v1alpha"
+	http "net/http"
+	strings "strings"
+)
+
+// This is a compile-time assertion to ensure that this generated file and the connect package are
+// compatible. If you get a compiler error that this constant is not defined, this code was
+// generated with a version of connect newer than the one compiled into your binary. You can fix the
+// problem by either regenerating this code with an older version of connect or updating the connect
+// version compiled into your binary.
+const _ = connect_go.IsAtLeastVersion1_2_0
+
+const (
+	// ServerReflectionName is the fully-qualified name of the ServerReflection service.
+	ServerReflectionName = "grpc.reflection.v1alpha.ServerReflection"
+)
+
+// ServerReflectionClient is a client for the grpc.reflection.v1alpha.ServerReflection service.
+type ServerReflectionClient interface {
+	// The reflection service is structured as a bidirectional stream, ensuring
+	// all related requests go to a single server.
+	ServerReflectionInfo(context.Context) *connect_go.BidiStreamForClient[v1alpha.ServerReflectionRequest, v1alpha.ServerReflectionResponse]
+}
+
+// NewServerReflectionClient constructs a client for the grpc.reflection.v1alpha.ServerReflection
+// service. By default, it uses the Connect protocol with the binary Protobuf Codec, asks for
+// gzipped responses, and sends uncompressed requests. To use the gRPC or gRPC-Web protocols, supply
+// the connect.WithGRPC() or connect.WithGRPCWeb() options.
+//
+// The URL supplied here should be the base URL for the Connect or gRPC server (for example,
+// http://api.acme.com or https://acme.com/grpc).
+func NewServerReflectionClient(httpClient connect_go.HTTPClient, baseURL string, opts ...connect_go.ClientOption) ServerReflectionClient {
+	baseURL = strings.TrimRight(baseURL, "/")
+	return &serverReflectionClient{
+		serverReflectionInfo: connect_go.NewClient[v1alpha.ServerReflectionRequest, v1alpha.ServerReflectionResponse](
+			httpClient,
+			baseURL+"/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo",
+			opts...,
+		),
+	}
+}
+
+// serverReflectionClient implements ServerReflectionClient.
+type serverReflectionClient struct {
+	serverReflectionInfo *connect_go.Client[v1alpha.ServerReflectionRequest, v1alpha.ServerReflectionResponse]
+}
+
+// ServerReflectionInfo calls grpc.reflection.v1alpha.ServerReflection.ServerReflectionInfo.
+func (c *serverReflectionClient) ServerReflectionInfo(ctx context.Context) *connect_go.BidiStreamForClient[v1alpha.ServerReflectionRequest, v1alpha.ServerReflectionResponse] {
+	return c.serverReflectionInfo.CallBidiStream(ctx)
+}
+
+// ServerReflectionHandler is an implementation of the grpc.reflection.v1alpha.ServerReflection
+// service.
+type ServerReflectionHandler interface {
+	// The reflection service is structured as a bidirectional stream, ensuring
+	// all related requests go to a single server.
+	ServerReflectionInfo(context.Context, *connect_go.BidiStream[v1alpha.ServerReflectionRequest, v1alpha.ServerReflectionResponse]) error
+}
+
+// NewServerReflectionHandler builds an HTTP handler from the service implementation. It returns the
+// path on which to mount the handler and the handler itself.
+//
+// By default, handlers support the Connect, gRPC, and gRPC-Web protocols with the binary Protobuf
+// and JSON codecs. They also support gzip compression.
+func NewServerReflectionHandler(svc ServerReflectionHandler, opts ...connect_go.HandlerOption) (string, http.Handler) {
+	mux := http.NewServeMux()
+	mux.Handle("/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo", connect_go.NewBidiStreamHandler(
+		"/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo",
+		svc.ServerReflectionInfo,
+		opts...,
+	))
+	return "/grpc.reflection.v1alpha.ServerReflection/", mux
+}
+
+// NewServerReflectionService describes the grpc.reflection.v1alpha.ServerReflection service and its
+// procedures, for use with connect.Register.
+func NewServerReflectionService(svc ServerReflectionHandler) connect_go.Service {
+	return connect_go.NewService(
+		ServerReflectionName,
+		connect_go.ServiceProcedure{
+			Procedure: "/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo",
+			NewHandler: func(opts ...connect_go.HandlerOption) *connect_go.Handler {
+				return connect_go.NewBidiStreamHandler("/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo", svc.ServerReflectionInfo, opts...)
+			},
+		},
+	)
+}
+
+// UnimplementedServerReflectionHandler returns CodeUnimplemented from all methods.
+type UnimplementedServerReflectionHandler struct{}
+
+func (UnimplementedServerReflectionHandler) ServerReflectionInfo(context.Context, *connect_go.BidiStream[v1alpha.ServerReflectionRequest, v1alpha.ServerReflectionResponse]) error {
+	return connect_go.NewError(connect_go.CodeUnimplemented, errors.New("grpc.reflection.v1alpha.ServerReflection.ServerReflectionInfo is not implemented"))
+}
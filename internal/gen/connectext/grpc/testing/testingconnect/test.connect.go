@@ -0,0 +1,411 @@
+// Code generated by protoc-gen-connect-go. DO NOT EDIT.
+//
+// Source: connectext/grpc/testing/test.proto
+
+package testingconnect
+
+import (
+	context "context"
+	errors "errors"
+	connect_go "github.com/bufbuild/connect-go"
+	testing "github.com/bufbuild/connect-go/internal/gen/connectext/grpc/testing"
+	http "net/http"
+	strings "strings"
+)
+
+// This is a compile-time assertion to ensure that this generated file and the connect package are
+// compatible. If you get a compiler error that this constant is not defined, this code was
+// generated with a version of connect newer than the one compiled into your binary. You can fix the
+// problem by either regenerating this code with an older version of connect or updating the connect
+// version compiled into your binary.
+const _ = connect_go.IsAtLeastVersion1_2_0
+
+const (
+	// TestServiceName is the fully-qualified name of the TestService service.
+	TestServiceName = "grpc.testing.TestService"
+	// UnimplementedServiceName is the fully-qualified name of the UnimplementedService service.
+	UnimplementedServiceName = "grpc.testing.UnimplementedService"
+)
+
+// TestServiceClient is a client for the grpc.testing.TestService service.
+type TestServiceClient interface {
+	// One empty request followed by one empty response.
+	EmptyCall(context.Context, *connect_go.Request[testing.Empty]) (*connect_go.Response[testing.Empty], error)
+	// One request followed by one response.
+	UnaryCall(context.Context, *connect_go.Request[testing.SimpleRequest]) (*connect_go.Response[testing.SimpleResponse], error)
+	// One request followed by one response. Response has cache control
+	// headers set such that a caching HTTP proxy (such as GFE) can
+	// satisfy subsequent requests.
+	CacheableUnaryCall(context.Context, *connect_go.Request[testing.SimpleRequest]) (*connect_go.Response[testing.SimpleResponse], error)
+	// One request followed by a sequence of responses (streamed download).
+	// The server returns the payload with client desired type and sizes.
+	StreamingOutputCall(context.Context, *connect_go.Request[testing.StreamingOutputCallRequest]) (*connect_go.ServerStreamForClient[testing.StreamingOutputCallResponse], error)
+	// A sequence of requests followed by one response (streamed upload).
+	// The server returns the aggregated size of client payload as the result.
+	StreamingInputCall(context.Context) *connect_go.ClientStreamForClient[testing.StreamingInputCallRequest, testing.StreamingInputCallResponse]
+	// A sequence of requests with each request served by the server immediately.
+	// As one request could lead to multiple responses, this interface
+	// demonstrates the idea of full duplexing.
+	FullDuplexCall(context.Context) *connect_go.BidiStreamForClient[testing.StreamingOutputCallRequest, testing.StreamingOutputCallResponse]
+	// A sequence of requests followed by a sequence of responses.
+	// The server buffers all the client requests and then serves them in order. A
+	// stream of responses are returned to the client when the server starts with
+	// first request.
+	HalfDuplexCall(context.Context) *connect_go.BidiStreamForClient[testing.StreamingOutputCallRequest, testing.StreamingOutputCallResponse]
+	// The test server will not implement this method. It will be used
+	// to test the behavior when clients call unimplemented methods.
+	UnimplementedCall(context.Context, *connect_go.Request[testing.Empty]) (*connect_go.Response[testing.Empty], error)
+}
+
+// NewTestServiceClient constructs a client for the grpc.testing.TestService service. By default, it
+// uses the Connect protocol with the binary Protobuf Codec, asks for gzipped responses, and sends
+// uncompressed requests. To use the gRPC or gRPC-Web protocols, supply the connect.WithGRPC() or
+// connect.WithGRPCWeb() options.
+//
+// The URL supplied here should be the base URL for the Connect or gRPC server (for example,
+// http://api.acme.com or https://acme.com/grpc).
+func NewTestServiceClient(httpClient connect_go.HTTPClient, baseURL string, opts ...connect_go.ClientOption) TestServiceClient {
+	baseURL = strings.TrimRight(baseURL, "/")
+	return &testServiceClient{
+		emptyCall: connect_go.NewClient[testing.Empty, testing.Empty](
+			httpClient,
+			baseURL+"/grpc.testing.TestService/EmptyCall",
+			opts...,
+		),
+		unaryCall: connect_go.NewClient[testing.SimpleRequest, testing.SimpleResponse](
+			httpClient,
+			baseURL+"/grpc.testing.TestService/UnaryCall",
+			opts...,
+		),
+		cacheableUnaryCall: connect_go.NewClient[testing.SimpleRequest, testing.SimpleResponse](
+			httpClient,
+			baseURL+"/grpc.testing.TestService/CacheableUnaryCall",
+			opts...,
+		),
+		streamingOutputCall: connect_go.NewClient[testing.StreamingOutputCallRequest, testing.StreamingOutputCallResponse](
+			httpClient,
+			baseURL+"/grpc.testing.TestService/StreamingOutputCall",
+			opts...,
+		),
+		streamingInputCall: connect_go.NewClient[testing.StreamingInputCallRequest, testing.StreamingInputCallResponse](
+			httpClient,
+			baseURL+"/grpc.testing.TestService/StreamingInputCall",
+			opts...,
+		),
+		fullDuplexCall: connect_go.NewClient[testing.StreamingOutputCallRequest, testing.StreamingOutputCallResponse](
+			httpClient,
+			baseURL+"/grpc.testing.TestService/FullDuplexCall",
+			opts...,
+		),
+		halfDuplexCall: connect_go.NewClient[testing.StreamingOutputCallRequest, testing.StreamingOutputCallResponse](
+			httpClient,
+			baseURL+"/grpc.testing.TestService/HalfDuplexCall",
+			opts...,
+		),
+		unimplementedCall: connect_go.NewClient[testing.Empty, testing.Empty](
+			httpClient,
+			baseURL+"/grpc.testing.TestService/UnimplementedCall",
+			opts...,
+		),
+	}
+}
+
+// testServiceClient implements TestServiceClient.
+type testServiceClient struct {
+	emptyCall           *connect_go.Client[testing.Empty, testing.Empty]
+	unaryCall           *connect_go.Client[testing.SimpleRequest, testing.SimpleResponse]
+	cacheableUnaryCall  *connect_go.Client[testing.SimpleRequest, testing.SimpleResponse]
+	streamingOutputCall *connect_go.Client[testing.StreamingOutputCallRequest, testing.StreamingOutputCallResponse]
+	streamingInputCall  *connect_go.Client[testing.StreamingInputCallRequest, testing.StreamingInputCallResponse]
+	fullDuplexCall      *connect_go.Client[testing.StreamingOutputCallRequest, testing.StreamingOutputCallResponse]
+	halfDuplexCall      *connect_go.Client[testing.StreamingOutputCallRequest, testing.StreamingOutputCallResponse]
+	unimplementedCall   *connect_go.Client[testing.Empty, testing.Empty]
+}
+
+// EmptyCall calls grpc.testing.TestService.EmptyCall.
+func (c *testServiceClient) EmptyCall(ctx context.Context, req *connect_go.Request[testing.Empty]) (*connect_go.Response[testing.Empty], error) {
+	return c.emptyCall.CallUnary(ctx, req)
+}
+
+// UnaryCall calls grpc.testing.TestService.UnaryCall.
+func (c *testServiceClient) UnaryCall(ctx context.Context, req *connect_go.Request[testing.SimpleRequest]) (*connect_go.Response[testing.SimpleResponse], error) {
+	return c.unaryCall.CallUnary(ctx, req)
+}
+
+// CacheableUnaryCall calls grpc.testing.TestService.CacheableUnaryCall.
+func (c *testServiceClient) CacheableUnaryCall(ctx context.Context, req *connect_go.Request[testing.SimpleRequest]) (*connect_go.Response[testing.SimpleResponse], error) {
+	return c.cacheableUnaryCall.CallUnary(ctx, req)
+}
+
+// StreamingOutputCall calls grpc.testing.TestService.StreamingOutputCall.
+func (c *testServiceClient) StreamingOutputCall(ctx context.Context, req *connect_go.Request[testing.StreamingOutputCallRequest]) (*connect_go.ServerStreamForClient[testing.StreamingOutputCallResponse], error) {
+	return c.streamingOutputCall.CallServerStream(ctx, req)
+}
+
+// StreamingInputCall calls grpc.testing.TestService.StreamingInputCall.
+func (c *testServiceClient) StreamingInputCall(ctx context.Context) *connect_go.ClientStreamForClient[testing.StreamingInputCallRequest, testing.StreamingInputCallResponse] {
+	return c.streamingInputCall.CallClientStream(ctx)
+}
+
+// FullDuplexCall calls grpc.testing.TestService.FullDuplexCall.
+func (c *testServiceClient) FullDuplexCall(ctx context.Context) *connect_go.BidiStreamForClient[testing.StreamingOutputCallRequest, testing.StreamingOutputCallResponse] {
+	return c.fullDuplexCall.CallBidiStream(ctx)
+}
+
+// HalfDuplexCall calls grpc.testing.TestService.HalfDuplexCall.
+func (c *testServiceClient) HalfDuplexCall(ctx context.Context) *connect_go.BidiStreamForClient[testing.StreamingOutputCallRequest, testing.StreamingOutputCallResponse] {
+	return c.halfDuplexCall.CallBidiStream(ctx)
+}
+
+// UnimplementedCall calls grpc.testing.TestService.UnimplementedCall.
+func (c *testServiceClient) UnimplementedCall(ctx context.Context, req *connect_go.Request[testing.Empty]) (*connect_go.Response[testing.Empty], error) {
+	return c.unimplementedCall.CallUnary(ctx, req)
+}
+
+// TestServiceHandler is an implementation of the grpc.testing.TestService service.
+type TestServiceHandler interface {
+	// One empty request followed by one empty response.
+	EmptyCall(context.Context, *connect_go.Request[testing.Empty]) (*connect_go.Response[testing.Empty], error)
+	// One request followed by one response.
+	UnaryCall(context.Context, *connect_go.Request[testing.SimpleRequest]) (*connect_go.Response[testing.SimpleResponse], error)
+	// One request followed by one response. Response has cache control
+	// headers set such that a caching HTTP proxy (such as GFE) can
+	// satisfy subsequent requests.
+	CacheableUnaryCall(context.Context, *connect_go.Request[testing.SimpleRequest]) (*connect_go.Response[testing.SimpleResponse], error)
+	// One request followed by a sequence of responses (streamed download).
+	// The server returns the payload with client desired type and sizes.
+	StreamingOutputCall(context.Context, *connect_go.Request[testing.StreamingOutputCallRequest], *connect_go.ServerStream[testing.StreamingOutputCallResponse]) error
+	// A sequence of requests followed by one response (streamed upload).
+	// The server returns the aggregated size of client payload as the result.
+	StreamingInputCall(context.Context, *connect_go.ClientStream[testing.StreamingInputCallRequest]) (*connect_go.Response[testing.StreamingInputCallResponse], error)
+	// A sequence of requests with each request served by the server immediately.
+	// As one request could lead to multiple responses, this interface
+	// demonstrates the idea of full duplexing.
+	FullDuplexCall(context.Context, *connect_go.BidiStream[testing.StreamingOutputCallRequest, testing.StreamingOutputCallResponse]) error
+	// A sequence of requests followed by a sequence of responses.
+	// The server buffers all the client requests and then serves them in order. A
+	// stream of responses are returned to the client when the server starts with
+	// first request.
+	HalfDuplexCall(context.Context, *connect_go.BidiStream[testing.StreamingOutputCallRequest, testing.StreamingOutputCallResponse]) error
+	// The test server will not implement this method. It will be used
+	// to test the behavior when clients call unimplemented methods.
+	UnimplementedCall(context.Context, *connect_go.Request[testing.Empty]) (*connect_go.Response[testing.Empty], error)
+}
+
+// NewTestServiceHandler builds an HTTP handler from the service implementation. It returns the path
+// on which to mount the handler and the handler itself.
+//
+// By default, handlers support the Connect, gRPC, and gRPC-Web protocols with the binary Protobuf
+// and JSON codecs. They also support gzip compression.
+func NewTestServiceHandler(svc TestServiceHandler, opts ...connect_go.HandlerOption) (string, http.Handler) {
+	mux := http.NewServeMux()
+	mux.Handle("/grpc.testing.TestService/EmptyCall", connect_go.NewUnaryHandler(
+		"/grpc.testing.TestService/EmptyCall",
+		svc.EmptyCall,
+		opts...,
+	))
+	mux.Handle("/grpc.testing.TestService/UnaryCall", connect_go.NewUnaryHandler(
+		"/grpc.testing.TestService/UnaryCall",
+		svc.UnaryCall,
+		opts...,
+	))
+	mux.Handle("/grpc.testing.TestService/CacheableUnaryCall", connect_go.NewUnaryHandler(
+		"/grpc.testing.TestService/CacheableUnaryCall",
+		svc.CacheableUnaryCall,
+		opts...,
+	))
+	mux.Handle("/grpc.testing.TestService/StreamingOutputCall", connect_go.NewServerStreamHandler(
+		"/grpc.testing.TestService/StreamingOutputCall",
+		svc.StreamingOutputCall,
+		opts...,
+	))
+	mux.Handle("/grpc.testing.TestService/StreamingInputCall", connect_go.NewClientStreamHandler(
+		"/grpc.testing.TestService/StreamingInputCall",
+		svc.StreamingInputCall,
+		opts...,
+	))
+	mux.Handle("/grpc.testing.TestService/FullDuplexCall", connect_go.NewBidiStreamHandler(
+		"/grpc.testing.TestService/FullDuplexCall",
+		svc.FullDuplexCall,
+		opts...,
+	))
+	mux.Handle("/grpc.testing.TestService/HalfDuplexCall", connect_go.NewBidiStreamHandler(
+		"/grpc.testing.TestService/HalfDuplexCall",
+		svc.HalfDuplexCall,
+		opts...,
+	))
+	mux.Handle("/grpc.testing.TestService/UnimplementedCall", connect_go.NewUnaryHandler(
+		"/grpc.testing.TestService/UnimplementedCall",
+		svc.UnimplementedCall,
+		opts...,
+	))
+	return "/grpc.testing.TestService/", mux
+}
+
+// NewTestService describes the grpc.testing.TestService service and its procedures, for use with
+// connect.Register.
+func NewTestService(svc TestServiceHandler) connect_go.Service {
+	return connect_go.NewService(
+		TestServiceName,
+		connect_go.ServiceProcedure{
+			Procedure: "/grpc.testing.TestService/EmptyCall",
+			NewHandler: func(opts ...connect_go.HandlerOption) *connect_go.Handler {
+				return connect_go.NewUnaryHandler("/grpc.testing.TestService/EmptyCall", svc.EmptyCall, opts...)
+			},
+		},
+		connect_go.ServiceProcedure{
+			Procedure: "/grpc.testing.TestService/UnaryCall",
+			NewHandler: func(opts ...connect_go.HandlerOption) *connect_go.Handler {
+				return connect_go.NewUnaryHandler("/grpc.testing.TestService/UnaryCall", svc.UnaryCall, opts...)
+			},
+		},
+		connect_go.ServiceProcedure{
+			Procedure: "/grpc.testing.TestService/CacheableUnaryCall",
+			NewHandler: func(opts ...connect_go.HandlerOption) *connect_go.Handler {
+				return connect_go.NewUnaryHandler("/grpc.testing.TestService/CacheableUnaryCall", svc.CacheableUnaryCall, opts...)
+			},
+		},
+		connect_go.ServiceProcedure{
+			Procedure: "/grpc.testing.TestService/StreamingOutputCall",
+			NewHandler: func(opts ...connect_go.HandlerOption) *connect_go.Handler {
+				return connect_go.NewServerStreamHandler("/grpc.testing.TestService/StreamingOutputCall", svc.StreamingOutputCall, opts...)
+			},
+		},
+		connect_go.ServiceProcedure{
+			Procedure: "/grpc.testing.TestService/StreamingInputCall",
+			NewHandler: func(opts ...connect_go.HandlerOption) *connect_go.Handler {
+				return connect_go.NewClientStreamHandler("/grpc.testing.TestService/StreamingInputCall", svc.StreamingInputCall, opts...)
+			},
+		},
+		connect_go.ServiceProcedure{
+			Procedure: "/grpc.testing.TestService/FullDuplexCall",
+			NewHandler: func(opts ...connect_go.HandlerOption) *connect_go.Handler {
+				return connect_go.NewBidiStreamHandler("/grpc.testing.TestService/FullDuplexCall", svc.FullDuplexCall, opts...)
+			},
+		},
+		connect_go.ServiceProcedure{
+			Procedure: "/grpc.testing.TestService/HalfDuplexCall",
+			NewHandler: func(opts ...connect_go.HandlerOption) *connect_go.Handler {
+				return connect_go.NewBidiStreamHandler("/grpc.testing.TestService/HalfDuplexCall", svc.HalfDuplexCall, opts...)
+			},
+		},
+		connect_go.ServiceProcedure{
+			Procedure: "/grpc.testing.TestService/UnimplementedCall",
+			NewHandler: func(opts ...connect_go.HandlerOption) *connect_go.Handler {
+				return connect_go.NewUnaryHandler("/grpc.testing.TestService/UnimplementedCall", svc.UnimplementedCall, opts...)
+			},
+		},
+	)
+}
+
+// UnimplementedTestServiceHandler returns CodeUnimplemented from all methods.
+type UnimplementedTestServiceHandler struct{}
+
+func (UnimplementedTestServiceHandler) EmptyCall(context.Context, *connect_go.Request[testing.Empty]) (*connect_go.Response[testing.Empty], error) {
+	return nil, connect_go.NewError(connect_go.CodeUnimplemented, errors.New("grpc.testing.TestService.EmptyCall is not implemented"))
+}
+
+func (UnimplementedTestServiceHandler) UnaryCall(context.Context, *connect_go.Request[testing.SimpleRequest]) (*connect_go.Response[testing.SimpleResponse], error) {
+	return nil, connect_go.NewError(connect_go.CodeUnimplemented, errors.New("grpc.testing.TestService.UnaryCall is not implemented"))
+}
+
+func (UnimplementedTestServiceHandler) CacheableUnaryCall(context.Context, *connect_go.Request[testing.SimpleRequest]) (*connect_go.Response[testing.SimpleResponse], error) {
+	return nil, connect_go.NewError(connect_go.CodeUnimplemented, errors.New("grpc.testing.TestService.CacheableUnaryCall is not implemented"))
+}
+
+func (UnimplementedTestServiceHandler) StreamingOutputCall(context.Context, *connect_go.Request[testing.StreamingOutputCallRequest], *connect_go.ServerStream[testing.StreamingOutputCallResponse]) error {
+	return connect_go.NewError(connect_go.CodeUnimplemented, errors.New("grpc.testing.TestService.StreamingOutputCall is not implemented"))
+}
+
+func (UnimplementedTestServiceHandler) StreamingInputCall(context.Context, *connect_go.ClientStream[testing.StreamingInputCallRequest]) (*connect_go.Response[testing.StreamingInputCallResponse], error) {
+	return nil, connect_go.NewError(connect_go.CodeUnimplemented, errors.New("grpc.testing.TestService.StreamingInputCall is not implemented"))
+}
+
+func (UnimplementedTestServiceHandler) FullDuplexCall(context.Context, *connect_go.BidiStream[testing.StreamingOutputCallRequest, testing.StreamingOutputCallResponse]) error {
+	return connect_go.NewError(connect_go.CodeUnimplemented, errors.New("grpc.testing.TestService.FullDuplexCall is not implemented"))
+}
+
+func (UnimplementedTestServiceHandler) HalfDuplexCall(context.Context, *connect_go.BidiStream[testing.StreamingOutputCallRequest, testing.StreamingOutputCallResponse]) error {
+	return connect_go.NewError(connect_go.CodeUnimplemented, errors.New("grpc.testing.TestService.HalfDuplexCall is not implemented"))
+}
+
+func (UnimplementedTestServiceHandler) UnimplementedCall(context.Context, *connect_go.Request[testing.Empty]) (*connect_go.Response[testing.Empty], error) {
+	return nil, connect_go.NewError(connect_go.CodeUnimplemented, errors.New("grpc.testing.TestService.UnimplementedCall is not implemented"))
+}
+
+// UnimplementedServiceClient is a client for the grpc.testing.UnimplementedService service.
+type UnimplementedServiceClient interface {
+	// A call that no server should implement
+	UnimplementedCall(context.Context, *connect_go.Request[testing.Empty]) (*connect_go.Response[testing.Empty], error)
+}
+
+// NewUnimplementedServiceClient constructs a client for the grpc.testing.UnimplementedService
+// service. By default, it uses the Connect protocol with the binary Protobuf Codec, asks for
+// gzipped responses, and sends uncompressed requests. To use the gRPC or gRPC-Web protocols, supply
+// the connect.WithGRPC() or connect.WithGRPCWeb() options.
+//
+// The URL supplied here should be the base URL for the Connect or gRPC server (for example,
+// http://api.acme.com or https://acme.com/grpc).
+func NewUnimplementedServiceClient(httpClient connect_go.HTTPClient, baseURL string, opts ...connect_go.ClientOption) UnimplementedServiceClient {
+	baseURL = strings.TrimRight(baseURL, "/")
+	return &unimplementedServiceClient{
+		unimplementedCall: connect_go.NewClient[testing.Empty, testing.Empty](
+			httpClient,
+			baseURL+"/grpc.testing.UnimplementedService/UnimplementedCall",
+			opts...,
+		),
+	}
+}
+
+// unimplementedServiceClient implements UnimplementedServiceClient.
+type unimplementedServiceClient struct {
+	unimplementedCall *connect_go.Client[testing.Empty, testing.Empty]
+}
+
+// UnimplementedCall calls grpc.testing.UnimplementedService.UnimplementedCall.
+func (c *unimplementedServiceClient) UnimplementedCall(ctx context.Context, req *connect_go.Request[testing.Empty]) (*connect_go.Response[testing.Empty], error) {
+	return c.unimplementedCall.CallUnary(ctx, req)
+}
+
+// UnimplementedServiceHandler is an implementation of the grpc.testing.UnimplementedService
+// service.
+type UnimplementedServiceHandler interface {
+	// A call that no server should implement
+	UnimplementedCall(context.Context, *connect_go.Request[testing.Empty]) (*connect_go.Response[testing.Empty], error)
+}
+
+// NewUnimplementedServiceHandler builds an HTTP handler from the service implementation. It returns
+// the path on which to mount the handler and the handler itself.
+//
+// By default, handlers support the Connect, gRPC, and gRPC-Web protocols with the binary Protobuf
+// and JSON codecs. They also support gzip compression.
+func NewUnimplementedServiceHandler(svc UnimplementedServiceHandler, opts ...connect_go.HandlerOption) (string, http.Handler) {
+	mux := http.NewServeMux()
+	mux.Handle("/grpc.testing.UnimplementedService/UnimplementedCall", connect_go.NewUnaryHandler(
+		"/grpc.testing.UnimplementedService/UnimplementedCall",
+		svc.UnimplementedCall,
+		opts...,
+	))
+	return "/grpc.testing.UnimplementedService/", mux
+}
+
+// NewUnimplementedService describes the grpc.testing.UnimplementedService service and its
+// procedures, for use with connect.Register.
+func NewUnimplementedService(svc UnimplementedServiceHandler) connect_go.Service {
+	return connect_go.NewService(
+		UnimplementedServiceName,
+		connect_go.ServiceProcedure{
+			Procedure: "/grpc.testing.UnimplementedService/UnimplementedCall",
+			NewHandler: func(opts ...connect_go.HandlerOption) *connect_go.Handler {
+				return connect_go.NewUnaryHandler("/grpc.testing.UnimplementedService/UnimplementedCall", svc.UnimplementedCall, opts...)
+			},
+		},
+	)
+}
+
+// UnimplementedUnimplementedServiceHandler returns CodeUnimplemented from all methods.
+type UnimplementedUnimplementedServiceHandler struct{}
+
+func (UnimplementedUnimplementedServiceHandler) UnimplementedCall(context.Context, *connect_go.Request[testing.Empty]) (*connect_go.Response[testing.Empty], error) {
+	return nil, connect_go.NewError(connect_go.CodeUnimplemented, errors.New("grpc.testing.UnimplementedService.UnimplementedCall is not implemented"))
+}
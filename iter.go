@@ -0,0 +1,94 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.23
+
+package connect
+
+import (
+	"iter"
+)
+
+// All returns an iterator over the messages in the stream. If the stream
+// stops with an unexpected error, the iterator yields it (with a nil message)
+// as its final element. Reaching the end of the stream isn't an error.
+//
+// All doesn't close the stream, so callers should still defer a call to
+// Close. (If the loop body panics, All closes the stream before the panic
+// propagates, so that the underlying HTTP/2 stream isn't leaked.) Deferring
+// Close also cleans up after breaking out of the loop early:
+//
+//	defer stream.Close()
+//	for msg, err := range stream.All() {
+//	  if err != nil {
+//	    return err
+//	  }
+//	  fmt.Println(msg)
+//	}
+func (s *ServerStreamForClient[Res]) All() iter.Seq2[*Res, error] {
+	return func(yield func(*Res, error) bool) {
+		// If the loop body panics (or calls runtime.Goexit), we don't return
+		// normally.
+		returned := false
+		defer func() {
+			if !returned {
+				_ = s.Close()
+			}
+		}()
+		for s.Receive() {
+			if !yield(s.Msg(), nil) {
+				returned = true
+				return
+			}
+		}
+		if err := s.Err(); err != nil {
+			yield(nil, err)
+		}
+		returned = true
+	}
+}
+
+// Messages returns an iterator over the messages sent by the client. If the
+// stream stops with an unexpected error, the iterator yields it (with a nil
+// message) as its final element. Reaching the end of the stream isn't an
+// error.
+func (c *ClientStream[Req]) Messages() iter.Seq2[*Req, error] {
+	return func(yield func(*Req, error) bool) {
+		for c.Receive() {
+			if !yield(c.Msg(), nil) {
+				return
+			}
+		}
+		if err := c.Err(); err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+// All returns an iterator over the items of a paginated list. If fetching a
+// page fails, the iterator yields the error (with a zero item) as its final
+// element.
+func (p *Paginator[T]) All() iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for p.Next() {
+			if !yield(p.Item(), nil) {
+				return
+			}
+		}
+		if err := p.Err(); err != nil {
+			var zero T
+			yield(zero, err)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.23
+
+package connect_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/bufbuild/connect-go/internal/assert"
+	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
+	"github.com/bufbuild/connect-go/internal/gen/connect/ping/v1/pingv1connect"
+)
+
+func TestStreamIterators(t *testing.T) {
+	t.Parallel()
+	const sumProcedure = "/" + pingv1connect.PingServiceName + "/Sum"
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	mux.Handle(sumProcedure, connect.NewClientStreamHandler(
+		sumProcedure,
+		func(ctx context.Context, stream *connect.ClientStream[pingv1.SumRequest]) (*connect.Response[pingv1.SumResponse], error) {
+			var sum int64
+			for msg, err := range stream.Messages() {
+				if err != nil {
+					return nil, err
+				}
+				sum += msg.Number
+			}
+			return connect.NewResponse(&pingv1.SumResponse{Sum: sum}), nil
+		},
+	))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+
+	t.Run("server_stream", func(t *testing.T) {
+		t.Parallel()
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 3}))
+		assert.Nil(t, err)
+		defer stream.Close()
+		var got []int64
+		for msg, err := range stream.All() {
+			assert.Nil(t, err)
+			got = append(got, msg.Number)
+		}
+		assert.Equal(t, got, []int64{1, 2, 3})
+	})
+	t.Run("server_stream_panic", func(t *testing.T) {
+		t.Parallel()
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 3}))
+		assert.Nil(t, err)
+		func() {
+			defer func() {
+				assert.Equal(t, recover(), any("boom"))
+			}()
+			for range stream.All() {
+				panic("boom")
+			}
+		}()
+		// The iterator closed the stream on the way out.
+		assert.False(t, stream.Receive())
+		assert.NotNil(t, stream.Err())
+	})
+	t.Run("server_stream_break", func(t *testing.T) {
+		t.Parallel()
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 3}))
+		assert.Nil(t, err)
+		defer stream.Close()
+		var got []int64
+		for msg, err := range stream.All() {
+			assert.Nil(t, err)
+			got = append(got, msg.Number)
+			break
+		}
+		assert.Equal(t, got, []int64{1})
+	})
+	t.Run("server_stream_error", func(t *testing.T) {
+		t.Parallel()
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: -1}))
+		assert.Nil(t, err)
+		defer stream.Close()
+		var errs []error
+		for msg, err := range stream.All() {
+			assert.Nil(t, msg)
+			errs = append(errs, err)
+		}
+		assert.Equal(t, len(errs), 1)
+		assert.Equal(t, connect.CodeOf(errs[0]), connect.CodeInvalidArgument)
+	})
+	t.Run("client_stream", func(t *testing.T) {
+		t.Parallel()
+		stream := client.Sum(context.Background())
+		for i := int64(1); i <= 3; i++ {
+			assert.Nil(t, stream.Send(&pingv1.SumRequest{Number: i}))
+		}
+		response, err := stream.CloseAndReceive()
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.Sum, 6)
+	})
+}
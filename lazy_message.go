@@ -0,0 +1,122 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+// LazyMessage defers unmarshaling, for proxies and routers that forward
+// messages without inspecting most of them. Use it as the message type of a
+// handler or client, for example NewUnaryHandler[LazyMessage[pingv1.PingRequest],
+// LazyMessage[pingv1.PingResponse]]. Received LazyMessages hold the raw,
+// uncompressed message bytes, and they're only unmarshaled by the first call
+// to Decode. Sending a LazyMessage reuses its raw bytes unchanged if the
+// codec matches the one it was received with, so forwarding never pays to
+// unmarshal and marshal again.
+//
+// Since unmarshaling is deferred, features that inspect messages, such as
+// validation and initializers, see the LazyMessage rather than the decoded
+// message.
+type LazyMessage[T any] struct {
+	raw   []byte
+	codec Codec
+	msg   *T
+	err   error
+}
+
+// NewLazyMessage wraps an already-decoded message, so that it can be sent by
+// clients and handlers that use LazyMessages.
+func NewLazyMessage[T any](msg *T) *LazyMessage[T] {
+	return &LazyMessage[T]{msg: msg}
+}
+
+// Decode unmarshals the message on first use and returns the result. Later
+// calls return the same message and error. Treat the returned message as
+// read-only: to send a modified message, pass it to Set, since otherwise the
+// raw bytes are sent unchanged.
+func (m *LazyMessage[T]) Decode() (*T, error) {
+	if m.msg != nil || m.err != nil {
+		return m.msg, m.err
+	}
+	msg := new(T)
+	if m.codec != nil {
+		if err := m.codec.Unmarshal(m.raw, msg); err != nil {
+			m.err = errorf(CodeInvalidArgument, "unmarshal into %T: %w", msg, err)
+			return nil, m.err
+		}
+	}
+	m.msg = msg
+	return m.msg, nil
+}
+
+// Set replaces the message. The raw bytes are discarded, so sending the
+// LazyMessage marshals msg.
+func (m *LazyMessage[T]) Set(msg *T) {
+	m.raw = nil
+	m.codec = nil
+	m.msg = msg
+	m.err = nil
+}
+
+// Raw returns the message's raw bytes and the name of the codec that produced
+// them. It returns false if the message wasn't received, or has been
+// replaced with Set.
+func (m *LazyMessage[T]) Raw() ([]byte, string, bool) {
+	if m.codec == nil {
+		return nil, "", false
+	}
+	return m.raw, m.codec.Name(), true
+}
+
+func (m *LazyMessage[T]) setRaw(data []byte, codec Codec) {
+	m.raw = append(m.raw[:0], data...)
+	m.codec = codec
+	m.msg = nil
+	m.err = nil
+}
+
+func (m *LazyMessage[T]) marshal(codec Codec) ([]byte, error) {
+	if m.codec != nil && m.codec.Name() == codec.Name() {
+		// Callers may recycle the returned slice, so it can't alias raw.
+		return append([]byte(nil), m.raw...), nil
+	}
+	msg, err := m.Decode()
+	if err != nil {
+		return nil, err
+	}
+	return codec.Marshal(msg)
+}
+
+// lazyMessage is implemented by all LazyMessages.
+type lazyMessage interface {
+	setRaw([]byte, Codec)
+	marshal(Codec) ([]byte, error)
+}
+
+// marshalMessage is like codec.Marshal, but it reuses the raw bytes of
+// LazyMessages.
+func marshalMessage(codec Codec, message any) ([]byte, error) {
+	if lazy, ok := message.(lazyMessage); ok {
+		return lazy.marshal(codec)
+	}
+	return codec.Marshal(message)
+}
+
+// unmarshalMessage is like codec.Unmarshal, but it defers unmarshaling into
+// LazyMessages.
+func unmarshalMessage(codec Codec, data []byte, message any) error {
+	if lazy, ok := message.(lazyMessage); ok {
+		lazy.setRaw(data, codec)
+		return nil
+	}
+	return codec.Unmarshal(data, message)
+}
@@ -0,0 +1,107 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	connect "github.com/bufbuild/connect-go"
+	"github.com/bufbuild/connect-go/internal/assert"
+	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
+	"github.com/bufbuild/connect-go/internal/gen/connect/ping/v1/pingv1connect"
+)
+
+func TestLazyMessage(t *testing.T) {
+	t.Parallel()
+	const pingProcedure = "/" + pingv1connect.PingServiceName + "/Ping"
+	backendMux := http.NewServeMux()
+	backendMux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	backend := httptest.NewServer(backendMux)
+	t.Cleanup(backend.Close)
+
+	type (
+		lazyRequest  = connect.LazyMessage[pingv1.PingRequest]
+		lazyResponse = connect.LazyMessage[pingv1.PingResponse]
+	)
+	forward := connect.NewClient[lazyRequest, lazyResponse](backend.Client(), backend.URL+pingProcedure)
+	proxyMux := http.NewServeMux()
+	proxyMux.Handle(pingProcedure, connect.NewUnaryHandler(
+		pingProcedure,
+		func(ctx context.Context, request *connect.Request[lazyRequest]) (*connect.Response[lazyResponse], error) {
+			if _, codec, ok := request.Msg.Raw(); !ok || codec == "" {
+				return nil, connect.NewError(connect.CodeInternal, errors.New("request has no raw bytes"))
+			}
+			msg, err := request.Msg.Decode()
+			if err != nil {
+				return nil, err
+			}
+			if msg.Text == "rewrite" {
+				request.Msg.Set(&pingv1.PingRequest{Number: msg.Number * 2, Text: "rewritten"})
+			}
+			response, err := forward.CallUnary(ctx, connect.NewRequest(request.Msg))
+			if err != nil {
+				return nil, err
+			}
+			return connect.NewResponse(response.Msg), nil
+		},
+	))
+	proxy := httptest.NewServer(proxyMux)
+	t.Cleanup(proxy.Close)
+
+	for _, codec := range []struct {
+		name    string
+		options []connect.ClientOption
+	}{
+		{name: "proto"},
+		// The proxy forwards with the binary codec, so JSON requests are
+		// decoded and marshaled again.
+		{name: "json", options: []connect.ClientOption{connect.WithProtoJSON()}},
+	} {
+		codec := codec
+		t.Run(codec.name, func(t *testing.T) {
+			t.Parallel()
+			client := pingv1connect.NewPingServiceClient(proxy.Client(), proxy.URL, codec.options...)
+			response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 42, Text: "forward"}))
+			assert.Nil(t, err)
+			assert.Equal(t, response.Msg.Number, 42)
+			assert.Equal(t, response.Msg.Text, "forward")
+
+			response, err = client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 42, Text: "rewrite"}))
+			assert.Nil(t, err)
+			assert.Equal(t, response.Msg.Number, 84)
+			assert.Equal(t, response.Msg.Text, "rewritten")
+		})
+	}
+	t.Run("lazy_client", func(t *testing.T) {
+		t.Parallel()
+		client := connect.NewClient[lazyRequest, lazyResponse](proxy.Client(), proxy.URL+pingProcedure)
+		response, err := client.CallUnary(
+			context.Background(),
+			connect.NewRequest(connect.NewLazyMessage(&pingv1.PingRequest{Number: 7})),
+		)
+		assert.Nil(t, err)
+		raw, codecName, ok := response.Msg.Raw()
+		assert.True(t, ok)
+		assert.Equal(t, codecName, "proto")
+		assert.True(t, len(raw) > 0)
+		msg, err := response.Msg.Decode()
+		assert.Nil(t, err)
+		assert.Equal(t, msg.Number, 7)
+	})
+}
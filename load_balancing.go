@@ -0,0 +1,350 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// After a failure to reach an endpoint, it's skipped for a backoff that
+	// doubles with each consecutive failure.
+	endpointInitialBackoff = time.Second
+	endpointMaxBackoff     = 30 * time.Second
+)
+
+// Resolver supplies the base URLs of the servers that a client configured
+// with [WithLoadBalancing] spreads its calls across. Resolve is called at the
+// start of every call, so implementations that look up endpoints remotely
+// should cache their results.
+type Resolver interface {
+	Resolve(ctx context.Context) ([]string, error)
+}
+
+// NewStaticResolver returns a [Resolver] for a fixed set of base URLs.
+func NewStaticResolver(urls ...string) Resolver {
+	return staticResolver(urls)
+}
+
+type staticResolver []string
+
+func (r staticResolver) Resolve(context.Context) ([]string, error) {
+	return r, nil
+}
+
+// Endpoint describes one of the servers a [Balancer] can choose from.
+type Endpoint struct {
+	// URL is the endpoint's base URL, as returned by the [Resolver].
+	URL string
+	// Pending is the number of calls to the endpoint that are still in
+	// flight.
+	Pending int
+	// Load is the most recent ORCA load report the endpoint attached to a
+	// response, or nil if it hasn't sent one. Reports are read from HTTP
+	// headers and trailers, so they're only seen for gRPC calls and unary
+	// Connect calls.
+	Load *LoadReport
+}
+
+// Balancer chooses the endpoint for each call made by a client configured
+// with [WithLoadBalancing]. Pick receives the healthy endpoints in the order
+// returned by the [Resolver] (or all of them, if none are healthy) and
+// returns the index of the chosen endpoint. Endpoints become unhealthy when
+// the client can't reach them, and healthy again after a backoff or a
+// successful call. Balancers can weight endpoints by the load reports
+// attached with [SetLoadReport].
+//
+// Balancers are shared by all the clients configured with the same option,
+// so they must be safe to call concurrently.
+type Balancer interface {
+	Pick(endpoints []Endpoint) int
+}
+
+// NewPickFirstBalancer returns a [Balancer] that sends every call to the
+// first healthy endpoint, so the remaining endpoints act as fallbacks.
+func NewPickFirstBalancer() Balancer {
+	return &pickFirstBalancer{}
+}
+
+type pickFirstBalancer struct{}
+
+func (*pickFirstBalancer) Pick([]Endpoint) int {
+	return 0
+}
+
+// NewRoundRobinBalancer returns a [Balancer] that cycles through the healthy
+// endpoints.
+func NewRoundRobinBalancer() Balancer {
+	return &roundRobinBalancer{}
+}
+
+type roundRobinBalancer struct {
+	next uint64 // atomic
+}
+
+func (b *roundRobinBalancer) Pick(endpoints []Endpoint) int {
+	return int((atomic.AddUint64(&b.next, 1) - 1) % uint64(len(endpoints)))
+}
+
+// NewLeastPendingBalancer returns a [Balancer] that chooses the healthy
+// endpoint with the fewest calls in flight, which adapts to endpoints that
+// respond at different speeds. Ties are broken in round-robin order.
+func NewLeastPendingBalancer() Balancer {
+	return &leastPendingBalancer{}
+}
+
+type leastPendingBalancer struct {
+	next uint64 // atomic
+}
+
+func (b *leastPendingBalancer) Pick(endpoints []Endpoint) int {
+	start := int((atomic.AddUint64(&b.next, 1) - 1) % uint64(len(endpoints)))
+	best := start
+	for i := 1; i < len(endpoints); i++ {
+		index := (start + i) % len(endpoints)
+		if endpoints[index].Pending < endpoints[best].Pending {
+			best = index
+		}
+	}
+	return best
+}
+
+// loadBalancer tracks the endpoints of the clients configured with one
+// WithLoadBalancing option.
+type loadBalancer struct {
+	resolver Resolver
+	balancer Balancer
+
+	mu        sync.Mutex
+	endpoints map[string]*endpointState
+}
+
+type endpointState struct {
+	url            *url.URL
+	pending        int
+	failures       int
+	unhealthyUntil time.Time
+	load           *LoadReport
+}
+
+func (s *endpointState) endpoint(rawURL string) Endpoint {
+	return Endpoint{URL: rawURL, Pending: s.pending, Load: s.load}
+}
+
+// callOutcome describes how a call to an endpoint ended.
+type callOutcome int
+
+const (
+	// callReached means the endpoint responded.
+	callReached callOutcome = iota + 1
+	// callUnreachable means the client couldn't reach the endpoint.
+	callUnreachable
+	// callCanceled means the caller gave up, which says nothing about the
+	// endpoint's health.
+	callCanceled
+)
+
+func newLoadBalancer(resolver Resolver, balancer Balancer) *loadBalancer {
+	if balancer == nil {
+		balancer = NewRoundRobinBalancer()
+	}
+	return &loadBalancer{
+		resolver:  resolver,
+		balancer:  balancer,
+		endpoints: make(map[string]*endpointState),
+	}
+}
+
+// pick chooses an endpoint for a call, skipping any in quarantine (which may
+// be nil). The caller must call done once the call finishes.
+func (b *loadBalancer) pick(ctx context.Context, quarantine *EndpointQuarantine) (*endpointState, error) {
+	urls, err := b.resolver.Resolve(ctx)
+	if err != nil {
+		return nil, errorf(CodeUnavailable, "resolve endpoints: %w", err)
+	}
+	if len(urls) == 0 {
+		return nil, errorf(CodeUnavailable, "resolver returned no endpoints")
+	}
+	resolved := urls
+	if quarantine != nil {
+		urls = quarantine.filter(urls)
+		if len(urls) == 0 {
+			return nil, errorf(CodeUnavailable, "all endpoints are quarantined")
+		}
+	}
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	states := make([]*endpointState, 0, len(urls))
+	candidates := make([]Endpoint, 0, len(urls))
+	for _, rawURL := range urls {
+		state, ok := b.endpoints[rawURL]
+		if !ok {
+			parsed, err := url.Parse(rawURL)
+			if err != nil {
+				return nil, errorf(CodeUnavailable, "invalid endpoint URL %q: %w", rawURL, err)
+			}
+			state = &endpointState{url: parsed}
+			b.endpoints[rawURL] = state
+		}
+		if now.Before(state.unhealthyUntil) {
+			continue
+		}
+		states = append(states, state)
+		candidates = append(candidates, state.endpoint(rawURL))
+	}
+	if len(states) == 0 {
+		// Every endpoint is failing, so try them all rather than failing
+		// without making a call.
+		for _, rawURL := range urls {
+			state := b.endpoints[rawURL]
+			states = append(states, state)
+			candidates = append(candidates, state.endpoint(rawURL))
+		}
+	}
+	b.prune(resolved)
+	index := b.balancer.Pick(candidates)
+	if index < 0 || index >= len(states) {
+		index = 0
+	}
+	state := states[index]
+	state.pending++
+	return state, nil
+}
+
+// prune forgets idle endpoints that the resolver no longer returns.
+func (b *loadBalancer) prune(urls []string) {
+	if len(b.endpoints) <= len(urls) {
+		return
+	}
+	current := make(map[string]struct{}, len(urls))
+	for _, rawURL := range urls {
+		current[rawURL] = struct{}{}
+	}
+	for rawURL, state := range b.endpoints {
+		if _, ok := current[rawURL]; !ok && state.pending == 0 {
+			delete(b.endpoints, rawURL)
+		}
+	}
+}
+
+// done records the outcome of a call and the load report attached to its
+// response, if any. Only failures to reach the endpoint make it unhealthy:
+// errors returned by the server don't.
+func (b *loadBalancer) done(state *endpointState, outcome callOutcome, load *LoadReport) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	state.pending--
+	if load != nil {
+		state.load = load
+	}
+	switch outcome {
+	case callCanceled:
+	case callReached:
+		state.failures = 0
+		state.unhealthyUntil = time.Time{}
+	case callUnreachable:
+		state.failures++
+		policy := RetryPolicy{InitialBackoff: endpointInitialBackoff, MaxBackoff: endpointMaxBackoff}
+		state.unhealthyUntil = time.Now().Add(policy.backoff(state.failures))
+	}
+}
+
+// balancedClient sends each request to the endpoint chosen by a
+// loadBalancer, keeping the request's procedure path and query.
+type balancedClient struct {
+	next       HTTPClient
+	balancer   *loadBalancer
+	quarantine *EndpointQuarantine
+	procedure  string
+}
+
+func (c *balancedClient) Do(request *http.Request) (*http.Response, error) {
+	ctx := request.Context()
+	state, err := c.balancer.pick(ctx, c.quarantine)
+	if err != nil {
+		return nil, err
+	}
+	target := *state.url
+	target.Path = strings.TrimSuffix(target.Path, "/") + c.procedure
+	target.RawPath = ""
+	target.RawQuery = request.URL.RawQuery
+	request.URL = &target
+	request.Host = ""
+	response, err := c.next.Do(request)
+	if err != nil {
+		outcome := callUnreachable
+		if ctx.Err() != nil {
+			outcome = callCanceled
+		}
+		c.balancer.done(state, outcome, nil)
+		return nil, err
+	}
+	// Protocol clients may rewrite the response headers, so look for a load
+	// report before handing them over.
+	load := loadReportFromHeader(response.Header, orcaTrailer, connectUnaryTrailerPrefix+orcaTrailer)
+	response.Body = &balancedBody{
+		ReadCloser: response.Body,
+		done: func() {
+			outcome := callReached
+			if ctx.Err() != nil {
+				outcome = callCanceled
+			}
+			if trailerLoad := loadReportFromHeader(response.Trailer, orcaTrailer); trailerLoad != nil {
+				load = trailerLoad
+			}
+			c.balancer.done(state, outcome, load)
+		},
+	}
+	return response, nil
+}
+
+// balancedBody keeps a call pending until its response body is closed.
+type balancedBody struct {
+	io.ReadCloser
+
+	once sync.Once
+	done func()
+}
+
+func (b *balancedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.done)
+	return err
+}
+
+// loadReportFromHeader finds an ORCA load report under any of the keys: gRPC
+// sends reports in the trailers (or the headers, for trailers-only
+// responses), and unary Connect responses send them in a prefixed header.
+// Malformed reports are ignored.
+func loadReportFromHeader(header http.Header, keys ...string) *LoadReport {
+	for _, key := range keys {
+		encoded := header.Get(key)
+		if encoded == "" {
+			continue
+		}
+		if report, err := parseLoadReport(encoded); err == nil {
+			return report
+		}
+	}
+	return nil
+}
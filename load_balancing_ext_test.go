@@ -0,0 +1,230 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/bufbuild/connect-go/internal/assert"
+	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
+	"github.com/bufbuild/connect-go/internal/gen/connect/ping/v1/pingv1connect"
+)
+
+func TestLoadBalancing(t *testing.T) {
+	t.Parallel()
+	const procedure = "/" + pingv1connect.PingServiceName + "/Ping"
+	// Each server reports its index in the response's Number and as its CPU
+	// utilization. Calls with the text "block" wait until release is closed.
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	newServer := func(t *testing.T, index int64) string {
+		t.Helper()
+		mux := http.NewServeMux()
+		mux.Handle(procedure, connect.NewUnaryHandler(
+			procedure,
+			func(ctx context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+				if request.Msg.Text == "block" {
+					started <- struct{}{}
+					<-release
+				}
+				response := connect.NewResponse(&pingv1.PingResponse{Number: index})
+				connect.SetLoadReport(response.Trailer(), &connect.LoadReport{CPUUtilization: float64(index)})
+				return response, nil
+			},
+		))
+		server := httptest.NewServer(mux)
+		t.Cleanup(server.Close)
+		return server.URL
+	}
+	urls := []string{newServer(t, 0), newServer(t, 1), newServer(t, 2)}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	unreachable := "http://" + listener.Addr().String()
+	assert.Nil(t, listener.Close())
+
+	ping := func(t *testing.T, client *connect.Client[pingv1.PingRequest, pingv1.PingResponse]) int64 {
+		t.Helper()
+		response, err := client.CallUnary(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Nil(t, err)
+		return response.Msg.Number
+	}
+	newClient := func(options ...connect.ClientOption) *connect.Client[pingv1.PingRequest, pingv1.PingResponse] {
+		// The URL's host is replaced by the chosen endpoint.
+		return connect.NewClient[pingv1.PingRequest, pingv1.PingResponse](
+			http.DefaultClient,
+			"http://ignored.invalid"+procedure,
+			options...,
+		)
+	}
+	t.Run("round_robin", func(t *testing.T) {
+		t.Parallel()
+		client := newClient(connect.WithLoadBalancing(connect.NewStaticResolver(urls...), nil))
+		var got []int64
+		for i := 0; i < 6; i++ {
+			got = append(got, ping(t, client))
+		}
+		assert.Equal(t, got, []int64{0, 1, 2, 0, 1, 2})
+	})
+	t.Run("pick_first", func(t *testing.T) {
+		t.Parallel()
+		client := newClient(connect.WithLoadBalancing(
+			connect.NewStaticResolver(unreachable, urls[1], urls[2]),
+			connect.NewPickFirstBalancer(),
+		))
+		// The first endpoint is unreachable, so the call fails and the
+		// endpoint is skipped until its backoff expires.
+		_, err := client.CallUnary(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+		assert.Equal(t, ping(t, client), int64(1))
+		assert.Equal(t, ping(t, client), int64(1))
+	})
+	t.Run("wait_for_ready", func(t *testing.T) {
+		t.Parallel()
+		// With wait-for-ready, failures to connect are retried on another
+		// endpoint.
+		client := newClient(
+			connect.WithLoadBalancing(connect.NewStaticResolver(unreachable, urls[2]), connect.NewPickFirstBalancer()),
+			connect.WithWaitForReady(),
+		)
+		assert.Equal(t, ping(t, client), int64(2))
+	})
+	t.Run("least_pending", func(t *testing.T) {
+		t.Parallel()
+		client := newClient(connect.WithLoadBalancing(
+			connect.NewStaticResolver(urls[0], urls[1]),
+			connect.NewLeastPendingBalancer(),
+		))
+		// While a call to one endpoint is in flight, calls go to the other.
+		blocked := make(chan int64, 1)
+		go func() {
+			response, err := client.CallUnary(context.Background(), connect.NewRequest(&pingv1.PingRequest{Text: "block"}))
+			assert.Nil(t, err)
+			blocked <- response.Msg.Number
+		}()
+		<-started
+		other := ping(t, client)
+		assert.Equal(t, ping(t, client), other)
+		assert.Equal(t, ping(t, client), other)
+		close(release)
+		assert.Equal(t, <-blocked, 1-other)
+	})
+	t.Run("load_reports", func(t *testing.T) {
+		t.Parallel()
+		for _, protocol := range []struct {
+			name    string
+			options []connect.ClientOption
+		}{
+			{name: "connect"},
+			{name: "grpc", options: []connect.ClientOption{connect.WithGRPC()}},
+		} {
+			protocol := protocol
+			t.Run(protocol.name, func(t *testing.T) {
+				t.Parallel()
+				balancer := &leastCPUBalancer{}
+				client := newClient(append(
+					protocol.options,
+					connect.WithLoadBalancing(connect.NewStaticResolver(urls[2], urls[1]), balancer),
+				)...)
+				// Once both endpoints have reported their load, calls go to
+				// the less loaded one.
+				assert.Equal(t, ping(t, client), int64(2))
+				assert.Equal(t, ping(t, client), int64(1))
+				assert.Equal(t, ping(t, client), int64(1))
+				assert.Equal(t, ping(t, client), int64(1))
+			})
+		}
+	})
+	t.Run("quarantine", func(t *testing.T) {
+		t.Parallel()
+		quarantine := connect.NewEndpointQuarantine(nil, 0)
+		client := newClient(
+			connect.WithLoadBalancing(connect.NewStaticResolver(urls[0], urls[1]), nil),
+			connect.WithEndpointQuarantine(quarantine),
+		)
+		quarantine.Quarantine(urls[0])
+		assert.True(t, quarantine.Quarantined(urls[0]))
+		assert.Equal(t, ping(t, client), int64(1))
+		assert.Equal(t, ping(t, client), int64(1))
+		quarantine.Quarantine(urls[1])
+		_, err := client.CallUnary(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+		quarantine.Readmit(urls[0])
+		assert.False(t, quarantine.Quarantined(urls[0]))
+		assert.Equal(t, ping(t, client), int64(0))
+		assert.Equal(t, ping(t, client), int64(0))
+	})
+	t.Run("quarantine_probe", func(t *testing.T) {
+		t.Parallel()
+		healthy := make(chan struct{})
+		quarantine := connect.NewEndpointQuarantine(func(ctx context.Context, url string) error {
+			assert.Equal(t, url, urls[0])
+			select {
+			case <-healthy:
+				return nil
+			default:
+				return errors.New("still deploying")
+			}
+		}, time.Millisecond)
+		client := newClient(
+			connect.WithLoadBalancing(connect.NewStaticResolver(urls[0], urls[1]), connect.NewPickFirstBalancer()),
+			connect.WithEndpointQuarantine(quarantine),
+		)
+		quarantine.Quarantine(urls[0])
+		assert.Equal(t, ping(t, client), int64(1))
+		close(healthy)
+		for quarantine.Quarantined(urls[0]) {
+			time.Sleep(time.Millisecond)
+		}
+		assert.Equal(t, ping(t, client), int64(0))
+	})
+	t.Run("quarantine_without_load_balancing", func(t *testing.T) {
+		t.Parallel()
+		client := newClient(connect.WithEndpointQuarantine(connect.NewEndpointQuarantine(nil, 0)))
+		_, err := client.CallUnary(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnknown)
+	})
+	t.Run("resolver_error", func(t *testing.T) {
+		t.Parallel()
+		client := newClient(connect.WithLoadBalancing(connect.NewStaticResolver(), nil))
+		_, err := client.CallUnary(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+	})
+}
+
+// leastCPUBalancer picks the endpoint with the lowest reported CPU
+// utilization, trying endpoints that haven't reported their load first.
+type leastCPUBalancer struct{}
+
+func (*leastCPUBalancer) Pick(endpoints []connect.Endpoint) int {
+	for i, endpoint := range endpoints {
+		if endpoint.Load == nil {
+			return i
+		}
+	}
+	best := 0
+	for i, endpoint := range endpoints {
+		if endpoint.Load.CPUUtilization < endpoints[best].Load.CPUUtilization {
+			best = i
+		}
+	}
+	return best
+}
@@ -0,0 +1,92 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/bufbuild/connect-go/internal/assert"
+)
+
+func TestLoadBalancerCanceledCalls(t *testing.T) {
+	t.Parallel()
+	const rawURL = "http://endpoint.invalid"
+	balancer := newLoadBalancer(NewStaticResolver(rawURL), nil)
+	reachable := true
+	client := &balancedClient{
+		next: httpClientFunc(func(request *http.Request) (*http.Response, error) {
+			if err := request.Context().Err(); err != nil {
+				return nil, err
+			}
+			if !reachable {
+				return nil, errors.New("connection refused")
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     make(http.Header),
+				Body:       io.NopCloser(strings.NewReader("")),
+			}, nil
+		}),
+		balancer:  balancer,
+		procedure: "/service/Method",
+	}
+	do := func(ctx context.Context) error {
+		request, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://ignored.invalid", nil)
+		assert.Nil(t, err)
+		response, err := client.Do(request)
+		if err != nil {
+			return err
+		}
+		return response.Body.Close()
+	}
+	unhealthy := func() bool {
+		balancer.mu.Lock()
+		defer balancer.mu.Unlock()
+		return !balancer.endpoints[rawURL].unhealthyUntil.IsZero()
+	}
+
+	reachable = false
+	assert.NotNil(t, do(context.Background()))
+	assert.True(t, unhealthy())
+	// Canceled calls say nothing about the endpoint, so they don't reset its
+	// health, whether they fail before or after the response arrives.
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.NotNil(t, do(canceled))
+	assert.True(t, unhealthy())
+	reachable = true
+	ctx, cancel := context.WithCancel(context.Background())
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://ignored.invalid", nil)
+	assert.Nil(t, err)
+	response, err := client.Do(request)
+	assert.Nil(t, err)
+	cancel()
+	assert.Nil(t, response.Body.Close())
+	assert.True(t, unhealthy())
+	// A call that reaches the endpoint makes it healthy again.
+	assert.Nil(t, do(context.Background()))
+	assert.False(t, unhealthy())
+}
+
+type httpClientFunc func(*http.Request) (*http.Response, error)
+
+func (f httpClientFunc) Do(request *http.Request) (*http.Response, error) {
+	return f(request)
+}
@@ -0,0 +1,545 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	longPollStreamHeader = "Connect-Poll-Stream"
+	longPollCursorHeader = "Connect-Poll-Cursor"
+	longPollStatusHeader = "Connect-Poll-Status"
+
+	longPollStatusMessage = "message" // the response carries the next message
+	longPollStatusPending = "pending" // no message arrived in time; poll again
+	longPollStatusDone    = "done"    // the stream ended successfully
+
+	defaultLongPollMaxWait     = 20 * time.Second
+	defaultLongPollRetention   = time.Minute
+	defaultLongPollMaxBuffered = 64
+)
+
+// LongPolling configures [WithLongPolling]. The zero value uses the defaults
+// described on each field.
+type LongPolling struct {
+	// MaxWait is how long a poll waits for the next message before returning
+	// a pending response. It should be shorter than the timeouts of any
+	// proxies between clients and the server. The default is 20 seconds.
+	MaxWait time.Duration
+	// Retention is how long a stream is kept between polls. Streams that
+	// aren't polled for this long are canceled, and their undelivered
+	// messages are discarded. The default is one minute.
+	Retention time.Duration
+	// MaxBuffered limits the number of undelivered messages buffered for each
+	// stream. Once the buffer is full, Send blocks until the client polls for
+	// more messages. The default is 64.
+	MaxBuffered int
+}
+
+// LongPollStream consumes a server streaming procedure with repeated unary
+// calls, for clients on networks that don't tolerate long-lived streaming
+// responses. The handler must be configured with [WithLongPolling]. Each poll
+// returns at most one message; the cursor and stream ID headers that tie the
+// polls together are managed automatically.
+//
+// LongPollStream has the same Receive/Msg/Err pattern as
+// [ServerStreamForClient]. It's not safe for concurrent use.
+type LongPollStream[Req, Res any] struct {
+	ctx     context.Context
+	client  *Client[Req, Res]
+	request *Request[Req]
+
+	streamID string
+	cursor   uint64
+	header   http.Header
+	trailer  http.Header
+	msg      *Res
+	done     bool
+	err      error
+}
+
+// NewLongPollStream starts consuming a server streaming procedure with
+// repeated unary calls made by client, which must be configured with the
+// procedure's URL. The request's headers are sent with every poll. No calls
+// are made until the first call to Receive.
+func NewLongPollStream[Req, Res any](
+	ctx context.Context,
+	client *Client[Req, Res],
+	request *Request[Req],
+) *LongPollStream[Req, Res] {
+	return &LongPollStream[Req, Res]{
+		ctx:     ctx,
+		client:  client,
+		request: request,
+		header:  make(http.Header),
+		trailer: make(http.Header),
+	}
+}
+
+// Receive polls until the next message is available, returning true. Once the
+// stream ends or a poll fails, Receive returns false, and Err reports any
+// error.
+func (s *LongPollStream[Req, Res]) Receive() bool {
+	if s.done || s.err != nil {
+		return false
+	}
+	for {
+		request := s.request
+		if s.streamID != "" {
+			// The handler only reads the first request message.
+			request = NewRequest(new(Req))
+			mergeHeaders(request.Header(), s.request.Header())
+			request.Header().Set(longPollStreamHeader, s.streamID)
+		} else {
+			request = NewRequest(s.request.Msg)
+			mergeHeaders(request.Header(), s.request.Header())
+		}
+		request.Header().Set(longPollCursorHeader, strconv.FormatUint(s.cursor, 10 /* base */))
+		response, err := s.client.CallUnary(s.ctx, request)
+		if err != nil {
+			s.err = err
+			return false
+		}
+		if s.streamID == "" {
+			s.streamID = response.Header().Get(longPollStreamHeader)
+		}
+		switch status := response.Header().Get(longPollStatusHeader); status {
+		case longPollStatusMessage:
+			mergeHeaders(s.header, response.Header())
+			s.msg = response.Msg
+			s.cursor++
+			return true
+		case longPollStatusPending:
+			continue
+		case longPollStatusDone:
+			mergeHeaders(s.header, response.Header())
+			mergeHeaders(s.trailer, response.Trailer())
+			s.done = true
+			return false
+		default:
+			s.err = errorf(CodeUnimplemented, "handler doesn't support long polling: unexpected %s %q", longPollStatusHeader, status)
+			return false
+		}
+	}
+}
+
+// Msg returns the most recent message unmarshaled by a call to Receive.
+func (s *LongPollStream[Req, Res]) Msg() *Res {
+	if s.msg == nil {
+		s.msg = new(Res)
+	}
+	return s.msg
+}
+
+// Err returns the first non-EOF error that was encountered by Receive.
+func (s *LongPollStream[Req, Res]) Err() error {
+	return s.err
+}
+
+// ResponseHeader returns the headers received from the server. Headers are
+// merged from every poll that returned a message.
+func (s *LongPollStream[Req, Res]) ResponseHeader() http.Header {
+	return s.header
+}
+
+// ResponseTrailer returns the trailers received from the server. Trailers
+// aren't populated until Receive returns false.
+func (s *LongPollStream[Req, Res]) ResponseTrailer() http.Header {
+	return s.trailer
+}
+
+// Close stops polling. The handler discards the stream once its retention
+// period elapses.
+func (s *LongPollStream[Req, Res]) Close() error {
+	s.done = true
+	return nil
+}
+
+// longPollHandler serves long polls of a server streaming procedure, which
+// are Connect unary requests carrying the cursor header. It's enabled with
+// WithLongPolling. Other Connect unary requests go to the fallback handler, if
+// there is one.
+type longPollHandler struct {
+	connectHandler
+
+	fallback protocolHandler
+}
+
+func newLongPollHandler(params *protocolHandlerParams, fallback protocolHandler) protocolHandler {
+	unaryParams := *params
+	unaryParams.Spec.StreamType = StreamTypeUnary
+	accept := make(map[string]struct{})
+	for _, name := range params.Codecs.Names() {
+		accept[connectUnaryContentTypePrefix+name] = struct{}{}
+	}
+	return &longPollHandler{
+		connectHandler: connectHandler{protocolHandlerParams: unaryParams, accept: accept},
+		fallback:       fallback,
+	}
+}
+
+func (h *longPollHandler) NewConn(
+	responseWriter http.ResponseWriter,
+	request *http.Request,
+) (handlerConnCloser, error) {
+	if !isLongPoll(request) {
+		if h.fallback != nil {
+			if _, ok := h.fallback.ContentTypes()[request.Header.Get(headerContentType)]; ok {
+				return h.fallback.NewConn(responseWriter, request)
+			}
+		}
+		conn, err := h.connectHandler.NewConn(responseWriter, request)
+		if err != nil {
+			return nil, err
+		}
+		pollErr := errorf(CodeInvalidArgument, "server streaming procedure requires a %s header", longPollCursorHeader)
+		_ = conn.Close(pollErr)
+		return nil, pollErr
+	}
+	return h.connectHandler.NewConn(responseWriter, request)
+}
+
+func isLongPoll(request *http.Request) bool {
+	return request.Header.Get(longPollCursorHeader) != ""
+}
+
+// longPoller runs the streams consumed by long polling and buffers their
+// messages until clients acknowledge them.
+type longPoller struct {
+	config      LongPolling
+	spec        Spec
+	newRequest  func() any
+	newResponse func() any
+	copyRequest func(dst, src any) error
+
+	mu       sync.Mutex
+	sessions map[string]*longPollSession
+}
+
+func newLongPoller(
+	config LongPolling,
+	spec Spec,
+	newRequest, newResponse func() any,
+	copyRequest func(dst, src any) error,
+) *longPoller {
+	if config.MaxWait <= 0 {
+		config.MaxWait = defaultLongPollMaxWait
+	}
+	if config.Retention <= 0 {
+		config.Retention = defaultLongPollRetention
+	}
+	if config.MaxBuffered <= 0 {
+		config.MaxBuffered = defaultLongPollMaxBuffered
+	}
+	return &longPoller{
+		config:      config,
+		spec:        spec,
+		newRequest:  newRequest,
+		newResponse: newResponse,
+		copyRequest: copyRequest,
+		sessions:    make(map[string]*longPollSession),
+	}
+}
+
+// serve answers a single poll. The first poll of a stream starts the
+// implementation in the background; the stream then outlives the request.
+func (p *longPoller) serve(ctx context.Context, conn StreamingHandlerConn, implementation StreamingHandlerFunc) error {
+	cursor, err := strconv.ParseUint(conn.RequestHeader().Get(longPollCursorHeader), 10 /* base */, 64 /* bitsize */)
+	if err != nil {
+		return errorf(CodeInvalidArgument, "invalid %s header: %w", longPollCursorHeader, err)
+	}
+	var session *longPollSession
+	if id := conn.RequestHeader().Get(longPollStreamHeader); id != "" {
+		session = p.get(id)
+		if session == nil {
+			return errorf(CodeNotFound, "long-poll stream %q expired or doesn't exist", id)
+		}
+	} else {
+		if cursor != 0 {
+			return errorf(CodeInvalidArgument, "new long-poll streams start at cursor 0, got %d", cursor)
+		}
+		request := p.newRequest()
+		if err := conn.Receive(request); err != nil {
+			return err
+		}
+		session = p.start(ctx, conn, request, implementation)
+	}
+	conn.ResponseHeader().Set(longPollStreamHeader, session.id)
+	result := session.poll(ctx, cursor, p.config.MaxWait)
+	mergeHeaders(conn.ResponseHeader(), result.header)
+	if result.err != nil {
+		return result.err
+	}
+	conn.ResponseHeader().Set(longPollStatusHeader, result.status)
+	switch result.status {
+	case longPollStatusMessage:
+		return conn.Send(result.msg)
+	case longPollStatusDone:
+		mergeHeaders(conn.ResponseTrailer(), result.trailer)
+	}
+	// Pending and done responses carry an empty message.
+	return conn.Send(p.newResponse())
+}
+
+func (p *longPoller) start(
+	ctx context.Context,
+	conn StreamingHandlerConn,
+	request any,
+	implementation StreamingHandlerFunc,
+) *longPollSession {
+	// The stream outlives the first poll, so it keeps the request's values but
+	// not its deadline or cancellation.
+	streamCtx, cancel := context.WithCancel(detachedContext{ctx})
+	session := &longPollSession{
+		id:          NewCallID(),
+		maxBuffered: p.config.MaxBuffered,
+		retention:   p.config.Retention,
+		cancel:      cancel,
+		changed:     make(chan struct{}),
+		header:      make(http.Header),
+		trailer:     make(http.Header),
+	}
+	session.expire = time.AfterFunc(p.config.Retention, func() {
+		p.expire(session)
+	})
+	p.mu.Lock()
+	p.sessions[session.id] = session
+	p.mu.Unlock()
+	streamConn := &longPollStreamConn{
+		ctx:           streamCtx,
+		session:       session,
+		spec:          p.spec,
+		peer:          conn.Peer(),
+		requestHeader: conn.RequestHeader().Clone(),
+		request:       request,
+		copyRequest:   p.copyRequest,
+	}
+	go func() {
+		session.finish(implementation(streamCtx, streamConn))
+	}()
+	return session
+}
+
+func (p *longPoller) get(id string) *longPollSession {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.sessions[id]
+}
+
+// expire discards an idle stream, unless a poll started since the retention
+// timer fired.
+func (p *longPoller) expire(session *longPollSession) {
+	session.mu.Lock()
+	polling := session.polling
+	session.mu.Unlock()
+	if polling > 0 {
+		return
+	}
+	p.mu.Lock()
+	delete(p.sessions, session.id)
+	p.mu.Unlock()
+	session.cancel()
+}
+
+// longPollSession buffers the messages of one stream.
+type longPollSession struct {
+	id          string
+	maxBuffered int
+	retention   time.Duration
+	cancel      context.CancelFunc
+	expire      *time.Timer
+
+	mu       sync.Mutex
+	changed  chan struct{} // closed and replaced when the session changes
+	polling  int
+	first    uint64 // cursor of messages[0]
+	messages []any
+	done     bool
+	err      error
+	header   http.Header
+	trailer  http.Header
+}
+
+type longPollResult struct {
+	status  string
+	msg     any
+	header  http.Header
+	trailer http.Header
+	err     error
+}
+
+// poll acknowledges the messages before cursor and waits up to maxWait for the
+// message at cursor. Polling the same cursor again returns the same message,
+// so clients can retry polls whose responses were lost.
+func (s *longPollSession) poll(ctx context.Context, cursor uint64, maxWait time.Duration) longPollResult {
+	s.mu.Lock()
+	s.polling++
+	s.expire.Stop()
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.polling--
+		if s.polling == 0 {
+			s.expire.Reset(s.retention)
+		}
+		s.mu.Unlock()
+	}()
+	timer := time.NewTimer(maxWait)
+	defer timer.Stop()
+	for {
+		s.mu.Lock()
+		if cursor < s.first || cursor > s.first+uint64(len(s.messages)) {
+			s.mu.Unlock()
+			return longPollResult{err: errorf(
+				CodeOutOfRange,
+				"cursor %d outside of buffered messages [%d, %d]", cursor, s.first, s.first+uint64(len(s.messages)),
+			)}
+		}
+		if acked := cursor - s.first; acked > 0 {
+			s.messages = s.messages[acked:]
+			s.first = cursor
+			s.notifyLocked()
+		}
+		if len(s.messages) > 0 {
+			result := longPollResult{status: longPollStatusMessage, msg: s.messages[0], header: s.header.Clone()}
+			s.mu.Unlock()
+			return result
+		}
+		if s.done {
+			result := longPollResult{status: longPollStatusDone, header: s.header.Clone(), trailer: s.trailer.Clone(), err: s.err}
+			s.mu.Unlock()
+			return result
+		}
+		changed := s.changed
+		s.mu.Unlock()
+		select {
+		case <-changed:
+		case <-timer.C:
+			return longPollResult{status: longPollStatusPending}
+		case <-ctx.Done():
+			return longPollResult{err: wrapIfContextDone(ctx, ctx.Err())}
+		}
+	}
+}
+
+// push buffers a message, waiting for space if the buffer is full.
+func (s *longPollSession) push(ctx context.Context, msg any) error {
+	s.mu.Lock()
+	for len(s.messages) >= s.maxBuffered {
+		changed := s.changed
+		s.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return wrapIfContextDone(ctx, ctx.Err())
+		}
+		s.mu.Lock()
+	}
+	s.messages = append(s.messages, msg)
+	s.notifyLocked()
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *longPollSession) finish(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.done = true
+	s.err = err
+	s.notifyLocked()
+}
+
+func (s *longPollSession) notifyLocked() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// longPollStreamConn is the StreamingHandlerConn used by the implementation
+// of a long-polled stream. Sent messages are buffered in the session.
+type longPollStreamConn struct {
+	ctx           context.Context
+	session       *longPollSession
+	spec          Spec
+	peer          Peer
+	requestHeader http.Header
+	request       any // nil once received
+	copyRequest   func(dst, src any) error
+}
+
+func (c *longPollStreamConn) Spec() Spec {
+	return c.spec
+}
+
+func (c *longPollStreamConn) Peer() Peer {
+	return c.peer
+}
+
+func (c *longPollStreamConn) Receive(msg any) error {
+	if c.request == nil {
+		return io.EOF
+	}
+	request := c.request
+	c.request = nil
+	return c.copyRequest(msg, request)
+}
+
+func (c *longPollStreamConn) RequestHeader() http.Header {
+	return c.requestHeader
+}
+
+func (c *longPollStreamConn) Send(msg any) error {
+	if protoMessage, ok := msg.(proto.Message); ok {
+		// Handlers may reuse messages after sending them.
+		msg = proto.Clone(protoMessage)
+	}
+	return c.session.push(c.ctx, msg)
+}
+
+func (c *longPollStreamConn) ResponseHeader() http.Header {
+	return c.session.header
+}
+
+func (c *longPollStreamConn) ResponseTrailer() http.Header {
+	return c.session.trailer
+}
+
+// copyMessage copies src into dst. Both must be *T.
+func copyMessage[T any](dst, src any) error {
+	typedDst, ok := dst.(*T)
+	if !ok {
+		return errorf(CodeInternal, "unexpected message type %T", dst)
+	}
+	typedSrc, ok := src.(*T)
+	if !ok {
+		return errorf(CodeInternal, "unexpected message type %T", src)
+	}
+	protoDst, isProto := dst.(proto.Message)
+	protoSrc, _ := src.(proto.Message)
+	if isProto && protoSrc != nil {
+		proto.Reset(protoDst)
+		proto.Merge(protoDst, protoSrc)
+		return nil
+	}
+	*typedDst = *typedSrc
+	return nil
+}
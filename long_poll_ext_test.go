@@ -0,0 +1,160 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	connect "github.com/bufbuild/connect-go"
+	"github.com/bufbuild/connect-go/internal/assert"
+	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
+	"github.com/bufbuild/connect-go/internal/gen/connect/ping/v1/pingv1connect"
+)
+
+func TestLongPolling(t *testing.T) {
+	t.Parallel()
+	const (
+		countUpProcedure = "/" + pingv1connect.PingServiceName + "/CountUp"
+		slowProcedure    = "/" + pingv1connect.PingServiceName + "/Slow"
+	)
+	polling := connect.WithLongPolling(connect.LongPolling{MaxWait: 10 * time.Millisecond, MaxBuffered: 2})
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}, polling, connect.WithJSONArrayStreaming()))
+	mux.Handle(slowProcedure, connect.NewServerStreamHandler(
+		slowProcedure,
+		func(ctx context.Context, request *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+			for i := int64(1); i <= request.Msg.Number; i++ {
+				// Outlast several polls before each message.
+				time.Sleep(50 * time.Millisecond)
+				if err := stream.Send(&pingv1.CountUpResponse{Number: i}); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		polling,
+	))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	receiveAll := func(t *testing.T, stream *connect.LongPollStream[pingv1.CountUpRequest, pingv1.CountUpResponse]) []int64 {
+		t.Helper()
+		var got []int64
+		for stream.Receive() {
+			got = append(got, stream.Msg().Number)
+		}
+		assert.Nil(t, stream.Close())
+		return got
+	}
+
+	for _, codec := range []struct {
+		name    string
+		options []connect.ClientOption
+	}{
+		{name: "proto"},
+		{name: "json", options: []connect.ClientOption{connect.WithProtoJSON()}},
+	} {
+		codec := codec
+		t.Run(codec.name, func(t *testing.T) {
+			t.Parallel()
+			client := connect.NewClient[pingv1.CountUpRequest, pingv1.CountUpResponse](
+				server.Client(),
+				server.URL+countUpProcedure,
+				codec.options...,
+			)
+			stream := connect.NewLongPollStream(
+				context.Background(),
+				client,
+				connect.NewRequest(&pingv1.CountUpRequest{Number: 5}),
+			)
+			assert.Equal(t, receiveAll(t, stream), []int64{1, 2, 3, 4, 5})
+			assert.Nil(t, stream.Err())
+			assert.Equal(t, stream.ResponseHeader().Get(handlerHeader), headerValue)
+			assert.Equal(t, stream.ResponseTrailer().Get(handlerTrailer), trailerValue)
+		})
+	}
+	t.Run("pending", func(t *testing.T) {
+		t.Parallel()
+		client := connect.NewClient[pingv1.CountUpRequest, pingv1.CountUpResponse](
+			server.Client(),
+			server.URL+slowProcedure,
+		)
+		stream := connect.NewLongPollStream(
+			context.Background(),
+			client,
+			connect.NewRequest(&pingv1.CountUpRequest{Number: 3}),
+		)
+		assert.Equal(t, receiveAll(t, stream), []int64{1, 2, 3})
+		assert.Nil(t, stream.Err())
+	})
+	t.Run("stream_error", func(t *testing.T) {
+		t.Parallel()
+		client := connect.NewClient[pingv1.CountUpRequest, pingv1.CountUpResponse](
+			server.Client(),
+			server.URL+countUpProcedure,
+		)
+		stream := connect.NewLongPollStream(
+			context.Background(),
+			client,
+			connect.NewRequest(&pingv1.CountUpRequest{}),
+		)
+		assert.Zero(t, len(receiveAll(t, stream)))
+		assert.Equal(t, connect.CodeOf(stream.Err()), connect.CodeInvalidArgument)
+	})
+	t.Run("unknown_stream", func(t *testing.T) {
+		t.Parallel()
+		client := connect.NewClient[pingv1.CountUpRequest, pingv1.CountUpResponse](
+			server.Client(),
+			server.URL+countUpProcedure,
+		)
+		request := connect.NewRequest(&pingv1.CountUpRequest{})
+		request.Header().Set("Connect-Poll-Stream", "unknown")
+		request.Header().Set("Connect-Poll-Cursor", "1")
+		_, err := client.CallUnary(context.Background(), request)
+		assert.Equal(t, connect.CodeOf(err), connect.CodeNotFound)
+	})
+	t.Run("missing_cursor", func(t *testing.T) {
+		t.Parallel()
+		client := connect.NewClient[pingv1.CountUpRequest, pingv1.CountUpResponse](
+			server.Client(),
+			server.URL+countUpProcedure,
+		)
+		_, err := client.CallUnary(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 1}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeInvalidArgument)
+	})
+	t.Run("json_array", func(t *testing.T) {
+		t.Parallel()
+		request, err := http.NewRequestWithContext(
+			context.Background(),
+			http.MethodPost,
+			server.URL+countUpProcedure,
+			strings.NewReader(`{"number": 2}`),
+		)
+		assert.Nil(t, err)
+		request.Header.Set("Content-Type", "application/json")
+		response, err := server.Client().Do(request)
+		assert.Nil(t, err)
+		body, err := io.ReadAll(response.Body)
+		assert.Nil(t, err)
+		assert.Nil(t, response.Body.Close())
+		assert.Equal(t, response.StatusCode, http.StatusOK)
+		assert.Equal(t, strings.ReplaceAll(string(body), " ", ""), `[{"number":"1"},{"number":"2"}]`)
+	})
+}
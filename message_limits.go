@@ -0,0 +1,123 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ResponseLimitBehavior controls what a client does with a unary response
+// message that exceeds its read limit. See [WithUnaryResponseLimitBehavior].
+type ResponseLimitBehavior uint8
+
+const (
+	// ResponseLimitDiscard reads over-limit responses to the end and discards
+	// them as they arrive, so they never occupy more than the read limit in
+	// memory. This is the default.
+	ResponseLimitDiscard ResponseLimitBehavior = iota
+	// ResponseLimitRetainPrefix discards over-limit responses like
+	// ResponseLimitDiscard, but keeps the first bytes of the message (up to
+	// the read limit) in the resulting [MessageTooLargeError]. It's useful for
+	// diagnosing unexpectedly large responses.
+	ResponseLimitRetainPrefix
+)
+
+// MessageTooLargeError is the underlying error of the [CodeResourceExhausted]
+// errors returned when a message exceeds a configured read limit. Use
+// [errors.As] to retrieve it from an [*Error].
+type MessageTooLargeError struct {
+	// Size is the number of bytes in the message, as received from the
+	// network or after decompression.
+	Size int64
+	// Max is the configured limit.
+	Max int64
+	// Prefix holds the first bytes of the message (as received from the
+	// network), if the client was configured with [ResponseLimitRetainPrefix].
+	Prefix []byte
+}
+
+func (e *MessageTooLargeError) Error() string {
+	return fmt.Sprintf("message size %d is larger than configured max %d", e.Size, e.Max)
+}
+
+func newMessageTooLargeError(size, max int64, prefix []byte) *Error {
+	return NewError(CodeResourceExhausted, &MessageTooLargeError{
+		Size:   size,
+		Max:    max,
+		Prefix: prefix,
+	})
+}
+
+// discardMessage drains the remaining size bytes of an over-limit message
+// from reader. If retain is positive, up to that many leading bytes are kept
+// and returned.
+func discardMessage(reader io.Reader, size int64, retain int) ([]byte, error) {
+	var prefix *bytes.Buffer
+	if retain > 0 {
+		prefix = bytes.NewBuffer(make([]byte, 0, retain))
+		copied, err := io.CopyN(prefix, reader, int64(retain))
+		size -= copied
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+	}
+	if _, err := io.CopyN(io.Discard, reader, size); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if prefix == nil {
+		return nil, nil
+	}
+	return prefix.Bytes(), nil
+}
+
+// headerFieldOverhead is the per-field overhead used to size header lists,
+// as defined for SETTINGS_MAX_HEADER_LIST_SIZE in RFC 9113.
+const headerFieldOverhead = 32
+
+// firstMessageMaxBytes returns the size limit for a message: firstMax for the
+// first message on a stream (if set), and max for all others.
+func firstMessageMaxBytes(afterFirst bool, firstMax, max int) int {
+	if !afterFirst && firstMax > 0 {
+		return firstMax
+	}
+	return max
+}
+
+// headerListSize estimates the size of a header list the way HTTP/2 does: the
+// length of each name and value, plus a fixed overhead per field.
+func headerListSize(header http.Header) int {
+	var size int
+	for key, values := range header {
+		for _, value := range values {
+			size += len(key) + len(value) + headerFieldOverhead
+		}
+	}
+	return size
+}
+
+// checkHeaderSize enforces the limit set with WithReadMaxHeaderBytes.
+func checkHeaderSize(header http.Header, max int) *Error {
+	if max <= 0 {
+		return nil
+	}
+	if size := headerListSize(header); size > max {
+		return errorf(CodeResourceExhausted, "header size %d is larger than configured max %d", size, max)
+	}
+	return nil
+}
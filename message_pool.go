@@ -0,0 +1,59 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// messagePool recycles request messages for unary handlers configured with
+// WithRequestMessagePooling. A nil pool allocates a new message every time.
+type messagePool[T any] struct {
+	pool sync.Pool
+}
+
+func newMessagePool[T any](enabled bool) *messagePool[T] {
+	if !enabled {
+		return nil
+	}
+	return &messagePool[T]{}
+}
+
+func (p *messagePool[T]) Get() *T {
+	if p == nil {
+		return new(T)
+	}
+	if msg, ok := p.pool.Get().(*T); ok {
+		return msg
+	}
+	return new(T)
+}
+
+// Put resets the message and returns it to the pool.
+func (p *messagePool[T]) Put(msg *T) {
+	if p == nil {
+		return
+	}
+	if protoMsg, ok := any(msg).(proto.Message); ok {
+		// Generated messages have unexported state that we shouldn't copy.
+		proto.Reset(protoMsg)
+	} else {
+		var zero T
+		*msg = zero
+	}
+	p.pool.Put(msg)
+}
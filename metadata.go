@@ -0,0 +1,73 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"net/http"
+)
+
+const (
+	// headerMessageMetadata announces that the sender understands
+	// per-message metadata envelopes. Clients set it on requests when
+	// WithMessageMetadata is enabled, and handlers echo it back when they've
+	// agreed to exchange metadata.
+	headerMessageMetadata  = "Connect-Message-Metadata"
+	messageMetadataVersion = "1"
+)
+
+// SendWithMetadata sends a message on a streaming connection, annotated with
+// metadata (for example, W3C trace context headers like Traceparent). The
+// connection is usually a StreamingClientConn or StreamingHandlerConn obtained
+// from a stream's Conn method.
+//
+// Metadata is only sent if both the client and handler have enabled
+// [WithMessageMetadata]. Otherwise, or if interceptors have wrapped the
+// connection, the metadata is silently dropped and the message is sent as
+// usual.
+func SendWithMetadata(conn interface{ Send(any) error }, msg any, metadata http.Header) error {
+	if conn, ok := conn.(messageMetadataConn); ok {
+		return conn.SendWithMetadata(msg, metadata)
+	}
+	return conn.Send(msg)
+}
+
+// ReceiveWithMetadata receives a message from a streaming connection, along
+// with any metadata the sender attached to it with [SendWithMetadata]. If the
+// message wasn't annotated or per-message metadata wasn't negotiated, the
+// returned metadata is nil.
+func ReceiveWithMetadata(conn interface{ Receive(any) error }, msg any) (http.Header, error) {
+	if conn, ok := conn.(messageMetadataConn); ok {
+		return conn.ReceiveWithMetadata(msg)
+	}
+	return nil, conn.Receive(msg)
+}
+
+// messageMetadataConn is implemented by the streaming connections that
+// support per-message metadata.
+type messageMetadataConn interface {
+	SendWithMetadata(any, http.Header) error
+	ReceiveWithMetadata(any) (http.Header, error)
+}
+
+// negotiateMessageMetadata reports whether a handler should exchange
+// per-message metadata with the client. If so, it acknowledges support in the
+// response headers.
+func negotiateMessageMetadata(enabled bool, requestHeader, responseHeader http.Header) bool {
+	if !enabled || requestHeader.Get(headerMessageMetadata) != messageMetadataVersion {
+		return false
+	}
+	responseHeader[headerMessageMetadata] = []string{messageMetadataVersion}
+	return true
+}
@@ -17,8 +17,14 @@ package connect
 import (
 	"compress/gzip"
 	"context"
+	"crypto/tls"
 	"io"
+	"net"
 	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
 )
 
 // A ClientOption configures a [Client].
@@ -62,6 +68,102 @@ func WithClientOptions(options ...ClientOption) ClientOption {
 	return &clientOptionsOption{options}
 }
 
+// WithConnect configures clients to use the Connect protocol. Since Connect is
+// the default, this option is only necessary to override an earlier [WithGRPC]
+// or [WithGRPCWeb] option (for example, one bundled into a shared set of
+// options).
+func WithConnect() ClientOption {
+	return &connectOption{}
+}
+
+// WithCancelGracePeriod controls what happens to in-flight calls when their
+// context is canceled or times out. By default, the client aborts the
+// underlying HTTP request immediately (resetting the HTTP/2 stream), so
+// blocked Send and Receive calls return promptly with CodeCanceled or
+// CodeDeadlineExceeded.
+//
+// With a positive grace period, the client instead stops sending, closes the
+// request stream, and keeps reading the response for up to the grace period
+// so that the server can flush its final messages and trailers. The request
+// is aborted once the grace period elapses or the caller closes the response,
+// whichever comes first. Since Receive keeps waiting for the server during
+// the grace period, callers should keep it short.
+func WithCancelGracePeriod(period time.Duration) ClientOption {
+	return &cancelGracePeriodOption{Period: period}
+}
+
+// WithTimeoutSkew shortens the timeout that clients send to servers by skew,
+// to account for the time the request spends in transit and any difference
+// between the client's and server's clocks. The server's deadline then
+// expires before the client's, so the server's response (usually an error
+// with CodeDeadlineExceeded) has time to reach the client. Timeouts are never
+// shortened to less than one millisecond.
+//
+// Handlers configured with [WithDeadlineReport] report how much of the
+// timeout they received, which helps to choose an appropriate skew.
+//
+// By default, clients send their full remaining timeout.
+func WithTimeoutSkew(skew time.Duration) ClientOption {
+	return &timeoutSkewOption{Skew: skew}
+}
+
+// WithDefaultCallTimeout sets the timeout for calls whose contexts don't have
+// a deadline, so that forgotten deadlines don't leave calls waiting forever.
+// It mirrors [WithDefaultTimeout] on handlers, but takes effect on the client:
+// the deadline is visible to interceptors and is sent to the server like any
+// other timeout. Calls whose contexts already have a deadline are unaffected,
+// even if that deadline is later than the default. For streaming calls, the
+// timeout covers the whole stream.
+//
+// By default, calls without a deadline run until they finish or their context
+// is canceled.
+func WithDefaultCallTimeout(timeout time.Duration) ClientOption {
+	return &defaultCallTimeoutOption{Timeout: timeout}
+}
+
+// WithWaitForReady makes calls wait for the server to become reachable,
+// rather than failing immediately with [CodeUnavailable] when the client
+// can't connect to it. This smooths over brief outages, like a deploy that
+// restarts the only server. While waiting, the client retries the connection
+// with exponential backoff until the call's context expires, so calls
+// without a deadline may wait indefinitely: pair this option with
+// [WithDefaultCallTimeout] or per-call deadlines.
+//
+// Only failures to connect are retried, since the request can't have reached
+// the server, so wait-for-ready is safe for streams and for procedures with
+// side effects. Individual calls can override this option with
+// [ContextWithWaitForReady].
+//
+// By default, calls fail as soon as the client can't connect.
+func WithWaitForReady() ClientOption {
+	return &waitForReadyOption{}
+}
+
+// WithLoadBalancing spreads calls across the servers supplied by the
+// resolver, so internal traffic doesn't need an external load balancer. The
+// balancer chooses the server for each call; if it's nil, clients use
+// [NewRoundRobinBalancer]. The URL passed to [NewClient] still names the
+// procedure, but its scheme and host are replaced by those of the chosen
+// server's base URL. For example:
+//
+//	connect.WithLoadBalancing(
+//		connect.NewStaticResolver("https://a.internal", "https://b.internal"),
+//		connect.NewLeastPendingBalancer(),
+//	)
+//
+// Clients track the health of each server: servers that can't be reached
+// are skipped for a backoff that grows with each consecutive failure. Pair
+// this option with [WithWaitForReady] to retry calls that fail to connect on
+// other servers, and with [WithEndpointQuarantine] to take servers out of
+// rotation explicitly. Clients constructed with the same option (for
+// example, all the clients in a generated service client) share the servers'
+// pending calls and health.
+//
+// By default, clients send every call to the URL passed to [NewClient].
+func WithLoadBalancing(resolver Resolver, balancer Balancer) ClientOption {
+	return &loadBalancingOption{balancer: newLoadBalancer(resolver, balancer)}
+}
+
 // WithGRPC configures clients to use the HTTP/2 gRPC protocol.
 func WithGRPC() ClientOption {
 	return &grpcOption{web: false}
@@ -72,13 +174,43 @@ func WithGRPCWeb() ClientOption {
 	return &grpcOption{web: true}
 }
 
+// WithHTTPGet configures clients using the Connect protocol to call unary
+// procedures that have no side effects with HTTP GET rather than POST, so
+// browsers, CDNs, and caching proxies can cache their responses. The request
+// message is encoded in the URL's query string, along with its codec and
+// compression. Codecs that implement [StableCodec] marshal messages
+// deterministically, so equal requests produce identical URLs.
+//
+// Procedures are marked as side-effect free with [WithIdempotency], which
+// generated code does automatically for methods with the
+// idempotency_level = NO_SIDE_EFFECTS option. Other procedures, streaming
+// procedures, the gRPC and gRPC-Web protocols, and clients that sign
+// requests with [WithAWSSigV4] always use POST, as do calls whose URL would
+// exceed the limit set by [WithHTTPGetMaxURLSize].
+//
+// By default, clients always use POST.
+func WithHTTPGet() ClientOption {
+	return &enableGetOption{}
+}
+
+// WithHTTPGetMaxURLSize limits the length of the URLs that clients configured
+// with [WithHTTPGet] generate. Requests whose URL, including the encoded
+// message, would be longer than bytes are sent with POST instead, since many
+// servers and proxies reject long URLs. A non-positive size removes the
+// limit.
+//
+// By default, URLs are limited to 8 KiB.
+func WithHTTPGetMaxURLSize(bytes int) ClientOption {
+	return &getMaxURLSizeOption{Max: bytes}
+}
+
 // WithProtoJSON configures a client to send JSON-encoded data instead of
 // binary Protobuf. It uses the standard Protobuf JSON mapping as implemented
 // by [google.golang.org/protobuf/encoding/protojson]: fields are named using
 // lowerCamelCase, zero values are omitted, missing required fields are errors,
 // enums are emitted as strings, etc.
 func WithProtoJSON() ClientOption {
-	return WithCodec(&protoJSONCodec{codecNameJSON})
+	return WithCodec(&protoJSONCodec{name: codecNameJSON})
 }
 
 // WithSendCompression configures the client to use the specified algorithm to
@@ -101,6 +233,310 @@ func WithSendGzip() ClientOption {
 	return WithSendCompression(compressionGzip)
 }
 
+// WithZstd makes Zstandard compression available, registered as "zstd".
+// Handlers accept zstd-compressed requests and compress responses with zstd
+// when clients prefer it, and clients ask for zstd-compressed responses. To
+// also compress requests with zstd, combine it with
+// WithSendCompression("zstd"). Zstandard usually compresses better than gzip
+// while using considerably less CPU, so it's a good choice for
+// high-throughput services. Compressed messages use windows of at most 8 MiB,
+// and larger windows are rejected, as RFC 9659 recommends.
+//
+// Handlers must also use WithZstd before clients send zstd-compressed
+// requests. By default, clients and handlers only support gzip.
+func WithZstd() Option {
+	return &compressionOption{
+		Name:            compressionZstd,
+		CompressionPool: newCompressionPool(newZstdDecompressor, newZstdCompressor),
+	}
+}
+
+// WithDialer configures the client to open connections with dial rather
+// than the dialer configured on its HTTP client's transport. It's useful for
+// custom service discovery, alternative DNS resolvers, and proxies. The
+// client's [Peer] reports the address of the connection actually used, so
+// errors can be attributed to individual backends behind a DNS name.
+//
+// WithDialer requires an [*http.Client] whose Transport is nil or an
+// [*http.Transport]; other HTTP clients cause calls to fail with CodeUnknown.
+// The transport is cloned with its DialContext replaced and its DialTLSContext
+// cleared, so connections aren't shared with other users of the original HTTP
+// client. Clients constructed with the same WithDialer option (for example, all
+// the clients in a generated service client) share the cloned transport and
+// its connection pool.
+//
+// By default, clients use the HTTP client's transport unmodified.
+func WithDialer(dial func(ctx context.Context, network, addr string) (net.Conn, error)) ClientOption {
+	return &dialerOption{Dial: dial, transports: make(map[*http.Transport]*http.Transport)}
+}
+
+// WithRetry retries unary calls that fail with retryable codes, following
+// the policy. Retries happen beneath the client's interceptors, so
+// interceptors see a single call, and every attempt shares the call's
+// deadline. Retries after the first carry a grpc-previous-rpc-attempts header
+// with the number of earlier attempts. Individual calls can override the
+// policy with [ContextWithRetryPolicy]. For example:
+//
+//	connect.WithRetry(connect.RetryPolicy{
+//		MaxAttempts:    4,
+//		InitialBackoff: 50 * time.Millisecond,
+//		RetryableCodes: []connect.Code{connect.CodeUnavailable, connect.CodeResourceExhausted},
+//	})
+//
+// Streaming calls aren't retried.
+//
+// By default, clients don't retry calls.
+func WithRetry(policy RetryPolicy) ClientOption {
+	return &retryOption{Retrier: newRetrier(policy)}
+}
+
+// WithTLSConfig configures the TLS settings the client uses to connect to its
+// server, such as trusted root CAs, client certificates for mutual TLS, the
+// minimum TLS version, and the server name used for SNI and certificate
+// verification. It lets clients for backends in different trust domains share
+// one HTTP client, instead of each needing its own. For example, to reach a
+// backend through an address that doesn't match its certificate:
+//
+//	connect.WithTLSConfig(&tls.Config{
+//		RootCAs:    internalCAs,
+//		ServerName: "billing.internal.example.com",
+//	})
+//
+// The config is cloned, so later changes to it have no effect. Like
+// [WithDialer], WithTLSConfig requires an [*http.Client] whose Transport is nil
+// or an [*http.Transport]; the transport is cloned with its TLSClientConfig
+// replaced and its DialTLSContext cleared. Clients constructed with the same
+// WithTLSConfig option share the cloned transport and its connection pool.
+//
+// By default, clients use the TLS configuration of their HTTP client's
+// transport.
+func WithTLSConfig(config *tls.Config) ClientOption {
+	option := &tlsConfigOption{transports: make(map[*http.Transport]*http.Transport)}
+	if config != nil {
+		option.Config = config.Clone()
+	}
+	return option
+}
+
+// WithHTTPStatusCodes customizes how the client interprets HTTP responses
+// that don't carry an RPC result, such as redirects and the non-standard
+// statuses used by some CDNs and load balancers (for example, 499 or the
+// 520-527 range). If mapping recognizes the status, the client returns an
+// error with the mapped code; otherwise, it uses the protocol's standard
+// mapping, which reports most unexpected statuses as CodeUnknown. Either way,
+// the error wraps an [*HTTPStatusError] with the original status.
+//
+// By default, [http.Client] follows redirects, so clients only see 3xx
+// responses if the HTTP client's CheckRedirect function returns
+// [http.ErrUseLastResponse].
+func WithHTTPStatusCodes(mapping func(status int) (code Code, ok bool)) ClientOption {
+	return &httpStatusCodesOption{Mapping: mapping}
+}
+
+// WithUnaryResponseLimitBehavior controls what clients do with unary
+// responses that exceed the limit set with [WithReadMaxBytes] (or
+// [WithFirstMessageReadMaxBytes]). By default, over-limit responses are
+// discarded as they're read, so they never occupy more than the limit in
+// memory. With [ResponseLimitRetainPrefix], clients also keep the first bytes
+// of the response for diagnostics.
+//
+// Either way, the call fails with [CodeResourceExhausted] and the error wraps
+// a [*MessageTooLargeError] reporting the response's actual size, which is
+// useful when tuning limits.
+func WithUnaryResponseLimitBehavior(behavior ResponseLimitBehavior) ClientOption {
+	return &unaryResponseLimitBehaviorOption{Behavior: behavior}
+}
+
+// WithAWSSigV4 configures clients to sign unary requests with AWS Signature
+// Version 4, so that they can call services fronted by Amazon API Gateway,
+// Lambda function URLs, or other endpoints that use IAM authorization. The
+// service and region are used to scope the signature: for example, API
+// Gateway expects the service "execute-api".
+//
+// Signatures cover the request's exact body, so they're only supported with
+// the Connect protocol, and streaming calls aren't signed. Using WithAWSSigV4
+// with [WithGRPC] or [WithGRPCWeb] is an error.
+func WithAWSSigV4(credentials AWSCredentialsFunc, service, region string) ClientOption {
+	return &awsSigV4Option{
+		Signer: &awsSigV4Signer{
+			credentials: credentials,
+			service:     service,
+			region:      region,
+			now:         time.Now,
+		},
+	}
+}
+
+// WithCallIDs assigns each call a unique ID, which handler implementations,
+// interceptors, and reporting hooks can retrieve with [CallIDFromContext] to
+// correlate their logs, metrics, and traces. The generate function must be
+// safe to call concurrently; if it's nil, IDs come from [NewCallID].
+//
+// Clients assign a new ID to every call, even calls made while handling
+// another call. To share IDs between clients and handlers, also use
+// [WithCallIDHeader].
+//
+// By default, calls don't have IDs.
+func WithCallIDs(generate func() string) Option {
+	return &callIDsOption{Generate: generate}
+}
+
+// WithRouteExtractor extracts routing metadata, such as a tenant ID or shard
+// key, from each call's request headers or message into a [RouteInfo].
+// Interceptors and implementations retrieve it with [RouteInfoFromContext].
+//
+// In clients, the route is extracted before the interceptors run, so it's
+// also visible in the context of the outbound HTTP request, where custom
+// transports and dialers configured with [WithDialer] can use it to pick a
+// backend. Streaming clients don't have a request message or headers when
+// the call starts, so they use the route set with [ContextWithRouteInfo].
+// Clients write the route to the extractor's headers, if they're configured
+// and not already set, so handlers and proxies see the same route. Clients
+// called while handling another call inherit its route unless the request
+// specifies a different one.
+//
+// By default, calls have no routing metadata.
+func WithRouteExtractor(extractor RouteExtractor) Option {
+	return &routeExtractorOption{Extractor: extractor}
+}
+
+// WithIdempotency declares the procedure's idempotency level, which is
+// available to interceptors in the [Spec]. Handlers for unary procedures
+// with [IdempotencyNoSideEffects] accept Connect protocol requests sent with
+// HTTP GET (or HEAD, which runs the RPC and drops the response body), and
+// clients configured with [WithHTTPGet] send them.
+//
+// Generated code sets this option from each method's idempotency_level, so
+// it's rarely necessary to use it directly.
+//
+// By default, the idempotency level is [IdempotencyUnknown].
+func WithIdempotency(level IdempotencyLevel) Option {
+	return &idempotencyOption{Level: level}
+}
+
+// WithStrictHeaders hardens clients and handlers against request smuggling
+// and header injection. Handlers reject requests with invalid header names or
+// values, pseudo-headers in the header block, malformed or conflicting
+// Content-Length values, Transfer-Encoding other than chunked, both
+// Content-Length and Transfer-Encoding, or connection-specific headers over
+// HTTP/2, responding with HTTP 400 before any interceptors or
+// implementations run.
+//
+// Both clients and handlers also sanitize metadata before writing it: they
+// drop fields with invalid or pseudo-header names, framing headers such as
+// Content-Length and Transfer-Encoding, and values containing control
+// characters. Without this option, net/http fails calls with such request
+// headers, and how it writes such response headers depends on the HTTP
+// version.
+//
+// By default, headers are passed to net/http as-is.
+func WithStrictHeaders() Option {
+	return &strictHeadersOption{}
+}
+
+// WithCallIDHeader propagates call IDs in the named header, so that clients and
+// handlers report the same ID for each call. It implies [WithCallIDs] with the
+// default generator, unless another generator is configured. Handlers echo the
+// ID in their response headers, and they only trust IDs of up to 128 printable
+// ASCII characters: other values are replaced with a newly generated ID.
+func WithCallIDHeader(header string) Option {
+	return &callIDHeaderOption{Header: header}
+}
+
+// WithSerializationTiming reports the time spent marshaling, unmarshaling,
+// compressing, and decompressing each message, which pinpoints whether a slow
+// call is waiting on the network or on serialization. The report function
+// receives the call's context, so it can attach timings to the active trace
+// span as events or record them alongside other per-call metrics. It's called
+// synchronously on the hot path and must be safe to call concurrently.
+//
+// By default, serialization isn't timed.
+func WithSerializationTiming(report func(context.Context, SerializationTiming)) Option {
+	return &serializationTimingOption{Report: report}
+}
+
+// WithMaxConcurrentCalls caps the number of in-flight calls, making
+// backpressure explicit rather than letting a burst of calls overwhelm the
+// server. Calls over the limit wait for a slot according to the queue policy;
+// calls that are rejected or time out while waiting fail with
+// [CodeResourceExhausted]. Unary calls hold their slot until they return, and
+// streaming calls hold theirs until the receive side of the stream is closed,
+// so streams must always be closed.
+//
+// Clients constructed with the same option share the limit, so a generated
+// service client limits calls across all of its procedures. If maxConcurrent
+// isn't positive, calls are never limited, which is the default.
+func WithMaxConcurrentCalls(maxConcurrent int, policy QueuePolicy) ClientOption {
+	return &maxConcurrentCallsOption{Limiter: newCallLimiter(maxConcurrent, policy)}
+}
+
+// WithReconnectOnDrain transparently reopens server streams closed by a
+// draining server (see [Drainer]), waiting for the delay the server requests
+// and then sending the original request again. Consumers see a single,
+// uninterrupted stream, so the server's procedure must be safe to restart: a
+// resumable subscription, for example, rather than a finite list. It gives up
+// after maxReconnects consecutive reconnects that don't receive a message,
+// and then returns the server's [CodeUnavailable] error.
+//
+// By default, streams aren't reopened.
+func WithReconnectOnDrain(maxReconnects int) ClientOption {
+	return &reconnectOnDrainOption{MaxReconnects: maxReconnects}
+}
+
+// WithSingleFlight coalesces concurrent identical unary calls into a single
+// network request, and gives each caller its own copy of the response. This
+// avoids duplicate load when many callers ask for the same thing at once, as
+// in a cache stampede. Calls are identical if they have the same procedure,
+// request message (compared with [DigestRequest]), and request headers.
+// Headers that identify individual calls are ignored: the call ID header set
+// by [WithCallIDHeader] and the W3C Traceparent and Tracestate headers.
+// Callers that join an in-flight call receive its response headers.
+//
+// Callers that join an in-flight call don't make their own request, so
+// WithSingleFlight must only be used for idempotent procedures without side
+// effects. If the in-flight call is canceled or times out, callers whose own
+// contexts are still live retry independently.
+//
+// By default, every call makes its own request.
+func WithSingleFlight() ClientOption {
+	return &singleFlightOption{}
+}
+
+// WithProgress reports the progress of unary calls as their request and
+// response bodies are transferred, so that applications can display upload
+// and download progress for large messages without switching to streaming
+// RPCs. The callback runs synchronously on the goroutine sending or receiving
+// the body, so it should return quickly.
+//
+// Requests are reported in chunks of 16KiB as the HTTP client consumes them,
+// and responses as they're read. Streaming calls aren't reported, since each
+// message is usually small. By default, progress isn't reported.
+func WithProgress(report func(Progress)) ClientOption {
+	return &progressOption{Report: report}
+}
+
+// WithCodedErrors guarantees that every error returned by the client's
+// methods, and by the streams it opens, is a [*Error]. Context cancellations
+// and timeouts are wrapped with [CodeCanceled] and [CodeDeadlineExceeded], and
+// other errors, like those returned by interceptors, are wrapped with
+// [CodeUnknown]. Callers can then use a type assertion instead of [errors.As].
+// The only exception is the [io.EOF] that streams use to signal their end.
+//
+// Errors created by connect-go itself, including errors from the transport,
+// already have codes. By default, errors returned by interceptors are passed
+// through unchanged.
+func WithCodedErrors() ClientOption {
+	return &codedErrorsOption{}
+}
+
+// WithPayloadSigner configures clients to sign the request message of every
+// unary call with the supplied [PayloadSigner], which sees the message's exact
+// wire bytes and attaches the signature as request headers. Streaming calls
+// aren't signed.
+func WithPayloadSigner(sign PayloadSigner) ClientOption {
+	return &payloadSignerOption{Sign: sign}
+}
+
 // A HandlerOption configures a [Handler].
 //
 // In addition to any options grouped in the documentation below, remember that
@@ -130,6 +566,110 @@ func WithCompression(
 	}
 }
 
+// WithErrorFormatter registers a custom serializer for the error bodies of
+// Connect unary responses. When a client's Accept header names the content
+// type, the handler uses the formatter instead of the standard Connect JSON
+// and sets the response's Content-Type accordingly. This lets REST consumers
+// of Connect JSON endpoints receive errors in their house style. For example,
+// to support RFC 7807 problem details:
+//
+//	connect.WithErrorFormatter(connect.ProblemJSONContentType, connect.FormatProblemJSON)
+//
+// Repeated options register formatters for additional content types. The
+// gRPC and gRPC-Web protocols, and Connect streaming responses, always use
+// their standard error formats, as do Connect clients. By default, no custom
+// formatters are registered.
+func WithErrorFormatter(contentType string, format ErrorFormatter) HandlerOption {
+	return &errorFormatterOption{ContentType: contentType, Format: format}
+}
+
+// WithGRPCStatusInErrors adds the serialized google.rpc.Status to the JSON
+// error bodies of Connect unary responses, in a "grpcStatus" field holding
+// the unpadded base64 encoding of the binary message. The status is the same
+// one that gRPC and gRPC-Web responses carry in the grpc-status-details-bin
+// trailer, so clients that normalize errors on google.rpc.Status can decode
+// it without special-casing the Connect protocol. Connect clients ignore the
+// field, and custom formatters registered with WithErrorFormatter take
+// precedence over it. By default, Connect unary error bodies don't include
+// the status.
+func WithGRPCStatusInErrors() HandlerOption {
+	return &grpcStatusInErrorsOption{}
+}
+
+// WithDebugEcho attaches diagnostic headers to responses, to ease debugging
+// in the field. When a request has a Connect-Debug header and the echo's
+// Authorize function approves it, the response headers describe the protocol
+// (Connect-Debug-Protocol), codec (Connect-Debug-Codec), and request
+// compression (Connect-Debug-Compression) the handler chose, along with the
+// configured version (Connect-Debug-Version). The handler's processing time is
+// sent as the Connect-Debug-Processing-Time trailer.
+//
+// Since the headers reveal details of the deployment, Authorize should only
+// approve trusted callers: for example, requests from an internal network or
+// with an operator's credentials. By default, no diagnostic headers are sent.
+func WithDebugEcho(echo DebugEcho) HandlerOption {
+	return &debugEchoOption{Echo: echo}
+}
+
+// WithErrorRedaction hides the internals of unexpected errors from clients.
+// Errors matching the policy are sent with their code and metadata, but their
+// messages are replaced and only approved details are kept. This keeps stack
+// traces, SQL, and similar content away from untrusted clients, while
+// [Handler.ServeConnectHTTP] and interceptors still see the original error.
+// For example, to redact internal errors in production:
+//
+//	connect.WithErrorRedaction(connect.ErrorRedactionPolicy{Message: "internal error"})
+//
+// By default, errors are sent unchanged.
+func WithErrorRedaction(policy ErrorRedactionPolicy) HandlerOption {
+	return &errorRedactionOption{Policy: policy}
+}
+
+// WithJSONArrayStreaming is an experimental option that also exposes server
+// streaming procedures as Connect unary JSON endpoints, for REST clients that
+// can't consume the enveloped streaming format. Requests with a Content-Type
+// of application/json get a response that's a JSON array of the streamed
+// messages, sent in chunks as the handler produces them.
+//
+// Errors returned before the first message is sent use the usual Connect
+// unary status codes and JSON bodies. Once the array has started, the status
+// can't change, so a failing handler leaves the array unterminated; clients
+// should treat malformed JSON as a failed call. Responses aren't compressed,
+// and the option has no effect on other stream types or if the Connect
+// protocol or JSON codec is disabled.
+func WithJSONArrayStreaming() HandlerOption {
+	return &jsonArrayStreamingOption{}
+}
+
+// WithHandlerProtocols restricts handlers to the named RPC protocols: any of
+// [ProtocolConnect], [ProtocolGRPC], and [ProtocolGRPCWeb]. Requests using
+// other protocols are rejected with an HTTP 415 Unsupported Media Type, just
+// like requests with an unknown Content-Type. For example, gRPC-only
+// deployments may use WithHandlerProtocols(ProtocolGRPC) to disable the Connect
+// and gRPC-Web protocols.
+//
+// By default, handlers support all three protocols. Unknown protocol names are
+// ignored, and if none of the names are known, the option has no effect.
+func WithHandlerProtocols(protocols ...string) HandlerOption {
+	return &handlerProtocolsOption{Protocols: protocols}
+}
+
+// WithCORS lets browsers call the handler from web pages served by other
+// origins (for example, "https://app.example.com"). Handlers answer CORS
+// preflight requests themselves, allowing POST requests with the headers used
+// by the Connect and gRPC-Web protocols plus any headers the browser asks
+// for, and expose the protocols' response headers. The origin "*" allows any
+// origin.
+//
+// Preflight requests from other origins are rejected with an HTTP 403
+// Forbidden. Applications with more complex needs, like credentialed requests
+// or per-procedure policies, should use a dedicated CORS middleware instead.
+//
+// By default, handlers don't answer preflight requests or set CORS headers.
+func WithCORS(origins ...string) HandlerOption {
+	return &corsOption{Origins: origins}
+}
+
 // WithHandlerOptions composes multiple HandlerOptions into one.
 func WithHandlerOptions(options ...HandlerOption) HandlerOption {
 	return &handlerOptionsOption{options}
@@ -153,6 +693,361 @@ func WithRecover(handle func(context.Context, Spec, http.Header, any) error) Han
 	return WithInterceptors(&recoverHandlerInterceptor{handle: handle})
 }
 
+// WithAuditLog writes an [AuditRecord] to the sink for every call the handler
+// serves, for deployments that must keep a tamper-evident record of who
+// called what and when. Audit records are separate from debug logging: they
+// have a fixed structure and are chained together by their hashes.
+//
+// The named request fields, using their Protobuf names, are included in each
+// record; for streaming calls, they're taken from the first request message.
+// Handlers constructed with the same option, like all the handlers of a
+// generated service, share a single chain. The audit interceptor observes
+// errors from interceptors registered after it, so it should usually be the
+// first.
+func WithAuditLog(sink AuditSink, fields ...string) HandlerOption {
+	return WithInterceptors(&auditInterceptor{log: newAuditLog(sink, fields)})
+}
+
+// WithClientCancelCode changes the code handlers report when the client
+// cancels an RPC. By default, handlers report [CodeCanceled], which
+// distinguishes clients giving up from handlers running out of time. Services
+// that account for client cancellations in their latency SLOs may prefer to
+// report [CodeDeadlineExceeded] instead.
+//
+// Interceptors see the chosen code, so it flows into logs and metrics; the
+// client has already gone away and won't see it.
+func WithClientCancelCode(code Code) HandlerOption {
+	return &clientCancelCodeOption{Code: code}
+}
+
+// WithDrainer lets a [Drainer] close the handler's streams when the server
+// shuts down, asking clients to reconnect elsewhere. Unary calls aren't
+// affected.
+//
+// By default, handlers don't drain streams.
+func WithDrainer(drainer *Drainer) HandlerOption {
+	return &drainerOption{Drainer: drainer}
+}
+
+// WithDisconnectPolicy controls what happens when a client disconnects while
+// the handler is still running. A grace period keeps the handler's context
+// alive so that non-idempotent operations can finish rather than being
+// abandoned halfway, and a notification hook lets handlers record the
+// disconnect. The client has gone away, so whatever the handler returns is
+// discarded.
+//
+// By default, the handler's context is canceled as soon as the client
+// disconnects.
+func WithDisconnectPolicy(policy DisconnectPolicy) HandlerOption {
+	return &disconnectPolicyOption{Policy: policy}
+}
+
+// WithMaxTimeout limits how long handlers run. Clients can propagate
+// arbitrarily long timeouts with the grpc-timeout and Connect-Timeout-Ms
+// headers, which lets them pin streams open for weeks. If the client's timeout
+// is longer than max, or the client didn't send a timeout at all, the
+// handler's context expires after max instead.
+//
+// By default, handlers use the client's timeout (if any) as-is.
+func WithMaxTimeout(max time.Duration) HandlerOption {
+	return &maxTimeoutOption{Max: max}
+}
+
+// WithMaxDeadlineExtension allows handlers to push back the deadlines of
+// long-running calls with [ExtendDeadline], by at most max in total. It's
+// useful for jobs whose duration is only known after reading the request.
+// Calls without a deadline can't be extended, since they don't expire.
+//
+// By default, deadlines can't be extended.
+func WithMaxDeadlineExtension(max time.Duration) HandlerOption {
+	return &maxDeadlineExtensionOption{Max: max}
+}
+
+// WithRequestMessagePooling is an experimental option that recycles the
+// request messages of unary handlers, reducing allocations and garbage
+// collection work for services that decode large numbers of small messages.
+// Each message is reset and returned to a pool once the response has been
+// sent.
+//
+// Implementations and interceptors must not retain the request message (or
+// any of its fields) after the call returns, including in goroutines they
+// start. Because Protobuf messages drop their nested fields when reset, only
+// the top-level message is reused.
+//
+// By default, request messages aren't pooled.
+func WithRequestMessagePooling() HandlerOption {
+	return &requestMessagePoolingOption{}
+}
+
+// WithDefaultTimeout sets the timeout for calls whose clients didn't send one,
+// so handlers aren't at the mercy of clients that never set deadlines. Unlike
+// [WithMaxTimeout], it doesn't shorten timeouts that clients do send, so
+// handlers can pair a short default with a longer maximum: clients that
+// don't care get the default, and clients that need more time can ask for up
+// to the maximum. If the default is longer than the maximum, the maximum
+// applies.
+//
+// Generated constructors share options across a whole service, so use
+// [WithProcedureOptions] to set a different default for one procedure.
+//
+// By default, handlers run without a deadline unless the client sends one.
+func WithDefaultTimeout(timeout time.Duration) HandlerOption {
+	return &defaultTimeoutOption{Timeout: timeout}
+}
+
+// WithMinTimeout rejects calls whose timeouts are too short for the handler to
+// do useful work. If the client's timeout is shorter than min, the handler
+// responds with CodeInvalidArgument without running the implementation. Calls
+// without timeouts are unaffected.
+//
+// By default, handlers accept any timeout.
+func WithMinTimeout(min time.Duration) HandlerOption {
+	return &minTimeoutOption{Min: min}
+}
+
+// WithTimeoutHeader makes Connect handlers also honor the timeout in an
+// additional request header, easing migration from RPC frameworks that
+// encoded deadlines differently. The header's Precedence decides what happens
+// when a request also has a Connect-Timeout-Ms header. Requests with invalid
+// values fail with CodeInvalidArgument, and the resulting timeout is subject
+// to [WithMinTimeout] and [WithMaxTimeout] as usual. The gRPC and gRPC-Web
+// protocols only use grpc-timeout.
+//
+// By default, Connect handlers only honor Connect-Timeout-Ms.
+func WithTimeoutHeader(header TimeoutHeader) HandlerOption {
+	return &timeoutHeaderOption{Header: header}
+}
+
+// WithDeadlineMargin reserves part of each RPC's deadline for the handler
+// itself. The handler's context keeps the deadline derived from the client's
+// timeout, but outbound calls made with it (or with contexts derived from it)
+// send timeouts shortened by margin, so downstream services time out with
+// enough time left for this handler to respond to its client. The budget
+// reported by [RemainingBudget] excludes the margin.
+//
+// By default, handlers don't reserve any margin.
+func WithDeadlineMargin(margin time.Duration) HandlerOption {
+	return &deadlineMarginOption{Margin: margin}
+}
+
+// WithDeadlineReport makes handlers report the remaining time before the
+// call's deadline, as seen by the handler when the call arrives, in the
+// "Deadline-Remaining-Ms" response header. Clients can compare the reported
+// value with the timeout they sent, using [ReportedDeadline], to estimate
+// transit time and calibrate [WithTimeoutSkew]. Calls without deadlines don't
+// get the header.
+//
+// By default, handlers don't report their deadlines.
+func WithDeadlineReport() HandlerOption {
+	return &deadlineReportOption{}
+}
+
+// WithLenientRequestEncoding makes handlers tolerate API gateways and proxies
+// that transparently decompress Connect unary request bodies but leave the
+// HTTP-standard Content-Encoding header in place. If a request body can't be
+// decompressed with the algorithm named in Content-Encoding, the handler
+// unmarshals it as-is instead of rejecting the request. Streaming requests
+// compress each message individually, so intermediaries can't decompress them
+// and they're unaffected.
+//
+// By default, handlers reject request bodies that can't be decompressed.
+func WithLenientRequestEncoding() HandlerOption {
+	return &lenientRequestEncodingOption{}
+}
+
+// WithAuthVerifiers configures the handler to verify each request's transport
+// credentials before running the implementation. The verifiers are tried in
+// order, and the first verified identity is available to interceptors and the
+// implementation as [Peer.AuthInfo]. Requests that fail verification are
+// rejected. Repeated WithAuthVerifiers options append to the list of
+// verifiers.
+//
+// For example, to accept identities from mutual TLS and fall back to a custom
+// header scheme:
+//
+//	connect.WithAuthVerifiers(connect.VerifyTLS, verifyAPIKey)
+//
+// By default, handlers don't verify credentials and Peer.AuthInfo is nil.
+func WithAuthVerifiers(verifiers ...AuthVerifier) HandlerOption {
+	return &authVerifiersOption{Verifiers: verifiers}
+}
+
+// WithCompressionStatsTrailers configures the handler to report how
+// compression affected the size of the messages it sent, which helps with
+// capacity planning and with verifying that compression settings actually
+// help. The algorithm and the total sizes before and after compression are
+// sent as response trailers; clients can parse them with
+// [CompressionStatsFromTrailer].
+//
+// Statistics are available for gRPC and gRPC-Web responses and for Connect
+// streaming responses. Connect unary responses send their trailers before the
+// body, so they never include statistics. By default, no statistics are sent.
+func WithCompressionStatsTrailers() HandlerOption {
+	return &compressionStatsTrailersOption{}
+}
+
+// WithRuntimeLimits makes handlers read limits from a [RuntimeLimits] handle
+// at the start of every call, so the limits can be changed without restarting
+// the server:
+//
+//	limits := connect.NewRuntimeLimits(connect.CallPolicy{ReadMaxBytes: 4 * 1024 * 1024})
+//	handler := connect.NewUnaryHandler(procedure, fn, connect.WithRuntimeLimits(limits))
+//	// During an incident:
+//	limits.Store(connect.CallPolicy{ReadMaxBytes: 64 * 1024, Timeout: time.Second})
+//
+// The limits override the handler's read and send limits, may shorten the
+// call's timeout or disable response compression, and may reject calls with
+// CodeResourceExhausted, just like the policies returned by the resolver
+// configured with [WithPolicyResolver]. If a handler has both, the stricter
+// of the two settings applies to each call.
+//
+// By default, handler limits are fixed when the handler is constructed.
+func WithRuntimeLimits(limits *RuntimeLimits) HandlerOption {
+	return &runtimeLimitsOption{Limits: limits}
+}
+
+// WithPolicyResolver applies per-call limits, such as per-tenant quotas.
+// Before running the implementation, the handler calls resolve with the
+// call's context, [Spec], and [Peer]; tenants are usually identified from
+// values that authentication middleware stored in the context. The returned
+// [CallPolicy] overrides the handler's read and send limits, may shorten the
+// call's timeout or disable response compression, and may reject the call
+// with CodeResourceExhausted. The resolve function must be safe to call
+// concurrently.
+//
+// By default, all calls use the handler's configuration.
+func WithPolicyResolver(resolve func(ctx context.Context, spec Spec, peer Peer) CallPolicy) HandlerOption {
+	return &policyResolverOption{Resolve: resolve}
+}
+
+// WithPayloadVerifier configures unary handlers to verify each request
+// message with the supplied [PayloadVerifier] before decompressing and
+// unmarshaling it. Requests that fail verification never reach interceptors
+// or the handler implementation. Streaming handlers don't verify messages, so
+// services that mix unary and streaming procedures should authenticate their
+// streams some other way.
+func WithPayloadVerifier(verify PayloadVerifier) HandlerOption {
+	return &payloadVerifierOption{Verify: verify}
+}
+
+// WithSlowRequestThreshold reports RPCs that take longer than threshold. If an
+// RPC is still running once threshold has elapsed, the handler calls report
+// with the RPC's context, [Spec], [Peer], the time elapsed, and the
+// [SlowRequestStage] the RPC is stuck in. Since report is called while the RPC
+// is running, stuck streams are detected as they happen rather than when they
+// finish. Each RPC is reported at most once. The report function is called on
+// a separate goroutine, so it must be safe to call concurrently.
+//
+// By default, handlers don't track slow RPCs.
+func WithSlowRequestThreshold(
+	threshold time.Duration,
+	report func(ctx context.Context, spec Spec, peer Peer, elapsed time.Duration, stage SlowRequestStage),
+) HandlerOption {
+	return &slowRequestThresholdOption{Threshold: threshold, Report: report}
+}
+
+// WithUnknownFieldsReporter detects clients using newer schemas than the
+// handler. Whenever the handler receives a Protobuf request message with
+// unknown fields (including in nested messages), it calls report with the
+// number of unknown fields found. The report function must be safe to call
+// concurrently, and it should be cheap: it's called inline with Receive.
+//
+// Unknown field detection is implemented as an interceptor, so it only sees
+// the messages that reach it. By default, handlers don't look for unknown
+// fields.
+func WithUnknownFieldsReporter(report func(ctx context.Context, spec Spec, count int)) HandlerOption {
+	return WithInterceptors(&unknownFieldsInterceptor{report: report})
+}
+
+// WithUnknownFieldsHeader adds a Connect-Unknown-Fields response header
+// reporting the number of unknown fields in the request messages, letting
+// clients detect that the handler is using an older schema. The header is
+// omitted if there aren't any unknown fields. Since streaming handlers send
+// headers with their first response, the count only includes messages
+// received before then.
+//
+// By default, handlers don't look for unknown fields.
+func WithUnknownFieldsHeader() HandlerOption {
+	return WithInterceptors(&unknownFieldsInterceptor{setHeader: true})
+}
+
+// WithLongPolling lets clients consume a server streaming procedure with
+// repeated unary polls, for networks whose proxies and middleboxes kill
+// long-lived streaming responses. The first poll starts the stream in the
+// background. The handler buffers messages until the client's next poll
+// acknowledges them, and each poll returns the next message or, after
+// config.MaxWait, an empty response asking the client to poll again. Clients
+// use [NewLongPollStream] to manage polls.
+//
+// Polls are Connect unary requests, so interceptors only see the stream
+// itself, which runs with the first poll's context values and headers but
+// without its deadline. Streams that clients stop polling are canceled after
+// config.Retention.
+//
+// By default, server streaming procedures can't be long-polled. This option
+// has no effect on unary, client streaming, or bidirectional streaming
+// handlers, or on handlers that don't support the Connect protocol.
+func WithLongPolling(config LongPolling) HandlerOption {
+	return &longPollingOption{Config: config}
+}
+
+// WithFlushThreshold makes streaming handlers batch small messages: rather
+// than flushing the response after every message, handlers flush once at
+// least bytes have been written since the last flush. Anything left is flushed
+// when the call ends. Batching trades latency for fewer, larger writes.
+//
+// Like [WithImmediateFlush], this option also sets the "X-Accel-Buffering: no"
+// response header, so that nginx and compatible reverse proxies pass flushed
+// data to the client instead of buffering the entire response.
+//
+// By default, streaming handlers flush after every message. This option has
+// no effect on unary handlers.
+func WithFlushThreshold(bytes int) HandlerOption {
+	return &flushPolicyOption{Policy: &flushPolicy{threshold: bytes}}
+}
+
+// WithImmediateFlush makes streaming handlers flush the response after every
+// message, undoing [WithFlushThreshold], and sets the "X-Accel-Buffering: no"
+// response header. Use it for servers behind reverse proxies that otherwise
+// buffer streaming responses until they end, delaying every message.
+//
+// By default, streaming handlers flush after every message but don't set the
+// header. This option has no effect on unary handlers.
+func WithImmediateFlush() HandlerOption {
+	return &flushPolicyOption{Policy: &flushPolicy{}}
+}
+
+// WithServerStreamCache caches the responses of a server streaming procedure.
+// The first time the handler sees a request, it records the response headers,
+// messages, and trailers sent by the implementation. For the following ttl,
+// identical requests are served by replaying the recording without calling
+// the implementation. Requests are identical if their digests, computed with
+// [DigestRequest], match; request headers aren't considered. Failed calls
+// aren't cached, and neither are responses with messages sent by
+// [SendWithMetadata] or [SendWithEnvelopeFlags].
+//
+// Caching is only safe for deterministic procedures whose responses don't
+// depend on the caller, such as expensive exports and listings of public data.
+// Interceptors still run on every call. Recorded responses are held in memory,
+// within the limits set by [WithServerStreamCacheLimits].
+//
+// By default, responses aren't cached. This option has no effect on unary,
+// client streaming, or bidirectional streaming handlers.
+func WithServerStreamCache(ttl time.Duration) HandlerOption {
+	return &serverStreamCacheOption{TTL: ttl}
+}
+
+// WithServerStreamCacheLimits bounds the memory used by
+// [WithServerStreamCache]. Once the cache is full, the least recently used
+// responses are evicted, and responses too large to cache are served without
+// being recorded.
+//
+// By default, the cache uses the defaults described on
+// [ServerStreamCacheLimits].
+func WithServerStreamCacheLimits(limits ServerStreamCacheLimits) HandlerOption {
+	return &serverStreamCacheLimitsOption{Limits: limits}
+}
+
 // Option implements both [ClientOption] and [HandlerOption], so it can be
 // applied both client-side and server-side.
 type Option interface {
@@ -178,6 +1073,47 @@ func WithCodec(codec Codec) Option {
 	return &codecOption{Codec: codec}
 }
 
+// WithProtoUnmarshalOptions configures how the default Protobuf binary and
+// JSON codecs unmarshal messages. Services using extensions or google.protobuf.Any
+// fields with a custom type registry can supply a Resolver, and services that
+// shouldn't retain unknown fields can set DiscardUnknown. The JSON codec uses
+// the Resolver only if it also implements protoregistry.MessageTypeResolver,
+// as *protoregistry.Types does, and ignores the options that don't apply to
+// JSON.
+//
+// Codecs registered with [WithCodec] under names other than the defaults are
+// unaffected. By default, the Protobuf codecs use the zero value of
+// [proto.UnmarshalOptions].
+func WithProtoUnmarshalOptions(options proto.UnmarshalOptions) Option {
+	return &protoUnmarshalOptionsOption{Options: options}
+}
+
+// WithTypeResolver configures the registry used to look up Protobuf types that
+// aren't known statically: the messages packed into google.protobuf.Any
+// fields and extensions. Clients use it to unmarshal the values of
+// [ErrorDetail]s, and both clients and handlers use it in the default Protobuf
+// binary and JSON codecs. This lets detail and Any types compiled into
+// separate modules, or loaded dynamically, resolve correctly.
+//
+// A Resolver supplied with [WithProtoUnmarshalOptions] takes precedence for
+// unmarshaling messages. By default, the Protobuf runtime's package-global
+// registry is used.
+func WithTypeResolver(resolver TypeResolver) Option {
+	return &typeResolverOption{Resolver: resolver}
+}
+
+// WithHeaderMergePolicy configures how headers and trailers set on a [Request]
+// or [Response] are merged with those already set on the stream. Handlers
+// apply the policy to the headers and trailers of responses returned by unary
+// and client streaming implementations, and clients apply it to the headers of
+// server streaming requests.
+//
+// By default, values are appended, so setting the same key in more than one
+// place sends duplicate values. See also [SetHeaderOnce].
+func WithHeaderMergePolicy(policy HeaderMergePolicy) Option {
+	return &headerMergePolicyOption{Policy: policy}
+}
+
 // WithCompressMinBytes sets a minimum size threshold for compression:
 // regardless of compressor configuration, messages smaller than the configured
 // minimum are sent uncompressed.
@@ -189,6 +1125,27 @@ func WithCompressMinBytes(min int) Option {
 	return &compressMinBytesOption{Min: min}
 }
 
+// WithCodecCompressMinBytes overrides the threshold set with
+// [WithCompressMinBytes] for messages marshaled with the named codec. Since
+// text formats like JSON compress well even at small sizes, it often makes
+// sense to use a lower threshold for them than for binary Protobuf.
+//
+// Calling WithCodecCompressMinBytes more than once for the same codec uses the
+// last threshold.
+func WithCodecCompressMinBytes(codec string, min int) Option {
+	return &codecCompressMinBytesOption{Codec: codec, Min: min}
+}
+
+// WithCompressionPolicy decides whether to compress each outbound message
+// with a callback, which may take the RPC's Spec, the codec, and the message's
+// size into account. The policy takes precedence over thresholds set with
+// [WithCompressMinBytes] and [WithCodecCompressMinBytes]. It's only consulted
+// once the peers have agreed on a compression algorithm, and it must be safe
+// to call concurrently.
+func WithCompressionPolicy(policy CompressionPolicy) Option {
+	return &compressionPolicyOption{Policy: policy}
+}
+
 // WithReadMaxBytes limits the performance impact of pathologically large
 // messages sent by the other party. For handlers, WithReadMaxBytes limits the size
 // of a message that the client can send. For clients, WithReadMaxBytes limits the
@@ -206,6 +1163,55 @@ func WithReadMaxBytes(max int) Option {
 	return &readMaxBytesOption{Max: max}
 }
 
+// WithInitialBufferSize sets the capacity, in bytes, of newly allocated
+// buffers for reading and writing messages. Buffers grow as needed, so a size
+// close to that of typical messages avoids repeated growth without wasting
+// memory. Values less than one restore the default of 512 bytes.
+func WithInitialBufferSize(size int) Option {
+	return &initialBufferSizeOption{Size: size}
+}
+
+// WithMaxRecycleBufferSize sets the largest buffer capacity, in bytes, that is
+// returned to the pool for reuse. Larger buffers are left for the garbage
+// collector, so that a rare large message doesn't pin its memory
+// indefinitely. Raise the limit if large messages are common. Values less
+// than one restore the default of 8 MiB.
+func WithMaxRecycleBufferSize(size int) Option {
+	return &maxRecycleBufferSizeOption{Size: size}
+}
+
+// WithBufferPoolStats records buffer pool hits, misses, and discards in stats.
+// By default, pool statistics aren't recorded.
+func WithBufferPoolStats(stats *BufferPoolStats) Option {
+	return &bufferPoolStatsOption{Stats: stats}
+}
+
+// WithFirstMessageReadMaxBytes limits the size of the first message read on
+// each call, overriding [WithReadMaxBytes] for that message only. It's useful
+// for streams that start with a large setup message followed by many small
+// messages (or the reverse), since a single limit must accommodate the largest
+// message. For unary calls, it applies to the only message.
+//
+// By default, the first message has the same limit as the rest.
+func WithFirstMessageReadMaxBytes(max int) Option {
+	return &firstMessageReadMaxBytesOption{Max: max}
+}
+
+// WithReadMaxHeaderBytes limits the total size of the headers sent by the
+// other party: for handlers, the request headers, and for clients, the
+// response headers. Sizes are calculated as in HTTP/2: the length of each
+// name and value, plus 32 bytes per field. Calls whose headers are too large
+// fail with [CodeResourceExhausted].
+//
+// The limit is enforced after net/http has read the headers, so it's a
+// per-procedure complement to http.Server's MaxHeaderBytes and
+// http.Transport's MaxResponseHeaderBytes, not a replacement.
+//
+// By default, header size isn't limited.
+func WithReadMaxHeaderBytes(max int) Option {
+	return &readMaxHeaderBytesOption{Max: max}
+}
+
 // WithSendMaxBytes prevents sending messages too large for the client/handler
 // to handle without significant performance overhead. For handlers, WithSendMaxBytes
 // limits the size of a message that the handler can respond with. For clients,
@@ -218,6 +1224,84 @@ func WithSendMaxBytes(max int) Option {
 	return &sendMaxBytesOption{Max: max}
 }
 
+// WithFirstMessageSendMaxBytes limits the size of the first message sent on
+// each call, overriding [WithSendMaxBytes] for that message only. For unary
+// calls, it applies to the only message.
+//
+// By default, the first message has the same limit as the rest.
+func WithFirstMessageSendMaxBytes(max int) Option {
+	return &firstMessageSendMaxBytesOption{Max: max}
+}
+
+// WithMessageMetadata enables per-message metadata on streaming RPCs, which
+// lets each message carry its own small set of headers: for example, W3C trace
+// context for tracing individual messages in a long-lived stream. Use
+// [SendWithMetadata] and [ReceiveWithMetadata] to attach and read metadata.
+//
+// Metadata is framed as a separate envelope, with a reserved flag, immediately
+// preceding the message it annotates. Clients announce support with a request
+// header, and handlers only send metadata to clients that have announced
+// support. Because peers that don't understand the reserved flag reject the
+// stream, clients should only enable WithMessageMetadata when calling
+// handlers that also enable it.
+//
+// By default, per-message metadata is disabled.
+func WithMessageMetadata() Option {
+	return &messageMetadataOption{}
+}
+
+// WithEnvelopeFlags registers experimental envelope flags for streaming RPCs.
+// Each flag names one of the reserved bits in the prefix of every streaming
+// message, so that experimental features (for example, per-message checksums,
+// priorities, or compression choices) can mark individual messages without
+// changing the framing code. Use [SendWithEnvelopeFlags] and
+// [ReceiveWithEnvelopeFlags] to set and read flags.
+//
+// Clients announce their flags with a request header, and handlers
+// acknowledge the flags they've also registered with the same bit. Only
+// acknowledged flags are ever set on the wire. Because handlers reject
+// messages with unnegotiated flags, clients should only set flags after
+// checking that the handler acknowledged them, or when they know the handler
+// has registered them.
+//
+// If any flag is invalid, clients and handlers fail every call with
+// CodeUnknown. Repeated calls add to the registered flags, and later flags
+// replace earlier ones with the same name or bit.
+func WithEnvelopeFlags(flags ...EnvelopeFlag) Option {
+	return &envelopeFlagsOption{Flags: flags}
+}
+
+// WithResponseValidation validates response messages that implement a
+// Validate() error method, like those generated by protoc-gen-validate.
+// Handlers validate each response before sending it, and clients validate
+// each response as it's received. Invalid responses are reported as errors
+// with [CodeInternal], since they violate the API contract.
+//
+// Response validation is implemented as an interceptor, so its position
+// relative to other interceptors follows the order of options. Messages
+// without a Validate method are never rejected. By default, responses aren't
+// validated.
+func WithResponseValidation() Option {
+	return WithInterceptors(&responseValidationInterceptor{})
+}
+
+// WithInitializer configures a function that prepares each received message
+// before it's unmarshaled. The function is called with the RPC's [Spec] and a
+// pointer to the message, so applications can pre-populate defaults or
+// allocate nested fields from a pool or arena. Initialization errors that
+// aren't already [*Error]s are reported with [CodeInternal].
+//
+// When an initializer is configured, the default protobuf binary and JSON
+// codecs merge the received message into the initialized one, so fields the
+// initializer set are kept unless the sender set them too. Other codecs that
+// reset messages before unmarshaling discard any fields the initializer set.
+//
+// The initializer runs before any interceptor sees the message. By default,
+// messages are unmarshaled without initialization.
+func WithInitializer(initializer func(spec Spec, message any) error) Option {
+	return &initializerOption{Initializer: initializer}
+}
+
 // WithInterceptors configures a client or handler's interceptor stack. Repeated
 // WithInterceptors options are applied in order, so
 //
@@ -274,9 +1358,102 @@ func WithOptions(options ...Option) Option {
 	return &optionsOption{options}
 }
 
-type clientOptionsOption struct {
-	options []ClientOption
-}
+// WithProcedureOptions applies options only to clients and handlers for the
+// named procedure (for example, "/acme.foo.v1.FooService/Bar"). It's useful
+// for per-procedure overrides when the same options are shared across a whole
+// service, as they are by generated constructors:
+//
+//	connect.WithOptions(
+//		connect.WithReadMaxBytes(64*1024),
+//		connect.WithProcedureOptions(
+//			"/acme.foo.v1.FooService/Upload",
+//			connect.WithReadMaxBytes(16*1024*1024),
+//		),
+//	)
+//
+// Handler-only options, such as [WithDefaultTimeout], are accepted too;
+// clients ignore them. Options apply in order, so overrides should follow the
+// defaults they replace.
+func WithProcedureOptions(procedure string, options ...HandlerOption) Option {
+	return &procedureOptionsOption{
+		Procedure: extractProtoPath(procedure),
+		Options:   options,
+	}
+}
+
+type cancelGracePeriodOption struct {
+	Period time.Duration
+}
+
+func (o *cancelGracePeriodOption) applyToClient(config *clientConfig) {
+	config.CancelGracePeriod = o.Period
+}
+
+type timeoutSkewOption struct {
+	Skew time.Duration
+}
+
+func (o *timeoutSkewOption) applyToClient(config *clientConfig) {
+	config.TimeoutSkew = o.Skew
+}
+
+type loadBalancingOption struct {
+	balancer *loadBalancer
+}
+
+func (o *loadBalancingOption) applyToClient(config *clientConfig) {
+	config.LoadBalancer = o.balancer
+}
+
+type endpointQuarantineOption struct {
+	Quarantine *EndpointQuarantine
+}
+
+func (o *endpointQuarantineOption) applyToClient(config *clientConfig) {
+	config.EndpointQuarantine = o.Quarantine
+}
+
+type waitForReadyOption struct{}
+
+func (o *waitForReadyOption) applyToClient(config *clientConfig) {
+	config.WaitForReady = true
+}
+
+type defaultCallTimeoutOption struct {
+	Timeout time.Duration
+}
+
+func (o *defaultCallTimeoutOption) applyToClient(config *clientConfig) {
+	config.DefaultCallTimeout = o.Timeout
+}
+
+type unaryResponseLimitBehaviorOption struct {
+	Behavior ResponseLimitBehavior
+}
+
+func (o *unaryResponseLimitBehaviorOption) applyToClient(config *clientConfig) {
+	config.UnaryResponseLimitBehavior = o.Behavior
+}
+
+type awsSigV4Option struct {
+	Signer *awsSigV4Signer
+}
+
+func (o *awsSigV4Option) applyToClient(config *clientConfig) {
+	config.AWSSigV4 = o.Signer
+}
+
+type payloadSignerOption struct {
+	Sign PayloadSigner
+}
+
+func (o *payloadSignerOption) applyToClient(config *clientConfig) {
+	config.PayloadSigner = o.Sign
+}
+
+type clientOptionsOption struct {
+	options []ClientOption
+}
 
 func (o *clientOptionsOption) applyToClient(config *clientConfig) {
 	for _, option := range o.options {
@@ -335,6 +1512,44 @@ func (o *compressionOption) applyToHandler(config *handlerConfig) {
 	config.CompressionNames = append(config.CompressionNames, o.Name)
 }
 
+type protoUnmarshalOptionsOption struct {
+	Options proto.UnmarshalOptions
+}
+
+func (o *protoUnmarshalOptionsOption) applyToClient(config *clientConfig) {
+	options := o.Options
+	config.ProtoUnmarshalOptions = &options
+}
+
+func (o *protoUnmarshalOptionsOption) applyToHandler(config *handlerConfig) {
+	options := o.Options
+	config.ProtoUnmarshalOptions = &options
+}
+
+type typeResolverOption struct {
+	Resolver TypeResolver
+}
+
+func (o *typeResolverOption) applyToClient(config *clientConfig) {
+	config.TypeResolver = o.Resolver
+}
+
+func (o *typeResolverOption) applyToHandler(config *handlerConfig) {
+	config.TypeResolver = o.Resolver
+}
+
+type headerMergePolicyOption struct {
+	Policy HeaderMergePolicy
+}
+
+func (o *headerMergePolicyOption) applyToClient(config *clientConfig) {
+	config.HeaderMergePolicy = o.Policy
+}
+
+func (o *headerMergePolicyOption) applyToHandler(config *handlerConfig) {
+	config.HeaderMergePolicy = o.Policy
+}
+
 type compressMinBytesOption struct {
 	Min int
 }
@@ -347,6 +1562,98 @@ func (o *compressMinBytesOption) applyToHandler(config *handlerConfig) {
 	config.CompressMinBytes = o.Min
 }
 
+type codecCompressMinBytesOption struct {
+	Codec string
+	Min   int
+}
+
+func (o *codecCompressMinBytesOption) applyToClient(config *clientConfig) {
+	if config.CodecCompressMinBytes == nil {
+		config.CodecCompressMinBytes = make(map[string]int)
+	}
+	config.CodecCompressMinBytes[o.Codec] = o.Min
+}
+
+func (o *codecCompressMinBytesOption) applyToHandler(config *handlerConfig) {
+	if config.CodecCompressMinBytes == nil {
+		config.CodecCompressMinBytes = make(map[string]int)
+	}
+	config.CodecCompressMinBytes[o.Codec] = o.Min
+}
+
+type compressionPolicyOption struct {
+	Policy CompressionPolicy
+}
+
+func (o *compressionPolicyOption) applyToClient(config *clientConfig) {
+	config.CompressionPolicy = o.Policy
+}
+
+func (o *compressionPolicyOption) applyToHandler(config *handlerConfig) {
+	config.CompressionPolicy = o.Policy
+}
+
+type firstMessageReadMaxBytesOption struct {
+	Max int
+}
+
+func (o *firstMessageReadMaxBytesOption) applyToClient(config *clientConfig) {
+	config.FirstReadMaxBytes = o.Max
+}
+
+func (o *firstMessageReadMaxBytesOption) applyToHandler(config *handlerConfig) {
+	config.FirstReadMaxBytes = o.Max
+}
+
+type firstMessageSendMaxBytesOption struct {
+	Max int
+}
+
+func (o *firstMessageSendMaxBytesOption) applyToClient(config *clientConfig) {
+	config.FirstSendMaxBytes = o.Max
+}
+
+func (o *firstMessageSendMaxBytesOption) applyToHandler(config *handlerConfig) {
+	config.FirstSendMaxBytes = o.Max
+}
+
+type readMaxHeaderBytesOption struct {
+	Max int
+}
+
+func (o *readMaxHeaderBytesOption) applyToClient(config *clientConfig) {
+	config.ReadMaxHeaderBytes = o.Max
+}
+
+func (o *readMaxHeaderBytesOption) applyToHandler(config *handlerConfig) {
+	config.ReadMaxHeaderBytes = o.Max
+}
+
+type procedureOptionsOption struct {
+	Procedure string
+	Options   []HandlerOption
+}
+
+func (o *procedureOptionsOption) applyToClient(config *clientConfig) {
+	if config.Procedure != o.Procedure {
+		return
+	}
+	for _, option := range o.Options {
+		if clientOption, ok := option.(ClientOption); ok {
+			clientOption.applyToClient(config)
+		}
+	}
+}
+
+func (o *procedureOptionsOption) applyToHandler(config *handlerConfig) {
+	if config.Procedure != o.Procedure {
+		return
+	}
+	for _, option := range o.Options {
+		option.applyToHandler(config)
+	}
+}
+
 type readMaxBytesOption struct {
 	Max int
 }
@@ -359,6 +1666,68 @@ func (o *readMaxBytesOption) applyToHandler(config *handlerConfig) {
 	config.ReadMaxBytes = o.Max
 }
 
+type initialBufferSizeOption struct {
+	Size int
+}
+
+func (o *initialBufferSizeOption) applyToClient(config *clientConfig) {
+	o.apply(config.BufferPool)
+}
+
+func (o *initialBufferSizeOption) applyToHandler(config *handlerConfig) {
+	o.apply(config.BufferPool)
+}
+
+func (o *initialBufferSizeOption) apply(pool *bufferPool) {
+	pool.initialSize = o.Size
+	if pool.initialSize < 1 {
+		pool.initialSize = initialBufferSize
+	}
+}
+
+type maxRecycleBufferSizeOption struct {
+	Size int
+}
+
+func (o *maxRecycleBufferSizeOption) applyToClient(config *clientConfig) {
+	o.apply(config.BufferPool)
+}
+
+func (o *maxRecycleBufferSizeOption) applyToHandler(config *handlerConfig) {
+	o.apply(config.BufferPool)
+}
+
+func (o *maxRecycleBufferSizeOption) apply(pool *bufferPool) {
+	pool.maxRecycleSize = o.Size
+	if pool.maxRecycleSize < 1 {
+		pool.maxRecycleSize = maxRecycleBufferSize
+	}
+}
+
+type bufferPoolStatsOption struct {
+	Stats *BufferPoolStats
+}
+
+func (o *bufferPoolStatsOption) applyToClient(config *clientConfig) {
+	config.BufferPool.stats = o.Stats
+}
+
+func (o *bufferPoolStatsOption) applyToHandler(config *handlerConfig) {
+	config.BufferPool.stats = o.Stats
+}
+
+type initializerOption struct {
+	Initializer func(Spec, any) error
+}
+
+func (o *initializerOption) applyToClient(config *clientConfig) {
+	config.Initializer = o.Initializer
+}
+
+func (o *initializerOption) applyToHandler(config *handlerConfig) {
+	config.Initializer = o.Initializer
+}
+
 type sendMaxBytesOption struct {
 	Max int
 }
@@ -371,6 +1740,295 @@ func (o *sendMaxBytesOption) applyToHandler(config *handlerConfig) {
 	config.SendMaxBytes = o.Max
 }
 
+type drainerOption struct {
+	Drainer *Drainer
+}
+
+func (o *drainerOption) applyToHandler(config *handlerConfig) {
+	config.Drainer = o.Drainer
+}
+
+type disconnectPolicyOption struct {
+	Policy DisconnectPolicy
+}
+
+func (o *disconnectPolicyOption) applyToHandler(config *handlerConfig) {
+	policy := o.Policy
+	config.DisconnectPolicy = &policy
+}
+
+type clientCancelCodeOption struct {
+	Code Code
+}
+
+func (o *clientCancelCodeOption) applyToHandler(config *handlerConfig) {
+	config.ClientCancelCode = o.Code
+}
+
+type defaultTimeoutOption struct {
+	Timeout time.Duration
+}
+
+func (o *defaultTimeoutOption) applyToHandler(config *handlerConfig) {
+	config.DefaultTimeout = o.Timeout
+}
+
+type maxTimeoutOption struct {
+	Max time.Duration
+}
+
+func (o *maxTimeoutOption) applyToHandler(config *handlerConfig) {
+	config.MaxTimeout = o.Max
+}
+
+type minTimeoutOption struct {
+	Min time.Duration
+}
+
+func (o *minTimeoutOption) applyToHandler(config *handlerConfig) {
+	config.MinTimeout = o.Min
+}
+
+type deadlineMarginOption struct {
+	Margin time.Duration
+}
+
+func (o *deadlineMarginOption) applyToHandler(config *handlerConfig) {
+	config.DeadlineMargin = o.Margin
+}
+
+type deadlineReportOption struct{}
+
+func (o *deadlineReportOption) applyToHandler(config *handlerConfig) {
+	config.ReportDeadline = true
+}
+
+type lenientRequestEncodingOption struct{}
+
+func (o *lenientRequestEncodingOption) applyToHandler(config *handlerConfig) {
+	config.LenientRequestEncoding = true
+}
+
+type authVerifiersOption struct {
+	Verifiers []AuthVerifier
+}
+
+func (o *authVerifiersOption) applyToHandler(config *handlerConfig) {
+	config.AuthVerifiers = append(config.AuthVerifiers, o.Verifiers...)
+}
+
+type compressionStatsTrailersOption struct{}
+
+func (o *compressionStatsTrailersOption) applyToHandler(config *handlerConfig) {
+	config.CompressionStatsTrailers = true
+}
+
+type maxDeadlineExtensionOption struct {
+	Max time.Duration
+}
+
+func (o *maxDeadlineExtensionOption) applyToHandler(config *handlerConfig) {
+	config.MaxDeadlineExtension = o.Max
+}
+
+type policyResolverOption struct {
+	Resolve func(context.Context, Spec, Peer) CallPolicy
+}
+
+func (o *policyResolverOption) applyToHandler(config *handlerConfig) {
+	config.PolicyResolver = o.Resolve
+}
+
+type runtimeLimitsOption struct {
+	Limits *RuntimeLimits
+}
+
+func (o *runtimeLimitsOption) applyToHandler(config *handlerConfig) {
+	config.RuntimeLimits = o.Limits
+}
+
+type payloadVerifierOption struct {
+	Verify PayloadVerifier
+}
+
+func (o *payloadVerifierOption) applyToHandler(config *handlerConfig) {
+	config.PayloadVerifier = o.Verify
+}
+
+type slowRequestThresholdOption struct {
+	Threshold time.Duration
+	Report    func(context.Context, Spec, Peer, time.Duration, SlowRequestStage)
+}
+
+func (o *slowRequestThresholdOption) applyToHandler(config *handlerConfig) {
+	config.SlowRequestThreshold = o.Threshold
+	config.SlowRequestReport = o.Report
+}
+
+type longPollingOption struct {
+	Config LongPolling
+}
+
+func (o *longPollingOption) applyToHandler(config *handlerConfig) {
+	config.LongPolling = &o.Config
+}
+
+type flushPolicyOption struct {
+	Policy *flushPolicy
+}
+
+func (o *flushPolicyOption) applyToHandler(config *handlerConfig) {
+	config.FlushPolicy = o.Policy
+}
+
+type serverStreamCacheOption struct {
+	TTL time.Duration
+}
+
+func (o *serverStreamCacheOption) applyToHandler(config *handlerConfig) {
+	config.ServerStreamCacheTTL = o.TTL
+}
+
+type serverStreamCacheLimitsOption struct {
+	Limits ServerStreamCacheLimits
+}
+
+func (o *serverStreamCacheLimitsOption) applyToHandler(config *handlerConfig) {
+	config.ServerStreamCacheLimits = o.Limits
+}
+
+type messageMetadataOption struct{}
+
+func (o *messageMetadataOption) applyToClient(config *clientConfig) {
+	config.MessageMetadata = true
+}
+
+func (o *messageMetadataOption) applyToHandler(config *handlerConfig) {
+	config.MessageMetadata = true
+}
+
+type envelopeFlagsOption struct {
+	Flags []EnvelopeFlag
+}
+
+func (o *envelopeFlagsOption) applyToClient(config *clientConfig) {
+	for _, flag := range o.Flags {
+		if err := flag.validate(); err != nil && config.InitErr == nil {
+			config.InitErr = NewError(CodeUnknown, err)
+		}
+	}
+	config.EnvelopeFlags = append(config.EnvelopeFlags, o.Flags...)
+}
+
+func (o *envelopeFlagsOption) applyToHandler(config *handlerConfig) {
+	for _, flag := range o.Flags {
+		if err := flag.validate(); err != nil && config.InitErr == nil {
+			config.InitErr = NewError(CodeUnknown, err)
+		}
+	}
+	config.EnvelopeFlags = append(config.EnvelopeFlags, o.Flags...)
+}
+
+type requestMessagePoolingOption struct{}
+
+func (o *requestMessagePoolingOption) applyToHandler(config *handlerConfig) {
+	config.RequestMessagePooling = true
+}
+
+type prioritySchedulerOption struct {
+	Scheduler *PriorityScheduler
+}
+
+func (o *prioritySchedulerOption) applyToHandler(config *handlerConfig) {
+	config.PriorityScheduler = o.Scheduler
+}
+
+type peerLimiterOption struct {
+	Limiter *PeerLimiter
+}
+
+func (o *peerLimiterOption) applyToHandler(config *handlerConfig) {
+	config.PeerLimiter = o.Limiter
+}
+
+// clientInitErrorOption fails client construction, for options that can't be
+// applied.
+type clientInitErrorOption struct {
+	Err *Error
+}
+
+func (o *clientInitErrorOption) applyToClient(config *clientConfig) {
+	if config.InitErr == nil {
+		config.InitErr = o.Err
+	}
+}
+
+type errorFormatterOption struct {
+	ContentType string
+	Format      ErrorFormatter
+}
+
+func (o *errorFormatterOption) applyToHandler(config *handlerConfig) {
+	if o.Format == nil {
+		return
+	}
+	if config.ErrorFormatters == nil {
+		config.ErrorFormatters = make(map[string]ErrorFormatter)
+	}
+	config.ErrorFormatters[baseMediaType(o.ContentType)] = o.Format
+}
+
+type timeoutHeaderOption struct {
+	Header TimeoutHeader
+}
+
+func (o *timeoutHeaderOption) applyToHandler(config *handlerConfig) {
+	if o.Header.Name == "" {
+		config.TimeoutHeader = nil
+		return
+	}
+	header := o.Header
+	config.TimeoutHeader = &header
+}
+
+type grpcStatusInErrorsOption struct{}
+
+func (o *grpcStatusInErrorsOption) applyToHandler(config *handlerConfig) {
+	config.GRPCStatusInErrors = true
+}
+
+type debugEchoOption struct {
+	Echo DebugEcho
+}
+
+func (o *debugEchoOption) applyToHandler(config *handlerConfig) {
+	echo := o.Echo
+	config.DebugEcho = &echo
+}
+
+type errorRedactionOption struct {
+	Policy ErrorRedactionPolicy
+}
+
+func (o *errorRedactionOption) applyToHandler(config *handlerConfig) {
+	policy := o.Policy
+	config.ErrorRedaction = &policy
+}
+
+type jsonArrayStreamingOption struct{}
+
+func (o *jsonArrayStreamingOption) applyToHandler(config *handlerConfig) {
+	config.JSONArrayStreaming = true
+}
+
+type corsOption struct {
+	Origins []string
+}
+
+func (o *corsOption) applyToHandler(config *handlerConfig) {
+	config.CORSOrigins = append(config.CORSOrigins, o.Origins...)
+}
+
 type handlerOptionsOption struct {
 	options []HandlerOption
 }
@@ -381,6 +2039,217 @@ func (o *handlerOptionsOption) applyToHandler(config *handlerConfig) {
 	}
 }
 
+type routeExtractorOption struct {
+	Extractor RouteExtractor
+}
+
+func (o *routeExtractorOption) applyToClient(config *clientConfig) {
+	extractor := o.Extractor
+	config.RouteExtractor = &extractor
+}
+
+func (o *routeExtractorOption) applyToHandler(config *handlerConfig) {
+	extractor := o.Extractor
+	config.RouteExtractor = &extractor
+}
+
+type strictHeadersOption struct{}
+
+func (o *strictHeadersOption) applyToClient(config *clientConfig) {
+	config.StrictHeaders = true
+}
+
+func (o *strictHeadersOption) applyToHandler(config *handlerConfig) {
+	config.StrictHeaders = true
+}
+
+type callIDsOption struct {
+	Generate func() string
+}
+
+func (o *callIDsOption) applyToClient(config *clientConfig) {
+	config.CallIDs = o.apply(config.CallIDs)
+}
+
+func (o *callIDsOption) applyToHandler(config *handlerConfig) {
+	config.CallIDs = o.apply(config.CallIDs)
+}
+
+func (o *callIDsOption) apply(policy *callIDPolicy) *callIDPolicy {
+	if policy == nil {
+		policy = &callIDPolicy{}
+	}
+	policy.generate = o.Generate
+	return policy
+}
+
+type serializationTimingOption struct {
+	Report func(context.Context, SerializationTiming)
+}
+
+func (o *serializationTimingOption) applyToClient(config *clientConfig) {
+	config.SerializationTiming = o.Report
+}
+
+func (o *serializationTimingOption) applyToHandler(config *handlerConfig) {
+	config.SerializationTiming = o.Report
+}
+
+type callIDHeaderOption struct {
+	Header string
+}
+
+func (o *callIDHeaderOption) applyToClient(config *clientConfig) {
+	config.CallIDs = o.apply(config.CallIDs)
+}
+
+func (o *callIDHeaderOption) applyToHandler(config *handlerConfig) {
+	config.CallIDs = o.apply(config.CallIDs)
+}
+
+func (o *callIDHeaderOption) apply(policy *callIDPolicy) *callIDPolicy {
+	if policy == nil {
+		policy = &callIDPolicy{}
+	}
+	policy.header = http.CanonicalHeaderKey(o.Header)
+	return policy
+}
+
+type maxConcurrentCallsOption struct {
+	Limiter *callLimiter
+}
+
+func (o *maxConcurrentCallsOption) applyToClient(config *clientConfig) {
+	config.CallLimiter = o.Limiter
+}
+
+type reconnectOnDrainOption struct {
+	MaxReconnects int
+}
+
+func (o *reconnectOnDrainOption) applyToClient(config *clientConfig) {
+	config.ReconnectOnDrain = o.MaxReconnects
+}
+
+type singleFlightOption struct{}
+
+func (o *singleFlightOption) applyToClient(config *clientConfig) {
+	config.SingleFlight = true
+}
+
+type progressOption struct {
+	Report func(Progress)
+}
+
+func (o *progressOption) applyToClient(config *clientConfig) {
+	config.Progress = o.Report
+}
+
+type codedErrorsOption struct{}
+
+func (o *codedErrorsOption) applyToClient(config *clientConfig) {
+	config.CodedErrors = true
+}
+
+type connectOption struct{}
+
+func (o *connectOption) applyToClient(config *clientConfig) {
+	config.Protocol = &protocolConnect{}
+}
+
+type handlerProtocolsOption struct {
+	Protocols []string
+}
+
+func (o *handlerProtocolsOption) applyToHandler(config *handlerConfig) {
+	var connect, grpc, grpcWeb bool
+	for _, protocol := range o.Protocols {
+		switch protocol {
+		case ProtocolConnect:
+			connect = true
+		case ProtocolGRPC:
+			grpc = true
+		case ProtocolGRPCWeb:
+			grpcWeb = true
+		}
+	}
+	if !connect && !grpc && !grpcWeb {
+		// Disabling every protocol would reject all requests.
+		return
+	}
+	config.HandleConnect = connect
+	config.HandleGRPC = grpc
+	config.HandleGRPCWeb = grpcWeb
+}
+
+type dialerOption struct {
+	Dial func(context.Context, string, string) (net.Conn, error)
+
+	mu         sync.Mutex
+	transports map[*http.Transport]*http.Transport // original to cloned
+}
+
+func (o *dialerOption) applyToClient(config *clientConfig) {
+	config.Dialer = o
+}
+
+type retryOption struct {
+	Retrier *retrier
+}
+
+func (o *retryOption) applyToClient(config *clientConfig) {
+	config.Retrier = o.Retrier
+}
+
+type tlsConfigOption struct {
+	Config *tls.Config
+
+	mu         sync.Mutex
+	transports map[*http.Transport]*http.Transport // original to cloned
+}
+
+func (o *tlsConfigOption) applyToClient(config *clientConfig) {
+	if o.Config == nil {
+		config.TLSConfig = nil
+		return
+	}
+	config.TLSConfig = o
+}
+
+type httpStatusCodesOption struct {
+	Mapping func(int) (Code, bool)
+}
+
+func (o *httpStatusCodesOption) applyToClient(config *clientConfig) {
+	config.HTTPStatusCodes = o.Mapping
+}
+
+type enableGetOption struct{}
+
+func (o *enableGetOption) applyToClient(config *clientConfig) {
+	config.EnableGet = true
+}
+
+type getMaxURLSizeOption struct {
+	Max int
+}
+
+func (o *getMaxURLSizeOption) applyToClient(config *clientConfig) {
+	config.GetMaxURLSize = o.Max
+}
+
+type idempotencyOption struct {
+	Level IdempotencyLevel
+}
+
+func (o *idempotencyOption) applyToClient(config *clientConfig) {
+	config.IdempotencyLevel = o.Level
+}
+
+func (o *idempotencyOption) applyToHandler(config *handlerConfig) {
+	config.IdempotencyLevel = o.Level
+}
+
 type grpcOption struct {
 	web bool
 }
@@ -414,6 +2283,28 @@ func (o *interceptorsOption) chainWith(current Interceptor) Interceptor {
 	return newChain(append([]Interceptor{current}, o.Interceptors...))
 }
 
+type profileOption struct {
+	Profile Profile
+}
+
+func (o *profileOption) applyToClient(config *clientConfig) {
+	for _, option := range o.Profile.Options {
+		option.applyToClient(config)
+	}
+	for _, option := range o.Profile.ClientOptions {
+		option.applyToClient(config)
+	}
+}
+
+func (o *profileOption) applyToHandler(config *handlerConfig) {
+	for _, option := range o.Profile.Options {
+		option.applyToHandler(config)
+	}
+	for _, option := range o.Profile.HandlerOptions {
+		option.applyToHandler(config)
+	}
+}
+
 type optionsOption struct {
 	options []Option
 }
@@ -454,7 +2345,7 @@ func withProtoBinaryCodec() Option {
 
 func withProtoJSONCodecs() HandlerOption {
 	return WithHandlerOptions(
-		WithCodec(&protoJSONCodec{codecNameJSON}),
-		WithCodec(&protoJSONCodec{codecNameJSONCharsetUTF8}),
+		WithCodec(&protoJSONCodec{name: codecNameJSON}),
+		WithCodec(&protoJSONCodec{name: codecNameJSONCharsetUTF8}),
 	)
 }
@@ -0,0 +1,334 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// orcaTrailer is the binary trailer used by gRPC's Open Request Cost
+// Aggregation (ORCA) protocol to carry per-call load reports.
+const orcaTrailer = "Endpoint-Load-Metrics-Bin"
+
+// Field numbers from xds.data.orca.v3.OrcaLoadReport.
+const (
+	orcaFieldCPUUtilization         protowire.Number = 1
+	orcaFieldMemUtilization         protowire.Number = 2
+	orcaFieldRequestCost            protowire.Number = 4
+	orcaFieldUtilization            protowire.Number = 5
+	orcaFieldRPSFractional          protowire.Number = 6
+	orcaFieldEPS                    protowire.Number = 7
+	orcaFieldNamedMetrics           protowire.Number = 8
+	orcaFieldApplicationUtilization protowire.Number = 9
+)
+
+// A LoadReport is a per-call backend load report, in the format used by
+// gRPC's Open Request Cost Aggregation (ORCA) protocol. Handlers attach
+// reports to responses with [SetLoadReport], and load balancers consume them
+// to weight backends; clients can observe them with [WithLoadReportObserver].
+//
+// Utilization values are usually fractions between 0 and 1, but may exceed 1
+// if the backend is overcommitted.
+type LoadReport struct {
+	CPUUtilization         float64
+	MemUtilization         float64
+	ApplicationUtilization float64
+	// RPSFractional is the number of queries per second the backend is
+	// serving.
+	RPSFractional float64
+	// EPS is the number of errors per second the backend is returning.
+	EPS float64
+	// RequestCost holds application-specific costs of this request.
+	RequestCost map[string]float64
+	// Utilization holds application-specific resource utilization.
+	Utilization map[string]float64
+	// NamedMetrics holds any other application-specific metrics.
+	NamedMetrics map[string]float64
+}
+
+// SetLoadReport serializes the report into the standard ORCA trailer. Handlers
+// typically pass [Response.Trailer], [ServerStream.ResponseTrailer], or the
+// metadata of a returned [*Error].
+func SetLoadReport(trailer http.Header, report *LoadReport) {
+	var data []byte
+	data = appendORCADouble(data, orcaFieldCPUUtilization, report.CPUUtilization)
+	data = appendORCADouble(data, orcaFieldMemUtilization, report.MemUtilization)
+	data = appendORCAMap(data, orcaFieldRequestCost, report.RequestCost)
+	data = appendORCAMap(data, orcaFieldUtilization, report.Utilization)
+	data = appendORCADouble(data, orcaFieldRPSFractional, report.RPSFractional)
+	data = appendORCADouble(data, orcaFieldEPS, report.EPS)
+	data = appendORCAMap(data, orcaFieldNamedMetrics, report.NamedMetrics)
+	data = appendORCADouble(data, orcaFieldApplicationUtilization, report.ApplicationUtilization)
+	trailer.Set(orcaTrailer, EncodeBinaryHeader(data))
+}
+
+// LoadReportFromTrailer parses the ORCA load report from a response's
+// trailers. It reports false if the trailers don't include a report.
+func LoadReportFromTrailer(trailer http.Header) (*LoadReport, bool, error) {
+	encoded := trailer.Get(orcaTrailer)
+	if encoded == "" {
+		return nil, false, nil
+	}
+	report, err := parseLoadReport(encoded)
+	if err != nil {
+		return nil, false, err
+	}
+	return report, true, nil
+}
+
+func parseLoadReport(encoded string) (*LoadReport, error) {
+	data, err := DecodeBinaryHeader(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("decode load report: %w", err)
+	}
+	report := &LoadReport{}
+	for len(data) > 0 {
+		number, wireType, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, fmt.Errorf("parse load report: %w", protowire.ParseError(n))
+		}
+		data = data[n:]
+		switch {
+		case wireType == protowire.Fixed64Type && isORCADoubleField(number):
+			bits, n := protowire.ConsumeFixed64(data)
+			if n < 0 {
+				return nil, fmt.Errorf("parse load report: %w", protowire.ParseError(n))
+			}
+			data = data[n:]
+			report.setDouble(number, math.Float64frombits(bits))
+		case wireType == protowire.BytesType && isORCAMapField(number):
+			entry, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return nil, fmt.Errorf("parse load report: %w", protowire.ParseError(n))
+			}
+			data = data[n:]
+			key, value, err := parseORCAMapEntry(entry)
+			if err != nil {
+				return nil, err
+			}
+			report.setMapEntry(number, key, value)
+		default:
+			n := protowire.ConsumeFieldValue(number, wireType, data)
+			if n < 0 {
+				return nil, fmt.Errorf("parse load report: %w", protowire.ParseError(n))
+			}
+			data = data[n:]
+		}
+	}
+	return report, nil
+}
+
+// WithLoadReportObserver configures the client to call observe with the ORCA
+// load report attached to each response, which lets client-side load
+// balancers weight backends by their reported utilization. For streaming
+// calls, the report is observed when the response is closed. Calls without a
+// report, or with a malformed report, aren't observed.
+//
+// The observer is implemented as an interceptor, so its position relative to
+// other interceptors follows the order of options. The observe function must
+// be safe to call concurrently.
+func WithLoadReportObserver(observe func(ctx context.Context, spec Spec, report *LoadReport)) ClientOption {
+	return WithInterceptors(&loadReportInterceptor{observe: observe})
+}
+
+func isORCADoubleField(number protowire.Number) bool {
+	switch number {
+	case orcaFieldCPUUtilization, orcaFieldMemUtilization, orcaFieldRPSFractional,
+		orcaFieldEPS, orcaFieldApplicationUtilization:
+		return true
+	default:
+		return false
+	}
+}
+
+func isORCAMapField(number protowire.Number) bool {
+	return number == orcaFieldRequestCost || number == orcaFieldUtilization || number == orcaFieldNamedMetrics
+}
+
+func appendORCADouble(data []byte, number protowire.Number, value float64) []byte {
+	if value == 0 {
+		// Proto3 scalars don't serialize zero values.
+		return data
+	}
+	data = protowire.AppendTag(data, number, protowire.Fixed64Type)
+	return protowire.AppendFixed64(data, math.Float64bits(value))
+}
+
+func appendORCAMap(data []byte, number protowire.Number, values map[string]float64) []byte {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys) // deterministic output
+	for _, key := range keys {
+		var entry []byte
+		entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+		entry = protowire.AppendString(entry, key)
+		entry = protowire.AppendTag(entry, 2, protowire.Fixed64Type)
+		entry = protowire.AppendFixed64(entry, math.Float64bits(values[key]))
+		data = protowire.AppendTag(data, number, protowire.BytesType)
+		data = protowire.AppendBytes(data, entry)
+	}
+	return data
+}
+
+func parseORCAMapEntry(entry []byte) (string, float64, error) {
+	var key string
+	var value float64
+	for len(entry) > 0 {
+		number, wireType, n := protowire.ConsumeTag(entry)
+		if n < 0 {
+			return "", 0, fmt.Errorf("parse load report: %w", protowire.ParseError(n))
+		}
+		entry = entry[n:]
+		switch {
+		case number == 1 && wireType == protowire.BytesType:
+			var raw []byte
+			raw, n = protowire.ConsumeBytes(entry)
+			key = string(raw)
+		case number == 2 && wireType == protowire.Fixed64Type:
+			var bits uint64
+			bits, n = protowire.ConsumeFixed64(entry)
+			value = math.Float64frombits(bits)
+		default:
+			n = protowire.ConsumeFieldValue(number, wireType, entry)
+		}
+		if n < 0 {
+			return "", 0, fmt.Errorf("parse load report: %w", protowire.ParseError(n))
+		}
+		entry = entry[n:]
+	}
+	return key, value, nil
+}
+
+func (r *LoadReport) setDouble(number protowire.Number, value float64) {
+	switch number {
+	case orcaFieldCPUUtilization:
+		r.CPUUtilization = value
+	case orcaFieldMemUtilization:
+		r.MemUtilization = value
+	case orcaFieldRPSFractional:
+		r.RPSFractional = value
+	case orcaFieldEPS:
+		r.EPS = value
+	case orcaFieldApplicationUtilization:
+		r.ApplicationUtilization = value
+	}
+}
+
+func (r *LoadReport) setMapEntry(number protowire.Number, key string, value float64) {
+	var values *map[string]float64
+	switch number {
+	case orcaFieldRequestCost:
+		values = &r.RequestCost
+	case orcaFieldUtilization:
+		values = &r.Utilization
+	case orcaFieldNamedMetrics:
+		values = &r.NamedMetrics
+	default:
+		return
+	}
+	if *values == nil {
+		*values = make(map[string]float64)
+	}
+	(*values)[key] = value
+}
+
+// loadReportInterceptor passes the ORCA load reports attached to responses to
+// an observer.
+type loadReportInterceptor struct {
+	observe func(context.Context, Spec, *LoadReport)
+}
+
+func (i *loadReportInterceptor) WrapUnary(next UnaryFunc) UnaryFunc {
+	return func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
+		response, err := next(ctx, request)
+		if !request.Spec().IsClient {
+			return response, err
+		}
+		var trailer http.Header
+		var connectErr *Error
+		if errors.As(err, &connectErr) {
+			trailer = connectErr.Meta()
+		} else if err == nil {
+			trailer = response.Trailer()
+		}
+		i.report(ctx, request.Spec(), trailer)
+		return response, err
+	}
+}
+
+func (i *loadReportInterceptor) WrapStreamingClient(next StreamingClientFunc) StreamingClientFunc {
+	return func(ctx context.Context, spec Spec) StreamingClientConn {
+		return &loadReportClientConn{
+			StreamingClientConn: next(ctx, spec),
+			ctx:                 ctx,
+			interceptor:         i,
+		}
+	}
+}
+
+func (i *loadReportInterceptor) WrapStreamingHandler(next StreamingHandlerFunc) StreamingHandlerFunc {
+	return next
+}
+
+func (i *loadReportInterceptor) report(ctx context.Context, spec Spec, trailer http.Header) {
+	if trailer == nil {
+		return
+	}
+	if report, ok, err := LoadReportFromTrailer(trailer); ok && err == nil {
+		i.observe(ctx, spec, report)
+	}
+}
+
+type loadReportClientConn struct {
+	StreamingClientConn
+
+	ctx         context.Context
+	interceptor *loadReportInterceptor
+	once        sync.Once
+}
+
+func (cc *loadReportClientConn) ReceiveWithMetadata(msg any) (http.Header, error) {
+	return ReceiveWithMetadata(cc.StreamingClientConn, msg)
+}
+
+func (cc *loadReportClientConn) SendWithMetadata(msg any, metadata http.Header) error {
+	return SendWithMetadata(cc.StreamingClientConn, msg, metadata)
+}
+
+func (cc *loadReportClientConn) ReceiveWithEnvelopeFlags(msg any) ([]string, error) {
+	return ReceiveWithEnvelopeFlags(cc.StreamingClientConn, msg)
+}
+
+func (cc *loadReportClientConn) SendWithEnvelopeFlags(msg any, flags []string) error {
+	return SendWithEnvelopeFlags(cc.StreamingClientConn, msg, flags...)
+}
+
+func (cc *loadReportClientConn) CloseResponse() error {
+	err := cc.StreamingClientConn.CloseResponse()
+	cc.once.Do(func() {
+		cc.interceptor.report(cc.ctx, cc.Spec(), cc.ResponseTrailer())
+	})
+	return err
+}
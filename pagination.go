@@ -0,0 +1,117 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+)
+
+// A PageFunc fetches one page of a paginated list, usually by calling a
+// unary list RPC. It receives the page token returned with the previous page
+// (or an empty string for the first page) and returns the page's items along
+// with the token for the next page. An empty next page token marks the last
+// page.
+type PageFunc[T any] func(ctx context.Context, pageToken string) (items []T, nextPageToken string, err error)
+
+// Paginator iterates over the items of a paginated list, fetching pages
+// lazily as they're needed. It's constructed with [Paginate].
+//
+// Its API mirrors [ServerStreamForClient]:
+//
+//	books := connect.Paginate(ctx, listBooks)
+//	for books.Next() {
+//	  fmt.Println(books.Item())
+//	}
+//	if err := books.Err(); err != nil {
+//	  return err
+//	}
+type Paginator[T any] struct {
+	ctx       context.Context
+	fetch     PageFunc[T]
+	pageToken string
+	page      []T
+	item      T
+	done      bool
+	err       error
+}
+
+// Paginate constructs a Paginator that calls fetch until it returns an empty
+// next page token.
+func Paginate[T any](ctx context.Context, fetch PageFunc[T]) *Paginator[T] {
+	return &Paginator[T]{ctx: ctx, fetch: fetch}
+}
+
+// Next advances the paginator to the next item, which will then be available
+// through the Item method. It returns false when there are no more items or
+// when fetching a page fails. After Next returns false, the Err method will
+// return any error encountered.
+func (p *Paginator[T]) Next() bool {
+	for len(p.page) == 0 {
+		if p.done || p.err != nil {
+			var zero T
+			p.item = zero
+			return false
+		}
+		p.fetchPage()
+	}
+	p.item = p.page[0]
+	p.page = p.page[1:]
+	return true
+}
+
+// Item returns the most recent item found by a call to Next.
+func (p *Paginator[T]) Item() T {
+	return p.item
+}
+
+// Err returns the first error encountered by Next.
+func (p *Paginator[T]) Err() error {
+	return p.err
+}
+
+func (p *Paginator[T]) fetchPage() {
+	if err := p.ctx.Err(); err != nil {
+		p.err = wrapIfContextDone(p.ctx, err)
+		return
+	}
+	items, nextPageToken, err := p.fetch(p.ctx, p.pageToken)
+	if err != nil {
+		p.err = err
+		return
+	}
+	if nextPageToken != "" && nextPageToken == p.pageToken {
+		p.err = errorf(CodeInternal, "pagination stuck: page token %q repeated", nextPageToken)
+		return
+	}
+	p.page = items
+	p.pageToken = nextPageToken
+	p.done = nextPageToken == ""
+}
+
+// SendPaginated sends each item of a paginated list on a server stream,
+// letting a server streaming list RPC share its implementation with a paged
+// unary list RPC. It stops at the first error, whether from fetching a page
+// or sending a message.
+func SendPaginated[Res any](paginator *Paginator[*Res], stream *ServerStream[Res]) error {
+	for paginator.Next() {
+		if err := stream.Send(paginator.Item()); err != nil {
+			return err
+		}
+	}
+	if err := paginator.Err(); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/bufbuild/connect-go/internal/assert"
+	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
+	"github.com/bufbuild/connect-go/internal/gen/connect/ping/v1/pingv1connect"
+)
+
+// countPages returns a PageFunc that counts from 1 to limit, pageSize numbers
+// at a time.
+func countPages(limit, pageSize int64) connect.PageFunc[*pingv1.CountUpResponse] {
+	return func(_ context.Context, pageToken string) ([]*pingv1.CountUpResponse, string, error) {
+		var start int64
+		if pageToken != "" {
+			var err error
+			start, err = strconv.ParseInt(pageToken, 10, 64)
+			if err != nil {
+				return nil, "", connect.NewError(connect.CodeInvalidArgument, err)
+			}
+		}
+		var page []*pingv1.CountUpResponse
+		for i := start; i < limit && i < start+pageSize; i++ {
+			page = append(page, &pingv1.CountUpResponse{Number: i + 1})
+		}
+		if start+pageSize >= limit {
+			return page, "", nil
+		}
+		return page, strconv.FormatInt(start+pageSize, 10), nil
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	t.Parallel()
+	t.Run("pages", func(t *testing.T) {
+		t.Parallel()
+		paginator := connect.Paginate(context.Background(), countPages(7, 3))
+		var got []int64
+		for paginator.Next() {
+			got = append(got, paginator.Item().Number)
+		}
+		assert.Nil(t, paginator.Err())
+		assert.Equal(t, got, []int64{1, 2, 3, 4, 5, 6, 7})
+		assert.False(t, paginator.Next())
+	})
+	t.Run("empty", func(t *testing.T) {
+		t.Parallel()
+		paginator := connect.Paginate(context.Background(), countPages(0, 3))
+		assert.False(t, paginator.Next())
+		assert.Nil(t, paginator.Err())
+	})
+	t.Run("error", func(t *testing.T) {
+		t.Parallel()
+		fetchErr := errors.New("oh no")
+		paginator := connect.Paginate(
+			context.Background(),
+			func(_ context.Context, pageToken string) ([]int, string, error) {
+				if pageToken == "" {
+					return []int{1}, "next", nil
+				}
+				return nil, "", fetchErr
+			},
+		)
+		assert.True(t, paginator.Next())
+		assert.Equal(t, paginator.Item(), 1)
+		assert.False(t, paginator.Next())
+		assert.ErrorIs(t, paginator.Err(), fetchErr)
+	})
+	t.Run("repeated_token", func(t *testing.T) {
+		t.Parallel()
+		paginator := connect.Paginate(
+			context.Background(),
+			func(context.Context, string) ([]int, string, error) {
+				return nil, "same", nil
+			},
+		)
+		assert.False(t, paginator.Next())
+		assert.Equal(t, connect.CodeOf(paginator.Err()), connect.CodeInternal)
+	})
+	t.Run("canceled", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		paginator := connect.Paginate(ctx, countPages(7, 3))
+		assert.False(t, paginator.Next())
+		assert.Equal(t, connect.CodeOf(paginator.Err()), connect.CodeCanceled)
+	})
+}
+
+func TestSendPaginated(t *testing.T) {
+	t.Parallel()
+	const countUpProcedure = "/" + pingv1connect.PingServiceName + "/CountUp"
+	mux := http.NewServeMux()
+	mux.Handle(countUpProcedure, connect.NewServerStreamHandler(
+		countUpProcedure,
+		func(ctx context.Context, req *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+			return connect.SendPaginated(connect.Paginate(ctx, countPages(req.Msg.Number, 2)), stream)
+		},
+	))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := connect.NewClient[pingv1.CountUpRequest, pingv1.CountUpResponse](
+		server.Client(),
+		server.URL+countUpProcedure,
+	)
+	stream, err := client.CallServerStream(
+		context.Background(),
+		connect.NewRequest(&pingv1.CountUpRequest{Number: 5}),
+	)
+	assert.Nil(t, err)
+	var got []int64
+	for stream.Receive() {
+		got = append(got, stream.Msg().Number)
+	}
+	assert.Nil(t, stream.Err())
+	assert.Equal(t, got, []int64{1, 2, 3, 4, 5})
+	assert.Nil(t, stream.Close())
+}
@@ -0,0 +1,113 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// PeerLimiter caps the number of concurrent streams from each client, so that
+// a single noisy client can't crowd out the others in a multi-tenant service.
+// Each client has its own queue, governed by the [QueuePolicy]; streams that
+// are rejected or time out while waiting fail with [CodeResourceExhausted].
+// Streams hold their slot until the handler returns. Unary calls aren't
+// limited.
+//
+// A single limiter may be shared by many handlers, in which case the limit
+// spans all of their procedures. Attach it to handlers with
+// [WithPeerLimiter].
+type PeerLimiter struct {
+	maxPerPeer int
+	policy     QueuePolicy
+	key        func(Peer) string
+
+	mu    sync.Mutex
+	peers map[string]*peerLimit
+}
+
+type peerLimit struct {
+	limiter *callLimiter
+	refs    int // active and waiting streams, guarded by PeerLimiter.mu
+}
+
+// NewPeerLimiter constructs a PeerLimiter that allows maxPerPeer concurrent
+// streams per client. The key function identifies clients; it usually
+// returns an authenticated identity from [Peer.AuthInfo]. If key is nil,
+// clients are identified by the host of [Peer.Addr]. Streams with an empty
+// key aren't limited, and if maxPerPeer isn't positive, no streams are.
+func NewPeerLimiter(maxPerPeer int, policy QueuePolicy, key func(Peer) string) *PeerLimiter {
+	if key == nil {
+		key = peerHost
+	}
+	return &PeerLimiter{
+		maxPerPeer: maxPerPeer,
+		policy:     policy,
+		key:        key,
+		peers:      make(map[string]*peerLimit),
+	}
+}
+
+// WithPeerLimiter limits the handler's concurrent streams per client with a
+// [PeerLimiter].
+func WithPeerLimiter(limiter *PeerLimiter) HandlerOption {
+	return &peerLimiterOption{Limiter: limiter}
+}
+
+// acquire waits until the peer's stream can run, then returns a function that
+// must be called when the stream finishes.
+func (l *PeerLimiter) acquire(ctx context.Context, peer Peer) (func(), error) {
+	key := l.key(peer)
+	if l.maxPerPeer <= 0 || key == "" {
+		return func() {}, nil
+	}
+	l.mu.Lock()
+	limit, ok := l.peers[key]
+	if !ok {
+		limit = &peerLimit{limiter: newCallLimiter(l.maxPerPeer, l.policy)}
+		l.peers[key] = limit
+	}
+	limit.refs++
+	l.mu.Unlock()
+	unref := func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		limit.refs--
+		if limit.refs == 0 {
+			// Forget idle clients, so that the map doesn't grow without bound.
+			delete(l.peers, key)
+		}
+	}
+	release, err := limit.limiter.acquire(ctx)
+	if err != nil {
+		unref()
+		return nil, err
+	}
+	return func() {
+		release()
+		unref()
+	}, nil
+}
+
+// peerHost identifies a peer by the host portion of its address, so that all
+// of a client's connections share a limit.
+func peerHost(peer Peer) string {
+	host, _, err := net.SplitHostPort(peer.Addr)
+	if err != nil {
+		return peer.Addr
+	}
+	return host
+}
@@ -0,0 +1,116 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"time"
+)
+
+// CallPolicy holds per-call limits, returned by the resolver configured with
+// [WithPolicyResolver]. Zero values leave the handler's configuration
+// unchanged.
+type CallPolicy struct {
+	// ReadMaxBytes overrides WithReadMaxBytes for this call.
+	ReadMaxBytes int
+	// SendMaxBytes overrides WithSendMaxBytes for this call.
+	SendMaxBytes int
+	// Timeout caps the time available to the handler. If the client's timeout
+	// is shorter, the client's timeout still applies.
+	Timeout time.Duration
+	// DisableCompression sends responses uncompressed, even if the client
+	// accepts compressed responses. It's useful for tenants whose traffic
+	// isn't worth the CPU cost of compression.
+	DisableCompression bool
+	// Limiter, if non-nil, is consulted once per call. If it doesn't allow the
+	// call, the handler responds with CodeResourceExhausted without running
+	// the implementation. The limiters in golang.org/x/time/rate satisfy this
+	// interface.
+	Limiter interface{ Allow() bool }
+}
+
+// policyApplier is implemented by handler conns that support per-call
+// policies.
+type policyApplier interface {
+	applyPolicy(*CallPolicy)
+}
+
+func applyPolicy(conn StreamingHandlerConn, policy *CallPolicy) {
+	if applier, ok := conn.(policyApplier); ok {
+		applier.applyPolicy(policy)
+	}
+}
+
+// resolvePolicy looks up the policy for a call and enforces it. If the call is
+// allowed, it returns the context to use for the rest of the call and a
+// cancellation function (which may be nil).
+func resolvePolicy(
+	ctx context.Context,
+	resolve func(context.Context, Spec, Peer) CallPolicy,
+	conn handlerConnCloser,
+) (context.Context, context.CancelFunc, error) {
+	policy := resolve(ctx, conn.Spec(), conn.Peer())
+	if policy.Limiter != nil && !policy.Limiter.Allow() {
+		return ctx, nil, errorf(CodeResourceExhausted, "rate limit exceeded")
+	}
+	applyPolicy(conn, &policy)
+	if policy.Timeout <= 0 {
+		return ctx, nil, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, policy.Timeout)
+	return ctx, cancel, nil
+}
+
+func (hc *connectUnaryHandlerConn) applyPolicy(policy *CallPolicy) {
+	if policy.ReadMaxBytes > 0 {
+		hc.unmarshaler.readMaxBytes = policy.ReadMaxBytes
+	}
+	if policy.SendMaxBytes > 0 {
+		hc.marshaler.sendMaxBytes = policy.SendMaxBytes
+	}
+	if policy.DisableCompression {
+		hc.marshaler.compressionPool = nil
+	}
+}
+
+func (hc *connectStreamingHandlerConn) applyPolicy(policy *CallPolicy) {
+	if policy.ReadMaxBytes > 0 {
+		hc.unmarshaler.readMaxBytes = policy.ReadMaxBytes
+	}
+	if policy.SendMaxBytes > 0 {
+		hc.marshaler.sendMaxBytes = policy.SendMaxBytes
+	}
+	if policy.DisableCompression {
+		hc.marshaler.compressionPool = nil
+		delete(hc.responseWriter.Header(), connectStreamingHeaderCompression)
+	}
+}
+
+func (hc *grpcHandlerConn) applyPolicy(policy *CallPolicy) {
+	if policy.ReadMaxBytes > 0 {
+		hc.unmarshaler.envelopeReader.readMaxBytes = policy.ReadMaxBytes
+	}
+	if policy.SendMaxBytes > 0 {
+		hc.marshaler.sendMaxBytes = policy.SendMaxBytes
+	}
+	if policy.DisableCompression {
+		hc.marshaler.compressionPool = nil
+		delete(hc.responseWriter.Header(), grpcHeaderCompression)
+	}
+}
+
+func (hc *errorTranslatingHandlerConnCloser) applyPolicy(policy *CallPolicy) {
+	applyPolicy(hc.handlerConnCloser, policy)
+}
@@ -0,0 +1,246 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// headerPriority carries the Extensible Priorities defined in RFC 9218.
+	headerPriority = "Priority"
+
+	// DefaultUrgency is the urgency of calls that don't specify one, as
+	// defined in RFC 9218.
+	DefaultUrgency = 3
+	// MaxUrgency is the least urgent priority level.
+	MaxUrgency = 7
+
+	// defaultStreamingUrgency is the urgency the scheduler assigns to
+	// streaming calls that don't specify one: they're usually bulk transfers
+	// or long-lived, so they yield to unary calls.
+	defaultStreamingUrgency = DefaultUrgency + 1
+)
+
+// Priority is the priority of an RPC, using the urgency and incremental
+// parameters defined by RFC 9218. Urgency ranges from 0 (most urgent) to
+// [MaxUrgency]; Incremental indicates that the client can use partial
+// responses, as with most server streams.
+//
+// Go's HTTP/2 implementation doesn't send PRIORITY frames, so priorities are
+// sent as a Priority request header. Handlers configured with
+// [WithPriorityScheduler] use it to order calls.
+type Priority struct {
+	Urgency     int
+	Incremental bool
+}
+
+// String formats the priority as a Priority header value.
+func (p Priority) String() string {
+	if p.Incremental {
+		return fmt.Sprintf("u=%d, i", p.Urgency)
+	}
+	return fmt.Sprintf("u=%d", p.Urgency)
+}
+
+// SetPriority sets the Priority header on a request, overriding the client's
+// default from [WithPriority]. It's useful for setting priorities on
+// individual calls, using the headers from [Request.Header] or
+// [StreamingClientConn.RequestHeader].
+func SetPriority(header http.Header, priority Priority) {
+	header[headerPriority] = []string{priority.String()}
+}
+
+// parsePriority parses a Priority header value, ignoring unknown or malformed
+// parameters as RFC 9218 requires. It reports false if the header is absent.
+func parsePriority(header http.Header) (Priority, bool) {
+	values := header.Values(headerPriority)
+	if len(values) == 0 {
+		return Priority{}, false
+	}
+	priority := Priority{Urgency: DefaultUrgency}
+	for _, value := range values {
+		for _, param := range strings.Split(value, ",") {
+			key, raw, hasValue := strings.Cut(strings.TrimSpace(param), "=")
+			switch key {
+			case "u":
+				urgency, err := strconv.Atoi(raw)
+				if err == nil && urgency >= 0 && urgency <= MaxUrgency {
+					priority.Urgency = urgency
+				}
+			case "i":
+				priority.Incremental = !hasValue || raw == "?1"
+			}
+		}
+	}
+	return priority, true
+}
+
+// WithPriority sets the default priority of the client's calls. To set the
+// priority of a single call, use [SetPriority].
+//
+// Priorities are advisory: handlers without a [PriorityScheduler] ignore them.
+// Clients fail with CodeUnknown if the urgency is out of range.
+func WithPriority(priority Priority) ClientOption {
+	if priority.Urgency < 0 || priority.Urgency > MaxUrgency {
+		return &clientInitErrorOption{
+			Err: errorf(CodeUnknown, "priority urgency %d out of range [0, %d]", priority.Urgency, MaxUrgency),
+		}
+	}
+	return WithInterceptors(&priorityInterceptor{priority: priority})
+}
+
+// priorityInterceptor sets the default priority on outbound calls, without
+// overwriting priorities set on individual calls.
+type priorityInterceptor struct {
+	priority Priority
+}
+
+func (i *priorityInterceptor) WrapUnary(next UnaryFunc) UnaryFunc {
+	return func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
+		if request.Spec().IsClient {
+			i.setDefault(request.Header())
+		}
+		return next(ctx, request)
+	}
+}
+
+func (i *priorityInterceptor) WrapStreamingClient(next StreamingClientFunc) StreamingClientFunc {
+	return func(ctx context.Context, spec Spec) StreamingClientConn {
+		conn := next(ctx, spec)
+		i.setDefault(conn.RequestHeader())
+		return conn
+	}
+}
+
+func (i *priorityInterceptor) WrapStreamingHandler(next StreamingHandlerFunc) StreamingHandlerFunc {
+	return next
+}
+
+func (i *priorityInterceptor) setDefault(header http.Header) {
+	if _, ok := header[headerPriority]; !ok {
+		SetPriority(header, i.priority)
+	}
+}
+
+// PriorityScheduler limits the number of calls that handlers run
+// concurrently. When all slots are busy, waiting calls are admitted in order
+// of urgency, and calls with the same urgency are admitted in arrival order.
+// This keeps latency-sensitive calls fast when they share a server (or an
+// HTTP/2 connection) with bulk traffic.
+//
+// Calls without a Priority header are treated as [DefaultUrgency], except
+// for streaming calls, which are one step less urgent. A call holds its slot
+// until the handler returns, so the limit should leave room for long-lived
+// streams. Calls whose context ends while waiting fail with
+// [CodeCanceled] or [CodeDeadlineExceeded].
+//
+// A single scheduler may be shared by many handlers.
+type PriorityScheduler struct {
+	maxConcurrent int
+
+	mu      sync.Mutex
+	active  int
+	waiting [MaxUrgency + 1][]chan struct{}
+}
+
+// NewPriorityScheduler constructs a scheduler that runs at most
+// maxConcurrent calls at once. If maxConcurrent isn't positive, calls are
+// never delayed.
+func NewPriorityScheduler(maxConcurrent int) *PriorityScheduler {
+	return &PriorityScheduler{maxConcurrent: maxConcurrent}
+}
+
+// WithPriorityScheduler runs the handler's calls through a
+// [PriorityScheduler].
+func WithPriorityScheduler(scheduler *PriorityScheduler) HandlerOption {
+	return &prioritySchedulerOption{Scheduler: scheduler}
+}
+
+// schedule waits until the call can run, then returns a function that must be
+// called when the call finishes.
+func (s *PriorityScheduler) schedule(ctx context.Context, conn StreamingHandlerConn) (func(), error) {
+	if s.maxConcurrent <= 0 {
+		return func() {}, nil
+	}
+	priority, ok := parsePriority(conn.RequestHeader())
+	if !ok {
+		priority.Urgency = DefaultUrgency
+		if conn.Spec().StreamType != StreamTypeUnary {
+			priority.Urgency = defaultStreamingUrgency
+		}
+	}
+	s.mu.Lock()
+	if s.active < s.maxConcurrent && s.queued() == 0 {
+		s.active++
+		s.mu.Unlock()
+		return s.release, nil
+	}
+	ready := make(chan struct{})
+	s.waiting[priority.Urgency] = append(s.waiting[priority.Urgency], ready)
+	s.mu.Unlock()
+	select {
+	case <-ready:
+		return s.release, nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		removed := s.remove(priority.Urgency, ready)
+		s.mu.Unlock()
+		if !removed {
+			// We were admitted concurrently, so pass the slot along.
+			s.release()
+		}
+		return nil, wrapIfContextDone(ctx, ctx.Err())
+	}
+}
+
+// release frees a slot, handing it directly to the most urgent waiting call.
+func (s *PriorityScheduler) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for urgency, queue := range s.waiting {
+		if len(queue) == 0 {
+			continue
+		}
+		close(queue[0])
+		s.waiting[urgency] = queue[1:]
+		return
+	}
+	s.active--
+}
+
+func (s *PriorityScheduler) queued() int {
+	var total int
+	for _, queue := range s.waiting {
+		total += len(queue)
+	}
+	return total
+}
+
+func (s *PriorityScheduler) remove(urgency int, ready chan struct{}) bool {
+	queue := s.waiting[urgency]
+	for i, candidate := range queue {
+		if candidate == ready {
+			s.waiting[urgency] = append(queue[:i:i], queue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
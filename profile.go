@@ -0,0 +1,83 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import "time"
+
+const meshCallIDHeader = "Call-Id"
+
+// A Profile is a reusable bundle of options, so that services sharing a
+// deployment environment don't each copy the same long list of options.
+// Apply a profile with [WithProfile]. Organizations can define their own
+// profiles, or start from the presets returned by [PublicInternetProfile] and
+// [InternalMeshProfile].
+//
+// Profiles are plain values: to customize a preset, append to its slices
+// before applying it.
+type Profile struct {
+	// Options apply to both clients and handlers.
+	Options []Option
+	// ClientOptions apply only to clients, after Options.
+	ClientOptions []ClientOption
+	// HandlerOptions apply only to handlers, after Options.
+	HandlerOptions []HandlerOption
+}
+
+// WithProfile applies all the options in the profile. Options are applied in
+// order, so options following WithProfile override the profile's settings:
+//
+//	connect.WithOptions(
+//		connect.WithProfile(connect.PublicInternetProfile("https://app.example.com")),
+//		connect.WithReadMaxBytes(16*1024*1024), // this service accepts uploads
+//	)
+func WithProfile(profile Profile) Option {
+	return &profileOption{Profile: profile}
+}
+
+// PublicInternetProfile returns a preset for APIs exposed to untrusted
+// clients on the public internet. It limits messages to 4 MiB and headers to
+// 32 KiB, caps handler timeouts at 30 seconds, and redacts the messages of
+// internal and unknown errors. Browsers on the given origins may call the
+// handlers with CORS; if there are no origins, CORS stays disabled.
+func PublicInternetProfile(origins ...string) Profile {
+	return Profile{
+		Options: []Option{
+			WithReadMaxBytes(4 * 1024 * 1024),
+			WithReadMaxHeaderBytes(32 * 1024),
+		},
+		HandlerOptions: []HandlerOption{
+			WithMaxTimeout(30 * time.Second),
+			WithErrorRedaction(ErrorRedactionPolicy{Message: "internal error"}),
+			WithCORS(origins...),
+		},
+	}
+}
+
+// InternalMeshProfile returns a preset for traffic between trusted services
+// inside a service mesh. It allows messages of up to 64 MiB, compresses
+// messages of 1 KiB or more (clients send gzip), and propagates call IDs in
+// the Call-Id header so that logs on both sides of each call correlate.
+func InternalMeshProfile() Profile {
+	return Profile{
+		Options: []Option{
+			WithReadMaxBytes(64 * 1024 * 1024),
+			WithCompressMinBytes(1024),
+			WithCallIDHeader(meshCallIDHeader),
+		},
+		ClientOptions: []ClientOption{
+			WithSendGzip(),
+		},
+	}
+}
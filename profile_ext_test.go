@@ -0,0 +1,100 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/bufbuild/connect-go/internal/assert"
+	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
+	"github.com/bufbuild/connect-go/internal/gen/connect/ping/v1/pingv1connect"
+)
+
+func TestProfile(t *testing.T) {
+	t.Parallel()
+	newClient := func(t *testing.T, options ...connect.HandlerOption) pingv1connect.PingServiceClient {
+		t.Helper()
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}, options...))
+		server := httptest.NewServer(mux)
+		t.Cleanup(server.Close)
+		return pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+	}
+	large := strings.Repeat("a", 5*1024*1024)
+	t.Run("public_internet", func(t *testing.T) {
+		t.Parallel()
+		client := newClient(t, connect.WithProfile(connect.PublicInternetProfile()))
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Text: large}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+		_, err = client.Fail(
+			context.Background(),
+			connect.NewRequest(&pingv1.FailRequest{Code: int32(connect.CodeInternal)}),
+		)
+		assert.Equal(t, connect.CodeOf(err), connect.CodeInternal)
+		var connectErr *connect.Error
+		assert.True(t, errors.As(err, &connectErr))
+		assert.Equal(t, connectErr.Message(), "internal error")
+	})
+	t.Run("override", func(t *testing.T) {
+		t.Parallel()
+		client := newClient(
+			t,
+			connect.WithProfile(connect.PublicInternetProfile()),
+			connect.WithReadMaxBytes(16*1024*1024),
+		)
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Text: large}))
+		assert.Nil(t, err)
+	})
+	t.Run("internal_mesh", func(t *testing.T) {
+		t.Parallel()
+		var handlerID string
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(
+			pingServer{},
+			connect.WithProfile(connect.InternalMeshProfile()),
+			connect.WithInterceptors(connect.UnaryInterceptorFunc(func(next connect.UnaryFunc) connect.UnaryFunc {
+				return func(ctx context.Context, request connect.AnyRequest) (connect.AnyResponse, error) {
+					handlerID, _ = connect.CallIDFromContext(ctx)
+					return next(ctx, request)
+				}
+			})),
+		))
+		server := httptest.NewServer(mux)
+		t.Cleanup(server.Close)
+		var clientID string
+		client := pingv1connect.NewPingServiceClient(
+			server.Client(),
+			server.URL,
+			connect.WithProfile(connect.InternalMeshProfile()),
+			connect.WithInterceptors(connect.UnaryInterceptorFunc(func(next connect.UnaryFunc) connect.UnaryFunc {
+				return func(ctx context.Context, request connect.AnyRequest) (connect.AnyResponse, error) {
+					clientID, _ = connect.CallIDFromContext(ctx)
+					return next(ctx, request)
+				}
+			})),
+		)
+		response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Text: large}))
+		assert.Nil(t, err)
+		assert.Equal(t, len(response.Msg.Text), len(large))
+		assert.NotZero(t, clientID)
+		assert.Equal(t, handlerID, clientID)
+	})
+}
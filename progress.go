@@ -0,0 +1,101 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"net/http"
+	"sync"
+)
+
+// progressChunkSize is the granularity of request progress reports. Writes to
+// the request body block until net/http has consumed them, so splitting large
+// writes lets us report progress as the body is sent.
+const progressChunkSize = 16 * 1024
+
+// Progress describes how much of a unary call's request or response body has
+// been transferred. Sizes are of the HTTP body, so they include any
+// compression and protocol framing.
+type Progress struct {
+	Spec Spec
+	// Response is false while the request body is sent, and true while the
+	// response body is received.
+	Response bool
+	// Bytes is the number of bytes transferred so far.
+	Bytes int64
+	// Total is the size of the body, or -1 if it's unknown. Requests are
+	// always buffered, so their size is known; responses have a known size
+	// only if the server sets Content-Length, which Connect unary handlers
+	// usually do.
+	Total int64
+}
+
+// transferProgress tracks the bytes sent and received by a duplexHTTPCall.
+type transferProgress struct {
+	spec   Spec
+	report func(Progress)
+
+	mu            sync.Mutex
+	sent          int64
+	sendTotal     int64
+	received      int64
+	receiveTotal  int64
+	responseReady bool
+}
+
+// newTransferProgress returns nil unless progress is reported for the call.
+func newTransferProgress(spec Spec, report func(Progress)) *transferProgress {
+	if report == nil || spec.StreamType != StreamTypeUnary {
+		return nil
+	}
+	return &transferProgress{spec: spec, report: report, sendTotal: -1, receiveTotal: -1}
+}
+
+// expectBytes records the size of the request body. Marshalers call it before
+// writing, since they buffer the whole request.
+func (p *transferProgress) expectBytes(total int64) {
+	p.mu.Lock()
+	p.sendTotal = p.sent + total
+	p.mu.Unlock()
+}
+
+func (p *transferProgress) wrote(n int) {
+	p.mu.Lock()
+	p.sent += int64(n)
+	progress := Progress{Spec: p.spec, Bytes: p.sent, Total: p.sendTotal}
+	p.mu.Unlock()
+	p.report(progress)
+}
+
+func (p *transferProgress) read(response *http.Response, n int) {
+	p.mu.Lock()
+	if !p.responseReady {
+		p.responseReady = true
+		if response != nil && response.ContentLength >= 0 {
+			p.receiveTotal = response.ContentLength
+		}
+	}
+	p.received += int64(n)
+	progress := Progress{Spec: p.spec, Response: true, Bytes: p.received, Total: p.receiveTotal}
+	p.mu.Unlock()
+	p.report(progress)
+}
+
+// expectRequestBytes tells the writer's progress tracker, if any, the size of
+// the request body.
+func expectRequestBytes(writer any, total int) {
+	if call, ok := writer.(*duplexHTTPCall); ok && call.progress != nil {
+		call.progress.expectBytes(int64(total))
+	}
+}
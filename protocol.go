@@ -24,6 +24,9 @@ import (
 	"net/url"
 	"sort"
 	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
 )
 
 const (
@@ -33,6 +36,14 @@ const (
 	discardLimit = 1024 * 1024 * 4 // 4MiB
 )
 
+// The names of the RPC protocols supported by this module. Use them with
+// [WithHandlerProtocols].
+const (
+	ProtocolConnect = "connect"
+	ProtocolGRPC    = "grpc"
+	ProtocolGRPCWeb = "grpcweb"
+)
+
 var errNoTimeout = errors.New("no timeout")
 
 // A Protocol defines the HTTP semantics to use when sending and receiving
@@ -65,9 +76,24 @@ type protocolHandlerParams struct {
 	Codecs           readOnlyCodecs
 	CompressionPools readOnlyCompressionPools
 	CompressMinBytes int
-	BufferPool       *bufferPool
-	ReadMaxBytes     int
-	SendMaxBytes     int
+	// CodecCompressMinBytes overrides CompressMinBytes for particular codecs,
+	// keyed by codec name.
+	CodecCompressMinBytes map[string]int
+	CompressionPolicy     CompressionPolicy
+	PayloadVerifier       PayloadVerifier
+	BufferPool            *bufferPool
+	ReadMaxBytes          int
+	SendMaxBytes          int
+	FirstReadMaxBytes     int
+	FirstSendMaxBytes     int
+	MessageMetadata       bool
+	EnvelopeFlags         *envelopeFlagSet
+	LenientEncoding       bool
+	Initializer           func(Spec, any) error
+	ErrorFormatters       map[string]ErrorFormatter
+	GRPCStatusInErrors    bool
+	TimeoutHeader         *TimeoutHeader
+	SerializationTiming   func(context.Context, SerializationTiming)
 }
 
 // Handler is the server side of a protocol. HTTP handlers typically support
@@ -85,8 +111,9 @@ type protocolHandler interface {
 	// request's context, a nil cancellation function, and a nil error.
 	SetTimeout(*http.Request) (context.Context, context.CancelFunc, error)
 
-	// NewConn constructs a HandlerConn for the message exchange.
-	NewConn(http.ResponseWriter, *http.Request) (handlerConnCloser, bool)
+	// NewConn constructs a HandlerConn for the message exchange. If it can't,
+	// it writes the error to the client and then returns it.
+	NewConn(http.ResponseWriter, *http.Request) (handlerConnCloser, error)
 }
 
 // ClientParams are the arguments provided to a Protocol's NewClient method,
@@ -98,11 +125,40 @@ type protocolClientParams struct {
 	CompressionPools readOnlyCompressionPools
 	Codec            Codec
 	CompressMinBytes int
-	HTTPClient       HTTPClient
-	URL              string
-	BufferPool       *bufferPool
-	ReadMaxBytes     int
-	SendMaxBytes     int
+	// CodecCompressMinBytes overrides CompressMinBytes for particular codecs,
+	// keyed by codec name.
+	CodecCompressMinBytes map[string]int
+	CompressionPolicy     CompressionPolicy
+	PayloadSigner         PayloadSigner
+	AWSSigV4              *awsSigV4Signer
+	HTTPClient            HTTPClient
+	URL                   string
+	EnableGet             bool
+	GetMaxURLSize         int
+	BufferPool            *bufferPool
+	ReadMaxBytes          int
+	SendMaxBytes          int
+	FirstReadMaxBytes     int
+	FirstSendMaxBytes     int
+	ReadMaxHeaderBytes    int
+	CancelGracePeriod     time.Duration
+	// TimeoutSkew is subtracted from the timeout sent to the server, to
+	// account for network transit.
+	TimeoutSkew time.Duration
+	// UnaryResponseLimitBehavior applies to over-limit responses to unary
+	// calls.
+	UnaryResponseLimitBehavior ResponseLimitBehavior
+	MessageMetadata            bool
+	EnvelopeFlags              *envelopeFlagSet
+	HTTPStatusCodes            func(int) (Code, bool)
+	Initializer                func(Spec, any) error
+	TypeResolver               TypeResolver
+	// Progress, if non-nil, reports the transfer of unary request and
+	// response bodies.
+	Progress func(Progress)
+	// SerializationTiming, if non-nil, reports the time spent encoding and
+	// compressing each message.
+	SerializationTiming func(context.Context, SerializationTiming)
 	// The gRPC family of protocols always needs access to a Protobuf codec to
 	// marshal and unmarshal errors.
 	Protobuf Codec
@@ -134,8 +190,9 @@ type protocolClient interface {
 type errorTranslatingHandlerConnCloser struct {
 	handlerConnCloser
 
-	toWire   func(error) error
-	fromWire func(error) error
+	toWire      func(error) error
+	fromWire    func(error) error
+	initializer func(Spec, any) error
 }
 
 func (hc *errorTranslatingHandlerConnCloser) Send(msg any) error {
@@ -143,9 +200,40 @@ func (hc *errorTranslatingHandlerConnCloser) Send(msg any) error {
 }
 
 func (hc *errorTranslatingHandlerConnCloser) Receive(msg any) error {
+	if err := initializeMessage(hc.initializer, hc.Spec(), msg); err != nil {
+		return err
+	}
 	return hc.fromWire(hc.handlerConnCloser.Receive(msg))
 }
 
+func (hc *errorTranslatingHandlerConnCloser) SendWithMetadata(msg any, metadata http.Header) error {
+	return hc.fromWire(SendWithMetadata(hc.handlerConnCloser, msg, metadata))
+}
+
+func (hc *errorTranslatingHandlerConnCloser) ReceiveWithMetadata(msg any) (http.Header, error) {
+	if err := initializeMessage(hc.initializer, hc.Spec(), msg); err != nil {
+		return nil, err
+	}
+	metadata, err := ReceiveWithMetadata(hc.handlerConnCloser, msg)
+	return metadata, hc.fromWire(err)
+}
+
+func (hc *errorTranslatingHandlerConnCloser) SendWithEnvelopeFlags(msg any, flags []string) error {
+	return hc.fromWire(SendWithEnvelopeFlags(hc.handlerConnCloser, msg, flags...))
+}
+
+func (hc *errorTranslatingHandlerConnCloser) ReceiveWithEnvelopeFlags(msg any) ([]string, error) {
+	if err := initializeMessage(hc.initializer, hc.Spec(), msg); err != nil {
+		return nil, err
+	}
+	flags, err := ReceiveWithEnvelopeFlags(hc.handlerConnCloser, msg)
+	return flags, hc.fromWire(err)
+}
+
+func (hc *errorTranslatingHandlerConnCloser) CloseReceive() error {
+	return hc.fromWire(closeReceive(hc.handlerConnCloser))
+}
+
 func (hc *errorTranslatingHandlerConnCloser) Close(err error) error {
 	closeErr := hc.handlerConnCloser.Close(hc.toWire(err))
 	return hc.fromWire(closeErr)
@@ -158,7 +246,8 @@ func (hc *errorTranslatingHandlerConnCloser) Close(err error) error {
 type errorTranslatingClientConn struct {
 	StreamingClientConn
 
-	fromWire func(error) error
+	fromWire    func(error) error
+	initializer func(Spec, any) error
 }
 
 func (cc *errorTranslatingClientConn) Send(msg any) error {
@@ -166,9 +255,36 @@ func (cc *errorTranslatingClientConn) Send(msg any) error {
 }
 
 func (cc *errorTranslatingClientConn) Receive(msg any) error {
+	if err := initializeMessage(cc.initializer, cc.Spec(), msg); err != nil {
+		return err
+	}
 	return cc.fromWire(cc.StreamingClientConn.Receive(msg))
 }
 
+func (cc *errorTranslatingClientConn) SendWithMetadata(msg any, metadata http.Header) error {
+	return cc.fromWire(SendWithMetadata(cc.StreamingClientConn, msg, metadata))
+}
+
+func (cc *errorTranslatingClientConn) ReceiveWithMetadata(msg any) (http.Header, error) {
+	if err := initializeMessage(cc.initializer, cc.Spec(), msg); err != nil {
+		return nil, err
+	}
+	metadata, err := ReceiveWithMetadata(cc.StreamingClientConn, msg)
+	return metadata, cc.fromWire(err)
+}
+
+func (cc *errorTranslatingClientConn) SendWithEnvelopeFlags(msg any, flags []string) error {
+	return cc.fromWire(SendWithEnvelopeFlags(cc.StreamingClientConn, msg, flags...))
+}
+
+func (cc *errorTranslatingClientConn) ReceiveWithEnvelopeFlags(msg any) ([]string, error) {
+	if err := initializeMessage(cc.initializer, cc.Spec(), msg); err != nil {
+		return nil, err
+	}
+	flags, err := ReceiveWithEnvelopeFlags(cc.StreamingClientConn, msg)
+	return flags, cc.fromWire(err)
+}
+
 func (cc *errorTranslatingClientConn) CloseRequest() error {
 	return cc.fromWire(cc.StreamingClientConn.CloseRequest())
 }
@@ -180,21 +296,62 @@ func (cc *errorTranslatingClientConn) CloseResponse() error {
 // wrapHandlerConnWithCodedErrors ensures that we (1) automatically code
 // context-related errors correctly when writing them to the network, and (2)
 // return *Errors from all exported APIs.
-func wrapHandlerConnWithCodedErrors(conn handlerConnCloser) handlerConnCloser {
+func wrapHandlerConnWithCodedErrors(
+	ctx context.Context,
+	conn handlerConnCloser,
+	initializer func(Spec, any) error,
+) handlerConnCloser {
 	return &errorTranslatingHandlerConnCloser{
 		handlerConnCloser: conn,
-		toWire:            wrapIfContextError,
-		fromWire:          wrapIfUncoded,
+		initializer:       initializer,
+		toWire: func(err error) error {
+			return wrapIfContextDone(ctx, err)
+		},
+		fromWire: func(err error) error {
+			return wrapIfUncoded(wrapIfStreamContextDone(ctx, err))
+		},
 	}
 }
 
 // wrapClientConnWithCodedErrors ensures that we always return *Errors from
-// public APIs.
-func wrapClientConnWithCodedErrors(conn StreamingClientConn) StreamingClientConn {
+// public APIs, coding errors caused by the context appropriately.
+func wrapClientConnWithCodedErrors(
+	ctx context.Context,
+	conn StreamingClientConn,
+	initializer func(Spec, any) error,
+	resolver TypeResolver,
+) StreamingClientConn {
 	return &errorTranslatingClientConn{
 		StreamingClientConn: conn,
-		fromWire:            wrapIfUncoded,
+		initializer:         initializer,
+		fromWire: func(err error) error {
+			err = wrapIfUncoded(wrapIfStreamContextDone(ctx, err))
+			if connectErr, ok := asError(err); ok && resolver != nil {
+				connectErr.setTypeResolver(resolver)
+			}
+			return err
+		},
+	}
+}
+
+// initializeMessage prepares msg to be unmarshaled into, using the function
+// configured with WithInitializer (if any). The built-in Protobuf codecs merge
+// into initialized messages, so Protobuf messages are reset first: otherwise,
+// fields from a reused message would leak into the next one.
+func initializeMessage(initializer func(Spec, any) error, spec Spec, msg any) error {
+	if initializer == nil {
+		return nil
+	}
+	if protoMessage, ok := msg.(proto.Message); ok {
+		proto.Reset(protoMessage)
+	}
+	if err := initializer(spec, msg); err != nil {
+		if connectErr, ok := asError(err); ok {
+			return connectErr
+		}
+		return errorf(CodeInternal, "initialize %T: %w", msg, err)
 	}
+	return nil
 }
 
 func sortedAcceptPostValue(handlers []protocolHandler) string {
@@ -24,11 +24,14 @@ import (
 	"io"
 	"math"
 	"net/http"
+	"net/url"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/anypb"
 )
 
@@ -40,6 +43,14 @@ const (
 	connectStreamingHeaderAcceptCompression = "Connect-Accept-Encoding"
 	connectHeaderTimeout                    = "Connect-Timeout-Ms"
 
+	connectUnaryEncodingQueryParameter    = "encoding"
+	connectUnaryMessageQueryParameter     = "message"
+	connectUnaryBase64QueryParameter      = "base64"
+	connectUnaryCompressionQueryParameter = "compression"
+	connectUnaryConnectQueryParameter     = "connect"
+	connectUnaryConnectQueryValue         = "v1"
+	connectUnaryDefaultGetMaxURLSize      = 8 * 1024
+
 	connectFlagEnvelopeEndStream = 0b00000010
 
 	connectUnaryContentTypePrefix     = "application/"
@@ -70,7 +81,10 @@ func (*protocolConnect) NewClient(params *protocolClientParams) (protocolClient,
 	if err := validateRequestURL(params.URL); err != nil {
 		return nil, err
 	}
-	return &connectClient{protocolClientParams: *params}, nil
+	return &connectClient{
+		protocolClientParams: *params,
+		userAgent:            connectUserAgent(),
+	}, nil
 }
 
 type connectHandler struct {
@@ -83,34 +97,54 @@ func (h *connectHandler) ContentTypes() map[string]struct{} {
 	return h.accept
 }
 
-func (*connectHandler) SetTimeout(request *http.Request) (context.Context, context.CancelFunc, error) {
-	timeout := request.Header.Get(connectHeaderTimeout)
-	if timeout == "" {
-		return request.Context(), nil, nil
+func (h *connectHandler) SetTimeout(request *http.Request) (context.Context, context.CancelFunc, error) {
+	var timeout time.Duration
+	var hasTimeout bool
+	if encoded := request.Header.Get(connectHeaderTimeout); encoded != "" {
+		if len(encoded) > 10 {
+			return nil, nil, errorf(CodeInvalidArgument, "parse timeout: %q has >10 digits", encoded)
+		}
+		millis, err := strconv.ParseInt(encoded, 10 /* base */, 64 /* bitsize */)
+		if err != nil {
+			return nil, nil, errorf(CodeInvalidArgument, "parse timeout: %w", err)
+		}
+		timeout, hasTimeout = time.Duration(millis)*time.Millisecond, true
 	}
-	if len(timeout) > 10 {
-		return nil, nil, errorf(CodeInvalidArgument, "parse timeout: %q has >10 digits", timeout)
+	if h.TimeoutHeader != nil {
+		var err error
+		timeout, hasTimeout, err = h.TimeoutHeader.resolve(request.Header, timeout, hasTimeout)
+		if err != nil {
+			return nil, nil, err
+		}
 	}
-	millis, err := strconv.ParseInt(timeout, 10 /* base */, 64 /* bitsize */)
-	if err != nil {
-		return nil, nil, errorf(CodeInvalidArgument, "parse timeout: %w", err)
+	if !hasTimeout {
+		return request.Context(), nil, nil
 	}
-	ctx, cancel := context.WithTimeout(
-		request.Context(),
-		time.Duration(millis)*time.Millisecond,
-	)
+	ctx, cancel := context.WithTimeout(request.Context(), timeout)
 	return ctx, cancel, nil
 }
 
 func (h *connectHandler) NewConn(
 	responseWriter http.ResponseWriter,
 	request *http.Request,
-) (handlerConnCloser, bool) {
+) (handlerConnCloser, error) {
 	// We need to parse metadata before entering the interceptor stack; we'll
 	// send the error to the client later on.
 	var contentEncoding, acceptEncoding string
-	if h.Spec.StreamType == StreamTypeUnary {
-		contentEncoding = request.Header.Get(connectUnaryHeaderCompression)
+	contentType := request.Header.Get(headerContentType)
+	body := io.Reader(request.Body)
+	var getErr *Error
+	if request.Method == http.MethodGet || request.Method == http.MethodHead {
+		// handler.go only routes GETs and HEADs for unary procedures here.
+		query := request.URL.Query()
+		contentType = connectUnaryContentTypePrefix + query.Get(connectUnaryEncodingQueryParameter)
+		contentEncoding = normalizeContentCoding(query.Get(connectUnaryCompressionQueryParameter))
+		acceptEncoding = request.Header.Get(connectUnaryHeaderAcceptCompression)
+		var message []byte
+		message, getErr = decodeConnectGetMessage(query)
+		body = bytes.NewReader(message)
+	} else if h.Spec.StreamType == StreamTypeUnary {
+		contentEncoding = normalizeContentCoding(request.Header.Get(connectUnaryHeaderCompression))
 		acceptEncoding = request.Header.Get(connectUnaryHeaderAcceptCompression)
 	} else {
 		contentEncoding = request.Header.Get(connectStreamingHeaderCompression)
@@ -121,6 +155,9 @@ func (h *connectHandler) NewConn(
 		contentEncoding,
 		acceptEncoding,
 	)
+	if failed == nil {
+		failed = getErr
+	}
 
 	// Write any remaining headers here:
 	// (1) any writes to the stream will implicitly send the headers, so we
@@ -130,7 +167,7 @@ func (h *connectHandler) NewConn(
 	// Since we know that these header keys are already in canonical form, we can
 	// skip the normalization in Header.Set.
 	header := responseWriter.Header()
-	header[headerContentType] = []string{request.Header.Get(headerContentType)}
+	header[headerContentType] = []string{contentType}
 	acceptCompressionHeader := connectUnaryHeaderAcceptCompression
 	if h.Spec.StreamType != StreamTypeUnary {
 		acceptCompressionHeader = connectStreamingHeaderAcceptCompression
@@ -143,37 +180,46 @@ func (h *connectHandler) NewConn(
 		}
 	}
 	header[acceptCompressionHeader] = []string{h.CompressionPools.CommaSeparatedNames()}
+	messageMetadata := negotiateMessageMetadata(h.MessageMetadata, request.Header, header)
+	envelopeFlags := negotiateEnvelopeFlags(h.EnvelopeFlags, request.Header, header)
 
-	codecName := connectCodecFromContentType(
-		h.Spec.StreamType,
-		request.Header.Get(headerContentType),
-	)
+	codecName := connectCodecFromContentType(h.Spec.StreamType, contentType)
 	codec := h.Codecs.Get(codecName) // handler.go guarantees this is not nil
+	compressMinBytes := codecCompressMinBytes(h.CompressMinBytes, h.CodecCompressMinBytes, codec)
+	compressPolicy := h.CompressionPolicy.bind(h.Spec, codec)
+	timer := newSerializationTimer(request.Context(), h.Spec, h.SerializationTiming)
 
 	var conn handlerConnCloser
-	peer := Peer{Addr: request.RemoteAddr}
+	peer := newPeerFromRequest(request)
 	if h.Spec.StreamType == StreamTypeUnary {
 		conn = &connectUnaryHandlerConn{
-			spec:           h.Spec,
-			peer:           peer,
-			request:        request,
-			responseWriter: responseWriter,
+			spec:            h.Spec,
+			peer:            peer,
+			request:         request,
+			responseWriter:  responseWriter,
+			errorFormatters: h.ErrorFormatters,
+			grpcStatus:      h.GRPCStatusInErrors,
 			marshaler: connectUnaryMarshaler{
 				writer:           responseWriter,
 				codec:            codec,
-				compressMinBytes: h.CompressMinBytes,
+				compressMinBytes: compressMinBytes,
+				compressPolicy:   compressPolicy,
 				compressionName:  responseCompression,
 				compressionPool:  h.CompressionPools.Get(responseCompression),
 				bufferPool:       h.BufferPool,
 				header:           responseWriter.Header(),
-				sendMaxBytes:     h.SendMaxBytes,
+				sendMaxBytes:     firstMessageMaxBytes(false, h.FirstSendMaxBytes, h.SendMaxBytes),
+				timer:            timer,
 			},
 			unmarshaler: connectUnaryUnmarshaler{
-				reader:          request.Body,
+				reader:          body,
 				codec:           codec,
 				compressionPool: h.CompressionPools.Get(requestCompression),
 				bufferPool:      h.BufferPool,
-				readMaxBytes:    h.ReadMaxBytes,
+				readMaxBytes:    firstMessageMaxBytes(false, h.FirstReadMaxBytes, h.ReadMaxBytes),
+				lenient:         h.LenientEncoding,
+				verifyPayload:   h.PayloadVerifier.bind(h.Spec, request.Header),
+				timer:           timer,
 			},
 			responseTrailer: make(http.Header),
 		}
@@ -185,39 +231,66 @@ func (h *connectHandler) NewConn(
 			responseWriter: responseWriter,
 			marshaler: connectStreamingMarshaler{
 				envelopeWriter: envelopeWriter{
-					writer:           responseWriter,
-					codec:            codec,
-					compressMinBytes: h.CompressMinBytes,
-					compressionPool:  h.CompressionPools.Get(responseCompression),
-					bufferPool:       h.BufferPool,
-					sendMaxBytes:     h.SendMaxBytes,
+					writer:            responseWriter,
+					codec:             codec,
+					compressMinBytes:  compressMinBytes,
+					compressPolicy:    compressPolicy,
+					compressionPool:   h.CompressionPools.Get(responseCompression),
+					compressionName:   responseCompression,
+					bufferPool:        h.BufferPool,
+					sendMaxBytes:      h.SendMaxBytes,
+					firstSendMaxBytes: h.FirstSendMaxBytes,
+					sendMetadata:      messageMetadata,
+					envelopeFlags:     envelopeFlags,
+					timer:             timer,
 				},
 			},
 			unmarshaler: connectStreamingUnmarshaler{
 				envelopeReader: envelopeReader{
-					reader:          request.Body,
-					codec:           codec,
-					compressionPool: h.CompressionPools.Get(requestCompression),
-					bufferPool:      h.BufferPool,
-					readMaxBytes:    h.ReadMaxBytes,
+					reader:            request.Body,
+					codec:             codec,
+					compressionPool:   h.CompressionPools.Get(requestCompression),
+					bufferPool:        h.BufferPool,
+					readMaxBytes:      h.ReadMaxBytes,
+					firstReadMaxBytes: h.FirstReadMaxBytes,
+					readMetadata:      messageMetadata,
+					envelopeFlags:     envelopeFlags,
+					timer:             timer,
 				},
 			},
 			responseTrailer: make(http.Header),
 		}
 	}
-	conn = wrapHandlerConnWithCodedErrors(conn)
+	conn = wrapHandlerConnWithCodedErrors(request.Context(), conn, h.Initializer)
 	// We can't return failed as-is: a nil *Error is non-nil when returned as an
 	// error interface.
 	if failed != nil {
 		// Negotiation failed, so we can't establish a stream.
 		_ = conn.Close(failed)
-		return nil, false
+		return nil, failed
 	}
-	return conn, true
+	return conn, nil
+}
+
+// decodeConnectGetMessage decodes the request message from the query string
+// of a Connect unary GET request. Binary and compressed messages are base64
+// encoded with the URL-safe alphabet, with or without padding.
+func decodeConnectGetMessage(query url.Values) ([]byte, *Error) {
+	message := query.Get(connectUnaryMessageQueryParameter)
+	if query.Get(connectUnaryBase64QueryParameter) != "1" {
+		return []byte(message), nil
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(message, "="))
+	if err != nil {
+		return nil, errorf(CodeInvalidArgument, "decode message query parameter: %w", err)
+	}
+	return decoded, nil
 }
 
 type connectClient struct {
 	protocolClientParams
+
+	userAgent string // formatted once, rather than for every call
 }
 
 func (c *connectClient) Peer() Peer {
@@ -227,7 +300,7 @@ func (c *connectClient) Peer() Peer {
 func (c *connectClient) WriteRequestHeader(streamType StreamType, header http.Header) {
 	// We know these header keys are in canonical form, so we can bypass all the
 	// checks in Header.Set.
-	header[headerUserAgent] = []string{connectUserAgent()}
+	header[headerUserAgent] = []string{c.userAgent}
 	header[headerContentType] = []string{
 		connectContentTypeFromCodecName(streamType, c.Codec.Name()),
 	}
@@ -249,6 +322,12 @@ func (c *connectClient) WriteRequestHeader(streamType StreamType, header http.He
 	if acceptCompression := c.CompressionPools.CommaSeparatedNames(); acceptCompression != "" {
 		header[acceptCompressionHeader] = []string{acceptCompression}
 	}
+	if c.MessageMetadata {
+		header[headerMessageMetadata] = []string{messageMetadataVersion}
+	}
+	if c.EnvelopeFlags != nil {
+		header[headerEnvelopeFlags] = []string{c.EnvelopeFlags.String()}
+	}
 }
 
 func (c *connectClient) NewConn(
@@ -257,7 +336,7 @@ func (c *connectClient) NewConn(
 	header http.Header,
 ) StreamingClientConn {
 	if deadline, ok := ctx.Deadline(); ok {
-		millis := int64(time.Until(deadline) / time.Millisecond)
+		millis := int64(timeoutWithSkew(deadline, c.TimeoutSkew+deadlineMargin(ctx)) / time.Millisecond)
 		if millis > 0 {
 			encoded := strconv.FormatInt(millis, 10 /* base */)
 			if len(encoded) <= 10 {
@@ -265,30 +344,50 @@ func (c *connectClient) NewConn(
 			} // else effectively unbounded
 		}
 	}
-	duplexCall := newDuplexHTTPCall(ctx, c.HTTPClient, c.URL, spec, header)
+	duplexCall := newDuplexHTTPCall(ctx, c.HTTPClient, c.URL, spec, header, c.CancelGracePeriod)
+	duplexCall.readMaxHeaderBytes = c.ReadMaxHeaderBytes
+	duplexCall.progress = newTransferProgress(spec, c.Progress)
+	compressMinBytes := codecCompressMinBytes(c.CompressMinBytes, c.CodecCompressMinBytes, c.Codec)
+	compressPolicy := c.CompressionPolicy.bind(spec, c.Codec)
+	timer := newSerializationTimer(ctx, spec, c.SerializationTiming)
 	var conn StreamingClientConn
 	if spec.StreamType == StreamTypeUnary {
+		var getCall *duplexHTTPCall
+		if c.EnableGet && spec.IdempotencyLevel == IdempotencyNoSideEffects && c.AWSSigV4 == nil {
+			getCall = duplexCall
+		}
 		unaryConn := &connectUnaryClientConn{
 			spec:             spec,
-			peer:             c.Peer(),
 			duplexCall:       duplexCall,
 			compressionPools: c.CompressionPools,
 			bufferPool:       c.BufferPool,
+			httpStatusCodes:  c.HTTPStatusCodes,
 			marshaler: connectUnaryMarshaler{
 				writer:           duplexCall,
 				codec:            c.Codec,
-				compressMinBytes: c.CompressMinBytes,
+				compressMinBytes: compressMinBytes,
+				compressPolicy:   compressPolicy,
 				compressionName:  c.CompressionName,
 				compressionPool:  c.CompressionPools.Get(c.CompressionName),
 				bufferPool:       c.BufferPool,
 				header:           duplexCall.Header(),
-				sendMaxBytes:     c.SendMaxBytes,
+				signPayload: chainPayloadSigners(
+					c.PayloadSigner.bind(spec, duplexCall.Header()),
+					c.AWSSigV4.bind(ctx, spec, c.URL, duplexCall.Header()),
+				),
+				sendMaxBytes:  firstMessageMaxBytes(false, c.FirstSendMaxBytes, c.SendMaxBytes),
+				getCall:       getCall,
+				getMaxURLSize: c.GetMaxURLSize,
+				timer:         timer,
 			},
 			unmarshaler: connectUnaryUnmarshaler{
-				reader:       duplexCall,
-				codec:        c.Codec,
-				bufferPool:   c.BufferPool,
-				readMaxBytes: c.ReadMaxBytes,
+				reader:          duplexCall,
+				codec:           c.Codec,
+				bufferPool:      c.BufferPool,
+				readMaxBytes:    firstMessageMaxBytes(false, c.FirstReadMaxBytes, c.ReadMaxBytes),
+				retainOverLimit: c.UnaryResponseLimitBehavior == ResponseLimitRetainPrefix,
+				sniffGzip:       true,
+				timer:           timer,
 			},
 			responseHeader:  make(http.Header),
 			responseTrailer: make(http.Header),
@@ -298,27 +397,36 @@ func (c *connectClient) NewConn(
 	} else {
 		streamingConn := &connectStreamingClientConn{
 			spec:             spec,
-			peer:             c.Peer(),
 			duplexCall:       duplexCall,
 			compressionPools: c.CompressionPools,
 			bufferPool:       c.BufferPool,
+			httpStatusCodes:  c.HTTPStatusCodes,
 			codec:            c.Codec,
 			marshaler: connectStreamingMarshaler{
 				envelopeWriter: envelopeWriter{
-					writer:           duplexCall,
-					codec:            c.Codec,
-					compressMinBytes: c.CompressMinBytes,
-					compressionPool:  c.CompressionPools.Get(c.CompressionName),
-					bufferPool:       c.BufferPool,
-					sendMaxBytes:     c.SendMaxBytes,
+					writer:            duplexCall,
+					codec:             c.Codec,
+					compressMinBytes:  compressMinBytes,
+					compressPolicy:    compressPolicy,
+					compressionPool:   c.CompressionPools.Get(c.CompressionName),
+					bufferPool:        c.BufferPool,
+					sendMaxBytes:      c.SendMaxBytes,
+					firstSendMaxBytes: c.FirstSendMaxBytes,
+					sendMetadata:      c.MessageMetadata,
+					envelopeFlags:     c.EnvelopeFlags,
+					timer:             timer,
 				},
 			},
 			unmarshaler: connectStreamingUnmarshaler{
 				envelopeReader: envelopeReader{
-					reader:       duplexCall,
-					codec:        c.Codec,
-					bufferPool:   c.BufferPool,
-					readMaxBytes: c.ReadMaxBytes,
+					reader:            duplexCall,
+					codec:             c.Codec,
+					bufferPool:        c.BufferPool,
+					readMaxBytes:      c.ReadMaxBytes,
+					firstReadMaxBytes: c.FirstReadMaxBytes,
+					readMetadata:      c.MessageMetadata,
+					envelopeFlags:     c.EnvelopeFlags,
+					timer:             timer,
 				},
 			},
 			responseHeader:  make(http.Header),
@@ -327,15 +435,15 @@ func (c *connectClient) NewConn(
 		conn = streamingConn
 		duplexCall.SetValidateResponse(streamingConn.validateResponse)
 	}
-	return wrapClientConnWithCodedErrors(conn)
+	return wrapClientConnWithCodedErrors(ctx, conn, c.Initializer, c.TypeResolver)
 }
 
 type connectUnaryClientConn struct {
 	spec             Spec
-	peer             Peer
 	duplexCall       *duplexHTTPCall
 	compressionPools readOnlyCompressionPools
 	bufferPool       *bufferPool
+	httpStatusCodes  func(int) (Code, bool)
 	marshaler        connectUnaryMarshaler
 	unmarshaler      connectUnaryUnmarshaler
 	responseHeader   http.Header
@@ -347,7 +455,7 @@ func (cc *connectUnaryClientConn) Spec() Spec {
 }
 
 func (cc *connectUnaryClientConn) Peer() Peer {
-	return cc.peer
+	return cc.duplexCall.Peer()
 }
 
 func (cc *connectUnaryClientConn) Send(msg any) error {
@@ -388,17 +496,24 @@ func (cc *connectUnaryClientConn) CloseResponse() error {
 }
 
 func (cc *connectUnaryClientConn) validateResponse(response *http.Response) *Error {
+	// Adopt the response's header map rather than copying it, moving the
+	// prefixed trailers into their own map.
 	for k, v := range response.Header {
-		if !strings.HasPrefix(k, connectUnaryTrailerPrefix) {
-			cc.responseHeader[k] = v
-			continue
+		if strings.HasPrefix(k, connectUnaryTrailerPrefix) {
+			cc.responseTrailer[strings.TrimPrefix(k, connectUnaryTrailerPrefix)] = v
+			delete(response.Header, k)
 		}
-		cc.responseTrailer[strings.TrimPrefix(k, connectUnaryTrailerPrefix)] = v
 	}
-	compression := response.Header.Get(connectUnaryHeaderCompression)
+	cc.responseHeader = response.Header
+	compression := normalizeContentCoding(response.Header.Get(connectUnaryHeaderCompression))
+	compressionPool := cc.compressionPools.Get(compression)
+	if compression == compressionGzip && compressionPool == nil {
+		// Proxies may gzip responses even if the client hasn't registered gzip.
+		compressionPool = httpGzipCompressionPool
+	}
 	if compression != "" &&
 		compression != compressionIdentity &&
-		!cc.compressionPools.Contains(compression) {
+		compressionPool == nil {
 		return errorf(
 			CodeInternal,
 			"unknown encoding %q: accepted encodings are %v",
@@ -409,31 +524,29 @@ func (cc *connectUnaryClientConn) validateResponse(response *http.Response) *Err
 	if response.StatusCode != http.StatusOK {
 		unmarshaler := connectUnaryUnmarshaler{
 			reader:          response.Body,
-			compressionPool: cc.compressionPools.Get(compression),
+			compressionPool: compressionPool,
 			bufferPool:      cc.bufferPool,
+			sniffGzip:       true,
 		}
 		var wireErr connectWireError
 		if err := unmarshaler.UnmarshalFunc(&wireErr, json.Unmarshal); err != nil {
-			return NewError(
-				connectHTTPToCode(response.StatusCode),
-				errors.New(response.Status),
-			)
+			return newHTTPStatusError(response, connectHTTPToCode, cc.httpStatusCodes)
 		}
 		serverErr := wireErr.asError()
 		serverErr.meta = cc.responseHeader.Clone()
 		mergeHeaders(serverErr.meta, cc.responseTrailer)
 		return serverErr
 	}
-	cc.unmarshaler.compressionPool = cc.compressionPools.Get(compression)
+	cc.unmarshaler.compressionPool = compressionPool
 	return nil
 }
 
 type connectStreamingClientConn struct {
 	spec             Spec
-	peer             Peer
 	duplexCall       *duplexHTTPCall
 	compressionPools readOnlyCompressionPools
 	bufferPool       *bufferPool
+	httpStatusCodes  func(int) (Code, bool)
 	codec            Codec
 	marshaler        connectStreamingMarshaler
 	unmarshaler      connectStreamingUnmarshaler
@@ -446,7 +559,7 @@ func (cc *connectStreamingClientConn) Spec() Spec {
 }
 
 func (cc *connectStreamingClientConn) Peer() Peer {
-	return cc.peer
+	return cc.duplexCall.Peer()
 }
 
 func (cc *connectStreamingClientConn) Send(msg any) error {
@@ -456,6 +569,35 @@ func (cc *connectStreamingClientConn) Send(msg any) error {
 	return nil // must be a literal nil: nil *Error is a non-nil error
 }
 
+func (cc *connectStreamingClientConn) SendWithMetadata(msg any, metadata http.Header) error {
+	if err := cc.marshaler.WriteMetadata(metadata); err != nil {
+		return err
+	}
+	return cc.Send(msg)
+}
+
+func (cc *connectStreamingClientConn) ReceiveWithMetadata(msg any) (http.Header, error) {
+	if err := cc.Receive(msg); err != nil {
+		return nil, err
+	}
+	return cc.unmarshaler.metadata, nil
+}
+
+func (cc *connectStreamingClientConn) SendWithEnvelopeFlags(msg any, flags []string) error {
+	bits := cc.marshaler.envelopeFlags.bits(flags)
+	if err := cc.marshaler.MarshalWithFlags(msg, bits); err != nil {
+		return err
+	}
+	return nil // must be a literal nil: nil *Error is a non-nil error
+}
+
+func (cc *connectStreamingClientConn) ReceiveWithEnvelopeFlags(msg any) ([]string, error) {
+	if err := cc.Receive(msg); err != nil {
+		return nil, err
+	}
+	return cc.unmarshaler.envelopeFlags.names(cc.unmarshaler.flags), nil
+}
+
 func (cc *connectStreamingClientConn) RequestHeader() http.Header {
 	return cc.duplexCall.Header()
 }
@@ -506,7 +648,7 @@ func (cc *connectStreamingClientConn) CloseResponse() error {
 
 func (cc *connectStreamingClientConn) validateResponse(response *http.Response) *Error {
 	if response.StatusCode != http.StatusOK {
-		return errorf(connectHTTPToCode(response.StatusCode), "HTTP status %v", response.Status)
+		return newHTTPStatusError(response, connectHTTPToCode, cc.httpStatusCodes)
 	}
 	compression := response.Header.Get(connectStreamingHeaderCompression)
 	if compression != "" &&
@@ -520,7 +662,9 @@ func (cc *connectStreamingClientConn) validateResponse(response *http.Response)
 		)
 	}
 	cc.unmarshaler.compressionPool = cc.compressionPools.Get(compression)
-	mergeHeaders(cc.responseHeader, response.Header)
+	// Nothing can write to the response headers before the response arrives,
+	// so we can adopt net/http's map rather than copying it.
+	cc.responseHeader = response.Header
 	return nil
 }
 
@@ -533,6 +677,8 @@ type connectUnaryHandlerConn struct {
 	unmarshaler     connectUnaryUnmarshaler
 	responseTrailer http.Header
 	wroteBody       bool
+	errorFormatters map[string]ErrorFormatter
+	grpcStatus      bool
 }
 
 func (hc *connectUnaryHandlerConn) Spec() Spec {
@@ -578,10 +724,29 @@ func (hc *connectUnaryHandlerConn) Close(err error) error {
 	if err == nil {
 		return hc.request.Body.Close()
 	}
-	// In unary Connect, errors always use application/json.
-	hc.responseWriter.Header().Set(headerContentType, connectUnaryContentTypeJSON)
+	// In unary Connect, errors use application/json unless the client asked for
+	// a format registered with WithErrorFormatter.
+	contentType := connectUnaryContentTypeJSON
+	var data []byte
+	var marshalErr error
+	if formatContentType, format := negotiateErrorFormatter(hc.errorFormatters, hc.request); format != nil {
+		contentType = formatContentType
+		connectErr, ok := asError(err)
+		if !ok {
+			connectErr = NewError(CodeUnknown, err)
+		}
+		data, marshalErr = format(connectErr)
+	} else {
+		wire := newConnectWireError(err)
+		if hc.grpcStatus {
+			marshalErr = wire.attachGRPCStatus(err)
+		}
+		if marshalErr == nil {
+			data, marshalErr = json.Marshal(wire)
+		}
+	}
+	hc.responseWriter.Header().Set(headerContentType, contentType)
 	hc.responseWriter.WriteHeader(connectCodeToHTTP(CodeOf(err)))
-	data, marshalErr := json.Marshal(newConnectWireError(err))
 	if marshalErr != nil {
 		_ = hc.request.Body.Close()
 		return errorf(CodeInternal, "marshal error: %w", err)
@@ -613,6 +778,7 @@ type connectStreamingHandlerConn struct {
 	marshaler       connectStreamingMarshaler
 	unmarshaler     connectStreamingUnmarshaler
 	responseTrailer http.Header
+	receiveClosed   uint32 // atomic
 }
 
 func (hc *connectStreamingHandlerConn) Spec() Spec {
@@ -624,7 +790,14 @@ func (hc *connectStreamingHandlerConn) Peer() Peer {
 }
 
 func (hc *connectStreamingHandlerConn) Receive(msg any) error {
+	if atomic.LoadUint32(&hc.receiveClosed) != 0 {
+		return io.EOF
+	}
 	if err := hc.unmarshaler.Unmarshal(msg); err != nil {
+		if atomic.LoadUint32(&hc.receiveClosed) != 0 {
+			// CloseReceive interrupted the read.
+			return io.EOF
+		}
 		// Clients may not send end-of-stream metadata, so we don't need to handle
 		// errSpecialEnvelope.
 		return err
@@ -632,6 +805,43 @@ func (hc *connectStreamingHandlerConn) Receive(msg any) error {
 	return nil // must be a literal nil: nil *Error is a non-nil error
 }
 
+func (hc *connectStreamingHandlerConn) ReceiveWithMetadata(msg any) (http.Header, error) {
+	if err := hc.Receive(msg); err != nil {
+		return nil, err
+	}
+	return hc.unmarshaler.metadata, nil
+}
+
+func (hc *connectStreamingHandlerConn) SendWithMetadata(msg any, metadata http.Header) error {
+	if err := hc.marshaler.WriteMetadata(metadata); err != nil {
+		return err
+	}
+	return hc.Send(msg)
+}
+
+func (hc *connectStreamingHandlerConn) ReceiveWithEnvelopeFlags(msg any) ([]string, error) {
+	if err := hc.Receive(msg); err != nil {
+		return nil, err
+	}
+	return hc.unmarshaler.envelopeFlags.names(hc.unmarshaler.flags), nil
+}
+
+func (hc *connectStreamingHandlerConn) SendWithEnvelopeFlags(msg any, flags []string) error {
+	defer flushResponseWriter(hc.responseWriter)
+	bits := hc.marshaler.envelopeFlags.bits(flags)
+	if err := hc.marshaler.MarshalWithFlags(msg, bits); err != nil {
+		return err
+	}
+	return nil // must be a literal nil: nil *Error is a non-nil error
+}
+
+func (hc *connectStreamingHandlerConn) CloseReceive() error {
+	// Subsequent calls to Receive see a clean end of stream. Closing the body
+	// also interrupts a concurrent Receive.
+	atomic.StoreUint32(&hc.receiveClosed, 1)
+	return hc.request.Body.Close()
+}
+
 func (hc *connectStreamingHandlerConn) RequestHeader() http.Header {
 	return hc.request.Header
 }
@@ -737,22 +947,32 @@ type connectUnaryMarshaler struct {
 	writer           io.Writer
 	codec            Codec
 	compressMinBytes int
+	compressPolicy   func(size int) bool // overrides compressMinBytes
+	signPayload      func([]byte) *Error
 	compressionName  string
 	compressionPool  *compressionPool
 	bufferPool       *bufferPool
 	header           http.Header
 	sendMaxBytes     int
+	// If getCall is set, the message is sent in the query string of a GET
+	// request rather than in the request body, unless the URL would be longer
+	// than getMaxURLSize.
+	getCall       *duplexHTTPCall
+	getMaxURLSize int
+	timer         *serializationTimer
 }
 
 func (m *connectUnaryMarshaler) Marshal(message any) *Error {
-	data, err := m.codec.Marshal(message)
+	start := m.timer.start()
+	data, err := m.marshal(message)
 	if err != nil {
 		return errorf(CodeInternal, "marshal message: %w", err)
 	}
+	m.timer.observe(SerializationMarshal, start, len(data))
 	// Can't avoid allocating the slice, but we can reuse it.
 	uncompressed := bytes.NewBuffer(data)
 	defer m.bufferPool.Put(uncompressed)
-	if len(data) < m.compressMinBytes || m.compressionPool == nil {
+	if m.compressionPool == nil || !shouldCompress(len(data), m.compressMinBytes, m.compressPolicy) {
 		if m.sendMaxBytes > 0 && len(data) > m.sendMaxBytes {
 			return NewError(CodeResourceExhausted, fmt.Errorf("message size %d exceeds sendMaxBytes %d", len(data), m.sendMaxBytes))
 		}
@@ -760,9 +980,11 @@ func (m *connectUnaryMarshaler) Marshal(message any) *Error {
 	}
 	compressed := m.bufferPool.Get()
 	defer m.bufferPool.Put(compressed)
+	start = m.timer.start()
 	if err := m.compressionPool.Compress(compressed, uncompressed); err != nil {
 		return err
 	}
+	m.timer.observe(SerializationCompress, start, len(data))
 	if m.sendMaxBytes > 0 && compressed.Len() > m.sendMaxBytes {
 		return NewError(CodeResourceExhausted, fmt.Errorf("compressed message size %d exceeds sendMaxBytes %d", compressed.Len(), m.sendMaxBytes))
 	}
@@ -770,7 +992,26 @@ func (m *connectUnaryMarshaler) Marshal(message any) *Error {
 	return m.write(compressed.Bytes())
 }
 
+func (m *connectUnaryMarshaler) marshal(message any) ([]byte, error) {
+	if _, lazy := message.(lazyMessage); !lazy && m.getCall != nil {
+		// Equal GET requests should have equal URLs, so they can be cached.
+		if stable, ok := m.codec.(StableCodec); ok {
+			return stable.MarshalStable(message)
+		}
+	}
+	return marshalMessage(m.codec, message)
+}
+
 func (m *connectUnaryMarshaler) write(data []byte) *Error {
+	if m.signPayload != nil {
+		if err := m.signPayload(data); err != nil {
+			return err
+		}
+	}
+	if m.getCall != nil && m.writeGet(data) {
+		return nil
+	}
+	expectRequestBytes(m.writer, len(data))
 	if _, err := m.writer.Write(data); err != nil {
 		if connectErr, ok := asError(err); ok {
 			return connectErr
@@ -780,6 +1021,36 @@ func (m *connectUnaryMarshaler) write(data []byte) *Error {
 	return nil
 }
 
+// writeGet encodes the message in the query string of a GET request. Text
+// messages are sent as-is, and binary or compressed messages are base64
+// encoded. The query parameters are sorted, so equal messages produce equal
+// URLs. If the URL would be too long, writeGet leaves the request untouched
+// and returns false, so the message is sent with POST instead.
+func (m *connectUnaryMarshaler) writeGet(data []byte) bool {
+	query := make(url.Values, 5)
+	query.Set(connectUnaryConnectQueryParameter, connectUnaryConnectQueryValue)
+	query.Set(connectUnaryEncodingQueryParameter, m.codec.Name())
+	compression := m.header.Get(connectUnaryHeaderCompression)
+	if compression != "" {
+		query.Set(connectUnaryCompressionQueryParameter, compression)
+	}
+	if name := m.codec.Name(); compression == "" && (name == codecNameJSON || name == codecNameJSONCharsetUTF8) {
+		query.Set(connectUnaryMessageQueryParameter, string(data))
+	} else {
+		query.Set(connectUnaryBase64QueryParameter, "1")
+		query.Set(connectUnaryMessageQueryParameter, base64.RawURLEncoding.EncodeToString(data))
+	}
+	rawQuery := query.Encode()
+	if m.getMaxURLSize > 0 && m.getCall.urlSizeWithQuery(rawQuery) > m.getMaxURLSize {
+		return false
+	}
+	// GET requests don't have a body, so they don't describe one.
+	delete(m.header, connectUnaryHeaderCompression)
+	delete(m.header, headerContentType)
+	m.getCall.convertToGet(rawQuery)
+	return true
+}
+
 type connectUnaryUnmarshaler struct {
 	reader          io.Reader
 	codec           Codec
@@ -787,10 +1058,32 @@ type connectUnaryUnmarshaler struct {
 	bufferPool      *bufferPool
 	alreadyRead     bool
 	readMaxBytes    int
+	// sniffGzip allows the unmarshaler to recover from intermediaries that gzip
+	// the body without setting Content-Encoding. If the body can't be
+	// unmarshaled and looks like gzip, it's decompressed and unmarshaled again.
+	sniffGzip bool
+	// lenient allows the unmarshaler to recover from intermediaries that
+	// decompress the body without removing Content-Encoding. If the body can't
+	// be decompressed, it's unmarshaled as-is.
+	lenient bool
+	// retainOverLimit keeps the first readMaxBytes of an over-limit message in
+	// the returned error.
+	retainOverLimit bool
+	verifyPayload   func([]byte) *Error
+	timer           *serializationTimer
 }
 
 func (u *connectUnaryUnmarshaler) Unmarshal(message any) *Error {
-	return u.UnmarshalFunc(message, u.codec.Unmarshal)
+	return u.UnmarshalFunc(message, u.unmarshal)
+}
+
+func (u *connectUnaryUnmarshaler) unmarshal(data []byte, message any) error {
+	start := u.timer.start()
+	if err := unmarshalMessage(u.codec, data, message); err != nil {
+		return err
+	}
+	u.timer.observe(SerializationUnmarshal, start, len(data))
+	return nil
 }
 
 func (u *connectUnaryUnmarshaler) UnmarshalFunc(message any, unmarshal func([]byte, any) error) *Error {
@@ -821,17 +1114,45 @@ func (u *connectUnaryUnmarshaler) UnmarshalFunc(message any, unmarshal func([]by
 		if err != nil {
 			return errorf(CodeResourceExhausted, "message is larger than configured max %d - unable to determine message size: %w", u.readMaxBytes, err)
 		}
-		return errorf(CodeResourceExhausted, "message size %d is larger than configured max %d", bytesRead+discardedBytes, u.readMaxBytes)
+		var prefix []byte
+		if u.retainOverLimit {
+			prefix = make([]byte, u.readMaxBytes)
+			copy(prefix, data.Bytes())
+		}
+		return newMessageTooLargeError(bytesRead+discardedBytes, int64(u.readMaxBytes), prefix)
+	}
+	if u.verifyPayload != nil {
+		if err := u.verifyPayload(data.Bytes()); err != nil {
+			return err
+		}
 	}
 	if data.Len() > 0 && u.compressionPool != nil {
 		decompressed := u.bufferPool.Get()
 		defer u.bufferPool.Put(decompressed)
-		if err := u.compressionPool.Decompress(decompressed, data, int64(u.readMaxBytes)); err != nil {
+		src := data
+		if u.lenient {
+			// Decompressing consumes src, so keep data intact in case we need to
+			// fall back to the raw bytes.
+			src = bytes.NewBuffer(data.Bytes())
+		}
+		start := u.timer.start()
+		if err := u.compressionPool.Decompress(decompressed, src, int64(u.readMaxBytes)); err == nil {
+			u.timer.observe(SerializationDecompress, start, decompressed.Len())
+			data = decompressed
+		} else if !u.lenient || err.Code() == CodeResourceExhausted {
 			return err
 		}
-		data = decompressed
 	}
 	if err := unmarshal(data.Bytes(), message); err != nil {
+		if u.sniffGzip && u.compressionPool == nil && bytes.HasPrefix(data.Bytes(), []byte(gzipMagic)) {
+			decompressed := u.bufferPool.Get()
+			defer u.bufferPool.Put(decompressed)
+			if decompressErr := httpGzipCompressionPool.Decompress(decompressed, data, int64(u.readMaxBytes)); decompressErr == nil {
+				if err := unmarshal(decompressed.Bytes(), message); err == nil {
+					return nil
+				}
+			}
+		}
 		return errorf(CodeInvalidArgument, "unmarshal into %T: %w", message, err)
 	}
 	return nil
@@ -856,6 +1177,9 @@ func (d *connectWireDetail) MarshalJSON() ([]byte, error) {
 	// Try to produce debug info, but expect failure when we don't have
 	// descriptors.
 	var codec protoJSONCodec
+	if d.resolver != nil {
+		codec.marshal.Resolver = d.resolver
+	}
 	debug, err := codec.Marshal(d.pb)
 	if err == nil && len(debug) > 2 { // don't bother sending `{}`
 		wire.Debug = json.RawMessage(debug)
@@ -892,6 +1216,11 @@ type connectWireError struct {
 	Code    Code                 `json:"code"`
 	Message string               `json:"message,omitempty"`
 	Details []*connectWireDetail `json:"details,omitempty"`
+	// GRPCStatus is the unpadded base64 encoding of the binary
+	// google.rpc.Status that a gRPC server would send in the
+	// grpc-status-details-bin trailer. It's only populated when the handler
+	// uses WithGRPCStatusInErrors, and clients ignore it.
+	GRPCStatus string `json:"grpcStatus,omitempty"`
 }
 
 func newConnectWireError(err error) *connectWireError {
@@ -912,6 +1241,16 @@ func newConnectWireError(err error) *connectWireError {
 	return wire
 }
 
+// attachGRPCStatus populates the GRPCStatus field from err.
+func (e *connectWireError) attachGRPCStatus(err error) error {
+	status, marshalErr := proto.Marshal(grpcStatusFromError(err))
+	if marshalErr != nil {
+		return marshalErr
+	}
+	e.GRPCStatus = base64.RawStdEncoding.EncodeToString(status)
+	return nil
+}
+
 func (e *connectWireError) asError() *Error {
 	if e == nil || e.Code == 0 {
 		return nil
@@ -26,6 +26,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 	"unicode/utf8"
 
@@ -39,6 +40,7 @@ const (
 	grpcHeaderStatus            = "Grpc-Status"
 	grpcHeaderMessage           = "Grpc-Message"
 	grpcHeaderDetails           = "Grpc-Status-Details-Bin"
+	grpcHeaderTE                = "Te"
 
 	grpcFlagEnvelopeTrailer = 0b10000000
 
@@ -105,6 +107,7 @@ func (g *protocolGRPC) NewClient(params *protocolClientParams) (protocolClient,
 	return &grpcClient{
 		protocolClientParams: *params,
 		web:                  g.web,
+		userAgent:            grpcUserAgent(),
 	}, nil
 }
 
@@ -136,7 +139,7 @@ func (*grpcHandler) SetTimeout(request *http.Request) (context.Context, context.
 func (g *grpcHandler) NewConn(
 	responseWriter http.ResponseWriter,
 	request *http.Request,
-) (handlerConnCloser, bool) {
+) (handlerConnCloser, error) {
 	// We need to parse metadata before entering the interceptor stack; we'll
 	// send the error to the client later on.
 	requestCompression, responseCompression, failed := negotiateCompression(
@@ -158,23 +161,46 @@ func (g *grpcHandler) NewConn(
 	if responseCompression != compressionIdentity {
 		header[grpcHeaderCompression] = []string{responseCompression}
 	}
+	messageMetadata := negotiateMessageMetadata(g.MessageMetadata, request.Header, header)
+	envelopeFlags := negotiateEnvelopeFlags(g.EnvelopeFlags, request.Header, header)
+
+	if !g.web {
+		if err := grpcValidateTrailerSupport(request); err != nil {
+			// We can't rely on trailers, so send a trailers-only response with the
+			// error in the HTTP headers. Clients (and proxies) that strip trailers
+			// still see a descriptive error.
+			grpcErrorToTrailer(g.BufferPool, header, g.Codecs.Protobuf(), err)
+			responseWriter.WriteHeader(http.StatusOK)
+			_ = request.Body.Close()
+			return nil, err
+		}
+	}
 
 	codecName := grpcCodecFromContentType(g.web, request.Header.Get(headerContentType))
 	codec := g.Codecs.Get(codecName) // handler.go guarantees this is not nil
-	conn := wrapHandlerConnWithCodedErrors(&grpcHandlerConn{
+	compressMinBytes := codecCompressMinBytes(g.CompressMinBytes, g.CodecCompressMinBytes, codec)
+	compressPolicy := g.CompressionPolicy.bind(g.Spec, codec)
+	timer := newSerializationTimer(request.Context(), g.Spec, g.SerializationTiming)
+	conn := wrapHandlerConnWithCodedErrors(request.Context(), &grpcHandlerConn{
 		spec:       g.Spec,
-		peer:       Peer{Addr: request.RemoteAddr},
+		peer:       newPeerFromRequest(request),
 		web:        g.web,
 		bufferPool: g.BufferPool,
 		protobuf:   g.Codecs.Protobuf(), // for errors
 		marshaler: grpcMarshaler{
 			envelopeWriter: envelopeWriter{
-				writer:           responseWriter,
-				compressionPool:  g.CompressionPools.Get(responseCompression),
-				codec:            codec,
-				compressMinBytes: g.CompressMinBytes,
-				bufferPool:       g.BufferPool,
-				sendMaxBytes:     g.SendMaxBytes,
+				writer:            responseWriter,
+				compressionPool:   g.CompressionPools.Get(responseCompression),
+				compressionName:   responseCompression,
+				codec:             codec,
+				compressMinBytes:  compressMinBytes,
+				compressPolicy:    compressPolicy,
+				bufferPool:        g.BufferPool,
+				sendMaxBytes:      g.SendMaxBytes,
+				firstSendMaxBytes: g.FirstSendMaxBytes,
+				sendMetadata:      messageMetadata,
+				envelopeFlags:     envelopeFlags,
+				timer:             timer,
 			},
 		},
 		responseWriter:  responseWriter,
@@ -183,27 +209,33 @@ func (g *grpcHandler) NewConn(
 		request:         request,
 		unmarshaler: grpcUnmarshaler{
 			envelopeReader: envelopeReader{
-				reader:          request.Body,
-				codec:           codec,
-				compressionPool: g.CompressionPools.Get(requestCompression),
-				bufferPool:      g.BufferPool,
-				readMaxBytes:    g.ReadMaxBytes,
+				reader:            request.Body,
+				codec:             codec,
+				compressionPool:   g.CompressionPools.Get(requestCompression),
+				bufferPool:        g.BufferPool,
+				readMaxBytes:      g.ReadMaxBytes,
+				firstReadMaxBytes: g.FirstReadMaxBytes,
+				readMetadata:      messageMetadata,
+				envelopeFlags:     envelopeFlags,
+				timer:             timer,
+				verifyPayload:     g.PayloadVerifier.bind(g.Spec, request.Header),
 			},
 			web: g.web,
 		},
-	})
+	}, g.Initializer)
 	if failed != nil {
 		// Negotiation failed, so we can't establish a stream.
 		_ = conn.Close(failed)
-		return nil, false
+		return nil, failed
 	}
-	return conn, true
+	return conn, nil
 }
 
 type grpcClient struct {
 	protocolClientParams
 
-	web bool
+	web       bool
+	userAgent string // formatted once, rather than for every call
 }
 
 func (g *grpcClient) Peer() Peer {
@@ -213,7 +245,7 @@ func (g *grpcClient) Peer() Peer {
 func (g *grpcClient) WriteRequestHeader(_ StreamType, header http.Header) {
 	// We know these header keys are in canonical form, so we can bypass all the
 	// checks in Header.Set.
-	header[headerUserAgent] = []string{grpcUserAgent()}
+	header[headerUserAgent] = []string{g.userAgent}
 	header[headerContentType] = []string{grpcContentTypeFromCodecName(g.web, g.Codec.Name())}
 	// gRPC handles compression on a per-message basis, so we don't want to
 	// compress the whole stream. By default, http.Client will ask the server
@@ -225,10 +257,16 @@ func (g *grpcClient) WriteRequestHeader(_ StreamType, header http.Header) {
 	if acceptCompression := g.CompressionPools.CommaSeparatedNames(); acceptCompression != "" {
 		header[grpcHeaderAcceptCompression] = []string{acceptCompression}
 	}
+	if g.MessageMetadata {
+		header[headerMessageMetadata] = []string{messageMetadataVersion}
+	}
+	if g.EnvelopeFlags != nil {
+		header[headerEnvelopeFlags] = []string{g.EnvelopeFlags.String()}
+	}
 	if !g.web {
 		// The gRPC-HTTP2 specification requires this - it flushes out proxies that
 		// don't support HTTP trailers.
-		header["Te"] = []string{"trailers"}
+		header[grpcHeaderTE] = []string{"trailers"}
 	}
 }
 
@@ -238,7 +276,7 @@ func (g *grpcClient) NewConn(
 	header http.Header,
 ) StreamingClientConn {
 	if deadline, ok := ctx.Deadline(); ok {
-		if encodedDeadline, err := grpcEncodeTimeout(time.Until(deadline)); err == nil {
+		if encodedDeadline, err := grpcEncodeTimeout(timeoutWithSkew(deadline, g.TimeoutSkew+deadlineMargin(ctx))); err == nil {
 			// Tests verify that the error in encodeTimeout is unreachable, so we
 			// don't need to handle the error case.
 			header[grpcHeaderTimeout] = []string{encodedDeadline}
@@ -250,34 +288,52 @@ func (g *grpcClient) NewConn(
 		g.URL,
 		spec,
 		header,
+		g.CancelGracePeriod,
 	)
+	duplexCall.readMaxHeaderBytes = g.ReadMaxHeaderBytes
+	duplexCall.progress = newTransferProgress(spec, g.Progress)
+	compressMinBytes := codecCompressMinBytes(g.CompressMinBytes, g.CodecCompressMinBytes, g.Codec)
+	compressPolicy := g.CompressionPolicy.bind(spec, g.Codec)
+	timer := newSerializationTimer(ctx, spec, g.SerializationTiming)
 	conn := &grpcClientConn{
 		spec:             spec,
-		peer:             g.Peer(),
 		duplexCall:       duplexCall,
 		compressionPools: g.CompressionPools,
 		bufferPool:       g.BufferPool,
 		protobuf:         g.Protobuf,
 		marshaler: grpcMarshaler{
 			envelopeWriter: envelopeWriter{
-				writer:           duplexCall,
-				compressionPool:  g.CompressionPools.Get(g.CompressionName),
-				codec:            g.Codec,
-				compressMinBytes: g.CompressMinBytes,
-				bufferPool:       g.BufferPool,
-				sendMaxBytes:     g.SendMaxBytes,
+				writer:            duplexCall,
+				compressionPool:   g.CompressionPools.Get(g.CompressionName),
+				codec:             g.Codec,
+				compressMinBytes:  compressMinBytes,
+				compressPolicy:    compressPolicy,
+				bufferPool:        g.BufferPool,
+				sendMaxBytes:      g.SendMaxBytes,
+				firstSendMaxBytes: g.FirstSendMaxBytes,
+				sendMetadata:      g.MessageMetadata,
+				envelopeFlags:     g.EnvelopeFlags,
+				timer:             timer,
+				signPayload:       g.PayloadSigner.bind(spec, header),
 			},
 		},
 		unmarshaler: grpcUnmarshaler{
 			envelopeReader: envelopeReader{
-				reader:       duplexCall,
-				codec:        g.Codec,
-				bufferPool:   g.BufferPool,
-				readMaxBytes: g.ReadMaxBytes,
+				reader:            duplexCall,
+				codec:             g.Codec,
+				bufferPool:        g.BufferPool,
+				readMaxBytes:      g.ReadMaxBytes,
+				firstReadMaxBytes: g.FirstReadMaxBytes,
+				readMetadata:      g.MessageMetadata,
+				envelopeFlags:     g.EnvelopeFlags,
+				timer:             timer,
+				retainOverLimit: spec.StreamType == StreamTypeUnary &&
+					g.UnaryResponseLimitBehavior == ResponseLimitRetainPrefix,
 			},
 		},
 		responseHeader:  make(http.Header),
 		responseTrailer: make(http.Header),
+		httpStatusCodes: g.HTTPStatusCodes,
 	}
 	duplexCall.SetValidateResponse(conn.validateResponse)
 	if g.web {
@@ -292,13 +348,12 @@ func (g *grpcClient) NewConn(
 			return call.ResponseTrailer()
 		}
 	}
-	return wrapClientConnWithCodedErrors(conn)
+	return wrapClientConnWithCodedErrors(ctx, conn, g.Initializer, g.TypeResolver)
 }
 
 // grpcClientConn works for both gRPC and gRPC-Web.
 type grpcClientConn struct {
 	spec             Spec
-	peer             Peer
 	duplexCall       *duplexHTTPCall
 	compressionPools readOnlyCompressionPools
 	bufferPool       *bufferPool
@@ -308,6 +363,7 @@ type grpcClientConn struct {
 	responseHeader   http.Header
 	responseTrailer  http.Header
 	readTrailers     func(*grpcUnmarshaler, *duplexHTTPCall) http.Header
+	httpStatusCodes  func(int) (Code, bool)
 }
 
 func (cc *grpcClientConn) Spec() Spec {
@@ -315,7 +371,7 @@ func (cc *grpcClientConn) Spec() Spec {
 }
 
 func (cc *grpcClientConn) Peer() Peer {
-	return cc.peer
+	return cc.duplexCall.Peer()
 }
 
 func (cc *grpcClientConn) Send(msg any) error {
@@ -325,6 +381,35 @@ func (cc *grpcClientConn) Send(msg any) error {
 	return nil // must be a literal nil: nil *Error is a non-nil error
 }
 
+func (cc *grpcClientConn) SendWithMetadata(msg any, metadata http.Header) error {
+	if err := cc.marshaler.WriteMetadata(metadata); err != nil {
+		return err
+	}
+	return cc.Send(msg)
+}
+
+func (cc *grpcClientConn) ReceiveWithMetadata(msg any) (http.Header, error) {
+	if err := cc.Receive(msg); err != nil {
+		return nil, err
+	}
+	return cc.unmarshaler.envelopeReader.metadata, nil
+}
+
+func (cc *grpcClientConn) SendWithEnvelopeFlags(msg any, flags []string) error {
+	bits := cc.marshaler.envelopeFlags.bits(flags)
+	if err := cc.marshaler.MarshalWithFlags(msg, bits); err != nil {
+		return err
+	}
+	return nil // must be a literal nil: nil *Error is a non-nil error
+}
+
+func (cc *grpcClientConn) ReceiveWithEnvelopeFlags(msg any) ([]string, error) {
+	if err := cc.Receive(msg); err != nil {
+		return nil, err
+	}
+	return cc.unmarshaler.envelopeReader.envelopeFlags.names(cc.unmarshaler.envelopeReader.flags), nil
+}
+
 func (cc *grpcClientConn) RequestHeader() http.Header {
 	return cc.duplexCall.Header()
 }
@@ -394,6 +479,7 @@ func (cc *grpcClientConn) validateResponse(response *http.Response) *Error {
 		cc.compressionPools,
 		cc.bufferPool,
 		cc.protobuf,
+		cc.httpStatusCodes,
 	); err != nil {
 		return err
 	}
@@ -415,6 +501,7 @@ type grpcHandlerConn struct {
 	wroteToBody     bool
 	request         *http.Request
 	unmarshaler     grpcUnmarshaler
+	receiveClosed   uint32 // atomic
 }
 
 func (hc *grpcHandlerConn) Spec() Spec {
@@ -426,12 +513,64 @@ func (hc *grpcHandlerConn) Peer() Peer {
 }
 
 func (hc *grpcHandlerConn) Receive(msg any) error {
+	if atomic.LoadUint32(&hc.receiveClosed) != 0 {
+		return io.EOF
+	}
 	if err := hc.unmarshaler.Unmarshal(msg); err != nil {
+		if atomic.LoadUint32(&hc.receiveClosed) != 0 {
+			// CloseReceive interrupted the read.
+			return io.EOF
+		}
 		return err // already coded
 	}
 	return nil // must be a literal nil: nil *Error is a non-nil error
 }
 
+func (hc *grpcHandlerConn) ReceiveWithMetadata(msg any) (http.Header, error) {
+	if err := hc.Receive(msg); err != nil {
+		return nil, err
+	}
+	return hc.unmarshaler.envelopeReader.metadata, nil
+}
+
+func (hc *grpcHandlerConn) SendWithMetadata(msg any, metadata http.Header) error {
+	if !hc.wroteToBody {
+		mergeHeaders(hc.responseWriter.Header(), hc.responseHeader)
+		hc.wroteToBody = true
+	}
+	if err := hc.marshaler.WriteMetadata(metadata); err != nil {
+		return err
+	}
+	return hc.Send(msg)
+}
+
+func (hc *grpcHandlerConn) ReceiveWithEnvelopeFlags(msg any) ([]string, error) {
+	if err := hc.Receive(msg); err != nil {
+		return nil, err
+	}
+	return hc.unmarshaler.envelopeReader.envelopeFlags.names(hc.unmarshaler.envelopeReader.flags), nil
+}
+
+func (hc *grpcHandlerConn) SendWithEnvelopeFlags(msg any, flags []string) error {
+	defer flushResponseWriter(hc.responseWriter)
+	if !hc.wroteToBody {
+		mergeHeaders(hc.responseWriter.Header(), hc.responseHeader)
+		hc.wroteToBody = true
+	}
+	bits := hc.marshaler.envelopeFlags.bits(flags)
+	if err := hc.marshaler.MarshalWithFlags(msg, bits); err != nil {
+		return err
+	}
+	return nil // must be a literal nil: nil *Error is a non-nil error
+}
+
+func (hc *grpcHandlerConn) CloseReceive() error {
+	// Subsequent calls to Receive see a clean end of stream. Closing the body
+	// also interrupts a concurrent Receive.
+	atomic.StoreUint32(&hc.receiveClosed, 1)
+	return hc.request.Body.Close()
+}
+
 func (hc *grpcHandlerConn) RequestHeader() http.Header {
 	return hc.request.Header
 }
@@ -587,9 +726,10 @@ func grpcValidateResponse(
 	availableCompressors readOnlyCompressionPools,
 	bufferPool *bufferPool,
 	protobuf Codec,
+	httpStatusCodes func(int) (Code, bool),
 ) *Error {
 	if response.StatusCode != http.StatusOK {
-		return errorf(grpcHTTPToCode(response.StatusCode), "HTTP status %v", response.Status)
+		return newHTTPStatusError(response, grpcHTTPToCode, httpStatusCodes)
 	}
 	if compression := response.Header.Get(grpcHeaderCompression); compression != "" &&
 		compression != compressionIdentity &&
@@ -761,6 +901,32 @@ func grpcContentTypeFromCodecName(web bool, name string) string {
 	return grpcContentTypePrefix + name
 }
 
+// grpcValidateTrailerSupport checks that we can send gRPC's status trailers to
+// the client. The gRPC protocol requires clients to send "TE: trailers", which
+// also lets proxies that don't support trailers reject requests early. Over
+// HTTP/1.1, net/http sends trailers with chunked transfer encoding, which
+// HTTP/1.0 doesn't support.
+func grpcValidateTrailerSupport(request *http.Request) *Error {
+	if request.ProtoMajor == 1 && request.ProtoMinor == 0 {
+		return errorf(CodeInternal, "gRPC requires trailers, which %s doesn't support", request.Proto)
+	}
+	for _, value := range request.Header.Values(grpcHeaderTE) {
+		for _, token := range strings.Split(value, ",") {
+			// Strip any parameters, like "trailers;q=0.5".
+			if semicolon := strings.IndexByte(token, ';'); semicolon >= 0 {
+				token = token[:semicolon]
+			}
+			if strings.EqualFold(strings.TrimSpace(token), "trailers") {
+				return nil
+			}
+		}
+	}
+	return errorf(
+		CodeInternal,
+		`gRPC requests must include "TE: trailers": a proxy may have removed it and may also strip response trailers`,
+	)
+}
+
 func grpcErrorToTrailer(bufferPool *bufferPool, trailer http.Header, protobuf Codec, err error) {
 	if err == nil {
 		trailer.Set(grpcHeaderStatus, "0") // zero is the gRPC OK status
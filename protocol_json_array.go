@@ -0,0 +1,166 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"net/http"
+)
+
+// jsonArrayHandler serves server streaming procedures to Connect unary JSON
+// requests, streaming the responses as the elements of a JSON array. It's
+// enabled with WithJSONArrayStreaming.
+type jsonArrayHandler struct {
+	connectHandler
+}
+
+// newJSONArrayHandler returns nil if the handler doesn't support JSON.
+func newJSONArrayHandler(params *protocolHandlerParams) protocolHandler {
+	accept := make(map[string]struct{})
+	for _, name := range []string{codecNameJSON, codecNameJSONCharsetUTF8} {
+		if params.Codecs.Get(name) != nil {
+			accept[connectUnaryContentTypePrefix+name] = struct{}{}
+		}
+	}
+	if len(accept) == 0 {
+		return nil
+	}
+	return &jsonArrayHandler{connectHandler{protocolHandlerParams: *params, accept: accept}}
+}
+
+func (h *jsonArrayHandler) NewConn(
+	responseWriter http.ResponseWriter,
+	request *http.Request,
+) (handlerConnCloser, error) {
+	// Requests may be compressed as usual, but responses never are: the
+	// response is a stream, and compressing it would delay each element.
+	requestCompression, _, failed := negotiateCompression(
+		h.CompressionPools,
+		normalizeContentCoding(request.Header.Get(connectUnaryHeaderCompression)),
+		"",
+	)
+	header := responseWriter.Header()
+	header[headerContentType] = []string{request.Header.Get(headerContentType)}
+	header[connectUnaryHeaderAcceptCompression] = []string{h.CompressionPools.CommaSeparatedNames()}
+	codec := h.Codecs.Get(connectCodecFromContentType(StreamTypeUnary, request.Header.Get(headerContentType)))
+	timer := newSerializationTimer(request.Context(), h.Spec, h.SerializationTiming)
+	var conn handlerConnCloser = &jsonArrayHandlerConn{
+		connectUnaryHandlerConn: &connectUnaryHandlerConn{
+			spec:            h.Spec,
+			peer:            newPeerFromRequest(request),
+			request:         request,
+			responseWriter:  responseWriter,
+			errorFormatters: h.ErrorFormatters,
+			grpcStatus:      h.GRPCStatusInErrors,
+			unmarshaler: connectUnaryUnmarshaler{
+				reader:          request.Body,
+				codec:           codec,
+				compressionPool: h.CompressionPools.Get(requestCompression),
+				bufferPool:      h.BufferPool,
+				readMaxBytes:    firstMessageMaxBytes(false, h.FirstReadMaxBytes, h.ReadMaxBytes),
+				lenient:         h.LenientEncoding,
+				verifyPayload:   h.PayloadVerifier.bind(h.Spec, request.Header),
+				timer:           timer,
+			},
+			responseTrailer: make(http.Header),
+		},
+		codec:        codec,
+		sendMaxBytes: h.SendMaxBytes,
+		timer:        timer,
+	}
+	conn = wrapHandlerConnWithCodedErrors(request.Context(), conn, h.Initializer)
+	if failed != nil {
+		_ = conn.Close(failed)
+		return nil, failed
+	}
+	return conn, nil
+}
+
+// jsonArrayHandlerConn writes each message as an element of a JSON array.
+// Until the first message is sent, it behaves like a Connect unary conn, so
+// errors are sent with the usual status codes and JSON bodies.
+type jsonArrayHandlerConn struct {
+	*connectUnaryHandlerConn
+
+	codec        Codec
+	sendMaxBytes int
+	timer        *serializationTimer
+	started      bool
+}
+
+func (hc *jsonArrayHandlerConn) Send(msg any) error {
+	start := hc.timer.start()
+	data, err := marshalMessage(hc.codec, msg)
+	if err != nil {
+		return errorf(CodeInternal, "marshal message: %w", err)
+	}
+	hc.timer.observe(SerializationMarshal, start, len(data))
+	if hc.sendMaxBytes > 0 && len(data) > hc.sendMaxBytes {
+		return errorf(CodeResourceExhausted, "message size %d exceeds sendMaxBytes %d", len(data), hc.sendMaxBytes)
+	}
+	separator := []byte(",")
+	if !hc.started {
+		hc.start()
+		separator = []byte("[")
+	}
+	if _, err := hc.responseWriter.Write(separator); err != nil {
+		return err
+	}
+	if _, err := hc.responseWriter.Write(data); err != nil {
+		return err
+	}
+	flushResponseWriter(hc.responseWriter)
+	return nil
+}
+
+// Close ends the array. If the handler fails after sending some messages, it's
+// too late to change the status code, so the array is left unterminated:
+// clients see malformed JSON rather than a truncated list that looks
+// complete.
+func (hc *jsonArrayHandlerConn) Close(err error) error {
+	if !hc.started {
+		if err != nil {
+			return hc.connectUnaryHandlerConn.Close(err)
+		}
+		hc.start()
+		if _, writeErr := hc.responseWriter.Write([]byte("[")); writeErr != nil {
+			_ = hc.request.Body.Close()
+			return writeErr
+		}
+	}
+	if err == nil {
+		if _, writeErr := hc.responseWriter.Write([]byte("]")); writeErr != nil {
+			_ = hc.request.Body.Close()
+			return writeErr
+		}
+	}
+	// Trailers set after the body has started are sent as HTTP trailers.
+	header := hc.responseWriter.Header()
+	for key, values := range hc.responseTrailer {
+		header[http.TrailerPrefix+key] = values
+	}
+	return hc.request.Body.Close()
+}
+
+// start sends the response headers. Trailers set so far are sent as headers,
+// like Connect unary trailers.
+func (hc *jsonArrayHandlerConn) start() {
+	hc.started = true
+	hc.wroteBody = true
+	hc.writeResponseHeader(nil /* error */)
+	for key := range hc.responseTrailer {
+		delete(hc.responseTrailer, key)
+	}
+	hc.responseWriter.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,189 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// retryPreviousAttemptsHeader tells the server how many times a call has
+	// already been attempted, as in gRPC.
+	retryPreviousAttemptsHeader = "Grpc-Previous-Rpc-Attempts"
+	// retryPushbackTrailer lets servers override the client's backoff, as in
+	// gRPC. A negative or malformed value asks the client not to retry.
+	retryPushbackTrailer = "Grpc-Retry-Pushback-Ms"
+
+	defaultRetryInitialBackoff = 100 * time.Millisecond
+	defaultRetryMaxBackoff     = 5 * time.Second
+	defaultRetryMultiplier     = 2
+)
+
+var retryPolicyContextValue = NewContextValue[RetryPolicy]("connect retry policy")
+
+// RetryPolicy configures automatic retries of failed unary calls, with the
+// same semantics as the retryPolicy of gRPC's service config. A failed
+// attempt is retried if its code is retryable, the policy allows more
+// attempts, and the call's context hasn't expired: all attempts share the
+// call's deadline. Before each retry, the client waits for a random duration
+// between zero and the current backoff ("full jitter"), and the backoff
+// grows by the multiplier after every attempt, up to the maximum.
+//
+// Servers can override the backoff with the grpc-retry-pushback-ms trailer,
+// or suppress retries by setting it to a negative value. Streams closed by a
+// [Drainer] are retried after the delay the server asks for.
+//
+// Retried calls run the whole request again, so only idempotent procedures,
+// or procedures that fail before doing any work, should be retried.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the original
+	// call. Values below 2 disable retries.
+	MaxAttempts int
+	// InitialBackoff is the backoff before the first retry. If zero, it's
+	// 100ms.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the backoff. If zero, it's 5s.
+	MaxBackoff time.Duration
+	// BackoffMultiplier scales the backoff after each retry. If zero, it's 2.
+	BackoffMultiplier float64
+	// RetryableCodes lists the codes to retry. If empty, only CodeUnavailable
+	// is retried.
+	RetryableCodes []Code
+}
+
+// ContextWithRetryPolicy returns a copy of ctx that overrides the retry
+// policy of clients configured with [WithRetry], for calls made with the
+// context. To disable retries for a call, use a policy with a MaxAttempts
+// of 1.
+func ContextWithRetryPolicy(ctx context.Context, policy RetryPolicy) context.Context {
+	return retryPolicyContextValue.With(ctx, policy)
+}
+
+func (p *RetryPolicy) retryable(code Code) bool {
+	if len(p.RetryableCodes) == 0 {
+		return code == CodeUnavailable
+	}
+	for _, retryable := range p.RetryableCodes {
+		if code == retryable {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the upper bound of the delay before the given retry,
+// starting from 1.
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	initial := p.InitialBackoff
+	if initial <= 0 {
+		initial = defaultRetryInitialBackoff
+	}
+	limit := p.MaxBackoff
+	if limit <= 0 {
+		limit = defaultRetryMaxBackoff
+	}
+	multiplier := p.BackoffMultiplier
+	if multiplier <= 0 {
+		multiplier = defaultRetryMultiplier
+	}
+	backoff := float64(initial) * math.Pow(multiplier, float64(retry-1))
+	if backoff > float64(limit) {
+		return limit
+	}
+	return time.Duration(backoff)
+}
+
+// retrier retries the unary calls of a client.
+type retrier struct {
+	policy RetryPolicy
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func newRetrier(policy RetryPolicy) *retrier {
+	return &retrier{
+		policy: policy,
+		// Seed per client, so that processes don't share a jitter sequence.
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())), //nolint:gosec // jitter doesn't need a CSPRNG
+	}
+}
+
+// newRetryingUnary retries failed calls. Each attempt gets a fresh copy of the request's
+// headers, since protocols add per-attempt headers like timeouts and
+// signatures.
+func newRetryingUnary[Req any](next UnaryFunc, retrier *retrier) UnaryFunc {
+	return func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
+		policy := retrier.policy
+		if override, ok := retryPolicyContextValue.From(ctx); ok {
+			policy = override
+		}
+		typed, ok := request.(*Request[Req])
+		if !ok || policy.MaxAttempts < 2 {
+			return next(ctx, request)
+		}
+		header := typed.Header().Clone()
+		for attempt := 1; ; attempt++ {
+			attemptRequest := typed
+			if attempt > 1 {
+				copied := *typed
+				copied.header = header.Clone()
+				copied.header.Set(retryPreviousAttemptsHeader, strconv.Itoa(attempt-1))
+				attemptRequest = &copied
+			}
+			response, err := next(ctx, attemptRequest)
+			typed.peer = attemptRequest.peer
+			if err == nil || attempt >= policy.MaxAttempts || !policy.retryable(CodeOf(err)) {
+				return response, err
+			}
+			delay, retry := retrier.delay(&policy, attempt, err)
+			if !retry {
+				return response, err
+			}
+			if err := sleepBeforeRetry(ctx, attempt, func(int) time.Duration { return delay }); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// delay returns the time to wait before the given retry, and false if the
+// server asked the client not to retry.
+func (r *retrier) delay(policy *RetryPolicy, retry int, err error) (time.Duration, bool) {
+	if delay, ok := drainReconnectDelay(err); ok {
+		return delay, true
+	}
+	if connectErr, ok := asError(err); ok {
+		if values := connectErr.Meta().Values(retryPushbackTrailer); len(values) > 0 {
+			millis, parseErr := strconv.ParseInt(values[0], 10 /* base */, 64 /* bitsize */)
+			if parseErr != nil || millis < 0 {
+				return 0, false
+			}
+			return time.Duration(millis) * time.Millisecond, true
+		}
+	}
+	backoff := policy.backoff(retry)
+	if backoff <= 0 {
+		return 0, true
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return time.Duration(r.rand.Int63n(int64(backoff))), true
+}
@@ -0,0 +1,135 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/bufbuild/connect-go/internal/assert"
+	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
+	"github.com/bufbuild/connect-go/internal/gen/connect/ping/v1/pingv1connect"
+)
+
+func TestRetry(t *testing.T) {
+	t.Parallel()
+	const procedure = "/" + pingv1connect.PingServiceName + "/Ping"
+	// The request's text names a test case; the server fails the first
+	// Number attempts of each case with the code in the request header.
+	var mu sync.Mutex
+	attempts := make(map[string][]string)
+	mux := http.NewServeMux()
+	mux.Handle(procedure, connect.NewUnaryHandler(
+		procedure,
+		func(ctx context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			mu.Lock()
+			previous := attempts[request.Msg.Text]
+			attempts[request.Msg.Text] = append(previous, request.Header().Get("Grpc-Previous-Rpc-Attempts"))
+			mu.Unlock()
+			if int64(len(previous)) < request.Msg.Number {
+				var code connect.Code
+				assert.Nil(t, code.UnmarshalText([]byte(request.Header().Get("Fail-With"))))
+				err := connect.NewError(code, errors.New("try again"))
+				if pushback := request.Header().Get("Pushback"); pushback != "" {
+					err.Meta().Set("Grpc-Retry-Pushback-Ms", pushback)
+				}
+				return nil, err
+			}
+			return connect.NewResponse(&pingv1.PingResponse{Number: int64(len(previous) + 1)}), nil
+		},
+	))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	var calls int
+	client := connect.NewClient[pingv1.PingRequest, pingv1.PingResponse](
+		server.Client(),
+		server.URL+procedure,
+		connect.WithRetry(connect.RetryPolicy{
+			MaxAttempts:    3,
+			InitialBackoff: time.Millisecond,
+			RetryableCodes: []connect.Code{connect.CodeUnavailable, connect.CodeAborted},
+		}),
+		connect.WithInterceptors(connect.UnaryInterceptorFunc(func(next connect.UnaryFunc) connect.UnaryFunc {
+			return func(ctx context.Context, request connect.AnyRequest) (connect.AnyResponse, error) {
+				mu.Lock()
+				calls++
+				mu.Unlock()
+				return next(ctx, request)
+			}
+		})),
+	)
+	call := func(ctx context.Context, name string, failures int64, code connect.Code, pushback string) (*connect.Response[pingv1.PingResponse], error) {
+		request := connect.NewRequest(&pingv1.PingRequest{Text: name, Number: failures})
+		request.Header().Set("Fail-With", code.String())
+		if pushback != "" {
+			request.Header().Set("Pushback", pushback)
+		}
+		return client.CallUnary(ctx, request)
+	}
+	attemptsOf := func(name string) []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return attempts[name]
+	}
+
+	response, err := call(context.Background(), "recovers", 2, connect.CodeUnavailable, "")
+	assert.Nil(t, err)
+	assert.Equal(t, response.Msg.Number, int64(3))
+	assert.Equal(t, attemptsOf("recovers"), []string{"", "1", "2"})
+	assert.Equal(t, calls, 1)
+
+	_, err = call(context.Background(), "custom_code", 1, connect.CodeAborted, "")
+	assert.Nil(t, err)
+	assert.Equal(t, len(attemptsOf("custom_code")), 2)
+
+	_, err = call(context.Background(), "exhausted", 5, connect.CodeUnavailable, "")
+	assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+	assert.Equal(t, len(attemptsOf("exhausted")), 3)
+
+	_, err = call(context.Background(), "not_retryable", 1, connect.CodeNotFound, "")
+	assert.Equal(t, connect.CodeOf(err), connect.CodeNotFound)
+	assert.Equal(t, len(attemptsOf("not_retryable")), 1)
+
+	_, err = call(context.Background(), "pushback_stop", 1, connect.CodeUnavailable, "-1")
+	assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+	assert.Equal(t, len(attemptsOf("pushback_stop")), 1)
+
+	start := time.Now()
+	_, err = call(context.Background(), "pushback_delay", 1, connect.CodeUnavailable, "50")
+	assert.Nil(t, err)
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+
+	ctx := connect.ContextWithRetryPolicy(context.Background(), connect.RetryPolicy{MaxAttempts: 1})
+	_, err = call(ctx, "overridden", 1, connect.CodeUnavailable, "")
+	assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+	assert.Equal(t, len(attemptsOf("overridden")), 1)
+
+	// Attempts share the call's deadline.
+	ctx = connect.ContextWithRetryPolicy(context.Background(), connect.RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Hour,
+		MaxBackoff:     time.Hour,
+	})
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = call(ctx, "deadline", 1, connect.CodeUnavailable, "")
+	assert.Equal(t, connect.CodeOf(err), connect.CodeDeadlineExceeded)
+}
@@ -0,0 +1,49 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bufbuild/connect-go/internal/assert"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	t.Parallel()
+	var defaults RetryPolicy
+	assert.Equal(t, defaults.backoff(1), 100*time.Millisecond)
+	assert.Equal(t, defaults.backoff(2), 200*time.Millisecond)
+	assert.Equal(t, defaults.backoff(10), 5*time.Second)
+	assert.True(t, defaults.retryable(CodeUnavailable))
+	assert.False(t, defaults.retryable(CodeInternal))
+
+	policy := RetryPolicy{
+		InitialBackoff:    time.Second,
+		MaxBackoff:        10 * time.Second,
+		BackoffMultiplier: 3,
+	}
+	assert.Equal(t, policy.backoff(1), time.Second)
+	assert.Equal(t, policy.backoff(2), 3*time.Second)
+	assert.Equal(t, policy.backoff(3), 9*time.Second)
+	assert.Equal(t, policy.backoff(4), 10*time.Second)
+
+	retrier := newRetrier(policy)
+	for retry := 1; retry < 5; retry++ {
+		delay, ok := retrier.delay(&policy, retry, NewError(CodeUnavailable, nil))
+		assert.True(t, ok)
+		assert.True(t, delay >= 0 && delay < policy.backoff(retry))
+	}
+}
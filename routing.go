@@ -0,0 +1,129 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"net/http"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+var routeInfoContextValue = NewContextValue[RouteInfo]("connect route info")
+
+// RouteInfo holds a call's routing metadata, as extracted by the
+// [RouteExtractor] configured with [WithRouteExtractor].
+type RouteInfo struct {
+	// Tenant identifies the customer or organization the call acts for.
+	Tenant string
+	// ShardKey identifies the data partition the call touches.
+	ShardKey string
+}
+
+// RouteInfoFromContext returns the routing metadata of the current call.
+// Handler implementations and interceptors can use it to enforce tenant
+// isolation or pick a shard, and HTTP clients can read it from the outbound
+// request's context to route calls to the right backend. It reports false if
+// the call has no routing metadata.
+func RouteInfoFromContext(ctx context.Context) (RouteInfo, bool) {
+	return routeInfoContextValue.From(ctx)
+}
+
+// ContextWithRouteInfo returns a copy of ctx carrying the routing metadata,
+// for clients whose callers know the route of a call in advance.
+func ContextWithRouteInfo(ctx context.Context, info RouteInfo) context.Context {
+	return routeInfoContextValue.With(ctx, info)
+}
+
+// A RouteExtractor parses routing metadata from a call's request headers
+// or request message, so that routing logic can live in one place instead of
+// in every interceptor and handler. Each value is read from its header if
+// the header is present, and otherwise from the named top-level field of the
+// request message. Message fields are only consulted for unary calls.
+//
+// For example, to route on an X-Tenant-Id header and the shard_key field of
+// request messages:
+//
+//	connect.WithRouteExtractor(connect.RouteExtractor{
+//		TenantHeader:  "X-Tenant-Id",
+//		ShardKeyField: "shard_key",
+//	})
+type RouteExtractor struct {
+	TenantHeader   string
+	TenantField    string
+	ShardKeyHeader string
+	ShardKeyField  string
+}
+
+// assign attaches the call's routing metadata to the context. Extracted
+// values replace those already in the context, so clients propagate the
+// route of the call they're handling unless the request overrides it.
+func (e *RouteExtractor) assign(ctx context.Context, header http.Header, msg any) context.Context {
+	if e == nil {
+		return ctx
+	}
+	info, _ := RouteInfoFromContext(ctx)
+	if tenant := extractRouteValue(header, e.TenantHeader, msg, e.TenantField); tenant != "" {
+		info.Tenant = tenant
+	}
+	if shardKey := extractRouteValue(header, e.ShardKeyHeader, msg, e.ShardKeyField); shardKey != "" {
+		info.ShardKey = shardKey
+	}
+	if info == (RouteInfo{}) {
+		return ctx
+	}
+	return routeInfoContextValue.With(ctx, info)
+}
+
+// writeClientHeader propagates the outbound call's routing metadata to the
+// handler (and any proxies on the way), unless the request already has the
+// headers.
+func (e *RouteExtractor) writeClientHeader(ctx context.Context, header http.Header) {
+	if e == nil {
+		return
+	}
+	info, ok := RouteInfoFromContext(ctx)
+	if !ok {
+		return
+	}
+	if e.TenantHeader != "" && info.Tenant != "" && header.Get(e.TenantHeader) == "" {
+		header.Set(e.TenantHeader, info.Tenant)
+	}
+	if e.ShardKeyHeader != "" && info.ShardKey != "" && header.Get(e.ShardKeyHeader) == "" {
+		header.Set(e.ShardKeyHeader, info.ShardKey)
+	}
+}
+
+func extractRouteValue(header http.Header, key string, msg any, field string) string {
+	if key != "" {
+		if value := header.Get(key); value != "" {
+			return value
+		}
+	}
+	if field == "" {
+		return ""
+	}
+	protoMsg, ok := msg.(proto.Message)
+	if !ok {
+		return ""
+	}
+	reflected := protoMsg.ProtoReflect()
+	descriptor := reflected.Descriptor().Fields().ByName(protoreflect.Name(field))
+	if descriptor == nil || descriptor.IsList() || descriptor.IsMap() || descriptor.Message() != nil || !reflected.Has(descriptor) {
+		return ""
+	}
+	return reflected.Get(descriptor).String()
+}
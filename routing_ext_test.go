@@ -0,0 +1,111 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/bufbuild/connect-go/internal/assert"
+	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
+	"github.com/bufbuild/connect-go/internal/gen/connect/ping/v1/pingv1connect"
+)
+
+func TestRouteExtractor(t *testing.T) {
+	t.Parallel()
+	extractor := connect.WithRouteExtractor(connect.RouteExtractor{
+		TenantHeader:  "X-Tenant-Id",
+		ShardKeyField: "number",
+	})
+	var mu sync.Mutex
+	routes := make(map[string]connect.RouteInfo)
+	record := func(ctx context.Context, procedure string) {
+		info, _ := connect.RouteInfoFromContext(ctx)
+		mu.Lock()
+		defer mu.Unlock()
+		routes[procedure] = info
+	}
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		pingServer{},
+		extractor,
+		connect.WithInterceptors(&recordRouteInterceptor{record: record}),
+	))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	var transportRoute connect.RouteInfo
+	httpClient := httpClientFunc(func(request *http.Request) (*http.Response, error) {
+		transportRoute, _ = connect.RouteInfoFromContext(request.Context())
+		return server.Client().Do(request)
+	})
+	client := pingv1connect.NewPingServiceClient(httpClient, server.URL, extractor)
+
+	t.Run("unary", func(t *testing.T) {
+		ctx := connect.ContextWithRouteInfo(context.Background(), connect.RouteInfo{Tenant: "acme"})
+		_, err := client.Ping(ctx, connect.NewRequest(&pingv1.PingRequest{Number: 7}))
+		assert.Nil(t, err)
+		assert.Equal(t, transportRoute, connect.RouteInfo{Tenant: "acme", ShardKey: "7"})
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, routes["/"+pingv1connect.PingServiceName+"/Ping"], connect.RouteInfo{Tenant: "acme", ShardKey: "7"})
+	})
+	t.Run("header_overrides_context", func(t *testing.T) {
+		ctx := connect.ContextWithRouteInfo(context.Background(), connect.RouteInfo{Tenant: "acme"})
+		request := connect.NewRequest(&pingv1.PingRequest{})
+		request.Header().Set("X-Tenant-Id", "globex")
+		_, err := client.Ping(ctx, request)
+		assert.Nil(t, err)
+		assert.Equal(t, transportRoute, connect.RouteInfo{Tenant: "globex"})
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, routes["/"+pingv1connect.PingServiceName+"/Ping"], connect.RouteInfo{Tenant: "globex"})
+	})
+	t.Run("stream", func(t *testing.T) {
+		ctx := connect.ContextWithRouteInfo(context.Background(), connect.RouteInfo{Tenant: "initech"})
+		stream, err := client.CountUp(ctx, connect.NewRequest(&pingv1.CountUpRequest{Number: 2}))
+		assert.Nil(t, err)
+		for stream.Receive() {
+		}
+		assert.Nil(t, stream.Err())
+		assert.Nil(t, stream.Close())
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, routes["/"+pingv1connect.PingServiceName+"/CountUp"], connect.RouteInfo{Tenant: "initech"})
+	})
+}
+
+type recordRouteInterceptor struct {
+	connect.Interceptor
+
+	record func(context.Context, string)
+}
+
+func (i *recordRouteInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, request connect.AnyRequest) (connect.AnyResponse, error) {
+		i.record(ctx, request.Spec().Procedure)
+		return next(ctx, request)
+	}
+}
+
+func (i *recordRouteInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		i.record(ctx, conn.Spec().Procedure)
+		return next(ctx, conn)
+	}
+}
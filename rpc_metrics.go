@@ -0,0 +1,140 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// rpcDurationBounds are the histogram bucket boundaries OpenTelemetry
+// recommends for RPC durations.
+var rpcDurationBounds = []time.Duration{ //nolint:gochecknoglobals
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	75 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	750 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	7500 * time.Millisecond,
+	10 * time.Second,
+}
+
+// An RPCMetric aggregates the calls to one procedure with one outcome.
+type RPCMetric struct {
+	Procedure string
+	IsClient  bool
+	// Code is "ok" for successful calls, and the error's [Code] otherwise.
+	Code  string
+	Calls uint64
+	// TotalDuration is the sum of the calls' durations. DurationBuckets is a
+	// histogram of the durations: DurationBuckets[i] counts the calls that took
+	// at most DurationBounds[i] (and longer than the previous bound), and the
+	// last bucket counts the calls that took longer than every bound.
+	TotalDuration    time.Duration
+	DurationBounds   []time.Duration
+	DurationBuckets  []uint64
+	RequestMessages  int64
+	ResponseMessages int64
+	RequestBytes     int64
+	ResponseBytes    int64
+}
+
+type rpcMetricKey struct {
+	procedure string
+	isClient  bool
+	code      string
+}
+
+// RPCMetrics aggregates spans into the RPC metrics OpenTelemetry defines:
+// call counts, durations, and message counts and sizes for each procedure
+// and outcome. Use its Record method as the export function for
+// [WithTelemetry], or call it from an export function that also forwards
+// spans to a tracing backend. RPCMetrics is safe to use concurrently, and
+// one value may be shared by many clients and handlers.
+type RPCMetrics struct {
+	mu      sync.Mutex
+	metrics map[rpcMetricKey]*RPCMetric
+}
+
+// NewRPCMetrics constructs an empty RPCMetrics.
+func NewRPCMetrics() *RPCMetrics {
+	return &RPCMetrics{metrics: make(map[rpcMetricKey]*RPCMetric)}
+}
+
+// Record adds a completed call to the metrics.
+func (m *RPCMetrics) Record(_ context.Context, span *Span) {
+	key := rpcMetricKey{procedure: span.Spec.Procedure, isClient: span.Spec.IsClient, code: "ok"}
+	if span.Err != nil {
+		key.code = CodeOf(wrapIfContextError(span.Err)).String()
+	}
+	duration := span.Duration()
+	bucket := sort.Search(len(rpcDurationBounds), func(i int) bool {
+		return duration <= rpcDurationBounds[i]
+	})
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	metric, ok := m.metrics[key]
+	if !ok {
+		metric = &RPCMetric{
+			Procedure:       key.procedure,
+			IsClient:        key.isClient,
+			Code:            key.code,
+			DurationBounds:  rpcDurationBounds,
+			DurationBuckets: make([]uint64, len(rpcDurationBounds)+1),
+		}
+		m.metrics[key] = metric
+	}
+	metric.Calls++
+	metric.TotalDuration += duration
+	metric.DurationBuckets[bucket]++
+	metric.RequestMessages += span.RequestMessages
+	metric.ResponseMessages += span.ResponseMessages
+	metric.RequestBytes += span.RequestBytes
+	metric.ResponseBytes += span.ResponseBytes
+}
+
+// Snapshot returns a copy of the metrics, sorted by procedure, then with
+// handler metrics before client metrics, then by code.
+func (m *RPCMetrics) Snapshot() []RPCMetric {
+	m.mu.Lock()
+	snapshot := make([]RPCMetric, 0, len(m.metrics))
+	for _, metric := range m.metrics {
+		copied := *metric
+		copied.DurationBounds = append([]time.Duration(nil), metric.DurationBounds...)
+		copied.DurationBuckets = append([]uint64(nil), metric.DurationBuckets...)
+		snapshot = append(snapshot, copied)
+	}
+	m.mu.Unlock()
+	sort.Slice(snapshot, func(i, j int) bool {
+		left, right := snapshot[i], snapshot[j]
+		if left.Procedure != right.Procedure {
+			return left.Procedure < right.Procedure
+		}
+		if left.IsClient != right.IsClient {
+			return !left.IsClient
+		}
+		return left.Code < right.Code
+	})
+	return snapshot
+}
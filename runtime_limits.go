@@ -0,0 +1,109 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// RuntimeLimits holds handler limits that can be changed while the server is
+// running, so that feature-flag systems and operators can tighten limits
+// during incidents without redeploying. Handlers configured with
+// [WithRuntimeLimits] read the current limits at the start of every call;
+// calls already in progress keep the limits they started with.
+//
+// The limits are a [CallPolicy], so zero values leave the handler's
+// configuration unchanged. To lift a limit, store limits with the field set
+// to zero. A RuntimeLimits may be shared by many handlers, and its methods are
+// safe to call concurrently.
+type RuntimeLimits struct {
+	value atomic.Value // *CallPolicy
+}
+
+// NewRuntimeLimits constructs a RuntimeLimits holding the initial limits.
+func NewRuntimeLimits(initial CallPolicy) *RuntimeLimits {
+	limits := &RuntimeLimits{}
+	limits.Store(initial)
+	return limits
+}
+
+// Load returns the current limits.
+func (l *RuntimeLimits) Load() CallPolicy {
+	if policy, ok := l.value.Load().(*CallPolicy); ok {
+		return *policy
+	}
+	return CallPolicy{}
+}
+
+// Store replaces the current limits. Calls that start afterwards use the new
+// limits.
+func (l *RuntimeLimits) Store(limits CallPolicy) {
+	l.value.Store(&limits)
+}
+
+// withRuntimeLimits combines a handler's runtime limits with its policy
+// resolver (which may be nil). The stricter setting of the two applies.
+func withRuntimeLimits(
+	limits *RuntimeLimits,
+	resolve func(context.Context, Spec, Peer) CallPolicy,
+) func(context.Context, Spec, Peer) CallPolicy {
+	if limits == nil {
+		return resolve
+	}
+	if resolve == nil {
+		return func(context.Context, Spec, Peer) CallPolicy {
+			return limits.Load()
+		}
+	}
+	return func(ctx context.Context, spec Spec, peer Peer) CallPolicy {
+		return stricterPolicy(limits.Load(), resolve(ctx, spec, peer))
+	}
+}
+
+// stricterPolicy merges two policies, keeping the stricter value of each
+// field.
+func stricterPolicy(left, right CallPolicy) CallPolicy {
+	merged := CallPolicy{
+		ReadMaxBytes:       smallerLimit(left.ReadMaxBytes, right.ReadMaxBytes),
+		SendMaxBytes:       smallerLimit(left.SendMaxBytes, right.SendMaxBytes),
+		Timeout:            smallerLimit(left.Timeout, right.Timeout),
+		DisableCompression: left.DisableCompression || right.DisableCompression,
+		Limiter:            left.Limiter,
+	}
+	if left.Limiter == nil {
+		merged.Limiter = right.Limiter
+	} else if right.Limiter != nil {
+		merged.Limiter = bothLimiters{left.Limiter, right.Limiter}
+	}
+	return merged
+}
+
+// smallerLimit returns the smaller of two limits, treating non-positive
+// values as unset.
+func smallerLimit[T int | ~int64](left, right T) T {
+	if left <= 0 || (right > 0 && right < left) {
+		return right
+	}
+	return left
+}
+
+// bothLimiters allows calls that both limiters allow. The second limiter is
+// only consulted if the first allows the call.
+type bothLimiters [2]interface{ Allow() bool }
+
+func (l bothLimiters) Allow() bool {
+	return l[0].Allow() && l[1].Allow()
+}
@@ -0,0 +1,109 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// SerializationStage identifies the work measured by a [SerializationTiming].
+type SerializationStage uint8
+
+const (
+	// SerializationMarshal is the time spent encoding a message with the
+	// call's codec.
+	SerializationMarshal SerializationStage = iota + 1
+	// SerializationUnmarshal is the time spent decoding a message with the
+	// call's codec.
+	SerializationUnmarshal
+	// SerializationCompress is the time spent compressing an encoded message.
+	SerializationCompress
+	// SerializationDecompress is the time spent decompressing an encoded
+	// message.
+	SerializationDecompress
+)
+
+func (s SerializationStage) String() string {
+	switch s {
+	case SerializationMarshal:
+		return "marshal"
+	case SerializationUnmarshal:
+		return "unmarshal"
+	case SerializationCompress:
+		return "compress"
+	case SerializationDecompress:
+		return "decompress"
+	}
+	return fmt.Sprintf("stage_%d", uint8(s))
+}
+
+// SerializationTiming describes the time spent encoding, decoding,
+// compressing, or decompressing a single message. Comparing these durations
+// with the overall latency of a call shows whether time is spent on the
+// network or on serialization.
+type SerializationTiming struct {
+	Spec  Spec
+	Stage SerializationStage
+	// Bytes is the size of the encoded message before compression.
+	Bytes    int
+	Duration time.Duration
+}
+
+// serializationTimer reports the SerializationTimings for a single call. A
+// nil *serializationTimer is valid and reports nothing, so marshalers can use
+// it unconditionally.
+type serializationTimer struct {
+	spec   Spec
+	report func(SerializationTiming)
+}
+
+// newSerializationTimer returns nil unless timings are reported, and binds the
+// call's context so that reports can be attached to its trace.
+func newSerializationTimer(
+	ctx context.Context,
+	spec Spec,
+	report func(context.Context, SerializationTiming),
+) *serializationTimer {
+	if report == nil {
+		return nil
+	}
+	return &serializationTimer{
+		spec:   spec,
+		report: func(timing SerializationTiming) { report(ctx, timing) },
+	}
+}
+
+// start returns the time at which a stage begins. It avoids reading the clock
+// if timings aren't reported.
+func (t *serializationTimer) start() time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+func (t *serializationTimer) observe(stage SerializationStage, start time.Time, bytes int) {
+	if t == nil {
+		return
+	}
+	t.report(SerializationTiming{
+		Spec:     t.spec,
+		Stage:    stage,
+		Bytes:    bytes,
+		Duration: time.Since(start),
+	})
+}
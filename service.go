@@ -0,0 +1,74 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"net/http"
+)
+
+// A Service is a named group of procedures that are mounted together. Code
+// generated by protoc-gen-connect-go provides a Service for each Protobuf
+// service, and hand-written or dynamic services can use [NewService], so
+// frameworks can mount both uniformly with [Register].
+type Service interface {
+	// ServiceName is the fully-qualified name of the service: for example,
+	// "acme.foo.v1.FooService".
+	ServiceName() string
+	// Procedures lists the service's procedures.
+	Procedures() []ServiceProcedure
+}
+
+// ServiceProcedure pairs a procedure's path (for example,
+// "/acme.foo.v1.FooService/Bar") with a function that constructs its
+// [Handler].
+type ServiceProcedure struct {
+	Procedure  string
+	NewHandler func(options ...HandlerOption) *Handler
+}
+
+// NewService constructs a [Service] from its fully-qualified name and
+// procedures.
+func NewService(name string, procedures ...ServiceProcedure) Service {
+	return &service{name: name, procedures: procedures}
+}
+
+// Register constructs handlers for each of the service's procedures, applying
+// the supplied options to all of them, and mounts each one on the mux at its
+// procedure's path. Any type with an http.ServeMux-style Handle method can be
+// used as the mux.
+func Register(
+	mux interface {
+		Handle(pattern string, handler http.Handler)
+	},
+	service Service,
+	options ...HandlerOption,
+) {
+	for _, procedure := range service.Procedures() {
+		mux.Handle(procedure.Procedure, procedure.NewHandler(options...))
+	}
+}
+
+type service struct {
+	name       string
+	procedures []ServiceProcedure
+}
+
+func (s *service) ServiceName() string {
+	return s.name
+}
+
+func (s *service) Procedures() []ServiceProcedure {
+	return s.procedures
+}
@@ -0,0 +1,102 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"net/http"
+)
+
+// A PayloadSigner computes a signature over the exact bytes of a unary
+// request message, as sent on the wire: after marshaling with the codec and
+// compressing (if applicable), but before any protocol-specific framing. It
+// attaches the signature to the request by setting headers, and it may
+// consult headers already set (for example, Content-Encoding or a timestamp
+// added by an interceptor) to build the signed string.
+//
+// PayloadSigners support payload-signing schemes like HMAC request signatures
+// and detached JWS. Configure clients to use one with [WithPayloadSigner].
+// Errors abort the call; errors that aren't already [*Error]s are returned
+// with CodeInternal.
+type PayloadSigner func(spec Spec, header http.Header, payload []byte) error
+
+// A PayloadVerifier checks the signature over the exact bytes of a unary
+// request message, as received from the wire, before the message is
+// decompressed and unmarshaled. It's the handler-side counterpart of
+// [PayloadSigner], and it receives the request headers.
+//
+// Configure handlers to use one with [WithPayloadVerifier]. A non-nil error
+// rejects the request; errors that aren't already [*Error]s are sent to the
+// client with CodeUnauthenticated.
+type PayloadVerifier func(spec Spec, header http.Header, payload []byte) error
+
+// bind returns a function that signs payloads for a single call, or nil if
+// the call doesn't need signing. Only unary calls send a single message before
+// the request headers must be on the wire, so only they can be signed.
+func (s PayloadSigner) bind(spec Spec, header http.Header) func([]byte) *Error {
+	if s == nil || spec.StreamType != StreamTypeUnary {
+		return nil
+	}
+	return func(payload []byte) *Error {
+		if err := s(spec, header, payload); err != nil {
+			if connectErr, ok := asError(err); ok {
+				return connectErr
+			}
+			return errorf(CodeInternal, "sign payload: %w", err)
+		}
+		return nil
+	}
+}
+
+// chainPayloadSigners combines bound signers, running them in order. Later
+// signers see headers set by earlier ones.
+func chainPayloadSigners(signers ...func([]byte) *Error) func([]byte) *Error {
+	var chain []func([]byte) *Error
+	for _, sign := range signers {
+		if sign != nil {
+			chain = append(chain, sign)
+		}
+	}
+	switch len(chain) {
+	case 0:
+		return nil
+	case 1:
+		return chain[0]
+	}
+	return func(payload []byte) *Error {
+		for _, sign := range chain {
+			if err := sign(payload); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// bind returns a function that verifies payloads for a single call, or nil if
+// the call doesn't need verification.
+func (v PayloadVerifier) bind(spec Spec, header http.Header) func([]byte) *Error {
+	if v == nil || spec.StreamType != StreamTypeUnary {
+		return nil
+	}
+	return func(payload []byte) *Error {
+		if err := v(spec, header, payload); err != nil {
+			if connectErr, ok := asError(err); ok {
+				return connectErr
+			}
+			return NewError(CodeUnauthenticated, err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// singleFlightKey identifies identical calls. Headers are part of the key, so
+// calls made with different credentials never share a response. Headers that
+// identify individual calls rather than their content, like call IDs and trace
+// context, are left out: otherwise, no two calls would ever be identical.
+type singleFlightKey struct {
+	digest RequestDigest
+	header string
+}
+
+func newSingleFlightKey(request AnyRequest, codec Codec, perCall map[string]struct{}) (singleFlightKey, error) {
+	digest, err := DigestRequest(request.Spec().Procedure, request.Any(), codec)
+	if err != nil {
+		return singleFlightKey{}, err
+	}
+	header := request.Header()
+	if len(perCall) > 0 {
+		header = make(http.Header, len(request.Header()))
+		for key, values := range request.Header() {
+			if _, ok := perCall[http.CanonicalHeaderKey(key)]; !ok {
+				header[key] = values
+			}
+		}
+	}
+	var encoded bytes.Buffer
+	// Header.Write sorts keys, so equal headers always produce equal strings.
+	if err := header.Write(&encoded); err != nil {
+		return singleFlightKey{}, err
+	}
+	return singleFlightKey{digest: digest, header: encoded.String()}, nil
+}
+
+// singleFlightPerCallHeaders returns the canonical names of the request
+// headers that differ between otherwise identical calls.
+func singleFlightPerCallHeaders(callIDs *callIDPolicy) map[string]struct{} {
+	perCall := map[string]struct{}{
+		headerTraceParent: {},
+		headerTraceState:  {},
+	}
+	if callIDs != nil && callIDs.header != "" {
+		perCall[callIDs.header] = struct{}{}
+	}
+	return perCall
+}
+
+// singleFlightCall is an in-flight call that identical calls can wait on.
+type singleFlightCall struct {
+	done     chan struct{}
+	waiters  int // guarded by singleFlightGroup.mu
+	response AnyResponse
+	err      error
+}
+
+// singleFlightGroup coalesces identical concurrent calls.
+type singleFlightGroup struct {
+	mu    sync.Mutex
+	calls map[singleFlightKey]*singleFlightCall
+}
+
+// do calls call, unless an identical call is already in flight. In that case,
+// it waits for the in-flight call and returns its result. The returned
+// boolean reports whether the result is shared with other callers, in which
+// case it must be copied before it's returned to the application.
+func (g *singleFlightGroup) do(
+	ctx context.Context,
+	key singleFlightKey,
+	call func() (AnyResponse, error),
+) (AnyResponse, bool, error) {
+	g.mu.Lock()
+	if inFlight, ok := g.calls[key]; ok {
+		inFlight.waiters++
+		g.mu.Unlock()
+		select {
+		case <-inFlight.done:
+			return inFlight.response, true, inFlight.err
+		case <-ctx.Done():
+			return nil, false, wrapIfContextDone(ctx, ctx.Err())
+		}
+	}
+	leader := &singleFlightCall{done: make(chan struct{})}
+	g.calls[key] = leader
+	g.mu.Unlock()
+
+	leader.response, leader.err = call()
+	g.mu.Lock()
+	delete(g.calls, key)
+	shared := leader.waiters > 0
+	g.mu.Unlock()
+	close(leader.done)
+	return leader.response, shared, leader.err
+}
+
+// newSingleFlightUnary coalesces identical concurrent calls to next, ignoring
+// the perCall headers. Every caller receives its own copy of a shared
+// response, so callers can't observe each other's changes.
+func newSingleFlightUnary[Res any](next UnaryFunc, codec Codec, perCall map[string]struct{}) UnaryFunc {
+	group := &singleFlightGroup{calls: make(map[singleFlightKey]*singleFlightCall)}
+	return func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
+		key, err := newSingleFlightKey(request, codec, perCall)
+		if err != nil {
+			// We can't tell which calls are identical, so don't coalesce.
+			return next(ctx, request)
+		}
+		response, shared, err := group.do(ctx, key, func() (AnyResponse, error) {
+			return next(ctx, request)
+		})
+		if !shared {
+			return response, err
+		}
+		if err != nil {
+			if ctx.Err() == nil && isContextError(err) {
+				// The call that we waited on was canceled, but this call wasn't,
+				// so try again.
+				return next(ctx, request)
+			}
+			return nil, copySharedError(err)
+		}
+		return copySharedResponse[Res](response)
+	}
+}
+
+func copySharedResponse[Res any](response AnyResponse) (AnyResponse, error) {
+	typed, ok := response.(*Response[Res])
+	if !ok {
+		return nil, errorf(CodeInternal, "unexpected client response type %T", response)
+	}
+	msg := new(Res)
+	if err := copyMessage[Res](msg, typed.Msg); err != nil {
+		return nil, err
+	}
+	return &Response[Res]{
+		Msg:     msg,
+		header:  typed.header.Clone(),
+		trailer: typed.trailer.Clone(),
+	}, nil
+}
+
+func copySharedError(err error) error {
+	connectErr, ok := asError(err)
+	if !ok {
+		return err
+	}
+	copied := *connectErr
+	copied.meta = connectErr.meta.Clone()
+	return &copied
+}
+
+func isContextError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	code := CodeOf(err)
+	return code == CodeCanceled || code == CodeDeadlineExceeded
+}
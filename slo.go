@@ -0,0 +1,298 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// An SLICategory classifies the outcome of an RPC for service-level
+// indicators and error budgets.
+type SLICategory uint8
+
+const (
+	// SLISuccess is a call that completed without error.
+	SLISuccess SLICategory = iota
+	// SLIUserError is a call that failed because of the caller, for example
+	// because the request was invalid or unauthenticated. User errors usually
+	// don't consume the error budget.
+	SLIUserError
+	// SLIServerError is a call that failed because of a bug or unexpected
+	// condition in the server.
+	SLIServerError
+	// SLIInfraError is a call that failed because of the infrastructure
+	// between or beneath the client and server, such as an unavailable
+	// backend, a network failure, or an expired deadline.
+	SLIInfraError
+)
+
+func (c SLICategory) String() string {
+	switch c {
+	case SLISuccess:
+		return "success"
+	case SLIUserError:
+		return "user_error"
+	case SLIServerError:
+		return "server_error"
+	case SLIInfraError:
+		return "infra_error"
+	}
+	return "unknown"
+}
+
+// An SLIClassifier assigns the outcome of a call to an SLI category. The error
+// is nil if the call succeeded. Classifiers must be safe to call
+// concurrently.
+type SLIClassifier func(spec Spec, err error) SLICategory
+
+// ClassifySLI is the default SLIClassifier. Calls that fail with
+// CodeCanceled, CodeInvalidArgument, CodeNotFound, CodeAlreadyExists,
+// CodePermissionDenied, CodeResourceExhausted, CodeFailedPrecondition,
+// CodeAborted, CodeOutOfRange, or CodeUnauthenticated are user errors, and
+// calls that fail with CodeUnavailable or CodeDeadlineExceeded are
+// infrastructure errors. In clients, errors that didn't come from the server
+// (see [IsWireError]) are also infrastructure errors. All other failures are
+// server errors. Context cancellation and deadline errors count as
+// CodeCanceled and CodeDeadlineExceeded.
+func ClassifySLI(spec Spec, err error) SLICategory {
+	if err == nil {
+		return SLISuccess
+	}
+	switch CodeOf(wrapIfContextError(err)) {
+	case CodeCanceled, CodeInvalidArgument, CodeNotFound, CodeAlreadyExists,
+		CodePermissionDenied, CodeResourceExhausted, CodeFailedPrecondition,
+		CodeAborted, CodeOutOfRange, CodeUnauthenticated:
+		return SLIUserError
+	case CodeUnavailable, CodeDeadlineExceeded:
+		return SLIInfraError
+	}
+	if spec.IsClient && !IsWireError(err) {
+		return SLIInfraError
+	}
+	return SLIServerError
+}
+
+// SLICounts are the number of calls in each SLI category.
+type SLICounts struct {
+	Success     uint64
+	UserError   uint64
+	ServerError uint64
+	InfraError  uint64
+}
+
+// Total returns the total number of calls.
+func (c SLICounts) Total() uint64 {
+	return c.Success + c.UserError + c.ServerError + c.InfraError
+}
+
+// Availability returns the fraction of calls that didn't consume the error
+// budget: successes and user errors, divided by the total. With no calls, the
+// availability is 1.
+func (c SLICounts) Availability() float64 {
+	total := c.Total()
+	if total == 0 {
+		return 1
+	}
+	return float64(c.Success+c.UserError) / float64(total)
+}
+
+func (c *SLICounts) add(category SLICategory) {
+	switch category {
+	case SLISuccess:
+		atomic.AddUint64(&c.Success, 1)
+	case SLIUserError:
+		atomic.AddUint64(&c.UserError, 1)
+	case SLIServerError:
+		atomic.AddUint64(&c.ServerError, 1)
+	case SLIInfraError:
+		atomic.AddUint64(&c.InfraError, 1)
+	}
+}
+
+func (c *SLICounts) load() SLICounts {
+	return SLICounts{
+		Success:     atomic.LoadUint64(&c.Success),
+		UserError:   atomic.LoadUint64(&c.UserError),
+		ServerError: atomic.LoadUint64(&c.ServerError),
+		InfraError:  atomic.LoadUint64(&c.InfraError),
+	}
+}
+
+// An SLITracker is an [Interceptor] that classifies the outcome of every call
+// into SLI categories and keeps aggregate counts, for export to error-budget
+// and alerting tools. Add it to clients or handlers with [WithInterceptors];
+// one tracker may be shared by many clients and handlers, but it doesn't
+// distinguish between them, so most applications use separate trackers for
+// the calls they serve and the calls they make.
+//
+// Each call is counted once, when its outcome is known: for handlers, when
+// the implementation returns, and for clients, when the response ends or is
+// closed. Streaming calls closed by the client before the response ends count
+// as successes.
+type SLITracker struct {
+	classify SLIClassifier
+
+	mu         sync.RWMutex
+	procedures map[string]*SLICounts
+}
+
+// NewSLITracker constructs an SLITracker. If classify is nil, the tracker
+// uses [ClassifySLI].
+func NewSLITracker(classify SLIClassifier) *SLITracker {
+	if classify == nil {
+		classify = ClassifySLI
+	}
+	return &SLITracker{
+		classify:   classify,
+		procedures: make(map[string]*SLICounts),
+	}
+}
+
+// Counts returns the counts for all procedures combined.
+func (t *SLITracker) Counts() SLICounts {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	var total SLICounts
+	for _, counts := range t.procedures {
+		snapshot := counts.load()
+		total.Success += snapshot.Success
+		total.UserError += snapshot.UserError
+		total.ServerError += snapshot.ServerError
+		total.InfraError += snapshot.InfraError
+	}
+	return total
+}
+
+// ProcedureCounts returns the counts for each procedure that has been
+// called, keyed by procedure (for example, "/acme.foo.v1.FooService/Bar").
+func (t *SLITracker) ProcedureCounts() map[string]SLICounts {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	snapshot := make(map[string]SLICounts, len(t.procedures))
+	for procedure, counts := range t.procedures {
+		snapshot[procedure] = counts.load()
+	}
+	return snapshot
+}
+
+// WrapUnary implements [Interceptor].
+func (t *SLITracker) WrapUnary(next UnaryFunc) UnaryFunc {
+	return func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
+		response, err := next(ctx, request)
+		t.record(request.Spec(), err)
+		return response, err
+	}
+}
+
+// WrapStreamingClient implements [Interceptor].
+func (t *SLITracker) WrapStreamingClient(next StreamingClientFunc) StreamingClientFunc {
+	return func(ctx context.Context, spec Spec) StreamingClientConn {
+		return &sliClientConn{
+			StreamingClientConn: next(ctx, spec),
+			tracker:             t,
+		}
+	}
+}
+
+// WrapStreamingHandler implements [Interceptor].
+func (t *SLITracker) WrapStreamingHandler(next StreamingHandlerFunc) StreamingHandlerFunc {
+	return func(ctx context.Context, conn StreamingHandlerConn) error {
+		err := next(ctx, conn)
+		t.record(conn.Spec(), err)
+		return err
+	}
+}
+
+func (t *SLITracker) record(spec Spec, err error) {
+	if err != nil {
+		err = wrapIfContextError(err)
+	}
+	t.countsFor(spec.Procedure).add(t.classify(spec, err))
+}
+
+func (t *SLITracker) countsFor(procedure string) *SLICounts {
+	t.mu.RLock()
+	counts, ok := t.procedures[procedure]
+	t.mu.RUnlock()
+	if ok {
+		return counts
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if counts, ok := t.procedures[procedure]; ok {
+		return counts
+	}
+	counts = &SLICounts{}
+	t.procedures[procedure] = counts
+	return counts
+}
+
+// sliClientConn records the outcome of a client stream when the response
+// ends, or when it's closed early.
+type sliClientConn struct {
+	StreamingClientConn
+
+	tracker *SLITracker
+	once    sync.Once
+}
+
+func (cc *sliClientConn) Receive(msg any) error {
+	return cc.observe(cc.StreamingClientConn.Receive(msg))
+}
+
+func (cc *sliClientConn) ReceiveWithMetadata(msg any) (http.Header, error) {
+	metadata, err := ReceiveWithMetadata(cc.StreamingClientConn, msg)
+	return metadata, cc.observe(err)
+}
+
+func (cc *sliClientConn) SendWithMetadata(msg any, metadata http.Header) error {
+	return SendWithMetadata(cc.StreamingClientConn, msg, metadata)
+}
+
+func (cc *sliClientConn) ReceiveWithEnvelopeFlags(msg any) ([]string, error) {
+	flags, err := ReceiveWithEnvelopeFlags(cc.StreamingClientConn, msg)
+	return flags, cc.observe(err)
+}
+
+func (cc *sliClientConn) SendWithEnvelopeFlags(msg any, flags []string) error {
+	return SendWithEnvelopeFlags(cc.StreamingClientConn, msg, flags...)
+}
+
+func (cc *sliClientConn) CloseResponse() error {
+	err := cc.StreamingClientConn.CloseResponse()
+	cc.finish(nil)
+	return err
+}
+
+// observe records the outcome of the call if err ends the response.
+func (cc *sliClientConn) observe(err error) error {
+	if errors.Is(err, io.EOF) {
+		cc.finish(nil)
+	} else if err != nil {
+		cc.finish(err)
+	}
+	return err
+}
+
+func (cc *sliClientConn) finish(err error) {
+	cc.once.Do(func() {
+		cc.tracker.record(cc.Spec(), err)
+	})
+}
@@ -0,0 +1,95 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/bufbuild/connect-go/internal/assert"
+	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
+	"github.com/bufbuild/connect-go/internal/gen/connect/ping/v1/pingv1connect"
+)
+
+func TestSLITracker(t *testing.T) {
+	t.Parallel()
+	handlerTracker := connect.NewSLITracker(nil)
+	clientTracker := connect.NewSLITracker(nil)
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		pingServer{},
+		connect.WithInterceptors(handlerTracker),
+	))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := pingv1connect.NewPingServiceClient(
+		server.Client(),
+		server.URL,
+		connect.WithInterceptors(clientTracker),
+	)
+	ctx := context.Background()
+
+	_, err := client.Ping(ctx, connect.NewRequest(&pingv1.PingRequest{}))
+	assert.Nil(t, err)
+	for _, code := range []connect.Code{connect.CodeNotFound, connect.CodeInternal, connect.CodeUnavailable} {
+		_, err := client.Fail(ctx, connect.NewRequest(&pingv1.FailRequest{Code: int32(code)}))
+		assert.Equal(t, connect.CodeOf(err), code)
+	}
+	stream, err := client.CountUp(ctx, connect.NewRequest(&pingv1.CountUpRequest{Number: 3}))
+	assert.Nil(t, err)
+	for stream.Receive() {
+	}
+	assert.Nil(t, stream.Err())
+	assert.Nil(t, stream.Close())
+
+	want := connect.SLICounts{Success: 2, UserError: 1, ServerError: 1, InfraError: 1}
+	assert.Equal(t, handlerTracker.Counts(), want)
+	assert.Equal(t, clientTracker.Counts(), want)
+	assert.Equal(t, want.Total(), uint64(5))
+	assert.Equal(t, want.Availability(), 0.6)
+	assert.Equal(t, handlerTracker.ProcedureCounts(), map[string]connect.SLICounts{
+		"/" + pingv1connect.PingServiceName + "/Ping":    {Success: 1},
+		"/" + pingv1connect.PingServiceName + "/Fail":    {UserError: 1, ServerError: 1, InfraError: 1},
+		"/" + pingv1connect.PingServiceName + "/CountUp": {Success: 1},
+	})
+}
+
+func TestClassifySLI(t *testing.T) {
+	t.Parallel()
+	handlerSpec := connect.Spec{}
+	clientSpec := connect.Spec{IsClient: true}
+	assert.Equal(t, connect.ClassifySLI(handlerSpec, nil), connect.SLISuccess)
+	assert.Equal(t, connect.ClassifySLI(handlerSpec, connect.NewError(connect.CodePermissionDenied, nil)), connect.SLIUserError)
+	assert.Equal(t, connect.ClassifySLI(handlerSpec, context.DeadlineExceeded), connect.SLIInfraError)
+	assert.Equal(t, connect.ClassifySLI(handlerSpec, errors.New("oops")), connect.SLIServerError)
+	assert.Equal(t, connect.ClassifySLI(clientSpec, errors.New("connection reset")), connect.SLIInfraError)
+	assert.Equal(t, connect.SLIInfraError.String(), "infra_error")
+
+	tracker := connect.NewSLITracker(func(connect.Spec, error) connect.SLICategory {
+		return connect.SLIServerError
+	})
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}, connect.WithInterceptors(tracker)))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+	_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+	assert.Nil(t, err)
+	assert.Equal(t, tracker.Counts(), connect.SLICounts{ServerError: 1})
+}
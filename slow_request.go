@@ -0,0 +1,136 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// SlowRequestStage describes how far a slow RPC had progressed when it was
+// reported to the callback configured with [WithSlowRequestThreshold].
+type SlowRequestStage uint8
+
+const (
+	// SlowRequestStageFirstMessage indicates that the handler hadn't yet
+	// received a message from the client.
+	SlowRequestStageFirstMessage SlowRequestStage = iota + 1
+	// SlowRequestStageHeaders indicates that the handler had received a message,
+	// but hadn't yet sent response headers.
+	SlowRequestStageHeaders
+	// SlowRequestStageTotal indicates that the handler had received a message
+	// and started responding, but hadn't finished the RPC.
+	SlowRequestStageTotal
+)
+
+func (s SlowRequestStage) String() string {
+	switch s {
+	case SlowRequestStageFirstMessage:
+		return "first-message"
+	case SlowRequestStageHeaders:
+		return "headers"
+	case SlowRequestStageTotal:
+		return "total"
+	}
+	return "unknown"
+}
+
+// slowRequestConn tracks the progress of an RPC, and reports it if the RPC
+// is still running after the threshold.
+type slowRequestConn struct {
+	handlerConnCloser
+
+	received int32 // atomic
+	sent     int32 // atomic
+	timer    *time.Timer
+}
+
+func newSlowRequestConn(
+	ctx context.Context,
+	conn handlerConnCloser,
+	threshold time.Duration,
+	report func(context.Context, Spec, Peer, time.Duration, SlowRequestStage),
+) *slowRequestConn {
+	start := time.Now()
+	slow := &slowRequestConn{handlerConnCloser: conn}
+	slow.timer = time.AfterFunc(threshold, func() {
+		report(ctx, conn.Spec(), conn.Peer(), time.Since(start), slow.stage())
+	})
+	return slow
+}
+
+func (hc *slowRequestConn) Receive(msg any) error {
+	err := hc.handlerConnCloser.Receive(msg)
+	if err == nil {
+		atomic.StoreInt32(&hc.received, 1)
+	}
+	return err
+}
+
+func (hc *slowRequestConn) ReceiveWithMetadata(msg any) (http.Header, error) {
+	metadata, err := ReceiveWithMetadata(hc.handlerConnCloser, msg)
+	if err == nil {
+		atomic.StoreInt32(&hc.received, 1)
+	}
+	return metadata, err
+}
+
+func (hc *slowRequestConn) Send(msg any) error {
+	atomic.StoreInt32(&hc.sent, 1)
+	return hc.handlerConnCloser.Send(msg)
+}
+
+func (hc *slowRequestConn) SendWithMetadata(msg any, metadata http.Header) error {
+	atomic.StoreInt32(&hc.sent, 1)
+	return SendWithMetadata(hc.handlerConnCloser, msg, metadata)
+}
+
+func (hc *slowRequestConn) ReceiveWithEnvelopeFlags(msg any) ([]string, error) {
+	flags, err := ReceiveWithEnvelopeFlags(hc.handlerConnCloser, msg)
+	if err == nil {
+		atomic.StoreInt32(&hc.received, 1)
+	}
+	return flags, err
+}
+
+func (hc *slowRequestConn) SendWithEnvelopeFlags(msg any, flags []string) error {
+	atomic.StoreInt32(&hc.sent, 1)
+	return SendWithEnvelopeFlags(hc.handlerConnCloser, msg, flags...)
+}
+
+func (hc *slowRequestConn) CloseReceive() error {
+	return closeReceive(hc.handlerConnCloser)
+}
+
+func (hc *slowRequestConn) Close(err error) error {
+	hc.timer.Stop()
+	return hc.handlerConnCloser.Close(err)
+}
+
+func (hc *slowRequestConn) applyPolicy(policy *CallPolicy) {
+	applyPolicy(hc.handlerConnCloser, policy)
+}
+
+func (hc *slowRequestConn) stage() SlowRequestStage {
+	if atomic.LoadInt32(&hc.received) == 0 {
+		return SlowRequestStageFirstMessage
+	}
+	if atomic.LoadInt32(&hc.sent) == 0 {
+		return SlowRequestStageHeaders
+	}
+	return SlowRequestStageTotal
+}
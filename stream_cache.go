@@ -0,0 +1,275 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	defaultServerStreamCacheMaxEntries    = 1024
+	defaultServerStreamCacheMaxBytes      = 64 << 20 // 64 MiB
+	defaultServerStreamCacheMaxEntryBytes = 4 << 20  // 4 MiB
+)
+
+// ServerStreamCacheLimits bounds the memory used by [WithServerStreamCache].
+// The zero value uses the defaults described on each field. Message sizes are
+// measured with [proto.Size]; messages that aren't Protobuf messages count as
+// empty.
+type ServerStreamCacheLimits struct {
+	// MaxEntries limits the number of cached responses. Once it's reached, the
+	// least recently used response is evicted to make room. The default is
+	// 1024.
+	MaxEntries int
+	// MaxBytes limits the total size of the cached messages, evicting the
+	// least recently used responses as necessary. The default is 64 MiB.
+	MaxBytes int
+	// MaxEntryBytes limits the size of a single cached response. Once a
+	// stream's messages exceed it, the handler stops recording them and the
+	// response isn't cached. The default is 4 MiB.
+	MaxEntryBytes int
+}
+
+// serverStreamCache records the responses of a server streaming procedure and
+// replays them for identical requests until they expire. Entries are kept in
+// least recently used order and evicted once the cache exceeds its limits.
+// Expired entries are removed lazily, when they're looked up or reach the end
+// of the eviction order.
+type serverStreamCache struct {
+	ttl           time.Duration
+	maxEntries    int
+	maxBytes      int
+	maxEntryBytes int
+	now           func() time.Time
+
+	mu      sync.Mutex
+	entries map[RequestDigest]*list.Element
+	lru     *list.List // of *serverStreamCacheEntry, most recently used first
+	bytes   int
+}
+
+type serverStreamCacheEntry struct {
+	key      RequestDigest
+	expires  time.Time
+	header   http.Header
+	trailer  http.Header
+	messages []any
+	size     int
+}
+
+func newServerStreamCache(ttl time.Duration, limits ServerStreamCacheLimits) *serverStreamCache {
+	cache := &serverStreamCache{
+		ttl:           ttl,
+		maxEntries:    limits.MaxEntries,
+		maxBytes:      limits.MaxBytes,
+		maxEntryBytes: limits.MaxEntryBytes,
+		now:           time.Now,
+		entries:       make(map[RequestDigest]*list.Element),
+		lru:           list.New(),
+	}
+	if cache.maxEntries <= 0 {
+		cache.maxEntries = defaultServerStreamCacheMaxEntries
+	}
+	if cache.maxBytes <= 0 {
+		cache.maxBytes = defaultServerStreamCacheMaxBytes
+	}
+	if cache.maxEntryBytes <= 0 {
+		cache.maxEntryBytes = defaultServerStreamCacheMaxEntryBytes
+	}
+	if cache.maxEntryBytes > cache.maxBytes {
+		cache.maxEntryBytes = cache.maxBytes
+	}
+	return cache
+}
+
+// Serve replays a cached response to the request if there is one. Otherwise,
+// it calls the implementation and caches the response if the implementation
+// succeeds. Requests that aren't Protobuf messages are never cached.
+func (c *serverStreamCache) Serve(
+	conn StreamingHandlerConn,
+	request any,
+	implementation func(StreamingHandlerConn) error,
+) error {
+	key, err := DigestRequest(conn.Spec().Procedure, request, nil)
+	if err != nil {
+		return implementation(conn)
+	}
+	if entry := c.get(key); entry != nil {
+		mergeHeaders(conn.ResponseHeader(), entry.header)
+		mergeHeaders(conn.ResponseTrailer(), entry.trailer)
+		for _, msg := range entry.messages {
+			if err := conn.Send(msg); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	recorder := &recordingHandlerConn{
+		StreamingHandlerConn: conn,
+		initialHeader:        conn.ResponseHeader().Clone(),
+		maxBytes:             c.maxEntryBytes,
+	}
+	if err := implementation(recorder); err != nil {
+		return err
+	}
+	if recorder.uncacheable {
+		return nil
+	}
+	c.put(&serverStreamCacheEntry{
+		key:      key,
+		expires:  c.now().Add(c.ttl),
+		header:   recorder.addedHeaders(),
+		trailer:  conn.ResponseTrailer().Clone(),
+		messages: recorder.messages,
+		size:     recorder.bytes,
+	})
+	return nil
+}
+
+func (c *serverStreamCache) get(key RequestDigest) *serverStreamCacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	entry, _ := elem.Value.(*serverStreamCacheEntry)
+	if !c.now().Before(entry.expires) {
+		c.remove(elem)
+		return nil
+	}
+	c.lru.MoveToFront(elem)
+	return entry
+}
+
+func (c *serverStreamCache) put(entry *serverStreamCacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[entry.key]; ok {
+		c.remove(elem)
+	}
+	c.entries[entry.key] = c.lru.PushFront(entry)
+	c.bytes += entry.size
+	now := c.now()
+	for back := c.lru.Back(); back != nil; back = c.lru.Back() {
+		oldest, _ := back.Value.(*serverStreamCacheEntry)
+		if c.lru.Len() <= c.maxEntries && c.bytes <= c.maxBytes && now.Before(oldest.expires) {
+			break
+		}
+		c.remove(back)
+	}
+}
+
+func (c *serverStreamCache) remove(elem *list.Element) {
+	entry, _ := c.lru.Remove(elem).(*serverStreamCacheEntry)
+	delete(c.entries, entry.key)
+	c.bytes -= entry.size
+}
+
+// recordingHandlerConn records a copy of each message sent, until the
+// messages exceed maxBytes. Messages sent with metadata or envelope flags
+// can't be replayed faithfully, so they stop the recording too.
+type recordingHandlerConn struct {
+	StreamingHandlerConn
+
+	initialHeader http.Header
+	maxBytes      int
+	messages      []any
+	bytes         int
+	uncacheable   bool
+}
+
+func (c *recordingHandlerConn) Send(msg any) error {
+	if err := c.StreamingHandlerConn.Send(msg); err != nil {
+		return err
+	}
+	c.record(msg)
+	return nil
+}
+
+func (c *recordingHandlerConn) SendWithMetadata(msg any, metadata http.Header) error {
+	if err := SendWithMetadata(c.StreamingHandlerConn, msg, metadata); err != nil {
+		return err
+	}
+	if len(metadata) > 0 {
+		c.stopRecording()
+		return nil
+	}
+	c.record(msg)
+	return nil
+}
+
+func (c *recordingHandlerConn) ReceiveWithMetadata(msg any) (http.Header, error) {
+	return ReceiveWithMetadata(c.StreamingHandlerConn, msg)
+}
+
+func (c *recordingHandlerConn) SendWithEnvelopeFlags(msg any, flags []string) error {
+	if err := SendWithEnvelopeFlags(c.StreamingHandlerConn, msg, flags...); err != nil {
+		return err
+	}
+	if len(flags) > 0 {
+		c.stopRecording()
+		return nil
+	}
+	c.record(msg)
+	return nil
+}
+
+func (c *recordingHandlerConn) ReceiveWithEnvelopeFlags(msg any) ([]string, error) {
+	return ReceiveWithEnvelopeFlags(c.StreamingHandlerConn, msg)
+}
+
+func (c *recordingHandlerConn) CloseReceive() error {
+	return closeReceive(c.StreamingHandlerConn)
+}
+
+func (c *recordingHandlerConn) record(msg any) {
+	if c.uncacheable {
+		return
+	}
+	if protoMessage, ok := msg.(proto.Message); ok {
+		c.bytes += proto.Size(protoMessage)
+		if c.bytes > c.maxBytes {
+			// Too large to cache.
+			c.stopRecording()
+			return
+		}
+		// Handlers may reuse messages after sending them.
+		msg = proto.Clone(protoMessage)
+	}
+	c.messages = append(c.messages, msg)
+}
+
+func (c *recordingHandlerConn) stopRecording() {
+	c.uncacheable = true
+	c.messages = nil
+}
+
+// addedHeaders returns the response headers set by the implementation, as
+// opposed to those set by the protocol.
+func (c *recordingHandlerConn) addedHeaders() http.Header {
+	added := make(http.Header)
+	for key, values := range c.ResponseHeader() {
+		if _, ok := c.initialHeader[key]; !ok {
+			added[key] = append([]string(nil), values...)
+		}
+	}
+	return added
+}
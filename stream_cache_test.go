@@ -0,0 +1,225 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bufbuild/connect-go/internal/assert"
+	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestServerStreamCacheLimits(t *testing.T) {
+	t.Parallel()
+	// serve calls the cache with a request for number, and reports whether
+	// the implementation ran. The implementation sends one message whose text
+	// is number bytes long.
+	serve := func(t *testing.T, cache *serverStreamCache, number int64) bool {
+		t.Helper()
+		var called bool
+		conn := &streamCacheTestConn{
+			header:  make(http.Header),
+			trailer: make(http.Header),
+		}
+		err := cache.Serve(conn, &pingv1.CountUpRequest{Number: number}, func(conn StreamingHandlerConn) error {
+			called = true
+			return conn.Send(&pingv1.PingResponse{Number: number, Text: strings.Repeat("x", int(number))})
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, len(conn.sent), 1)
+		return called
+	}
+	messageSize := func(number int64) int {
+		return proto.Size(&pingv1.PingResponse{Number: number, Text: strings.Repeat("x", int(number))})
+	}
+
+	t.Run("max_entries", func(t *testing.T) {
+		t.Parallel()
+		cache := newServerStreamCache(time.Hour, ServerStreamCacheLimits{MaxEntries: 2})
+		assert.True(t, serve(t, cache, 1))
+		assert.True(t, serve(t, cache, 2))
+		assert.False(t, serve(t, cache, 1)) // now the most recently used
+		assert.True(t, serve(t, cache, 3))  // evicts 2
+		assert.False(t, serve(t, cache, 1))
+		assert.False(t, serve(t, cache, 3))
+		assert.True(t, serve(t, cache, 2))
+		assert.Equal(t, cache.lru.Len(), 2)
+	})
+	t.Run("max_bytes", func(t *testing.T) {
+		t.Parallel()
+		cache := newServerStreamCache(time.Hour, ServerStreamCacheLimits{
+			MaxBytes: messageSize(10) + messageSize(20),
+		})
+		assert.True(t, serve(t, cache, 10))
+		assert.True(t, serve(t, cache, 20))
+		assert.True(t, serve(t, cache, 30)) // evicts 10 and 20
+		assert.Equal(t, cache.lru.Len(), 1)
+		assert.Equal(t, cache.bytes, messageSize(30))
+		assert.False(t, serve(t, cache, 30))
+		assert.True(t, serve(t, cache, 10))
+	})
+	t.Run("max_entry_bytes", func(t *testing.T) {
+		t.Parallel()
+		cache := newServerStreamCache(time.Hour, ServerStreamCacheLimits{MaxEntryBytes: messageSize(10)})
+		assert.True(t, serve(t, cache, 10))
+		assert.False(t, serve(t, cache, 10))
+		// Too large to record, so every call runs the implementation.
+		assert.True(t, serve(t, cache, 11))
+		assert.True(t, serve(t, cache, 11))
+		assert.Equal(t, cache.lru.Len(), 1)
+	})
+	t.Run("expiry", func(t *testing.T) {
+		t.Parallel()
+		now := time.Now()
+		cache := newServerStreamCache(time.Minute, ServerStreamCacheLimits{})
+		cache.now = func() time.Time { return now }
+		assert.True(t, serve(t, cache, 1))
+		now = now.Add(30 * time.Second)
+		assert.True(t, serve(t, cache, 2))
+		assert.False(t, serve(t, cache, 1))
+		now = now.Add(45 * time.Second)
+		// Entry 1 was used recently, but it's still expired.
+		assert.True(t, serve(t, cache, 1))
+		// Adding an entry removes expired entries from the end of the list.
+		now = now.Add(time.Minute)
+		assert.True(t, serve(t, cache, 3))
+		assert.Equal(t, cache.lru.Len(), 1)
+		assert.Equal(t, cache.bytes, messageSize(3))
+	})
+}
+
+func TestServerStreamCacheForwarding(t *testing.T) {
+	t.Parallel()
+	// serve calls the cache with the same request every time, and reports
+	// whether the implementation ran.
+	serve := func(t *testing.T, cache *serverStreamCache, send func(StreamingHandlerConn) error) (*streamCacheTestConn, bool) {
+		t.Helper()
+		var called bool
+		conn := &streamCacheTestConn{
+			header:  make(http.Header),
+			trailer: make(http.Header),
+		}
+		err := cache.Serve(conn, &pingv1.CountUpRequest{Number: 1}, func(conn StreamingHandlerConn) error {
+			called = true
+			return send(conn)
+		})
+		assert.Nil(t, err)
+		return conn, called
+	}
+
+	t.Run("metadata", func(t *testing.T) {
+		t.Parallel()
+		cache := newServerStreamCache(time.Hour, ServerStreamCacheLimits{})
+		send := func(conn StreamingHandlerConn) error {
+			return SendWithMetadata(conn, &pingv1.PingResponse{Number: 1}, http.Header{"Foo": []string{"bar"}})
+		}
+		conn, called := serve(t, cache, send)
+		assert.True(t, called)
+		assert.Equal(t, conn.metadata, []http.Header{{"Foo": []string{"bar"}}})
+		// Replaying would drop the metadata, so the response isn't cached.
+		_, called = serve(t, cache, send)
+		assert.True(t, called)
+		assert.Equal(t, cache.lru.Len(), 0)
+	})
+	t.Run("envelope_flags", func(t *testing.T) {
+		t.Parallel()
+		cache := newServerStreamCache(time.Hour, ServerStreamCacheLimits{})
+		send := func(conn StreamingHandlerConn) error {
+			return SendWithEnvelopeFlags(conn, &pingv1.PingResponse{Number: 1}, "checksum")
+		}
+		conn, called := serve(t, cache, send)
+		assert.True(t, called)
+		assert.Equal(t, conn.flags, [][]string{{"checksum"}})
+		_, called = serve(t, cache, send)
+		assert.True(t, called)
+		assert.Equal(t, cache.lru.Len(), 0)
+	})
+	t.Run("empty_metadata", func(t *testing.T) {
+		t.Parallel()
+		cache := newServerStreamCache(time.Hour, ServerStreamCacheLimits{})
+		send := func(conn StreamingHandlerConn) error {
+			return SendWithMetadata(conn, &pingv1.PingResponse{Number: 1}, nil)
+		}
+		_, called := serve(t, cache, send)
+		assert.True(t, called)
+		conn, called := serve(t, cache, send)
+		assert.False(t, called)
+		assert.Equal(t, len(conn.sent), 1)
+	})
+	t.Run("close_receive", func(t *testing.T) {
+		t.Parallel()
+		cache := newServerStreamCache(time.Hour, ServerStreamCacheLimits{})
+		conn, _ := serve(t, cache, func(conn StreamingHandlerConn) error {
+			return closeReceive(conn)
+		})
+		assert.True(t, conn.receiveClosed)
+	})
+}
+
+type streamCacheTestConn struct {
+	StreamingHandlerConn
+
+	header        http.Header
+	trailer       http.Header
+	sent          []any
+	metadata      []http.Header
+	flags         [][]string
+	receiveClosed bool
+}
+
+func (c *streamCacheTestConn) Spec() Spec {
+	return Spec{Procedure: "/connect.ping.v1.PingService/CountUp", StreamType: StreamTypeServer}
+}
+
+func (c *streamCacheTestConn) Send(msg any) error {
+	c.sent = append(c.sent, msg)
+	return nil
+}
+
+func (c *streamCacheTestConn) SendWithMetadata(msg any, metadata http.Header) error {
+	c.metadata = append(c.metadata, metadata)
+	return c.Send(msg)
+}
+
+func (c *streamCacheTestConn) ReceiveWithMetadata(any) (http.Header, error) {
+	return nil, io.EOF
+}
+
+func (c *streamCacheTestConn) SendWithEnvelopeFlags(msg any, flags []string) error {
+	c.flags = append(c.flags, flags)
+	return c.Send(msg)
+}
+
+func (c *streamCacheTestConn) ReceiveWithEnvelopeFlags(any) ([]string, error) {
+	return nil, io.EOF
+}
+
+func (c *streamCacheTestConn) CloseReceive() error {
+	c.receiveClosed = true
+	return nil
+}
+
+func (c *streamCacheTestConn) ResponseHeader() http.Header {
+	return c.header
+}
+
+func (c *streamCacheTestConn) ResponseTrailer() http.Header {
+	return c.trailer
+}
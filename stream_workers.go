@@ -0,0 +1,242 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+)
+
+// StreamWorkers serves a bidirectional stream with a bounded pool of worker
+// goroutines. It receives messages from the client, calls handle for each one
+// on one of the workers, and sends the non-nil responses back to the client.
+// If ordered is true, responses are sent in the order their requests were
+// received; otherwise, they're sent as soon as they're ready. At most workers
+// requests are in flight at once, which bounds memory use in both modes.
+//
+// StreamWorkers returns nil once the client has finished sending, all
+// requests have been handled, and all responses have been sent. If receiving,
+// handling, or sending fails, the context passed to handle is canceled, and
+// StreamWorkers returns the first error after the workers stop. When it stops
+// early, it closes the receive side of the stream with
+// [BidiStream.CloseReceive], which interrupts a pending Receive, and waits for
+// the Receive to return, so no goroutines outlive the call. If interceptors
+// have wrapped the stream's connection, Receive can't be interrupted and
+// StreamWorkers waits until the client sends another message or closes its
+// side of the stream.
+//
+// If handle panics, StreamWorkers stops the other workers and then panics with
+// the same value on the calling goroutine. A panic on a worker goroutine would
+// otherwise crash the process; re-panicking on the handler's goroutine lets
+// the usual recovery mechanisms, like [WithRecover], handle it.
+//
+//	func (s *Server) Process(ctx context.Context, stream *connect.BidiStream[Req, Res]) error {
+//	  return connect.StreamWorkers(ctx, stream, 8, true, s.processOne)
+//	}
+func StreamWorkers[Req, Res any](
+	ctx context.Context,
+	stream *BidiStream[Req, Res],
+	workers int,
+	ordered bool,
+	handle func(context.Context, *Req) (*Res, error),
+) error {
+	if workers < 1 {
+		workers = 1
+	}
+	poolCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	pool := &streamWorkerPool[Req, Res]{
+		ctx:     poolCtx,
+		cancel:  cancel,
+		stream:  stream,
+		handle:  handle,
+		ordered: ordered,
+		slots:   make(chan struct{}, workers),
+		jobs:    make(chan streamWorkerJob[Req]),
+		results: make(chan streamWorkerResult[Res], workers),
+	}
+	var workersDone sync.WaitGroup
+	workersDone.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer workersDone.Done()
+			pool.work()
+		}()
+	}
+	senderDone := make(chan struct{})
+	go func() {
+		defer close(senderDone)
+		pool.send()
+	}()
+	receiverDone := make(chan struct{})
+	go func() {
+		defer close(receiverDone)
+		pool.receive()
+	}()
+	workersDone.Wait()
+	close(pool.results)
+	<-senderDone
+	if poolCtx.Err() != nil {
+		// The pool stopped early, and the receiver may be blocked in Receive.
+		_ = stream.CloseReceive()
+	}
+	<-receiverDone
+	if pool.panicked {
+		panic(pool.panicValue) //nolint:forbidigo
+	}
+	if pool.err != nil {
+		return pool.err
+	}
+	// If the caller's context is done, some requests may not have been handled.
+	return wrapIfContextError(ctx.Err())
+}
+
+type streamWorkerJob[Req any] struct {
+	seq int
+	msg *Req
+}
+
+type streamWorkerResult[Res any] struct {
+	seq int
+	msg *Res
+}
+
+type streamWorkerPool[Req, Res any] struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	stream  *BidiStream[Req, Res]
+	handle  func(context.Context, *Req) (*Res, error)
+	ordered bool
+	// Each in-flight request holds a slot from receipt until its response is
+	// sent, so slots bound both concurrency and buffered responses.
+	slots   chan struct{}
+	jobs    chan streamWorkerJob[Req]
+	results chan streamWorkerResult[Res]
+
+	errOnce sync.Once
+	err     error
+
+	panicOnce  sync.Once
+	panicked   bool
+	panicValue any
+}
+
+func (p *streamWorkerPool[Req, Res]) fail(err error) {
+	p.errOnce.Do(func() {
+		p.err = err
+		p.cancel()
+	})
+}
+
+// receive reads requests and hands them to the workers. It closes the jobs
+// channel when the client is done sending or the pool fails.
+func (p *streamWorkerPool[Req, Res]) receive() {
+	defer close(p.jobs)
+	for seq := 0; ; seq++ {
+		select {
+		case p.slots <- struct{}{}:
+		case <-p.ctx.Done():
+			return
+		}
+		msg, err := p.stream.Receive()
+		if errors.Is(err, io.EOF) {
+			return
+		} else if err != nil {
+			p.fail(err)
+			return
+		}
+		select {
+		case p.jobs <- streamWorkerJob[Req]{seq: seq, msg: msg}:
+		case <-p.ctx.Done():
+			return
+		}
+	}
+}
+
+func (p *streamWorkerPool[Req, Res]) work() {
+	for {
+		var job streamWorkerJob[Req]
+		select {
+		case <-p.ctx.Done():
+			return
+		case j, ok := <-p.jobs:
+			if !ok {
+				return
+			}
+			job = j
+		}
+		res, err := p.safeHandle(job.msg)
+		if err != nil {
+			p.fail(err)
+			return
+		}
+		p.results <- streamWorkerResult[Res]{seq: job.seq, msg: res}
+	}
+}
+
+// safeHandle calls handle, converting panics into errors that stop the pool.
+func (p *streamWorkerPool[Req, Res]) safeHandle(msg *Req) (res *Res, err error) {
+	panicked := true
+	defer func() {
+		if !panicked {
+			return
+		}
+		r := recover()
+		p.panicOnce.Do(func() {
+			p.panicked = true
+			p.panicValue = r
+		})
+		err = errorf(CodeInternal, "stream worker panicked: %v", r)
+		p.fail(err)
+	}()
+	res, err = p.handle(p.ctx, msg)
+	panicked = false
+	return res, err
+}
+
+func (p *streamWorkerPool[Req, Res]) send() {
+	pending := make(map[int]*Res)
+	next := 0
+	for result := range p.results {
+		if p.ctx.Err() != nil {
+			continue // drain results so that workers can exit
+		}
+		if !p.ordered {
+			p.sendOne(result.msg)
+			continue
+		}
+		pending[result.seq] = result.msg
+		for {
+			msg, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			p.sendOne(msg)
+		}
+	}
+}
+
+func (p *streamWorkerPool[Req, Res]) sendOne(msg *Res) {
+	if msg != nil && p.ctx.Err() == nil {
+		if err := p.stream.Send(msg); err != nil {
+			p.fail(err)
+		}
+	}
+	<-p.slots
+}
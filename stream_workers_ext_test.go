@@ -0,0 +1,185 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/bufbuild/connect-go/internal/assert"
+	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
+	"github.com/bufbuild/connect-go/internal/gen/connect/ping/v1/pingv1connect"
+)
+
+func TestStreamWorkers(t *testing.T) {
+	t.Parallel()
+	const (
+		cumSumProcedure = "/" + pingv1connect.PingServiceName + "/CumSum"
+		workers         = 4
+		messages        = 20
+	)
+	newServer := func(t *testing.T, ordered bool, inFlight *int32) *httptest.Server {
+		t.Helper()
+		var current int32
+		mux := http.NewServeMux()
+		mux.Handle(cumSumProcedure, connect.NewBidiStreamHandler(
+			cumSumProcedure,
+			func(ctx context.Context, stream *connect.BidiStream[pingv1.CumSumRequest, pingv1.CumSumResponse]) error {
+				return connect.StreamWorkers(ctx, stream, workers, ordered, func(ctx context.Context, req *pingv1.CumSumRequest) (*pingv1.CumSumResponse, error) {
+					now := atomic.AddInt32(&current, 1)
+					defer atomic.AddInt32(&current, -1)
+					for {
+						peak := atomic.LoadInt32(inFlight)
+						if now <= peak || atomic.CompareAndSwapInt32(inFlight, peak, now) {
+							break
+						}
+					}
+					if req.Number == 100 {
+						panic("unlucky")
+					}
+					if req.Number < 0 {
+						return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("negative number"))
+					}
+					if req.Number%2 == 0 {
+						return nil, nil // no response
+					}
+					// Finish later requests first.
+					time.Sleep(time.Duration(messages-req.Number) * time.Millisecond)
+					return &pingv1.CumSumResponse{Sum: req.Number}, nil
+				})
+			},
+			connect.WithRecover(func(context.Context, connect.Spec, http.Header, any) error {
+				return connect.NewError(connect.CodeInternal, errors.New("recovered"))
+			}),
+		))
+		server := httptest.NewUnstartedServer(mux)
+		server.EnableHTTP2 = true
+		server.StartTLS()
+		t.Cleanup(server.Close)
+		return server
+	}
+	run := func(t *testing.T, server *httptest.Server, numbers ...int64) ([]int64, error) {
+		t.Helper()
+		client := connect.NewClient[pingv1.CumSumRequest, pingv1.CumSumResponse](
+			server.Client(),
+			server.URL+cumSumProcedure,
+		)
+		stream := client.CallBidiStream(context.Background())
+		for _, n := range numbers {
+			assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: n}))
+		}
+		assert.Nil(t, stream.CloseRequest())
+		var got []int64
+		for {
+			msg, err := stream.Receive()
+			if errors.Is(err, io.EOF) {
+				return got, stream.CloseResponse()
+			} else if err != nil {
+				return got, err
+			}
+			got = append(got, msg.Sum)
+		}
+	}
+	var numbers, odds []int64
+	for i := int64(0); i < messages; i++ {
+		numbers = append(numbers, i)
+		if i%2 == 1 {
+			odds = append(odds, i)
+		}
+	}
+
+	t.Run("ordered", func(t *testing.T) {
+		t.Parallel()
+		var inFlight int32
+		got, err := run(t, newServer(t, true, &inFlight), numbers...)
+		assert.Nil(t, err)
+		assert.Equal(t, got, odds)
+		assert.True(t, atomic.LoadInt32(&inFlight) <= workers)
+	})
+	t.Run("unordered", func(t *testing.T) {
+		t.Parallel()
+		var inFlight int32
+		got, err := run(t, newServer(t, false, &inFlight), numbers...)
+		assert.Nil(t, err)
+		sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+		assert.Equal(t, got, odds)
+		assert.True(t, atomic.LoadInt32(&inFlight) <= workers)
+	})
+	t.Run("error", func(t *testing.T) {
+		t.Parallel()
+		var inFlight int32
+		_, err := run(t, newServer(t, true, &inFlight), 1, 3, -1, 5)
+		assert.Equal(t, connect.CodeOf(err), connect.CodeInvalidArgument)
+	})
+	t.Run("panic", func(t *testing.T) {
+		t.Parallel()
+		var inFlight int32
+		_, err := run(t, newServer(t, true, &inFlight), 1, 3, 100, 5)
+		assert.Equal(t, connect.CodeOf(err), connect.CodeInternal)
+		assert.True(t, strings.HasSuffix(err.Error(), "recovered"))
+	})
+}
+
+func TestStreamWorkersStopsReceiving(t *testing.T) {
+	t.Parallel()
+	const cumSumProcedure = "/" + pingv1connect.PingServiceName + "/CumSum"
+	afterWorkers := make(chan error, 1)
+	mux := http.NewServeMux()
+	mux.Handle(cumSumProcedure, connect.NewBidiStreamHandler(
+		cumSumProcedure,
+		func(ctx context.Context, stream *connect.BidiStream[pingv1.CumSumRequest, pingv1.CumSumResponse]) error {
+			err := connect.StreamWorkers(ctx, stream, 2, true, func(context.Context, *pingv1.CumSumRequest) (*pingv1.CumSumResponse, error) {
+				return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("no thanks"))
+			})
+			// The client hasn't closed its side of the stream, so this would block
+			// if StreamWorkers had left a Receive pending.
+			_, receiveErr := stream.Receive()
+			afterWorkers <- receiveErr
+			return err
+		},
+	))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	client := connect.NewClient[pingv1.CumSumRequest, pingv1.CumSumResponse](
+		server.Client(),
+		server.URL+cumSumProcedure,
+	)
+	stream := client.CallBidiStream(context.Background())
+	t.Cleanup(func() {
+		_ = stream.CloseRequest()
+		_ = stream.CloseResponse()
+	})
+	assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: 1}))
+	_, err := stream.Receive()
+	assert.Equal(t, connect.CodeOf(err), connect.CodeInvalidArgument)
+	select {
+	case receiveErr := <-afterWorkers:
+		assert.ErrorIs(t, receiveErr, io.EOF)
+	case <-time.After(5 * time.Second):
+		t.Fatal("StreamWorkers returned with a Receive still pending")
+	}
+}
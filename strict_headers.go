@@ -0,0 +1,210 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// framingHeaders control how HTTP messages are delimited and how
+// connections are managed. Metadata must never set them: a proxy that
+// disagrees with the server about where a message ends can be tricked into
+// smuggling a second request inside the first.
+var framingHeaders = map[string]struct{}{ //nolint:gochecknoglobals
+	"Connection":        {},
+	"Content-Length":    {},
+	"Keep-Alive":        {},
+	"Proxy-Connection":  {},
+	"Transfer-Encoding": {},
+	"Upgrade":           {},
+}
+
+// checkStrictHeaders rejects requests with headers that different HTTP
+// implementations may interpret differently, which is how request smuggling
+// and header injection attacks start. net/http's server already rejects many
+// of these, but handlers may sit behind other servers, proxies, or
+// frameworks that are more lenient.
+func checkStrictHeaders(request *http.Request) error {
+	for key, values := range request.Header {
+		if strings.HasPrefix(key, ":") {
+			return fmt.Errorf("pseudo-header %q not allowed in header block", key)
+		}
+		if !validHeaderFieldName(key) {
+			return fmt.Errorf("invalid header name %q", key)
+		}
+		for _, value := range values {
+			if !validHeaderFieldValue(value) {
+				return fmt.Errorf("invalid value for header %q", key)
+			}
+		}
+	}
+	for key := range request.Trailer {
+		if strings.HasPrefix(key, ":") || !validHeaderFieldName(key) {
+			return fmt.Errorf("invalid trailer name %q", key)
+		}
+	}
+	if request.ProtoMajor >= 2 {
+		// HTTP/2 and later forbid connection-specific headers, and the only
+		// allowed value for TE is "trailers".
+		for key := range framingHeaders {
+			if key == "Content-Length" {
+				continue
+			}
+			if _, ok := request.Header[key]; ok {
+				return fmt.Errorf("connection-specific header %q not allowed in HTTP/%d", key, request.ProtoMajor)
+			}
+		}
+		for _, value := range request.Header["Te"] {
+			if !strings.EqualFold(strings.TrimSpace(value), "trailers") {
+				return fmt.Errorf("TE header %q not allowed in HTTP/%d", value, request.ProtoMajor)
+			}
+		}
+	}
+	var transferEncoding []string
+	transferEncoding = append(transferEncoding, request.Header.Values("Transfer-Encoding")...)
+	transferEncoding = append(transferEncoding, request.TransferEncoding...)
+	for _, value := range transferEncoding {
+		if value != "chunked" {
+			return fmt.Errorf("unsupported transfer encoding %q", value)
+		}
+	}
+	lengths := request.Header.Values("Content-Length")
+	for _, value := range lengths {
+		if value == "" || strings.Trim(value, "0123456789") != "" {
+			return fmt.Errorf("invalid Content-Length %q", value)
+		}
+		if value != lengths[0] {
+			return fmt.Errorf("conflicting Content-Length values %q and %q", lengths[0], value)
+		}
+	}
+	if len(lengths) > 0 && len(transferEncoding) > 0 {
+		return errors.New("request has both Content-Length and Transfer-Encoding")
+	}
+	return nil
+}
+
+// sanitizeHeader removes fields that can't be written safely: invalid and
+// pseudo-header names, framing headers, and values with control characters
+// that could inject additional headers. Trailers announced with
+// [http.TrailerPrefix] are checked without the prefix.
+func sanitizeHeader(header http.Header) {
+	for key, values := range header {
+		name := strings.TrimPrefix(key, http.TrailerPrefix)
+		if _, ok := framingHeaders[http.CanonicalHeaderKey(name)]; ok ||
+			strings.HasPrefix(name, ":") ||
+			!validHeaderFieldName(name) {
+			delete(header, key)
+			continue
+		}
+		valid := values[:0:0]
+		for _, value := range values {
+			if validHeaderFieldValue(value) {
+				valid = append(valid, value)
+			}
+		}
+		switch {
+		case len(valid) == len(values):
+		case len(valid) == 0:
+			delete(header, key)
+		default:
+			header[key] = valid
+		}
+	}
+}
+
+// validHeaderFieldName reports whether name is a non-empty RFC 9110 token.
+func validHeaderFieldName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// validHeaderFieldValue reports whether value is free of control characters
+// other than horizontal tab. Bytes above 0x7f are allowed as obs-text.
+func validHeaderFieldValue(value string) bool {
+	for i := 0; i < len(value); i++ {
+		if c := value[i]; (c < ' ' && c != '\t') || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// strictHeaderClient sanitizes outbound request headers and trailers.
+type strictHeaderClient struct {
+	next HTTPClient
+}
+
+func (c *strictHeaderClient) Do(request *http.Request) (*http.Response, error) {
+	sanitizeHeader(request.Header)
+	sanitizeHeader(request.Trailer)
+	return c.next.Do(request)
+}
+
+// strictHeaderWriter sanitizes response headers before they're written.
+// Trailers are set after the body, so handlers must call sanitizeTrailers
+// before returning to net/http.
+type strictHeaderWriter struct {
+	http.ResponseWriter
+
+	wroteHeader bool
+}
+
+func (w *strictHeaderWriter) WriteHeader(statusCode int) {
+	w.sanitizeHeader()
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *strictHeaderWriter) Write(data []byte) (int, error) {
+	w.sanitizeHeader()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *strictHeaderWriter) Flush() {
+	w.sanitizeHeader()
+	flushResponseWriter(w.ResponseWriter)
+}
+
+// Unwrap returns the underlying writer, for use with http.ResponseController.
+func (w *strictHeaderWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *strictHeaderWriter) sanitizeHeader() {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	sanitizeHeader(w.Header())
+}
+
+func (w *strictHeaderWriter) sanitizeTrailers() {
+	// If nothing was written, net/http sends the headers when the handler
+	// returns, so they need sanitizing too. Otherwise, only trailers remain.
+	sanitizeHeader(w.Header())
+}
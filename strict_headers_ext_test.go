@@ -0,0 +1,154 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/bufbuild/connect-go/internal/assert"
+	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
+	"github.com/bufbuild/connect-go/internal/gen/connect/ping/v1/pingv1connect"
+)
+
+func TestStrictHeaders(t *testing.T) {
+	t.Parallel()
+	const procedure = "/" + pingv1connect.PingServiceName + "/Ping"
+	handler := connect.NewUnaryHandler(
+		procedure,
+		func(ctx context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			response := connect.NewResponse(&pingv1.PingResponse{
+				Text: request.Header().Get("X-Echo") + "," + request.Header().Get("X-Injected"),
+			})
+			response.Header().Set("X-Safe", "yes")
+			response.Header().Set("X-Split", "a\r\nSet-Cookie: session=evil")
+			response.Header()["Bad Name"] = []string{"value"}
+			response.Header().Set("Content-Length", "0")
+			response.Trailer().Set("X-Trailer", "b\nX-Injected: 1")
+			return response, nil
+		},
+		connect.WithStrictHeaders(),
+	)
+	t.Run("smuggling", func(t *testing.T) {
+		t.Parallel()
+		vectors := []struct {
+			name  string
+			setup func(*http.Request)
+		}{
+			{"content_length_and_transfer_encoding", func(r *http.Request) {
+				r.Header.Set("Content-Length", "2")
+				r.TransferEncoding = []string{"chunked"}
+			}},
+			{"conflicting_content_lengths", func(r *http.Request) {
+				r.Header["Content-Length"] = []string{"2", "3"}
+			}},
+			{"content_length_list", func(r *http.Request) {
+				r.Header.Set("Content-Length", "2, 2")
+			}},
+			{"signed_content_length", func(r *http.Request) {
+				r.Header.Set("Content-Length", "+2")
+			}},
+			{"obfuscated_transfer_encoding", func(r *http.Request) {
+				r.Header.Set("Transfer-Encoding", " chunked")
+			}},
+			{"stacked_transfer_encoding", func(r *http.Request) {
+				r.TransferEncoding = []string{"chunked", "identity"}
+			}},
+			{"crlf_in_value", func(r *http.Request) {
+				r.Header.Set("X-Echo", "a\r\nX-Injected: 1")
+			}},
+			{"nul_in_value", func(r *http.Request) {
+				r.Header.Set("X-Echo", "a\x00b")
+			}},
+			{"invalid_name", func(r *http.Request) {
+				r.Header["X-Echo "] = []string{"a"}
+			}},
+			{"pseudo_header", func(r *http.Request) {
+				r.Header[":authority"] = []string{"example.com"}
+			}},
+			{"http2_connection_header", func(r *http.Request) {
+				r.ProtoMajor = 2
+				r.Header.Set("Connection", "keep-alive")
+			}},
+			{"http2_te", func(r *http.Request) {
+				r.ProtoMajor = 2
+				r.Header.Set("Te", "gzip")
+			}},
+		}
+		for _, vector := range vectors {
+			vector := vector
+			t.Run(vector.name, func(t *testing.T) {
+				t.Parallel()
+				request := httptest.NewRequest(http.MethodPost, procedure, strings.NewReader("{}"))
+				request.Header.Set("Content-Type", "application/json")
+				vector.setup(request)
+				recorder := httptest.NewRecorder()
+				handler.ServeHTTP(recorder, request)
+				assert.Equal(t, recorder.Code, http.StatusBadRequest)
+			})
+		}
+	})
+	t.Run("sanitize", func(t *testing.T) {
+		t.Parallel()
+		mux := http.NewServeMux()
+		mux.Handle(procedure, handler)
+		server := httptest.NewServer(mux)
+		t.Cleanup(server.Close)
+		client := connect.NewClient[pingv1.PingRequest, pingv1.PingResponse](
+			server.Client(),
+			server.URL+procedure,
+			connect.WithStrictHeaders(),
+		)
+		request := connect.NewRequest(&pingv1.PingRequest{})
+		request.Header().Set("X-Echo", "ok")
+		request.Header().Add("X-Echo", "a\r\nX-Injected: 1")
+		request.Header().Set("Transfer-Encoding", "chunked")
+		response, err := client.CallUnary(context.Background(), request)
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.Text, "ok,")
+		assert.Equal(t, response.Header().Get("X-Safe"), "yes")
+		assert.Equal(t, response.Header().Values("X-Split"), nil)
+		assert.Equal(t, response.Header().Values("Set-Cookie"), nil)
+		assert.Equal(t, response.Trailer().Values("X-Trailer"), nil)
+		assert.Equal(t, response.Trailer().Values("X-Injected"), nil)
+
+		// Without the option, net/http refuses to send the header.
+		lenient := connect.NewClient[pingv1.PingRequest, pingv1.PingResponse](
+			server.Client(),
+			server.URL+procedure,
+		)
+		request = connect.NewRequest(&pingv1.PingRequest{})
+		request.Header().Set("X-Echo", "a\r\nX-Injected: 1")
+		_, err = lenient.CallUnary(context.Background(), request)
+		assert.NotNil(t, err)
+	})
+	t.Run("valid", func(t *testing.T) {
+		t.Parallel()
+		request := httptest.NewRequest(http.MethodPost, procedure, strings.NewReader("{}"))
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set("Content-Length", "2")
+		request.Header.Set("X-Echo", "tab\tand utf-8 é")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		assert.Equal(t, recorder.Code, http.StatusOK)
+		assert.Equal(t, recorder.Header().Get("X-Safe"), "yes")
+		assert.Equal(t, recorder.Header().Values("Content-Length"), nil)
+		assert.Equal(t, recorder.Header().Values("Trailer-X-Trailer"), nil)
+	})
+}
@@ -0,0 +1,431 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	headerTraceParent = "Traceparent"
+	headerTraceState  = "Tracestate"
+
+	traceParentVersion = "00"
+	traceParentLength  = 55 // version-traceid-spanid-flags
+	traceFlagSampled   = 0x01
+)
+
+var traceContextValue = NewContextValue[TraceContext]("trace context") //nolint:gochecknoglobals
+
+// A TraceContext identifies a span within a distributed trace. It's
+// propagated between clients and handlers in the traceparent and tracestate
+// headers defined by the W3C Trace Context specification, which
+// OpenTelemetry and most tracing systems understand.
+type TraceContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+	// TraceState is vendor-specific data, propagated as-is.
+	TraceState string
+}
+
+// ContextWithTraceContext returns a new context carrying the trace context.
+// Clients configured with [WithTelemetry] use it as the parent of their
+// calls' spans.
+func ContextWithTraceContext(ctx context.Context, trace TraceContext) context.Context {
+	return traceContextValue.With(ctx, trace)
+}
+
+// TraceContextFromContext returns the trace context carried by ctx. In
+// handlers configured with [WithTelemetry], it's the handler's own span, so
+// calls made while handling a request join the same trace.
+func TraceContextFromContext(ctx context.Context) (TraceContext, bool) {
+	trace, ok := traceContextValue.From(ctx)
+	return trace, ok && trace.IsValid()
+}
+
+// IsValid reports whether both the trace and span IDs are non-zero.
+func (t TraceContext) IsValid() bool {
+	return t.TraceID != [16]byte{} && t.SpanID != [8]byte{}
+}
+
+// TraceParent formats the trace context as a W3C traceparent header value.
+func (t TraceContext) TraceParent() string {
+	flags := "00"
+	if t.Sampled {
+		flags = "01"
+	}
+	return traceParentVersion + "-" + hex.EncodeToString(t.TraceID[:]) +
+		"-" + hex.EncodeToString(t.SpanID[:]) + "-" + flags
+}
+
+// ParseTraceParent parses a W3C traceparent header value. It accepts values
+// from future versions of the specification, as long as they begin with the
+// fields of the current version.
+func ParseTraceParent(value string) (TraceContext, error) {
+	var trace TraceContext
+	if len(value) < traceParentLength || (len(value) > traceParentLength && value[traceParentLength] != '-') {
+		return trace, errors.New("traceparent has the wrong length")
+	}
+	version, traceID, spanID, flags := value[0:2], value[3:35], value[36:52], value[53:55]
+	if value[2] != '-' || value[35] != '-' || value[52] != '-' {
+		return trace, errors.New("traceparent fields aren't separated by dashes")
+	}
+	if version == "ff" || (version == traceParentVersion && len(value) != traceParentLength) {
+		return trace, errors.New("invalid traceparent version")
+	}
+	var versionBits, flagBits [1]byte
+	for _, field := range []struct {
+		dst []byte
+		src string
+	}{
+		{versionBits[:], version},
+		{trace.TraceID[:], traceID},
+		{trace.SpanID[:], spanID},
+		{flagBits[:], flags},
+	} {
+		_, err := hex.Decode(field.dst, []byte(field.src))
+		if err != nil || strings.ToLower(field.src) != field.src {
+			return TraceContext{}, errors.New("traceparent fields must be lowercase hex")
+		}
+	}
+	trace.Sampled = flagBits[0]&traceFlagSampled != 0
+	if !trace.IsValid() {
+		return TraceContext{}, errors.New("traceparent has an all-zero trace or span ID")
+	}
+	return trace, nil
+}
+
+// A Span describes a completed client or handler call, with the information
+// OpenTelemetry's RPC conventions expect of spans and metrics.
+type Span struct {
+	Spec Spec
+	Peer Peer
+	// Trace identifies the call's own span. Parent identifies the span that
+	// caused the call, and is zero if the call started a new trace.
+	Trace  TraceContext
+	Parent TraceContext
+	Start  time.Time
+	End    time.Time
+	// Err is the call's error, or nil if it succeeded.
+	Err error
+	// The number of messages sent and received, and their total size in the
+	// Protobuf binary encoding. Messages that aren't Protobuf messages count
+	// as zero bytes.
+	RequestMessages  int64
+	ResponseMessages int64
+	RequestBytes     int64
+	ResponseBytes    int64
+}
+
+// Name returns the span name OpenTelemetry uses for RPCs: the procedure
+// without its leading slash (for example, "acme.foo.v1.FooService/Bar").
+func (s *Span) Name() string {
+	return strings.TrimPrefix(s.Spec.Procedure, "/")
+}
+
+// Duration returns how long the call took.
+func (s *Span) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// Attributes returns the span's attributes, named as in OpenTelemetry's RPC
+// semantic conventions.
+func (s *Span) Attributes() map[string]string {
+	attributes := make(map[string]string, 4)
+	if service, method, ok := strings.Cut(s.Name(), "/"); ok {
+		attributes["rpc.service"] = service
+		attributes["rpc.method"] = method
+	}
+	if s.Peer.Addr != "" {
+		if s.Spec.IsClient {
+			attributes["server.address"] = s.Peer.Addr
+		} else {
+			attributes["client.address"] = s.Peer.Addr
+		}
+	}
+	if s.Err != nil {
+		attributes["rpc.connect_rpc.error_code"] = CodeOf(wrapIfContextError(s.Err)).String()
+	}
+	return attributes
+}
+
+// WithTelemetry traces every call and reports it to export when it completes.
+// Clients continue the trace in the calling context (see
+// [ContextWithTraceContext]) or start a new one, and send it to the server in
+// W3C traceparent and tracestate headers. Handlers continue the trace in the
+// request headers, and they put their own span in the context passed to
+// interceptors and implementations, so outbound calls join the same trace.
+//
+// The export function runs synchronously, so it should hand spans off to a
+// background exporter rather than doing network I/O. Spans are exported
+// whether or not they're sampled, so that metrics (see [RPCMetrics]) count
+// every call; exporters that forward spans to a tracing backend should drop
+// spans whose Trace isn't Sampled. New traces are always sampled.
+//
+// Telemetry is an interceptor, applied in the same order as those added with
+// [WithInterceptors]: use it as the first option to include time spent in
+// other interceptors. Each call is exported once, when its outcome is known:
+// for handlers, when the implementation returns, and for clients, when the
+// response ends or is closed.
+//
+// By default, calls aren't traced.
+func WithTelemetry(export func(context.Context, *Span)) Option {
+	return WithInterceptors(&telemetryInterceptor{export: export})
+}
+
+type telemetryInterceptor struct {
+	export func(context.Context, *Span)
+}
+
+func (t *telemetryInterceptor) WrapUnary(next UnaryFunc) UnaryFunc {
+	return func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
+		ctx, span := startSpan(ctx, request.Spec(), request.Header())
+		span.RequestMessages = 1
+		span.RequestBytes = protoSize(request.Any())
+		response, err := next(ctx, request)
+		if err == nil && response != nil {
+			span.ResponseMessages = 1
+			span.ResponseBytes = protoSize(response.Any())
+		}
+		span.Peer = request.Peer()
+		t.finish(ctx, span, err)
+		return response, err
+	}
+}
+
+func (t *telemetryInterceptor) WrapStreamingClient(next StreamingClientFunc) StreamingClientFunc {
+	return func(ctx context.Context, spec Spec) StreamingClientConn {
+		header := make(http.Header, 2)
+		ctx, span := startSpan(ctx, spec, header)
+		conn := next(ctx, spec)
+		mergeHeadersWithPolicy(conn.RequestHeader(), header, HeaderMergeOverwrite)
+		return &telemetryClientConn{
+			StreamingClientConn: conn,
+			ctx:                 ctx,
+			telemetry:           t,
+			span:                span,
+		}
+	}
+}
+
+func (t *telemetryInterceptor) WrapStreamingHandler(next StreamingHandlerFunc) StreamingHandlerFunc {
+	return func(ctx context.Context, conn StreamingHandlerConn) error {
+		ctx, span := startSpan(ctx, conn.Spec(), conn.RequestHeader())
+		wrapped := &telemetryHandlerConn{StreamingHandlerConn: conn, span: span}
+		err := next(ctx, wrapped)
+		span.Peer = conn.Peer()
+		t.finish(ctx, span, err)
+		return err
+	}
+}
+
+// finish exports a copy of the span, since streams may still be updating its
+// counts.
+func (t *telemetryInterceptor) finish(ctx context.Context, span *Span, err error) {
+	t.export(ctx, &Span{
+		Spec:             span.Spec,
+		Peer:             span.Peer,
+		Trace:            span.Trace,
+		Parent:           span.Parent,
+		Start:            span.Start,
+		End:              time.Now(),
+		Err:              err,
+		RequestMessages:  atomic.LoadInt64(&span.RequestMessages),
+		ResponseMessages: atomic.LoadInt64(&span.ResponseMessages),
+		RequestBytes:     atomic.LoadInt64(&span.RequestBytes),
+		ResponseBytes:    atomic.LoadInt64(&span.ResponseBytes),
+	})
+}
+
+// startSpan starts a span for the call. Clients take the parent from the
+// context and write the new span to the request headers, and handlers take
+// the parent from the request headers (or, failing that, the context). The
+// returned context carries the new span.
+func startSpan(ctx context.Context, spec Spec, header http.Header) (context.Context, *Span) {
+	span := &Span{Spec: spec, Start: time.Now()}
+	parent, ok := TraceContextFromContext(ctx)
+	if !spec.IsClient {
+		if remote, err := ParseTraceParent(header.Get(headerTraceParent)); err == nil {
+			remote.TraceState = header.Get(headerTraceState)
+			parent, ok = remote, true
+		}
+	}
+	if ok {
+		span.Parent = parent
+		span.Trace = TraceContext{
+			TraceID:    parent.TraceID,
+			Sampled:    parent.Sampled,
+			TraceState: parent.TraceState,
+		}
+	} else {
+		span.Trace.Sampled = true
+		_, _ = rand.Read(span.Trace.TraceID[:])
+	}
+	_, _ = rand.Read(span.Trace.SpanID[:])
+	if spec.IsClient {
+		header[headerTraceParent] = []string{span.Trace.TraceParent()}
+		if span.Trace.TraceState != "" {
+			header[headerTraceState] = []string{span.Trace.TraceState}
+		} else {
+			delete(header, headerTraceState)
+		}
+	}
+	return ContextWithTraceContext(ctx, span.Trace), span
+}
+
+func protoSize(msg any) int64 {
+	if message, ok := msg.(proto.Message); ok {
+		return int64(proto.Size(message))
+	}
+	return 0
+}
+
+// telemetryClientConn counts messages and exports the span when the response
+// ends, or when it's closed early. Send and Receive may be called
+// concurrently, so the counts are updated atomically.
+type telemetryClientConn struct {
+	StreamingClientConn
+
+	ctx       context.Context //nolint:containedctx
+	telemetry *telemetryInterceptor
+	span      *Span
+	once      sync.Once
+}
+
+func (cc *telemetryClientConn) Send(msg any) error {
+	return cc.sent(msg, cc.StreamingClientConn.Send(msg))
+}
+
+func (cc *telemetryClientConn) Receive(msg any) error {
+	return cc.received(msg, cc.StreamingClientConn.Receive(msg))
+}
+
+func (cc *telemetryClientConn) SendWithMetadata(msg any, metadata http.Header) error {
+	return cc.sent(msg, SendWithMetadata(cc.StreamingClientConn, msg, metadata))
+}
+
+func (cc *telemetryClientConn) ReceiveWithMetadata(msg any) (http.Header, error) {
+	metadata, err := ReceiveWithMetadata(cc.StreamingClientConn, msg)
+	return metadata, cc.received(msg, err)
+}
+
+func (cc *telemetryClientConn) SendWithEnvelopeFlags(msg any, flags []string) error {
+	return cc.sent(msg, SendWithEnvelopeFlags(cc.StreamingClientConn, msg, flags...))
+}
+
+func (cc *telemetryClientConn) ReceiveWithEnvelopeFlags(msg any) ([]string, error) {
+	flags, err := ReceiveWithEnvelopeFlags(cc.StreamingClientConn, msg)
+	return flags, cc.received(msg, err)
+}
+
+func (cc *telemetryClientConn) CloseResponse() error {
+	err := cc.StreamingClientConn.CloseResponse()
+	cc.finish(nil)
+	return err
+}
+
+func (cc *telemetryClientConn) sent(msg any, err error) error {
+	if err == nil {
+		atomic.AddInt64(&cc.span.RequestMessages, 1)
+		atomic.AddInt64(&cc.span.RequestBytes, protoSize(msg))
+	}
+	return err
+}
+
+func (cc *telemetryClientConn) received(msg any, err error) error {
+	switch {
+	case err == nil:
+		atomic.AddInt64(&cc.span.ResponseMessages, 1)
+		atomic.AddInt64(&cc.span.ResponseBytes, protoSize(msg))
+	case errors.Is(err, io.EOF):
+		cc.finish(nil)
+	default:
+		cc.finish(err)
+	}
+	return err
+}
+
+func (cc *telemetryClientConn) finish(err error) {
+	cc.once.Do(func() {
+		cc.span.Peer = cc.StreamingClientConn.Peer()
+		cc.telemetry.finish(cc.ctx, cc.span, err)
+	})
+}
+
+// telemetryHandlerConn counts messages. The span is exported by
+// WrapStreamingHandler once the implementation returns.
+type telemetryHandlerConn struct {
+	StreamingHandlerConn
+
+	span *Span
+}
+
+func (hc *telemetryHandlerConn) Send(msg any) error {
+	return hc.sent(msg, hc.StreamingHandlerConn.Send(msg))
+}
+
+func (hc *telemetryHandlerConn) Receive(msg any) error {
+	return hc.received(msg, hc.StreamingHandlerConn.Receive(msg))
+}
+
+func (hc *telemetryHandlerConn) SendWithMetadata(msg any, metadata http.Header) error {
+	return hc.sent(msg, SendWithMetadata(hc.StreamingHandlerConn, msg, metadata))
+}
+
+func (hc *telemetryHandlerConn) ReceiveWithMetadata(msg any) (http.Header, error) {
+	metadata, err := ReceiveWithMetadata(hc.StreamingHandlerConn, msg)
+	return metadata, hc.received(msg, err)
+}
+
+func (hc *telemetryHandlerConn) SendWithEnvelopeFlags(msg any, flags []string) error {
+	return hc.sent(msg, SendWithEnvelopeFlags(hc.StreamingHandlerConn, msg, flags...))
+}
+
+func (hc *telemetryHandlerConn) ReceiveWithEnvelopeFlags(msg any) ([]string, error) {
+	flags, err := ReceiveWithEnvelopeFlags(hc.StreamingHandlerConn, msg)
+	return flags, hc.received(msg, err)
+}
+
+func (hc *telemetryHandlerConn) CloseReceive() error {
+	return closeReceive(hc.StreamingHandlerConn)
+}
+
+func (hc *telemetryHandlerConn) sent(msg any, err error) error {
+	if err == nil {
+		atomic.AddInt64(&hc.span.ResponseMessages, 1)
+		atomic.AddInt64(&hc.span.ResponseBytes, protoSize(msg))
+	}
+	return err
+}
+
+func (hc *telemetryHandlerConn) received(msg any, err error) error {
+	if err == nil {
+		atomic.AddInt64(&hc.span.RequestMessages, 1)
+		atomic.AddInt64(&hc.span.RequestBytes, protoSize(msg))
+	}
+	return err
+}
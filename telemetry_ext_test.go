@@ -0,0 +1,173 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/bufbuild/connect-go/internal/assert"
+	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
+	"github.com/bufbuild/connect-go/internal/gen/connect/ping/v1/pingv1connect"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestTelemetry(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	var spans []*connect.Span
+	metrics := connect.NewRPCMetrics()
+	export := func(ctx context.Context, span *connect.Span) {
+		mu.Lock()
+		spans = append(spans, span)
+		mu.Unlock()
+		metrics.Record(ctx, span)
+	}
+	takeSpans := func() (handler, client *connect.Span) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, len(spans), 2)
+		handler, client = spans[0], spans[1]
+		spans = nil
+		assert.False(t, handler.Spec.IsClient)
+		assert.True(t, client.Spec.IsClient)
+		return handler, client
+	}
+	var handlerTrace connect.TraceContext
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		pingServer{},
+		connect.WithTelemetry(export),
+		connect.WithInterceptors(connect.UnaryInterceptorFunc(func(next connect.UnaryFunc) connect.UnaryFunc {
+			return func(ctx context.Context, request connect.AnyRequest) (connect.AnyResponse, error) {
+				handlerTrace, _ = connect.TraceContextFromContext(ctx)
+				return next(ctx, request)
+			}
+		})),
+	))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithTelemetry(export))
+
+	t.Run("unary", func(t *testing.T) {
+		parent, err := connect.ParseTraceParent("00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+		assert.Nil(t, err)
+		parent.TraceState = "vendor=value"
+		ctx := connect.ContextWithTraceContext(context.Background(), parent)
+		request := &pingv1.PingRequest{Number: 42, Text: "telemetry"}
+		_, err = client.Ping(ctx, connect.NewRequest(request))
+		assert.Nil(t, err)
+		handler, client := takeSpans()
+		assert.Equal(t, client.Parent, parent)
+		assert.Equal(t, client.Trace.TraceID, parent.TraceID)
+		assert.Equal(t, client.Trace.TraceState, "vendor=value")
+		assert.NotEqual(t, client.Trace.SpanID, parent.SpanID)
+		assert.Equal(t, handler.Parent, client.Trace)
+		assert.Equal(t, handler.Trace.TraceID, parent.TraceID)
+		assert.Equal(t, handlerTrace, handler.Trace)
+		assert.Equal(t, client.Name(), "connect.ping.v1.PingService/Ping")
+		assert.Equal(t, client.RequestBytes, int64(proto.Size(request)))
+		assert.Equal(t, handler.RequestBytes, client.RequestBytes)
+		assert.Equal(t, client.ResponseMessages, int64(1))
+		assert.True(t, handler.Duration() > 0)
+		assert.Equal(t, client.Attributes()["rpc.method"], "Ping")
+		assert.NotZero(t, client.Attributes()["server.address"])
+		assert.NotZero(t, handler.Attributes()["client.address"])
+	})
+	t.Run("new_trace", func(t *testing.T) {
+		_, err := client.Fail(context.Background(), connect.NewRequest(&pingv1.FailRequest{Code: int32(connect.CodeAborted)}))
+		assert.NotNil(t, err)
+		handler, client := takeSpans()
+		assert.Equal(t, client.Parent, connect.TraceContext{})
+		assert.True(t, client.Trace.IsValid())
+		assert.True(t, client.Trace.Sampled)
+		assert.Equal(t, handler.Parent, client.Trace)
+		assert.Equal(t, client.Attributes()["rpc.connect_rpc.error_code"], "aborted")
+		assert.Equal(t, handler.Attributes()["rpc.connect_rpc.error_code"], "aborted")
+	})
+	t.Run("bidi", func(t *testing.T) {
+		stream := client.CumSum(context.Background())
+		for i := 1; i <= 3; i++ {
+			assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: int64(i)}))
+			_, err := stream.Receive()
+			assert.Nil(t, err)
+		}
+		assert.Nil(t, stream.CloseRequest())
+		_, err := stream.Receive()
+		assert.NotNil(t, err)
+		assert.Nil(t, stream.CloseResponse())
+		handler, client := takeSpans()
+		assert.Equal(t, handler.Parent, client.Trace)
+		assert.Nil(t, client.Err)
+		assert.Equal(t, client.RequestMessages, int64(3))
+		assert.Equal(t, client.ResponseMessages, int64(3))
+		assert.Equal(t, handler.RequestMessages, int64(3))
+		assert.Equal(t, handler.ResponseMessages, int64(3))
+		assert.Equal(t, handler.ResponseBytes, client.ResponseBytes)
+	})
+	t.Run("metrics", func(t *testing.T) {
+		snapshot := metrics.Snapshot()
+		assert.Equal(t, len(snapshot), 6)
+		var calls uint64
+		for _, metric := range snapshot {
+			calls += metric.Calls
+			var bucketed uint64
+			for _, count := range metric.DurationBuckets {
+				bucketed += count
+			}
+			assert.Equal(t, bucketed, metric.Calls)
+			assert.Equal(t, len(metric.DurationBuckets), len(metric.DurationBounds)+1)
+		}
+		assert.Equal(t, calls, uint64(6))
+		fail := snapshot[2]
+		assert.Equal(t, fail.Procedure, "/connect.ping.v1.PingService/Fail")
+		assert.False(t, fail.IsClient)
+		assert.Equal(t, fail.Code, "aborted")
+	})
+}
+
+func TestParseTraceParent(t *testing.T) {
+	t.Parallel()
+	const valid = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	trace, err := connect.ParseTraceParent(valid)
+	assert.Nil(t, err)
+	assert.True(t, trace.Sampled)
+	assert.Equal(t, trace.TraceParent(), valid)
+	trace, err = connect.ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	assert.Nil(t, err)
+	assert.False(t, trace.Sampled)
+	// Future versions may append fields.
+	_, err = connect.ParseTraceParent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra")
+	assert.Nil(t, err)
+	for _, invalid := range []string{
+		"",
+		valid + "-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00_4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01",
+	} {
+		_, err := connect.ParseTraceParent(invalid)
+		assert.NotNil(t, err, assert.Sprintf("%q", invalid))
+	}
+}
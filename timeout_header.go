@@ -0,0 +1,109 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// A TimeoutHeaderPrecedence decides which timeout a Connect handler honors
+// when a request carries both the standard Connect-Timeout-Ms header and the
+// additional header configured with [WithTimeoutHeader].
+type TimeoutHeaderPrecedence uint8
+
+const (
+	// TimeoutHeaderFallback honors the additional header only when the request
+	// doesn't have a Connect-Timeout-Ms header. This is the default.
+	TimeoutHeaderFallback TimeoutHeaderPrecedence = iota
+	// TimeoutHeaderOverride honors the additional header whenever it's
+	// present, ignoring Connect-Timeout-Ms.
+	TimeoutHeaderOverride
+	// TimeoutHeaderShortest honors whichever of the two timeouts is shorter.
+	TimeoutHeaderShortest
+)
+
+// TimeoutHeader describes an additional request header that carries the
+// call's timeout, for clients that encode deadlines differently from the
+// Connect protocol. It's typically used while migrating from in-house RPC
+// frameworks: for example, to honor a legacy X-Timeout-Ms header,
+//
+//	connect.WithTimeoutHeader(connect.TimeoutHeader{Name: "X-Timeout-Ms"})
+//
+// The header's value must be a non-negative integer of at most 10 digits,
+// like Connect-Timeout-Ms.
+type TimeoutHeader struct {
+	// Name is the header's name.
+	Name string
+	// Unit is the duration of one unit of the header's value. If zero, the
+	// value is in milliseconds.
+	Unit time.Duration
+	// Precedence decides between the header and Connect-Timeout-Ms when a
+	// request has both.
+	Precedence TimeoutHeaderPrecedence
+}
+
+// resolve combines the timeout from the additional header, if any, with the
+// standard timeout (valid only if ok). Invalid values of the additional header
+// are errors.
+func (h *TimeoutHeader) resolve(header http.Header, standard time.Duration, ok bool) (time.Duration, bool, error) {
+	value := header.Get(h.Name)
+	if value == "" {
+		return standard, ok, nil
+	}
+	unit := h.Unit
+	if unit <= 0 {
+		unit = time.Millisecond
+	}
+	custom, err := parseTimeoutValue(value, unit)
+	if err != nil {
+		return 0, false, errorf(CodeInvalidArgument, "parse %s: %w", h.Name, err)
+	}
+	if !ok {
+		return custom, true, nil
+	}
+	switch h.Precedence {
+	case TimeoutHeaderOverride:
+		return custom, true, nil
+	case TimeoutHeaderShortest:
+		if custom < standard {
+			return custom, true, nil
+		}
+		return standard, true, nil
+	default:
+		return standard, true, nil
+	}
+}
+
+// parseTimeoutValue parses a timeout header's value, counted in units.
+func parseTimeoutValue(value string, unit time.Duration) (time.Duration, error) {
+	if len(value) > 10 {
+		return 0, fmt.Errorf("%q has >10 digits", value)
+	}
+	count, err := strconv.ParseInt(value, 10 /* base */, 64 /* bitsize */)
+	if err != nil {
+		return 0, err
+	}
+	if count < 0 {
+		return 0, fmt.Errorf("%q is negative", value)
+	}
+	if count > int64(math.MaxInt64/unit) {
+		return time.Duration(math.MaxInt64), nil
+	}
+	return time.Duration(count) * unit, nil
+}
@@ -0,0 +1,176 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// headerUnknownFields reports the number of unknown fields the handler
+// found in the request messages it received before sending response headers.
+const headerUnknownFields = "Connect-Unknown-Fields"
+
+// unknownFieldsInterceptor counts the unknown fields in handlers' request
+// messages, which usually means that the client is using a newer schema.
+type unknownFieldsInterceptor struct {
+	report    func(context.Context, Spec, int)
+	setHeader bool
+}
+
+func (i *unknownFieldsInterceptor) WrapUnary(next UnaryFunc) UnaryFunc {
+	return func(ctx context.Context, req AnyRequest) (AnyResponse, error) {
+		if req.Spec().IsClient {
+			return next(ctx, req)
+		}
+		count := countUnknownFields(req.Any())
+		if count > 0 && i.report != nil {
+			i.report(ctx, req.Spec(), count)
+		}
+		res, err := next(ctx, req)
+		if count > 0 && i.setHeader {
+			if err != nil {
+				if connectErr, ok := asError(err); ok {
+					connectErr.Meta().Set(headerUnknownFields, strconv.Itoa(count))
+				}
+			} else if res != nil {
+				res.Header().Set(headerUnknownFields, strconv.Itoa(count))
+			}
+		}
+		return res, err
+	}
+}
+
+func (i *unknownFieldsInterceptor) WrapStreamingClient(next StreamingClientFunc) StreamingClientFunc {
+	return next
+}
+
+func (i *unknownFieldsInterceptor) WrapStreamingHandler(next StreamingHandlerFunc) StreamingHandlerFunc {
+	return func(ctx context.Context, conn StreamingHandlerConn) error {
+		return next(ctx, &unknownFieldsHandlerConn{
+			StreamingHandlerConn: conn,
+			ctx:                  ctx,
+			interceptor:          i,
+		})
+	}
+}
+
+type unknownFieldsHandlerConn struct {
+	StreamingHandlerConn
+
+	ctx         context.Context
+	interceptor *unknownFieldsInterceptor
+	total       int
+}
+
+func (hc *unknownFieldsHandlerConn) Receive(msg any) error {
+	return hc.received(msg, hc.StreamingHandlerConn.Receive(msg))
+}
+
+func (hc *unknownFieldsHandlerConn) SendWithMetadata(msg any, metadata http.Header) error {
+	return SendWithMetadata(hc.StreamingHandlerConn, msg, metadata)
+}
+
+func (hc *unknownFieldsHandlerConn) ReceiveWithMetadata(msg any) (http.Header, error) {
+	metadata, err := ReceiveWithMetadata(hc.StreamingHandlerConn, msg)
+	return metadata, hc.received(msg, err)
+}
+
+func (hc *unknownFieldsHandlerConn) SendWithEnvelopeFlags(msg any, flags []string) error {
+	return SendWithEnvelopeFlags(hc.StreamingHandlerConn, msg, flags...)
+}
+
+func (hc *unknownFieldsHandlerConn) ReceiveWithEnvelopeFlags(msg any) ([]string, error) {
+	flags, err := ReceiveWithEnvelopeFlags(hc.StreamingHandlerConn, msg)
+	return flags, hc.received(msg, err)
+}
+
+func (hc *unknownFieldsHandlerConn) CloseReceive() error {
+	return closeReceive(hc.StreamingHandlerConn)
+}
+
+// received counts the unknown fields in a message returned by the wrapped
+// conn.
+func (hc *unknownFieldsHandlerConn) received(msg any, err error) error {
+	if err != nil {
+		return err
+	}
+	count := countUnknownFields(msg)
+	if count == 0 {
+		return nil
+	}
+	if hc.interceptor.report != nil {
+		hc.interceptor.report(hc.ctx, hc.Spec(), count)
+	}
+	hc.total += count
+	if hc.interceptor.setHeader {
+		// Only effective until the first call to Send.
+		hc.ResponseHeader().Set(headerUnknownFields, strconv.Itoa(hc.total))
+	}
+	return nil
+}
+
+// countUnknownFields counts the unknown fields in a Protobuf message,
+// including any nested messages. It returns zero for other types.
+func countUnknownFields(msg any) int {
+	protoMessage, ok := msg.(proto.Message)
+	if !ok {
+		return 0
+	}
+	return countUnknownFieldsReflect(protoMessage.ProtoReflect())
+}
+
+func countUnknownFieldsReflect(msg protoreflect.Message) int {
+	count := 0
+	unknown := msg.GetUnknown()
+	for len(unknown) > 0 {
+		_, _, n := protowire.ConsumeField(unknown)
+		if n < 0 {
+			count++ // malformed, but still unknown
+			break
+		}
+		unknown = unknown[n:]
+		count++
+	}
+	msg.Range(func(field protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		switch {
+		case field.IsMap():
+			if field.MapValue().Message() == nil {
+				return true
+			}
+			value.Map().Range(func(_ protoreflect.MapKey, v protoreflect.Value) bool {
+				count += countUnknownFieldsReflect(v.Message())
+				return true
+			})
+		case field.IsList():
+			if field.Message() == nil {
+				return true
+			}
+			list := value.List()
+			for i := 0; i < list.Len(); i++ {
+				count += countUnknownFieldsReflect(list.Get(i).Message())
+			}
+		case field.Message() != nil:
+			count += countUnknownFieldsReflect(value.Message())
+		}
+		return true
+	})
+	return count
+}
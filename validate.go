@@ -0,0 +1,139 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"net/http"
+)
+
+// validator is implemented by messages with generated validation logic, like
+// those produced by protoc-gen-validate.
+type validator interface {
+	Validate() error
+}
+
+// validateResponse returns an error with CodeInternal if the message
+// implements validator and is invalid. Invalid responses are contract
+// violations on the server, so we don't blame the client.
+func validateResponse(msg any) error {
+	if v, ok := msg.(validator); ok {
+		if err := v.Validate(); err != nil {
+			return errorf(CodeInternal, "invalid response %T: %w", msg, err)
+		}
+	}
+	return nil
+}
+
+// responseValidationInterceptor validates handlers' outbound responses and
+// clients' inbound responses.
+type responseValidationInterceptor struct{}
+
+func (i *responseValidationInterceptor) WrapUnary(next UnaryFunc) UnaryFunc {
+	return func(ctx context.Context, req AnyRequest) (AnyResponse, error) {
+		res, err := next(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		if err := validateResponse(res.Any()); err != nil {
+			return nil, err
+		}
+		return res, nil
+	}
+}
+
+func (i *responseValidationInterceptor) WrapStreamingClient(next StreamingClientFunc) StreamingClientFunc {
+	return func(ctx context.Context, spec Spec) StreamingClientConn {
+		return &responseValidatingClientConn{StreamingClientConn: next(ctx, spec)}
+	}
+}
+
+func (i *responseValidationInterceptor) WrapStreamingHandler(next StreamingHandlerFunc) StreamingHandlerFunc {
+	return func(ctx context.Context, conn StreamingHandlerConn) error {
+		return next(ctx, &responseValidatingHandlerConn{StreamingHandlerConn: conn})
+	}
+}
+
+type responseValidatingClientConn struct {
+	StreamingClientConn
+}
+
+func (cc *responseValidatingClientConn) Receive(msg any) error {
+	if err := cc.StreamingClientConn.Receive(msg); err != nil {
+		return err
+	}
+	return validateResponse(msg)
+}
+
+func (cc *responseValidatingClientConn) SendWithMetadata(msg any, metadata http.Header) error {
+	return SendWithMetadata(cc.StreamingClientConn, msg, metadata)
+}
+
+func (cc *responseValidatingClientConn) ReceiveWithMetadata(msg any) (http.Header, error) {
+	metadata, err := ReceiveWithMetadata(cc.StreamingClientConn, msg)
+	if err != nil {
+		return metadata, err
+	}
+	return metadata, validateResponse(msg)
+}
+
+func (cc *responseValidatingClientConn) SendWithEnvelopeFlags(msg any, flags []string) error {
+	return SendWithEnvelopeFlags(cc.StreamingClientConn, msg, flags...)
+}
+
+func (cc *responseValidatingClientConn) ReceiveWithEnvelopeFlags(msg any) ([]string, error) {
+	flags, err := ReceiveWithEnvelopeFlags(cc.StreamingClientConn, msg)
+	if err != nil {
+		return flags, err
+	}
+	return flags, validateResponse(msg)
+}
+
+type responseValidatingHandlerConn struct {
+	StreamingHandlerConn
+}
+
+func (hc *responseValidatingHandlerConn) Send(msg any) error {
+	if err := validateResponse(msg); err != nil {
+		return err
+	}
+	return hc.StreamingHandlerConn.Send(msg)
+}
+
+func (hc *responseValidatingHandlerConn) SendWithMetadata(msg any, metadata http.Header) error {
+	if err := validateResponse(msg); err != nil {
+		return err
+	}
+	return SendWithMetadata(hc.StreamingHandlerConn, msg, metadata)
+}
+
+func (hc *responseValidatingHandlerConn) ReceiveWithMetadata(msg any) (http.Header, error) {
+	return ReceiveWithMetadata(hc.StreamingHandlerConn, msg)
+}
+
+func (hc *responseValidatingHandlerConn) SendWithEnvelopeFlags(msg any, flags []string) error {
+	if err := validateResponse(msg); err != nil {
+		return err
+	}
+	return SendWithEnvelopeFlags(hc.StreamingHandlerConn, msg, flags...)
+}
+
+func (hc *responseValidatingHandlerConn) ReceiveWithEnvelopeFlags(msg any) ([]string, error) {
+	return ReceiveWithEnvelopeFlags(hc.StreamingHandlerConn, msg)
+}
+
+func (hc *responseValidatingHandlerConn) CloseReceive() error {
+	return closeReceive(hc.StreamingHandlerConn)
+}
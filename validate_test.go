@@ -0,0 +1,79 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bufbuild/connect-go/internal/assert"
+)
+
+type validatedMessage struct {
+	valid bool
+}
+
+func (m *validatedMessage) Validate() error {
+	if !m.valid {
+		return errors.New("not valid")
+	}
+	return nil
+}
+
+func TestResponseValidationInterceptor(t *testing.T) {
+	t.Parallel()
+	interceptor := &responseValidationInterceptor{}
+	t.Run("unary", func(t *testing.T) {
+		t.Parallel()
+		unary := func(valid bool) UnaryFunc {
+			return interceptor.WrapUnary(func(context.Context, AnyRequest) (AnyResponse, error) {
+				return NewResponse(&validatedMessage{valid: valid}), nil
+			})
+		}
+		_, err := unary(true)(context.Background(), NewRequest(&validatedMessage{}))
+		assert.Nil(t, err)
+		_, err = unary(false)(context.Background(), NewRequest(&validatedMessage{}))
+		assert.Equal(t, CodeOf(err), CodeInternal)
+	})
+	t.Run("handler_stream", func(t *testing.T) {
+		t.Parallel()
+		handler := interceptor.WrapStreamingHandler(func(_ context.Context, conn StreamingHandlerConn) error {
+			if err := conn.Send(&validatedMessage{valid: true}); err != nil {
+				return err
+			}
+			return conn.Send(&validatedMessage{valid: false})
+		})
+		conn := &sendRecordingHandlerConn{}
+		err := handler(context.Background(), conn)
+		assert.Equal(t, CodeOf(err), CodeInternal)
+		assert.Equal(t, len(conn.sent), 1)
+	})
+	t.Run("unvalidated", func(t *testing.T) {
+		t.Parallel()
+		assert.Nil(t, validateResponse(struct{}{}))
+	})
+}
+
+type sendRecordingHandlerConn struct {
+	StreamingHandlerConn
+
+	sent []any
+}
+
+func (c *sendRecordingHandlerConn) Send(msg any) error {
+	c.sent = append(c.sent, msg)
+	return nil
+}
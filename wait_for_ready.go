@@ -0,0 +1,139 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var waitForReadyContextValue = NewContextValue[bool]("connect wait for ready")
+
+// ContextWithWaitForReady returns a copy of ctx that overrides
+// [WithWaitForReady] for calls made with the context.
+func ContextWithWaitForReady(ctx context.Context, enabled bool) context.Context {
+	return waitForReadyContextValue.With(ctx, enabled)
+}
+
+// waitForReadyClient retries requests that fail because the client couldn't
+// connect to the server. The request hasn't been sent when dialing fails, so
+// it's safe to retry any call, including streams.
+type waitForReadyClient struct {
+	next    HTTPClient
+	enabled bool
+	retrier *retrier
+}
+
+func newWaitForReadyClient(next HTTPClient, enabled bool) *waitForReadyClient {
+	return &waitForReadyClient{
+		next:    next,
+		enabled: enabled,
+		retrier: newRetrier(RetryPolicy{}),
+	}
+}
+
+func (c *waitForReadyClient) Do(request *http.Request) (*http.Response, error) {
+	ctx := request.Context()
+	enabled := c.enabled
+	if override, ok := waitForReadyContextValue.From(ctx); ok {
+		enabled = override
+	}
+	if !enabled {
+		return c.next.Do(request)
+	}
+	var body *readyBody
+	if request.Body != nil && request.Body != http.NoBody {
+		// HTTP clients close the request body when they fail, but we need it
+		// for the next attempt.
+		body = &readyBody{ReadCloser: request.Body}
+		request.Body = body
+	}
+	for attempt := 1; ; attempt++ {
+		response, err := c.next.Do(request)
+		if err == nil || !isDialError(err) || ctx.Err() != nil || (body != nil && body.started()) {
+			if body != nil {
+				body.release()
+			}
+			return response, err
+		}
+		delay, _ := c.retrier.delay(&c.retrier.policy, attempt, err)
+		if err := sleepBeforeRetry(ctx, attempt, func(int) time.Duration { return delay }); err != nil {
+			if body != nil {
+				body.release()
+			}
+			return nil, err
+		}
+	}
+}
+
+// isDialError reports whether the client failed to connect to the server (or
+// its proxy).
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && (opErr.Op == "dial" || opErr.Op == "proxyconnect")
+}
+
+// readyBody defers closing a request body until the request has connected.
+// Once the body has been read, the request can't be retried, so Close takes
+// effect immediately.
+type readyBody struct {
+	io.ReadCloser
+
+	mu       sync.Mutex
+	read     bool
+	released bool
+	closed   bool
+}
+
+func (b *readyBody) Read(data []byte) (int, error) {
+	b.mu.Lock()
+	b.read = true
+	b.mu.Unlock()
+	return b.ReadCloser.Read(data)
+}
+
+func (b *readyBody) Close() error {
+	b.mu.Lock()
+	if !b.read && !b.released {
+		b.closed = true
+		b.mu.Unlock()
+		return nil
+	}
+	b.mu.Unlock()
+	return b.ReadCloser.Close()
+}
+
+func (b *readyBody) started() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.read
+}
+
+// release stops deferring Close, and closes the body if the HTTP client
+// already tried to.
+func (b *readyBody) release() {
+	b.mu.Lock()
+	b.released = true
+	closed := b.closed
+	b.mu.Unlock()
+	if closed {
+		_ = b.ReadCloser.Close()
+	}
+}
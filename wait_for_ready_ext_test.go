@@ -0,0 +1,100 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/bufbuild/connect-go/internal/assert"
+	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
+	"github.com/bufbuild/connect-go/internal/gen/connect/ping/v1/pingv1connect"
+)
+
+func TestWaitForReady(t *testing.T) {
+	t.Parallel()
+	// Reserve an address, then release it so that dialing fails until the
+	// server starts.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	addr := listener.Addr().String()
+	assert.Nil(t, listener.Close())
+	url := "http://" + addr
+	ping := func(ctx context.Context, client pingv1connect.PingServiceClient) error {
+		_, err := client.Ping(ctx, connect.NewRequest(&pingv1.PingRequest{Number: 42}))
+		return err
+	}
+
+	// While the server is down, calls without wait-for-ready fail
+	// immediately, and calls with it wait until their deadline.
+	client := pingv1connect.NewPingServiceClient(http.DefaultClient, url)
+	assert.Equal(t, connect.CodeOf(ping(context.Background(), client)), connect.CodeUnavailable)
+	waiting := pingv1connect.NewPingServiceClient(http.DefaultClient, url, connect.WithWaitForReady())
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	start := time.Now()
+	err = ping(ctx, waiting)
+	cancel()
+	assert.Equal(t, connect.CodeOf(err), connect.CodeDeadlineExceeded)
+	assert.True(t, time.Since(start) >= 200*time.Millisecond)
+	ctx = connect.ContextWithWaitForReady(context.Background(), false)
+	assert.Equal(t, connect.CodeOf(ping(ctx, waiting)), connect.CodeUnavailable)
+
+	// Once the server starts, waiting calls go through.
+	unaryDone := make(chan error, 1)
+	streamDone := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		unaryDone <- ping(ctx, waiting)
+	}()
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		stream, err := waiting.CountUp(ctx, connect.NewRequest(&pingv1.CountUpRequest{Number: 3}))
+		if err != nil {
+			streamDone <- err
+			return
+		}
+		var count int
+		for stream.Receive() {
+			count++
+		}
+		if count != 3 {
+			streamDone <- fmt.Errorf("got %d messages, expected 3", count)
+			return
+		}
+		streamDone <- stream.Close()
+	}()
+	time.Sleep(200 * time.Millisecond)
+	listener, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("address %s reused before the server started: %v", addr, err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	server := httptest.NewUnstartedServer(mux)
+	assert.Nil(t, server.Listener.Close())
+	server.Listener = listener
+	server.Start()
+	t.Cleanup(server.Close)
+	assert.Nil(t, <-unaryDone)
+	assert.Nil(t, <-streamDone)
+}
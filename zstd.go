@@ -0,0 +1,63 @@
+// Copyright 2021-2022 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	compressionZstd = "zstd"
+	// zstdMaxWindow is the largest window zstd decompressors accept. RFC 9659
+	// requires HTTP recipients to support windows of up to 8 MiB, and allows
+	// them to reject larger windows so that senders can't force large
+	// allocations.
+	zstdMaxWindow = 8 << 20
+)
+
+// zstdDecompressor adapts zstd.Decoder to the Decompressor interface. Closing
+// a zstd.Decoder releases it permanently, so Close is a no-op and pooled
+// decompressors are reused with Reset.
+type zstdDecompressor struct {
+	*zstd.Decoder
+}
+
+func newZstdDecompressor() Decompressor {
+	// With a concurrency of 1, the decoder runs synchronously and doesn't start
+	// goroutines, so it's safe to drop from the pool without closing it. The
+	// options are valid, so NewReader can't fail.
+	decoder, _ := zstd.NewReader(
+		nil,
+		zstd.WithDecoderConcurrency(1),
+		zstd.WithDecoderMaxWindow(zstdMaxWindow),
+	)
+	return &zstdDecompressor{Decoder: decoder}
+}
+
+func (d *zstdDecompressor) Close() error {
+	return nil
+}
+
+func newZstdCompressor() Compressor {
+	// As above, a concurrency of 1 avoids background goroutines.
+	encoder, _ := zstd.NewWriter(
+		io.Discard,
+		zstd.WithEncoderConcurrency(1),
+		zstd.WithWindowSize(zstdMaxWindow),
+	)
+	return encoder
+}